@@ -0,0 +1,418 @@
+// CubicLog Admin Settings - Change the running configuration without a restart
+//
+//   - GET    /api/admin/config                 the runtime settings, whether each
+//     comes from its flag or was changed here, and who changed it last
+//   - PUT    /api/admin/config                 change settings, e.g. {"retention_days": 14};
+//     settings left out stay as they are
+//   - DELETE /api/admin/config?setting=NAME    go back to the flag value
+//   - GET    /api/admin/audit                  configuration changes, newest first
+//     (?setting= narrows them down, ?limit= defaults to 100)
+//
+// Settings:
+//   - retention_days    like -retention; the next cleanup applies it, POST
+//     /api/retention/run applies it right away
+//   - escalation_rules  the rules of the -escalation-file (see escalation.go);
+//     their counters start over when the rules change
+//   - pattern_packs     like -pattern-packs, e.g. ["ecommerce", "iot"] (see
+//     patternpacks.go)
+//   - source_pattern_packs  sources with their own pattern packs, e.g.
+//     {"sensor-gateway": ["iot"]}; there is no flag for it
+//
+// An update is validated like the flag or file it replaces, and an invalid
+// update changes nothing. Changed settings are kept in runtime_config, so they
+// survive a restart and win over the flags until they are reset.
+//
+// API keys (/api/keys) and pattern overrides (/api/patterns) could already be
+// changed at runtime; the settings area of the dashboard manages them through
+// their own endpoints. Every change to any of them is written to config_audit
+// with the old and new value and who made it: key:<id> for a managed key,
+// api-key for the -api-key flag, anonymous when authentication is off.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Runtime settings
+const (
+	settingRetention    = "retention_days"
+	settingEscalations  = "escalation_rules"
+	settingPatternPacks = "pattern_packs"
+	settingSourcePacks  = "source_pattern_packs"
+)
+
+// runtimeSettings lists the settings in the order they are shown
+var runtimeSettings = []string{settingRetention, settingEscalations, settingPatternPacks, settingSourcePacks}
+
+// maxRetentionDays bounds retention_days (100 years)
+const maxRetentionDays = 36500
+
+// flagSettings holds the values set by flags and files, restored by a reset
+var flagSettings struct {
+	retentionDays   int
+	escalationRules []escalationRule
+	patternPacks    []string
+}
+
+// runtimeSetting is one setting as shown by GET /api/admin/config
+type runtimeSetting struct {
+	Value     interface{} `json:"value"`
+	FlagValue interface{} `json:"flag_value"`
+	Source    string      `json:"source"` // flag or runtime
+	UpdatedBy string      `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time  `json:"updated_at,omitempty"`
+}
+
+// configAuditEntry is one recorded configuration change
+type configAuditEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	Actor    string          `json:"actor"`
+	Setting  string          `json:"setting"`
+	OldValue json.RawMessage `json:"old_value"`
+	NewValue json.RawMessage `json:"new_value"`
+}
+
+// createRuntimeConfigTables creates the runtime settings and audit log tables
+func createRuntimeConfigTables() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS runtime_config (
+		setting    TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,  -- JSON
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS config_audit (
+		id        ` + alertIDColumn() + `,
+		at        TIMESTAMP NOT NULL,
+		actor     TEXT NOT NULL,
+		setting   TEXT NOT NULL,
+		old_value TEXT NOT NULL,  -- JSON
+		new_value TEXT NOT NULL   -- JSON
+	);
+	CREATE INDEX IF NOT EXISTS idx_config_audit_at ON config_audit(at);
+	`)
+	return err
+}
+
+// loadRuntimeConfig remembers the flag values and applies the settings changed at runtime
+func loadRuntimeConfig() error {
+	flagSettings.retentionDays = currentRetention()
+	flagSettings.escalationRules = currentEscalationRules()
+	flagSettings.patternPacks, _ = currentPackSelection()
+
+	rows, err := db.Query("SELECT setting, value FROM runtime_config")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var setting, value string
+		if err := rows.Scan(&setting, &value); err != nil {
+			return err
+		}
+		if err := applySetting(setting, []byte(value)); err != nil {
+			return fmt.Errorf("%s: %v", setting, err)
+		}
+	}
+	return rows.Err()
+}
+
+// currentEscalationRules returns a copy of the active escalation rules
+func currentEscalationRules() []escalationRule {
+	tracker := escalations
+	if tracker == nil {
+		return []escalationRule{}
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return append([]escalationRule{}, tracker.rules...)
+}
+
+// settingValue returns the current value of a setting
+func settingValue(setting string) interface{} {
+	instance, sources := currentPackSelection()
+	switch setting {
+	case settingRetention:
+		return currentRetention()
+	case settingPatternPacks:
+		return instance
+	case settingSourcePacks:
+		return sources
+	}
+	return currentEscalationRules()
+}
+
+// flagValue returns the value a setting has without runtime changes
+func flagValue(setting string) interface{} {
+	switch setting {
+	case settingRetention:
+		return flagSettings.retentionDays
+	case settingPatternPacks:
+		return append([]string{}, flagSettings.patternPacks...)
+	case settingSourcePacks:
+		return map[string][]string{}
+	}
+	return append([]escalationRule{}, flagSettings.escalationRules...)
+}
+
+// validateSetting checks a new value; it returns what applySetting would apply
+func validateSetting(setting string, value []byte) (interface{}, error) {
+	switch setting {
+	case settingRetention:
+		var days int
+		if err := json.Unmarshal(value, &days); err != nil {
+			return nil, fmt.Errorf("must be a number of days")
+		}
+		if days < 1 || days > maxRetentionDays {
+			return nil, fmt.Errorf("must be between 1 and %d days", maxRetentionDays)
+		}
+		return days, nil
+	case settingEscalations:
+		var rules []escalationRule
+		if err := json.Unmarshal(value, &rules); err != nil {
+			return nil, fmt.Errorf("must be a list of rules: %v", err)
+		}
+		names := map[string]bool{}
+		for i := range rules {
+			if err := normalizeEscalationRule(&rules[i]); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+			if names[rules[i].Name] {
+				return nil, fmt.Errorf("rule %d: '%s' is used twice", i+1, rules[i].Name)
+			}
+			names[rules[i].Name] = true
+		}
+		if rules == nil {
+			rules = []escalationRule{}
+		}
+		return rules, nil
+	case settingPatternPacks:
+		var names []string
+		if err := json.Unmarshal(value, &names); err != nil {
+			return nil, fmt.Errorf("must be a list of pattern pack names")
+		}
+		return parsePackNames(names)
+	case settingSourcePacks:
+		var sources map[string][]string
+		if err := json.Unmarshal(value, &sources); err != nil {
+			return nil, fmt.Errorf("must map sources to lists of pattern pack names")
+		}
+		return validateSourcePacks(sources)
+	}
+	return nil, fmt.Errorf("unknown setting")
+}
+
+// applySetting validates a value and makes it the running configuration
+func applySetting(setting string, value []byte) error {
+	valid, err := validateSetting(setting, value)
+	if err != nil {
+		return err
+	}
+	switch setting {
+	case settingRetention:
+		setRetention(valid.(int))
+	case settingEscalations:
+		setEscalationRules(valid.([]escalationRule))
+	case settingPatternPacks, settingSourcePacks:
+		instance, sources := currentPackSelection()
+		if setting == settingPatternPacks {
+			instance = valid.([]string)
+		} else {
+			sources = valid.(map[string][]string)
+		}
+		setPackSelection(instance, sources)
+		return loadPatterns()
+	}
+	return nil
+}
+
+// setEscalationRules replaces the escalation rules; without rules escalation is off
+func setEscalationRules(rules []escalationRule) {
+	if len(rules) == 0 {
+		escalations = nil
+		return
+	}
+	escalations = &escalationTracker{rules: rules, windows: make(map[string]*escalationWindow)}
+}
+
+// configActor names who changes the configuration, for the audit log
+func configActor(r *http.Request) string {
+	presented := requestAPIKey(r)
+	if id := managedKeyID(presented); id != "" {
+		return "key:" + id
+	}
+	if presented != "" {
+		return "api-key"
+	}
+	return "anonymous"
+}
+
+// recordConfigChange writes a change to the audit log; a failure is only
+// logged, the change itself has been made
+func recordConfigChange(actor, setting string, oldValue, newValue interface{}) {
+	oldJSON, _ := json.Marshal(oldValue)
+	newJSON, _ := json.Marshal(newValue)
+	if _, err := db.Exec(db.Rebind("INSERT INTO config_audit (at, actor, setting, old_value, new_value) VALUES (?, ?, ?, ?, ?)"),
+		dbTime(time.Now()), actor, setting, string(oldJSON), string(newJSON)); err != nil {
+		log.Printf("⚠️  Could not record the change of %s in the audit log: %v", setting, err)
+		return
+	}
+	log.Printf("⚙️  %s changed %s", actor, setting)
+}
+
+// saveSetting stores a setting changed at runtime
+func saveSetting(setting string, value interface{}, actor string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(db.Rebind(`INSERT INTO runtime_config (setting, value, updated_by, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (setting) DO UPDATE SET value = excluded.value, updated_by = excluded.updated_by, updated_at = excluded.updated_at`),
+		setting, string(data), actor, dbTime(time.Now()))
+	return err
+}
+
+// loadSettingsView returns every setting with its value and origin
+func loadSettingsView() (map[string]runtimeSetting, error) {
+	view := map[string]runtimeSetting{}
+	for _, setting := range runtimeSettings {
+		view[setting] = runtimeSetting{Value: settingValue(setting), FlagValue: flagValue(setting), Source: "flag"}
+	}
+	rows, err := db.Query("SELECT setting, updated_by, updated_at FROM runtime_config")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var setting, updatedBy string
+		var updatedAt time.Time
+		if err := rows.Scan(&setting, &updatedBy, (*scanTime)(&updatedAt)); err != nil {
+			return nil, err
+		}
+		if current, ok := view[setting]; ok {
+			current.Source, current.UpdatedBy, current.UpdatedAt = "runtime", updatedBy, &updatedAt
+			view[setting] = current
+		}
+	}
+	return view, rows.Err()
+}
+
+// handleAdminConfig answers GET, PUT and DELETE /api/admin/config
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	actor := configActor(r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var request map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		// Validate everything before changing anything
+		changed := map[string]interface{}{}
+		for setting, value := range request {
+			valid, err := validateSetting(setting, value)
+			if err != nil {
+				http.Error(w, setting+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			changed[setting] = valid
+		}
+		for _, setting := range runtimeSettings {
+			value, ok := changed[setting]
+			if !ok {
+				continue
+			}
+			old := settingValue(setting)
+			oldJSON, _ := json.Marshal(old)
+			newJSON, _ := json.Marshal(value)
+			if bytes.Equal(oldJSON, newJSON) {
+				continue
+			}
+			if err := saveSetting(setting, value, actor); err != nil {
+				http.Error(w, "Failed to save "+setting, http.StatusInternalServerError)
+				return
+			}
+			applySetting(setting, newJSON)
+			recordConfigChange(actor, setting, old, value)
+		}
+	case http.MethodDelete:
+		setting := r.URL.Query().Get("setting")
+		if !containsString(runtimeSettings, setting) {
+			http.Error(w, "Unknown setting", http.StatusBadRequest)
+			return
+		}
+		result, err := db.Exec(db.Rebind("DELETE FROM runtime_config WHERE setting = ?"), setting)
+		if err != nil {
+			http.Error(w, "Failed to reset "+setting, http.StatusInternalServerError)
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			old, value := settingValue(setting), flagValue(setting)
+			data, _ := json.Marshal(value)
+			applySetting(setting, data)
+			recordConfigChange(actor, setting, old, value)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	view, err := loadSettingsView()
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"settings": view})
+}
+
+// handleConfigAudit answers GET /api/admin/audit
+func handleConfigAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	query := "SELECT id, at, actor, setting, old_value, new_value FROM config_audit"
+	args := []interface{}{}
+	// setting=patterns includes every pattern list (patterns.severity, ...)
+	if setting := r.URL.Query().Get("setting"); setting != "" {
+		query += " WHERE setting = ? OR setting LIKE ?"
+		args = append(args, setting, setting+".%")
+	}
+	rows, err := db.Query(db.Rebind(query+" ORDER BY id DESC LIMIT "+strconv.Itoa(limit)), args...)
+	if err != nil {
+		http.Error(w, "Failed to load the audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	entries := []configAuditEntry{}
+	for rows.Next() {
+		var entry configAuditEntry
+		var oldValue, newValue string
+		if err := rows.Scan(&entry.ID, (*scanTime)(&entry.At), &entry.Actor, &entry.Setting, &oldValue, &newValue); err != nil {
+			http.Error(w, "Failed to load the audit log", http.StatusInternalServerError)
+			return
+		}
+		entry.OldValue, entry.NewValue = json.RawMessage(oldValue), json.RawMessage(newValue)
+		entries = append(entries, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAdminConfig tests changing, persisting, resetting and auditing runtime settings
+func TestAdminConfig(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { setRetention(30); escalations = nil; keyring.keys = nil }()
+
+	setRetention(30)
+	escalations = nil
+	if err := loadRuntimeConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(method, path, body string) (*httptest.ResponseRecorder, map[string]runtimeSetting) {
+		w := httptest.NewRecorder()
+		handleAdminConfig(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var response struct {
+			Settings map[string]runtimeSetting `json:"settings"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response.Settings
+	}
+
+	// A valid update applies right away and names its origin
+	w, settings := call("PUT", "/api/admin/config", `{"retention_days": 14, "escalation_rules": [{"name": "flood", "threshold": 5, "window": "1m"}]}`)
+	if w.Code != http.StatusOK || settings[settingRetention].Source != "runtime" || settings[settingRetention].FlagValue != float64(30) {
+		t.Fatalf("Expected the settings changed, got %d: %s", w.Code, w.Body.String())
+	}
+	if currentRetention() != 14 || escalations == nil || escalations.rules[0].EscalateTo != "critical" {
+		t.Errorf("Expected retention 14 and the flood rule active, got %d and %+v", currentRetention(), escalations)
+	}
+
+	// An invalid update changes nothing
+	for _, body := range []string{
+		`{"retention_days": 7, "escalation_rules": [{"name": "flood", "threshold": 0, "window": "1m"}]}`,
+		`{"retention_days": 0}`,
+		`{"escalation_rules": [{"name": "a", "threshold": 1, "window": "1m"}, {"name": "a", "threshold": 2, "window": "1m"}]}`,
+		`{"log_level": "debug"}`,
+	} {
+		if w, _ := call("PUT", "/api/admin/config", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if currentRetention() != 14 {
+		t.Errorf("Expected retention unchanged after invalid updates, got %d", currentRetention())
+	}
+
+	// Changes survive a restart and win over the flags
+	setRetention(30)
+	escalations = nil
+	if err := loadRuntimeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if currentRetention() != 14 || escalations == nil {
+		t.Errorf("Expected the stored settings applied on start, got %d and %+v", currentRetention(), escalations)
+	}
+
+	// A reset goes back to the flag value
+	if _, settings = call("DELETE", "/api/admin/config?setting=retention_days", ""); currentRetention() != 30 || settings[settingRetention].Source != "flag" {
+		t.Errorf("Expected retention back at the flag value, got %d (%+v)", currentRetention(), settings[settingRetention])
+	}
+
+	// Key changes land in the same audit log
+	handleAPIKeys(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/keys", strings.NewReader(`{"name":"ci"}`)))
+
+	audit := func(query string) []configAuditEntry {
+		w := httptest.NewRecorder()
+		handleConfigAudit(w, httptest.NewRequest("GET", "/api/admin/audit"+query, nil))
+		var response struct {
+			Entries []configAuditEntry `json:"entries"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Entries
+	}
+	entries := audit("")
+	if len(entries) != 4 || entries[0].Setting != "api_keys" || entries[1].Setting != settingRetention ||
+		string(entries[1].OldValue) != "14" || string(entries[1].NewValue) != "30" || entries[1].Actor != "anonymous" {
+		t.Fatalf("Expected the key, reset and both updates audited newest first, got %+v", entries)
+	}
+	if entries := audit("?setting=escalation_rules"); len(entries) != 1 || string(entries[0].OldValue) != "[]" {
+		t.Errorf("Expected one escalation change from no rules, got %+v", entries)
+	}
+}
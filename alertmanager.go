@@ -0,0 +1,264 @@
+// CubicLog Alertmanager - Infrastructure alerts on the same timeline as application logs
+//
+//	POST /api/ingest/alertmanager
+//
+// Point a Prometheus Alertmanager webhook receiver at CubicLog:
+//
+//	receivers:
+//	  - name: cubiclog
+//	    webhook_configs:
+//	      - url: http://cubiclog:8080/api/ingest/alertmanager
+//	        send_resolved: true
+//	        http_config:
+//	          authorization:
+//	            credentials: <api key>
+//
+// Every alert of a notification becomes one log, stored like a POST /api/logs
+// (quotas, escalations, environments, encryption and ?dry_run=true apply):
+//   - title "[FIRING] <alertname>" or "[RESOLVED] <alertname>", followed by the
+//     summary annotation; the description annotation is the description
+//   - severity from the severity label (critical/page, error, warning, info),
+//     warning for firing alerts without one, success once resolved
+//   - source from the service or job label, "alertmanager" without either
+//   - the labels as body fields, next to alert_status, fingerprint, starts_at,
+//     ends_at, generator_url, receiver and the annotations
+//
+// The answer lists the stored log IDs, and every alert's id, status and
+// derived metadata in "items" (see ingestack.go). An alert that can't be stored
+// is acknowledged as rejected and the other alerts are still stored; only when
+// none could be stored is the notification answered with that error status, so
+// Alertmanager retries it without storing an alert twice.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// alertmanagerSource is the source of alerts without a service or job label
+const alertmanagerSource = "alertmanager"
+
+// alertmanagerSeverities maps severity label values to CubicLog severities
+var alertmanagerSeverities = map[string]string{
+	"critical": "critical", "page": "critical", "emergency": "critical", "fatal": "critical",
+	"error": "error", "high": "error", "major": "error",
+	"warning": "warning", "warn": "warning", "medium": "warning", "minor": "warning",
+	"info": "info", "informational": "info", "low": "info", "none": "info",
+}
+
+// alertmanagerPayload is an Alertmanager webhook notification (version 4)
+type alertmanagerPayload struct {
+	Status   string              `json:"status"`
+	Receiver string              `json:"receiver"`
+	Alerts   []alertmanagerAlert `json:"alerts"`
+}
+
+// alertmanagerAlert is one alert of a notification
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// severity returns the CubicLog severity of an alert
+func (a alertmanagerAlert) severity() string {
+	if a.Status == "resolved" {
+		return "success"
+	}
+	if severity, ok := alertmanagerSeverities[strings.ToLower(a.Labels["severity"])]; ok {
+		return severity
+	}
+	return "warning"
+}
+
+// toLog converts an alert into a log and its severity
+func (a alertmanagerAlert) toLog(receiver string) (Log, string) {
+	severity := a.severity()
+	status := strings.ToLower(a.Status)
+	if status == "" {
+		status = "firing"
+	}
+	name := a.Labels["alertname"]
+	if name == "" {
+		name = "Alert"
+	}
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(status), name)
+	if summary := a.Annotations["summary"]; summary != "" {
+		title += " - " + summary
+	}
+
+	body := map[string]interface{}{}
+	for name, value := range a.Labels {
+		body[name] = value
+	}
+	annotations := map[string]interface{}{}
+	for name, value := range a.Annotations {
+		annotations[name] = value
+	}
+	body["alert_status"] = status
+	body["annotations"] = annotations
+	if a.Fingerprint != "" {
+		body["fingerprint"] = a.Fingerprint
+	}
+	if !a.StartsAt.IsZero() {
+		body["starts_at"] = a.StartsAt.UTC().Format(time.RFC3339)
+	}
+	// Firing alerts carry an expected end far in the future (or none at all)
+	if status == "resolved" && !a.EndsAt.IsZero() {
+		body["ends_at"] = a.EndsAt.UTC().Format(time.RFC3339)
+	}
+	if a.GeneratorURL != "" {
+		body["generator_url"] = a.GeneratorURL
+	}
+	if receiver != "" {
+		body["receiver"] = receiver
+	}
+
+	source := a.Labels["service"]
+	if source == "" {
+		source = a.Labels["job"]
+	}
+	if source == "" {
+		source = alertmanagerSource
+	}
+	logType := severity
+	if logType == "critical" {
+		logType = "error"
+	}
+	return Log{Header: LogHeader{
+		Type:        logType,
+		Title:       title,
+		Description: a.Annotations["description"],
+		Source:      source,
+		Color:       colorForLog(logType, LogMetadata{DerivedSeverity: severity, DerivedSource: source}),
+	}, Body: body}, severity
+}
+
+// handleAlertmanager answers POST /api/ingest/alertmanager
+func handleAlertmanager(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var payload alertmanagerPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, fmt.Sprintf("Request too large - limit is %d bytes", maxRequestBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid Alertmanager payload", http.StatusBadRequest)
+		return
+	}
+
+	ids, items := []int{}, []ingestAck{}
+	accepted, failedStatus, failedMessage := 0, 0, ""
+	for i, alert := range payload.Alerts {
+		entry, severity := alert.toLog(payload.Receiver)
+		status, ack, message := ingestLog(r, entry, severity)
+		if status >= 300 {
+			if failedStatus == 0 {
+				failedStatus, failedMessage = status, fmt.Sprintf("Alert '%s': %s", entry.Header.Title, message)
+			}
+		} else {
+			accepted++
+		}
+		if ack.ID != 0 {
+			ids = append(ids, ack.ID)
+		}
+		ack.Index = i
+		items = append(items, ack)
+	}
+	if accepted == 0 && failedStatus != 0 {
+		http.Error(w, failedMessage, failedStatus)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"received": len(payload.Alerts),
+		"ids":      ids,
+		"items":    items,
+	})
+}
+
+// ingestSeverityKey carries the severity a converted log already has (see ingestLog)
+type ingestSeverityKey struct{}
+
+// ingestSeverity returns the severity given by ingestLog ("" for logs sent to /api/logs)
+func ingestSeverity(r *http.Request) string {
+	severity, _ := r.Context().Value(ingestSeverityKey{}).(string)
+	return severity
+}
+
+// ingestRecorder captures createLog's answer for one converted log
+type ingestRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (i *ingestRecorder) Header() http.Header { return i.header }
+
+func (i *ingestRecorder) WriteHeader(status int) {
+	if i.status == 0 {
+		i.status = status
+	}
+}
+
+func (i *ingestRecorder) Write(p []byte) (int, error) {
+	if i.status == 0 {
+		i.status = http.StatusOK
+	}
+	return i.body.Write(p)
+}
+
+// ingestLog stores a log converted from another format through createLog, with
+// the API key, environment header and ?dry_run of the original request; a
+// severity other than "" replaces the derived one. Returns the HTTP status,
+// the acknowledgment (rejected for failures) and, for failures, the error message.
+func ingestLog(r *http.Request, entry Log, severity string) (int, ingestAck, string) {
+	var ack ingestAck
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return http.StatusBadRequest, ack, "invalid log"
+	}
+	ctx := context.WithValue(r.Context(), ingestMetadataKey{}, &ack.LogMetadata)
+	if severity != "" {
+		ctx = context.WithValue(ctx, ingestSeverityKey{}, severity)
+	}
+	converted := r.Clone(ctx)
+	converted.Body = io.NopCloser(bytes.NewReader(body))
+	converted.ContentLength = int64(len(body))
+
+	recorder := &ingestRecorder{header: http.Header{}}
+	createLog(recorder, converted)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	if recorder.status >= 300 {
+		message := strings.TrimSpace(recorder.body.String())
+		ack.Status, ack.Code, ack.Error = "rejected", recorder.status, message
+		return recorder.status, ack, message
+	}
+	var stored Log
+	json.Unmarshal(recorder.body.Bytes(), &stored)
+	ack.ID, ack.Status = stored.ID, ingestStatus(recorder.status, recorder.header)
+	return recorder.status, ack, ""
+}
+
+// ingestCollected stores a log CubicLog collected itself (see eventlog.go and docker.go) through ingestLog
+func ingestCollected(entry Log, severity string) (int, ingestAck, string) {
+	request, _ := http.NewRequest(http.MethodPost, "/api/logs", nil)
+	return ingestLog(request, entry, severity)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAlertmanagerWebhook tests turning Alertmanager notifications into logs
+func TestAlertmanagerWebhook(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	payload := `{
+		"version": "4",
+		"status": "firing",
+		"receiver": "cubiclog",
+		"alerts": [
+			{
+				"status": "firing",
+				"labels": {"alertname": "HighErrorRate", "severity": "critical", "job": "checkout", "instance": "web-1:9100"},
+				"annotations": {"summary": "Error rate above 5%", "description": "5xx responses are at 7.2%"},
+				"startsAt": "2024-05-01T10:00:00Z",
+				"endsAt": "0001-01-01T00:00:00Z",
+				"fingerprint": "c3a1f0"
+			},
+			{
+				"status": "resolved",
+				"labels": {"alertname": "DiskFilling", "severity": "warning"},
+				"annotations": {},
+				"startsAt": "2024-05-01T09:00:00Z",
+				"endsAt": "2024-05-01T09:30:00Z"
+			}
+		]
+	}`
+	w := httptest.NewRecorder()
+	handleAlertmanager(w, httptest.NewRequest("POST", "/api/ingest/alertmanager", strings.NewReader(payload)))
+	var result struct {
+		Received int   `json:"received"`
+		IDs      []int `json:"ids"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 200 || result.Received != 2 || len(result.IDs) != 2 {
+		t.Fatalf("Expected 2 stored alerts, got %d %+v", w.Code, result)
+	}
+
+	var title, description, source, severity, body string
+	db.QueryRow("SELECT title, description, source, derived_severity, body FROM logs WHERE id = ?", result.IDs[0]).
+		Scan(&title, &description, &source, &severity, &body)
+	if title != "[FIRING] HighErrorRate - Error rate above 5%" || description != "5xx responses are at 7.2%" {
+		t.Errorf("Unexpected title or description: %q %q", title, description)
+	}
+	if source != "checkout" || severity != "critical" {
+		t.Errorf("Expected source checkout and severity critical, got %s %s", source, severity)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal([]byte(body), &fields)
+	if fields["instance"] != "web-1:9100" || fields["alert_status"] != "firing" || fields["fingerprint"] != "c3a1f0" || fields["ends_at"] != nil {
+		t.Errorf("Expected the labels and alert details in the body, got %v", fields)
+	}
+
+	db.QueryRow("SELECT title, source, derived_severity FROM logs WHERE id = ?", result.IDs[1]).Scan(&title, &source, &severity)
+	if title != "[RESOLVED] DiskFilling" || source != alertmanagerSource || severity != "success" {
+		t.Errorf("Unexpected resolved alert: %q %s %s", title, source, severity)
+	}
+
+	w = httptest.NewRecorder()
+	handleAlertmanager(w, httptest.NewRequest("POST", "/api/ingest/alertmanager", strings.NewReader(`{"alerts": [`)))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an invalid payload, got %d", w.Code)
+	}
+}
+
+// TestAlertmanagerPartialFailure tests that an alert that can't be stored doesn't fail the others
+func TestAlertmanagerPartialFailure(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	originalBody, originalPolicy := maxBodyBytes, oversizePolicy
+	defer func() { maxBodyBytes, oversizePolicy = originalBody, originalPolicy }()
+	maxBodyBytes, oversizePolicy = 400, "reject"
+
+	payload := `{"receiver": "cubiclog", "alerts": [
+		{"status": "firing", "labels": {"alertname": "HighLatency"}, "annotations": {"runbook": "` + strings.Repeat("x", 500) + `"}},
+		{"status": "firing", "labels": {"alertname": "DiskFilling"}, "annotations": {}}
+	]}`
+	w := httptest.NewRecorder()
+	handleAlertmanager(w, httptest.NewRequest("POST", "/api/ingest/alertmanager", strings.NewReader(payload)))
+	var result struct {
+		IDs   []int       `json:"ids"`
+		Items []ingestAck `json:"items"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 200 || len(result.IDs) != 1 || len(result.Items) != 2 {
+		t.Fatalf("Expected 1 stored alert and 2 acknowledgments, got %d %s", w.Code, w.Body.String())
+	}
+	if result.Items[0].Status != "rejected" || result.Items[0].Code != 413 || result.Items[1].Status != "stored" {
+		t.Errorf("Expected the oversized alert rejected and the other stored, got %+v", result.Items)
+	}
+}
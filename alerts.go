@@ -0,0 +1,202 @@
+// CubicLog Alerts - Record fired alerts and deliver them to a webhook
+//
+// Features that detect something worth waking up for (escalation rules, ...)
+// fire an alert through fireAlert, which:
+//   - stores it in the alerts table (GET /api/alerts lists recent ones)
+//   - logs it with 🚨
+//   - POSTs it to -alert-webhook, if configured (as JSON, or rendered with
+//     -alert-template, see notifytemplate.go), recording the delivery (see
+//     deliveries.go)
+//
+// Alerts fired within the last hour also appear in /api/stats "alerts", so the
+// dashboard banner shows them, and in the notification center (see
+// notifications.go). Alerts muted by a silence (see silences.go) are only
+// stored.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// alertWebhookURL is the -alert-webhook setting - configured once in main()
+var alertWebhookURL string
+
+// alertWebhookClient delivers alerts; slow receivers must not pile up goroutines
+var alertWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// pendingDeliveries are alert deliveries in flight, waited for on shutdown
+var pendingDeliveries sync.WaitGroup
+
+// Alert is a fired alert
+type Alert struct {
+	ID       int64     `json:"id"`
+	Rule     string    `json:"rule"`
+	Kind     string    `json:"kind"` // which feature fired it, e.g. "escalation"
+	Source   string    `json:"source,omitempty"`
+	Severity string    `json:"severity"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+	LogIDs   []int64   `json:"log_ids,omitempty"` // sample of the logs that triggered it
+	FiredAt  time.Time `json:"fired_at"`
+
+	SilencedBy string `json:"silenced_by,omitempty"` // silence that muted it
+
+	// From the source registry (see sources.go), not stored with the alert
+	Owner      string `json:"owner,omitempty"`
+	RunbookURL string `json:"runbook_url,omitempty"`
+}
+
+// createAlertsTable creates the fired alert history
+func createAlertsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS alerts (
+		id       ` + alertIDColumn() + `,
+		rule     TEXT NOT NULL,
+		kind     TEXT NOT NULL,
+		source   TEXT,
+		severity TEXT NOT NULL,
+		title    TEXT NOT NULL,
+		message  TEXT NOT NULL,
+		count    INTEGER NOT NULL DEFAULT 0,
+		log_ids  TEXT,            -- JSON array
+		fired_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_alerts_fired_at ON alerts(fired_at);
+	`)
+	return err
+}
+
+// alertIDColumn is the auto-increment id column for the current driver
+func alertIDColumn() string {
+	if db.Driver() == "postgres" {
+		return "BIGSERIAL PRIMARY KEY"
+	}
+	return "INTEGER PRIMARY KEY AUTOINCREMENT"
+}
+
+// fireAlert records an alert and delivers it in the background
+func fireAlert(alert Alert) Alert {
+	if alert.FiredAt.IsZero() {
+		alert.FiredAt = time.Now().UTC().Truncate(time.Second)
+	}
+	alert.SilencedBy = silencedBy(alert)
+	alert = withSourceInfo(alert)
+	logIDs, _ := json.Marshal(alert.LogIDs)
+	id, err := db.InsertID(`INSERT INTO alerts (rule, kind, source, severity, title, message, count, log_ids, fired_at, silenced_by)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`,
+		alert.Rule, alert.Kind, alert.Source, alert.Severity, alert.Title, alert.Message, alert.Count, string(logIDs),
+		dbTime(alert.FiredAt), alert.SilencedBy)
+	if err != nil {
+		log.Printf("⚠️  Could not record alert %s: %v", alert.Rule, err)
+	}
+	alert.ID = id
+
+	if alert.SilencedBy != "" {
+		log.Printf("🔕 %s (silenced by %s): %s", alert.Title, alert.SilencedBy, alert.Message)
+		return alert
+	}
+	log.Printf("🚨 %s: %s", alert.Title, alert.Message)
+	notifyAlertWatchers()
+	if alertWebhookURL != "" {
+		pendingDeliveries.Add(1)
+		go func() {
+			defer pendingDeliveries.Done()
+			deliverAlert(alertWebhookURL, alert)
+		}()
+	}
+	return alert
+}
+
+// deliverAlert POSTs an alert to a webhook
+func deliverAlert(url string, alert Alert) {
+	payload, contentType, err := renderAlert(alert)
+	if err != nil {
+		log.Printf("⚠️  Alert template failed, sending plain JSON: %v", err)
+		payload, _ = json.Marshal(alert)
+		contentType = "application/json"
+	}
+	delivery := &Delivery{Kind: "alert", Reference: alert.ID, Target: url, contentType: contentType, payload: string(payload)}
+	code, err := postDelivery(delivery)
+	recordDelivery(delivery, code, err)
+	if err != nil {
+		log.Printf("⚠️  Alert webhook failed: %v", err)
+	}
+}
+
+// recentAlerts returns alerts fired since a point in time, newest first
+func recentAlerts(since time.Time, limit int) ([]Alert, error) {
+	rows, err := db.Query(db.Rebind(`SELECT id, rule, kind, COALESCE(source, ''), severity, title, message, count, COALESCE(log_ids, ''), fired_at, COALESCE(silenced_by, '')
+		FROM alerts WHERE fired_at >= ? ORDER BY fired_at DESC, id DESC LIMIT ?`), dbTime(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []Alert{}
+	for rows.Next() {
+		var alert Alert
+		var logIDs string
+		if err := rows.Scan(&alert.ID, &alert.Rule, &alert.Kind, &alert.Source, &alert.Severity, &alert.Title,
+			&alert.Message, &alert.Count, &logIDs, (*scanTime)(&alert.FiredAt), &alert.SilencedBy); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(logIDs), &alert.LogIDs)
+		alerts = append(alerts, withSourceInfo(alert))
+	}
+	return alerts, rows.Err()
+}
+
+// alertBanners returns the dashboard lines for alerts fired in the last hour
+func alertBanners() []string {
+	alerts, err := recentAlerts(time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		return nil
+	}
+	var banners []string
+	for _, alert := range alerts {
+		if alert.SilencedBy != "" {
+			continue
+		}
+		banner := fmt.Sprintf("%s: %s", alert.Title, alert.Message)
+		if alert.Owner != "" {
+			banner += " (owner: " + alert.Owner + ")"
+		}
+		banners = append(banners, banner)
+	}
+	return banners
+}
+
+// handleAlerts answers GET /api/alerts?since=24h&limit=100
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	since := 24 * time.Hour
+	if value := params.Get("since"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "since must be a duration like 1h or 168h", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	alerts, err := recentAlerts(time.Now().Add(-since), limit)
+	if err != nil {
+		http.Error(w, "Failed to load alerts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"alerts": alerts})
+}
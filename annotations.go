@@ -0,0 +1,234 @@
+// CubicLog Annotations - Deploy and config change markers for the charts
+//
+//   - POST   /api/annotations        record a marker
+//   - GET    /api/annotations        list markers (?since=24h, ?source=, ?environment=, ?kind=)
+//   - DELETE /api/annotations/{id}   remove a marker
+//
+// Annotations are events around the logs rather than logs themselves, so they
+// live in their own table and never count towards stats, alerts or retention:
+//
+//	{"kind": "deploy", "title": "checkout v2.4.1", "source": "checkout", "author": "ci"}
+//	{"kind": "config", "title": "Raised pool size to 50", "at": "2024-05-04T22:00:00Z"}
+//
+// at defaults to now; ends_at marks a span such as a maintenance window. The
+// dashboard draws them as vertical markers on the severity and error rate
+// charts, so an error spike right after a deploy is obvious. Kinds are
+// deploy, config, incident, maintenance and note (default deploy).
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// markerKinds are the kinds an annotation may have, the first is the default
+var markerKinds = []string{"deploy", "config", "incident", "maintenance", "note"}
+
+// Annotation is a marker event shown on the charts
+type Annotation struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Source      string     `json:"source,omitempty"`
+	Environment string     `json:"environment,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	At          *time.Time `json:"at"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// createAnnotationsTable creates the annotation table
+func createAnnotationsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS annotations (
+		id          TEXT PRIMARY KEY,
+		kind        TEXT NOT NULL,
+		title       TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		source      TEXT NOT NULL DEFAULT '',
+		environment TEXT NOT NULL DEFAULT '',
+		author      TEXT NOT NULL DEFAULT '',
+		occurred_at TIMESTAMP NOT NULL,
+		ends_at     TIMESTAMP,
+		created_at  TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_annotations_occurred_at ON annotations(occurred_at);
+	`)
+	return err
+}
+
+// prepare validates an annotation and fills in its defaults
+func (a *Annotation) prepare(now time.Time) error {
+	a.Kind = strings.ToLower(strings.TrimSpace(a.Kind))
+	if a.Kind == "" {
+		a.Kind = markerKinds[0]
+	}
+	if !containsString(markerKinds, a.Kind) {
+		return fmt.Errorf("kind must be one of %s", strings.Join(markerKinds, ", "))
+	}
+	a.Title = strings.TrimSpace(a.Title)
+	if a.Title == "" || len(a.Title) > 200 {
+		return fmt.Errorf("title is required and at most 200 characters")
+	}
+	a.Description, a.Source, a.Author = strings.TrimSpace(a.Description), strings.TrimSpace(a.Source), strings.TrimSpace(a.Author)
+	if len(a.Source) > 100 || len(a.Author) > 100 {
+		return fmt.Errorf("source and author must be at most 100 characters")
+	}
+	environment, err := normalizeEnvironment(a.Environment)
+	if err != nil {
+		return err
+	}
+	a.Environment = environment
+
+	at := now
+	if a.At != nil {
+		at = *a.At
+	}
+	at = at.UTC().Truncate(time.Second)
+	a.At = &at
+	if a.EndsAt != nil {
+		ends := a.EndsAt.UTC().Truncate(time.Second)
+		if ends.Before(at) {
+			return fmt.Errorf("ends_at must not be before at")
+		}
+		a.EndsAt = &ends
+	}
+	return nil
+}
+
+// listAnnotations returns the annotations at or after since, oldest first
+func listAnnotations(since time.Time, source, environment, kind string, limit int) ([]Annotation, error) {
+	query := "SELECT id, kind, title, description, source, environment, author, occurred_at, ends_at, created_at FROM annotations WHERE occurred_at >= ?"
+	args := []interface{}{dbTime(since)}
+	if source != "" {
+		// Annotations without a source (a config change, say) concern every source
+		query += " AND (source = ? OR source = '')"
+		args = append(args, source)
+	}
+	if environment != "" {
+		query += " AND (environment = ? OR environment = '')"
+		args = append(args, environment)
+	}
+	if kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	query += " ORDER BY occurred_at, id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	annotations := []Annotation{}
+	for rows.Next() {
+		var a Annotation
+		var at, endsAt time.Time
+		if err := rows.Scan(&a.ID, &a.Kind, &a.Title, &a.Description, &a.Source, &a.Environment, &a.Author,
+			(*scanTime)(&at), (*scanTime)(&endsAt), (*scanTime)(&a.CreatedAt)); err != nil {
+			return nil, err
+		}
+		a.At = &at
+		if !endsAt.IsZero() {
+			a.EndsAt = &endsAt
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+// handleAnnotations answers GET and POST /api/annotations
+func handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	now := time.Now()
+
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		since := 7 * 24 * time.Hour
+		if value := params.Get("since"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "since must be a duration like 24h or 168h", http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+		limit := 500
+		if value := params.Get("limit"); value != "" {
+			if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed <= 5000 {
+				limit = parsed
+			}
+		}
+		environment, err := normalizeEnvironment(params.Get("environment"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		annotations, err := listAnnotations(now.Add(-since), params.Get("source"), environment, params.Get("kind"), limit)
+		if err != nil {
+			http.Error(w, "Failed to load annotations", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"annotations": annotations})
+
+	case http.MethodPost:
+		var a Annotation
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := a.prepare(now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := make([]byte, 6)
+		rand.Read(id)
+		a.ID = "annotation-" + hex.EncodeToString(id)
+		a.CreatedAt = now.UTC().Truncate(time.Second)
+
+		var endsAt interface{}
+		if a.EndsAt != nil {
+			endsAt = dbTime(*a.EndsAt)
+		}
+		if _, err := db.Exec(db.Rebind(`INSERT INTO annotations (id, kind, title, description, source, environment, author, occurred_at, ends_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`), a.ID, a.Kind, a.Title, a.Description, a.Source, a.Environment, a.Author,
+			dbTime(*a.At), endsAt, dbTime(a.CreatedAt)); err != nil {
+			http.Error(w, "Failed to save annotation", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAnnotation answers DELETE /api/annotations/{id}
+func handleAnnotation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/annotations/")
+	result, err := db.Exec(db.Rebind("DELETE FROM annotations WHERE id = ?"), id)
+	if err != nil {
+		http.Error(w, "Failed to delete annotation", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "deleted", "id": id})
+}
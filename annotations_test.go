@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAnnotations tests recording, listing and deleting chart markers
+func TestAnnotations(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	record := func(body string) (int, Annotation) {
+		w := httptest.NewRecorder()
+		handleAnnotations(w, httptest.NewRequest("POST", "/api/annotations", strings.NewReader(body)))
+		var a Annotation
+		json.Unmarshal(w.Body.Bytes(), &a)
+		return w.Code, a
+	}
+	code, deploy := record(`{"title": "checkout v2.4.1", "source": "checkout", "environment": "prod", "author": "ci"}`)
+	if code != 201 || deploy.Kind != "deploy" || deploy.Environment != "production" || deploy.At == nil {
+		t.Fatalf("Expected a production deploy marker at now, got %d %+v", code, deploy)
+	}
+	record(`{"kind": "config", "title": "Raised pool size"}`)
+	record(`{"kind": "deploy", "title": "search v1.2", "source": "search"}`)
+	record(`{"kind": "note", "title": "Last year", "at": "2020-01-01T00:00:00Z"}`)
+	if code, _ := record(`{"kind": "party", "title": "Launch"}`); code != 400 {
+		t.Errorf("Expected status 400 for an unknown kind, got %d", code)
+	}
+
+	list := func(query string) []Annotation {
+		w := httptest.NewRecorder()
+		handleAnnotations(w, httptest.NewRequest("GET", "/api/annotations"+query, nil))
+		var response struct {
+			Annotations []Annotation `json:"annotations"`
+		}
+		json.NewDecoder(w.Body).Decode(&response)
+		return response.Annotations
+	}
+	if all := list(""); len(all) != 3 {
+		t.Errorf("Expected 3 markers in the last week, got %+v", all)
+	}
+	if checkout := list("?source=checkout"); len(checkout) != 2 || checkout[0].Source == "search" || checkout[1].Source == "search" {
+		t.Errorf("Expected the checkout deploy and the global config change, got %+v", checkout)
+	}
+
+	w := httptest.NewRecorder()
+	handleAnnotation(w, httptest.NewRequest("DELETE", "/api/annotations/"+deploy.ID, nil))
+	if w.Code != 200 || len(list("?source=checkout")) != 1 {
+		t.Errorf("Expected the deploy marker deleted, got %d", w.Code)
+	}
+}
@@ -0,0 +1,358 @@
+// CubicLog API Keys - Hashed, named keys that can be rotated without downtime
+//
+// Besides the single -api-key, keys can be managed at runtime:
+//   - POST   /api/keys                  {"name": "ci"} issues a key (the secret is
+//     only shown in this response); {"environment": "staging"} stamps that
+//     environment on every log sent with it (see environment.go)
+//   - GET    /api/keys                  lists keys without their secrets
+//   - POST   /api/keys/{id}/rotate      issues a new secret; the old one keeps
+//     working for ?grace= (default 24h) so clients can be redeployed
+//   - DELETE /api/keys/{id}             revokes a key immediately
+//   - cubiclog -create-key NAME         issues a key from the command line
+//
+// Only SHA-256 hashes of the secrets are stored (keys are 32 random bytes, so
+// a fast hash is enough), and presented keys are compared in constant time,
+// including the -api-key flag. Authentication is required as soon as -api-key
+// is set or at least one managed key exists; any valid key may manage keys.
+// Issued, rotated and revoked keys are recorded in the configuration audit
+// log (see adminconfig.go).
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiKeyPrefix marks managed keys so they are easy to spot in configs and leaks
+const apiKeyPrefix = "cl_"
+
+// defaultKeyGrace is how long a rotated secret keeps working
+const defaultKeyGrace = 24 * time.Hour
+
+// apiKey is a managed key as listed by GET /api/keys
+type apiKey struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Hint        string     `json:"hint"` // first characters of the current secret
+	Environment string     `json:"environment,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty"`
+	GraceUntil  *time.Time `json:"previous_valid_until,omitempty"`
+
+	hash         []byte
+	previousHash []byte
+}
+
+// keyring caches the managed keys for the auth middleware
+var keyring struct {
+	sync.RWMutex
+	keys []apiKey
+}
+
+// createAPIKeyTable creates the managed key table
+func createAPIKeyTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id             TEXT PRIMARY KEY,
+		name           TEXT NOT NULL,
+		hint           TEXT NOT NULL,
+		secret_hash    TEXT NOT NULL,  -- SHA-256 of the current secret
+		previous_hash  TEXT,           -- SHA-256 of the secret replaced by the last rotation
+		previous_until TIMESTAMP,      -- when the previous secret stops working
+		created_at     TIMESTAMP NOT NULL,
+		rotated_at     TIMESTAMP
+	);
+	`)
+	return err
+}
+
+// hashAPIKey returns the SHA-256 of a secret
+func hashAPIKey(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// newAPIKeySecret returns a random secret
+func newAPIKeySecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(secret), nil
+}
+
+// loadAPIKeys refreshes the keyring from the database
+func loadAPIKeys() error {
+	rows, err := db.Query("SELECT id, name, hint, COALESCE(environment, ''), secret_hash, COALESCE(previous_hash, ''), previous_until, created_at, rotated_at FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var keys []apiKey
+	for rows.Next() {
+		var key apiKey
+		var hash, previousHash string
+		var previousUntil, createdAt, rotatedAt time.Time
+		if err := rows.Scan(&key.ID, &key.Name, &key.Hint, &key.Environment, &hash, &previousHash,
+			(*scanTime)(&previousUntil), (*scanTime)(&createdAt), (*scanTime)(&rotatedAt)); err != nil {
+			return err
+		}
+		key.hash, _ = hex.DecodeString(hash)
+		key.previousHash, _ = hex.DecodeString(previousHash)
+		key.CreatedAt = createdAt
+		if !rotatedAt.IsZero() {
+			key.RotatedAt = &rotatedAt
+		}
+		if !previousUntil.IsZero() {
+			key.GraceUntil = &previousUntil
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	keyring.Lock()
+	keyring.keys = keys
+	keyring.Unlock()
+	return nil
+}
+
+// managedKeysExist reports whether any managed key is configured
+func managedKeysExist() bool {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	return len(keyring.keys) > 0
+}
+
+// validAPIKey checks a presented key against the flag key and the keyring in constant time
+func validAPIKey(presented, flagKey string) bool {
+	if presented == "" {
+		return false
+	}
+	hash := hashAPIKey(presented)
+	now := time.Now()
+	valid := 0
+	if flagKey != "" {
+		valid |= subtle.ConstantTimeCompare(hash, hashAPIKey(flagKey))
+	}
+
+	keyring.RLock()
+	defer keyring.RUnlock()
+	for _, key := range keyring.keys {
+		valid |= subtle.ConstantTimeCompare(hash, key.hash)
+		if key.GraceUntil != nil && now.Before(*key.GraceUntil) {
+			valid |= subtle.ConstantTimeCompare(hash, key.previousHash)
+		}
+	}
+	return valid == 1
+}
+
+// managedKeyID returns the ID of the managed key a secret belongs to ("" for
+// the -api-key flag, unknown or no key); call it on already authenticated keys
+func managedKeyID(presented string) string {
+	key, _ := managedKey(presented)
+	return key.ID
+}
+
+// managedKeyEnvironment returns the environment of the managed key a secret belongs to
+func managedKeyEnvironment(presented string) string {
+	key, _ := managedKey(presented)
+	return key.Environment
+}
+
+// managedKey finds the managed key a secret belongs to
+func managedKey(presented string) (apiKey, bool) {
+	if presented == "" {
+		return apiKey{}, false
+	}
+	hash := hashAPIKey(presented)
+	now := time.Now()
+	keyring.RLock()
+	defer keyring.RUnlock()
+	for _, key := range keyring.keys {
+		if subtle.ConstantTimeCompare(hash, key.hash) == 1 ||
+			(key.GraceUntil != nil && now.Before(*key.GraceUntil) && subtle.ConstantTimeCompare(hash, key.previousHash) == 1) {
+			return key, true
+		}
+	}
+	return apiKey{}, false
+}
+
+// dbTime formats a time the way the driver stores it
+func dbTime(t time.Time) interface{} {
+	if db.Driver() == "sqlite3" {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t.UTC()
+}
+
+// createAPIKey issues a new managed key and returns it with its secret
+func createAPIKey(name, environment string) (apiKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return apiKey{}, "", fmt.Errorf("name is required")
+	}
+	environment, err := normalizeEnvironment(environment)
+	if err != nil {
+		return apiKey{}, "", err
+	}
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return apiKey{}, "", err
+	}
+	id := make([]byte, 6)
+	rand.Read(id)
+
+	key := apiKey{ID: "key-" + hex.EncodeToString(id), Name: name, Hint: secret[:len(apiKeyPrefix)+6], Environment: environment, CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if _, err := db.Exec(db.Rebind("INSERT INTO api_keys (id, name, hint, environment, secret_hash, created_at) VALUES (?, ?, ?, NULLIF(?, ''), ?, ?)"),
+		key.ID, key.Name, key.Hint, key.Environment, hex.EncodeToString(hashAPIKey(secret)), dbTime(key.CreatedAt)); err != nil {
+		return apiKey{}, "", err
+	}
+	return key, secret, loadAPIKeys()
+}
+
+// rotateAPIKey replaces a key's secret, keeping the old one valid for grace
+func rotateAPIKey(id string, grace time.Duration) (apiKey, string, error) {
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return apiKey{}, "", err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := db.Exec(db.Rebind(`UPDATE api_keys
+		SET previous_hash = secret_hash, previous_until = ?, secret_hash = ?, hint = ?, rotated_at = ?
+		WHERE id = ?`), dbTime(now.Add(grace)), hex.EncodeToString(hashAPIKey(secret)), secret[:len(apiKeyPrefix)+6], dbTime(now), id)
+	if err != nil {
+		return apiKey{}, "", err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return apiKey{}, "", sql.ErrNoRows
+	}
+	if err := loadAPIKeys(); err != nil {
+		return apiKey{}, "", err
+	}
+	for _, key := range listAPIKeys() {
+		if key.ID == id {
+			return key, secret, nil
+		}
+	}
+	return apiKey{}, "", sql.ErrNoRows
+}
+
+// listAPIKeys returns the cached managed keys
+func listAPIKeys() []apiKey {
+	keyring.RLock()
+	defer keyring.RUnlock()
+	return append([]apiKey{}, keyring.keys...)
+}
+
+// findAPIKey returns a cached managed key by id
+func findAPIKey(id string) (apiKey, bool) {
+	for _, key := range listAPIKeys() {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return apiKey{}, false
+}
+
+// handleAPIKeys answers GET and POST /api/keys
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": listAPIKeys()})
+	case http.MethodPost:
+		var request struct {
+			Name        string `json:"name"`
+			Environment string `json:"environment"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		key, secret, err := createAPIKey(request.Name, request.Environment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordConfigChange(configActor(r), "api_keys", nil, key)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "secret": secret})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIKey answers POST /api/keys/{id}/rotate and DELETE /api/keys/{id}
+func handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	id, action, _ := strings.Cut(path, "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case action == "rotate" && r.Method == http.MethodPost:
+		grace := defaultKeyGrace
+		if value := r.URL.Query().Get("grace"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, "grace must be a duration like 24h or 0s", http.StatusBadRequest)
+				return
+			}
+			grace = parsed
+		}
+		previous, _ := findAPIKey(id)
+		key, secret, err := rotateAPIKey(id, grace)
+		if err == sql.ErrNoRows {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to rotate API key", http.StatusInternalServerError)
+			return
+		}
+		recordConfigChange(configActor(r), "api_keys", previous, key)
+		json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "secret": secret})
+	case action == "" && r.Method == http.MethodDelete:
+		revoked, _ := findAPIKey(id)
+		result, err := db.Exec(db.Rebind("DELETE FROM api_keys WHERE id = ?"), id)
+		if err != nil {
+			http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		loadAPIKeys()
+		recordConfigChange(configActor(r), "api_keys", revoked, nil)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "revoked", "id": id})
+	case action != "" && action != "rotate":
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreateKey implements the -create-key command
+func handleCreateKey(name string) {
+	key, secret, err := createAPIKey(name, "")
+	if err != nil {
+		fmt.Printf("❌ Could not create API key: %v\n", err)
+		os.Exit(1)
+	}
+	recordConfigChange("command-line", "api_keys", nil, key)
+	fmt.Printf("✅ Created API key %s (%s)\n", key.ID, key.Name)
+	fmt.Printf("   %s\n", secret)
+	fmt.Printf("ℹ️  Store it now - only its hash is kept. Authentication is now required for the API.\n")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAPIKeyRotation tests issuing, rotating with a grace period and revoking keys
+func TestAPIKeyRotation(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { keyring.keys = nil }()
+
+	protected := authMiddleware("", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	call := func(key string) int {
+		req := httptest.NewRequest("GET", "/api/logs", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		protected(w, req)
+		return w.Code
+	}
+	issued := func(w *httptest.ResponseRecorder) (string, string) {
+		var response struct {
+			Key    apiKey `json:"key"`
+			Secret string `json:"secret"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Key.ID, response.Secret
+	}
+
+	if code := call(""); code != http.StatusOK {
+		t.Errorf("Expected no authentication without keys, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handleAPIKeys(w, httptest.NewRequest("POST", "/api/keys", strings.NewReader(`{"name":"ci"}`)))
+	id, first := issued(w)
+	if w.Code != http.StatusCreated || !strings.HasPrefix(first, apiKeyPrefix) {
+		t.Fatalf("Expected a new key, got %d: %s", w.Code, w.Body.String())
+	}
+	var stored string
+	db.QueryRow("SELECT secret_hash FROM api_keys WHERE id = ?", id).Scan(&stored)
+	if strings.Contains(stored, first) || strings.Contains(w.Body.String(), stored) {
+		t.Errorf("Expected only the hash to be stored")
+	}
+	if call("") != http.StatusUnauthorized || call("wrong") != http.StatusUnauthorized || call(first) != http.StatusOK {
+		t.Errorf("Expected only the issued key to be accepted")
+	}
+
+	// The old secret keeps working during the grace period
+	w = httptest.NewRecorder()
+	handleAPIKey(w, httptest.NewRequest("POST", "/api/keys/"+id+"/rotate", nil))
+	_, second := issued(w)
+	if call(first) != http.StatusOK || call(second) != http.StatusOK {
+		t.Errorf("Expected both secrets to work during the grace period, got %d and %d", call(first), call(second))
+	}
+
+	// ...and stops immediately with grace=0
+	w = httptest.NewRecorder()
+	handleAPIKey(w, httptest.NewRequest("POST", "/api/keys/"+id+"/rotate?grace=0s", nil))
+	_, third := issued(w)
+	if call(second) != http.StatusUnauthorized || call(third) != http.StatusOK {
+		t.Errorf("Expected only the newest secret after rotating without grace")
+	}
+
+	w = httptest.NewRecorder()
+	handleAPIKey(w, httptest.NewRequest("DELETE", "/api/keys/"+id, nil))
+	if w.Code != http.StatusOK || call(third) != http.StatusOK || managedKeysExist() {
+		t.Errorf("Expected revoking the last key to turn authentication off, got %d", w.Code)
+	}
+	if code := authCode("secret", "Bearer secret"); code != http.StatusOK || authCode("secret", "secret2") != http.StatusUnauthorized {
+		t.Errorf("Expected the -api-key to be checked, got %d", code)
+	}
+}
+
+// authCode runs a request through authMiddleware with a flag key
+func authCode(flagKey, header string) int {
+	req := httptest.NewRequest("GET", "/api/logs", nil)
+	req.Header.Set("Authorization", header)
+	w := httptest.NewRecorder()
+	authMiddleware(flagKey, func(w http.ResponseWriter, r *http.Request) {})(w, req)
+	return w.Code
+}
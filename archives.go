@@ -0,0 +1,205 @@
+// CubicLog Archives - Search old partitions and backups next to the live database
+//
+//	cubiclog -attach /archive/logs-2021.db,/archive/logs-2022.db
+//	cubiclog -attach 'old=/backups/2019/logs.db,/archive/*.db'
+//
+// Each entry is a SQLite file (a moved-away monthly partition, a restored
+// backup, the database of a retired instance), a glob, or name=path; without
+// a name the file name is used ("logs-2021"). Archives are opened read-only
+// and never changed, cleaned up or migrated.
+//
+// Archives stay out of queries unless asked for, so day-to-day listings keep
+// their speed:
+//   - GET /api/logs?attach=all                 the live data plus every archive
+//   - GET /api/export/csv?attach=logs-2021     the live data plus named archives
+//   - GET /api/archives                        attached archives and their date ranges
+//
+// Archives outside the requested from/to range are skipped. A log that is in
+// both the live database and a backup shows up once, as identical rows are
+// merged. Together with monthly partitions at most 10 files can be read per
+// query; a query needing more is answered 400 instead of leaving files out.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// archiveDB is an attached read-only SQLite file
+type archiveDB struct {
+	Name   string    `json:"name"`
+	Path   string    `json:"path"`
+	Logs   int64     `json:"logs"`
+	Oldest time.Time `json:"oldest"`
+	Newest time.Time `json:"newest"`
+}
+
+// archives are the -attach databases - configured once in main()
+var archives []archiveDB
+
+// archiveNamePattern is what an archive name may look like
+var archiveNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// archiveURI opens an archive read-only when attached
+func archiveURI(path string) string {
+	return "file:" + path + "?mode=ro"
+}
+
+// configureArchives parses -attach and checks that every file is a CubicLog database
+func configureArchives(spec string) error {
+	archives = nil
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+	if db.Driver() != "sqlite3" {
+		return fmt.Errorf("-attach is only supported for SQLite")
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, path, named := strings.Cut(entry, "=")
+		if !named {
+			path = entry
+		}
+		paths, err := filepath.Glob(path)
+		if err != nil || len(paths) == 0 {
+			return fmt.Errorf("no database file matches %s", path)
+		}
+		if named && len(paths) > 1 {
+			return fmt.Errorf("%s matches %d files - named archives need exactly one", path, len(paths))
+		}
+		for _, path := range paths {
+			archive := archiveDB{Name: strings.ToLower(name), Path: path}
+			if !named {
+				archive.Name = strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+			}
+			if !archiveNamePattern.MatchString(archive.Name) {
+				return fmt.Errorf("invalid archive name '%s' - use up to 32 letters, digits, '-' or '_' (name=path)", archive.Name)
+			}
+			if seen[archive.Name] || archive.Name == "all" {
+				return fmt.Errorf("archive name '%s' is taken - give it another one with name=path", archive.Name)
+			}
+			seen[archive.Name] = true
+			if err := inspectArchive(&archive); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			archives = append(archives, archive)
+		}
+	}
+	if len(archives) > maxAttachedPartitions {
+		return fmt.Errorf("at most %d archives can be attached", maxAttachedPartitions)
+	}
+	return nil
+}
+
+// inspectArchive reads the size and date range of an archive
+func inspectArchive(archive *archiveDB) error {
+	if _, err := os.Stat(archive.Path); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS archive", archiveURI(archive.Path)); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE archive")
+
+	var oldest, newest time.Time
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*), MIN(timestamp), MAX(timestamp) FROM archive.logs").
+		Scan(&archive.Logs, (*scanTime)(&oldest), (*scanTime)(&newest)); err != nil {
+		return fmt.Errorf("not a CubicLog database (%v)", err)
+	}
+	archive.Oldest, archive.Newest = oldest.UTC(), newest.UTC()
+	return nil
+}
+
+// selectArchives resolves ?attach= ("all" or comma-separated names) to archives
+// overlapping [from, to]
+func selectArchives(value, from, to string) ([]archiveDB, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var selected []archiveDB
+	for _, archive := range archives {
+		if value == "all" || containsString(strings.Split(value, ","), archive.Name) {
+			selected = append(selected, archive)
+		}
+	}
+	if value != "all" {
+		for _, name := range strings.Split(value, ",") {
+			if !containsString(archiveNames(selected), name) {
+				return nil, fmt.Errorf("unknown archive '%s' - see GET /api/archives", name)
+			}
+		}
+	}
+
+	var inRange []archiveDB
+	for _, archive := range selected {
+		if archive.Logs == 0 {
+			continue
+		}
+		if len(from) >= 10 && from[:10] > archive.Newest.Format("2006-01-02") {
+			continue
+		}
+		if len(to) >= 10 && to[:10] < archive.Oldest.Format("2006-01-02") {
+			continue
+		}
+		inRange = append(inRange, archive)
+	}
+	return inRange, nil
+}
+
+// archiveNames returns the names of archives
+func archiveNames(list []archiveDB) []string {
+	names := make([]string, len(list))
+	for i, archive := range list {
+		names[i] = archive.Name
+	}
+	return names
+}
+
+// attachArchives adds the SELECTs reading archives to a query across
+// databases; identical rows merge with UNION so a backup doesn't show logs twice
+func attachArchives(ctx context.Context, conn *sql.Conn, selected []archiveDB, attached *[]string) (string, error) {
+	var union string
+	for i, archive := range selected {
+		alias := fmt.Sprintf("a%d", i)
+		if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+alias, archiveURI(archive.Path)); err != nil {
+			return "", fmt.Errorf("could not attach archive %s: %v", archive.Name, err)
+		}
+		*attached = append(*attached, alias)
+
+		missing, err := missingPartitionColumns(ctx, conn, alias, strings.Split(partitionColumns, ", "))
+		if err != nil {
+			return "", err
+		}
+		union += " UNION SELECT " + partitionSelect(missing) + " FROM " + alias + ".logs"
+	}
+	return union, nil
+}
+
+// handleArchives answers GET /api/archives
+func handleArchives(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	list := archives
+	if list == nil {
+		list = []archiveDB{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"archives": list})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// TestArchives tests searching attached archive databases with ?attach=
+func TestArchives(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer configureArchives("")
+
+	// An archive from 2021, one of whose logs is also in the live database
+	live := db
+	path := filepath.Join(t.TempDir(), "logs-2021.db")
+	var err error
+	if db, err = openStore("sqlite3", path); err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := createTable(); err != nil {
+		t.Fatalf("Failed to create archive tables: %v", err)
+	}
+	insert := `INSERT INTO logs (id, type, title, color, body, timestamp, derived_severity, derived_source)
+		VALUES (?, 'error', ?, 'red', '{}', ?, 'error', 'billing')`
+	db.Exec(insert, 1, "Invoice run failed", "2021-06-01 10:00:00")
+	db.Exec(insert, 2, "Ledger mismatch", "2021-06-02 10:00:00")
+	db.Close()
+	db = live
+	db.Exec(insert, 1, "Invoice run failed", "2021-06-01 10:00:00")
+	db.Exec(insert, 3, "Card declined", "2024-01-05 10:00:00")
+
+	if err := configureArchives("old=" + path); err != nil {
+		t.Fatalf("Expected the archive to attach, got %v", err)
+	}
+	if len(archives) != 1 || archives[0].Name != "old" || archives[0].Logs != 2 {
+		t.Fatalf("Expected one archive with 2 logs, got %+v", archives)
+	}
+
+	list := func(query string) (int, []Log) {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		return w.Code, logs
+	}
+	if _, logs := list(""); len(logs) != 2 {
+		t.Errorf("Expected only the 2 live logs without attach, got %d", len(logs))
+	}
+	if _, logs := list("?attach=all"); len(logs) != 3 {
+		t.Errorf("Expected 3 logs with the archive (the shared one once), got %+v", logs)
+	}
+	if _, logs := list("?attach=old&from=2024-01-05"); len(logs) != 1 {
+		t.Errorf("Expected the archive to be skipped outside its date range, got %d logs", len(logs))
+	}
+	if code, _ := list("?attach=backup"); code != 400 {
+		t.Errorf("Expected status 400 for an unknown archive, got %d", code)
+	}
+
+	if err := configureArchives(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("Expected an error for a missing archive file")
+	}
+}
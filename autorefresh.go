@@ -0,0 +1,32 @@
+// CubicLog Auto-Refresh - How often the dashboard asks for new logs
+//
+//	cubiclog -refresh-interval 15s
+//	cubiclog -refresh-interval 0     only refresh on demand
+//	GET /api/logs?since_id=1042     logs newer than the one the dashboard saw last
+//
+// Every open dashboard polls the log list, every 5 seconds by default. On a
+// busy instance with many open dashboards, a longer interval takes load off
+// the server; /api/ui/config hands the interval to the dashboards. With 0
+// they never poll and the refresh button is the only way to new logs.
+//
+// While someone reads the list, they can pause it: the list stays as it is,
+// and the dashboard only asks for logs newer than the newest one it shows
+// (since_id, with the same filters) to offer "resume and show N new logs".
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// dashboardRefresh is the -refresh-interval setting - configured once in main()
+var dashboardRefresh = 5 * time.Second
+
+// configureRefresh checks and sets the dashboard polling interval
+func configureRefresh(interval time.Duration) error {
+	if interval != 0 && interval < time.Second {
+		return fmt.Errorf("refresh interval must be 0 or at least 1s, got %s", interval)
+	}
+	dashboardRefresh = interval
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAutoRefresh tests the refresh interval setting and the since_id filter
+func TestAutoRefresh(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { dashboardRefresh = 5 * time.Second }()
+
+	if err := configureRefresh(500 * time.Millisecond); err == nil {
+		t.Error("Expected sub-second intervals to be refused")
+	}
+	for _, interval := range []time.Duration{0, 30 * time.Second} {
+		if err := configureRefresh(interval); err != nil {
+			t.Errorf("Expected %s to be accepted, got %v", interval, err)
+		}
+	}
+	var config struct {
+		RefreshInterval *int64 `json:"refresh_interval_ms"`
+	}
+	w := httptest.NewRecorder()
+	handleUIConfig(w, httptest.NewRequest("GET", "/api/ui/config", nil))
+	json.NewDecoder(w.Body).Decode(&config)
+	if config.RefreshInterval == nil || *config.RefreshInterval != 30000 {
+		t.Errorf("Expected a 30000ms refresh interval in the UI config, got %v", config.RefreshInterval)
+	}
+
+	// A paused dashboard asks for the logs after the newest one it shows
+	for _, title := range []string{"seen timeout", "new timeout", "new login", "another timeout"} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"title":"`+title+`"}}`)))
+	}
+	w = httptest.NewRecorder()
+	handleLogs(w, httptest.NewRequest("GET", "/api/logs?since_id=1&q=timeout", nil))
+	var logs []Log
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 2 || logs[0].Header.Title != "another timeout" || logs[1].Header.Title != "new timeout" {
+		t.Errorf("Expected the 2 newer timeouts, got %+v", logs)
+	}
+	w = httptest.NewRecorder()
+	handleLogs(w, httptest.NewRequest("GET", "/api/logs?since_id=latest", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid since_id, got %d", w.Code)
+	}
+}
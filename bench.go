@@ -0,0 +1,170 @@
+// CubicLog Load Test - Measure what an instance can ingest
+//
+//	cubiclog -bench -target http://localhost:8080 -rate 5000 -duration 60s
+//
+// Sends realistic synthetic logs (see synthetic.go) to POST /api/logs at a
+// fixed rate from a pool of concurrent connections, then reports throughput,
+// latency percentiles and errors. If the target cannot keep up, requests that
+// could not even be started on time are reported as "behind schedule".
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// benchResult collects the outcome of a load test run
+type benchResult struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	statuses  map[int]int
+	failures  map[string]int // transport errors by message
+	behind    int            // requests dropped because every worker was busy
+}
+
+// record stores the outcome of one request
+func (r *benchResult) record(latency time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.failures[err.Error()]++
+		return
+	}
+	r.latencies = append(r.latencies, latency)
+	r.statuses[status]++
+}
+
+// runBenchmark sends synthetic logs to target at rate logs/second for duration
+func runBenchmark(target, apiKey string, rate int, duration time.Duration, concurrency int) *benchResult {
+	result := &benchResult{statuses: make(map[int]int), failures: make(map[string]int)}
+	url := strings.TrimSuffix(target, "/") + "/api/logs"
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: concurrency, MaxIdleConns: concurrency},
+	}
+
+	jobs := make(chan []byte, concurrency)
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for payload := range jobs {
+				req, _ := http.NewRequest("POST", url, bytes.NewReader(payload))
+				req.Header.Set("Content-Type", "application/json")
+				if apiKey != "" {
+					req.Header.Set("Authorization", "Bearer "+apiKey)
+				}
+				start := time.Now()
+				resp, err := client.Do(req)
+				if err != nil {
+					result.record(0, 0, err)
+					continue
+				}
+				resp.Body.Close()
+				result.record(time.Since(start), resp.StatusCode, nil)
+			}
+		}()
+	}
+
+	// Pace requests in 10ms slices so high rates don't need a 0.2ms ticker
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	start := time.Now()
+	sent := 0
+	ticker := time.NewTicker(10 * time.Millisecond)
+	for now := range ticker.C {
+		elapsed := now.Sub(start)
+		if elapsed >= duration {
+			break
+		}
+		due := int(elapsed.Seconds() * float64(rate))
+		for ; sent < due; sent++ {
+			payload, _ := json.Marshal(syntheticLog(rng))
+			select {
+			case jobs <- payload:
+			default:
+				result.mu.Lock()
+				result.behind++
+				result.mu.Unlock()
+			}
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	workers.Wait()
+	return result
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(float64(len(sorted)-1) * p / 100)
+	return sorted[index]
+}
+
+// handleBench implements the -bench command
+func handleBench(target, apiKey string, rate int, duration time.Duration, concurrency int) {
+	if rate <= 0 || concurrency <= 0 || duration <= 0 {
+		fmt.Printf("❌ -rate, -concurrency and -duration must be positive\n")
+		os.Exit(1)
+	}
+
+	// Make sure there is something to test before flooding it
+	resp, err := http.Get(strings.TrimSuffix(target, "/") + "/health")
+	if err != nil {
+		fmt.Printf("❌ Target %s is not reachable: %v\n", target, err)
+		os.Exit(1)
+	}
+	resp.Body.Close()
+
+	fmt.Printf("🏋️  Sending %d logs/s to %s for %s (%d connections)...\n", rate, target, duration, concurrency)
+	started := time.Now()
+	result := runBenchmark(target, apiKey, rate, duration, concurrency)
+	elapsed := time.Since(started)
+
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	succeeded := 0
+	for status, count := range result.statuses {
+		if status >= 200 && status < 300 {
+			succeeded += count
+		}
+	}
+
+	fmt.Printf("\n📊 Results\n")
+	fmt.Printf("   Requests:    %d completed, %d succeeded\n", len(result.latencies), succeeded)
+	fmt.Printf("   Throughput:  %.0f logs/s (target %d)\n", float64(succeeded)/elapsed.Seconds(), rate)
+	fmt.Printf("   Latency:     p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(result.latencies, 50).Round(time.Microsecond),
+		percentile(result.latencies, 90).Round(time.Microsecond),
+		percentile(result.latencies, 99).Round(time.Microsecond),
+		percentile(result.latencies, 100).Round(time.Microsecond))
+
+	statuses := make([]int, 0, len(result.statuses))
+	for status := range result.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Printf("   HTTP %d:    %d\n", status, result.statuses[status])
+	}
+	for message, count := range result.failures {
+		fmt.Printf("   ❌ %d × %s\n", count, message)
+	}
+	if result.behind > 0 {
+		fmt.Printf("   ⚠️  %d requests behind schedule (all connections busy) - the target can't keep up with %d logs/s\n", result.behind, rate)
+	}
+
+	if succeeded == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestBenchmarkRun tests that the load generator delivers synthetic logs to an instance
+func TestBenchmarkRun(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(handleLogs))
+	defer server.Close()
+
+	// A single connection keeps the in-memory test database on one SQLite connection
+	result := runBenchmark(server.URL, "", 100, 300*time.Millisecond, 1)
+
+	if result.statuses[http.StatusCreated] == 0 {
+		t.Fatalf("Expected logs to be created, got statuses %v and failures %v", result.statuses, result.failures)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if count != result.statuses[http.StatusCreated] {
+		t.Errorf("Expected %d stored logs, got %d", result.statuses[http.StatusCreated], count)
+	}
+
+	// Every synthetic log must be accepted by the API
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		entry := syntheticLog(rng)
+		if err := validateLogHeader(&entry.Header); err != nil {
+			t.Fatalf("Synthetic log %+v is invalid: %v", entry.Header, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// CubicLog Branding - White-label the dashboard with -ui-dir
+//
+//	cubiclog -ui-dir /etc/cubiclog/ui
+//
+// Files in the directory take precedence over the embedded UI, everything
+// else falls back to it:
+//   - branding.json  title, logo, primary color and footer text:
+//     {"title": "ACME Logs", "logo": "acme.svg", "primary_color": "#e11d48",
+//     "footer": "ACME Platform Team"}
+//   - custom.css     extra styles, loaded after the built-in ones
+//   - index.html     a complete replacement dashboard (start from ui/index.html;
+//     it is a Go text/template with the branding fields)
+//   - vendor/...     replacements for bundled libraries
+//   - any other file (logos, images) is served below /assets/
+//
+// The logo is a file name in the directory or an absolute URL.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// uiBranding holds the values the dashboard template is rendered with
+type uiBranding struct {
+	Title        string `json:"title"`
+	Logo         string `json:"logo"`
+	PrimaryColor string `json:"primary_color"`
+	Footer       string `json:"footer"`
+	Stylesheet   bool   `json:"-"` // custom.css exists
+}
+
+// defaultBranding is the stock CubicLog look
+var defaultBranding = uiBranding{Title: "CubicLog", PrimaryColor: "#3b82f6"}
+
+// cssColorPattern accepts hex colors, which are placed into the Tailwind config
+var cssColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// PageTitle returns the browser tab title
+func (b uiBranding) PageTitle() string {
+	if b.Title == defaultBranding.Title {
+		return "CubicLog - A Modern Logging Dashboard"
+	}
+	return b.Title
+}
+
+// overlayFS serves files from top, falling back to base
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.top.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return file, err
+	}
+	return o.base.Open(name)
+}
+
+// loadBranding reads branding.json from the UI root and fills in defaults
+func loadBranding(root fs.FS) (uiBranding, error) {
+	branding := defaultBranding
+	data, err := fs.ReadFile(root, "branding.json")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return branding, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &branding); err != nil {
+			return branding, fmt.Errorf("invalid branding.json: %v", err)
+		}
+	}
+
+	if strings.TrimSpace(branding.Title) == "" {
+		branding.Title = defaultBranding.Title
+	}
+	if branding.PrimaryColor == "" {
+		branding.PrimaryColor = defaultBranding.PrimaryColor
+	}
+	if !cssColorPattern.MatchString(branding.PrimaryColor) {
+		return branding, fmt.Errorf("invalid primary_color '%s' - use a hex color like #3b82f6", branding.PrimaryColor)
+	}
+	if branding.Logo != "" && !strings.HasPrefix(branding.Logo, "https://") && !strings.HasPrefix(branding.Logo, "http://") {
+		if _, err := fs.Stat(root, strings.TrimPrefix(branding.Logo, "/")); err != nil {
+			return branding, fmt.Errorf("logo '%s' not found in the UI directory", branding.Logo)
+		}
+		branding.Logo = "/assets/" + strings.TrimPrefix(branding.Logo, "/")
+	}
+	_, err = fs.Stat(root, "custom.css")
+	branding.Stylesheet = err == nil
+	return branding, nil
+}
+
+// configureUI switches the dashboard to a custom UI directory
+func configureUI(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("UI directory %s not found", dir)
+	}
+
+	root := overlayFS{top: os.DirFS(dir), base: embeddedUIRoot()}
+	branding, err := loadBranding(root)
+	if err != nil {
+		return err
+	}
+	page, err := loadWebUI(root, branding)
+	if err != nil {
+		return err
+	}
+	uiRoot, webUI = root, page
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCustomBranding tests that -ui-dir overrides the embedded dashboard and falls back to it
+func TestCustomBranding(t *testing.T) {
+	originalRoot, originalUI := uiRoot, webUI
+	defer func() { uiRoot, webUI = originalRoot, originalUI }()
+
+	// The stock dashboard keeps its look
+	if !strings.Contains(webUI, "<title>CubicLog - A Modern Logging Dashboard</title>") || !strings.Contains(webUI, "by Mendex") {
+		t.Errorf("Expected default title and footer in the embedded dashboard")
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "branding.json"), []byte(`{"title": "ACME <Logs>", "logo": "acme.svg", "primary_color": "#e11d48", "footer": "ACME Platform Team"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "acme.svg"), []byte("<svg></svg>"), 0644)
+	os.WriteFile(filepath.Join(dir, "custom.css"), []byte("body { letter-spacing: 0.01em; }"), 0644)
+
+	if err := configureUI(dir); err != nil {
+		t.Fatalf("Failed to configure UI: %v", err)
+	}
+	for _, expected := range []string{
+		"<title>ACME &lt;Logs&gt;</title>",
+		`<img src="/assets/acme.svg"`,
+		`primary: "#e11d48"`,
+		"ACME Platform Team",
+		`<link href="/assets/custom.css"`,
+	} {
+		if !strings.Contains(webUI, expected) {
+			t.Errorf("Expected dashboard to contain %q", expected)
+		}
+	}
+	if strings.Contains(webUI, "by Mendex") {
+		t.Errorf("Expected the custom footer to replace the default one")
+	}
+
+	// Custom files and embedded assets are both served
+	for _, path := range []string{"/assets/acme.svg", "/assets/vendor/assets.json"} {
+		w := httptest.NewRecorder()
+		serveAssets(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Errorf("Expected 200 for %s, got %d", path, w.Code)
+		}
+	}
+
+	// A complete index.html replacement
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<h1>{{.Title | html}} custom</h1>`), 0644)
+	if err := configureUI(dir); err != nil {
+		t.Fatalf("Failed to configure UI: %v", err)
+	}
+	if webUI != "<h1>ACME &lt;Logs&gt; custom</h1>" {
+		t.Errorf("Expected custom index.html, got %s", webUI)
+	}
+
+	// Invalid settings are refused
+	os.WriteFile(filepath.Join(dir, "branding.json"), []byte(`{"primary_color": "red\"; alert(1)"}`), 0644)
+	if err := configureUI(dir); err == nil {
+		t.Errorf("Expected error for invalid primary color")
+	}
+}
@@ -0,0 +1,369 @@
+// CubicLog Bulk Actions - Triage hundreds of related logs in one request
+//
+//	curl -X POST -H "Authorization: Bearer $API_KEY" http://localhost:8080/api/logs/bulk \
+//	  -d '{"filter": {"source": "payments", "severity": "error", "from": "2024-05-14"}, "action": "tag", "tags": ["incident-42"]}'
+//
+// Select logs either by "ids" or by "filter" (the GET /api/logs parameters:
+// q, type, color, source, severity, tag, acknowledged, from, to), then apply
+// one action:
+//   - tag / untag          add or remove "tags"
+//   - acknowledge          mark as seen (unacknowledge undoes it)
+//   - set_severity         override the derived severity with "severity"
+//   - delete               remove the logs (except those under a legal hold, see holds.go)
+//
+// Everything runs in one transaction: either all selected logs change or none.
+// The response summarizes what matched and changed; "dry_run": true only
+// reports the selection. A filter must not be empty and may select at most
+// maxBulkLogs logs. Tags and acknowledgements are kept next to the logs (table
+// log_triage) rather than in them, so the hash chain stays valid and older
+// monthly partitions need no migration. With -partition monthly, bulk actions
+// apply to the current month.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxBulkLogs caps the logs one bulk request may change
+const maxBulkLogs = 10000
+
+// bulkGeneration counts applied bulk actions, so ETags change with edited logs
+var bulkGeneration atomic.Int64
+
+// bulkActions are the supported actions
+var bulkActions = []string{"tag", "untag", "acknowledge", "unacknowledge", "set_severity", "delete"}
+
+// tagPattern validates tag names (they are stored comma-separated)
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:/-]{0,49}$`)
+
+// bulkRequest is the body of POST /api/logs/bulk
+type bulkRequest struct {
+	IDs      []int             `json:"ids"`
+	Filter   map[string]string `json:"filter"`
+	Action   string            `json:"action"`
+	Tags     []string          `json:"tags"`
+	Severity string            `json:"severity"`
+	DryRun   bool              `json:"dry_run"`
+
+	where string // selection as a WHERE clause
+	args  []interface{}
+}
+
+// bulkResult summarizes a bulk action
+type bulkResult struct {
+	Action   string `json:"action"`
+	DryRun   bool   `json:"dry_run"`
+	Matched  int    `json:"matched"`
+	Changed  int    `json:"changed"`
+	IDs      []int  `json:"ids"`
+	NotFound []int  `json:"not_found,omitempty"` // requested ids that don't exist
+	Held     []int  `json:"held,omitempty"`      // matched logs a legal hold keeps from deletion
+}
+
+// createTriageTable creates the table holding tags and acknowledgements
+func createTriageTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS log_triage (
+		log_id          BIGINT PRIMARY KEY,
+		logged_at       TIMESTAMP NOT NULL,
+		tags            TEXT NOT NULL DEFAULT '',
+		acknowledged_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_log_triage_logged_at ON log_triage(logged_at);
+	`)
+	return err
+}
+
+// pruneTriage drops triage rows of logs removed by retention (logs kept by a
+// legal hold, or in a partition, keep the tags a hold matches on)
+func pruneTriage(cutoff time.Time) {
+	filter, args := "logged_at < ? AND log_id NOT IN (SELECT id FROM logs)", []interface{}{dbTime(cutoff)}
+	for _, tag := range heldTags() {
+		filter += " AND ',' || tags || ',' NOT " + db.Like() + " ?"
+		args = append(args, "%,"+tag+",%")
+	}
+	db.Exec(db.Rebind("DELETE FROM log_triage WHERE "+filter), args...)
+}
+
+// attachTriage fills in the tags and acknowledgements of listed logs
+func attachTriage(logs []Log) {
+	if len(logs) == 0 {
+		return
+	}
+	index := make(map[int]int, len(logs))
+	placeholders := make([]string, len(logs))
+	args := make([]interface{}, len(logs))
+	for i, l := range logs {
+		index[l.ID] = i
+		placeholders[i] = "?"
+		args[i] = l.ID
+	}
+	rows, err := db.Query(db.Rebind("SELECT log_id, tags, acknowledged_at FROM log_triage WHERE log_id IN ("+strings.Join(placeholders, ", ")+")"), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var tags string
+		var acknowledgedAt time.Time
+		if rows.Scan(&id, &tags, (*scanTime)(&acknowledgedAt)) != nil {
+			continue
+		}
+		l := &logs[index[id]]
+		l.Tags = splitTags(tags)
+		if !acknowledgedAt.IsZero() {
+			l.AcknowledgedAt = &acknowledgedAt
+		}
+	}
+}
+
+// splitTags parses the stored tag list
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// parseBulkRequest reads and validates a bulk request
+func parseBulkRequest(r *http.Request) (bulkRequest, error) {
+	var request bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, fmt.Errorf("Invalid JSON")
+	}
+	if !containsString(bulkActions, request.Action) {
+		return request, fmt.Errorf("action must be one of %s", strings.Join(bulkActions, ", "))
+	}
+	if (len(request.IDs) == 0) == (len(request.Filter) == 0) {
+		return request, fmt.Errorf("select logs with either ids or a non-empty filter")
+	}
+	if len(request.IDs) > maxBulkLogs {
+		return request, fmt.Errorf("at most %d ids per request", maxBulkLogs)
+	}
+	if len(request.IDs) > 0 {
+		placeholders := make([]string, len(request.IDs))
+		for i, id := range request.IDs {
+			placeholders[i] = "?"
+			request.args = append(request.args, id)
+		}
+		request.where = " WHERE id IN (" + strings.Join(placeholders, ", ") + ")"
+	} else {
+		params := url.Values{}
+		for key, value := range request.Filter {
+			params.Set(key, value)
+		}
+		var err error
+		if request.where, request.args, err = buildLogFilter(params); err != nil {
+			return request, err
+		}
+		if len(request.args) == 0 {
+			return request, fmt.Errorf("the filter selects every log - use at least one of its parameters")
+		}
+	}
+	switch request.Action {
+	case "tag", "untag":
+		if len(request.Tags) == 0 {
+			return request, fmt.Errorf("%s needs tags", request.Action)
+		}
+		for _, tag := range request.Tags {
+			if !tagPattern.MatchString(tag) {
+				return request, fmt.Errorf("invalid tag '%s' (letters, digits and . _ : / -, up to 50 characters)", tag)
+			}
+		}
+	case "set_severity":
+		request.Severity = strings.ToLower(request.Severity)
+		if !containsString(builtinSeverities, request.Severity) {
+			return request, fmt.Errorf("severity must be one of %s", strings.Join(builtinSeverities, ", "))
+		}
+	}
+	return request, nil
+}
+
+// selectBulkLogs returns the ids and timestamps of the selected logs (up to
+// one more than maxBulkLogs) and the requested ids that don't exist
+func selectBulkLogs(request bulkRequest) (map[int]time.Time, []int, error) {
+	args := append(append([]interface{}{}, request.args...), maxBulkLogs+1)
+	rows, err := db.Query(db.Rebind("SELECT id, timestamp FROM logs"+request.where+" LIMIT ?"), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	selected := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var timestamp time.Time
+		if err := rows.Scan(&id, (*scanTime)(&timestamp)); err != nil {
+			return nil, nil, err
+		}
+		selected[id] = timestamp
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var notFound []int
+	for _, id := range request.IDs {
+		if _, ok := selected[id]; !ok {
+			notFound = append(notFound, id)
+		}
+	}
+	return selected, notFound, nil
+}
+
+// applyBulkAction changes the selected logs in one transaction and returns how many changed
+func applyBulkAction(request bulkRequest, selected map[int]time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := dbTime(time.Now())
+	changed := 0
+	for id, timestamp := range selected {
+		var result sql.Result
+		switch request.Action {
+		case "delete":
+			if result, err = tx.Exec(db.Rebind("DELETE FROM logs WHERE id = ?"), id); err == nil {
+				_, err = tx.Exec(db.Rebind("DELETE FROM log_triage WHERE log_id = ?"), id)
+			}
+		case "set_severity":
+			result, err = tx.Exec(db.Rebind("UPDATE logs SET derived_severity = ? WHERE id = ? AND COALESCE(derived_severity, '') <> ?"), request.Severity, id, request.Severity)
+		default:
+			result, err = updateTriage(tx, request, id, timestamp, now)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			changed++
+		}
+	}
+	return changed, tx.Commit()
+}
+
+// updateTriage applies a tag or acknowledge action to one log
+func updateTriage(tx *sql.Tx, request bulkRequest, id int, timestamp time.Time, now interface{}) (sql.Result, error) {
+	var tags string
+	var acknowledged time.Time
+	err := tx.QueryRow(db.Rebind("SELECT tags, acknowledged_at FROM log_triage WHERE log_id = ?"), id).Scan(&tags, (*scanTime)(&acknowledged))
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	current := splitTags(tags)
+	updated := append([]string{}, current...)
+	var acknowledgedAt interface{}
+	if !acknowledged.IsZero() {
+		acknowledgedAt = dbTime(acknowledged)
+	}
+	switch request.Action {
+	case "tag":
+		for _, tag := range request.Tags {
+			if !containsString(updated, tag) {
+				updated = append(updated, tag)
+			}
+		}
+		sort.Strings(updated)
+	case "untag":
+		updated = updated[:0]
+		for _, tag := range current {
+			if !containsString(request.Tags, tag) {
+				updated = append(updated, tag)
+			}
+		}
+	case "acknowledge":
+		if !acknowledged.IsZero() {
+			return noRowsChanged{}, nil
+		}
+		acknowledgedAt = now
+	case "unacknowledge":
+		if acknowledged.IsZero() {
+			return noRowsChanged{}, nil
+		}
+		acknowledgedAt = nil
+	}
+	if (request.Action == "tag" || request.Action == "untag") && strings.Join(updated, ",") == tags {
+		return noRowsChanged{}, nil
+	}
+
+	if exists {
+		return tx.Exec(db.Rebind("UPDATE log_triage SET tags = ?, acknowledged_at = ? WHERE log_id = ?"), strings.Join(updated, ","), acknowledgedAt, id)
+	}
+	return tx.Exec(db.Rebind("INSERT INTO log_triage (log_id, logged_at, tags, acknowledged_at) VALUES (?, ?, ?, ?)"),
+		id, dbTime(timestamp), strings.Join(updated, ","), acknowledgedAt)
+}
+
+// noRowsChanged is the result of an action that had nothing to do
+type noRowsChanged struct{}
+
+func (noRowsChanged) LastInsertId() (int64, error) { return 0, nil }
+func (noRowsChanged) RowsAffected() (int64, error) { return 0, nil }
+
+// handleBulkLogs answers POST /api/logs/bulk
+func handleBulkLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	request, err := parseBulkRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	selected, notFound, err := selectBulkLogs(request)
+	if err != nil {
+		log.Printf("Bulk selection error: %v", err)
+		http.Error(w, "Failed to select logs", http.StatusInternalServerError)
+		return
+	}
+	if len(selected) > maxBulkLogs {
+		http.Error(w, fmt.Sprintf("The filter matches more than %d logs - narrow it down", maxBulkLogs), http.StatusBadRequest)
+		return
+	}
+
+	result := bulkResult{Action: request.Action, DryRun: request.DryRun, Matched: len(selected), IDs: []int{}, NotFound: notFound}
+	if request.Action == "delete" {
+		ids := make([]int, 0, len(selected))
+		for id := range selected {
+			ids = append(ids, id)
+		}
+		if result.Held, err = heldLogIDs(ids); err != nil {
+			log.Printf("Bulk selection error: %v", err)
+			http.Error(w, "Failed to select logs", http.StatusInternalServerError)
+			return
+		}
+		for _, id := range result.Held {
+			delete(selected, id)
+		}
+	}
+	for id := range selected {
+		result.IDs = append(result.IDs, id)
+	}
+	sort.Ints(result.IDs)
+	if !request.DryRun && len(selected) > 0 {
+		if result.Changed, err = applyBulkAction(request, selected); err != nil {
+			log.Printf("Bulk %s error: %v", request.Action, err)
+			http.Error(w, "Bulk action failed, nothing was changed", http.StatusInternalServerError)
+			return
+		}
+		bulkGeneration.Add(1)
+		if request.Action == "delete" || request.Action == "set_severity" {
+			invalidateHourlyStats()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
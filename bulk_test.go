@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBulkActions tests tagging, acknowledging, re-rating and deleting logs in bulk
+func TestBulkActions(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, entry := range []string{
+		`{"header":{"type":"error","title":"Card declined","source":"payments"}}`,
+		`{"header":{"type":"error","title":"Card expired","source":"payments"}}`,
+		`{"header":{"type":"info","title":"Order shipped","source":"shipping"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(entry)))
+	}
+	bulk := func(body string) (int, bulkResult) {
+		w := httptest.NewRecorder()
+		handleBulkLogs(w, httptest.NewRequest("POST", "/api/logs/bulk", strings.NewReader(body)))
+		var result bulkResult
+		json.NewDecoder(w.Body).Decode(&result)
+		return w.Code, result
+	}
+	list := func(query string) []Log {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs?"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		return logs
+	}
+
+	code, result := bulk(`{"filter": {"source": "payments"}, "action": "tag", "tags": ["incident-42", "billing"]}`)
+	if code != 200 || result.Matched != 2 || result.Changed != 2 {
+		t.Fatalf("Expected 2 payment logs tagged, got %d %+v", code, result)
+	}
+	if _, result = bulk(`{"filter": {"source": "payments"}, "action": "tag", "tags": ["billing"]}`); result.Changed != 0 {
+		t.Errorf("Expected tagging twice to change nothing, got %d", result.Changed)
+	}
+	tagged := list("tag=incident-42")
+	if len(tagged) != 2 || strings.Join(tagged[0].Tags, ",") != "billing,incident-42" {
+		t.Fatalf("Expected 2 logs with sorted tags, got %+v", tagged)
+	}
+
+	if _, result = bulk(fmt.Sprintf(`{"ids": [%d, 999], "action": "acknowledge"}`, tagged[0].ID)); result.Changed != 1 || len(result.NotFound) != 1 {
+		t.Errorf("Expected 1 log acknowledged and 1 unknown id, got %+v", result)
+	}
+	if open := list("acknowledged=false"); len(open) != 2 {
+		t.Errorf("Expected 2 unacknowledged logs, got %d", len(open))
+	}
+
+	if _, result = bulk(`{"filter": {"tag": "incident-42"}, "action": "set_severity", "severity": "warning"}`); result.Changed != 2 {
+		t.Errorf("Expected 2 logs re-rated, got %+v", result)
+	}
+	if rerated := list("severity=warning"); len(rerated) != 2 {
+		t.Errorf("Expected 2 logs with severity warning, got %d", len(rerated))
+	}
+
+	if _, result = bulk(`{"filter": {"source": "payments"}, "action": "delete", "dry_run": true}`); result.Matched != 2 || result.Changed != 0 {
+		t.Errorf("Expected a dry run to change nothing, got %+v", result)
+	}
+	if _, result = bulk(`{"filter": {"source": "payments"}, "action": "delete"}`); result.Changed != 2 || len(list("")) != 1 {
+		t.Errorf("Expected 2 logs deleted, got %+v", result)
+	}
+
+	for _, body := range []string{
+		`{"filter": {"q": ""}, "action": "delete"}`,
+		`{"action": "acknowledge"}`,
+		`{"ids": [1], "action": "archive"}`,
+		`{"ids": [1], "action": "tag", "tags": ["a,b"]}`,
+	} {
+		if code, _ := bulk(body); code != 400 {
+			t.Errorf("Expected status 400 for %s, got %d", body, code)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// CubicLog Charts - Pre-aggregated series for the dashboard charts
+//
+//   - GET /api/charts/severity  log counts per interval, stacked by severity
+//   - GET /api/charts/sources   error rate per interval for the busiest sources
+//
+// With sources=checkout,checkout-canary the sources chart returns those
+// sources instead, in that order and even without logs, so a canary can be
+// compared with the stable service during a rollout (up to 10 sources).
+//
+// Both accept range=24h|7d|30d (default 24h). The interval follows the range
+// (1h, 6h and 1d buckets) so every chart has a few dozen points, and empty
+// buckets are included so series line up. Buckets are in UTC like the stored
+// timestamps; the dashboard shows them in the browser's time zone. Counts are grouped per hour in SQL
+// and folded into buckets here; hourly rollups are included, so downsampled
+// logs still show up in the volume chart. A source's error rate is the share
+// of its logs with derived severity error or critical.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chartRanges maps the supported ranges to their length and bucket size
+var chartRanges = map[string]struct {
+	span, interval time.Duration
+}{
+	"24h": {24 * time.Hour, time.Hour},
+	"7d":  {7 * 24 * time.Hour, 6 * time.Hour},
+	"30d": {30 * 24 * time.Hour, 24 * time.Hour},
+}
+
+// chartSeverities is the stacking order, most severe first
+var chartSeverities = []string{"critical", "error", "warning", "success", "info", "debug"}
+
+// chartWindow is the bucketed time range a chart covers
+type chartWindow struct {
+	Range    string
+	Interval time.Duration
+	Starts   []time.Time
+}
+
+// hourCount is one row of the hourly aggregate
+type hourCount struct {
+	hour     time.Time
+	source   string
+	severity string
+	count    int
+}
+
+// parseChartWindow reads the range parameter and lays out the buckets ending now
+func parseChartWindow(r *http.Request, now time.Time) (chartWindow, bool) {
+	name := r.URL.Query().Get("range")
+	if name == "" {
+		name = "24h"
+	}
+	spec, ok := chartRanges[name]
+	if !ok {
+		return chartWindow{}, false
+	}
+
+	last := truncateBucket(now.UTC(), spec.interval)
+	count := int(spec.span / spec.interval)
+	window := chartWindow{Range: name, Interval: spec.interval}
+	for i := count - 1; i >= 0; i-- {
+		window.Starts = append(window.Starts, last.Add(-time.Duration(i)*spec.interval))
+	}
+	return window, true
+}
+
+// truncateBucket rounds down to the start of the interval's bucket, so daily
+// buckets start at midnight and 6h buckets at 00, 06, 12 and 18
+func truncateBucket(t time.Time, interval time.Duration) time.Time {
+	if interval >= 24*time.Hour {
+		year, month, day := t.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+	hour := t.Hour() / int(interval/time.Hour) * int(interval/time.Hour)
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+}
+
+// bucket returns the index of the bucket containing t, or -1
+func (w chartWindow) bucket(t time.Time) int {
+	for i := len(w.Starts) - 1; i >= 0; i-- {
+		if !t.Before(w.Starts[i]) {
+			if t.Before(w.Starts[i].Add(w.Interval)) {
+				return i
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// hourlyCounts returns log counts per hour, source and severity since from,
+// including hourly rollups
+func hourlyCounts(from time.Time) ([]hourCount, error) {
+	// substr over the text form of the timestamp yields 'YYYY-MM-DD HH' on both SQLite and PostgreSQL
+	hourExpr := "substr(CAST(timestamp AS TEXT), 1, 13)"
+	// Compare in SQLite's CURRENT_TIMESTAMP format, the stored timestamps are UTC text
+	var since interface{} = from
+	if db.Driver() == "sqlite3" {
+		since = from.UTC().Format("2006-01-02 15:04:05")
+	}
+	rows, release, err := queryLogs(from.Format("2006-01-02"), "", func(table string) (string, []interface{}) {
+		return db.Rebind(`
+			SELECT ` + hourExpr + `, COALESCE(derived_source, 'unknown'), COALESCE(derived_severity, 'info'), COUNT(*)
+			FROM ` + table + `
+			WHERE timestamp >= ?
+			GROUP BY ` + hourExpr + `, COALESCE(derived_source, 'unknown'), COALESCE(derived_severity, 'info')`), []interface{}{since}
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts, err := scanHourCounts(rows)
+	release()
+	if err != nil {
+		return nil, err
+	}
+
+	rollups, err := db.Query(db.Rebind("SELECT hour, source, severity, count FROM log_rollups WHERE hour >= ?"), from.UTC().Format("2006-01-02 15"))
+	if err != nil {
+		return nil, err
+	}
+	defer rollups.Close()
+	rolled, err := scanHourCounts(rollups)
+	return append(counts, rolled...), err
+}
+
+// scanHourCounts reads (hour, source, severity, count) rows
+func scanHourCounts(rows *sql.Rows) ([]hourCount, error) {
+	var counts []hourCount
+	for rows.Next() {
+		var hour string
+		var row hourCount
+		if err := rows.Scan(&hour, &row.source, &row.severity, &row.count); err != nil {
+			return nil, err
+		}
+		parsed, err := time.ParseInLocation("2006-01-02 15", hour, time.UTC)
+		if err != nil {
+			continue
+		}
+		row.hour = parsed
+		counts = append(counts, row)
+	}
+	return counts, rows.Err()
+}
+
+// bucketLabels formats the bucket start times for the response
+func (w chartWindow) bucketLabels() []string {
+	labels := make([]string, len(w.Starts))
+	for i, start := range w.Starts {
+		labels[i] = start.Format(time.RFC3339)
+	}
+	return labels
+}
+
+// handleSeverityChart answers /api/charts/severity
+func handleSeverityChart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	window, ok := parseChartWindow(r, time.Now())
+	if !ok {
+		http.Error(w, "Invalid range - use 24h, 7d or 30d", http.StatusBadRequest)
+		return
+	}
+	counts, err := hourlyCounts(window.Starts[0])
+	if err != nil {
+		http.Error(w, "Failed to load chart data", http.StatusInternalServerError)
+		return
+	}
+
+	series := map[string][]int{}
+	for _, severity := range chartSeverities {
+		series[severity] = make([]int, len(window.Starts))
+	}
+	totals := make([]int, len(window.Starts))
+	for _, row := range counts {
+		index := window.bucket(row.hour)
+		if index < 0 {
+			continue
+		}
+		if _, known := series[row.severity]; !known {
+			series[row.severity] = make([]int, len(window.Starts))
+		}
+		series[row.severity][index] += row.count
+		totals[index] += row.count
+	}
+
+	// Any other severities are stacked after the built-in ones
+	var extra []string
+	for severity := range series {
+		if !containsString(chartSeverities, severity) {
+			extra = append(extra, severity)
+		}
+	}
+	sort.Strings(extra)
+	severities := append(append([]string{}, chartSeverities...), extra...)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"range":      window.Range,
+		"interval":   shortDuration(window.Interval),
+		"buckets":    window.bucketLabels(),
+		"severities": severities,
+		"series":     series,
+		"totals":     totals,
+		"colors":     chartColors,
+	})
+}
+
+// maxComparedSources caps the sources of a comparison
+const maxComparedSources = 10
+
+// comparedSources reads the sources parameter: the sources to compare, in order
+func comparedSources(value string) ([]string, bool) {
+	var sources []string
+	for _, source := range strings.Split(value, ",") {
+		source = strings.TrimSpace(source)
+		if source != "" && !containsString(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources, len(sources) <= maxComparedSources
+}
+
+// sourceSeries is the error-rate sparkline of one source
+type sourceSeries struct {
+	Source    string    `json:"source"`
+	Total     int       `json:"total"`
+	Errors    int       `json:"errors"`
+	ErrorRate float64   `json:"error_rate"` // percent over the whole range
+	Points    []float64 `json:"points"`     // percent per bucket
+	Volume    []int     `json:"volume"`     // logs per bucket
+}
+
+// handleSourcesChart answers /api/charts/sources
+func handleSourcesChart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	window, ok := parseChartWindow(r, time.Now())
+	if !ok {
+		http.Error(w, "Invalid range - use 24h, 7d or 30d", http.StatusBadRequest)
+		return
+	}
+	limit := 8
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed <= 50 {
+			limit = parsed
+		}
+	}
+	compared, ok := comparedSources(r.URL.Query().Get("sources"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Too many sources - compare at most %d", maxComparedSources), http.StatusBadRequest)
+		return
+	}
+	counts, err := hourlyCounts(window.Starts[0])
+	if err != nil {
+		http.Error(w, "Failed to load chart data", http.StatusInternalServerError)
+		return
+	}
+
+	bySource := map[string]*sourceSeries{}
+	errorCounts := map[string][]int{}
+	for _, row := range counts {
+		index := window.bucket(row.hour)
+		if index < 0 || (compared != nil && !containsString(compared, row.source)) {
+			continue
+		}
+		series, ok := bySource[row.source]
+		if !ok {
+			series = &sourceSeries{Source: row.source, Volume: make([]int, len(window.Starts))}
+			bySource[row.source] = series
+			errorCounts[row.source] = make([]int, len(window.Starts))
+		}
+		series.Total += row.count
+		series.Volume[index] += row.count
+		if row.severity == "error" || row.severity == "critical" {
+			series.Errors += row.count
+			errorCounts[row.source][index] += row.count
+		}
+	}
+
+	// Compared sources without logs get an empty series
+	for _, source := range compared {
+		if _, ok := bySource[source]; !ok {
+			bySource[source] = &sourceSeries{Source: source, Volume: make([]int, len(window.Starts))}
+			errorCounts[source] = make([]int, len(window.Starts))
+		}
+	}
+
+	sources := make([]sourceSeries, 0, len(bySource))
+	for source, series := range bySource {
+		series.ErrorRate = percent(series.Errors, series.Total)
+		series.Points = make([]float64, len(window.Starts))
+		for i, volume := range series.Volume {
+			series.Points[i] = percent(errorCounts[source][i], volume)
+		}
+		sources = append(sources, *series)
+	}
+	if compared != nil {
+		// A comparison keeps the requested order
+		sources = sources[:0]
+		for _, source := range compared {
+			sources = append(sources, *bySource[source])
+		}
+	} else {
+		sort.Slice(sources, func(i, j int) bool {
+			if sources[i].Total != sources[j].Total {
+				return sources[i].Total > sources[j].Total
+			}
+			return sources[i].Source < sources[j].Source
+		})
+		if len(sources) > limit {
+			sources = sources[:limit]
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"range":    window.Range,
+		"interval": shortDuration(window.Interval),
+		"buckets":  window.bucketLabels(),
+		"sources":  sources,
+	})
+}
+
+// percent returns part/total as a percentage with one decimal
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*1000) / 10
+}
+
+// shortDuration formats bucket sizes as 1h, 6h or 1d
+func shortDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return strconv.Itoa(int(d/time.Hour)) + "h"
+}
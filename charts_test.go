@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChartEndpoints tests the severity and per-source chart series
+func TestChartEndpoints(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, body := range []string{
+		`{"header":{"type":"error","title":"Payment failed","source":"billing"}}`,
+		`{"header":{"type":"info","title":"Invoice sent","source":"billing"}}`,
+		`{"header":{"type":"info","title":"User login","source":"auth"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+	db.Exec("INSERT INTO log_rollups (hour, source, severity, count) VALUES (?, 'auth', 'debug', 5)", time.Now().UTC().Format("2006-01-02 15"))
+
+	w := httptest.NewRecorder()
+	handleSeverityChart(w, httptest.NewRequest("GET", "/api/charts/severity", nil))
+	var severity struct {
+		Interval string           `json:"interval"`
+		Buckets  []string         `json:"buckets"`
+		Series   map[string][]int `json:"series"`
+		Totals   []int            `json:"totals"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &severity)
+	last := len(severity.Buckets) - 1
+	if severity.Interval != "1h" || len(severity.Buckets) != 24 {
+		t.Fatalf("Expected 24 hourly buckets, got %d (%s)", len(severity.Buckets), severity.Interval)
+	}
+	if severity.Totals[last] != 8 || severity.Series["error"][last] != 1 || severity.Series["debug"][last] != 5 {
+		t.Errorf("Expected 8 logs with 1 error and 5 rolled-up debug logs in the current hour, got %d / %v / %v",
+			severity.Totals[last], severity.Series["error"], severity.Series["debug"])
+	}
+
+	w = httptest.NewRecorder()
+	handleSourcesChart(w, httptest.NewRequest("GET", "/api/charts/sources?range=7d", nil))
+	var sources struct {
+		Interval string         `json:"interval"`
+		Buckets  []string       `json:"buckets"`
+		Sources  []sourceSeries `json:"sources"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sources)
+	if sources.Interval != "6h" || len(sources.Buckets) != 28 || len(sources.Sources) != 2 {
+		t.Fatalf("Expected 2 sources over 28 buckets of 6h, got %d over %d (%s)", len(sources.Sources), len(sources.Buckets), sources.Interval)
+	}
+	billing := sources.Sources[1]
+	if sources.Sources[0].Source != "auth" || billing.Source != "billing" {
+		t.Errorf("Expected auth then billing by volume, got %s, %s", sources.Sources[0].Source, billing.Source)
+	}
+	if billing.ErrorRate != 50 || billing.Points[len(billing.Points)-1] != 50 {
+		t.Errorf("Expected billing error rate of 50%%, got %v", billing.ErrorRate)
+	}
+
+	w = httptest.NewRecorder()
+	handleSeverityChart(w, httptest.NewRequest("GET", "/api/charts/severity?range=1y", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for an unsupported range, got %d", w.Code)
+	}
+}
+
+// TestSourcesChartCompare tests comparing selected sources on the sources chart
+func TestSourcesChartCompare(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, body := range []string{
+		`{"header":{"type":"info","title":"Order placed","source":"checkout"}}`,
+		`{"header":{"type":"info","title":"Order placed","source":"checkout"}}`,
+		`{"header":{"type":"error","title":"Order failed","source":"checkout-canary"}}`,
+		`{"header":{"type":"info","title":"User login","source":"auth"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	// Requested order, duplicates dropped, sources without logs included
+	w := httptest.NewRecorder()
+	handleSourcesChart(w, httptest.NewRequest("GET", "/api/charts/sources?sources=checkout-canary,checkout,%20checkout,billing&limit=1", nil))
+	var compared struct {
+		Sources []sourceSeries `json:"sources"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &compared)
+	var names []string
+	for _, series := range compared.Sources {
+		names = append(names, series.Source)
+	}
+	if strings.Join(names, ",") != "checkout-canary,checkout,billing" {
+		t.Fatalf("Expected checkout-canary, checkout and billing, got %v", names)
+	}
+	canary, stable, billing := compared.Sources[0], compared.Sources[1], compared.Sources[2]
+	if canary.ErrorRate != 100 || stable.ErrorRate != 0 || stable.Volume[len(stable.Volume)-1] != 2 {
+		t.Errorf("Expected the canary at 100%% errors and checkout with 2 logs, got %+v / %+v", canary, stable)
+	}
+	if billing.Total != 0 || len(billing.Points) != 24 || len(billing.Volume) != 24 {
+		t.Errorf("Expected an empty series for billing, got %+v", billing)
+	}
+
+	w = httptest.NewRecorder()
+	handleSourcesChart(w, httptest.NewRequest("GET", "/api/charts/sources?sources=a,b,c,d,e,f,g,h,i,j,k", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for more than %d sources, got %d", maxComparedSources, w.Code)
+	}
+}
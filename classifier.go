@@ -0,0 +1,186 @@
+// CubicLog Classifier - Organization rules that keywords and patterns can't express
+//
+//	cubiclog -classifier "python3 /etc/cubiclog/classify.py"
+//	cubiclog -classifier "wasmtime run /etc/cubiclog/classify.wasm" -classifier-timeout 100ms
+//
+// The classifier is a long-running command CubicLog starts once and talks to
+// in JSON lines: for every incoming log it writes one line to the command's
+// stdin and reads one line back from its stdout.
+//
+//	→ {"header": {"title": "Nightly export failed", ...}, "body": {...}, "metadata": {"derived_severity": "error", ...}}
+//	← {"severity": "warning", "source": "batch", "category": "exports"}
+//
+// Fields left out (or {}) keep what the smart detection derived. Severities
+// must be critical, error, warning, success, info or debug. WASM modules run
+// through a WASI runtime such as wasmtime or wasmer as the command (compiled
+// to read stdin and write stdout), so CubicLog itself needs no WASM runtime.
+// The command line is split on spaces, without a shell.
+//
+// A classifier that doesn't answer within -classifier-timeout (default 250ms),
+// answers with something that isn't JSON, or exits is skipped for that log -
+// the derived metadata stays - and restarted for the next one. Learned
+// corrections (see corrections.go), ingest token sources and client
+// severities still win over the classifier. Logs are classified one at a time.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// classifierResult is a classifier's answer for one log ("" keeps the derived value)
+type classifierResult struct {
+	Severity string `json:"severity"`
+	Source   string `json:"source"`
+	Category string `json:"category"`
+}
+
+// classifierProcess is the running -classifier command
+type classifierProcess struct {
+	mu      sync.Mutex // one log at a time
+	args    []string
+	timeout time.Duration
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string // lines read from stdout, closed when it ends
+}
+
+// classifier is the -classifier command (nil without one) - configured once in main()
+var classifier *classifierProcess
+
+// configureClassifier sets up the -classifier command (started with the first log)
+func configureClassifier(command string, timeout time.Duration) error {
+	if classifier != nil {
+		classifier.mu.Lock()
+		classifier.stop()
+		classifier.mu.Unlock()
+	}
+	classifier = nil
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("classifier command not found: %v", err)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("classifier timeout must be positive")
+	}
+	classifier = &classifierProcess{args: args, timeout: timeout}
+	return nil
+}
+
+// start runs the command (mu held)
+func (p *classifierProcess) start() error {
+	cmd := exec.Command(p.args[0], p.args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	p.cmd, p.stdin, p.lines = cmd, stdin, lines
+	return nil
+}
+
+// stop ends the command, so the next log starts a fresh one (mu held)
+func (p *classifierProcess) stop() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	go func(cmd *exec.Cmd, lines chan string) {
+		for range lines {
+		}
+		cmd.Wait()
+	}(p.cmd, p.lines)
+	p.cmd, p.stdin, p.lines = nil, nil, nil
+}
+
+// classify asks the command about one log
+func (p *classifierProcess) classify(request []byte) (classifierResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var result classifierResult
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return result, err
+		}
+	}
+	if _, err := p.stdin.Write(append(request, '\n')); err != nil {
+		p.stop()
+		return result, err
+	}
+
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			p.stop()
+			return result, fmt.Errorf("classifier exited")
+		}
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			p.stop()
+			return result, fmt.Errorf("invalid answer %q", line)
+		}
+		return result, nil
+	case <-time.After(p.timeout):
+		p.stop()
+		return result, fmt.Errorf("no answer within %v", p.timeout)
+	}
+}
+
+// classifyLog applies the -classifier to the derived metadata of a log and
+// reports whether it changed anything
+func classifyLog(header LogHeader, body map[string]interface{}, metadata LogMetadata) (LogMetadata, bool) {
+	if classifier == nil || metadata.Correction != "" {
+		return metadata, false
+	}
+	request, err := json.Marshal(map[string]interface{}{"header": header, "body": body, "metadata": metadata})
+	if err != nil {
+		return metadata, false
+	}
+	result, err := classifier.classify(request)
+	if err != nil {
+		log.Printf("⚠️  Classifier skipped '%s': %v", header.Title, err)
+		return metadata, false
+	}
+
+	changed := false
+	if severity := strings.ToLower(strings.TrimSpace(result.Severity)); severity != "" && severity != metadata.DerivedSeverity {
+		if containsString(builtinSeverities, severity) {
+			metadata.DerivedSeverity, changed = severity, true
+		} else {
+			log.Printf("⚠️  Classifier returned unknown severity '%s' for '%s'", result.Severity, header.Title)
+		}
+	}
+	if source := strings.TrimSpace(result.Source); source != "" && source != metadata.DerivedSource && len(source) <= 100 {
+		metadata.DerivedSource, changed = source, true
+	}
+	if category := strings.ToLower(strings.TrimSpace(result.Category)); category != "" && category != metadata.DerivedCategory && len(category) <= 100 {
+		metadata.DerivedCategory, changed = category, true
+	}
+	return metadata, changed
+}
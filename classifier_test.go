@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestClassifier tests classifying logs with an external command
+func TestClassifier(t *testing.T) {
+	defer configureClassifier("", 0)
+
+	script := filepath.Join(t.TempDir(), "classify.sh")
+	os.WriteFile(script, []byte(`while read -r line; do
+  case "$line" in
+    *Nightly*) echo '{"severity": "WARNING", "source": "batch", "category": "exports"}' ;;
+    *Slow*) sleep 1; echo '{}' ;;
+    *Broken*) echo 'not json' ;;
+    *Unknown*) echo '{"severity": "urgent"}' ;;
+    *) echo '{}' ;;
+  esac
+done
+`), 0755)
+	if err := configureClassifier("sh "+script, 200*time.Millisecond); err != nil {
+		t.Fatalf("Failed to configure the classifier: %v", err)
+	}
+
+	classify := func(title string) (LogMetadata, bool) {
+		header := LogHeader{Title: title, Source: "exports"}
+		return classifyLog(header, nil, deriveMetadata(header, nil))
+	}
+	if m, changed := classify("Nightly export failed"); !changed || m.DerivedSeverity != "warning" || m.DerivedSource != "batch" || m.DerivedCategory != "exports" {
+		t.Errorf("Expected the classifier's answer applied, got %+v (%v)", m, changed)
+	}
+	if m, changed := classify("Export failed"); changed || m.DerivedSeverity != "error" {
+		t.Errorf("Expected {} to keep the derived metadata, got %+v", m)
+	}
+
+	// Slow, broken and invalid answers are skipped, and the command restarted
+	for _, title := range []string{"Slow export failed", "Broken export failed", "Unknown export failed"} {
+		if m, changed := classify(title); changed || m.DerivedSeverity != "error" {
+			t.Errorf("Expected '%s' to keep the derived metadata, got %+v", title, m)
+		}
+	}
+	if m, _ := classify("Nightly export failed"); m.DerivedSource != "batch" {
+		t.Errorf("Expected the classifier restarted, got %+v", m)
+	}
+
+	if err := configureClassifier("no-such-classifier-command", time.Second); err == nil {
+		t.Errorf("Expected an error for a missing command")
+	}
+}
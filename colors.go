@@ -0,0 +1,342 @@
+// CubicLog Severity Colors - Match the dashboard to your team's conventions
+//
+// Logs sent without a color get one from their severity. The mapping can be
+// changed with a JSON file given with -color-file:
+//
+//	{
+//	  "severities": {"warning": "orange", "error": "red", "audit": "teal"},
+//	  "categories": {"business": "amber"},
+//	  "default": "slate"
+//	}
+//
+// "severities" overrides the built-in severities (critical, error, warning,
+// success, info, debug) and may name custom ones: a log whose type is a custom
+// name ("type": "audit") takes that color whatever its content. "categories"
+// colors logs whose severity has no color by their derived category
+// (security, database, performance, business, http); "default" is used when
+// nothing else matches. Entries left out keep their built-in color. Values are
+// Tailwind color names. The charts use the configured severity colors too.
+//
+// COLOR BY SOURCE:
+// With -color-by source, logs are colored by their derived source instead, so
+// each service keeps one recognizable color. Every source gets a stable color
+// hashed from its name; overrides are stored in the database:
+//
+//   - GET    /api/colors/sources           the color of every known source
+//   - PUT    /api/colors/sources/{source}  {"color": "teal"}
+//   - DELETE /api/colors/sources/{source}  back to the hashed color
+//
+// Logs without a source of their own (derived as "application-service"), and
+// custom types from the color file, are still colored as above.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// colorConfig is the -color-file
+type colorConfig struct {
+	Severities map[string]string `json:"severities"`
+	Categories map[string]string `json:"categories"`
+	Default    string            `json:"default"`
+}
+
+// severityColors maps derived severities (and custom types) to colors - configured once in main()
+var severityColors = map[string]string{
+	"critical": "red",
+	"error":    "rose",
+	"warning":  "yellow",
+	"success":  "green",
+	"debug":    "gray",
+	"info":     "blue",
+}
+
+// categoryColors colors logs without a severity color by category - configured once in main()
+var categoryColors = map[string]string{
+	"security":    "purple",
+	"database":    "indigo",
+	"performance": "orange",
+	"business":    "emerald",
+	"http":        "cyan",
+}
+
+// defaultColor is used when nothing else matches - configured once in main()
+var defaultColor = "blue"
+
+// chartColors are the severity colors from the color file, which the charts
+// use instead of their own palette - configured once in main()
+var chartColors = map[string]string{}
+
+// colorBySource colors logs by derived source instead of severity - configured once in main()
+var colorBySource bool
+
+// sourcePalette are the colors sources are hashed onto (no grays, which read as "no color")
+var sourcePalette = []string{
+	"red", "orange", "amber", "yellow", "lime", "green", "emerald", "teal", "cyan",
+	"sky", "blue", "indigo", "violet", "purple", "fuchsia", "pink", "rose",
+}
+
+// genericSources are what deriveMetadata falls back to when a log names no source
+var genericSources = []string{"", "unknown", "application-service"}
+
+// sourceColorOverrides caches the source_colors table
+var sourceColorOverrides = struct {
+	sync.RWMutex
+	colors map[string]string
+}{colors: map[string]string{}}
+
+// builtinSeverities are the severities deriveMetadata produces
+var builtinSeverities = []string{"critical", "error", "warning", "success", "info", "debug"}
+
+// loadColorConfig reads the color file and applies it on top of the built-in colors
+func loadColorConfig(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read color file: %v", err)
+	}
+	var config colorConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid color file: %v", err)
+	}
+
+	severities, err := mergeColors(severityColors, config.Severities, "severity")
+	if err != nil {
+		return err
+	}
+	categories, err := mergeColors(categoryColors, config.Categories, "category")
+	if err != nil {
+		return err
+	}
+	if config.Default != "" && !isValidTailwindColor(config.Default) {
+		return fmt.Errorf("default color '%s' is not a Tailwind color name", config.Default)
+	}
+	severityColors, categoryColors = severities, categories
+	defaultColor = valueOr(config.Default, defaultColor)
+	for name := range config.Severities {
+		name = strings.ToLower(strings.TrimSpace(name))
+		chartColors[name] = severityColors[name]
+	}
+	return nil
+}
+
+// mergeColors returns base with the configured entries applied
+func mergeColors(base, configured map[string]string, kind string) (map[string]string, error) {
+	merged := make(map[string]string, len(base)+len(configured))
+	for name, color := range base {
+		merged[name] = color
+	}
+	for name, color := range configured {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return nil, fmt.Errorf("empty %s name in color file", kind)
+		}
+		if !isValidTailwindColor(color) {
+			return nil, fmt.Errorf("%s '%s': '%s' is not a Tailwind color name", kind, name, color)
+		}
+		merged[name] = color
+	}
+	return merged, nil
+}
+
+// configureColorMode applies -color-by
+func configureColorMode(mode string) error {
+	switch mode {
+	case "", "severity":
+		colorBySource = false
+	case "source":
+		colorBySource = true
+	default:
+		return fmt.Errorf("-color-by must be severity or source")
+	}
+	return nil
+}
+
+// colorForLog picks the color of a log from its type and derived metadata
+func colorForLog(logType string, metadata LogMetadata) string {
+	// Custom severity names given as the log type win over content detection
+	logType = strings.ToLower(strings.TrimSpace(logType))
+	if color, ok := severityColors[logType]; ok && !containsString(builtinSeverities, logType) {
+		return color
+	}
+	if colorBySource && !containsString(genericSources, metadata.DerivedSource) {
+		return sourceColor(metadata.DerivedSource)
+	}
+	if color, ok := severityColors[metadata.DerivedSeverity]; ok {
+		return color
+	}
+	if color, ok := categoryColors[metadata.DerivedCategory]; ok {
+		return color
+	}
+	return defaultColor
+}
+
+// sourceColor returns the override of a source, or the color hashed from its name
+func sourceColor(source string) string {
+	sourceColorOverrides.RLock()
+	color, ok := sourceColorOverrides.colors[source]
+	sourceColorOverrides.RUnlock()
+	if ok {
+		return color
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(source))
+	return sourcePalette[hash.Sum32()%uint32(len(sourcePalette))]
+}
+
+// createSourceColorsTable creates the per-source color overrides
+func createSourceColorsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS source_colors (
+		source     TEXT PRIMARY KEY,
+		color      TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// loadSourceColors reads the stored overrides into the cache
+func loadSourceColors() error {
+	rows, err := db.Query("SELECT source, color FROM source_colors")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	colors := map[string]string{}
+	for rows.Next() {
+		var source, color string
+		if err := rows.Scan(&source, &color); err != nil {
+			return err
+		}
+		colors[source] = color
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sourceColorOverrides.Lock()
+	sourceColorOverrides.colors = colors
+	sourceColorOverrides.Unlock()
+	return nil
+}
+
+// sourceColorView is one source in GET /api/colors/sources
+type sourceColorView struct {
+	Source   string `json:"source"`
+	Color    string `json:"color"`
+	Override bool   `json:"override"`
+}
+
+// handleSourceColors answers GET /api/colors/sources
+func handleSourceColors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Sources with logs, plus overridden ones that have none (yet)
+	rows, err := db.Query("SELECT DISTINCT derived_source FROM logs WHERE derived_source NOT IN ('unknown', 'application-service') ORDER BY derived_source LIMIT 500")
+	if err != nil {
+		http.Error(w, "Failed to list sources", http.StatusInternalServerError)
+		return
+	}
+	var sources []string
+	for rows.Next() {
+		var source string
+		if rows.Scan(&source) == nil {
+			sources = append(sources, source)
+		}
+	}
+	rows.Close()
+	sourceColorOverrides.RLock()
+	for source := range sourceColorOverrides.colors {
+		if !containsString(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	sourceColorOverrides.RUnlock()
+
+	views := make([]sourceColorView, 0, len(sources))
+	for _, source := range sources {
+		sourceColorOverrides.RLock()
+		_, override := sourceColorOverrides.colors[source]
+		sourceColorOverrides.RUnlock()
+		views = append(views, sourceColorView{Source: source, Color: sourceColor(source), Override: override})
+	}
+
+	mode := "severity"
+	if colorBySource {
+		mode = "source"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"color_by": mode, "sources": views})
+}
+
+// handleSourceColor answers PUT and DELETE /api/colors/sources/{source}
+func handleSourceColor(w http.ResponseWriter, r *http.Request) {
+	source := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/colors/sources/"))
+	if source == "" || len(source) > 100 {
+		http.Error(w, "Source name must be 1-100 characters", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var request struct {
+			Color string `json:"color"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !isValidTailwindColor(request.Color) {
+			http.Error(w, fmt.Sprintf("'%s' is not a Tailwind color name", request.Color), http.StatusBadRequest)
+			return
+		}
+		if err := saveSourceColor(source, request.Color); err != nil {
+			http.Error(w, "Failed to save source color", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if _, err := db.Exec(db.Rebind("DELETE FROM source_colors WHERE source = ?"), source); err != nil {
+			http.Error(w, "Failed to reset source color", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := loadSourceColors(); err != nil {
+		http.Error(w, "Failed to load source colors", http.StatusInternalServerError)
+		return
+	}
+
+	sourceColorOverrides.RLock()
+	_, override := sourceColorOverrides.colors[source]
+	sourceColorOverrides.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sourceColorView{Source: source, Color: sourceColor(source), Override: override})
+}
+
+// saveSourceColor stores the override of a source
+func saveSourceColor(source, color string) error {
+	now := dbTime(time.Now())
+	result, err := db.Exec(db.Rebind("UPDATE source_colors SET color = ?, updated_at = ? WHERE source = ?"), color, now, source)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+	_, err = db.Exec(db.Rebind("INSERT INTO source_colors (source, color, updated_at) VALUES (?, ?, ?)"), source, color, now)
+	return err
+}
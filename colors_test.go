@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestColorConfig tests overriding severity colors and adding custom severities
+func TestColorConfig(t *testing.T) {
+	severities, categories, fallback := severityColors, categoryColors, defaultColor
+	defer func() {
+		severityColors, categoryColors, defaultColor, chartColors = severities, categories, fallback, map[string]string{}
+	}()
+
+	path := filepath.Join(t.TempDir(), "colors.json")
+	os.WriteFile(path, []byte(`{"severities": {"Warning": "orange", "audit": "teal"}, "default": "slate"}`), 0644)
+	if err := loadColorConfig(path); err != nil {
+		t.Fatalf("Failed to load color file: %v", err)
+	}
+
+	tests := []struct {
+		header   LogHeader
+		expected string
+	}{
+		{LogHeader{Type: "warning", Title: "Disk usage high"}, "orange"},
+		{LogHeader{Type: "audit", Title: "Payment failed for order 7"}, "teal"},
+		{LogHeader{Type: "error", Title: "Database connection failed"}, "rose"},
+	}
+	for _, test := range tests {
+		if color := deriveColorFromSeverity(test.header, nil); color != test.expected {
+			t.Errorf("Expected %s for %+v, got %s", test.expected, test.header, color)
+		}
+	}
+	if chartColors["warning"] != "orange" || chartColors["error"] != "" {
+		t.Errorf("Expected only the configured severities for the charts, got %v", chartColors)
+	}
+
+	os.WriteFile(path, []byte(`{"severities": {"warning": "#ff8800"}}`), 0644)
+	if err := loadColorConfig(path); err == nil {
+		t.Error("Expected a hex value to be rejected")
+	}
+	if severityColors["warning"] != "orange" {
+		t.Errorf("Expected a rejected file to leave the colors unchanged, got %s", severityColors["warning"])
+	}
+}
+
+// TestSourceColors tests coloring logs by source with stored overrides
+func TestSourceColors(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer configureColorMode("severity")
+	defer func() { sourceColorOverrides.colors = map[string]string{} }()
+
+	if err := configureColorMode("service"); err == nil {
+		t.Error("Expected an unknown -color-by mode to be rejected")
+	}
+	configureColorMode("source")
+	checkout := LogHeader{Title: "Payment failed", Source: "checkout"}
+	hashed := deriveColorFromSeverity(checkout, nil)
+	if !containsString(sourcePalette, hashed) || deriveColorFromSeverity(LogHeader{Title: "Order placed", Source: "checkout"}, nil) != hashed {
+		t.Errorf("Expected one stable palette color for every checkout log, got %s", hashed)
+	}
+	if color := deriveColorFromSeverity(LogHeader{Title: "Something failed"}, nil); color != "rose" {
+		t.Errorf("Expected logs without a source to keep their severity color, got %s", color)
+	}
+
+	w := httptest.NewRecorder()
+	handleSourceColor(w, httptest.NewRequest("PUT", "/api/colors/sources/checkout", strings.NewReader(`{"color": "teal"}`)))
+	if w.Code != 200 || deriveColorFromSeverity(checkout, nil) != "teal" {
+		t.Errorf("Expected the override to color checkout logs teal, got %d %s", w.Code, deriveColorFromSeverity(checkout, nil))
+	}
+	w = httptest.NewRecorder()
+	handleSourceColor(w, httptest.NewRequest("PUT", "/api/colors/sources/checkout", strings.NewReader(`{"color": "#00ff00"}`)))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for a non-Tailwind color, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleSourceColors(w, httptest.NewRequest("GET", "/api/colors/sources", nil))
+	var response struct {
+		ColorBy string            `json:"color_by"`
+		Sources []sourceColorView `json:"sources"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.ColorBy != "source" || len(response.Sources) != 1 || !response.Sources[0].Override || response.Sources[0].Color != "teal" {
+		t.Errorf("Expected checkout listed with its override, got %+v", response)
+	}
+
+	handleSourceColor(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/api/colors/sources/checkout", nil))
+	if color := deriveColorFromSeverity(checkout, nil); color != hashed {
+		t.Errorf("Expected the hashed color back after a reset, got %s", color)
+	}
+}
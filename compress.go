@@ -0,0 +1,187 @@
+// CubicLog Compression - gzip/deflate responses for the heavy endpoints
+//
+// Log listings, exports and the dashboard HTML are large and highly
+// repetitive; compressed they shrink by 80-90%. compressHandler picks gzip or
+// deflate from the client's Accept-Encoding (gzip preferred) and streams the
+// compressed output, so exports are never buffered in memory. Responses
+// without a body (204, 304), responses that already carry a Content-Encoding
+// and formats that are compressed already (xlsx) pass through unchanged.
+//
+// Exports also accept ?compress=gzip for clients that don't negotiate (plain
+// downloads, scripts): the response is then a .gz file (cubiclog_export.json.gz)
+// instead of a transparently compressed one, streamed the same way.
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gzipWriters  = sync.Pool{New: func() interface{} { w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression); return w }}
+	flateWriters = sync.Pool{New: func() interface{} { w, _ := flate.NewWriter(nil, flate.DefaultCompression); return w }}
+)
+
+// acceptedEncoding returns gzip, deflate or "" for an Accept-Encoding header
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		accepted[name] = true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted[name] = err == nil && q > 0 // q=0 means "not acceptable"
+			}
+		}
+	}
+	_, gzipListed := accepted["gzip"]
+	switch {
+	case accepted["gzip"], accepted["*"] && !gzipListed:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter compresses the response body once the status is known
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	writer   io.WriteCloser // nil while undecided or when passing through
+	decided  bool
+	download bool // ?compress=gzip: serve a .gz file rather than a Content-Encoding
+}
+
+// precompressedTypes are content types that gain nothing from compression
+var precompressedTypes = []string{"application/zip", "application/gzip",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+
+// start decides whether the response gets compressed
+func (c *compressWriter) start(status int) {
+	c.decided = true
+	header := c.Header()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || header.Get("Content-Encoding") != "" {
+		return
+	}
+	header.Del("Content-Length")
+	if c.download {
+		// Errors stay readable; everything else becomes a .gz attachment
+		if status >= 400 {
+			return
+		}
+		header.Set("Content-Type", "application/gzip")
+		if disposition := header.Get("Content-Disposition"); strings.Contains(disposition, "filename=") {
+			header.Set("Content-Disposition", disposition+".gz")
+		}
+	} else if containsString(precompressedTypes, header.Get("Content-Type")) {
+		return
+	} else {
+		header.Set("Content-Encoding", c.encoding)
+	}
+
+	if c.encoding == "gzip" {
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(c.ResponseWriter)
+		c.writer = gz
+	} else {
+		fl := flateWriters.Get().(*flate.Writer)
+		fl.Reset(c.ResponseWriter)
+		c.writer = fl
+	}
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if !c.decided {
+		c.start(status)
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.decided {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.writer != nil {
+		return c.writer.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush pushes compressed data to the client, for streaming responses
+func (c *compressWriter) Flush() {
+	if flusher, ok := c.writer.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close finishes the compressed stream and returns the writer to its pool
+func (c *compressWriter) close() {
+	switch w := c.writer.(type) {
+	case *gzip.Writer:
+		w.Close()
+		gzipWriters.Put(w)
+	case *flate.Writer:
+		w.Close()
+		flateWriters.Put(w)
+	}
+}
+
+// compressHandler compresses responses for clients that accept it
+func compressHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			handler(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		handler(cw, r)
+	}
+}
+
+// exportCompressHandler compresses exports like compressHandler and also
+// offers them as .gz downloads with ?compress=gzip. Signed exports (?sign=,
+// see exportsign.go) are not compressed on the fly, as their checksum must
+// match the file the client ends up with.
+func exportCompressHandler(handler http.HandlerFunc) http.HandlerFunc {
+	negotiated := compressHandler(handler)
+	download := func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{ResponseWriter: w, encoding: "gzip", download: true}
+		defer cw.close()
+		handler(cw, r)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		sign := r.URL.Query().Get("sign") != ""
+		switch r.URL.Query().Get("compress") {
+		case "":
+			if sign {
+				signExport(w, r, handler)
+			} else {
+				negotiated(w, r)
+			}
+		case "gzip":
+			if sign {
+				signExport(w, r, download)
+			} else {
+				download(w, r)
+			}
+		default:
+			http.Error(w, "Unsupported compress value - use compress=gzip", http.StatusBadRequest)
+		}
+	}
+}
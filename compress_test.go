@@ -0,0 +1,125 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestResponseCompression tests gzip/deflate negotiation on the log endpoints
+func TestResponseCompression(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 50; i++ {
+		req := httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"type":"info","title":"Repetitive log entry"},"body":{"service":"api"}}`))
+		createLog(httptest.NewRecorder(), req)
+	}
+	handler := compressHandler(handleLogs)
+
+	// gzip is preferred and the result decodes to the same JSON
+	req := httptest.NewRequest("GET", "/api/logs?limit=50", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got '%s'", w.Header().Get("Content-Encoding"))
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got '%s'", w.Header().Get("Vary"))
+	}
+	compressedSize := w.Body.Len()
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip response: %v", err)
+	}
+	plain, _ := io.ReadAll(reader)
+	var response []Log
+	if err := json.Unmarshal(plain, &response); err != nil {
+		t.Fatalf("Invalid JSON after decompression: %v", err)
+	}
+	if compressedSize*3 > len(plain) {
+		t.Errorf("Expected at least 3x compression, got %d -> %d bytes", len(plain), compressedSize)
+	}
+
+	// deflate when gzip is refused
+	req = httptest.NewRequest("GET", "/api/logs", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, deflate")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if w.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("Expected deflate encoding, got '%s'", w.Header().Get("Content-Encoding"))
+	}
+	plain, _ = io.ReadAll(flate.NewReader(w.Body))
+	if !json.Valid(plain) {
+		t.Errorf("Expected valid JSON after inflating")
+	}
+
+	// No Accept-Encoding: plain response
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/api/logs", nil))
+	if w.Header().Get("Content-Encoding") != "" || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("Expected an uncompressed JSON response")
+	}
+
+	// Bodiless responses are never encoded
+	notModified := compressHandler(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotModified) })
+	req = httptest.NewRequest("GET", "/api/logs", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	notModified(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty unencoded 304, got encoding '%s' and %d bytes", w.Header().Get("Content-Encoding"), w.Body.Len())
+	}
+}
+
+// TestExportCompression tests ?compress=gzip downloads and pass-through of xlsx exports
+func TestExportCompression(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"type":"info","title":"Nightly backup"}}`)))
+
+	// ?compress=gzip: a .gz attachment without Content-Encoding
+	w := httptest.NewRecorder()
+	exportCompressHandler(handleExportJSON)(w, httptest.NewRequest("GET", "/api/export/json?compress=gzip", nil))
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Content-Type") != "application/gzip" ||
+		!strings.HasSuffix(w.Header().Get("Content-Disposition"), "cubiclog_export.json.gz") {
+		t.Fatalf("Expected a .gz download, got headers %v", w.Header())
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip data: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	if !strings.Contains(string(data), "Nightly backup") {
+		t.Errorf("Expected the export inside the archive, got %s", data)
+	}
+
+	// Errors are not compressed
+	w = httptest.NewRecorder()
+	exportCompressHandler(handleExportCSV)(w, httptest.NewRequest("GET", "/api/export/csv?compress=gzip&columns=nope", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown column") {
+		t.Errorf("Expected a readable 400, got %d: %q", w.Code, w.Body.String())
+	}
+
+	// Workbooks are zip files already and skip negotiated compression
+	req := httptest.NewRequest("GET", "/api/export/xlsx", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	exportCompressHandler(handleExportXLSX)(w, req)
+	if w.Header().Get("Content-Encoding") != "" || !strings.HasPrefix(w.Body.String(), "PK") {
+		t.Errorf("Expected an uncompressed zip, got Content-Encoding '%s'", w.Header().Get("Content-Encoding"))
+	}
+
+	w = httptest.NewRecorder()
+	exportCompressHandler(handleExportJSON)(w, httptest.NewRequest("GET", "/api/export/json?compress=zstd", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsupported compress value, got %d", w.Code)
+	}
+}
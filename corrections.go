@@ -0,0 +1,342 @@
+// CubicLog Corrections - Smart by default, and improving
+//
+//   - POST   /api/corrections                  correct a log: {"log_id": 42, "severity": "warning", "source": "billing"}
+//   - GET    /api/corrections                  learned corrections and recent corrections
+//   - DELETE /api/corrections/{fingerprint}    forget a learned correction
+//
+// When the smart detection gets a log wrong, its derived severity and/or
+// source can be corrected, from the API or the dashboard's expanded log. The
+// log changes right away, the correction is kept in log_corrections, and it is
+// learned: later logs with the same fingerprint - the source they were derived
+// with and their normalized title (see groups.go) - get the corrected severity
+// and source as well. The latest correction of a fingerprint wins, and dry
+// runs name the learned correction that applied ("correction").
+//
+// /api/stats reports the corrections made, the learned corrections and how
+// many logs they corrected on arrival. Learned corrections live in memory and
+// are reloaded on start; other instances sharing a PostgreSQL database pick up
+// new ones on restart.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// learnedCorrection is what later logs of a fingerprint are corrected to
+type learnedCorrection struct {
+	Fingerprint string    `json:"fingerprint"`
+	Title       string    `json:"title"`            // title of the corrected log
+	Source      string    `json:"source,omitempty"` // "" keeps the derived source
+	Severity    string    `json:"severity,omitempty"`
+	Corrections int       `json:"corrections"` // times logs of the fingerprint were corrected
+	Applied     int       `json:"applied"`     // logs corrected on arrival
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// logCorrection is one correction of a stored log
+type logCorrection struct {
+	LogID        int       `json:"log_id"`
+	Fingerprint  string    `json:"fingerprint"`
+	SeverityFrom string    `json:"severity_from"`
+	SeverityTo   string    `json:"severity_to"`
+	SourceFrom   string    `json:"source_from"`
+	SourceTo     string    `json:"source_to"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// correctionRequest is the body of POST /api/corrections
+type correctionRequest struct {
+	LogID    int    `json:"log_id"`
+	Severity string `json:"severity"`
+	Source   string `json:"source"`
+}
+
+// correctionStats is the corrections summary shown in /api/stats
+type correctionStats struct {
+	Total   int `json:"total"`   // corrections made
+	Learned int `json:"learned"` // fingerprints with a learned correction
+	Applied int `json:"applied"` // logs corrected on arrival
+}
+
+// Learned corrections by fingerprint - loaded once in main(), changed by the API
+var (
+	activeCorrections atomic.Pointer[map[string]learnedCorrection]
+	correctionsMu     sync.Mutex // serializes changes and reloads
+)
+
+// createCorrectionsTables creates the corrections and the learned corrections
+func createCorrectionsTables() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS log_corrections (
+		id            ` + alertIDColumn() + `,
+		log_id        BIGINT NOT NULL,
+		fingerprint   TEXT NOT NULL,
+		severity_from TEXT NOT NULL DEFAULT '',
+		severity_to   TEXT NOT NULL DEFAULT '',
+		source_from   TEXT NOT NULL DEFAULT '',
+		source_to     TEXT NOT NULL DEFAULT '',
+		created_at    TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_log_corrections_created_at ON log_corrections(created_at);
+	CREATE TABLE IF NOT EXISTS learned_corrections (
+		fingerprint TEXT PRIMARY KEY,
+		title       TEXT NOT NULL,
+		source      TEXT NOT NULL DEFAULT '',
+		severity    TEXT NOT NULL DEFAULT '',
+		corrections INTEGER NOT NULL DEFAULT 0,
+		applied     INTEGER NOT NULL DEFAULT 0,
+		updated_at  TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// loadCorrections reads the learned corrections into memory
+func loadCorrections() error {
+	correctionsMu.Lock()
+	defer correctionsMu.Unlock()
+	return refreshCorrections()
+}
+
+// refreshCorrections replaces the learned corrections in memory (correctionsMu held)
+func refreshCorrections() error {
+	learned, err := loadLearnedCorrections()
+	if err != nil {
+		return err
+	}
+	byFingerprint := make(map[string]learnedCorrection, len(learned))
+	for _, c := range learned {
+		byFingerprint[c.Fingerprint] = c
+	}
+	activeCorrections.Store(&byFingerprint)
+	return nil
+}
+
+// loadLearnedCorrections returns the stored learned corrections, most recent first
+func loadLearnedCorrections() ([]learnedCorrection, error) {
+	rows, err := db.Query("SELECT fingerprint, title, source, severity, corrections, applied, updated_at FROM learned_corrections ORDER BY updated_at DESC, fingerprint")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	learned := []learnedCorrection{}
+	for rows.Next() {
+		var c learnedCorrection
+		if err := rows.Scan(&c.Fingerprint, &c.Title, &c.Source, &c.Severity, &c.Corrections, &c.Applied, (*scanTime)(&c.UpdatedAt)); err != nil {
+			return nil, err
+		}
+		learned = append(learned, c)
+	}
+	return learned, rows.Err()
+}
+
+// withLearnedCorrection applies the learned correction of a log's fingerprint, if any
+func withLearnedCorrection(header LogHeader, metadata LogMetadata) LogMetadata {
+	corrections := activeCorrections.Load()
+	if corrections == nil || len(*corrections) == 0 {
+		return metadata
+	}
+	fingerprint := errorFingerprint(metadata.DerivedSource, header.Title)
+	c, ok := (*corrections)[fingerprint]
+	if !ok {
+		return metadata
+	}
+	if c.Severity != "" {
+		metadata.DerivedSeverity = c.Severity
+	}
+	if c.Source != "" {
+		metadata.DerivedSource = c.Source
+	}
+	metadata.Correction = fingerprint
+	return metadata
+}
+
+// countCorrectionApplied counts a stored log corrected on arrival
+func countCorrectionApplied(metadata LogMetadata) {
+	if metadata.Correction != "" {
+		db.Exec(db.Rebind("UPDATE learned_corrections SET applied = applied + 1 WHERE fingerprint = ?"), metadata.Correction)
+	}
+}
+
+// correctLog changes a stored log's derived severity and source and learns the correction
+func correctLog(request correctionRequest, now time.Time) (logCorrection, error) {
+	var header LogHeader
+	var description, source, body, severity, derivedSource sql.NullString
+	err := db.QueryRow(db.Rebind("SELECT type, title, description, source, body, derived_severity, derived_source FROM logs WHERE id = ?"), request.LogID).
+		Scan(&header.Type, &header.Title, &description, &source, &body, &severity, &derivedSource)
+	if err != nil {
+		return logCorrection{}, err
+	}
+	header.Description, header.Source = openField(description.String), source.String
+
+	// The fingerprint is that of the log as detected, before any learned correction
+	var parsed map[string]interface{}
+	json.Unmarshal([]byte(openField(body.String)), &parsed)
+	detected := deriveMetadata(header, parsed)
+	fingerprint := detected.Correction
+	if fingerprint == "" {
+		fingerprint = errorFingerprint(detected.DerivedSource, header.Title)
+	}
+
+	c := logCorrection{LogID: request.LogID, Fingerprint: fingerprint, SeverityFrom: severity.String, SeverityTo: severity.String,
+		SourceFrom: derivedSource.String, SourceTo: derivedSource.String, CreatedAt: now.UTC().Truncate(time.Second)}
+	if request.Severity != "" {
+		c.SeverityTo = request.Severity
+	}
+	if request.Source != "" {
+		c.SourceTo = request.Source
+	}
+
+	correctionsMu.Lock()
+	defer correctionsMu.Unlock()
+	tx, err := db.Begin()
+	if err != nil {
+		return c, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(db.Rebind("UPDATE logs SET derived_severity = ?, derived_source = ? WHERE id = ?"), c.SeverityTo, c.SourceTo, c.LogID); err != nil {
+		return c, err
+	}
+	if _, err := tx.Exec(db.Rebind(`INSERT INTO log_corrections (log_id, fingerprint, severity_from, severity_to, source_from, source_to, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`), c.LogID, c.Fingerprint, c.SeverityFrom, c.SeverityTo, c.SourceFrom, c.SourceTo, dbTime(c.CreatedAt)); err != nil {
+		return c, err
+	}
+	result, err := tx.Exec(db.Rebind(`UPDATE learned_corrections SET title = ?, source = ?, severity = ?, corrections = corrections + 1, updated_at = ?
+		WHERE fingerprint = ?`), header.Title, request.Source, request.Severity, dbTime(c.CreatedAt), fingerprint)
+	if err != nil {
+		return c, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := tx.Exec(db.Rebind(`INSERT INTO learned_corrections (fingerprint, title, source, severity, corrections, applied, updated_at)
+			VALUES (?, ?, ?, ?, 1, 0, ?)`), fingerprint, header.Title, request.Source, request.Severity, dbTime(c.CreatedAt)); err != nil {
+			return c, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c, err
+	}
+	bulkGeneration.Add(1)
+	invalidateHourlyStats()
+	return c, refreshCorrections()
+}
+
+// recentCorrections returns the latest corrections, newest first
+func recentCorrections(limit int) ([]logCorrection, error) {
+	rows, err := db.Query(db.Rebind(`SELECT log_id, fingerprint, severity_from, severity_to, source_from, source_to, created_at
+		FROM log_corrections ORDER BY created_at DESC, id DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	corrections := []logCorrection{}
+	for rows.Next() {
+		var c logCorrection
+		if err := rows.Scan(&c.LogID, &c.Fingerprint, &c.SeverityFrom, &c.SeverityTo, &c.SourceFrom, &c.SourceTo, (*scanTime)(&c.CreatedAt)); err != nil {
+			return nil, err
+		}
+		corrections = append(corrections, c)
+	}
+	return corrections, rows.Err()
+}
+
+// loadCorrectionStats summarizes the corrections for /api/stats
+func loadCorrectionStats() correctionStats {
+	var stats correctionStats
+	db.QueryRow("SELECT COUNT(*) FROM log_corrections").Scan(&stats.Total)
+	db.QueryRow("SELECT COUNT(*), COALESCE(SUM(applied), 0) FROM learned_corrections").Scan(&stats.Learned, &stats.Applied)
+	return stats
+}
+
+// parseCorrectionRequest reads and validates a correction
+func parseCorrectionRequest(r *http.Request) (correctionRequest, error) {
+	var request correctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, fmt.Errorf("Invalid JSON")
+	}
+	if request.LogID <= 0 {
+		return request, fmt.Errorf("log_id is required")
+	}
+	request.Severity = strings.ToLower(strings.TrimSpace(request.Severity))
+	request.Source = strings.TrimSpace(request.Source)
+	if request.Severity == "" && request.Source == "" {
+		return request, fmt.Errorf("correct the severity, the source or both")
+	}
+	if request.Severity != "" && !containsString(builtinSeverities, request.Severity) {
+		return request, fmt.Errorf("severity must be one of %s", strings.Join(builtinSeverities, ", "))
+	}
+	if len(request.Source) > 100 {
+		return request, fmt.Errorf("source must be at most 100 characters")
+	}
+	return request, nil
+}
+
+// handleCorrections answers GET and POST /api/corrections
+func handleCorrections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		learned, err := loadLearnedCorrections()
+		if err != nil {
+			http.Error(w, "Failed to load corrections", http.StatusInternalServerError)
+			return
+		}
+		recent, err := recentCorrections(50)
+		if err != nil {
+			http.Error(w, "Failed to load corrections", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"learned": learned, "recent": recent})
+
+	case http.MethodPost:
+		request, err := parseCorrectionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		correction, err := correctLog(request, time.Now())
+		if err == sql.ErrNoRows {
+			http.Error(w, "Log not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to save correction", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(correction)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCorrection answers DELETE /api/corrections/{fingerprint}
+func handleCorrection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fingerprint := strings.TrimPrefix(r.URL.Path, "/api/corrections/")
+	result, err := db.Exec(db.Rebind("DELETE FROM learned_corrections WHERE fingerprint = ?"), fingerprint)
+	if err != nil {
+		http.Error(w, "Failed to delete correction", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Learned correction not found", http.StatusNotFound)
+		return
+	}
+	if err := loadCorrections(); err != nil {
+		http.Error(w, "Failed to reload corrections", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "deleted", "fingerprint": fingerprint})
+}
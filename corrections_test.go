@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCorrections tests correcting a log and applying the learned correction to similar logs
+func TestCorrections(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() {
+		db.Exec("DELETE FROM learned_corrections")
+		loadCorrections()
+	}()
+	loadCorrections()
+
+	send := func(title string) int {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header": {"title": "`+title+`", "source": "shop"}}`)))
+		var entry Log
+		json.NewDecoder(w.Body).Decode(&entry)
+		return entry.ID
+	}
+	stored := func(id int) (severity, source string) {
+		db.QueryRow("SELECT derived_severity, derived_source FROM logs WHERE id = ?", id).Scan(&severity, &source)
+		return
+	}
+
+	id := send("Order 1001 failed validation retry scheduled")
+	if severity, _ := stored(id); severity != "error" {
+		t.Fatalf("Expected the detection to rate the log error, got %s", severity)
+	}
+
+	correct := func(body string) int {
+		w := httptest.NewRecorder()
+		handleCorrections(w, httptest.NewRequest("POST", "/api/corrections", strings.NewReader(body)))
+		return w.Code
+	}
+	if code := correct(`{"log_id": ` + strconv.Itoa(id) + `, "severity": "info", "source": "orders"}`); code != 201 {
+		t.Fatalf("Expected status 201, got %d", code)
+	}
+	if severity, source := stored(id); severity != "info" || source != "orders" {
+		t.Errorf("Expected the log corrected to info/orders, got %s/%s", severity, source)
+	}
+
+	// Similar logs (same source and normalized title) get the correction on arrival
+	next := send("Order 2002 failed validation retry scheduled")
+	if severity, source := stored(next); severity != "info" || source != "orders" {
+		t.Errorf("Expected the learned correction applied, got %s/%s", severity, source)
+	}
+	if severity, _ := stored(send("Payment failed")); severity != "error" {
+		t.Errorf("Expected other logs untouched, got %s", severity)
+	}
+
+	for body, expected := range map[string]int{
+		`{"log_id": 999999, "severity": "info"}`:                     404,
+		`{"log_id": ` + strconv.Itoa(id) + `, "severity": "urgent"}`: 400,
+		`{"log_id": ` + strconv.Itoa(id) + `}`:                       400,
+	} {
+		if code := correct(body); code != expected {
+			t.Errorf("Expected status %d for %s, got %d", expected, body, code)
+		}
+	}
+
+	if stats := loadCorrectionStats(); stats.Total != 1 || stats.Learned != 1 || stats.Applied != 1 {
+		t.Errorf("Expected one correction learned and applied once, got %+v", stats)
+	}
+
+	// Forgetting the correction restores the detection
+	learned, _ := loadLearnedCorrections()
+	w := httptest.NewRecorder()
+	handleCorrection(w, httptest.NewRequest("DELETE", "/api/corrections/"+learned[0].Fingerprint, nil))
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if severity, _ := stored(send("Order 3003 failed validation retry scheduled")); severity != "error" {
+		t.Errorf("Expected the detection back after forgetting the correction, got %s", severity)
+	}
+}
@@ -0,0 +1,312 @@
+// CubicLog Correlations - Which spikes come together
+//
+//	GET /api/correlations                        pairs found over the last 24 hours
+//	GET /api/correlations?source=payment-service pairs involving a source
+//
+// Every 10 minutes CubicLog looks at the errors and warnings of the last 24
+// hours as signals: the errors (error or critical) and warnings of each
+// source, and each error group (see groups.go). A signal spikes in a minute
+// with at least 3 logs and at least three times its average rate; spike
+// minutes close together form one spike. For every pair of signals it counts
+// how often a spike of one (the follower) started within 5 minutes after, or
+// together with, a spike of the other (the leader):
+//   - co_occurrences  follower spikes with a leader spike before them
+//   - confidence      the share of the follower's spikes that had one, in percent
+//   - lift            how much more often than the leader's spikes would
+//     cover a random minute
+//   - median_lag_seconds  the typical time from the leader to the follower
+//
+// Pairs are listed when they co-occurred at least twice, with a confidence of
+// 50% or more and a lift of 2 or more, most confident first - so that
+// "payment-service errors follow redis-cache warnings" shows up as
+// redis-cache/warning leading payment-service/error. A pair can be listed both
+// ways when the spikes start together. Correlation is a lead, not proof of
+// cause.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	correlationInterval      = 10 * time.Minute // how often the correlations are computed
+	correlationLookback      = 24 * time.Hour   // the history looked at
+	correlationWindow        = 5 * time.Minute  // how long after a leader spike a follower spike counts
+	correlationMinSpike      = 3                // logs in a minute before it can be a spike
+	correlationSpikeFactor   = 3                // times the average rate a spike minute needs
+	correlationMinSupport    = 2                // co-occurrences before a pair is listed
+	correlationMinConfidence = 50.0             // percent of the follower's spikes
+	correlationMinLift       = 2.0
+)
+
+// CorrelationSignal is a source's errors or warnings, or an error group
+type CorrelationSignal struct {
+	Kind     string `json:"kind"` // source or group
+	Source   string `json:"source"`
+	Severity string `json:"severity,omitempty"` // error or warning, for sources
+	GroupID  int64  `json:"group_id,omitempty"`
+	Title    string `json:"title,omitempty"` // for groups
+	Spikes   int    `json:"spikes"`
+}
+
+// Correlation is a follower signal whose spikes tend to come with the leader's
+type Correlation struct {
+	Leader        CorrelationSignal `json:"leader"`
+	Follower      CorrelationSignal `json:"follower"`
+	CoOccurrences int               `json:"co_occurrences"`
+	Confidence    float64           `json:"confidence"`
+	Lift          float64           `json:"lift"`
+	MedianLag     int               `json:"median_lag_seconds"`
+	Summary       string            `json:"summary"`
+}
+
+// correlationResult is the latest computation
+type correlationResult struct {
+	ComputedAt   time.Time     `json:"computed_at"`
+	From         time.Time     `json:"from"`
+	Window       string        `json:"window"`
+	Signals      int           `json:"signals"`
+	Correlations []Correlation `json:"correlations"`
+}
+
+// correlations holds the latest result of the job
+var correlations struct {
+	sync.Mutex
+	result *correlationResult
+}
+
+// label names a signal in summaries ("payment-service errors", "error group 12 (Order 4711 failed)")
+func (s CorrelationSignal) label() string {
+	if s.Kind == "group" {
+		return fmt.Sprintf("error group %d (%s)", s.GroupID, s.Title)
+	}
+	return s.Source + " " + s.Severity + "s"
+}
+
+// signalSpikes returns the start of each spike in per-minute counts
+func signalSpikes(minutes map[time.Time]int, lookback time.Duration) []time.Time {
+	total := 0
+	for _, count := range minutes {
+		total += count
+	}
+	average := float64(total) / lookback.Minutes()
+
+	var spiking []time.Time
+	for minute, count := range minutes {
+		if count >= correlationMinSpike && float64(count) >= average*correlationSpikeFactor {
+			spiking = append(spiking, minute)
+		}
+	}
+	sort.Slice(spiking, func(i, j int) bool { return spiking[i].Before(spiking[j]) })
+
+	// Spike minutes at most two minutes apart belong to the same spike
+	var starts []time.Time
+	for i, minute := range spiking {
+		if i == 0 || minute.Sub(spiking[i-1]) > 2*time.Minute {
+			starts = append(starts, minute)
+		}
+	}
+	return starts
+}
+
+// correlate finds the follower spikes that had a leader spike up to window before them
+func correlate(leader, follower []time.Time, window time.Duration) (int, []time.Duration) {
+	var lags []time.Duration
+	for _, start := range follower {
+		// The closest leader spike at or before the follower's
+		i := sort.Search(len(leader), func(i int) bool { return leader[i].After(start) }) - 1
+		if i >= 0 && start.Sub(leader[i]) <= window {
+			lags = append(lags, start.Sub(leader[i]))
+		}
+	}
+	return len(lags), lags
+}
+
+// loadSignals counts the errors and warnings since from per minute and signal
+func loadSignals(from time.Time) (map[string]*CorrelationSignal, map[string]map[time.Time]int, error) {
+	// Before the logs are read: a single-connection database has no room for both
+	groups := map[string]ErrorGroup{}
+	if loaded, err := loadErrorGroups(from, 100000); err == nil {
+		for _, group := range loaded {
+			groups[group.Fingerprint] = group
+		}
+	}
+
+	minuteExpr := "substr(CAST(timestamp AS TEXT), 1, 16)"
+	rows, release, err := queryLogs(from.Format("2006-01-02"), "", func(table string) (string, []interface{}) {
+		return db.Rebind(`
+			SELECT ` + minuteExpr + `, COALESCE(derived_source, 'unknown'), derived_severity, title, COUNT(*)
+			FROM ` + table + `
+			WHERE timestamp >= ? AND derived_severity IN ('critical', 'error', 'warning')
+			GROUP BY ` + minuteExpr + `, COALESCE(derived_source, 'unknown'), derived_severity, title`), []interface{}{dbTime(from)}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	signals, counts := map[string]*CorrelationSignal{}, map[string]map[time.Time]int{}
+	add := func(key string, signal CorrelationSignal, minute time.Time, count int) {
+		if signals[key] == nil {
+			signals[key], counts[key] = &signal, map[time.Time]int{}
+		}
+		counts[key][minute] += count
+	}
+	for rows.Next() {
+		var minuteText, source, severity, title string
+		var count int
+		if err := rows.Scan(&minuteText, &source, &severity, &title, &count); err != nil {
+			return nil, nil, err
+		}
+		minute, err := time.ParseInLocation("2006-01-02 15:04", minuteText, time.UTC)
+		if err != nil {
+			continue
+		}
+		if severity == "warning" {
+			add("source/warning/"+source, CorrelationSignal{Kind: "source", Source: source, Severity: "warning"}, minute, count)
+			continue
+		}
+		add("source/error/"+source, CorrelationSignal{Kind: "source", Source: source, Severity: "error"}, minute, count)
+		if group, ok := groups[errorFingerprint(source, title)]; ok {
+			add("group/"+strconv.FormatInt(group.ID, 10), CorrelationSignal{Kind: "group", Source: source, GroupID: group.ID, Title: group.Title}, minute, count)
+		}
+	}
+	return signals, counts, rows.Err()
+}
+
+// computeCorrelations finds the co-occurring spikes of the lookback ending now
+func computeCorrelations(now time.Time, window, lookback time.Duration) (*correlationResult, error) {
+	from := now.Add(-lookback)
+	signals, counts, err := loadSignals(from)
+	if err != nil {
+		return nil, err
+	}
+
+	spikes := map[string][]time.Time{}
+	for key, minutes := range counts {
+		if starts := signalSpikes(minutes, lookback); len(starts) > 0 {
+			spikes[key] = starts
+			signals[key].Spikes = len(starts)
+		}
+	}
+
+	result := &correlationResult{ComputedAt: now, From: from, Window: window.String(), Signals: len(spikes), Correlations: []Correlation{}}
+	for leaderKey, leader := range spikes {
+		for followerKey, follower := range spikes {
+			if leaderKey == followerKey || len(follower) < correlationMinSupport {
+				continue
+			}
+			// An error group and the errors of its own source always come together
+			if l, f := signals[leaderKey], signals[followerKey]; l.Source == f.Source && (l.Kind == "group") != (f.Kind == "group") &&
+				l.Severity != "warning" && f.Severity != "warning" {
+				continue
+			}
+			support, lags := correlate(leader, follower, window)
+			if support < correlationMinSupport {
+				continue
+			}
+			confidence := float64(support) / float64(len(follower)) * 100
+			coverage := float64(len(leader)) * (window.Minutes() + 1) / lookback.Minutes()
+			lift := confidence / 100 / min(coverage, 1)
+			if confidence < correlationMinConfidence || lift < correlationMinLift {
+				continue
+			}
+			sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+			correlation := Correlation{
+				Leader:        *signals[leaderKey],
+				Follower:      *signals[followerKey],
+				CoOccurrences: support,
+				Confidence:    roundTo(confidence, 1),
+				Lift:          roundTo(lift, 1),
+				MedianLag:     int(lags[len(lags)/2].Seconds()),
+			}
+			correlation.Summary = fmt.Sprintf("%s follow %s within %d minutes (%d of %d spikes)",
+				correlation.Follower.label(), correlation.Leader.label(), int(window.Minutes()), support, len(follower))
+			result.Correlations = append(result.Correlations, correlation)
+		}
+	}
+	sort.Slice(result.Correlations, func(i, j int) bool {
+		a, b := result.Correlations[i], result.Correlations[j]
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if a.CoOccurrences != b.CoOccurrences {
+			return a.CoOccurrences > b.CoOccurrences
+		}
+		return a.Summary < b.Summary
+	})
+	return result, nil
+}
+
+// refreshCorrelations computes the correlations and keeps the result
+func refreshCorrelations(now time.Time) (*correlationResult, error) {
+	result, err := computeCorrelations(now.UTC().Truncate(time.Second), correlationWindow, correlationLookback)
+	if err != nil {
+		return nil, err
+	}
+	correlations.Lock()
+	correlations.result = result
+	correlations.Unlock()
+	return result, nil
+}
+
+// startCorrelationJob computes the correlations in the background
+func startCorrelationJob() {
+	go func() {
+		for now := time.Now(); ; now = <-time.After(correlationInterval) {
+			if _, err := refreshCorrelations(now); err != nil {
+				log.Printf("⚠️  Correlation error: %v", err)
+			}
+		}
+	}()
+}
+
+// handleCorrelations answers GET /api/correlations?source=&limit=
+func handleCorrelations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	// Computed here when the job hasn't run yet (or doesn't run, as on read-only instances)
+	correlations.Lock()
+	result := correlations.result
+	correlations.Unlock()
+	if result == nil || time.Since(result.ComputedAt) > correlationInterval {
+		var err error
+		if result, err = refreshCorrelations(time.Now()); err != nil {
+			http.Error(w, "Failed to compute correlations", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filtered := *result
+	filtered.Correlations = []Correlation{}
+	source := r.URL.Query().Get("source")
+	for _, correlation := range result.Correlations {
+		if source != "" && correlation.Leader.Source != source && correlation.Follower.Source != source {
+			continue
+		}
+		if len(filtered.Correlations) < limit {
+			filtered.Correlations = append(filtered.Correlations, correlation)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filtered)
+}
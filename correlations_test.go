@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCorrelations tests finding spikes that follow each other
+func TestCorrelations(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	correlations.result = nil
+
+	insert := func(source, severity string, at time.Time, count int) {
+		for i := 0; i < count; i++ {
+			db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+				VALUES (?, 'Something happened', 'red', '{}', ?, ?, ?)`, severity, dbTime(at), severity, source)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Minute)
+	// Payment errors follow cache warnings a minute later, three times out of three
+	for _, hoursAgo := range []int{2, 7, 13} {
+		burst := now.Add(-time.Duration(hoursAgo) * time.Hour)
+		insert("redis-cache", "warning", burst, 5)
+		insert("payment-service", "error", burst.Add(time.Minute), 4)
+	}
+	// Search errors spike on their own
+	insert("search", "error", now.Add(-4*time.Hour), 6)
+	insert("search", "error", now.Add(-9*time.Hour), 6)
+
+	w := httptest.NewRecorder()
+	handleCorrelations(w, httptest.NewRequest("GET", "/api/correlations", nil))
+	var result correlationResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if result.Signals != 3 || len(result.Correlations) != 1 {
+		t.Fatalf("Expected 3 spiking signals and one correlation, got %+v", result)
+	}
+	c := result.Correlations[0]
+	if c.Leader.Source != "redis-cache" || c.Leader.Severity != "warning" || c.Follower.Source != "payment-service" ||
+		c.CoOccurrences != 3 || c.Confidence != 100 || c.MedianLag != 60 {
+		t.Errorf("Expected payment-service errors to follow redis-cache warnings, got %+v", c)
+	}
+	if c.Summary != "payment-service errors follow redis-cache warnings within 5 minutes (3 of 3 spikes)" {
+		t.Errorf("Unexpected summary: %s", c.Summary)
+	}
+
+	w = httptest.NewRecorder()
+	handleCorrelations(w, httptest.NewRequest("GET", "/api/correlations?source=search", nil))
+	result = correlationResult{}
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Correlations) != 0 {
+		t.Errorf("Expected no correlations for search, got %+v", result.Correlations)
+	}
+}
@@ -0,0 +1,148 @@
+// CubicLog Cron Expressions - Standard 5-field schedules
+//
+//	┌ minute (0-59)
+//	│ ┌ hour (0-23)
+//	│ │ ┌ day of month (1-31)
+//	│ │ │ ┌ month (1-12)
+//	│ │ │ │ ┌ day of week (0-6, Sunday = 0 or 7)
+//	0 2 * * 0      every Sunday at 02:00
+//
+// Fields accept *, numbers, ranges (1-5), lists (1,15) and steps (*/15,
+// 9-17/2). As in classic cron, when both day of month and day of week are
+// restricted a day matching either one counts.
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64 // bit n set = value n allowed
+	anyDay, anyWeekday                     bool
+}
+
+// cronFields are the bounds of the five fields
+var cronFields = []struct {
+	name     string
+	min, max int
+}{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+// parseCron parses a 5-field cron expression
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		parsed, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %v", cronFields[i].name, field, err)
+		}
+		bits[i] = parsed
+	}
+	if bits[4]&(1<<7) != 0 { // 7 is Sunday too
+		bits[4] |= 1
+	}
+	return &cronSchedule{minutes: bits[0], hours: bits[1], days: bits[2], months: bits[3], weekdays: bits[4],
+		anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}, nil
+}
+
+// parseCronField turns one field into a bit set
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			if err != nil || parsed < 1 {
+				return 0, fmt.Errorf("bad step '%s'", stepPart)
+			}
+			step = parsed
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("bad value '%s'", from)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("bad value '%s'", to)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("out of range %d-%d", min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether the schedule fires in the minute of t
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minutes&(1<<uint(t.Minute())) == 0 || s.hours&(1<<uint(t.Hour())) == 0 || s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	return s.dayMatches(t)
+}
+
+// dayMatches applies the day of month / day of week rule
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// next returns the first time after t the schedule fires (zero if none within 5 years)
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// lastWithin returns the latest time in (t-span, t] the schedule fired (zero if none)
+func (s *cronSchedule) lastWithin(t time.Time, span time.Duration) time.Time {
+	t = t.Truncate(time.Minute)
+	for start := t; t.Sub(start) < span; start = start.Add(-time.Minute) {
+		if s.matches(start) {
+			return start
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,269 @@
+// CubicLog CSV Columns - Choose what a CSV export contains
+//
+//	/api/export/csv?columns=timestamp:Time,derived_severity:Severity,title,body.user.id:User&delimiter=semicolon
+//
+// Options:
+//   - columns    comma-separated list of id, type, title, description, source,
+//     color, body, timestamp, derived_severity, derived_source,
+//     derived_category, environment, derived_language, release,
+//     derived_duration_ms and derived_http_status, plus body fields as JSON
+//     paths (body.user.id, body.items[0].sku). Append :Label to name the
+//     column in the header row.
+//   - delimiter  tab, semicolon, pipe or any single URL-encoded character
+//     (default ",")
+//   - header     false to leave out the header row
+//
+// Without options the export is unchanged: the eight base columns with their
+// usual headers. Body fields that are objects or arrays are written as JSON,
+// missing ones as empty cells.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// csvFields are the columns a CSV export can select, in the order it selects them
+var csvFields = strings.Split(strings.ReplaceAll(partitionColumns, " ", ""), ",")
+
+// csvColumn is one column of a CSV export
+type csvColumn struct {
+	Field string        // one of csvFields, or "" for a body path
+	Path  []interface{} // body JSON path: string keys and int indexes
+	Label string        // header row text
+}
+
+// defaultCSVColumns is the classic export layout
+var defaultCSVColumns = []csvColumn{
+	{Field: "id", Label: "ID"}, {Field: "type", Label: "Type"}, {Field: "title", Label: "Title"},
+	{Field: "description", Label: "Description"}, {Field: "source", Label: "Source"},
+	{Field: "color", Label: "Color"}, {Field: "body", Label: "Body"}, {Field: "timestamp", Label: "Timestamp"},
+}
+
+// csvOptions holds the parsed export options
+type csvOptions struct {
+	Columns   []csvColumn
+	Delimiter rune
+	Header    bool
+}
+
+// parseCSVOptions reads columns, delimiter and header from the query string
+func parseCSVOptions(r *http.Request) (csvOptions, error) {
+	params := r.URL.Query()
+	options := csvOptions{Columns: defaultCSVColumns, Delimiter: ',', Header: true}
+
+	if spec := params.Get("columns"); spec != "" {
+		columns, err := parseCSVColumns(spec)
+		if err != nil {
+			return options, err
+		}
+		options.Columns = columns
+	}
+
+	switch delimiter := params.Get("delimiter"); delimiter {
+	case "":
+	case "tab", `\t`:
+		options.Delimiter = '\t'
+	case "semicolon":
+		options.Delimiter = ';'
+	case "pipe":
+		options.Delimiter = '|'
+	default:
+		value, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || value == '"' || value == '\r' || value == '\n' || value == utf8.RuneError {
+			return options, fmt.Errorf("invalid delimiter '%s' - use tab, semicolon, pipe or a single character", delimiter)
+		}
+		options.Delimiter = value
+	}
+
+	if header := params.Get("header"); header != "" {
+		include, err := strconv.ParseBool(header)
+		if err != nil {
+			return options, fmt.Errorf("invalid header '%s' - use true or false", header)
+		}
+		options.Header = include
+	}
+	return options, nil
+}
+
+// parseCSVColumns parses a columns= list
+func parseCSVColumns(spec string) ([]csvColumn, error) {
+	var columns []csvColumn
+	for _, item := range strings.Split(spec, ",") {
+		name, label, _ := strings.Cut(strings.TrimSpace(item), ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		column := csvColumn{Label: strings.TrimSpace(label)}
+		if column.Label == "" {
+			column.Label = name
+		}
+
+		if path, ok := strings.CutPrefix(name, "body."); ok {
+			parsed, err := parseJSONPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid column '%s': %v", name, err)
+			}
+			column.Path = parsed
+		} else if containsString(csvFields, name) {
+			column.Field = name
+		} else {
+			return nil, fmt.Errorf("unknown column '%s' - use %s or body.<path>", name, strings.Join(csvFields, ", "))
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+	return columns, nil
+}
+
+// parseJSONPath splits "items[0].sku" into ["items", 0, "sku"]
+func parseJSONPath(path string) ([]interface{}, error) {
+	var parsed []interface{}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			return nil, fmt.Errorf("empty path segment")
+		}
+		key, rest, indexed := strings.Cut(segment, "[")
+		if key != "" {
+			parsed = append(parsed, key)
+		}
+		for indexed {
+			index, after, closed := strings.Cut(rest, "]")
+			position, err := strconv.Atoi(index)
+			if !closed || err != nil || position < 0 {
+				return nil, fmt.Errorf("bad index in '%s'", segment)
+			}
+			parsed = append(parsed, position)
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("unexpected '%s' in '%s'", after, segment)
+			}
+			rest = after[1:]
+		}
+	}
+	return parsed, nil
+}
+
+// lookupJSONPath follows a parsed path through decoded JSON
+func lookupJSONPath(value interface{}, path []interface{}) (interface{}, bool) {
+	for _, step := range path {
+		switch key := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = object[key]; !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := value.([]interface{})
+			if !ok || key >= len(list) {
+				return nil, false
+			}
+			value = list[key]
+		}
+	}
+	return value, true
+}
+
+// csvCell formats a body value for a spreadsheet cell
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// exportRow is one log as selected by a CSV export
+type exportRow struct {
+	ID                                int
+	Type, Title                       string
+	Description, Source, Color, Body  sql.NullString
+	Timestamp                         time.Time
+	Severity, DerivedSource, Category sql.NullString
+	Environment, Language, Release    sql.NullString
+	DurationMs, HTTPStatus            sql.NullInt64
+}
+
+// scan reads a row of the csvFields columns
+func (row *exportRow) scan(rows *sql.Rows) error {
+	return rows.Scan(&row.ID, &row.Type, &row.Title, &row.Description, &row.Source, &row.Color, &row.Body,
+		(*scanTime)(&row.Timestamp), &row.Severity, &row.DerivedSource, &row.Category, &row.Environment, &row.Language, &row.Release, &row.DurationMs, &row.HTTPStatus)
+}
+
+// csvRecord builds the export line for the selected columns
+func (row exportRow) csvRecord(columns []csvColumn) []string {
+	var body interface{}
+	bodyDecoded := false
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		switch column.Field {
+		case "id":
+			record[i] = strconv.Itoa(row.ID)
+		case "type":
+			record[i] = row.Type
+		case "title":
+			record[i] = row.Title
+		case "description":
+			record[i] = openField(row.Description.String)
+		case "source":
+			record[i] = row.Source.String
+		case "color":
+			record[i] = row.Color.String
+		case "body":
+			record[i] = openField(row.Body.String)
+		case "timestamp":
+			record[i] = row.Timestamp.Format(time.RFC3339)
+		case "derived_severity":
+			record[i] = row.Severity.String
+		case "derived_source":
+			record[i] = row.DerivedSource.String
+		case "derived_category":
+			record[i] = row.Category.String
+		case "environment":
+			record[i] = row.Environment.String
+		case "derived_language":
+			record[i] = row.Language.String
+		case "release":
+			record[i] = row.Release.String
+		case "derived_duration_ms":
+			if row.DurationMs.Valid {
+				record[i] = strconv.FormatInt(row.DurationMs.Int64, 10)
+			}
+		case "derived_http_status":
+			if row.HTTPStatus.Valid {
+				record[i] = strconv.FormatInt(row.HTTPStatus.Int64, 10)
+			}
+		default:
+			if !bodyDecoded {
+				json.Unmarshal([]byte(openField(row.Body.String)), &body)
+				bodyDecoded = true
+			}
+			if value, ok := lookupJSONPath(body, column.Path); ok {
+				record[i] = csvCell(value)
+			}
+		}
+	}
+	return record
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCSVExportColumns tests column selection, body paths, delimiter and header options
+func TestCSVExportColumns(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	body := `{"header":{"type":"error","title":"Checkout failed","source":"shop"},"body":{"user":{"id":42},"items":[{"sku":"A-1"}],"status":500}}`
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+
+	export := func(query string) (int, string) {
+		w := httptest.NewRecorder()
+		handleExportCSV(w, httptest.NewRequest("GET", "/api/export/csv"+query, nil))
+		return w.Code, w.Body.String()
+	}
+
+	// Default layout is unchanged
+	if _, output := export(""); !strings.HasPrefix(output, "ID,Type,Title,Description,Source,Color,Body,Timestamp\n") {
+		t.Errorf("Expected the classic header, got %q", output)
+	}
+
+	_, output := export("?columns=title:Title,derived_severity,body.user.id:User,body.items[0].sku,body.missing&delimiter=semicolon")
+	expected := "Title;derived_severity;User;body.items[0].sku;body.missing\nCheckout failed;error;42;A-1;\n"
+	if output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+
+	if _, output := export("?columns=body.items&delimiter=tab&header=false"); output != "\"[{\"\"sku\"\":\"\"A-1\"\"}]\"\n" {
+		t.Errorf("Expected the items array as JSON without header, got %q", output)
+	}
+
+	for _, query := range []string{"?columns=password", "?columns=body.items[x]", "?delimiter=ab", "?header=maybe"} {
+		if code, _ := export(query); code != 400 {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// CubicLog Diagnostics - pprof, expvar and runtime snapshots on a private port
+//
+//	cubiclog -debug-addr localhost:6060
+//
+// Opt-in; nothing is served unless -debug-addr is set. The debug server runs
+// next to the main one and offers:
+//   - /debug/pprof/   CPU, heap, goroutine, block and mutex profiles
+//     (go tool pprof http://localhost:6060/debug/pprof/profile?seconds=30)
+//   - /debug/vars     expvar counters: logs received/stored/spooled/throttled,
+//     quota decisions, goroutines, spool backlog, plus Go's memstats
+//   - /debug/snapshot a JSON summary of goroutines, heap and GC
+//
+// A bare port (":6060" or "6060") binds to 127.0.0.1 only. The pprof and
+// expvar packages register themselves on http.DefaultServeMux, which the main
+// server uses, so the main server filters /debug/ out again.
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Ingestion counters published on /debug/vars
+var (
+	logsReceived     = expvar.NewInt("logs_received")
+	logsStored       = expvar.NewInt("logs_stored")
+	logsSpooled      = expvar.NewInt("logs_spooled")
+	logsQuotaLimited = expvar.NewInt("logs_quota_limited") // rejected or counted only
+	logsThrottled    = expvar.NewInt("logs_throttled")     // counted towards a representative (see throttle.go)
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+	expvar.Publish("uptime_seconds", expvar.Func(func() interface{} { return int64(time.Since(startedAt).Seconds()) }))
+	expvar.Publish("spool_pending", expvar.Func(func() interface{} {
+		_, _, pending := breaker.status()
+		return pending
+	}))
+}
+
+// debugListenAddress keeps bare ports on the loopback interface
+func debugListenAddress(addr string) string {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// debugMux returns the handlers served on -debug-addr
+func debugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/snapshot", handleDebugSnapshot)
+	return mux
+}
+
+// handleDebugSnapshot returns a goroutine and heap summary
+func handleDebugSnapshot(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastPause time.Duration
+	if mem.NumGC > 0 {
+		lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"time":       time.Now().UTC().Format(time.RFC3339),
+		"goroutines": runtime.NumGoroutine(),
+		"heap": map[string]interface{}{
+			"alloc_bytes":    mem.HeapAlloc,
+			"inuse_bytes":    mem.HeapInuse,
+			"idle_bytes":     mem.HeapIdle,
+			"released_bytes": mem.HeapReleased,
+			"objects":        mem.HeapObjects,
+			"sys_bytes":      mem.Sys,
+		},
+		"gc": map[string]interface{}{
+			"cycles":          mem.NumGC,
+			"last_pause_ms":   float64(lastPause) / float64(time.Millisecond),
+			"total_pause_ms":  float64(mem.PauseTotalNs) / float64(time.Millisecond),
+			"cpu_fraction":    mem.GCCPUFraction,
+			"next_gc_bytes":   mem.NextGC,
+			"last_gc_seconds": time.Since(time.Unix(0, int64(mem.LastGC))).Seconds(),
+		},
+	})
+}
+
+// startDebugServer serves the diagnostics endpoints in the background
+func startDebugServer(addr string) (string, error) {
+	listener, err := net.Listen("tcp", debugListenAddress(addr))
+	if err != nil {
+		return "", err
+	}
+	if host, _, _ := net.SplitHostPort(listener.Addr().String()); !net.ParseIP(host).IsLoopback() {
+		log.Printf("⚠️  Debug endpoints are reachable from the network on %s", listener.Addr())
+	}
+	go func() {
+		server := &http.Server{Handler: debugMux(), ReadHeaderTimeout: 10 * time.Second}
+		if err := server.Serve(listener); err != nil {
+			log.Printf("⚠️  Debug server stopped: %v", err)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+// withoutDebugRoutes hides the /debug/ handlers that pprof and expvar register
+// on http.DefaultServeMux from the public server
+func withoutDebugRoutes(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/") {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDebugEndpoints tests the diagnostics server and that /debug/ stays off the public server
+func TestDebugEndpoints(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if addr := debugListenAddress(":6060"); addr != "127.0.0.1:6060" {
+		t.Errorf("Expected bare port on loopback, got %s", addr)
+	}
+	if addr := debugListenAddress("6060"); addr != "127.0.0.1:6060" {
+		t.Errorf("Expected bare port on loopback, got %s", addr)
+	}
+
+	// Counters move when logs arrive
+	before := logsStored.Value()
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"title":"counted"}}`)))
+	if logsStored.Value() != before+1 {
+		t.Errorf("Expected logs_stored to increase by 1, got %d -> %d", before, logsStored.Value())
+	}
+
+	mux := debugMux()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("Invalid /debug/vars response: %v", err)
+	}
+	for _, name := range []string{"logs_received", "logs_stored", "goroutines", "spool_pending", "memstats"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("Expected %s in /debug/vars", name)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/snapshot", nil))
+	var snapshot map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &snapshot)
+	if snapshot["goroutines"] == nil || snapshot["heap"] == nil {
+		t.Errorf("Expected goroutines and heap in snapshot, got %v", snapshot)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("Expected goroutine profile, got %d", w.Code)
+	}
+
+	// The public server must not expose what pprof/expvar put on the default mux
+	public := withoutDebugRoutes(http.DefaultServeMux)
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		w = httptest.NewRecorder()
+		public.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s on the public server, got %d", path, w.Code)
+		}
+	}
+}
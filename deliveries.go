@@ -0,0 +1,252 @@
+// CubicLog Deliveries - Why a notification never arrived
+//
+// Every outbound notification is recorded with its outcome:
+//   - alert: an alert POSTed to -alert-webhook (see alerts.go), with the body
+//     as sent, so a retry sends exactly the same
+//   - issue: opening or commenting the tracker issue of an error group (see
+//     issues.go); a retry does it again with the group's current counts and
+//     links the issue to the group
+//
+// Endpoints:
+//   - GET  /api/deliveries              newest first (?kind=alert&status=failed&limit=100)
+//   - POST /api/deliveries/{id}/retry   attempt a delivery again
+//
+// A delivery is "delivered" or "failed" after its last attempt and keeps the
+// number of attempts, the receiver's HTTP status code and the error. Failed
+// deliveries aren't retried on their own. Deliveries are removed by retention.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivery is one outbound notification and the outcome of its last attempt
+type Delivery struct {
+	ID            int64     `json:"id"`
+	Kind          string    `json:"kind"`      // alert or issue
+	Reference     int64     `json:"reference"` // alert id or error group id
+	Target        string    `json:"target"`
+	Status        string    `json:"status"` // delivered or failed
+	Attempts      int       `json:"attempts"`
+	ResponseCode  int       `json:"response_code,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+
+	contentType string
+	payload     string
+}
+
+// deliveryStatusError is a receiver answering with a non-2xx status
+type deliveryStatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *deliveryStatusError) Error() string {
+	return e.Message
+}
+
+// createDeliveriesTable creates the delivery log
+func createDeliveriesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS deliveries (
+		id              ` + alertIDColumn() + `,
+		kind            TEXT NOT NULL,
+		reference       BIGINT NOT NULL DEFAULT 0,
+		target          TEXT NOT NULL,
+		content_type    TEXT NOT NULL DEFAULT '',
+		payload         TEXT NOT NULL DEFAULT '',
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		response_code   INTEGER NOT NULL DEFAULT 0,
+		error           TEXT NOT NULL DEFAULT '',
+		created_at      TIMESTAMP NOT NULL,
+		last_attempt_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_deliveries_created_at ON deliveries(created_at);
+	`)
+	return err
+}
+
+// recordDelivery stores the outcome of an attempt (code 0 when no answer is known)
+func recordDelivery(d *Delivery, code int, err error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	d.Attempts++
+	d.LastAttemptAt, d.ResponseCode, d.Status, d.Error = now, code, "delivered", ""
+	if err != nil {
+		var status *deliveryStatusError
+		if errors.As(err, &status) {
+			d.ResponseCode = status.Code
+		}
+		d.Status, d.Error = "failed", err.Error()
+	}
+
+	if d.ID == 0 {
+		d.CreatedAt = now
+		id, err := db.InsertID(`INSERT INTO deliveries (kind, reference, target, content_type, payload, status, attempts, response_code, error, created_at, last_attempt_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.Kind, d.Reference, d.Target, d.contentType, d.payload, d.Status, d.Attempts, d.ResponseCode, d.Error, dbTime(now), dbTime(now))
+		if err != nil {
+			log.Printf("⚠️  Could not record %s delivery: %v", d.Kind, err)
+		}
+		d.ID = id
+		return
+	}
+	if _, err := db.Exec(db.Rebind("UPDATE deliveries SET status = ?, attempts = ?, response_code = ?, error = ?, last_attempt_at = ? WHERE id = ?"),
+		d.Status, d.Attempts, d.ResponseCode, d.Error, dbTime(now), d.ID); err != nil {
+		log.Printf("⚠️  Could not record %s delivery %d: %v", d.Kind, d.ID, err)
+	}
+}
+
+// postDelivery POSTs a webhook delivery's payload and returns the receiver's status code
+func postDelivery(d *Delivery) (int, error) {
+	resp, err := alertWebhookClient.Post(d.Target, d.contentType, strings.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message := fmt.Sprintf("answered %d", resp.StatusCode)
+		if detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512)); len(bytes.TrimSpace(detail)) > 0 {
+			message += ": " + string(bytes.TrimSpace(detail))
+		}
+		return resp.StatusCode, &deliveryStatusError{Code: resp.StatusCode, Message: message}
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelivery attempts a delivery again and records the outcome
+func retryDelivery(d *Delivery) {
+	switch d.Kind {
+	case "alert":
+		code, err := postDelivery(d)
+		recordDelivery(d, code, err)
+	case "issue":
+		if issueTracker == nil {
+			recordDelivery(d, 0, fmt.Errorf("no issue tracker configured (-issue-tracker-file)"))
+			return
+		}
+		issueMu.Lock()
+		defer issueMu.Unlock()
+		group, err := loadErrorGroup(d.Reference)
+		if err != nil {
+			recordDelivery(d, 0, fmt.Errorf("error group %d: %v", d.Reference, err))
+			return
+		}
+		if _, err := syncGroupIssue(&group, d); err == nil {
+			if err := linkGroupIssue(group); err != nil {
+				log.Printf("⚠️  Could not link issue of error group %d: %v", group.ID, err)
+			}
+		}
+	}
+}
+
+// deliveryColumns are the columns scanDelivery reads
+const deliveryColumns = "id, kind, reference, target, content_type, payload, status, attempts, response_code, error, created_at, last_attempt_at"
+
+// scanDelivery reads one delivery row
+func scanDelivery(scan func(...interface{}) error) (Delivery, error) {
+	var d Delivery
+	err := scan(&d.ID, &d.Kind, &d.Reference, &d.Target, &d.contentType, &d.payload, &d.Status, &d.Attempts,
+		&d.ResponseCode, &d.Error, (*scanTime)(&d.CreatedAt), (*scanTime)(&d.LastAttemptAt))
+	return d, err
+}
+
+// loadDeliveries returns the latest deliveries, optionally of one kind and status
+func loadDeliveries(kind, status string, limit int) ([]Delivery, error) {
+	query, args := "SELECT "+deliveryColumns+" FROM deliveries WHERE 1=1", []interface{}{}
+	if kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	rows, err := db.Query(db.Rebind(query+" ORDER BY created_at DESC, id DESC LIMIT ?"), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// pruneDeliveries removes deliveries created before the retention cutoff
+func pruneDeliveries(cutoff time.Time) {
+	db.Exec(db.Rebind("DELETE FROM deliveries WHERE created_at < ?"), dbTime(cutoff))
+}
+
+// handleDeliveries answers GET /api/deliveries?kind=&status=&limit=
+func handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	deliveries, err := loadDeliveries(query.Get("kind"), query.Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Failed to load deliveries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": deliveries})
+}
+
+// handleDelivery answers POST /api/deliveries/{id}/retry
+func handleDelivery(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/deliveries/")
+	if !strings.HasSuffix(rest, "/retry") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimSuffix(rest, "/retry"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	d, err := scanDelivery(db.QueryRow(db.Rebind("SELECT "+deliveryColumns+" FROM deliveries WHERE id = ?"), id).Scan)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load delivery", http.StatusInternalServerError)
+		return
+	}
+	retryDelivery(&d)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
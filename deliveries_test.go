@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDeliveryLog tests that failed alert deliveries are recorded and can be retried
+func TestDeliveryLog(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "receiver down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+	alertWebhookURL = receiver.URL
+	defer func() { alertWebhookURL = "" }()
+
+	alert := fireAlert(Alert{Rule: "disk-full", Kind: "test", Severity: "critical", Title: "Disk full", Message: "99% used"})
+	var deliveries []Delivery
+	for deadline := time.Now().Add(2 * time.Second); len(deliveries) == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		deliveries, _ = loadDeliveries("alert", "failed", 10)
+	}
+	if len(deliveries) != 1 || deliveries[0].Reference != alert.ID || deliveries[0].ResponseCode != 503 || deliveries[0].Error != "answered 503: receiver down" {
+		t.Fatalf("Expected one failed delivery answered 503, got %+v", deliveries)
+	}
+
+	w := httptest.NewRecorder()
+	handleDelivery(w, httptest.NewRequest("POST", "/api/deliveries/"+strconv.FormatInt(deliveries[0].ID, 10)+"/retry", nil))
+	var retried Delivery
+	json.NewDecoder(w.Body).Decode(&retried)
+	if w.Code != 200 || retried.Status != "delivered" || retried.Attempts != 2 || retried.ResponseCode != 200 {
+		t.Errorf("Expected the retry to be delivered on the second attempt, got %d %+v", w.Code, retried)
+	}
+
+	w = httptest.NewRecorder()
+	handleDeliveries(w, httptest.NewRequest("GET", "/api/deliveries?status=failed", nil))
+	var listed struct {
+		Deliveries []Delivery `json:"deliveries"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Deliveries) != 0 {
+		t.Errorf("Expected no failed deliveries left, got %+v", listed.Deliveries)
+	}
+}
@@ -0,0 +1,322 @@
+// CubicLog Docker - Container logs from a plain Docker host, no Kubernetes needed
+//
+//	cubiclog -docker
+//	cubiclog -docker -docker-socket /run/user/1000/docker.sock
+//
+// With -docker, CubicLog talks to the local Docker daemon over its socket
+// (default /var/run/docker.sock, or the unix:// address in DOCKER_HOST) and
+// follows the stdout and stderr of every running container, and of every
+// container started later. Each line becomes a log stored like a POST
+// /api/logs, converted like a shipped event (see shippers.go): JSON lines add
+// their fields to the body, other lines become the title, and the smart
+// defaults derive the severity.
+//
+// The source is the container name. The body carries container, container_id,
+// image and stream (stdout or stderr), and for Compose containers
+// compose_project and compose_service. Lines written before CubicLog started
+// following a container are not collected. Containers labelled
+// cubiclog.ignore=true are skipped - label CubicLog's own container like that
+// when it runs in Docker, or its output may be collected too.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDockerSocket is where the Docker daemon listens unless DOCKER_HOST says otherwise
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// dockerRetryInterval is how long to wait before reconnecting to the daemon
+const dockerRetryInterval = 5 * time.Second
+
+// dockerIgnoreLabel marks containers whose output isn't collected
+const dockerIgnoreLabel = "cubiclog.ignore"
+
+// dockerClient talks to the -docker-socket (nil without -docker) - configured once in main()
+var dockerClient *http.Client
+
+// dockerFollowed are the containers whose logs are being followed
+var dockerFollowed = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: map[string]bool{}}
+
+// dockerContainer is what CubicLog needs to know about a container
+type dockerContainer struct {
+	ID     string
+	Name   string
+	Image  string
+	TTY    bool
+	Labels map[string]string
+}
+
+// defaultDockerSocketPath returns the socket in DOCKER_HOST, or the default one
+func defaultDockerSocketPath() string {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	return defaultDockerSocket
+}
+
+// configureDocker sets up the client for the Docker daemon and checks it answers
+func configureDocker(enabled bool, socket string) error {
+	dockerClient = nil
+	if !enabled {
+		return nil
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return fmt.Errorf("docker socket: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/_ping", nil)
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("docker daemon not reachable on %s: %v", socket, err)
+	}
+	resp.Body.Close()
+	dockerClient = client
+	return nil
+}
+
+// dockerGet sends a GET to the daemon API; the caller closes the body
+func dockerGet(path string) (*http.Response, error) {
+	resp, err := dockerClient.Get("http://docker" + path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("docker answered %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
+
+// inspectContainer looks up a container's name, image, labels and whether it has a TTY
+func inspectContainer(id string) (dockerContainer, error) {
+	resp, err := dockerGet("/containers/" + url.PathEscape(id) + "/json")
+	if err != nil {
+		return dockerContainer{}, err
+	}
+	defer resp.Body.Close()
+	var inspected struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image  string            `json:"Image"`
+			Tty    bool              `json:"Tty"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inspected); err != nil {
+		return dockerContainer{}, err
+	}
+	return dockerContainer{ID: inspected.ID, Name: strings.TrimPrefix(inspected.Name, "/"), Image: inspected.Config.Image,
+		TTY: inspected.Config.Tty, Labels: inspected.Config.Labels}, nil
+}
+
+// runningContainers lists the IDs of the running containers
+func runningContainers() ([]string, error) {
+	resp, err := dockerGet("/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(containers))
+	for i, c := range containers {
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+// readDockerLogs splits a log stream into lines - multiplexed stdout/stderr
+// frames, or the raw output of a container with a TTY
+func readDockerLogs(r io.Reader, tty bool, emit func(stream, line string)) error {
+	if tty {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			emit("stdout", strings.TrimRight(scanner.Text(), "\r"))
+		}
+		return scanner.Err()
+	}
+
+	pending := map[string]*bytes.Buffer{"stdout": {}, "stderr": {}}
+	flush := func(stream string, all bool) {
+		buffer := pending[stream]
+		for {
+			line, err := buffer.ReadString('\n')
+			if err != nil {
+				// An incomplete line waits for the next frame, unless the stream ended
+				if all && line != "" {
+					emit(stream, line)
+				} else if line != "" {
+					buffer.WriteString(line)
+				}
+				return
+			}
+			emit(stream, strings.TrimRight(line, "\r\n"))
+		}
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			flush("stdout", true)
+			flush("stderr", true)
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		stream := "stdout"
+		if header[0] == 2 {
+			stream = "stderr"
+		}
+		if _, err := io.CopyN(pending[stream], r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+		flush(stream, false)
+	}
+}
+
+// dockerLogEntry converts a line of container output into a log
+func dockerLogEntry(container dockerContainer, stream, line string) Log {
+	entry := shippedEventLog(map[string]interface{}{"message": line})
+	if entry.Body == nil {
+		entry.Body = map[string]interface{}{}
+	}
+	entry.Body["container"] = container.Name
+	entry.Body["container_id"] = container.ID[:min(12, len(container.ID))]
+	entry.Body["image"] = container.Image
+	entry.Body["stream"] = stream
+	if project := container.Labels["com.docker.compose.project"]; project != "" {
+		entry.Body["compose_project"] = project
+	}
+	if service := container.Labels["com.docker.compose.service"]; service != "" {
+		entry.Body["compose_service"] = service
+	}
+	if entry.Header.Source == "" {
+		entry.Header.Source = container.Name
+	}
+	return entry
+}
+
+// followContainer stores a container's output from since on, until the container stops
+func followContainer(id string, since time.Time) {
+	dockerFollowed.Lock()
+	if dockerFollowed.ids[id] {
+		dockerFollowed.Unlock()
+		return
+	}
+	dockerFollowed.ids[id] = true
+	dockerFollowed.Unlock()
+	defer func() {
+		dockerFollowed.Lock()
+		delete(dockerFollowed.ids, id)
+		dockerFollowed.Unlock()
+	}()
+
+	container, err := inspectContainer(id)
+	if err != nil {
+		log.Printf("⚠️  Docker container %s: %v", id, err)
+		return
+	}
+	if container.Labels[dockerIgnoreLabel] == "true" {
+		return
+	}
+	resp, err := dockerGet("/containers/" + url.PathEscape(id) + "/logs?follow=1&stdout=1&stderr=1&since=" + strconv.FormatInt(since.Unix(), 10))
+	if err != nil {
+		log.Printf("⚠️  Docker container %s: %v", container.Name, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	err = readDockerLogs(resp.Body, container.TTY, func(stream, line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		if status, _, message := ingestCollected(dockerLogEntry(container, stream, line), ""); status >= 300 {
+			log.Printf("⚠️  Line from container %s not stored: %s", container.Name, message)
+		}
+	})
+	if err != nil {
+		log.Printf("⚠️  Docker container %s: %v", container.Name, err)
+	}
+}
+
+// watchDocker follows the running containers and those started while the event stream is open
+func watchDocker() error {
+	resp, err := dockerGet("/events?filters=" + url.QueryEscape(`{"type":["container"],"event":["start"]}`))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	ids, err := runningContainers()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		go followContainer(id, now)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Action string `json:"Action"`
+			Actor  struct {
+				ID string `json:"ID"`
+			} `json:"Actor"`
+			Time int64 `json:"time"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			return err
+		}
+		if event.Action == "start" && event.Actor.ID != "" {
+			go followContainer(event.Actor.ID, time.Unix(event.Time, 0))
+		}
+	}
+}
+
+// startDockerCollector follows container output in the background (reconnecting to the daemon)
+func startDockerCollector() {
+	if dockerClient == nil {
+		return
+	}
+	go func() {
+		log.Printf("🐳 Collecting Docker container logs")
+		for {
+			err := watchDocker()
+			log.Printf("⚠️  Docker events: %v - reconnecting in %v", err, dockerRetryInterval)
+			time.Sleep(dockerRetryInterval)
+		}
+	}()
+}
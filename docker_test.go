@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDockerCollector tests following a container's output through a fake Docker daemon
+func TestDockerCollector(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Unix socket paths are short, so no t.TempDir()
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("No unix sockets here: %v", err)
+	}
+	frame := func(stream byte, data string) []byte {
+		header := make([]byte, 8)
+		header[0] = stream
+		binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+		return append(header, data...)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("OK")) })
+	mux.HandleFunc("/containers/3f2a9c1d7e4b5a6c/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id":"3f2a9c1d7e4b5a6c","Name":"/shop-api-1","Config":{"Image":"shop/api:1.4","Tty":false,
+			"Labels":{"com.docker.compose.project":"shop","com.docker.compose.service":"api"}}}`))
+	})
+	mux.HandleFunc("/containers/3f2a9c1d7e4b5a6c/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(1, "Listening on :8080\nGET /health 200"))
+		w.Write(frame(2, "panic: database connection refused\n"))
+		w.Write(frame(1, "\n"))
+	})
+	mux.HandleFunc("/containers/9b8a/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id":"9b8a","Name":"/cubiclog","Config":{"Image":"cubiclog","Labels":{"cubiclog.ignore":"true"}}}`))
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if err := configureDocker(true, socket); err != nil {
+		t.Fatalf("configureDocker failed: %v", err)
+	}
+	defer configureDocker(false, "")
+	followContainer("9b8a", time.Now())
+	followContainer("3f2a9c1d7e4b5a6c", time.Now())
+
+	rows, err := db.Query("SELECT title, source, derived_severity, body FROM logs ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var titles, severities []string
+	var body string
+	for rows.Next() {
+		var title, source, severity string
+		rows.Scan(&title, &source, &severity, &body)
+		if source != "shop-api-1" {
+			t.Errorf("Expected the container name as source, got %q", source)
+		}
+		titles, severities = append(titles, title), append(severities, severity)
+	}
+	if len(titles) != 3 || titles[0] != "Listening on :8080" || titles[1] != "panic: database connection refused" || titles[2] != "GET /health 200" {
+		t.Fatalf("Unexpected logs stored: %q", titles)
+	}
+	if severities[1] != "error" && severities[1] != "critical" {
+		t.Errorf("Expected the panic on stderr to be an error, got %s", severities[1])
+	}
+	for _, field := range []string{`"container_id":"3f2a9c1d7e4b"`, `"image":"shop/api:1.4"`, `"stream":"stdout"`, `"compose_service":"api"`} {
+		if !strings.Contains(body, field) {
+			t.Errorf("Expected %s in the body, got %s", field, body)
+		}
+	}
+}
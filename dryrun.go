@@ -0,0 +1,51 @@
+// CubicLog Dry Runs - Test an integration against production without writing
+//
+//	curl -X POST "http://localhost:8080/api/logs?dry_run=true" -d '{"header":{"title":"Payment failed"}}'
+//
+// A dry run goes through the same validation, smart defaults, derivation and
+// body size limit as a real log and answers 200 with the record that would
+// have been stored, but nothing is written: no row, no spool entry, no quota
+// or escalation counting, no error group and no alert. Start the server with
+// -validate-only to treat every ingestion request as a dry run, e.g. for a
+// staging instance that client teams test against. To see every decision on
+// the way, use the ingest simulator (see echoclassify.go).
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ingestValidateOnly is the -validate-only setting - configured once in main()
+var ingestValidateOnly bool
+
+// dryRunResult is the answer to a dry run
+type dryRunResult struct {
+	DryRun   bool        `json:"dry_run"`
+	Stored   bool        `json:"stored"`
+	Log      Log         `json:"log"`
+	Metadata LogMetadata `json:"metadata"`
+	Notes    []string    `json:"notes,omitempty"`
+}
+
+// isDryRun reports whether an ingestion request must not be stored
+func isDryRun(r *http.Request) bool {
+	if ingestValidateOnly || ingestTraced(r) {
+		return true
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	return dryRun
+}
+
+// writeDryRun answers a dry run with the would-be stored record
+func writeDryRun(w http.ResponseWriter, entry Log, metadata LogMetadata, notes []string) {
+	entry.Timestamp = time.Now()
+	if ingestValidateOnly {
+		notes = append(notes, "server runs with -validate-only, nothing is stored")
+	}
+	w.Header().Set("X-CubicLog-Dry-Run", "true")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dryRunResult{DryRun: true, Log: entry, Metadata: metadata, Notes: notes})
+}
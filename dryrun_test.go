@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDryRunIngestion tests that dry runs derive metadata without storing anything
+func TestDryRunIngestion(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	body := `{"header":{"title":"Payment failed for order 42"},"body":{"service":"billing","error":"card declined"}}`
+	w := httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs?dry_run=true", strings.NewReader(body)))
+	var result dryRunResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || !result.DryRun || result.Stored {
+		t.Fatalf("Expected a dry run result, got %d", w.Code)
+	}
+	if result.Metadata.DerivedSeverity != "error" || result.Metadata.DerivedSource != "billing" || result.Log.Header.Type == "" {
+		t.Errorf("Expected derived error from billing, got %+v / %+v", result.Metadata, result.Log.Header)
+	}
+
+	// Validation still applies
+	w = httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs?dry_run=true", strings.NewReader(`{"header":{"title":""}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a missing title, got %d", w.Code)
+	}
+
+	// Server-wide validate-only mode
+	ingestValidateOnly = true
+	w = httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	ingestValidateOnly = false
+	if w.Code != http.StatusOK || w.Header().Get("X-CubicLog-Dry-Run") != "true" {
+		t.Errorf("Expected -validate-only to answer with a dry run, got %d", w.Code)
+	}
+
+	var stored, groups int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&stored)
+	db.QueryRow("SELECT COUNT(*) FROM error_groups").Scan(&groups)
+	if stored != 0 || groups != 0 {
+		t.Errorf("Expected nothing stored, got %d logs and %d groups", stored, groups)
+	}
+}
@@ -0,0 +1,169 @@
+// CubicLog Ingest Simulator - Assert in CI how CubicLog will handle your logs
+//
+//	curl -X POST http://localhost:8080/api/testing/echo-classify \
+//	  -d '{"header":{"title":"Payment failed"},"body":{"service":"billing"}}'
+//
+// The log goes through the same pipeline as POST /api/logs - validation,
+// smart defaults, ingest token scoping, release and environment resolution,
+// classification, category taxonomy, severity overrides and the body size
+// limit - and the answer lists every decision on the way ("steps"), the log
+// and metadata it would be stored with, and where it would go next
+// ("routing"): escalation rules it counts towards and whether an alert would
+// fire or be silenced, the quota decision, throttling, its error group, and
+// whether its columns would be encrypted.
+//
+// Nothing is stored or counted: it runs as a dry run (see dryrun.go), and the
+// routing is read from the current counters without changing them. "outcome"
+// is stored, throttled, counted or rejected, and "status" is what POST
+// /api/logs would have answered; a rejected log comes with its "error". The
+// endpoint itself answers 200 for every log it could evaluate, so tests can
+// assert on rejections too.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ingestStep is one decision of the ingest pipeline
+type ingestStep struct {
+	Stage    string `json:"stage"`
+	Decision string `json:"decision"`
+	Value    string `json:"value,omitempty"`
+}
+
+// ingestTraceKey carries where createLog records its decisions (see traceIngest)
+type ingestTraceKey struct{}
+
+// traceIngest records a decision of createLog (no-op outside the simulator)
+func traceIngest(r *http.Request, stage, decision, value string) {
+	if steps, ok := r.Context().Value(ingestTraceKey{}).(*[]ingestStep); ok {
+		*steps = append(*steps, ingestStep{Stage: stage, Decision: decision, Value: value})
+	}
+}
+
+// ingestTraced reports whether a request runs through the simulator
+func ingestTraced(r *http.Request) bool {
+	return r.Context().Value(ingestTraceKey{}) != nil
+}
+
+// echoErrorGroup is the error group a log would be counted towards
+type echoErrorGroup struct {
+	Fingerprint string `json:"fingerprint"`
+	ID          int64  `json:"id,omitempty"`
+	New         bool   `json:"new"`
+}
+
+// echoRouting is where a log would go after the pipeline
+type echoRouting struct {
+	Escalations      []escalationPreview `json:"escalations"`
+	Quota            string              `json:"quota,omitempty"` // allow, count or reject; empty without -quota-file
+	Throttled        bool                `json:"throttled"`
+	RepresentativeID int64               `json:"representative_id,omitempty"`
+	ErrorGroup       *echoErrorGroup     `json:"error_group,omitempty"`
+	Encrypted        bool                `json:"encrypted"`
+}
+
+// echoResult is the answer of the simulator
+type echoResult struct {
+	Outcome  string       `json:"outcome"` // stored, throttled, counted or rejected
+	Status   int          `json:"status"`  // what POST /api/logs would answer
+	Error    string       `json:"error,omitempty"`
+	Log      *Log         `json:"log,omitempty"`
+	Metadata *LogMetadata `json:"metadata,omitempty"`
+	Steps    []ingestStep `json:"steps"`
+	Routing  *echoRouting `json:"routing,omitempty"`
+	Notes    []string     `json:"notes,omitempty"`
+}
+
+// handleEchoClassify answers POST /api/testing/echo-classify
+func handleEchoClassify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result := echoResult{Steps: []ingestStep{}}
+	recorder := &ingestRecorder{header: http.Header{}}
+	createLog(recorder, r.Clone(context.WithValue(r.Context(), ingestTraceKey{}, &result.Steps)))
+
+	if recorder.status >= 300 {
+		result.Outcome, result.Status, result.Error = "rejected", recorder.status, strings.TrimSpace(recorder.body.String())
+	} else {
+		var evaluated dryRunResult
+		if err := json.Unmarshal(recorder.body.Bytes(), &evaluated); err != nil {
+			http.Error(w, "Failed to evaluate log", http.StatusInternalServerError)
+			return
+		}
+		result.Log, result.Metadata, result.Notes = &evaluated.Log, &evaluated.Metadata, evaluated.Notes
+		result.Routing, result.Outcome, result.Status = routeEchoedLog(r, &evaluated.Log, &evaluated.Metadata, &result.Steps)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// routeEchoedLog evaluates what createLog does after a dry run stops, in the
+// same order, without counting the log anywhere
+func routeEchoedLog(r *http.Request, entry *Log, metadata *LogMetadata, steps *[]ingestStep) (*echoRouting, string, int) {
+	now := time.Now()
+	routing := &echoRouting{Escalations: []escalationPreview{}, Encrypted: fieldCipher != nil}
+	step := func(stage, decision, value string) {
+		*steps = append(*steps, ingestStep{Stage: stage, Decision: decision, Value: value})
+	}
+
+	// Escalation changes the severity, within the severity overrides
+	if tracker := escalations; tracker != nil {
+		routing.Escalations = tracker.preview(now, entry.Header, entry.Body, *metadata)
+		for _, preview := range routing.Escalations {
+			if !preview.Escalates {
+				continue
+			}
+			metadata.DerivedSeverity = preview.EscalateTo
+			step("escalation", preview.Rule, preview.EscalateTo)
+			if capped, rule := applySeverityOverride(*metadata); rule != nil {
+				*metadata = capped
+				step("severity override", rule.Name, capped.DerivedSeverity)
+			}
+		}
+	}
+
+	if quotas != nil {
+		bodyJSON, _ := json.Marshal(entry.Body)
+		size := int64(len(bodyJSON) + len(entry.Header.Title) + len(entry.Header.Description))
+		switch quotas.peekQuota(metadata.DerivedSource, requestAPIKey(r), size) {
+		case quotaReject:
+			routing.Quota = "reject"
+			step("quota", "over quota", "reject")
+			return routing, "rejected", http.StatusTooManyRequests
+		case quotaCountOnly:
+			routing.Quota = "count"
+			step("quota", "over quota", "count")
+			return routing, "counted", http.StatusAccepted
+		default:
+			routing.Quota = "allow"
+			step("quota", "within quota", "")
+		}
+	}
+
+	fingerprint := errorFingerprint(metadata.DerivedSource, entry.Header.Title)
+	if throttle != nil {
+		if representative, throttled := throttle.wouldThrottle(fingerprint, now); throttled {
+			routing.Throttled, routing.RepresentativeID = true, representative
+			step("throttle", "throttled", "")
+			return routing, "throttled", http.StatusAccepted
+		}
+	}
+
+	if containsString(groupedSeverities, metadata.DerivedSeverity) {
+		group := &echoErrorGroup{Fingerprint: fingerprint}
+		err := db.QueryRow(db.Rebind("SELECT id FROM error_groups WHERE fingerprint = ?"), fingerprint).Scan(&group.ID)
+		group.New = err == sql.ErrNoRows
+		routing.ErrorGroup = group
+	}
+	return routing, "stored", http.StatusCreated
+}
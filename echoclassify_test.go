@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEchoClassify tests that the simulator reports every decision without storing or counting anything
+func TestEchoClassify(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { escalations = nil }()
+
+	path := filepath.Join(t.TempDir(), "escalations.json")
+	os.WriteFile(path, []byte(`{"rules": [{"name": "declines", "match": {"text": "declined"}, "threshold": 1, "window": "1m", "escalate_to": "critical"}]}`), 0644)
+	if err := loadEscalationRules(path); err != nil {
+		t.Fatal(err)
+	}
+
+	echo := func(body string) (int, echoResult) {
+		w := httptest.NewRecorder()
+		handleEchoClassify(w, httptest.NewRequest("POST", "/api/testing/echo-classify", strings.NewReader(body)))
+		var result echoResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+	decision := func(result echoResult, stage string) string {
+		for _, step := range result.Steps {
+			if step.Stage == stage {
+				return step.Decision + ":" + step.Value
+			}
+		}
+		return ""
+	}
+
+	code, result := echo(`{"header":{"title":"Payment failed: card declined"},"body":{"service":"billing"}}`)
+	if code != http.StatusOK || result.Outcome != "stored" || result.Status != http.StatusCreated {
+		t.Fatalf("Expected a log that would be stored, got %d: %+v", code, result)
+	}
+	if decision(result, "validation") != "passed:" || decision(result, "type") != "derived:"+result.Log.Header.Type || decision(result, "source") != "derived:billing" {
+		t.Errorf("Expected validation, type and source decisions, got %+v", result.Steps)
+	}
+	if decision(result, "escalation") != "declines:critical" || result.Metadata.DerivedSeverity != "critical" {
+		t.Errorf("Expected the declines rule to escalate to critical, got %+v / %+v", result.Steps, result.Metadata)
+	}
+	if len(result.Routing.Escalations) != 1 || !result.Routing.Escalations[0].Alert || result.Routing.ErrorGroup == nil || !result.Routing.ErrorGroup.New {
+		t.Errorf("Expected an alert and a new error group, got %+v", result.Routing)
+	}
+
+	// Rejections are reported, not answered with an error
+	if code, result = echo(`{"header":{"title":""}}`); code != http.StatusOK || result.Outcome != "rejected" || result.Status != http.StatusBadRequest || result.Error == "" {
+		t.Errorf("Expected a rejected log, got %d: %+v", code, result)
+	}
+
+	// Nothing was stored or counted
+	var stored, groups int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&stored)
+	db.QueryRow("SELECT COUNT(*) FROM error_groups").Scan(&groups)
+	if stored != 0 || groups != 0 || len(escalations.windows) != 0 {
+		t.Errorf("Expected nothing stored or counted, got %d logs, %d groups and %d counters", stored, groups, len(escalations.windows))
+	}
+}
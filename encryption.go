@@ -0,0 +1,144 @@
+// CubicLog Encryption at Rest - Application-level encryption of sensitive columns
+//
+// Logs frequently carry customer data in their description and body. When an
+// encryption key is configured, those two columns are sealed with AES-256-GCM
+// before they reach the database and transparently opened again when logs are
+// read or exported. Titles, types and derived metadata stay in clear text so
+// filtering and analytics keep working.
+//
+// KEY SOURCES (first match wins):
+//   - -encryption-key-file: file containing the key (e.g. written by your KMS agent)
+//   - CUBICLOG_ENCRYPTION_KEY: environment variable
+//
+// Keys are 32 bytes, given as base64 or 64 hex characters. Generate one with:
+//
+//	openssl rand -base64 32
+//
+// An encrypted value that can't be opened (no key or the wrong one) is shown as
+// stored, enc:v1: prefix included, rather than as an empty field, and counted
+// under "undecryptable_values" in GET /readyz?verbose=1. Erasure requests fail
+// instead of skipping such logs.
+//
+// NOTE: free-text search (?q=) cannot look inside encrypted columns.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// encryptedPrefix marks values sealed by CubicLog so plaintext rows written
+// before encryption was enabled remain readable
+const encryptedPrefix = "enc:v1:"
+
+// fieldCipher is nil when encryption at rest is disabled
+var fieldCipher cipher.AEAD
+
+// Errors opening an encrypted value
+var (
+	errNoEncryptionKey = errors.New("encrypted value found but no encryption key configured")
+	errMalformedSealed = errors.New("malformed encrypted value")
+)
+
+// undecryptableValues counts encrypted values openField could not open since startup
+var undecryptableValues atomic.Int64
+
+// loadEncryptionKey reads the key from a file or environment variable and enables encryption
+func loadEncryptionKey(keyFile string) error {
+	raw := os.Getenv("CUBICLOG_ENCRYPTION_KEY")
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("could not read key file: %v", err)
+		}
+		raw = string(data)
+	}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil // Encryption disabled
+	}
+
+	key, err := decodeEncryptionKey(raw)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	fieldCipher, err = cipher.NewGCM(block)
+	return err
+}
+
+// decodeEncryptionKey accepts a 32-byte key encoded as hex or base64
+func decodeEncryptionKey(raw string) ([]byte, error) {
+	if len(raw) == 64 {
+		if key, err := hex.DecodeString(raw); err == nil {
+			return key, nil
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes encoded as base64 or hex")
+	}
+	return key, nil
+}
+
+// sealField encrypts a column value (no-op when encryption is disabled or value is empty)
+func sealField(value string) (string, error) {
+	if fieldCipher == nil || value == "" {
+		return value, nil
+	}
+
+	nonce := make([]byte, fieldCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := fieldCipher.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openField decrypts a column value for display; plaintext values are returned
+// unchanged. Values that can't be decrypted are returned unchanged as well,
+// still marked enc:v1:, and counted in undecryptableValues.
+func openField(value string) string {
+	plain, err := decryptField(value)
+	if err != nil {
+		undecryptableValues.Add(1)
+		log.Printf("⚠️  %v", err)
+		return value
+	}
+	return plain
+}
+
+// decryptField decrypts a column value; plaintext values are returned unchanged
+func decryptField(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if fieldCipher == nil {
+		return "", errNoEncryptionKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < fieldCipher.NonceSize() {
+		return "", errMalformedSealed
+	}
+
+	nonce, ciphertext := sealed[:fieldCipher.NonceSize()], sealed[fieldCipher.NonceSize():]
+	plain, err := fieldCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value (wrong key?): %v", err)
+	}
+	return string(plain), nil
+}
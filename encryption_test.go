@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEncryptionAtRest tests that bodies are stored sealed and read back in clear text
+func TestEncryptionAtRest(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	t.Setenv("CUBICLOG_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err := loadEncryptionKey(""); err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	defer func() { fieldCipher = nil }()
+
+	jsonData, _ := json.Marshal(Log{
+		Header: LogHeader{Title: "Card declined", Description: "customer jane@example.com"},
+		Body:   map[string]interface{}{"email": "jane@example.com"},
+	})
+	w := httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", bytes.NewBuffer(jsonData)))
+
+	var storedBody, storedDesc string
+	db.QueryRow("SELECT body, description FROM logs").Scan(&storedBody, &storedDesc)
+	if strings.Contains(storedBody, "jane") || strings.Contains(storedDesc, "jane") {
+		t.Errorf("Expected encrypted columns, got body=%s description=%s", storedBody, storedDesc)
+	}
+
+	w = httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs", nil))
+
+	var logs []Log
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 1 || logs[0].Body["email"] != "jane@example.com" || logs[0].Header.Description != "customer jane@example.com" {
+		t.Errorf("Expected decrypted log, got %+v", logs)
+	}
+
+	// With the wrong key the value is shown as stored and counted, never as empty
+	t.Setenv("CUBICLOG_ENCRYPTION_KEY", "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if err := loadEncryptionKey(""); err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	before := undecryptableValues.Load()
+	if _, err := decryptField(storedDesc); err == nil {
+		t.Error("Expected an error decrypting with the wrong key")
+	}
+	if got := openField(storedDesc); got != storedDesc {
+		t.Errorf("Expected the sealed value to be kept, got '%s'", got)
+	}
+	fieldCipher = nil
+	if _, err := decryptField(storedDesc); err != errNoEncryptionKey {
+		t.Errorf("Expected errNoEncryptionKey without a key, got %v", err)
+	}
+	if got := openField(storedDesc); got != storedDesc {
+		t.Errorf("Expected the sealed value to be kept without a key, got '%s'", got)
+	}
+	if counted := undecryptableValues.Load() - before; counted != 2 {
+		t.Errorf("Expected 2 undecryptable values counted, got %d", counted)
+	}
+}
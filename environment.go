@@ -0,0 +1,86 @@
+// CubicLog Environments - Keep production, staging and dev logs apart
+//
+// Every log can carry the environment it came from. The first of these wins:
+//   - the environment of the managed API key that sent it (POST /api/keys
+//     with {"name": "ci", "environment": "staging"})
+//   - the X-CubicLog-Environment request header
+//   - header.environment in the log itself
+//   - "environment" or "env" in the body (or body.metadata)
+//   - the environment of its source in the registry (see sources.go)
+//
+// Names are lowercased and the usual short forms are spelled out (prod →
+// production, stage/stg → staging, dev → development), so clients don't have
+// to agree on a spelling. Logs without any of these have no environment.
+//
+// GET /api/logs, the exports and the bulk actions filter with ?environment=,
+// and the dashboard shows the environment as a badge next to each log.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// environmentHeader sets the environment of the logs in a request
+const environmentHeader = "X-CubicLog-Environment"
+
+// environmentAliases spell out common short environment names
+var environmentAliases = map[string]string{
+	"prod":  "production",
+	"prd":   "production",
+	"live":  "production",
+	"stage": "staging",
+	"stg":   "staging",
+	"dev":   "development",
+	"local": "development",
+}
+
+// environmentPattern is what an environment name may look like
+var environmentPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// normalizeEnvironment lowercases and validates an environment name ("" stays "")
+func normalizeEnvironment(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", nil
+	}
+	if alias, ok := environmentAliases[name]; ok {
+		name = alias
+	}
+	if !environmentPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid environment '%s' - use up to 32 letters, digits, '-' or '_'", name)
+	}
+	return name, nil
+}
+
+// bodyEnvironment returns the environment named in a log body
+func bodyEnvironment(body map[string]interface{}) string {
+	for _, field := range []string{"environment", "env"} {
+		if value, ok := body[field].(string); ok && value != "" {
+			return value
+		}
+	}
+	if meta, ok := body["metadata"].(map[string]interface{}); ok {
+		return bodyEnvironment(meta)
+	}
+	return ""
+}
+
+// resolveEnvironment decides the environment of a log sent with r
+func resolveEnvironment(r *http.Request, header LogHeader, body map[string]interface{}, source string) (string, error) {
+	if environment := managedKeyEnvironment(requestAPIKey(r)); environment != "" {
+		return environment, nil
+	}
+	for _, candidate := range []string{r.Header.Get(environmentHeader), header.Environment, bodyEnvironment(body)} {
+		if candidate != "" {
+			return normalizeEnvironment(candidate)
+		}
+	}
+	if info, ok := lookupSource(source); ok {
+		environment, _ := normalizeEnvironment(info.Environment)
+		return environment, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogEnvironment tests resolving, storing and filtering log environments
+func TestLogEnvironment(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, secret, err := createAPIKey("staging-ci", "stage")
+	if err != nil {
+		t.Fatalf("Expected a key for staging, got %v", err)
+	}
+	send := func(body string, headers map[string]string) (int, Log) {
+		r := httptest.NewRequest("POST", "/api/logs", strings.NewReader(body))
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		createLog(w, r)
+		var created Log
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return w.Code, created
+	}
+
+	cases := []struct {
+		body     string
+		headers  map[string]string
+		expected string
+	}{
+		{`{"header":{"title":"Deployed","environment":"dev"}}`, map[string]string{"Authorization": "Bearer " + secret}, "staging"},
+		{`{"header":{"title":"Deployed","environment":"dev"}}`, map[string]string{environmentHeader: "PROD"}, "production"},
+		{`{"header":{"title":"Deployed"},"body":{"metadata":{"env":"dev"}}}`, nil, "development"},
+		{`{"header":{"title":"Deployed"}}`, nil, ""},
+	}
+	for _, c := range cases {
+		if code, created := send(c.body, c.headers); code != 201 || created.Header.Environment != c.expected {
+			t.Errorf("Expected environment '%s' for %s, got %d '%s'", c.expected, c.body, code, created.Header.Environment)
+		}
+	}
+	if code, _ := send(`{"header":{"title":"Deployed","environment":"prod env!"}}`, nil); code != 400 {
+		t.Errorf("Expected status 400 for an invalid environment, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs?environment=prod", nil))
+	var logs []Log
+	json.NewDecoder(w.Body).Decode(&logs)
+	if len(logs) != 1 || logs[0].Header.Environment != "production" {
+		t.Errorf("Expected only the production log, got %+v", logs)
+	}
+
+	w = httptest.NewRecorder()
+	handleExportCSV(w, httptest.NewRequest("GET", "/api/export/csv?environment=staging&columns=title,environment", nil))
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 2 || lines[1] != "Deployed,staging" {
+		t.Errorf("Expected the staging log in the CSV export, got %q", w.Body.String())
+	}
+}
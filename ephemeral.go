@@ -0,0 +1,73 @@
+// CubicLog Ephemeral Mode - Throwaway instances for CI and debugging sessions
+//
+//	cubiclog -ephemeral                 everything in memory, nothing written to disk
+//	cubiclog -db :memory:               in-memory database, other files as configured
+//
+// -ephemeral implies -db :memory: and also skips the PID file; the signing key
+// and spool live in memory as they do for any in-memory database. Commands
+// that work on a database file and exit (-check, -cleanup, -restore, -seed,
+// -create-key, -verify-chain) are refused, since their result would vanish
+// with the process. Retention runs hourly instead of only at startup, as an
+// in-memory database always starts empty. /api/stats reports the size the
+// database itself reports (page count × page size), for files and memory
+// alike.
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isMemoryDSN reports whether a SQLite DSN names an in-memory database
+func isMemoryDSN(dsn string) bool {
+	return dsn == ":memory:" || strings.HasPrefix(dsn, "file::memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// storeInMemory reports whether the current database lives in memory
+func storeInMemory() bool {
+	store, ok := db.(*sqliteStore)
+	return ok && store.memory
+}
+
+// checkEphemeralCommands rejects one-shot commands that would only touch memory
+func checkEphemeralCommands(commands map[string]bool) error {
+	var used []string
+	for name, set := range commands {
+		if set {
+			used = append(used, "-"+name)
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	sort.Strings(used)
+	return fmt.Errorf("%s would only change an in-memory database that is gone when the command exits", strings.Join(used, ", "))
+}
+
+// databaseBytes returns the database size as the database reports it (0 if unknown)
+func databaseBytes() int64 {
+	var size int64
+	switch db.Driver() {
+	case "sqlite3":
+		var pages, pageSize int64
+		if db.QueryRow("PRAGMA page_count").Scan(&pages) == nil && db.QueryRow("PRAGMA page_size").Scan(&pageSize) == nil {
+			size = pages * pageSize
+		}
+	case "postgres":
+		db.QueryRow("SELECT pg_database_size(current_database())").Scan(&size)
+	}
+	return size
+}
+
+// startMemoryCleanup applies retention every hour to an in-memory database
+func startMemoryCleanup() {
+	log.Printf("🧪 In-memory database: logs are gone when CubicLog stops")
+	go func() {
+		for range time.Tick(time.Hour) {
+			cleanupOldLogs(currentRetention())
+		}
+	}()
+}
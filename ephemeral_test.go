@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestInMemoryDatabase tests that concurrent requests share one in-memory database
+func TestInMemoryDatabase(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	if !storeInMemory() || db.(*sqliteStore).Stats().MaxOpenConnections != 1 {
+		t.Fatalf("Expected :memory: to be recognised and kept on a single connection")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"header":{"type":"info","title":"Request %d"}}`, i)
+			createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		}(i)
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	handleStats(w, httptest.NewRequest("GET", "/api/stats", nil))
+	var stats struct {
+		Total        int    `json:"total"`
+		DatabaseSize string `json:"database_size"`
+	}
+	json.NewDecoder(w.Body).Decode(&stats)
+	if stats.Total != 20 {
+		t.Errorf("Expected all 20 logs in the shared database, got %d", stats.Total)
+	}
+	if !strings.HasSuffix(stats.DatabaseSize, "KB (in memory)") {
+		t.Errorf("Expected the in-memory size, got %q", stats.DatabaseSize)
+	}
+
+	if err := checkEphemeralCommands(map[string]bool{"seed": true, "cleanup": false, "check": true}); err == nil ||
+		!strings.HasPrefix(err.Error(), "-check, -seed would") {
+		t.Errorf("Expected -check and -seed to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+// CubicLog Escalation Rules - Treat a flood differently from a trickle
+//
+// Rules are read from a JSON file given with -escalation-file:
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "name": "warning-flood",
+//	      "match": {"severities": ["warning"], "text": "timeout"},
+//	      "threshold": 20,
+//	      "window": "5m",
+//	      "group_by": "source",
+//	      "escalate_to": "critical",
+//	      "cooldown": "15m"
+//	    }
+//	  ]
+//	}
+//
+// Every incoming log is checked against the rules in order. When a rule has
+// seen threshold matching logs within window (per source with group_by
+// "source", per client IP with "ip"), matching logs are stored with escalate_to (default "critical") as
+// their derived severity for as long as the rate stays above the threshold,
+// and an alert fires (see alerts.go) - at most once per cooldown (default: the
+// window). The first rule that escalates a log wins.
+//
+// Match fields are all optional and combined with AND: severities, sources and
+// categories compare against the derived metadata, text is a case-insensitive
+// substring of the title or description, and access reads the log as an HTTP
+// request (see security.go): auth_failure, scan or unauthorized (a 401). Counters live in memory and start
+// over on restart. GET /api/escalations shows the rules and current counts.
+// The rules can be replaced at runtime from the dashboard (see adminconfig.go).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// escalationMatch selects the logs a rule counts
+type escalationMatch struct {
+	Severities []string `json:"severities,omitempty"`
+	Sources    []string `json:"sources,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Access     string   `json:"access,omitempty"` // "", auth_failure, scan or unauthorized
+}
+
+// escalationRule is one entry of the -escalation-file
+type escalationRule struct {
+	Name       string          `json:"name"`
+	Match      escalationMatch `json:"match"`
+	Threshold  int             `json:"threshold"`
+	Window     string          `json:"window"`
+	GroupBy    string          `json:"group_by"` // "", "source" or "ip"
+	EscalateTo string          `json:"escalate_to"`
+	Cooldown   string          `json:"cooldown"`
+
+	window   time.Duration
+	cooldown time.Duration
+}
+
+// escalationWindow holds the recent matches of one rule (and source)
+type escalationWindow struct {
+	seen      []time.Time
+	lastFired time.Time
+}
+
+// escalationTracker holds the rules and their sliding windows
+type escalationTracker struct {
+	mu      sync.Mutex
+	rules   []escalationRule
+	windows map[string]*escalationWindow
+}
+
+// escalations is nil when no escalation file is configured
+var escalations *escalationTracker
+
+// loadEscalationRules reads and validates the escalation file
+func loadEscalationRules(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read escalation file: %v", err)
+	}
+
+	var config struct {
+		Rules []escalationRule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid escalation file: %v", err)
+	}
+	for i := range config.Rules {
+		if err := normalizeEscalationRule(&config.Rules[i]); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+
+	escalations = &escalationTracker{rules: config.Rules, windows: make(map[string]*escalationWindow)}
+	return nil
+}
+
+// normalizeEscalationRule validates a rule and fills in defaults
+func normalizeEscalationRule(rule *escalationRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.Threshold < 1 {
+		return fmt.Errorf("'%s': threshold must be at least 1", rule.Name)
+	}
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("'%s': window must be a duration like 5m", rule.Name)
+	}
+	rule.window, rule.cooldown = window, window
+	if rule.Cooldown != "" {
+		if rule.cooldown, err = time.ParseDuration(rule.Cooldown); err != nil || rule.cooldown < 0 {
+			return fmt.Errorf("'%s': cooldown must be a duration like 15m", rule.Name)
+		}
+	}
+	switch rule.GroupBy {
+	case "", "source", "ip":
+	default:
+		return fmt.Errorf("'%s': group_by must be empty, source or ip", rule.Name)
+	}
+	switch rule.Match.Access {
+	case "", "auth_failure", "scan", "unauthorized":
+	default:
+		return fmt.Errorf("'%s': match access must be auth_failure, scan or unauthorized", rule.Name)
+	}
+	rule.EscalateTo = strings.ToLower(strings.TrimSpace(rule.EscalateTo))
+	if rule.EscalateTo == "" {
+		rule.EscalateTo = "critical"
+	}
+	rule.Match.Severities = parseSeverityList(strings.Join(rule.Match.Severities, ","))
+	rule.Match.Text = strings.ToLower(rule.Match.Text)
+	return nil
+}
+
+// matches reports whether a log counts towards the rule; access is read from
+// the log only when a rule needs it
+func (rule escalationRule) matches(header LogHeader, metadata LogMetadata, access func() accessEvent) bool {
+	if len(rule.Match.Severities) > 0 && !containsString(rule.Match.Severities, metadata.DerivedSeverity) {
+		return false
+	}
+	if len(rule.Match.Sources) > 0 && !containsString(rule.Match.Sources, metadata.DerivedSource) {
+		return false
+	}
+	if len(rule.Match.Categories) > 0 && !containsString(rule.Match.Categories, metadata.DerivedCategory) {
+		return false
+	}
+	if rule.Match.Text != "" && !strings.Contains(strings.ToLower(header.Title), rule.Match.Text) &&
+		!strings.Contains(strings.ToLower(header.Description), rule.Match.Text) {
+		return false
+	}
+	switch rule.Match.Access {
+	case "auth_failure":
+		if !access().AuthFailure {
+			return false
+		}
+	case "scan":
+		if !access().Scan {
+			return false
+		}
+	case "unauthorized":
+		if access().Status != http.StatusUnauthorized {
+			return false
+		}
+	}
+	// Logs without a client IP can't be counted per IP
+	return rule.GroupBy != "ip" || access().IP != ""
+}
+
+// windowKey identifies the counter a log goes to
+func (rule escalationRule) windowKey(metadata LogMetadata, access func() accessEvent) (key, group string) {
+	switch rule.GroupBy {
+	case "source":
+		group = metadata.DerivedSource
+	case "ip":
+		group = access().IP
+	}
+	return rule.Name + "\x00" + group, group
+}
+
+// escalation is the outcome of observing one log
+type escalation struct {
+	Rule  *escalationRule
+	Group string
+	Count int
+	Fire  bool // an alert is due
+}
+
+// observe counts a log and reports whether it is escalated. Only logs that
+// were accepted are counted; peek decides their severity beforehand.
+func (t *escalationTracker) observe(now time.Time, header LogHeader, body map[string]interface{}, metadata LogMetadata) *escalation {
+	return t.check(now, header, body, metadata, true)
+}
+
+// peek reports whether observe would escalate a log, without counting it
+func (t *escalationTracker) peek(now time.Time, header LogHeader, body map[string]interface{}, metadata LogMetadata) *escalation {
+	return t.check(now, header, body, metadata, false)
+}
+
+// check runs a log through the rules, counting it in their windows when count is set
+func (t *escalationTracker) check(now time.Time, header LogHeader, body map[string]interface{}, metadata LogMetadata, count bool) *escalation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var event *accessEvent
+	access := func() accessEvent {
+		if event == nil {
+			inspected := inspectAccess(header, body)
+			event = &inspected
+		}
+		return *event
+	}
+
+	var result *escalation
+	for i := range t.rules {
+		rule := &t.rules[i]
+		if !rule.matches(header, metadata, access) {
+			continue
+		}
+		key, group := rule.windowKey(metadata, access)
+		window := t.windows[key]
+		if window == nil {
+			window = &escalationWindow{}
+			if count {
+				t.windows[key] = window
+			}
+		}
+		seen := len(window.seen) + 1
+		if count {
+			window.seen = append(pruneBefore(window.seen, now.Add(-rule.window)), now)
+			if max := rule.Threshold * 10; len(window.seen) > max {
+				window.seen = window.seen[len(window.seen)-max:]
+			}
+			seen = len(window.seen)
+		} else {
+			cutoff := now.Add(-rule.window)
+			for _, at := range window.seen {
+				if at.Before(cutoff) {
+					seen--
+				}
+			}
+		}
+
+		if result != nil || seen < rule.Threshold {
+			continue
+		}
+		result = &escalation{Rule: rule, Group: group, Count: seen}
+		if window.lastFired.IsZero() || now.Sub(window.lastFired) >= rule.cooldown {
+			if count {
+				window.lastFired = now
+			}
+			result.Fire = true
+		}
+	}
+	return result
+}
+
+// escalationPreview is what observe would do with one more log (see echoclassify.go)
+type escalationPreview struct {
+	Rule       string `json:"rule"`
+	Group      string `json:"group,omitempty"`
+	Count      int    `json:"count"` // including this log
+	Threshold  int    `json:"threshold"`
+	Escalates  bool   `json:"escalates"`
+	EscalateTo string `json:"escalate_to,omitempty"`
+	Alert      bool   `json:"alert"`
+	SilencedBy string `json:"silenced_by,omitempty"`
+}
+
+// preview lists the rules a log matches and what counting it would do,
+// without counting it
+func (t *escalationTracker) preview(now time.Time, header LogHeader, body map[string]interface{}, metadata LogMetadata) []escalationPreview {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var event *accessEvent
+	access := func() accessEvent {
+		if event == nil {
+			inspected := inspectAccess(header, body)
+			event = &inspected
+		}
+		return *event
+	}
+
+	previews := []escalationPreview{}
+	escalated := false
+	for i := range t.rules {
+		rule := &t.rules[i]
+		if !rule.matches(header, metadata, access) {
+			continue
+		}
+		key, group := rule.windowKey(metadata, access)
+		count, lastFired := 1, time.Time{}
+		if window := t.windows[key]; window != nil {
+			cutoff := now.Add(-rule.window)
+			for _, seen := range window.seen {
+				if !seen.Before(cutoff) {
+					count++
+				}
+			}
+			lastFired = window.lastFired
+		}
+		preview := escalationPreview{Rule: rule.Name, Group: group, Count: count, Threshold: rule.Threshold}
+		if !escalated && count >= rule.Threshold {
+			escalated = true
+			preview.Escalates, preview.EscalateTo = true, rule.EscalateTo
+			if preview.Alert = lastFired.IsZero() || now.Sub(lastFired) >= rule.cooldown; preview.Alert {
+				alert := (&escalation{Rule: rule, Group: group, Count: count}).alert(0)
+				alert.FiredAt = now
+				preview.SilencedBy = silencedBy(alert)
+			}
+		}
+		previews = append(previews, preview)
+	}
+	return previews
+}
+
+// pruneBefore drops timestamps older than cutoff (times are in order)
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := sort.Search(len(times), func(i int) bool { return !times[i].Before(cutoff) })
+	return append(times[:0], times[i:]...)
+}
+
+// alert describes an escalation for fireAlert
+func (e *escalation) alert(logID int64) Alert {
+	var logIDs []int64
+	if logID > 0 { // spooled logs get their id later
+		logIDs = []int64{logID}
+	}
+	subject := "matching logs"
+	if len(e.Rule.Match.Severities) > 0 {
+		subject = strings.Join(e.Rule.Match.Severities, "/") + " logs"
+	}
+	if e.Group != "" {
+		subject += " from " + e.Group
+	}
+	source := e.Group
+	if e.Rule.GroupBy == "ip" {
+		source = "" // the group is a client IP, named in the message
+	}
+	return Alert{
+		Rule:     e.Rule.Name,
+		Kind:     "escalation",
+		Source:   source,
+		Severity: e.Rule.EscalateTo,
+		Title:    "Escalated: " + e.Rule.Name,
+		Message:  fmt.Sprintf("%d %s within %s, now treated as %s", e.Count, subject, e.Rule.window, e.Rule.EscalateTo),
+		Count:    e.Count,
+		LogIDs:   logIDs,
+	}
+}
+
+// escalationStatus is one counter as shown by GET /api/escalations
+type escalationStatus struct {
+	Rule      string `json:"rule"`
+	Group     string `json:"group,omitempty"`
+	Count     int    `json:"count"`
+	Threshold int    `json:"threshold"`
+	Window    string `json:"window"`
+	Escalated bool   `json:"escalated"`
+	LastFired string `json:"last_fired,omitempty"`
+}
+
+// status returns the rules and their current counts
+func (t *escalationTracker) status(now time.Time) []escalationStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := []escalationStatus{}
+	for _, rule := range t.rules {
+		prefix := rule.Name + "\x00"
+		var groups []escalationStatus
+		for key, window := range t.windows {
+			group, ok := strings.CutPrefix(key, prefix)
+			if !ok {
+				continue
+			}
+			window.seen = pruneBefore(window.seen, now.Add(-rule.window))
+			if len(window.seen) == 0 && now.Sub(window.lastFired) >= rule.cooldown {
+				delete(t.windows, key) // idle counter
+				continue
+			}
+			status := escalationStatus{Rule: rule.Name, Group: group, Count: len(window.seen), Threshold: rule.Threshold,
+				Window: rule.window.String(), Escalated: len(window.seen) >= rule.Threshold}
+			if !window.lastFired.IsZero() {
+				status.LastFired = window.lastFired.UTC().Format(time.RFC3339)
+			}
+			groups = append(groups, status)
+		}
+		if len(groups) == 0 {
+			groups = append(groups, escalationStatus{Rule: rule.Name, Threshold: rule.Threshold, Window: rule.window.String()})
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+		statuses = append(statuses, groups...)
+	}
+	return statuses
+}
+
+// handleEscalations answers GET /api/escalations
+func handleEscalations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	statuses := []escalationStatus{}
+	if escalations != nil {
+		statuses = escalations.status(time.Now())
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"enabled": escalations != nil, "rules": statuses})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEscalationRules tests that a flood of warnings escalates and fires one alert
+func TestEscalationRules(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	delivered := make(chan Alert, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		json.NewDecoder(r.Body).Decode(&alert)
+		delivered <- alert
+	}))
+	defer receiver.Close()
+	alertWebhookURL = receiver.URL
+	defer func() { escalations, alertWebhookURL = nil, "" }()
+
+	path := filepath.Join(t.TempDir(), "escalations.json")
+	os.WriteFile(path, []byte(`{"rules": [{"name": "warning-flood", "match": {"severities": ["warning"]},
+		"threshold": 3, "window": "1m", "group_by": "source"}]}`), 0644)
+	if err := loadEscalationRules(path); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	send := func(source string) string {
+		body := `{"header":{"type":"warning","title":"Slow upstream","source":"` + source + `"}}`
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		return w.Header().Get("X-CubicLog-Escalated")
+	}
+	for i := 0; i < 2; i++ {
+		send("payments")
+		send("search")
+	}
+	if rule := send("payments"); rule != "warning-flood" {
+		t.Errorf("Expected the third payments warning to escalate, got '%s'", rule)
+	}
+	send("payments") // still escalated, but within the cooldown
+
+	var critical, searchCritical int
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity = 'critical'").Scan(&critical)
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity = 'critical' AND source = 'search'").Scan(&searchCritical)
+	if critical != 2 || searchCritical != 0 {
+		t.Errorf("Expected 2 escalated payments logs, got %d (%d from search)", critical, searchCritical)
+	}
+
+	alerts, _ := recentAlerts(time.Now().Add(-time.Hour), 10)
+	if len(alerts) != 1 || alerts[0].Source != "payments" || alerts[0].Count != 3 {
+		t.Fatalf("Expected one alert for payments, got %+v", alerts)
+	}
+	select {
+	case alert := <-delivered:
+		if alert.Rule != "warning-flood" {
+			t.Errorf("Expected the webhook to receive warning-flood, got %s", alert.Rule)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the alert to be delivered to the webhook")
+	}
+}
+
+// TestEscalationCountsAcceptedLogs tests that rejected logs don't count towards an escalation
+func TestEscalationCountsAcceptedLogs(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	originalMax, originalPolicy := maxBodyBytes, oversizePolicy
+	defer func() { escalations, maxBodyBytes, oversizePolicy = nil, originalMax, originalPolicy }()
+	maxBodyBytes, oversizePolicy = 100, "reject"
+
+	path := filepath.Join(t.TempDir(), "escalations.json")
+	os.WriteFile(path, []byte(`{"rules": [{"name": "warning-flood", "match": {"severities": ["warning"]},
+		"threshold": 2, "window": "1m"}]}`), 0644)
+	if err := loadEscalationRules(path); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		return w
+	}
+	oversized := `{"header":{"type":"warning","title":"Slow upstream"},"body":{"trace":"` + strings.Repeat("x", 200) + `"}}`
+	for i := 0; i < 3; i++ {
+		if w := send(oversized); w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Expected oversized log to be rejected, got %d", w.Code)
+		}
+	}
+	dryRun := httptest.NewRequest("POST", "/api/logs?dry_run=true", strings.NewReader(`{"header":{"type":"warning","title":"Slow upstream"}}`))
+	createLog(httptest.NewRecorder(), dryRun)
+
+	if w := send(`{"header":{"type":"warning","title":"Slow upstream"}}`); w.Header().Get("X-CubicLog-Escalated") != "" {
+		t.Errorf("Expected the first accepted warning not to escalate, got '%s'", w.Header().Get("X-CubicLog-Escalated"))
+	}
+	if w := send(`{"header":{"type":"warning","title":"Slow upstream"}}`); w.Header().Get("X-CubicLog-Escalated") != "warning-flood" {
+		t.Errorf("Expected the second accepted warning to escalate")
+	}
+}
@@ -0,0 +1,59 @@
+// CubicLog Conditional Requests - 304 Not Modified for unchanged log queries
+//
+// The dashboard polls GET /api/logs every few seconds, usually getting the
+// same page back. Each response carries an ETag derived from the number of
+// logs matching the filter and the highest matching id: any new log raises
+// the id, any deleted one lowers the count. Everything editing logs in place -
+// bulk actions, corrections, repeats counted by throttling and privacy
+// erasures - bumps bulkGeneration, so when all three are unchanged so is the
+// result. A request with a matching
+// If-None-Match is answered with an empty 304 before rows are fetched,
+// decrypted or encoded.
+//
+// The tag is weak (W/) because the same result may be sent gzip-compressed
+// or not.
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// logsETag returns the ETag of the logs matching a WHERE clause
+func logsETag(fromDate, toDate string, attached []archiveDB, where string, args []interface{}) (string, error) {
+	rows, release, err := queryArchivedLogs(fromDate, toDate, attached, func(table string) (string, []interface{}) {
+		return "SELECT COUNT(*), COALESCE(MAX(id), 0) FROM " + table + where, args
+	})
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	var count, maxID int64
+	if rows.Next() {
+		if err := rows.Scan(&count, &maxID); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if generation := bulkGeneration.Load(); generation > 0 {
+		return fmt.Sprintf(`W/"%d-%d-%d"`, maxID, count, generation), nil
+	}
+	return fmt.Sprintf(`W/"%d-%d"`, maxID, count), nil
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogsETag tests conditional GET /api/logs requests
+func TestLogsETag(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	post := func(title string) {
+		req := httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"type":"info","title":"`+title+`"}}`))
+		createLog(httptest.NewRecorder(), req)
+	}
+	get := func(url, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handleLogs(w, req)
+		return w
+	}
+
+	post("first")
+	w := get("/api/logs", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d and '%s'", w.Code, etag)
+	}
+
+	// Unchanged result: 304 without a body
+	w = get("/api/logs", etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected empty 304, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	// A log outside the filter doesn't change the filtered tag
+	filtered := get("/api/logs?q=first", "").Header().Get("ETag")
+	post("second")
+	if w = get("/api/logs?q=first", filtered); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for unchanged filtered result, got %d", w.Code)
+	}
+
+	// A new matching log does
+	if w = get("/api/logs", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after a new log, got %d", w.Code)
+	}
+
+	// So does a deleted one
+	etag = get("/api/logs", "").Header().Get("ETag")
+	db.Exec("DELETE FROM logs WHERE title = 'first'")
+	if w = get("/api/logs", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after a deletion, got %d", w.Code)
+	}
+}
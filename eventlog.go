@@ -0,0 +1,215 @@
+// CubicLog Windows Event Log - Application and System events without an extra agent
+//
+//	cubiclog.exe -eventlog Application,System
+//
+// On Windows, CubicLog collects the given event log channels itself: every
+// few seconds it asks wevtutil (part of Windows) for the events recorded since
+// the last ones it saw and stores each as a log, like a POST /api/logs
+// (quotas, escalations, throttling and learned corrections apply):
+//   - title: the first line of the rendered message ("<provider> event <id>"
+//     for events without one)
+//   - severity and type from the level: Critical, Error, Warning, Information
+//     (info) and Verbose (debug)
+//   - source: the event's provider ("Service Control Manager", "MSSQLSERVER")
+//   - body: channel, provider, event_id, record_id, computer, time_created,
+//     the full message and the event data fields
+//
+// Collection starts with the events recorded after CubicLog started; events
+// written while it was down are not picked up. Reading the Security channel
+// needs an administrator account. On other systems -eventlog refuses to start.
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventLogInterval is how often the channels are asked for new events
+const eventLogInterval = 5 * time.Second
+
+// eventLogBatch is the most events read from a channel at once
+const eventLogBatch = 500
+
+// eventLogChannels are the -eventlog channels - configured once in main()
+var eventLogChannels []string
+
+// eventLogLevels maps Windows event levels to severities (0, LogAlways, is info)
+var eventLogLevels = map[int]string{1: "critical", 2: "error", 3: "warning", 4: "info", 5: "debug"}
+
+// windowsEvent is one event as rendered by wevtutil /f:RenderedXml
+type windowsEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     int `xml:"EventID"`
+		Level       int `xml:"Level"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID int64  `xml:"EventRecordID"`
+		Channel       string `xml:"Channel"`
+		Computer      string `xml:"Computer"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+// configureEventLog checks the -eventlog channels can be collected here
+func configureEventLog(channels string) error {
+	eventLogChannels = nil
+	for _, channel := range strings.Split(channels, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			eventLogChannels = append(eventLogChannels, channel)
+		}
+	}
+	if len(eventLogChannels) == 0 {
+		return nil
+	}
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("-eventlog collects Windows event logs and only runs on Windows, not %s", runtime.GOOS)
+	}
+	if _, err := exec.LookPath("wevtutil"); err != nil {
+		return fmt.Errorf("wevtutil not found: %v", err)
+	}
+	return nil
+}
+
+// parseWindowsEvents reads the events of a wevtutil query (a sequence of <Event> elements)
+func parseWindowsEvents(data []byte) ([]windowsEvent, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var events []windowsEvent
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "Event" {
+			var event windowsEvent
+			if err := decoder.DecodeElement(&event, &start); err != nil {
+				return events, err
+			}
+			events = append(events, event)
+		}
+	}
+}
+
+// windowsEventLog converts an event into a log and its severity
+func windowsEventLog(event windowsEvent) (Log, string) {
+	severity := eventLogLevels[event.System.Level]
+	if severity == "" {
+		severity = "info"
+	}
+	provider := strings.TrimSpace(event.System.Provider.Name)
+	if provider == "" {
+		provider = "eventlog"
+	}
+	message := strings.TrimSpace(event.RenderingInfo.Message)
+	title, _, _ := strings.Cut(message, "\n")
+	if title = strings.TrimSpace(title); title == "" {
+		title = fmt.Sprintf("%s event %d", provider, event.System.EventID)
+	}
+
+	body := map[string]interface{}{
+		"channel":      event.System.Channel,
+		"provider":     provider,
+		"event_id":     event.System.EventID,
+		"record_id":    event.System.EventRecordID,
+		"computer":     event.System.Computer,
+		"time_created": event.System.TimeCreated.SystemTime,
+	}
+	if message != "" {
+		body["message"] = message
+	}
+	if len(event.EventData.Data) > 0 {
+		data := map[string]interface{}{}
+		for i, field := range event.EventData.Data {
+			name := field.Name
+			if name == "" {
+				name = "data_" + strconv.Itoa(i+1)
+			}
+			data[name] = strings.TrimSpace(field.Value)
+		}
+		body["event_data"] = data
+	}
+	logType := severity
+	if logType == "critical" {
+		logType = "error"
+	}
+	return Log{Header: LogHeader{Type: logType, Title: truncateTitle(title), Source: provider}, Body: body}, severity
+}
+
+// queryEventLog runs wevtutil for the events of a channel after a record (the newest one with after < 0)
+func queryEventLog(channel string, after int64) ([]windowsEvent, error) {
+	args := []string{"qe", channel, "/f:RenderedXml"}
+	if after < 0 {
+		args = append(args, "/c:1", "/rd:true")
+	} else {
+		args = append(args, fmt.Sprintf("/q:*[System[EventRecordID>%d]]", after), fmt.Sprintf("/c:%d", eventLogBatch), "/rd:false")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("wevtutil", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseWindowsEvents(output)
+}
+
+// collectEvents stores events through ingestLog and returns the last record stored
+func collectEvents(events []windowsEvent, last int64) int64 {
+	for _, event := range events {
+		entry, severity := windowsEventLog(event)
+		if status, _, message := ingestCollected(entry, severity); status >= 300 {
+			// Stop here so the event is tried again with the next poll
+			log.Printf("⚠️  Event %d from %s not stored: %s", event.System.EventRecordID, event.System.Channel, message)
+			return last
+		}
+		last = event.System.EventRecordID
+	}
+	return last
+}
+
+// startEventLogCollector polls the -eventlog channels in the background
+func startEventLogCollector() {
+	for _, channel := range eventLogChannels {
+		go func(channel string) {
+			last := int64(-1) // the newest record is looked up first, so the history isn't imported
+			for ; ; time.Sleep(eventLogInterval) {
+				events, err := queryEventLog(channel, last)
+				if err != nil {
+					log.Printf("⚠️  Event log %s: %v", channel, err)
+					continue
+				}
+				if last < 0 {
+					last = 0
+					if len(events) > 0 {
+						last = events[0].System.EventRecordID
+					}
+					log.Printf("🪟 Collecting the %s event log", channel)
+					continue
+				}
+				last = collectEvents(events, last)
+			}
+		}(channel)
+	}
+}
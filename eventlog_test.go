@@ -0,0 +1,45 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+// TestWindowsEventLog tests converting wevtutil output into logs
+func TestWindowsEventLog(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	output := `<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System><Provider Name='Service Control Manager'/><EventID Qualifiers='49152'>7031</EventID><Level>2</Level><TimeCreated SystemTime='2024-05-13T08:15:02.1234567Z'/><EventRecordID>48211</EventRecordID><Channel>System</Channel><Computer>WEB-01</Computer></System><EventData><Data Name='param1'>Print Spooler</Data><Data Name='param2'>1</Data></EventData><RenderingInfo Culture='en-US'><Message>The Print Spooler service terminated unexpectedly.
+It has done this 1 time(s).</Message><Level>Error</Level></RenderingInfo></Event>
+<Event xmlns='http://schemas.microsoft.com/win/2004/08/events/event'><System><Provider Name='MsiInstaller'/><EventID>1033</EventID><Level>4</Level><TimeCreated SystemTime='2024-05-13T08:16:00Z'/><EventRecordID>48212</EventRecordID><Channel>Application</Channel><Computer>WEB-01</Computer></System><EventData><Data>Product: Agent</Data></EventData></Event>`
+	events, err := parseWindowsEvents([]byte(output))
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d (%v)", len(events), err)
+	}
+
+	entry, severity := windowsEventLog(events[0])
+	if severity != "error" || entry.Header.Source != "Service Control Manager" || entry.Header.Title != "The Print Spooler service terminated unexpectedly." {
+		t.Errorf("Unexpected log for the service crash: %s %+v", severity, entry.Header)
+	}
+	if entry.Body["event_id"] != 7031 || entry.Body["computer"] != "WEB-01" || entry.Body["event_data"].(map[string]interface{})["param1"] != "Print Spooler" {
+		t.Errorf("Unexpected body: %+v", entry.Body)
+	}
+	entry, severity = windowsEventLog(events[1])
+	if severity != "info" || entry.Header.Title != "MsiInstaller event 1033" || entry.Body["event_data"].(map[string]interface{})["data_1"] != "Product: Agent" {
+		t.Errorf("Unexpected log for the installer event: %s %+v %+v", severity, entry.Header, entry.Body)
+	}
+
+	if last := collectEvents(events, 48210); last != 48212 {
+		t.Errorf("Expected record 48212 to be the last collected, got %d", last)
+	}
+	var stored int
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity = 'error' AND source = 'Service Control Manager'").Scan(&stored)
+	if stored != 1 {
+		t.Errorf("Expected the service crash stored as an error, got %d", stored)
+	}
+	if err := configureEventLog("Application"); err == nil && runtime.GOOS != "windows" {
+		t.Error("Expected -eventlog to be refused outside Windows")
+	}
+	configureEventLog("")
+}
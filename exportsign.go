@@ -0,0 +1,190 @@
+// CubicLog Signed Exports - Checksums and signatures for audit extracts
+//
+// Every export (CSV, JSON, xlsx, also with ?compress=gzip) accepts ?sign=:
+//   - sign=header   the file as usual, with its SHA-256 checksum and HMAC
+//     signature in the response headers:
+//     Digest: sha-256=<base64>
+//     X-CubicLog-SHA256: <hex>
+//     X-CubicLog-Signature: hmac-sha256:<hex>
+//   - sign=sidecar  a zip holding the file plus sidecar files next to it:
+//     <file>.sha256 (sha256sum format, so `sha256sum -c` works) and <file>.sig
+//
+// Checksum and signature cover the file exactly as downloaded (the .gz with
+// ?compress=gzip). The export is spooled to a temporary file to compute them
+// before anything is sent, so signed exports are never compressed on the fly.
+// The signing key is the instance's (see signing.go): anyone can check the
+// checksum, while POST /api/export/verify with the file as body and the
+// signature in X-CubicLog-Signature tells whether this instance produced it.
+package main
+
+import (
+	"archive/zip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Response headers of signed exports
+const (
+	exportChecksumHeader  = "X-CubicLog-SHA256"
+	exportSignatureHeader = "X-CubicLog-Signature"
+)
+
+// exportSignModes are the accepted ?sign= values
+var exportSignModes = []string{"header", "sidecar"}
+
+// spooledExport captures an export in a temporary file while hashing it
+type spooledExport struct {
+	header http.Header
+	status int
+	file   *os.File
+	sum    hash.Hash
+	mac    hash.Hash
+	size   int64
+}
+
+func (s *spooledExport) Header() http.Header { return s.header }
+
+func (s *spooledExport) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+}
+
+func (s *spooledExport) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.file.Write(p)
+	s.sum.Write(p[:n])
+	s.mac.Write(p[:n])
+	s.size += int64(n)
+	return n, err
+}
+
+// exportFilename returns the attachment name of an export
+func exportFilename(header http.Header) string {
+	if _, name, ok := strings.Cut(header.Get("Content-Disposition"), "filename="); ok && name != "" {
+		return strings.Trim(name, `"`)
+	}
+	return "cubiclog_export"
+}
+
+// signExport runs an export into a temporary file and sends it with its
+// checksum and signature (errors are passed through unsigned)
+func signExport(w http.ResponseWriter, r *http.Request, export http.HandlerFunc) {
+	mode := r.URL.Query().Get("sign")
+	if mode == "true" {
+		mode = "header"
+	}
+	if !containsString(exportSignModes, mode) {
+		http.Error(w, "Unsupported sign value - use sign=header or sign=sidecar", http.StatusBadRequest)
+		return
+	}
+	mac, err := newPayloadMAC()
+	if err != nil {
+		log.Printf("⚠️  Export signing unavailable: %v", err)
+		http.Error(w, "Export signing is not available", http.StatusInternalServerError)
+		return
+	}
+	file, err := os.CreateTemp("", "cubiclog-export-*")
+	if err != nil {
+		http.Error(w, "Failed to prepare export", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	spool := &spooledExport{header: http.Header{}, file: file, sum: sha256.New(), mac: mac}
+	export(spool, r)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read export", http.StatusInternalServerError)
+		return
+	}
+	if spool.status == 0 {
+		spool.status = http.StatusOK
+	}
+	if spool.status != http.StatusOK {
+		for name, values := range spool.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(spool.status)
+		io.Copy(w, file)
+		return
+	}
+
+	checksum := spool.sum.Sum(nil)
+	signature := formatSignature(spool.mac)
+	name := exportFilename(spool.header)
+
+	if mode == "header" {
+		for name, values := range spool.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(checksum))
+		w.Header().Set(exportChecksumHeader, hex.EncodeToString(checksum))
+		w.Header().Set(exportSignatureHeader, signature)
+		w.Header().Set("Access-Control-Expose-Headers", "Digest, "+exportChecksumHeader+", "+exportSignatureHeader)
+		w.Header().Set("Content-Length", fmt.Sprint(spool.size))
+		io.Copy(w, file)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+name+".zip")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	archive := zip.NewWriter(w)
+	if entry, err := archive.Create(name); err == nil {
+		io.Copy(entry, file)
+	}
+	if entry, err := archive.Create(name + ".sha256"); err == nil {
+		fmt.Fprintf(entry, "%s  %s\n", hex.EncodeToString(checksum), name)
+	}
+	if entry, err := archive.Create(name + ".sig"); err == nil {
+		fmt.Fprintln(entry, signature)
+	}
+	archive.Close()
+}
+
+// handleExportVerify answers POST /api/export/verify with an export as body
+func handleExportVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	signature := strings.TrimSpace(r.Header.Get(exportSignatureHeader))
+	if signature == "" {
+		signature = strings.TrimSpace(r.URL.Query().Get("signature"))
+	}
+	if signature == "" {
+		http.Error(w, "Send the signature in the "+exportSignatureHeader+" header", http.StatusBadRequest)
+		return
+	}
+	mac, err := newPayloadMAC()
+	if err != nil {
+		http.Error(w, "Export signing is not available", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(sum, mac), r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read export", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":  hmac.Equal([]byte(formatSignature(mac)), []byte(signature)),
+		"sha256": hex.EncodeToString(sum.Sum(nil)),
+		"bytes":  size,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSignedExports tests export checksums and signatures in headers and sidecar files
+func TestSignedExports(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureSigning("", ":memory:", "sqlite3")
+
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"type":"info","title":"Nightly backup"}}`)))
+	export := exportCompressHandler(handleExportCSV)
+
+	w := httptest.NewRecorder()
+	export(w, httptest.NewRequest("GET", "/api/export/csv?sign=header", nil))
+	sum := sha256.Sum256(w.Body.Bytes())
+	signature := w.Header().Get(exportSignatureHeader)
+	if w.Code != 200 || w.Header().Get(exportChecksumHeader) != hex.EncodeToString(sum[:]) || !strings.HasPrefix(signature, signaturePrefix) {
+		t.Fatalf("Expected the checksum and signature of the CSV in the headers, got %d %v", w.Code, w.Header())
+	}
+
+	verify := func(body []byte, signature string) bool {
+		r := httptest.NewRequest("POST", "/api/export/verify", bytes.NewReader(body))
+		r.Header.Set(exportSignatureHeader, signature)
+		w := httptest.NewRecorder()
+		handleExportVerify(w, r)
+		var result struct {
+			Valid bool `json:"valid"`
+		}
+		json.NewDecoder(w.Body).Decode(&result)
+		return result.Valid
+	}
+	csv := w.Body.Bytes()
+	if !verify(csv, signature) {
+		t.Error("Expected the signed export to verify")
+	}
+	if verify(append([]byte("id,title\n"), csv...), signature) {
+		t.Error("Expected an edited export to fail verification")
+	}
+
+	w = httptest.NewRecorder()
+	export(w, httptest.NewRequest("GET", "/api/export/csv?sign=sidecar", nil))
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip with sidecar files: %v", err)
+	}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		data, _ := io.ReadAll(reader)
+		files[file.Name] = string(data)
+	}
+	fileSum := sha256.Sum256([]byte(files["cubiclog_export.csv"]))
+	if files["cubiclog_export.csv.sha256"] != hex.EncodeToString(fileSum[:])+"  cubiclog_export.csv\n" ||
+		!verify([]byte(files["cubiclog_export.csv"]), strings.TrimSpace(files["cubiclog_export.csv.sig"])) {
+		t.Errorf("Expected matching sidecar files, got %v", files)
+	}
+
+	w = httptest.NewRecorder()
+	export(w, httptest.NewRequest("GET", "/api/export/csv?sign=pgp", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an unknown sign mode, got %d", w.Code)
+	}
+}
@@ -0,0 +1,190 @@
+// CubicLog Forecast - How fast the database grows and when the disk is full
+//
+//	cubiclog -disk-runway-days 14
+//
+// Every hour CubicLog records the size of the database (as the database
+// reports it, see databaseBytes). The growth per day is the trend of the
+// samples of the last 7 days, so retention, rollups and vacuums are taken into
+// account: a database that stopped growing has no runway to worry about.
+//
+// /api/stats shows the forecast under "storage": the current size, the growth
+// per day, the expected size in 7 and 30 days and, for a SQLite database, the
+// free space in its directory and the days until it is used up at the current
+// growth (the runway). The forecast needs samples spanning 6 hours; until then
+// only the size is shown.
+//
+// When the runway drops below -disk-runway-days (default 14, 0 turns it off)
+// an alert fires (kind disk_runway, see alerts.go) - once a day while it
+// stays low, critical when the disk is full within 2 days - and /api/stats
+// adds a banner. In-memory and read-only instances record no samples.
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	forecastInterval   = time.Hour           // how often the size is sampled
+	forecastLookback   = 7 * 24 * time.Hour  // the samples the growth is taken from
+	forecastMinSpan    = 6 * time.Hour       // how far apart samples must be for a forecast
+	forecastKeep       = 30 * 24 * time.Hour // how long samples are kept
+	runwayCriticalDays = 2.0                 // runway alerts below this are critical
+)
+
+// diskRunwayDays is the -disk-runway-days setting - configured once in main()
+var diskRunwayDays = 14
+
+// runwayAlerted remembers when the last runway alert fired
+var runwayAlerted struct {
+	sync.Mutex
+	at time.Time
+}
+
+// StorageForecast is the database size now and where it is heading
+type StorageForecast struct {
+	DatabaseBytes int64     `json:"database_bytes"`
+	SampledFrom   time.Time `json:"sampled_from"`
+	Samples       int       `json:"samples"`
+	GrowthPerDay  *int64    `json:"growth_bytes_per_day,omitempty"`
+	In7Days       *int64    `json:"forecast_7d_bytes,omitempty"`
+	In30Days      *int64    `json:"forecast_30d_bytes,omitempty"`
+	FreeDiskBytes *int64    `json:"free_disk_bytes,omitempty"`
+	RunwayDays    *float64  `json:"runway_days,omitempty"` // days until the free space is used up
+}
+
+// createStorageSamplesTable creates the table of database size samples
+func createStorageSamplesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS storage_samples (
+		sampled_at TIMESTAMP PRIMARY KEY,
+		db_bytes   BIGINT NOT NULL
+	);
+	`)
+	return err
+}
+
+// recordStorageSample stores the database size at a point in time and drops old samples
+func recordStorageSample(at time.Time, bytes int64) error {
+	if _, err := db.Exec(db.Rebind(`INSERT INTO storage_samples (sampled_at, db_bytes) VALUES (?, ?)`), dbTime(at), bytes); err != nil {
+		return err
+	}
+	_, err := db.Exec(db.Rebind(`DELETE FROM storage_samples WHERE sampled_at < ?`), dbTime(at.Add(-forecastKeep)))
+	return err
+}
+
+// computeStorageForecast forecasts the size from the samples of the lookback
+// ending now (nil without samples)
+func computeStorageForecast(now time.Time) (*StorageForecast, error) {
+	rows, err := db.Query(db.Rebind(`SELECT sampled_at, db_bytes FROM storage_samples
+		WHERE sampled_at >= ? AND sampled_at <= ? ORDER BY sampled_at`), dbTime(now.Add(-forecastLookback)), dbTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var times []time.Time
+	var sizes []float64
+	for rows.Next() {
+		var at time.Time
+		var bytes int64
+		if err := rows.Scan((*scanTime)(&at), &bytes); err != nil {
+			return nil, err
+		}
+		times, sizes = append(times, at), append(sizes, float64(bytes))
+	}
+	if err := rows.Err(); err != nil || len(times) == 0 {
+		return nil, err
+	}
+
+	forecast := &StorageForecast{DatabaseBytes: int64(sizes[len(sizes)-1]), SampledFrom: times[0], Samples: len(times)}
+	if times[len(times)-1].Sub(times[0]) < forecastMinSpan {
+		return forecast, nil
+	}
+
+	// Least squares over (days since the first sample, bytes)
+	var meanX, meanY float64
+	days := make([]float64, len(times))
+	for i, at := range times {
+		days[i] = at.Sub(times[0]).Hours() / 24
+		meanX += days[i] / float64(len(times))
+		meanY += sizes[i] / float64(len(times))
+	}
+	var covariance, variance float64
+	for i := range days {
+		covariance += (days[i] - meanX) * (sizes[i] - meanY)
+		variance += (days[i] - meanX) * (days[i] - meanX)
+	}
+	growth := int64(covariance / variance)
+	in7, in30 := forecast.DatabaseBytes+max(growth, 0)*7, forecast.DatabaseBytes+max(growth, 0)*30
+	forecast.GrowthPerDay, forecast.In7Days, forecast.In30Days = &growth, &in7, &in30
+
+	if healthDataDir != "" {
+		if free, err := freeDiskBytes(healthDataDir); err == nil {
+			freeBytes := int64(free)
+			forecast.FreeDiskBytes = &freeBytes
+			if growth > 0 {
+				runway := roundTo(float64(freeBytes)/float64(growth), 1)
+				forecast.RunwayDays = &runway
+			}
+		}
+	}
+	return forecast, nil
+}
+
+// runwayLow reports whether the forecast's runway is below -disk-runway-days
+func (f *StorageForecast) runwayLow() bool {
+	return f != nil && f.RunwayDays != nil && diskRunwayDays > 0 && *f.RunwayDays < float64(diskRunwayDays)
+}
+
+// checkDiskRunway fires an alert when the runway is low, at most once a day
+func checkDiskRunway(forecast *StorageForecast, now time.Time) {
+	if !forecast.runwayLow() {
+		return
+	}
+	runwayAlerted.Lock()
+	if !runwayAlerted.at.IsZero() && now.Sub(runwayAlerted.at) < 24*time.Hour {
+		runwayAlerted.Unlock()
+		return
+	}
+	runwayAlerted.at = now
+	runwayAlerted.Unlock()
+
+	severity := "warning"
+	if *forecast.RunwayDays < runwayCriticalDays {
+		severity = "critical"
+	}
+	fireAlert(Alert{
+		Rule:     "disk-runway",
+		Kind:     "disk_runway",
+		Severity: severity,
+		Title:    fmt.Sprintf("Disk full in %.1f days", *forecast.RunwayDays),
+		Message: fmt.Sprintf("The database (%s) grows by %s a day; the %s free on its disk last about %.1f days at this rate, below the %d days of -disk-runway-days",
+			formatBytes(forecast.DatabaseBytes), formatBytes(*forecast.GrowthPerDay), formatBytes(*forecast.FreeDiskBytes), *forecast.RunwayDays, diskRunwayDays),
+		Count: 1,
+	})
+}
+
+// sampleStorage records the database size and checks the runway
+func sampleStorage(now time.Time) {
+	if err := recordStorageSample(now, databaseBytes()); err != nil {
+		log.Printf("⚠️  Storage sample error: %v", err)
+		return
+	}
+	forecast, err := computeStorageForecast(now)
+	if err != nil {
+		log.Printf("⚠️  Storage forecast error: %v", err)
+		return
+	}
+	checkDiskRunway(forecast, now)
+}
+
+// startStorageForecast samples the database size every hour
+func startStorageForecast() {
+	go func() {
+		for now := time.Now(); ; now = <-time.After(forecastInterval) {
+			sampleStorage(now.UTC().Truncate(time.Second))
+		}
+	}()
+}
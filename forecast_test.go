@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStorageForecast tests forecasting the database growth and alerting on a short disk runway
+func TestStorageForecast(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	healthDataDir = t.TempDir()
+	defer func() { healthDataDir = ""; runwayAlerted.at = time.Time{} }()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if forecast, err := computeStorageForecast(now); err != nil || forecast != nil {
+		t.Fatalf("Expected no forecast without samples, got %+v, %v", forecast, err)
+	}
+
+	// Two samples an hour apart are too close for a forecast
+	recordStorageSample(now.Add(-time.Hour), 1000)
+	recordStorageSample(now, 2000)
+	forecast, _ := computeStorageForecast(now)
+	if forecast == nil || forecast.DatabaseBytes != 2000 || forecast.GrowthPerDay != nil {
+		t.Fatalf("Expected the size without a forecast, got %+v", forecast)
+	}
+
+	// A petabyte a day fills any disk in well under 14 days
+	recordStorageSample(now.Add(-40*24*time.Hour), 1)
+	recordStorageSample(now.Add(-2*24*time.Hour), 2000-2e15)
+	recordStorageSample(now.Add(-24*time.Hour), 2000-1e15)
+	forecast, err := computeStorageForecast(now)
+	if err != nil || forecast.Samples != 4 || forecast.GrowthPerDay == nil {
+		t.Fatalf("Expected a forecast from the 4 samples of the last week, got %+v, %v", forecast, err)
+	}
+	if growth := *forecast.GrowthPerDay; growth < 9e14 || growth > 11e14 {
+		t.Errorf("Expected a growth of about 1e15 bytes a day, got %d", growth)
+	}
+	if *forecast.In7Days != forecast.DatabaseBytes+*forecast.GrowthPerDay*7 {
+		t.Errorf("Expected the 7-day forecast to add a week of growth, got %d", *forecast.In7Days)
+	}
+	if forecast.RunwayDays == nil || *forecast.RunwayDays > 1 || !forecast.runwayLow() {
+		t.Fatalf("Expected a runway under a day, got %+v", forecast.RunwayDays)
+	}
+
+	checkDiskRunway(forecast, now)
+	checkDiskRunway(forecast, now.Add(time.Hour))
+	alerts, _ := recentAlerts(now.Add(-time.Hour), 10)
+	if len(alerts) != 1 || alerts[0].Kind != "disk_runway" || alerts[0].Severity != "critical" {
+		t.Fatalf("Expected one critical runway alert a day, got %+v", alerts)
+	}
+
+	w := httptest.NewRecorder()
+	handleStats(w, httptest.NewRequest("GET", "/api/stats", nil))
+	var stats struct {
+		Storage *StorageForecast `json:"storage"`
+		Alerts  []string         `json:"alerts"`
+	}
+	json.NewDecoder(w.Body).Decode(&stats)
+	if stats.Storage == nil || stats.Storage.RunwayDays == nil {
+		t.Errorf("Expected the forecast in /api/stats, got %+v", stats.Storage)
+	}
+	if len(stats.Alerts) == 0 || !strings.HasPrefix(stats.Alerts[0], "Disk full in about ") {
+		t.Errorf("Expected a runway banner, got %v", stats.Alerts)
+	}
+
+	// Old samples are dropped
+	var kept int
+	db.QueryRow("SELECT COUNT(*) FROM storage_samples").Scan(&kept)
+	if kept != 4 {
+		t.Errorf("Expected the 40-day-old sample to be dropped, got %d samples", kept)
+	}
+}
@@ -3,3 +3,5 @@ module github.com/mendexio/CubicLog
 go 1.21
 
 require github.com/mattn/go-sqlite3 v1.14.18
+
+require github.com/lib/pq v1.10.9
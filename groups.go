@@ -0,0 +1,283 @@
+// CubicLog Error Groups - One row per kind of error, not per occurrence
+//
+// Every error or critical log is fingerprinted: its source plus its title with
+// the variable parts (UUIDs, hex ids, numbers, quoted values) replaced, so
+// "Order 4711 failed" and "Order 4712 failed" from the same service end up in
+// the same group. Groups keep a count, first/last seen, the release they first
+// appeared in (see releases.go) and the latest log.
+//
+//   - GET /api/groups              groups seen in the last 7 days (?since=24h&limit=50)
+//   - GET /api/groups?new=24h      groups first seen in the last 24 hours (see newerrors.go)
+//   - GET /api/groups/{id}         one group
+//   - POST /api/groups/{id}/issue  open or update a bug tracker issue (see issues.go)
+//
+// Groups outlive the logs they were built from, so a known error stays known
+// after retention removed its logs.
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorGroup is a set of error logs sharing a fingerprint
+type ErrorGroup struct {
+	ID           int64     `json:"id"`
+	Fingerprint  string    `json:"fingerprint"`
+	Source       string    `json:"source"`
+	Title        string    `json:"title"` // title of the first log
+	Severity     string    `json:"severity"`
+	Count        int       `json:"count"`
+	FirstSeen    time.Time `json:"first_seen"`
+	FirstRelease string    `json:"first_release,omitempty"` // release of the first log
+	LastSeen     time.Time `json:"last_seen"`
+	LastLogID    int64     `json:"last_log_id,omitempty"`
+
+	// Distinct users named by the group's logs (see userimpact.go)
+	Users         int `json:"users"`
+	UsersLastHour int `json:"users_last_hour"`
+	UsersLastDay  int `json:"users_last_day"`
+
+	IssueURL    string `json:"issue_url,omitempty"`
+	IssueKey    string `json:"issue_key,omitempty"` // number or key in the tracker
+	IssueStatus string `json:"issue_status,omitempty"`
+}
+
+// groupedSeverities are the derived severities that get grouped
+var groupedSeverities = []string{"error", "critical"}
+
+// Variable parts of titles, most specific first
+var fingerprintPatterns = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*[0-9][0-9a-f]*[a-f][0-9a-f]*\b|\b[0-9a-f]*[a-f][0-9a-f]*[0-9][0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`\d+(\.\d+)*`), "<n>"},
+}
+
+// createGroupsTable creates the error group table
+func createGroupsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS error_groups (
+		id           ` + alertIDColumn() + `,
+		fingerprint  TEXT NOT NULL UNIQUE,
+		source       TEXT NOT NULL,
+		title        TEXT NOT NULL,
+		severity     TEXT NOT NULL,
+		count        INTEGER NOT NULL DEFAULT 0,
+		first_seen   TIMESTAMP NOT NULL,
+		last_seen    TIMESTAMP NOT NULL,
+		last_log_id  BIGINT,
+		issue_url    TEXT,
+		issue_key    TEXT,
+		issue_status TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_error_groups_last_seen ON error_groups(last_seen);
+	`)
+	return err
+}
+
+// normalizeTitle replaces the variable parts of a title
+func normalizeTitle(title string) string {
+	normalized := strings.ToLower(strings.TrimSpace(title))
+	for _, p := range fingerprintPatterns {
+		normalized = p.pattern.ReplaceAllString(normalized, p.placeholder)
+	}
+	return strings.Join(strings.Fields(normalized), " ")
+}
+
+// errorFingerprint identifies the group of a log
+func errorFingerprint(source, title string) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + normalizeTitle(title)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// recordErrorGroup counts an error log and the user it names (see
+// userimpact.go) towards its group (logID 0 for spooled logs)
+func recordErrorGroup(logID int64, header LogHeader, body map[string]interface{}, metadata LogMetadata) {
+	if !containsString(groupedSeverities, metadata.DerivedSeverity) {
+		return
+	}
+	now := dbTime(time.Now())
+	fingerprint := errorFingerprint(metadata.DerivedSource, header.Title)
+	if user := bodyUser(body); user != "" {
+		defer recordGroupUser(fingerprint, user)
+	}
+	var lastLogID interface{}
+	if logID > 0 {
+		lastLogID = logID
+	}
+
+	result, err := db.Exec(db.Rebind(`UPDATE error_groups SET count = count + 1, last_seen = ?,
+		last_log_id = COALESCE(CAST(? AS BIGINT), last_log_id) WHERE fingerprint = ?`), now, lastLogID, fingerprint)
+	if err == nil {
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			return
+		}
+	}
+	id, err := db.InsertID(`INSERT INTO error_groups (fingerprint, source, title, severity, count, first_seen, last_seen, last_log_id, first_release)
+		VALUES (?, ?, ?, ?, 1, ?, ?, ?, NULLIF(?, ''))`, fingerprint, metadata.DerivedSource, header.Title, metadata.DerivedSeverity, now, now, lastLogID, header.Release)
+	if err == nil {
+		seen := time.Now()
+		announceNewErrorGroup(ErrorGroup{ID: id, Fingerprint: fingerprint, Source: metadata.DerivedSource, Title: header.Title,
+			Severity: metadata.DerivedSeverity, Count: 1, FirstSeen: seen, FirstRelease: header.Release, LastSeen: seen, LastLogID: logID})
+	}
+}
+
+// errorGroupColumns are selected by loadErrorGroups and scanErrorGroup
+const errorGroupColumns = `id, fingerprint, source, title, severity, count, first_seen, last_seen, COALESCE(last_log_id, 0),
+	COALESCE(issue_url, ''), COALESCE(issue_key, ''), COALESCE(issue_status, ''), COALESCE(first_release, '')`
+
+// scanErrorGroup reads one row selected with errorGroupColumns
+func scanErrorGroup(scan func(...interface{}) error) (ErrorGroup, error) {
+	var g ErrorGroup
+	err := scan(&g.ID, &g.Fingerprint, &g.Source, &g.Title, &g.Severity, &g.Count, (*scanTime)(&g.FirstSeen),
+		(*scanTime)(&g.LastSeen), &g.LastLogID, &g.IssueURL, &g.IssueKey, &g.IssueStatus, &g.FirstRelease)
+	return g, err
+}
+
+// loadErrorGroups returns the groups seen since a point in time, most frequent first
+func loadErrorGroups(since time.Time, limit int) ([]ErrorGroup, error) {
+	return queryErrorGroups("last_seen >= ? ORDER BY count DESC, last_seen DESC", dbTime(since), limit)
+}
+
+// loadNewErrorGroups returns the groups first seen since a point in time, newest first
+func loadNewErrorGroups(since time.Time, limit int) ([]ErrorGroup, error) {
+	return queryErrorGroups("first_seen >= ? ORDER BY first_seen DESC, id DESC", dbTime(since), limit)
+}
+
+// queryErrorGroups returns the groups matching a condition and order, up to limit
+func queryErrorGroups(where string, since interface{}, limit int) ([]ErrorGroup, error) {
+	rows, err := db.Query(db.Rebind(`SELECT `+errorGroupColumns+` FROM error_groups WHERE `+where+` LIMIT ?`), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []ErrorGroup{}
+	for rows.Next() {
+		g, err := scanErrorGroup(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return withUserImpact(groups), nil
+}
+
+// loadErrorGroup returns one group (sql.ErrNoRows when unknown)
+func loadErrorGroup(id int64) (ErrorGroup, error) {
+	g, err := scanErrorGroup(db.QueryRow(db.Rebind(`SELECT `+errorGroupColumns+` FROM error_groups WHERE id = ?`), id).Scan)
+	if err != nil {
+		return g, err
+	}
+	return withUserImpact([]ErrorGroup{g})[0], nil
+}
+
+// handleErrorGroups answers GET /api/groups?since=168h&limit=50 (or ?new=24h, see newerrors.go)
+func handleErrorGroups(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	since, load := 7*24*time.Hour, loadErrorGroups
+	if value := params.Get("new"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "new must be a duration like 24h or 168h", http.StatusBadRequest)
+			return
+		}
+		since, load = parsed, loadNewErrorGroups
+	} else if value := params.Get("since"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "since must be a duration like 24h or 168h", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	limit := 50
+	if value := params.Get("limit"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	groups, err := load(time.Now().Add(-since), limit)
+	if err != nil {
+		http.Error(w, "Failed to load error groups", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"groups": groups})
+}
+
+// handleErrorGroup answers GET /api/groups/{id} and POST /api/groups/{id}/issue
+func handleErrorGroup(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/groups/")
+	idPart, action, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		group, err := loadErrorGroup(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Error group not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load error group", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(group)
+	case action == "issue" && r.Method == http.MethodPost:
+		handleGroupIssue(w, r, id)
+	case action == "" || action == "issue":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// errorGroupSummary is a group as shown in /api/stats
+type errorGroupSummary struct {
+	ID           int64  `json:"id"`
+	Source       string `json:"source"`
+	Title        string `json:"title"`
+	Count        int    `json:"count"`
+	FirstRelease string `json:"first_release,omitempty"`
+	Users        int    `json:"users,omitempty"` // affected in the last 24 hours
+	LastLogID    int64  `json:"last_log_id,omitempty"`
+	IssueURL     string `json:"issue_url,omitempty"`
+	IssueKey     string `json:"issue_key,omitempty"`
+	IssueStatus  string `json:"issue_status,omitempty"`
+}
+
+// errorGroupSummaries lists the most frequent groups of the last 24 hours for the dashboard
+func errorGroupSummaries() []errorGroupSummary {
+	summaries := []errorGroupSummary{}
+	groups, err := loadErrorGroups(time.Now().Add(-24*time.Hour), 5)
+	if err != nil {
+		return summaries
+	}
+	for _, g := range groups {
+		summaries = append(summaries, errorGroupSummary{ID: g.ID, Source: g.Source, Title: g.Title, Count: g.Count, FirstRelease: g.FirstRelease, Users: g.UsersLastDay, LastLogID: g.LastLogID,
+			IssueURL: g.IssueURL, IssueKey: g.IssueKey, IssueStatus: g.IssueStatus})
+	}
+	return summaries
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestErrorGroupIssues tests grouping errors and linking a group to a GitHub issue
+func TestErrorGroupIssues(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var comments int
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/repos/acme/shop/issues":
+			var issue map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&issue)
+			if !strings.Contains(issue["title"].(string), "[payments] Order 4711 failed") {
+				t.Errorf("Unexpected issue title: %v", issue["title"])
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 42, "html_url": "https://github.com/acme/shop/issues/42"}`))
+		case r.Method == "POST" && r.URL.Path == "/repos/acme/shop/issues/42/comments":
+			comments++
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "GET" && r.URL.Path == "/repos/acme/shop/issues/42":
+			w.Write([]byte(`{"state": "closed"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer github.Close()
+	defer func() { issueTracker = nil }()
+
+	for _, title := range []string{"Order 4711 failed", "Order 4712 failed", "Order 99 failed", "Checkout crashed"} {
+		body := `{"header":{"type":"error","title":"` + title + `","source":"payments"}}`
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs",
+		strings.NewReader(`{"header":{"type":"info","title":"Order 1 shipped","source":"payments"}}`)))
+
+	w := httptest.NewRecorder()
+	handleErrorGroups(w, httptest.NewRequest("GET", "/api/groups", nil))
+	var listed struct {
+		Groups []ErrorGroup `json:"groups"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Groups) != 2 || listed.Groups[0].Count != 3 || listed.Groups[0].Title != "Order 4711 failed" {
+		t.Fatalf("Expected 2 groups with the order failures counted 3 times, got %+v", listed.Groups)
+	}
+	group := listed.Groups[0]
+
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleErrorGroup(w, httptest.NewRequest("POST", fmt.Sprintf("/api/groups/%d/issue", group.ID), nil))
+		return w
+	}
+	if w := post(); w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without a tracker, got %d", w.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "tracker.json")
+	os.WriteFile(path, []byte(`{"provider": "github", "url": "`+github.URL+`", "repo": "acme/shop", "token": "gh-token"}`), 0644)
+	if err := loadIssueTracker(path); err != nil {
+		t.Fatalf("Failed to load tracker: %v", err)
+	}
+
+	if w := post(); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the issue to be created, got %d: %s", w.Code, w.Body.String())
+	}
+	linked, _ := loadErrorGroup(group.ID)
+	if linked.IssueURL != "https://github.com/acme/shop/issues/42" || linked.IssueStatus != "open" {
+		t.Errorf("Expected the issue linked on the group, got %+v", linked)
+	}
+
+	// Posting again comments and picks up the closed state
+	if w := post(); w.Code != http.StatusOK || comments != 1 {
+		t.Errorf("Expected a comment, got %d (%d comments)", w.Code, comments)
+	}
+	if linked, _ = loadErrorGroup(group.ID); linked.IssueStatus != "closed" {
+		t.Errorf("Expected status closed, got %s", linked.IssueStatus)
+	}
+
+	w = httptest.NewRecorder()
+	handleErrorGroup(w, httptest.NewRequest("GET", "/api/groups/999", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown group, got %d", w.Code)
+	}
+}
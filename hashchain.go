@@ -0,0 +1,424 @@
+// CubicLog Hash Chain - Prove log history hasn't been altered after ingestion
+//
+// With -hash-chain every stored log gets an entry in the log_chain table:
+//   - content_hash  SHA-256 of the log as stored (id, timestamp, type, title,
+//     description, source, color, body)
+//   - hash          SHA-256 of the previous entry's hash + content_hash
+//
+// Changing, inserting or deleting a log (or a chain entry) breaks the chain
+// from that point on. Deleting the newest entries leaves a shorter chain that
+// still links up, so the head (id and hash) and the number of entries are also
+// kept in log_chain_head and compared, and with -partition every archived log
+// must still be in its monthly file. Check it with:
+//   - GET /api/chain/verify   JSON report with a signed checkpoint of the head
+//   - cubiclog -verify-chain  prints the report, exits 1 when it fails
+//
+// Keep the signed checkpoints somewhere else (ticket, mail, object storage):
+// someone with write access to the database could rebuild the whole chain, but
+// not one that still ends in a checkpoint you recorded earlier.
+//
+// Expected removals are reported, not failed: retention prunes the start of
+// the chain together with the logs, rollups and deletions show up as removed,
+// privacy erasures as erased (with the erasure report id), and with
+// -partition logs moved into monthly files as archived. Only one CubicLog
+// process should write to a chained database.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hashChainEnabled is the -hash-chain setting - configured once in main()
+var hashChainEnabled bool
+
+// chainGenesis is the previous hash of the very first entry
+var chainGenesis = strings.Repeat("0", 64)
+
+// maxChainReportIDs caps the log ids listed per problem in a report
+const maxChainReportIDs = 100
+
+// chain serializes appends and caches the current head hash
+var chain struct {
+	sync.Mutex
+	head string // "" until loaded from log_chain
+}
+
+// createChainTable creates the hash chain table and the record of its head
+func createChainTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS log_chain (
+		log_id       BIGINT PRIMARY KEY,
+		logged_at    TIMESTAMP NOT NULL,
+		prev_hash    TEXT NOT NULL,
+		content_hash TEXT NOT NULL,
+		hash         TEXT NOT NULL,
+		erased_by    TEXT             -- erasure report id when a privacy erasure changed the log
+	);
+	CREATE INDEX IF NOT EXISTS idx_log_chain_logged_at ON log_chain(logged_at);
+	CREATE TABLE IF NOT EXISTS log_chain_head (
+		id        INTEGER PRIMARY KEY CHECK (id = 1),
+		head_id   BIGINT NOT NULL,
+		head_hash TEXT NOT NULL,
+		entries   BIGINT NOT NULL
+	);
+	`)
+	return err
+}
+
+// chainContentHash hashes a log exactly as stored
+func chainContentHash(id int64, timestamp time.Time, logType, title, description, source, color, body string) string {
+	encoded, _ := json.Marshal([]interface{}{
+		id, timestamp.UTC().Format(time.RFC3339), logType, title, description, source, color, body,
+	})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainLink combines the previous hash with an entry's content hash
+func chainLink(prevHash, contentHash string) string {
+	sum := sha256.Sum256([]byte(prevHash + contentHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// insertChainedLog stores a log and its chain entry in one transaction
+func insertChainedLog(row storedLog) (int64, error) {
+	chain.Lock()
+	defer chain.Unlock()
+
+	if chain.head == "" {
+		var head sql.NullString
+		if err := db.QueryRow("SELECT hash FROM log_chain ORDER BY log_id DESC LIMIT 1").Scan(&head); err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		chain.head = chainGenesis
+		if head.Valid {
+			chain.head = head.String
+		}
+		// Chains started before the head was recorded take it from here
+		if _, err := db.Exec(db.Rebind(`
+			INSERT INTO log_chain_head (id, head_id, head_hash, entries)
+			SELECT 1, COALESCE(MAX(log_id), 0), ?, COUNT(*) FROM log_chain
+			WHERE NOT EXISTS (SELECT 1 FROM log_chain_head)`), chain.head); err != nil {
+			return 0, err
+		}
+	}
+
+	// Whole seconds in UTC so the timestamp reads back exactly as hashed
+	timestamp := row.Timestamp.UTC().Truncate(time.Second)
+	if row.Timestamp.IsZero() {
+		timestamp = time.Now().UTC().Truncate(time.Second)
+	}
+	var stored interface{} = timestamp
+	if db.Driver() == "sqlite3" {
+		stored = timestamp.Format("2006-01-02 15:04:05")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	insert := db.Rebind(`
+		INSERT INTO logs (type, title, description, source, color, body, derived_severity, derived_source, derived_category, environment, derived_language, release, derived_duration_ms, derived_http_status, timestamp)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, 0), ?)`)
+	args := []interface{}{row.Type, row.Title, row.Description, row.Source, row.Color, row.Body,
+		row.DerivedSeverity, row.DerivedSource, row.DerivedCategory, row.Environment, row.DerivedLanguage, row.Release, row.DerivedDurationMs, row.DerivedHTTPStatus, stored}
+	var id int64
+	if db.Driver() == "postgres" {
+		err = tx.QueryRow(insert+" RETURNING id", args...).Scan(&id)
+	} else {
+		var result sql.Result
+		if result, err = tx.Exec(insert, args...); err == nil {
+			id, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	contentHash := chainContentHash(id, timestamp, row.Type, row.Title, row.Description, row.Source, row.Color, row.Body)
+	hash := chainLink(chain.head, contentHash)
+	if _, err := tx.Exec(db.Rebind("INSERT INTO log_chain (log_id, logged_at, prev_hash, content_hash, hash) VALUES (?, ?, ?, ?, ?)"),
+		id, stored, chain.head, contentHash, hash); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(db.Rebind("UPDATE log_chain_head SET head_id = ?, head_hash = ?, entries = entries + 1 WHERE id = 1"), id, hash); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	chain.head = hash
+	return id, nil
+}
+
+// pruneChain drops chain entries older than the retention cutoff and takes
+// them off the recorded entry count
+func pruneChain(cutoff time.Time) {
+	var value interface{} = cutoff
+	if db.Driver() == "sqlite3" {
+		value = cutoff.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	chain.Lock()
+	defer chain.Unlock()
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(db.Rebind("DELETE FROM log_chain WHERE logged_at < ?"), value)
+	if err != nil {
+		return
+	}
+	if pruned, _ := result.RowsAffected(); pruned > 0 {
+		if _, err := tx.Exec(db.Rebind("UPDATE log_chain_head SET entries = entries - ? WHERE id = 1"), pruned); err != nil {
+			return
+		}
+	}
+	tx.Commit()
+}
+
+// recordedChainHead returns the head and entry count kept in log_chain_head
+// (nil for chains started before it was recorded and not appended to since)
+func recordedChainHead() (*chainCheckpoint, error) {
+	chain.Lock()
+	defer chain.Unlock()
+
+	var head chainCheckpoint
+	err := db.QueryRow("SELECT head_id, head_hash, entries FROM log_chain_head WHERE id = 1").Scan(&head.HeadID, &head.HeadHash, &head.Entries)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// chainCheckpoint identifies the head of the chain at verification time
+type chainCheckpoint struct {
+	HeadID     int64  `json:"head_id"`
+	HeadHash   string `json:"head_hash"`
+	Entries    int64  `json:"entries"`
+	VerifiedAt string `json:"verified_at,omitempty"`
+}
+
+// chainReport is the result of a verification run
+type chainReport struct {
+	Enabled    bool             `json:"enabled"`
+	Valid      bool             `json:"valid"`
+	Checked    int64            `json:"checked"`
+	Altered    []int64          `json:"altered"`          // content no longer matches its hash
+	Broken     []int64          `json:"broken_links"`     // entries whose links don't add up
+	Unchained  int64            `json:"unchained"`        // logs stored after chaining began without an entry
+	Removed    []int64          `json:"removed"`          // logs gone without an erasure (retention rollups, manual deletes)
+	Erased     map[string]int   `json:"erased"`           // logs changed or deleted per erasure report
+	Archived   int64            `json:"archived"`         // logs moved into monthly partition files
+	Missing    int64            `json:"missing_archived"` // archived logs no longer in their partition file
+	Truncated  bool             `json:"truncated"`        // head or entry count doesn't match the recorded head
+	Recorded   *chainCheckpoint `json:"recorded_head,omitempty"`
+	Checkpoint chainCheckpoint  `json:"checkpoint"`
+	Signature  string           `json:"signature,omitempty"`
+}
+
+// appendID records a log id, keeping reports bounded
+func appendID(ids []int64, id int64) []int64 {
+	if len(ids) < maxChainReportIDs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// verifyChain walks the whole chain and recomputes every hash
+func verifyChain(ctx context.Context) (chainReport, error) {
+	report := chainReport{Enabled: hashChainEnabled, Altered: []int64{}, Broken: []int64{}, Removed: []int64{}, Erased: map[string]int{}}
+	monthStart := time.Now().UTC().Format("2006-01")
+
+	// Read the recorded head first; entries appended while verifying come after it
+	recorded, err := recordedChainHead()
+	if err != nil {
+		return report, err
+	}
+	report.Recorded = recorded
+	query, args := `
+		SELECT c.log_id, c.logged_at, c.prev_hash, c.content_hash, c.hash, COALESCE(c.erased_by, ''),
+		       l.id, l.timestamp, l.type, l.title, COALESCE(l.description, ''), COALESCE(l.source, ''), l.color, l.body
+		FROM log_chain c LEFT JOIN logs l ON l.id = c.log_id`, []interface{}{}
+	if recorded != nil {
+		query += " WHERE c.log_id <= ?"
+		args = append(args, recorded.HeadID)
+	}
+	rows, err := db.Query(db.Rebind(query+" ORDER BY c.log_id"), args...)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	var altered, broken int64
+	previous, first := "", int64(0)
+	archivedMonths := map[string]int64{}
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		var logID int64
+		var loggedAt, timestamp time.Time
+		var prevHash, contentHash, hash, erasedBy string
+		var rowID sql.NullInt64
+		var logType, title, color, body sql.NullString
+		var description, source string
+		if err := rows.Scan(&logID, (*scanTime)(&loggedAt), &prevHash, &contentHash, &hash, &erasedBy,
+			&rowID, (*scanTime)(&timestamp), &logType, &title, &description, &source, &color, &body); err != nil {
+			return report, err
+		}
+		report.Checked++
+		if first == 0 {
+			first = logID
+		}
+
+		// The first remaining entry anchors the chain (older ones expired)
+		if (previous != "" && prevHash != previous) || chainLink(prevHash, contentHash) != hash {
+			broken++
+			report.Broken = appendID(report.Broken, logID)
+		}
+		previous = hash
+		report.Checkpoint.HeadID, report.Checkpoint.HeadHash = logID, hash
+
+		switch {
+		case !rowID.Valid && erasedBy != "":
+			report.Erased[erasedBy]++
+		case !rowID.Valid && partitionMode && loggedAt.UTC().Format("2006-01") < monthStart:
+			report.Archived++
+			archivedMonths[loggedAt.UTC().Format("2006-01")]++
+		case !rowID.Valid:
+			report.Removed = appendID(report.Removed, logID)
+		case chainContentHash(logID, timestamp, logType.String, title.String, description, source, color.String, body.String) != contentHash:
+			if erasedBy != "" {
+				report.Erased[erasedBy]++
+			} else {
+				altered++
+				report.Altered = appendID(report.Altered, logID)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	rows.Close()
+
+	// Deleting the newest entries leaves a chain that still links up
+	if recorded != nil && (report.Checked > 0 || recorded.Entries > 0) && (report.Checkpoint.HeadID != recorded.HeadID || report.Checkpoint.HeadHash != recorded.HeadHash || report.Checked != recorded.Entries) {
+		report.Truncated = true
+	}
+	for month, archived := range archivedMonths {
+		found, err := countArchivedLogs(ctx, month)
+		if err != nil {
+			return report, err
+		}
+		if found < archived {
+			report.Missing += archived - found
+		}
+	}
+
+	if first > 0 {
+		db.QueryRow(db.Rebind("SELECT COUNT(*) FROM logs WHERE id >= ? AND id NOT IN (SELECT log_id FROM log_chain)"), first).Scan(&report.Unchained)
+	}
+	report.Valid = altered == 0 && broken == 0 && report.Unchained == 0 && !report.Truncated && report.Missing == 0
+	report.Checkpoint.Entries = report.Checked
+	report.Checkpoint.VerifiedAt = time.Now().UTC().Format(time.RFC3339)
+
+	// Sign the checkpoint so it can be kept as an external anchor
+	if report.Checkpoint.HeadHash != "" {
+		payload, _ := json.Marshal(report.Checkpoint)
+		report.Signature, _ = signPayload(payload)
+	}
+	return report, nil
+}
+
+// countArchivedLogs counts the chained logs of a month found in its partition
+// file (0 when the file is gone)
+func countArchivedLogs(ctx context.Context, month string) (int64, error) {
+	if _, err := os.Stat(partitionPath(month)); err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS archived", partitionPath(month)); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE archived")
+
+	var found int64
+	err = conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM archived.logs WHERE id IN (
+			SELECT log_id FROM main.log_chain WHERE erased_by IS NULL AND substr(CAST(logged_at AS TEXT), 1, 7) = ?)`, month).Scan(&found)
+	return found, err
+}
+
+// handleChainVerify answers GET /api/chain/verify
+func handleChainVerify(w http.ResponseWriter, r *http.Request) {
+	report, err := verifyChain(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to verify hash chain", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleVerifyChain implements the -verify-chain command
+func handleVerifyChain() {
+	report, err := verifyChain(context.Background())
+	if err != nil {
+		fmt.Printf("❌ Hash chain verification failed: %v\n", err)
+		os.Exit(1)
+	}
+	if report.Checked == 0 && report.Valid {
+		fmt.Printf("ℹ️  No chained logs yet - start the server with -hash-chain to begin chaining\n")
+		return
+	}
+
+	fmt.Printf("🔗 Checked %d chain entries (head #%d %s)\n", report.Checked, report.Checkpoint.HeadID, report.Checkpoint.HeadHash)
+	fmt.Printf("   altered: %d  broken links: %d  unchained: %d\n", len(report.Altered), len(report.Broken), report.Unchained)
+	fmt.Printf("   removed: %d  archived: %d  erased: %d reports\n", len(report.Removed), report.Archived, len(report.Erased))
+	if report.Recorded != nil {
+		fmt.Printf("   recorded head: #%d %s (%d entries)\n", report.Recorded.HeadID, report.Recorded.HeadHash, report.Recorded.Entries)
+	}
+	if report.Signature != "" {
+		fmt.Printf("   checkpoint signature: %s\n", report.Signature)
+	}
+	if !report.Valid {
+		if len(report.Altered) > 0 {
+			fmt.Printf("❌ Altered logs: %v\n", report.Altered)
+		}
+		if len(report.Broken) > 0 {
+			fmt.Printf("❌ Broken links at: %v\n", report.Broken)
+		}
+		if report.Truncated {
+			fmt.Printf("❌ Chain doesn't end at the recorded head: newest entries were deleted\n")
+		}
+		if report.Missing > 0 {
+			fmt.Printf("❌ Archived logs missing from their partition files: %d\n", report.Missing)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Hash chain intact\n")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHashChain tests that chained logs verify and that tampering is detected
+func TestHashChain(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	hashChainEnabled = true
+	defer func() { hashChainEnabled = false; chain.head = "" }()
+	chain.head = ""
+	configureSigning("", ":memory:", "sqlite3")
+
+	for _, title := range []string{"Deploy started", "Payment failed for jane@example.com", "Deploy finished", "Cache warmed"} {
+		body := `{"header":{"type":"info","title":"` + title + `","description":"details"},"body":{"step":1}}`
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	report, err := verifyChain(context.Background())
+	if err != nil || !report.Valid || report.Checked != 4 || report.Signature == "" {
+		t.Fatalf("Expected 4 valid signed entries, got %+v (%v)", report, err)
+	}
+
+	// Erasures are reported separately, not as tampering
+	w := httptest.NewRecorder()
+	handlePrivacyErase(w, httptest.NewRequest("POST", "/api/privacy/erase", strings.NewReader(`{"subject":"jane@example.com","mode":"redact"}`)))
+	if report, _ = verifyChain(context.Background()); !report.Valid || len(report.Erased) != 1 {
+		t.Errorf("Expected an erased entry and a valid chain, got %+v", report)
+	}
+
+	// Editing a log after ingestion is detected
+	db.Exec("UPDATE logs SET title = 'Deploy finished (edited)' WHERE title = 'Deploy finished'")
+	if report, _ = verifyChain(context.Background()); report.Valid || len(report.Altered) != 1 || report.Altered[0] != 3 {
+		t.Errorf("Expected log 3 to be reported as altered, got %+v", report)
+	}
+
+	// So is removing a chain entry from the middle
+	db.Exec("UPDATE logs SET title = 'Deploy finished' WHERE id = 3")
+	db.Exec("DELETE FROM log_chain WHERE log_id = 2")
+	if report, _ = verifyChain(context.Background()); report.Valid || len(report.Broken) != 1 || report.Unchained != 1 {
+		t.Errorf("Expected a broken link and an unchained log, got %+v", report)
+	}
+}
+
+// TestHashChainTruncation tests that deleting the newest logs and their entries is detected
+func TestHashChainTruncation(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	hashChainEnabled = true
+	defer func() { hashChainEnabled = false; chain.head = "" }()
+	chain.head = ""
+	configureSigning("", ":memory:", "sqlite3")
+
+	send := func(titles ...string) {
+		for _, title := range titles {
+			body := `{"header":{"type":"info","title":"` + title + `"}}`
+			createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		}
+	}
+	send("Deploy started", "Deploy finished")
+
+	// Retention pruning is taken off the recorded entry count
+	db.Exec("DELETE FROM logs")
+	pruneChain(time.Now().Add(time.Hour))
+	if report, err := verifyChain(context.Background()); err != nil || !report.Valid || report.Checked != 0 {
+		t.Fatalf("Expected a fully pruned chain to verify, got %+v (%v)", report, err)
+	}
+
+	send("Deploy started", "Deploy finished", "Cache warmed")
+	if report, err := verifyChain(context.Background()); err != nil || !report.Valid || report.Recorded == nil || report.Recorded.Entries != 3 {
+		t.Fatalf("Expected a valid chain with a recorded head of 3 entries, got %+v (%v)", report, err)
+	}
+
+	// The remaining chain still links up, but no longer ends at the recorded head
+	db.Exec("DELETE FROM logs WHERE title = 'Cache warmed'")
+	db.Exec("DELETE FROM log_chain WHERE log_id = (SELECT MAX(log_id) FROM log_chain)")
+	if report, _ := verifyChain(context.Background()); report.Valid || !report.Truncated || len(report.Broken) != 0 {
+		t.Errorf("Expected a truncated chain, got %+v", report)
+	}
+}
+
+// TestHashChainMissingPartition tests that a deleted partition file is reported, not counted as archived
+func TestHashChainMissingPartition(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+
+	originalDB := db
+	var err error
+	db, err = openStore("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() {
+		db.Close()
+		db = originalDB
+		partitionMode, hashChainEnabled, chain.head = false, false, ""
+	}()
+	if err := createTable(); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := enablePartitioning("monthly", dbPath); err != nil {
+		t.Fatalf("Failed to enable partitioning: %v", err)
+	}
+	hashChainEnabled, chain.head = true, ""
+	configureSigning("", ":memory:", "sqlite3")
+
+	for _, at := range []time.Time{time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), time.Now()} {
+		if _, err := insertChainedLog(storedLog{Type: "info", Title: "entry", Color: "blue", Body: "{}", Timestamp: at}); err != nil {
+			t.Fatalf("Failed to insert chained log: %v", err)
+		}
+	}
+	if err := rollOverPartitions(); err != nil {
+		t.Fatalf("Rollover failed: %v", err)
+	}
+	if report, err := verifyChain(context.Background()); err != nil || !report.Valid || report.Archived != 1 {
+		t.Fatalf("Expected a valid chain with 1 archived log, got %+v (%v)", report, err)
+	}
+
+	os.Remove(partitionPath("2024-01"))
+	if report, _ := verifyChain(context.Background()); report.Valid || report.Missing != 1 {
+		t.Errorf("Expected the archived log to be missing, got %+v", report)
+	}
+}
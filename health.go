@@ -0,0 +1,185 @@
+// CubicLog Health Probes - Liveness, readiness and diagnostics
+//
+//   - GET /healthz  the process is up and serving HTTP (always 200)
+//   - GET /readyz   CubicLog can store logs right now: the database answers and
+//     accepts writes, free disk space is above -min-free-disk and the
+//     in-memory write queue is not full. 200 when ready, 503 otherwise, with
+//     the result of every check. With -read-only the write checks are
+//     reported as skipped.
+//   - GET /readyz?verbose=1  adds details for monitoring: database and WAL
+//     file sizes, free disk space, the last retention cleanup, spooled logs,
+//     the ingestion lag (age of the oldest log waiting to be stored), the
+//     recovery of a corrupt database at startup, if any (see recovery.go), and
+//     encrypted values that could not be decrypted (see encryption.go)
+//
+// GET /health is kept unchanged for existing monitors.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Health settings - configured once in main()
+var (
+	healthDBPath  string // SQLite database file, for size reporting
+	healthDataDir string // directory checked for free disk space
+	startedAt     = time.Now()
+)
+
+// lastCleanup remembers the most recent retention cleanup
+var lastCleanup struct {
+	sync.Mutex
+	at      time.Time
+	deleted int64
+}
+
+// recordCleanup stores the outcome of a retention cleanup run
+func recordCleanup(deleted int64) {
+	lastCleanup.Lock()
+	defer lastCleanup.Unlock()
+	lastCleanup.at = time.Now()
+	lastCleanup.deleted = deleted
+}
+
+// healthCheck is the result of one readiness check
+type healthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// handleLiveness answers /healthz
+func handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadiness answers /readyz
+func handleReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := readinessChecks()
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+
+	response := map[string]interface{}{"status": "ready", "checks": checks}
+	if !ready {
+		response["status"] = "not ready"
+	}
+	if verbose := r.URL.Query().Get("verbose"); verbose != "" && verbose != "0" && verbose != "false" {
+		response["details"] = healthDetails()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// readinessChecks runs every readiness check
+func readinessChecks() map[string]healthCheck {
+	checks := map[string]healthCheck{}
+
+	if err := db.Ping(); err != nil {
+		checks["database"] = healthCheck{Detail: err.Error()}
+	} else {
+		checks["database"] = healthCheck{OK: true}
+	}
+
+	// A -read-only instance never writes, and its database refuses writes
+	if readOnlyMode {
+		skipped := healthCheck{OK: true, Detail: "skipped: read-only mode"}
+		checks["writable"], checks["write_queue"] = skipped, skipped
+	} else if open, reason, _ := breaker.status(); open {
+		checks["writable"] = healthCheck{Detail: "writes suspended: " + reason}
+	} else if err := probeWritable(); err != nil {
+		checks["writable"] = healthCheck{Detail: err.Error()}
+	} else {
+		checks["writable"] = healthCheck{OK: true}
+	}
+
+	if healthDataDir != "" && minFreeDiskMB > 0 {
+		if free, err := freeDiskBytes(healthDataDir); err != nil {
+			checks["disk"] = healthCheck{Detail: err.Error()}
+		} else if freeMB := int64(free / 1024 / 1024); freeMB < minFreeDiskMB {
+			checks["disk"] = healthCheck{Detail: fmt.Sprintf("only %d MB free", freeMB)}
+		} else {
+			checks["disk"] = healthCheck{OK: true, Detail: fmt.Sprintf("%d MB free", freeMB)}
+		}
+	}
+
+	if !readOnlyMode {
+		breaker.mu.Lock()
+		buffered := len(breaker.memory)
+		breaker.mu.Unlock()
+		if buffered >= spoolMemoryLimit {
+			checks["write_queue"] = healthCheck{Detail: "memory buffer full"}
+		} else {
+			checks["write_queue"] = healthCheck{OK: true}
+		}
+	}
+	return checks
+}
+
+// probeWritable starts a write that touches no rows and rolls it back, which
+// fails on read-only files, locked databases and read-only replicas
+func probeWritable() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM logs WHERE id < 0")
+	return err
+}
+
+// healthDetails collects the verbose diagnostics
+func healthDetails() map[string]interface{} {
+	details := map[string]interface{}{
+		"version":        VERSION,
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+	}
+
+	if db.Driver() == "sqlite3" && healthDBPath != "" && !isMemoryDSN(healthDBPath) {
+		if info, err := os.Stat(healthDBPath); err == nil {
+			details["db_bytes"] = info.Size()
+		}
+		details["wal_bytes"] = int64(0)
+		if info, err := os.Stat(healthDBPath + "-wal"); err == nil {
+			details["wal_bytes"] = info.Size()
+		}
+	}
+	if healthDataDir != "" {
+		if free, err := freeDiskBytes(healthDataDir); err == nil {
+			details["free_disk_mb"] = free / 1024 / 1024
+		}
+	}
+
+	lastCleanup.Lock()
+	if !lastCleanup.at.IsZero() {
+		details["last_cleanup"] = lastCleanup.at.UTC().Format(time.RFC3339)
+		details["last_cleanup_deleted"] = lastCleanup.deleted
+	}
+	lastCleanup.Unlock()
+	if recovery := recoveryDetails(); recovery != nil {
+		details["database_recovery"] = recovery
+	}
+
+	if undecryptable := undecryptableValues.Load(); undecryptable > 0 {
+		details["undecryptable_values"] = undecryptable
+	}
+
+	_, _, pending := breaker.status()
+	details["spooled"] = pending
+	details["ingestion_lag_seconds"] = 0.0
+	if oldest := breaker.oldestPending(); !oldest.IsZero() {
+		details["ingestion_lag_seconds"] = time.Since(oldest).Seconds()
+	}
+	return details
+}
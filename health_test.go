@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHealthProbes tests the liveness, readiness and detailed health endpoints
+func TestHealthProbes(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	originalBreaker, originalPath := breaker, spoolPath
+	defer func() { breaker, spoolPath = originalBreaker, originalPath }()
+	breaker, spoolPath = &writeBreaker{}, ""
+
+	w := httptest.NewRecorder()
+	handleLiveness(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected liveness 200, got %d", w.Code)
+	}
+
+	readyz := func(url string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		handleReadiness(w, httptest.NewRequest("GET", url, nil))
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := readyz("/readyz")
+	if code != http.StatusOK || response["status"] != "ready" {
+		t.Fatalf("Expected ready, got %d %v", code, response)
+	}
+	if _, ok := response["details"]; ok {
+		t.Errorf("Expected no details without verbose")
+	}
+
+	// Details report the last cleanup and the ingestion lag of spooled logs
+	cleanupOldLogs(30)
+	breaker.trip("disk full")
+	breaker.spool(storedLog{Type: "info", Title: "waiting", Timestamp: time.Now().Add(-90 * time.Second)})
+
+	code, response = readyz("/readyz?verbose=1")
+	if code != http.StatusServiceUnavailable || response["status"] != "not ready" {
+		t.Errorf("Expected not ready while writes are suspended, got %d %v", code, response["status"])
+	}
+	checks, _ := response["checks"].(map[string]interface{})
+	if writable, _ := checks["writable"].(map[string]interface{}); writable["ok"] != false {
+		t.Errorf("Expected failed writable check, got %v", checks["writable"])
+	}
+	details, _ := response["details"].(map[string]interface{})
+	if details["last_cleanup"] == nil {
+		t.Errorf("Expected last_cleanup in details, got %v", details)
+	}
+	if details["spooled"] != float64(1) {
+		t.Errorf("Expected 1 spooled log, got %v", details["spooled"])
+	}
+	if lag, _ := details["ingestion_lag_seconds"].(float64); lag < 90 {
+		t.Errorf("Expected ingestion lag of at least 90s, got %v", details["ingestion_lag_seconds"])
+	}
+
+	// Ready again once the spool is replayed
+	if err := breaker.replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if code, _ = readyz("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected ready after replay, got %d", code)
+	}
+}
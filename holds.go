@@ -0,0 +1,374 @@
+// CubicLog Legal Holds - Keep logs from being deleted while a hold is in place
+//
+//   - GET  /api/admin/legal-holds                all holds, active and released
+//   - POST /api/admin/legal-holds                place a hold
+//   - POST /api/admin/legal-holds/{id}/release   lift it
+//
+// A hold names a reason and a filter of any combination of derived source,
+// tag (see bulk.go) and time range:
+//
+//	{"reason": "Case 2024-117", "source": "payments", "from": "2024-03-01T00:00:00Z", "to": "2024-03-31T23:59:59Z"}
+//	{"reason": "Incident 42 review", "tag": "incident-42"}
+//
+// Logs matching an active hold are skipped by retention cleanup, rollups,
+// bulk deletes and privacy erasures, and monthly partition files holding any
+// of them are kept. Holds are never deleted: releasing one records who lifted
+// it, when and why, next to who placed it, so the list doubles as the audit
+// trail. "Who" is the ID of the managed API key used, "api-key" for the
+// -api-key flag or "anonymous" without authentication.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LegalHold exempts matching logs from deletion
+type LegalHold struct {
+	ID            string     `json:"id"`
+	Reason        string     `json:"reason"`
+	Source        string     `json:"source,omitempty"`
+	Tag           string     `json:"tag,omitempty"`
+	From          *time.Time `json:"from,omitempty"`
+	To            *time.Time `json:"to,omitempty"`
+	CreatedBy     string     `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReleasedBy    string     `json:"released_by,omitempty"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+	ReleaseReason string     `json:"release_reason,omitempty"`
+
+	// Computed when listed
+	Active   bool  `json:"active"`
+	HeldLogs int64 `json:"held_logs"` // logs in the main database the hold protects
+}
+
+// legalHolds caches the active holds for the deletion paths
+var legalHolds = struct {
+	sync.RWMutex
+	active []LegalHold
+}{}
+
+// createLegalHoldsTable creates the legal hold table
+func createLegalHoldsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS legal_holds (
+		id             TEXT PRIMARY KEY,
+		reason         TEXT NOT NULL,
+		source         TEXT NOT NULL DEFAULT '',
+		tag            TEXT NOT NULL DEFAULT '',
+		from_time      TIMESTAMP,
+		to_time        TIMESTAMP,
+		created_by     TEXT NOT NULL,
+		created_at     TIMESTAMP NOT NULL,
+		released_by    TEXT NOT NULL DEFAULT '',
+		released_at    TIMESTAMP,
+		release_reason TEXT NOT NULL DEFAULT ''
+	);
+	`)
+	return err
+}
+
+// readLegalHolds returns all holds, newest first
+func readLegalHolds() ([]LegalHold, error) {
+	rows, err := db.Query(`SELECT id, reason, source, tag, from_time, to_time, created_by, created_at, released_by, released_at, release_reason
+		FROM legal_holds ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holds := []LegalHold{}
+	for rows.Next() {
+		var hold LegalHold
+		var from, to, releasedAt time.Time
+		if err := rows.Scan(&hold.ID, &hold.Reason, &hold.Source, &hold.Tag, (*scanTime)(&from), (*scanTime)(&to),
+			&hold.CreatedBy, (*scanTime)(&hold.CreatedAt), &hold.ReleasedBy, (*scanTime)(&releasedAt), &hold.ReleaseReason); err != nil {
+			return nil, err
+		}
+		if !from.IsZero() {
+			hold.From = &from
+		}
+		if !to.IsZero() {
+			hold.To = &to
+		}
+		if !releasedAt.IsZero() {
+			hold.ReleasedAt = &releasedAt
+		}
+		hold.Active = hold.ReleasedAt == nil
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// loadLegalHolds reads the active holds into the cache
+func loadLegalHolds() error {
+	holds, err := readLegalHolds()
+	if err != nil {
+		return err
+	}
+	var active []LegalHold
+	for _, hold := range holds {
+		if hold.Active {
+			active = append(active, hold)
+		}
+	}
+	legalHolds.Lock()
+	legalHolds.active = active
+	legalHolds.Unlock()
+	return nil
+}
+
+// condition matches the logs under one hold
+func (hold LegalHold) condition() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if hold.Source != "" {
+		conditions = append(conditions, "derived_source = ?")
+		args = append(args, hold.Source)
+	}
+	if hold.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT log_id FROM log_triage WHERE ',' || tags || ',' "+db.Like()+" ?)")
+		args = append(args, "%,"+hold.Tag+",%")
+	}
+	if hold.From != nil {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, dbTime(*hold.From))
+	}
+	if hold.To != nil {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, dbTime(*hold.To))
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", args
+}
+
+// heldCondition matches the logs under any active hold ("" without holds)
+func heldCondition() (string, []interface{}) {
+	legalHolds.RLock()
+	defer legalHolds.RUnlock()
+	if len(legalHolds.active) == 0 {
+		return "", nil
+	}
+	var conditions []string
+	var args []interface{}
+	for _, hold := range legalHolds.active {
+		condition, holdArgs := hold.condition()
+		conditions = append(conditions, condition)
+		args = append(args, holdArgs...)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// excludeHeld narrows a WHERE condition to logs no active hold protects
+func excludeHeld(filter string, args []interface{}) (string, []interface{}) {
+	held, heldArgs := heldCondition()
+	if held == "" {
+		return filter, args
+	}
+	return "(" + filter + ") AND NOT " + held, append(append([]interface{}{}, args...), heldArgs...)
+}
+
+// heldColumn is a select expression that is 1 for logs under an active hold
+func heldColumn() (string, []interface{}) {
+	held, args := heldCondition()
+	if held == "" {
+		return "0", nil
+	}
+	return "CASE WHEN " + held + " THEN 1 ELSE 0 END", args
+}
+
+// heldLogIDs returns which of the given logs an active hold protects
+func heldLogIDs(ids []int) ([]int, error) {
+	held, args := heldCondition()
+	if held == "" || len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.Query(db.Rebind("SELECT id FROM logs WHERE "+held+" AND id IN ("+placeholders+") ORDER BY id"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var kept []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		kept = append(kept, id)
+	}
+	return kept, rows.Err()
+}
+
+// heldTags returns the tags active holds match on
+func heldTags() []string {
+	legalHolds.RLock()
+	defer legalHolds.RUnlock()
+	var tags []string
+	for _, hold := range legalHolds.active {
+		if hold.Tag != "" {
+			tags = append(tags, hold.Tag)
+		}
+	}
+	return tags
+}
+
+// partitionHasHeldLogs reports whether a partition file holds logs under an
+// active hold (unreadable partitions count as held, so they are kept)
+func partitionHasHeldLogs(month string) bool {
+	held, args := heldCondition()
+	if held == "" {
+		return false
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return true
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS held", partitionPath(month)); err != nil {
+		return true
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE held")
+
+	var count int64
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM held.logs WHERE "+held, args...).Scan(&count); err != nil {
+		return true
+	}
+	return count > 0
+}
+
+// holdActor names who placed or released a hold
+func holdActor(r *http.Request) string {
+	if id := managedKeyID(requestAPIKey(r)); id != "" {
+		return id
+	}
+	if requestAPIKey(r) != "" {
+		return "api-key"
+	}
+	return "anonymous"
+}
+
+// handleLegalHolds answers GET and POST /api/admin/legal-holds
+func handleLegalHolds(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		holds, err := readLegalHolds()
+		if err != nil {
+			http.Error(w, "Failed to load legal holds", http.StatusInternalServerError)
+			return
+		}
+		for i, hold := range holds {
+			if hold.Active {
+				condition, args := hold.condition()
+				db.QueryRow(db.Rebind("SELECT COUNT(*) FROM logs WHERE "+condition), args...).Scan(&holds[i].HeldLogs)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"holds": holds})
+
+	case http.MethodPost:
+		var hold LegalHold
+		if err := json.NewDecoder(r.Body).Decode(&hold); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		hold.Reason, hold.Source, hold.Tag = strings.TrimSpace(hold.Reason), strings.TrimSpace(hold.Source), strings.TrimSpace(hold.Tag)
+		if hold.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+		if hold.Source == "" && hold.Tag == "" && hold.From == nil && hold.To == nil {
+			http.Error(w, "a hold needs a source, tag, from or to", http.StatusBadRequest)
+			return
+		}
+		if hold.From != nil && hold.To != nil && hold.To.Before(*hold.From) {
+			http.Error(w, "to must not be before from", http.StatusBadRequest)
+			return
+		}
+		id := make([]byte, 6)
+		rand.Read(id)
+		hold.ID = "hold-" + hex.EncodeToString(id)
+		hold.CreatedBy = holdActor(r)
+		hold.CreatedAt = time.Now().UTC().Truncate(time.Second)
+		hold.Active = true
+
+		var from, to interface{}
+		if hold.From != nil {
+			from = dbTime(*hold.From)
+		}
+		if hold.To != nil {
+			to = dbTime(*hold.To)
+		}
+		if _, err := db.Exec(db.Rebind(`INSERT INTO legal_holds (id, reason, source, tag, from_time, to_time, created_by, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`), hold.ID, hold.Reason, hold.Source, hold.Tag, from, to, hold.CreatedBy, dbTime(hold.CreatedAt)); err != nil {
+			http.Error(w, "Failed to save legal hold", http.StatusInternalServerError)
+			return
+		}
+		if err := loadLegalHolds(); err != nil {
+			http.Error(w, "Failed to load legal holds", http.StatusInternalServerError)
+			return
+		}
+		condition, args := hold.condition()
+		db.QueryRow(db.Rebind("SELECT COUNT(*) FROM logs WHERE "+condition), args...).Scan(&hold.HeldLogs)
+		log.Printf("⚖️  Legal hold %s placed by %s: %s", hold.ID, hold.CreatedBy, hold.Reason)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hold)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLegalHold answers POST /api/admin/legal-holds/{id}/release
+func handleLegalHold(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/admin/legal-holds/"), "/")
+	if action != "release" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Reason) == "" {
+		http.Error(w, "A release needs a JSON body with a reason", http.StatusBadRequest)
+		return
+	}
+
+	actor := holdActor(r)
+	result, err := db.Exec(db.Rebind("UPDATE legal_holds SET released_by = ?, released_at = ?, release_reason = ? WHERE id = ? AND released_at IS NULL"),
+		actor, dbTime(time.Now()), strings.TrimSpace(request.Reason), id)
+	if err != nil {
+		http.Error(w, "Failed to release legal hold", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		var exists string
+		if db.QueryRow(db.Rebind("SELECT id FROM legal_holds WHERE id = ?"), id).Scan(&exists) == sql.ErrNoRows {
+			http.Error(w, "Legal hold not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Legal hold already released", http.StatusConflict)
+		return
+	}
+	if err := loadLegalHolds(); err != nil {
+		http.Error(w, "Failed to load legal holds", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("⚖️  Legal hold %s released by %s: %s", id, actor, strings.TrimSpace(request.Reason))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "released", "id": id, "released_by": actor})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLegalHolds tests that held logs survive retention and bulk deletes until released
+func TestLegalHolds(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer loadLegalHolds()
+
+	for _, source := range []string{"payments", "payments", "cron"} {
+		db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+			VALUES ('error', 'entry', 'red', '{}', '2020-03-01 10:00:00', 'error', ?)`, source)
+	}
+	count := func() (n int) {
+		db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&n)
+		return n
+	}
+
+	w := httptest.NewRecorder()
+	handleLegalHolds(w, httptest.NewRequest("POST", "/api/admin/legal-holds", strings.NewReader(`{"source": "payments"}`)))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for a hold without a reason, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handleLegalHolds(w, httptest.NewRequest("POST", "/api/admin/legal-holds",
+		strings.NewReader(`{"reason": "Case 2020-117", "source": "payments", "to": "2020-03-31T23:59:59Z"}`)))
+	var hold LegalHold
+	json.Unmarshal(w.Body.Bytes(), &hold)
+	if w.Code != 201 || !hold.Active || hold.HeldLogs != 2 || hold.CreatedBy != "anonymous" {
+		t.Fatalf("Expected an active hold on 2 logs, got %d %+v", w.Code, hold)
+	}
+
+	cleanupOldLogs(30)
+	if n := count(); n != 2 {
+		t.Fatalf("Expected the 2 held logs to survive cleanup, got %d logs", n)
+	}
+
+	w = httptest.NewRecorder()
+	handleBulkLogs(w, httptest.NewRequest("POST", "/api/logs/bulk", strings.NewReader(`{"filter": {"source": "payments"}, "action": "delete"}`)))
+	var result bulkResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Changed != 0 || len(result.Held) != 2 || count() != 2 {
+		t.Errorf("Expected the bulk delete to keep the held logs, got %+v", result)
+	}
+
+	w = httptest.NewRecorder()
+	handleLegalHold(w, httptest.NewRequest("POST", "/api/admin/legal-holds/"+hold.ID+"/release", strings.NewReader(`{"reason": "Case closed"}`)))
+	if w.Code != 200 {
+		t.Fatalf("Expected the hold to be released, got %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handleLegalHold(w, httptest.NewRequest("POST", "/api/admin/legal-holds/"+hold.ID+"/release", strings.NewReader(`{"reason": "Again"}`)))
+	if w.Code != 409 {
+		t.Errorf("Expected status 409 releasing a released hold, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleLegalHolds(w, httptest.NewRequest("GET", "/api/admin/legal-holds", nil))
+	var listed struct {
+		Holds []LegalHold `json:"holds"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Holds) != 1 || listed.Holds[0].Active || listed.Holds[0].ReleaseReason != "Case closed" || listed.Holds[0].ReleasedAt == nil {
+		t.Errorf("Expected the released hold in the audit list, got %+v", listed.Holds)
+	}
+
+	cleanupOldLogs(30)
+	if n := count(); n != 0 {
+		t.Errorf("Expected cleanup to remove the logs after the release, got %d logs", n)
+	}
+}
@@ -0,0 +1,294 @@
+// CubicLog Hourly Stats - /api/stats from counters kept at ingestion
+//
+// Every stored log bumps a counter per hour, source, severity and category in
+// log_stats_hourly, together with the pattern statistics (HTTP codes, stack
+// traces, security and performance mentions in the body). /api/stats adds
+// those rows up in two queries instead of scanning the logs table with a
+// dozen LIKE queries, so it stays fast however large the table grows.
+//
+// Hourly rollups (see rollup.go) and logs only counted over a quota (see
+// quota.go) are kept in the rolled_up column, so totals include them while
+// the category and pattern statistics, which rollups don't keep, count raw
+// logs only.
+//
+// Changes to stored logs - retention, rollups, bulk deletes and re-rating,
+// corrections, erasures, partition rollover, repairs - mark the counters
+// stale, and the next /api/stats rebuilds them from the logs table in one
+// pass. They are also rebuilt once after startup, which covers logs written
+// by older versions. A read-only instance serves the counters as they are.
+//
+// Patterns are matched against the plaintext body: encrypted bodies (see
+// encryption.go) are decrypted to be counted, and a rebuild decrypts them
+// too. Bodies that can't be decrypted count towards no pattern.
+package main
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsPatterns are the body mentions counted for /api/stats pattern_stats, matched case-insensitively
+var statsPatterns = []struct {
+	column   string
+	stat     string
+	keywords []string
+}{
+	{"http_codes", "http_codes_detected", []string{"status", "http", "code"}},
+	{"stack_traces", "stack_traces_found", []string{".java:", ".py:", "goroutine", "traceback"}},
+	{"security_issues", "security_issues", []string{"unauthorized", "forbidden", "breach", "vulnerability"}},
+	{"performance_issues", "performance_issues", []string{"ms", "slow", "timeout", "performance"}},
+}
+
+// hourlyStatsMu guards the counters: stores hold the read lock while inserting
+// and counting a log, a rebuild takes the write lock so no log is counted twice
+var hourlyStatsMu sync.RWMutex
+
+// hourlyStatsStale is set when the counters no longer match the logs
+var hourlyStatsStale atomic.Bool
+
+// hourlyStat is one row of log_stats_hourly
+type hourlyStat struct {
+	hour     time.Time
+	source   string
+	severity string
+	category string
+	count    int
+	rolledUp int
+	patterns [4]int // in statsPatterns order
+}
+
+// createHourlyStatsTable creates the hourly counters (rebuilt from the logs on first use)
+func createHourlyStatsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS log_stats_hourly (
+		hour               TEXT NOT NULL,
+		source             TEXT NOT NULL DEFAULT '',
+		severity           TEXT NOT NULL DEFAULT '',
+		category           TEXT NOT NULL DEFAULT '',
+		count              INTEGER NOT NULL DEFAULT 0,
+		rolled_up          INTEGER NOT NULL DEFAULT 0,
+		http_codes         INTEGER NOT NULL DEFAULT 0,
+		stack_traces       INTEGER NOT NULL DEFAULT 0,
+		security_issues    INTEGER NOT NULL DEFAULT 0,
+		performance_issues INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (hour, source, severity, category)
+	);
+	`)
+	invalidateHourlyStats()
+	return err
+}
+
+// invalidateHourlyStats has the counters rebuilt before they are read next
+func invalidateHourlyStats() {
+	hourlyStatsStale.Store(true)
+}
+
+// statsPatternColumns lists the pattern columns in statsPatterns order
+func statsPatternColumns() string {
+	columns := make([]string, len(statsPatterns))
+	for i, pattern := range statsPatterns {
+		columns[i] = pattern.column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// bodyPatterns reports which statsPatterns a stored body mentions, decrypting it first
+func bodyPatterns(body string) [4]int {
+	var matched [4]int
+	plain, err := decryptField(body)
+	if err != nil {
+		return matched
+	}
+	lower := strings.ToLower(plain)
+	for i, pattern := range statsPatterns {
+		for _, keyword := range pattern.keywords {
+			if strings.Contains(lower, keyword) {
+				matched[i] = 1
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// countHourlyStats adds a stored log to the counters of its hour
+func countHourlyStats(row storedLog, timestamp time.Time) {
+	args := []interface{}{timestamp.UTC().Format("2006-01-02 15"), row.DerivedSource, row.DerivedSeverity, row.DerivedCategory}
+	updates := []string{"count = log_stats_hourly.count + 1"}
+	matched := bodyPatterns(row.Body)
+	for i, pattern := range statsPatterns {
+		args = append(args, matched[i])
+		updates = append(updates, pattern.column+" = log_stats_hourly."+pattern.column+" + excluded."+pattern.column)
+	}
+	if _, err := db.Exec(db.Rebind(`
+		INSERT INTO log_stats_hourly (hour, source, severity, category, count, `+statsPatternColumns()+`)
+		VALUES (?, ?, ?, ?, 1, ?, ?, ?, ?)
+		ON CONFLICT (hour, source, severity, category) DO UPDATE SET `+strings.Join(updates, ", ")), args...); err != nil {
+		invalidateHourlyStats()
+	}
+}
+
+// countHourlyRollup adds a log counted in the rollups only (see quota.go) to the counters of its hour
+func countHourlyRollup(hour, source, severity string) {
+	if _, err := db.Exec(db.Rebind(`
+		INSERT INTO log_stats_hourly (hour, source, severity, category, rolled_up) VALUES (?, ?, ?, '', 1)
+		ON CONFLICT (hour, source, severity, category) DO UPDATE SET rolled_up = log_stats_hourly.rolled_up + 1`), hour, source, severity); err != nil {
+		invalidateHourlyStats()
+	}
+}
+
+// rebuildHourlyStats recounts the counters from the logs and rollups.
+// Plaintext bodies are matched in SQL, encrypted ones are decrypted and
+// matched here.
+func rebuildHourlyStats() error {
+	hourExpr := "substr(CAST(timestamp AS TEXT), 1, 13)"
+	groupExpr := hourExpr + ", COALESCE(derived_source, ''), COALESCE(derived_severity, ''), COALESCE(derived_category, '')"
+	plaintext := "body NOT LIKE '" + encryptedPrefix + "%'"
+	sums := make([]string, len(statsPatterns))
+	for i, pattern := range statsPatterns {
+		matches := make([]string, len(pattern.keywords))
+		for j, keyword := range pattern.keywords {
+			matches[j] = "body " + db.Like() + " '%" + keyword + "%'"
+		}
+		sums[i] = "SUM(CASE WHEN " + plaintext + " AND (" + strings.Join(matches, " OR ") + ") THEN 1 ELSE 0 END)"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM log_stats_hourly"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(db.Rebind(`
+		INSERT INTO log_stats_hourly (hour, source, severity, category, count, ` + statsPatternColumns() + `)
+		SELECT ` + groupExpr + `, COUNT(*), ` + strings.Join(sums, ", ") + `
+		FROM logs
+		GROUP BY ` + groupExpr)); err != nil {
+		return err
+	}
+	if fieldCipher != nil {
+		if err := recountSealedPatterns(tx, groupExpr); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO log_stats_hourly (hour, source, severity, category, rolled_up)
+		SELECT hour, source, severity, '', SUM(count) FROM log_rollups GROUP BY hour, source, severity
+		ON CONFLICT (hour, source, severity, category) DO UPDATE SET rolled_up = excluded.rolled_up`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recountSealedPatterns adds the pattern counts of encrypted bodies to the
+// rebuilt counters
+func recountSealedPatterns(tx *sql.Tx, groupExpr string) error {
+	rows, err := tx.Query(`SELECT ` + groupExpr + `, body FROM logs WHERE body LIKE '` + encryptedPrefix + `%'`)
+	if err != nil {
+		return err
+	}
+	counts := map[[4]string][4]int{}
+	for rows.Next() {
+		var group [4]string
+		var body string
+		if err := rows.Scan(&group[0], &group[1], &group[2], &group[3], &body); err != nil {
+			rows.Close()
+			return err
+		}
+		matched, sum := bodyPatterns(body), counts[group]
+		for i := range sum {
+			sum[i] += matched[i]
+		}
+		counts[group] = sum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	updates := make([]string, len(statsPatterns))
+	for i, pattern := range statsPatterns {
+		updates[i] = pattern.column + " = " + pattern.column + " + ?"
+	}
+	for group, sum := range counts {
+		if _, err := tx.Exec(db.Rebind(`UPDATE log_stats_hourly SET `+strings.Join(updates, ", ")+`
+			WHERE hour = ? AND source = ? AND severity = ? AND category = ?`),
+			sum[0], sum[1], sum[2], sum[3], group[0], group[1], group[2], group[3]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadHourlyStats returns the counters summed per source, severity and
+// category - per hour from since on, or over all time with a zero since
+func loadHourlyStats(since time.Time) ([]hourlyStat, error) {
+	if hourlyStatsStale.Load() && !readOnlyMode {
+		hourlyStatsMu.Lock()
+		// Invalidations from here on are picked up by the next read
+		if hourlyStatsStale.Swap(false) {
+			if err := rebuildHourlyStats(); err != nil {
+				hourlyStatsStale.Store(true)
+				hourlyStatsMu.Unlock()
+				return nil, err
+			}
+		}
+		hourlyStatsMu.Unlock()
+	}
+
+	groups, query, args := "source, severity, category", "FROM log_stats_hourly", []interface{}{}
+	if !since.IsZero() {
+		groups = "hour, " + groups
+		query += " WHERE hour >= ?"
+		args = append(args, since.UTC().Format("2006-01-02 15"))
+	}
+	rows, err := db.Query(db.Rebind(`
+		SELECT `+groups+`, SUM(count), SUM(rolled_up), SUM(http_codes), SUM(stack_traces), SUM(security_issues), SUM(performance_issues)
+		`+query+` GROUP BY `+groups), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stats []hourlyStat
+	for rows.Next() {
+		var stat hourlyStat
+		var hour string
+		dest := []interface{}{&stat.source, &stat.severity, &stat.category, &stat.count, &stat.rolledUp,
+			&stat.patterns[0], &stat.patterns[1], &stat.patterns[2], &stat.patterns[3]}
+		if !since.IsZero() {
+			dest = append([]interface{}{&hour}, dest...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if hour != "" {
+			stat.hour, _ = time.ParseInLocation("2006-01-02 15", hour, time.UTC)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// topStatCounts returns the names with the highest counts, at most limit
+func topStatCounts(counts map[string]int, limit int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > limit {
+		names = names[:limit]
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHourlyStats tests that the counters kept at ingestion match a rebuild from the logs
+func TestHourlyStats(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := loadHourlyStats(time.Time{}); err != nil {
+		t.Fatalf("Initial rebuild failed: %v", err)
+	}
+	for _, body := range []string{
+		`{"header": {"title": "Payment failed", "source": "checkout"}, "body": {"error": "Traceback (most recent call last)"}}`,
+		`{"header": {"title": "Slow query took 950ms", "source": "checkout"}}`,
+		`{"header": {"type": "info", "title": "Login", "source": "auth"}, "body": {"status": 401, "reason": "unauthorized"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+	sorted := func(stats []hourlyStat) []hourlyStat {
+		sort.Slice(stats, func(i, j int) bool {
+			return stats[i].source+stats[i].severity+stats[i].category < stats[j].source+stats[j].severity+stats[j].category
+		})
+		return stats
+	}
+	counted, err := loadHourlyStats(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, patterns := 0, [4]int{}
+	for _, row := range counted {
+		total += row.count
+		for i := range patterns {
+			patterns[i] += row.patterns[i]
+		}
+	}
+	if total != 3 || patterns[1] != 1 || patterns[2] != 1 {
+		t.Errorf("Expected 3 logs with a stack trace and a security issue counted, got %d and %v", total, patterns)
+	}
+
+	invalidateHourlyStats()
+	rebuilt, err := loadHourlyStats(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if !reflect.DeepEqual(sorted(counted), sorted(rebuilt)) {
+		t.Errorf("Counters kept at ingestion differ from the rebuild:\n%+v\n%+v", counted, rebuilt)
+	}
+
+	// Removed logs are gone from the counters once they are marked stale
+	db.Exec("DELETE FROM logs WHERE derived_source = 'auth'")
+	invalidateHourlyStats()
+	all, _ := loadHourlyStats(time.Time{})
+	for _, row := range all {
+		if row.source == "auth" {
+			t.Errorf("Expected the deleted auth log to be gone, got %+v", row)
+		}
+	}
+}
+
+// TestHourlyStatsEncrypted tests that patterns are counted in encrypted bodies, at ingestion and on a rebuild
+func TestHourlyStatsEncrypted(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	t.Setenv("CUBICLOG_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err := loadEncryptionKey(""); err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	defer func() { fieldCipher = nil }()
+
+	if _, err := loadHourlyStats(time.Time{}); err != nil {
+		t.Fatalf("Initial rebuild failed: %v", err)
+	}
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(
+		`{"header": {"title": "Payment failed", "source": "checkout"}, "body": {"error": "Traceback (most recent call last)"}}`)))
+
+	patterns := func() [4]int {
+		stats, err := loadHourlyStats(time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum [4]int
+		for _, row := range stats {
+			for i := range sum {
+				sum[i] += row.patterns[i]
+			}
+		}
+		return sum
+	}
+	if counted := patterns(); counted[1] != 1 {
+		t.Errorf("Expected the encrypted stack trace counted at ingestion, got %v", counted)
+	}
+	invalidateHourlyStats()
+	if rebuilt := patterns(); rebuilt[1] != 1 {
+		t.Errorf("Expected the encrypted stack trace counted by the rebuild, got %v", rebuilt)
+	}
+}
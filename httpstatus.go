@@ -0,0 +1,124 @@
+// CubicLog HTTP Status - Status codes that are really status codes
+//
+//	cubiclog -http-status-fields status,response.status_code -http-status-sources api-gateway,nginx
+//	cubiclog -http-status=false
+//	GET /api/logs?http_status=5xx
+//
+// Logs mentioning an HTTP status code ("status 503", "HTTP 404", "returned
+// 500") get their severity from it before anything else. Scanning the text
+// also matches numbers that merely sit next to one of those words ("error code
+// 404 units sold"), so detection can be narrowed:
+//   - -http-status-fields reads the code only from these body paths (a number
+//     or a 3-digit string) and no longer scans the text
+//   - -http-status-sources only detects codes in logs of these derived sources
+//   - -http-status=false turns detection off altogether
+//
+// Only codes from 100 to 599 count. The code found is stored in the indexed
+// derived_http_status column, and /api/logs and the exports filter it with
+// ?http_status= taking a code (404) or a class (4xx).
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HTTP status detection settings - configured once in main()
+var (
+	httpStatusEnabled = true
+	httpStatusFields  [][]interface{} // body paths holding the code (nil: scan the text)
+	httpStatusSources []string        // derived sources codes are detected in (nil: all)
+)
+
+// configureHTTPStatus sets the -http-status, -http-status-fields and -http-status-sources flags
+func configureHTTPStatus(enabled bool, fields, sources string) error {
+	var paths [][]interface{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(field), "body."))
+		if field == "" {
+			continue
+		}
+		path, err := parseJSONPath(field)
+		if err != nil {
+			return fmt.Errorf("invalid HTTP status field '%s': %v", field, err)
+		}
+		paths = append(paths, path)
+	}
+	var names []string
+	for _, source := range strings.Split(sources, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			names = append(names, source)
+		}
+	}
+	httpStatusEnabled, httpStatusFields, httpStatusSources = enabled, paths, names
+	return nil
+}
+
+// validHTTPStatus parses a status code, 0 if it is none
+func validHTTPStatus(value string) int {
+	code, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || code < 100 || code > 599 {
+		return 0
+	}
+	return code
+}
+
+// detectHTTPStatus returns the HTTP status code of a log of the given derived
+// source (0 if it has none or detection doesn't apply)
+func detectHTTPStatus(source, text string, body map[string]interface{}) int {
+	if !httpStatusEnabled || (httpStatusSources != nil && !containsString(httpStatusSources, source)) {
+		return 0
+	}
+	if httpStatusFields == nil {
+		return validHTTPStatus(extractHTTPStatusCode(text))
+	}
+	for _, path := range httpStatusFields {
+		value, ok := lookupJSONPath(body, path)
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case float64:
+			if v == float64(int(v)) {
+				if code := validHTTPStatus(strconv.Itoa(int(v))); code != 0 {
+					return code
+				}
+			}
+		case string:
+			if code := validHTTPStatus(v); code != 0 {
+				return code
+			}
+		}
+	}
+	return 0
+}
+
+// httpStatusRangeSeverity rates a code missing from the http_status pattern list by its class
+func httpStatusRangeSeverity(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return "success"
+	case code >= 300 && code < 400:
+		return "info"
+	case code >= 400 && code < 500:
+		return "warning"
+	case code >= 500:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// parseHTTPStatusFilter reads ?http_status= as an inclusive range ("404", "4xx")
+func parseHTTPStatusFilter(value string) (int, int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) == 3 && strings.HasSuffix(value, "xx") && value[0] >= '1' && value[0] <= '5' {
+		class := int(value[0]-'0') * 100
+		return class, class + 99, nil
+	}
+	if code := validHTTPStatus(value); code != 0 {
+		return code, code, nil
+	}
+	return 0, 0, fmt.Errorf("invalid http_status '%s' - use a code like 404 or a class like 5xx", value)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHTTPStatusDetection tests storing, restricting and filtering HTTP status codes
+func TestHTTPStatusDetection(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer configureHTTPStatus(true, "", "")
+
+	derive := func(title, source string, body map[string]interface{}) LogMetadata {
+		return deriveMetadata(LogHeader{Title: title, Source: source}, body)
+	}
+	if m := derive("Error code 404 units sold", "inventory", nil); m.DerivedHTTPStatus != 404 || m.DerivedSeverity != "warning" {
+		t.Errorf("Expected the text scanned by default, got %+v", m)
+	}
+
+	// Fields replace the text scan
+	configureHTTPStatus(true, "status, body.response.status_code", "")
+	if m := derive("Error code 404 units sold", "inventory", nil); m.DerivedHTTPStatus != 0 {
+		t.Errorf("Expected no status outside the fields, got %d", m.DerivedHTTPStatus)
+	}
+	if m := derive("GET /cart", "web", map[string]interface{}{"response": map[string]interface{}{"status_code": float64(503)}}); m.DerivedHTTPStatus != 503 || m.DerivedSeverity != "critical" {
+		t.Errorf("Expected 503 read from the body field, got %+v", m)
+	}
+	if m := derive("GET /cart", "web", map[string]interface{}{"status": "1234"}); m.DerivedHTTPStatus != 0 {
+		t.Errorf("Expected an out of range code ignored, got %d", m.DerivedHTTPStatus)
+	}
+
+	// Sources and the opt-out
+	configureHTTPStatus(true, "", "api-gateway")
+	if derive("Error code 404 units sold", "inventory", nil).DerivedHTTPStatus != 0 || derive("Upstream returned 502", "api-gateway", nil).DerivedHTTPStatus != 502 {
+		t.Errorf("Expected codes detected in api-gateway logs only")
+	}
+	configureHTTPStatus(false, "", "")
+	if m := derive("Upstream returned 502", "api-gateway", nil); m.DerivedHTTPStatus != 0 {
+		t.Errorf("Expected detection turned off, got %d", m.DerivedHTTPStatus)
+	}
+	if err := configureHTTPStatus(true, "items[x", ""); err == nil {
+		t.Errorf("Expected an error for an invalid field path")
+	}
+
+	// The stored code is filtered by code or class
+	configureHTTPStatus(true, "", "")
+	for _, title := range []string{"Upstream returned 502", "GET /cart status 503", "Page HTTP 404", "Cart emptied"} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header": {"title": "`+title+`"}}`)))
+	}
+	count := func(query string) (int, int) {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs?"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		return w.Code, len(logs)
+	}
+	if _, n := count("http_status=5xx"); n != 2 {
+		t.Errorf("Expected two 5xx logs, got %d", n)
+	}
+	if _, n := count("http_status=404"); n != 1 {
+		t.Errorf("Expected one 404 log, got %d", n)
+	}
+	if code, _ := count("http_status=6xx"); code != 400 {
+		t.Errorf("Expected status 400 for an invalid class, got %d", code)
+	}
+}
@@ -0,0 +1,190 @@
+// CubicLog I18n - The dashboard in the language of its team
+//
+//	cubiclog -locale es
+//	GET /api/ui/i18n/{lang}    a language pack (public)
+//
+// The dashboard's texts come from language packs: ui/i18n/{lang}.json,
+// compiled into the binary like the rest of the dashboard. English, Spanish,
+// Portuguese and German are built in:
+//
+//	{
+//	  "name": "Español",
+//	  "messages": {
+//	    "filters.search": "Buscar logs...",
+//	    "pagination.showing": "Mostrando {from} a {to} de {total} resultados"
+//	  }
+//	}
+//
+// Messages are looked up by key; {name} placeholders are filled in by the
+// dashboard. Keys missing from a pack fall back to English, so a pack can be
+// partial. A -ui-dir (see branding.go) may add packs or override single
+// messages of a built-in one in its own i18n directory.
+//
+// -locale (default "en") is the language the dashboard opens with; everyone
+// can choose another one in the dashboard (stored with their preferences, see
+// preferences.go). Tags with a region fall back to their language, so pt-BR
+// is served the pt pack unless there is a pt-br one. /api/ui/config lists the
+// available languages.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// fallbackLocale is the language every pack falls back to
+const fallbackLocale = "en"
+
+// languageTagPattern validates language pack names (en, pt-br, zh-hant)
+var languageTagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// languagePack is the content of an i18n/{lang}.json file
+type languagePack struct {
+	Name     string            `json:"name"`
+	Messages map[string]string `json:"messages"`
+}
+
+// uiLanguage is an available language as listed by /api/ui/config
+type uiLanguage struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// Language packs - configured once in main()
+var (
+	languagePacks = mustLoadLanguagePacks()
+	defaultLocale = fallbackLocale
+)
+
+// mustLoadLanguagePacks reads the built-in language packs
+func mustLoadLanguagePacks() map[string]languagePack {
+	packs, err := loadLanguagePacks("")
+	if err != nil {
+		log.Fatalf("Embedded language packs are broken: %v", err)
+	}
+	return packs
+}
+
+// loadLanguagePacks reads the built-in packs and those of a -ui-dir, each
+// completed from the English one
+func loadLanguagePacks(dir string) (map[string]languagePack, error) {
+	packs := map[string]languagePack{}
+	roots := []fs.FS{embeddedUIRoot()}
+	if dir != "" {
+		roots = append(roots, os.DirFS(dir))
+	}
+	for _, root := range roots {
+		files, err := fs.Glob(root, "i18n/*.json")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			code := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+			if !languageTagPattern.MatchString(code) {
+				return nil, fmt.Errorf("%s: '%s' is not a language tag", file, code)
+			}
+			data, err := fs.ReadFile(root, file)
+			if err != nil {
+				return nil, err
+			}
+			var pack languagePack
+			if err := json.Unmarshal(data, &pack); err != nil {
+				return nil, fmt.Errorf("invalid language pack %s: %v", file, err)
+			}
+			// A -ui-dir pack overrides single messages of a built-in one
+			merged := packs[code]
+			if merged.Messages == nil {
+				merged.Messages = map[string]string{}
+			}
+			merged.Name = valueOr(strings.TrimSpace(pack.Name), merged.Name)
+			for key, message := range pack.Messages {
+				merged.Messages[key] = message
+			}
+			packs[code] = merged
+		}
+	}
+
+	english, ok := packs[fallbackLocale]
+	if !ok {
+		return nil, fmt.Errorf("the %s language pack is missing", fallbackLocale)
+	}
+	for code, pack := range packs {
+		if pack.Name == "" {
+			return nil, fmt.Errorf("language pack %s: name is required", code)
+		}
+		for key, message := range english.Messages {
+			if _, translated := pack.Messages[key]; !translated {
+				pack.Messages[key] = message
+			}
+		}
+	}
+	return packs, nil
+}
+
+// configureLocales loads the language packs of a -ui-dir and picks the default language
+func configureLocales(dir, locale string) error {
+	packs, err := loadLanguagePacks(dir)
+	if err != nil {
+		return err
+	}
+	code, ok := resolveLanguage(packs, locale)
+	if !ok {
+		return fmt.Errorf("no language pack for locale '%s'", locale)
+	}
+	languagePacks, defaultLocale = packs, code
+	return nil
+}
+
+// resolveLanguage finds the pack for a language tag, falling back from a
+// region (pt-BR) to its language (pt)
+func resolveLanguage(packs map[string]languagePack, tag string) (string, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if _, ok := packs[tag]; ok {
+		return tag, true
+	}
+	if language, _, found := strings.Cut(tag, "-"); found {
+		if _, ok := packs[language]; ok {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// uiLanguages lists the available languages by code
+func uiLanguages() []uiLanguage {
+	languages := []uiLanguage{}
+	for code, pack := range languagePacks {
+		languages = append(languages, uiLanguage{Code: code, Name: pack.Name})
+	}
+	sort.Slice(languages, func(i, j int) bool { return languages[i].Code < languages[j].Code })
+	return languages
+}
+
+// handleLanguagePack answers GET /api/ui/i18n/{lang}
+func handleLanguagePack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code, ok := resolveLanguage(languagePacks, strings.TrimPrefix(r.URL.Path, "/api/ui/i18n/"))
+	if !ok {
+		http.Error(w, "Language not found", http.StatusNotFound)
+		return
+	}
+	pack := languagePacks[code]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lang":     code,
+		"name":     pack.Name,
+		"messages": pack.Messages,
+	})
+}
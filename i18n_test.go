@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLanguagePacks tests the built-in language packs and -ui-dir overrides
+func TestLanguagePacks(t *testing.T) {
+	defer func() { languagePacks, defaultLocale = mustLoadLanguagePacks(), fallbackLocale }()
+
+	// Built-in packs translate every message, not just some
+	english := languagePacks["en"].Messages
+	for _, code := range []string{"es", "pt", "de"} {
+		data, err := fs.ReadFile(embeddedUIRoot(), "i18n/"+code+".json")
+		if err != nil {
+			t.Fatalf("Expected a built-in %s pack: %v", code, err)
+		}
+		var pack languagePack
+		json.Unmarshal(data, &pack)
+		for key := range english {
+			if pack.Messages[key] == "" {
+				t.Errorf("Expected %s to translate %s", code, key)
+			}
+		}
+	}
+
+	request := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		handleLanguagePack(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+	if code, body := request("/api/ui/i18n/pt-BR"); code != 200 || body["lang"] != "pt" {
+		t.Errorf("Expected pt-BR to fall back to pt, got %d %v", code, body["lang"])
+	}
+	if code, _ := request("/api/ui/i18n/../branding"); code != 404 {
+		t.Errorf("Expected status 404 for an unknown language, got %d", code)
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "i18n"), 0o755)
+	os.WriteFile(filepath.Join(dir, "i18n", "es.json"), []byte(`{"messages": {"logs.title": "Últimos logs"}}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "i18n", "fr.json"), []byte(`{"name": "Français", "messages": {"filters.clear": "Effacer"}}`), 0o644)
+	if err := configureLocales(dir, "fr-CA"); err != nil {
+		t.Fatalf("Failed to configure locales: %v", err)
+	}
+	if defaultLocale != "fr" || languagePacks["fr"].Messages["filters.clear"] != "Effacer" || languagePacks["fr"].Messages["logs.title"] != "Recent Logs" {
+		t.Errorf("Expected a partial fr pack completed from English, got %q %v", defaultLocale, languagePacks["fr"].Messages["logs.title"])
+	}
+	if es := languagePacks["es"]; es.Name != "Español" || es.Messages["logs.title"] != "Últimos logs" || es.Messages["filters.clear"] != "Limpiar" {
+		t.Errorf("Expected the override of a single Spanish message, got %+v", es.Messages["logs.title"])
+	}
+	if len(uiLanguages()) != 5 {
+		t.Errorf("Expected 5 languages, got %v", uiLanguages())
+	}
+	if err := configureLocales("", "ja"); err == nil {
+		t.Error("Expected a locale without a pack to be refused")
+	}
+}
@@ -0,0 +1,66 @@
+// CubicLog Ingest Acknowledgments - Which event became which log
+//
+// The batch endpoints (Vector, Alertmanager, see shippers.go and
+// alertmanager.go) answer with one item per event, in the order they were
+// sent, so producers can store a cross-reference to the CubicLog entry:
+//
+//	{"received": 2, "ids": [4711], "items": [
+//	  {"index": 0, "id": 4711, "status": "stored", "derived_severity": "error", "derived_source": "checkout", "derived_category": "payment"},
+//	  {"index": 1, "id": 4711, "status": "throttled", "derived_severity": "error", ...}
+//	]}
+//
+// status says what happened to the event:
+//   - stored     stored with the given id
+//   - throttled  counted on the representative log with the given id (see throttle.go)
+//   - spooled    accepted while the database can't take writes; it gets an id when replayed
+//   - counted    over a quota that only counts (see quota.go), not stored
+//   - validated  a dry run (see dryrun.go), not stored
+//   - rejected   refused with the HTTP status in code and the reason in error,
+//     not stored; the rest of the batch is handled regardless
+//   - accepted   answered with success in a way none of the above describe
+//
+// The derived metadata is what the log was (or would have been) stored with.
+// "ids" keeps listing the IDs without the index, as before.
+package main
+
+import (
+	"net/http"
+)
+
+// ingestAck is the acknowledgment of one event of a batch
+type ingestAck struct {
+	Index  int    `json:"index"`
+	ID     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Code   int    `json:"code,omitempty"`  // HTTP status of a rejected event
+	Error  string `json:"error,omitempty"` // why the event was rejected
+	LogMetadata
+}
+
+// ingestMetadataKey carries where createLog reports the derived metadata of a converted log (see ingestLog)
+type ingestMetadataKey struct{}
+
+// reportIngestMetadata hands the final derived metadata to ingestLog (no-op for logs sent to /api/logs)
+func reportIngestMetadata(r *http.Request, metadata LogMetadata) {
+	if target, ok := r.Context().Value(ingestMetadataKey{}).(*LogMetadata); ok {
+		*target = metadata
+	}
+}
+
+// ingestStatus names what createLog did with a log from its answer
+func ingestStatus(status int, header http.Header) string {
+	switch {
+	case status == http.StatusCreated:
+		return "stored"
+	case header.Get("X-CubicLog-Throttled") != "":
+		return "throttled"
+	case header.Get("X-CubicLog-Quota") != "":
+		return "counted"
+	case header.Get("X-CubicLog-Dry-Run") != "":
+		return "validated"
+	case status == http.StatusAccepted:
+		return "spooled"
+	default:
+		return "accepted"
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBatchAcknowledgments tests that batch endpoints acknowledge every event in order
+func TestBatchAcknowledgments(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureThrottle(1)
+	defer configureThrottle(0)
+
+	batch := `[
+		{"message": "Payment declined", "service": "checkout", "level": "error"},
+		{"message": "Payment declined", "service": "checkout", "level": "error"},
+		{"header": {"title": "Deploy finished", "source": "ci"}}
+	]`
+	w := httptest.NewRecorder()
+	handleVectorIngest(w, httptest.NewRequest("POST", "/api/ingest/vector", strings.NewReader(batch)))
+	var result struct {
+		IDs   []int       `json:"ids"`
+		Items []ingestAck `json:"items"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 200 || len(result.Items) != 3 {
+		t.Fatalf("Expected 3 acknowledgments, got %d %s", w.Code, w.Body.String())
+	}
+
+	first, repeat, deploy := result.Items[0], result.Items[1], result.Items[2]
+	if first.Index != 0 || first.Status != "stored" || first.DerivedSeverity != "error" || first.DerivedSource != "checkout" {
+		t.Errorf("Expected the first event stored as a checkout error, got %+v", first)
+	}
+	if repeat.Index != 1 || repeat.Status != "throttled" || repeat.ID != first.ID {
+		t.Errorf("Expected the repeat to be counted on log %d, got %+v", first.ID, repeat)
+	}
+	if deploy.Index != 2 || deploy.Status != "stored" || deploy.ID == first.ID || deploy.DerivedSource != "ci" {
+		t.Errorf("Expected the deploy stored on its own, got %+v", deploy)
+	}
+
+	w = httptest.NewRecorder()
+	handleVectorIngest(w, httptest.NewRequest("POST", "/api/ingest/vector?dry_run=true", strings.NewReader(`[{"message": "Disk almost full", "level": "warning"}]`)))
+	result.Items = nil
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Items) != 1 || result.Items[0].Status != "validated" || result.Items[0].ID != 0 || result.Items[0].DerivedSeverity != "warning" {
+		t.Errorf("Expected a validated dry run with its metadata, got %+v", result.Items)
+	}
+}
+
+// TestIngestStatus tests naming createLog's answers
+func TestIngestStatus(t *testing.T) {
+	header := func(name string) http.Header {
+		h := http.Header{}
+		if name != "" {
+			h.Set(name, "1")
+		}
+		return h
+	}
+	cases := []struct {
+		status int
+		header string
+		want   string
+	}{
+		{201, "", "stored"},
+		{202, "X-CubicLog-Throttled", "throttled"},
+		{202, "X-CubicLog-Quota", "counted"},
+		{200, "X-CubicLog-Dry-Run", "validated"},
+		{202, "", "spooled"},
+		{200, "", "accepted"},
+	}
+	for _, c := range cases {
+		if got := ingestStatus(c.status, header(c.header)); got != c.want {
+			t.Errorf("ingestStatus(%d, %s) = %s, expected %s", c.status, c.header, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// CubicLog Ingest Tokens - Let browsers and mobile apps log without an API key
+//
+// A backend holding a real API key mints a short-lived token and hands it to
+// the client:
+//
+//	POST /api/tokens/ingest  {"source": "web-checkout", "ttl": "15m"}
+//	→ {"token": "cit_eyJ...", "source": "web-checkout", "expires_at": "..."}
+//
+// The client sends logs with "Authorization: Bearer cit_eyJ...". Tokens:
+//   - are signed with HMAC-SHA256 using the signing key (see signing.go), so
+//     nothing is stored and every instance sharing the key accepts them
+//   - only allow POST /api/logs; reading, exporting and admin endpoints still
+//     need an API key
+//   - are scoped to one source: the log's source and derived source are set to
+//     the token's source whatever the client sends
+//   - expire after ttl (default 1h, at most 24h)
+//
+// CORS preflight requests to /api/logs are answered without authentication so
+// browsers can send the Authorization header.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ingestTokenPrefix marks ingest tokens in the Authorization header
+const ingestTokenPrefix = "cit_"
+
+// Ingest token lifetimes
+const (
+	defaultIngestTokenTTL = time.Hour
+	maxIngestTokenTTL     = 24 * time.Hour
+)
+
+// errInvalidIngestToken covers malformed, forged and expired tokens alike
+var errInvalidIngestToken = errors.New("invalid or expired ingest token")
+
+// ingestClaims is the signed content of a token
+type ingestClaims struct {
+	Source  string `json:"src"`
+	Expires int64  `json:"exp"` // unix seconds
+}
+
+// ingestSourceKey carries a token's source in the request context
+type ingestSourceKey struct{}
+
+// mintIngestToken returns a signed token for source valid for ttl
+func mintIngestToken(source string, ttl time.Duration) (string, time.Time, error) {
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	claims, err := json.Marshal(ingestClaims{Source: source, Expires: expires.Unix()})
+	if err != nil {
+		return "", expires, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(claims)
+	signature, err := signPayload([]byte(encoded))
+	if err != nil {
+		return "", expires, err
+	}
+	return ingestTokenPrefix + encoded + "." + strings.TrimPrefix(signature, signaturePrefix), expires, nil
+}
+
+// parseIngestToken checks a token's signature and expiry
+func parseIngestToken(token string) (ingestClaims, error) {
+	var claims ingestClaims
+	encoded, signature, ok := strings.Cut(strings.TrimPrefix(token, ingestTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, ingestTokenPrefix) || !verifyPayload([]byte(encoded), signaturePrefix+signature) {
+		return claims, errInvalidIngestToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(decoded, &claims) != nil || claims.Source == "" {
+		return claims, errInvalidIngestToken
+	}
+	if time.Now().Unix() >= claims.Expires {
+		return claims, errInvalidIngestToken
+	}
+	return claims, nil
+}
+
+// ingestTokenSource returns the source a request's ingest token is scoped to ("" without token)
+func ingestTokenSource(r *http.Request) string {
+	source, _ := r.Context().Value(ingestSourceKey{}).(string)
+	return source
+}
+
+// ingestAuthMiddleware accepts ingest tokens for POST requests and falls back to authMiddleware
+func ingestAuthMiddleware(apiKey string, handler http.HandlerFunc) http.HandlerFunc {
+	authenticated := authMiddleware(apiKey, handler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Browsers send preflights without credentials
+		if r.Method == http.MethodOptions {
+			handler(w, r)
+			return
+		}
+
+		token := requestAPIKey(r)
+		if !strings.HasPrefix(token, ingestTokenPrefix) {
+			authenticated(w, r)
+			return
+		}
+		claims, err := parseIngestToken(token)
+		if err != nil || r.Method != http.MethodPost {
+			http.Error(w, "Unauthorized - Invalid or expired ingest token", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), ingestSourceKey{}, claims.Source)))
+	}
+}
+
+// handleIngestToken answers POST /api/tokens/ingest
+func handleIngestToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request struct {
+		Source string `json:"source"`
+		TTL    string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	request.Source = strings.TrimSpace(request.Source)
+	if request.Source == "" {
+		http.Error(w, "source is required", http.StatusBadRequest)
+		return
+	}
+
+	ttl := defaultIngestTokenTTL
+	if request.TTL != "" {
+		parsed, err := time.ParseDuration(request.TTL)
+		if err != nil || parsed <= 0 || parsed > maxIngestTokenTTL {
+			http.Error(w, fmt.Sprintf("ttl must be a duration up to %s", maxIngestTokenTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+
+	token, expires, err := mintIngestToken(request.Source, ttl)
+	if err != nil {
+		http.Error(w, "Failed to sign token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"source":     request.Source,
+		"expires_at": expires.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIngestTokens tests minting tokens and logging with them
+func TestIngestTokens(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureSigning("", ":memory:", "sqlite3")
+
+	w := httptest.NewRecorder()
+	handleIngestToken(w, httptest.NewRequest("POST", "/api/tokens/ingest", strings.NewReader(`{"source":"web-checkout","ttl":"15m"}`)))
+	var minted map[string]string
+	json.Unmarshal(w.Body.Bytes(), &minted)
+	token := minted["token"]
+	if w.Code != http.StatusOK || !strings.HasPrefix(token, ingestTokenPrefix) {
+		t.Fatalf("Expected a token, got %d: %s", w.Code, w.Body.String())
+	}
+
+	handler := ingestAuthMiddleware("server-key", handleLogs)
+	send := func(method, token, body string) int {
+		req := httptest.NewRequest(method, "/api/logs", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// The token's source wins over anything the client sends
+	if code := send("POST", token, `{"header":{"title":"Checkout failed","source":"admin-api"},"body":{"service":"billing"}}`); code != http.StatusCreated {
+		t.Fatalf("Expected the token to allow logging, got %d", code)
+	}
+	var source, derived string
+	db.QueryRow("SELECT source, derived_source FROM logs").Scan(&source, &derived)
+	if source != "web-checkout" || derived != "web-checkout" {
+		t.Errorf("Expected source web-checkout, got %s/%s", source, derived)
+	}
+
+	if code := send("GET", token, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected tokens to be refused for reading, got %d", code)
+	}
+	forged := token[:len(token)-1] + map[bool]string{true: "1", false: "0"}[strings.HasSuffix(token, "0")]
+	if code := send("POST", forged, `{"header":{"title":"forged"}}`); code != http.StatusUnauthorized {
+		t.Errorf("Expected a forged token to be refused, got %d", code)
+	}
+	expired, _, _ := mintIngestToken("web-checkout", -time.Minute)
+	if code := send("POST", expired, `{"header":{"title":"late"}}`); code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired token to be refused, got %d", code)
+	}
+	if code := send("OPTIONS", "", ""); code != http.StatusOK {
+		t.Errorf("Expected CORS preflight to pass, got %d", code)
+	}
+}
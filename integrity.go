@@ -0,0 +1,362 @@
+// CubicLog Integrity Check & Repair - Verify and rescue the SQLite database
+//
+//	cubiclog -check            # report problems, exit 1 if any
+//	cubiclog -check -repair    # fix what can be fixed
+//
+// CHECKS:
+//   - PRAGMA integrity_check (page-level corruption)
+//   - FTS5 index verification for any full-text tables
+//   - Logs missing derived metadata (severity/source/category)
+//   - Log bodies that are not valid JSON
+//
+// REPAIR:
+//   - REINDEX and FTS5 rebuild
+//   - Re-derive missing metadata from the stored log content
+//   - When the file itself is corrupt, salvage every readable row into a fresh
+//     database, move the damaged file aside and put the fresh one in its place
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// salvageBatchSize is the rowid window copied at once during salvage; failing
+// windows are retried row by row so one bad page only costs its own rows
+const salvageBatchSize = 500
+
+// integrityReport summarises the findings of a check run
+type integrityReport struct {
+	Corrupt         []string // integrity_check messages other than "ok"
+	FTSErrors       []string // FTS tables failing verification
+	MissingMetadata int      // logs without derived metadata
+	InvalidBodies   int      // logs whose body is not valid JSON
+}
+
+// ok reports whether the database passed every check
+func (r integrityReport) ok() bool {
+	return len(r.Corrupt) == 0 && len(r.FTSErrors) == 0 && r.MissingMetadata == 0 && r.InvalidBodies == 0
+}
+
+// checkIntegrity runs all checks against the current database
+func checkIntegrity() integrityReport {
+	report := integrityReport{}
+
+	if rows, err := db.Query("PRAGMA integrity_check"); err != nil {
+		report.Corrupt = append(report.Corrupt, err.Error())
+	} else {
+		for rows.Next() {
+			var msg string
+			rows.Scan(&msg)
+			if msg != "ok" {
+				report.Corrupt = append(report.Corrupt, msg)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			report.Corrupt = append(report.Corrupt, err.Error())
+		}
+		rows.Close()
+	}
+
+	for _, table := range ftsTables() {
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO %s(%s) VALUES('integrity-check')", table, table)); err != nil {
+			report.FTSErrors = append(report.FTSErrors, fmt.Sprintf("%s: %v", table, err))
+		}
+	}
+
+	db.QueryRow(`SELECT COUNT(*) FROM logs
+		WHERE derived_severity IS NULL OR derived_source IS NULL OR derived_category IS NULL`).Scan(&report.MissingMetadata)
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE body IS NOT NULL AND body NOT LIKE ? AND json_valid(body) = 0",
+		encryptedPrefix+"%").Scan(&report.InvalidBodies)
+
+	return report
+}
+
+// ftsTables lists the FTS5 virtual tables in the database
+func ftsTables() []string {
+	var tables []string
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND sql LIKE '%USING fts5%'")
+	if err != nil {
+		return tables
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			tables = append(tables, name)
+		}
+	}
+	return tables
+}
+
+// rederiveMissingMetadata fills derived columns for logs that lack them
+func rederiveMissingMetadata() (int, error) {
+	rows, err := db.Query(`SELECT id, type, title, description, source, body FROM logs
+		WHERE derived_severity IS NULL OR derived_source IS NULL OR derived_category IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+
+	type pending struct {
+		id       int
+		metadata LogMetadata
+	}
+	var updates []pending
+	for rows.Next() {
+		var id int
+		var header LogHeader
+		var description, source, body sql.NullString
+		if err := rows.Scan(&id, &header.Type, &header.Title, &description, &source, &body); err != nil {
+			continue
+		}
+		// Rows that can't be decrypted keep their metadata rather than get it from empty fields
+		plainDescription, err := decryptField(description.String)
+		if err != nil {
+			continue
+		}
+		plainBody, err := decryptField(body.String)
+		if err != nil {
+			continue
+		}
+		header.Description = plainDescription
+		header.Source = source.String
+
+		var parsed map[string]interface{}
+		json.Unmarshal([]byte(plainBody), &parsed)
+		updates = append(updates, pending{id: id, metadata: deriveMetadata(header, parsed)})
+	}
+	rows.Close()
+
+	fixed := 0
+	for _, u := range updates {
+		if _, err := db.Exec("UPDATE logs SET derived_severity = ?, derived_source = ?, derived_category = ?, derived_language = NULLIF(?, ''), derived_duration_ms = NULLIF(?, 0), derived_http_status = NULLIF(?, 0) WHERE id = ?",
+			u.metadata.DerivedSeverity, u.metadata.DerivedSource, u.metadata.DerivedCategory, u.metadata.DerivedLanguage, u.metadata.DerivedDurationMs, u.metadata.DerivedHTTPStatus, u.id); err == nil {
+			fixed++
+		}
+	}
+	if fixed > 0 {
+		invalidateHourlyStats()
+	}
+	return fixed, nil
+}
+
+// salvageDatabase copies every readable row of the open database into a fresh
+// file at freshPath and returns the number of rows rescued per table
+func salvageDatabase(freshPath string) (map[string]int, error) {
+	corrupt := db
+	fresh, err := openStore("sqlite3", freshPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fresh.Close()
+
+	// Build the current schema in the fresh file
+	db = fresh
+	err = createTable()
+	db = corrupt
+	if err != nil {
+		return nil, fmt.Errorf("could not create fresh schema: %v", err)
+	}
+
+	rescued := make(map[string]int)
+	for _, table := range salvageableTables(fresh) {
+		rescued[table] = salvageTable(corrupt, fresh, table)
+	}
+	return rescued, nil
+}
+
+// salvageableTables lists the regular tables of the fresh schema worth copying
+func salvageableTables(fresh Store) []string {
+	var tables []string
+	rows, err := fresh.Query(`SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND sql NOT LIKE '%VIRTUAL TABLE%'`)
+	if err != nil {
+		return tables
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			tables = append(tables, name)
+		}
+	}
+	return tables
+}
+
+// salvageTable copies readable rows of one table window by window
+func salvageTable(from, to Store, table string) int {
+	var maxRowID int64
+	if err := from.QueryRow("SELECT COALESCE(MAX(rowid), 0) FROM " + table).Scan(&maxRowID); err != nil {
+		// The table b-tree root may be damaged; fall back to the autoincrement counter
+		from.QueryRow("SELECT COALESCE(seq, 0) FROM sqlite_sequence WHERE name = ?", table).Scan(&maxRowID)
+	}
+
+	copied := 0
+	for start := int64(0); start <= maxRowID; start += salvageBatchSize {
+		end := start + salvageBatchSize - 1
+		n, err := copyRowRange(from, to, table, start, end)
+		if err == nil {
+			copied += n
+			continue
+		}
+		// Retry the failing window one row at a time
+		for id := start; id <= end; id++ {
+			if n, err := copyRowRange(from, to, table, id, id); err == nil {
+				copied += n
+			}
+		}
+	}
+	return copied
+}
+
+// copyRowRange copies rows with rowid in [start, end] between databases
+func copyRowRange(from, to Store, table string, start, end int64) (int, error) {
+	rows, err := from.Query("SELECT * FROM "+table+" WHERE rowid BETWEEN ? AND ?", start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	insert := fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", table,
+		strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+
+	var batch [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return 0, err
+		}
+		batch = append(batch, values)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for _, values := range batch {
+		if _, err := to.Exec(insert, values...); err == nil {
+			copied++
+		}
+	}
+	return copied, nil
+}
+
+// replaceWithSalvage salvages dbPath into a fresh file, moves the damaged file
+// aside and puts the fresh database in its place. db is reopened on success.
+func replaceWithSalvage(dbPath string) (string, map[string]int, error) {
+	stamp := time.Now().Format("20060102-150405")
+	freshPath := dbPath + ".salvage-" + stamp
+	asidePath := dbPath + ".corrupt-" + stamp
+
+	rescued, err := salvageDatabase(freshPath)
+	if err != nil {
+		os.Remove(freshPath)
+		return "", nil, err
+	}
+
+	db.Close()
+	if err := os.Rename(dbPath, asidePath); err != nil {
+		return "", nil, fmt.Errorf("could not move damaged database aside: %v", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Rename(dbPath+suffix, asidePath+suffix)
+	}
+	if err := os.Rename(freshPath, dbPath); err != nil {
+		return "", nil, fmt.Errorf("could not install salvaged database: %v", err)
+	}
+
+	db, err = openStore("sqlite3", dbPath)
+	return asidePath, rescued, err
+}
+
+// handleCheck implements the -check and -repair commands
+func handleCheck(dbPath string, repair bool) {
+	if db.Driver() != "sqlite3" {
+		fmt.Printf("❌ Integrity checks are only available for SQLite\n")
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔍 Checking %s...\n", dbPath)
+	report := checkIntegrity()
+	printIntegrityReport(report)
+
+	if report.ok() {
+		fmt.Printf("✅ Database is healthy\n")
+		return
+	}
+	if !repair {
+		fmt.Printf("❌ Problems found - run with -repair to fix them\n")
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔧 Repairing...\n")
+	if len(report.Corrupt) > 0 {
+		aside, rescued, err := replaceWithSalvage(dbPath)
+		if err != nil {
+			fmt.Printf("❌ Salvage failed: %v\n", err)
+			os.Exit(1)
+		}
+		for table, count := range rescued {
+			fmt.Printf("   rescued %d rows from %s\n", count, table)
+		}
+		fmt.Printf("   damaged database kept at %s\n", aside)
+	}
+
+	if _, err := db.Exec("REINDEX"); err != nil {
+		log.Printf("⚠️  REINDEX failed: %v", err)
+	}
+	for _, table := range ftsTables() {
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO %s(%s) VALUES('rebuild')", table, table)); err != nil {
+			log.Printf("⚠️  FTS rebuild of %s failed: %v", table, err)
+		}
+	}
+	if fixed, err := rederiveMissingMetadata(); err == nil && fixed > 0 {
+		fmt.Printf("   re-derived metadata for %d logs\n", fixed)
+	}
+
+	// Invalid bodies cannot be reconstructed; report them rather than guessing
+	final := checkIntegrity()
+	printIntegrityReport(final)
+	if len(final.Corrupt) > 0 || len(final.FTSErrors) > 0 || final.MissingMetadata > 0 {
+		fmt.Printf("❌ Some problems could not be repaired\n")
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Repair completed\n")
+}
+
+// printIntegrityReport prints one line per check
+func printIntegrityReport(r integrityReport) {
+	if len(r.Corrupt) == 0 {
+		fmt.Printf("   ✅ integrity_check: ok\n")
+	} else {
+		fmt.Printf("   ❌ integrity_check: %d problems (first: %s)\n", len(r.Corrupt), r.Corrupt[0])
+	}
+	if len(r.FTSErrors) == 0 {
+		fmt.Printf("   ✅ full-text indexes: ok\n")
+	} else {
+		fmt.Printf("   ❌ full-text indexes: %s\n", strings.Join(r.FTSErrors, "; "))
+	}
+	if r.MissingMetadata == 0 {
+		fmt.Printf("   ✅ derived metadata: ok\n")
+	} else {
+		fmt.Printf("   ⚠️  derived metadata: %d logs missing\n", r.MissingMetadata)
+	}
+	if r.InvalidBodies == 0 {
+		fmt.Printf("   ✅ log bodies: ok\n")
+	} else {
+		fmt.Printf("   ⚠️  log bodies: %d are not valid JSON\n", r.InvalidBodies)
+	}
+}
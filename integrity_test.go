@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// TestIntegrityCheckAndSalvage tests detection of derived data gaps and salvaging rows into a fresh file
+func TestIntegrityCheckAndSalvage(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.Exec("INSERT INTO logs (type, title, color, body) VALUES ('error', 'Payment failed', 'red', '{\"service\": \"billing\"}')")
+	db.Exec("INSERT INTO logs (type, title, color, body) VALUES ('info', 'Broken body', 'blue', 'not json')")
+
+	report := checkIntegrity()
+	if len(report.Corrupt) != 0 {
+		t.Errorf("Expected no corruption, got %v", report.Corrupt)
+	}
+	if report.MissingMetadata != 2 {
+		t.Errorf("Expected 2 logs missing metadata, got %d", report.MissingMetadata)
+	}
+	if report.InvalidBodies != 1 {
+		t.Errorf("Expected 1 invalid body, got %d", report.InvalidBodies)
+	}
+
+	fixed, err := rederiveMissingMetadata()
+	if err != nil || fixed != 2 {
+		t.Errorf("Expected 2 logs re-derived, got %d (%v)", fixed, err)
+	}
+	var source string
+	db.QueryRow("SELECT derived_source FROM logs WHERE title = 'Payment failed'").Scan(&source)
+	if source != "billing" {
+		t.Errorf("Expected derived source 'billing', got '%s'", source)
+	}
+
+	freshPath := filepath.Join(t.TempDir(), "salvaged.db")
+	rescued, err := salvageDatabase(freshPath)
+	if err != nil {
+		t.Fatalf("Salvage failed: %v", err)
+	}
+	if rescued["logs"] != 2 {
+		t.Errorf("Expected 2 rescued logs, got %d", rescued["logs"])
+	}
+
+	conn, err := sql.Open("sqlite3", freshPath)
+	if err != nil {
+		t.Fatalf("Failed to open salvaged database: %v", err)
+	}
+	defer conn.Close()
+
+	var count int
+	conn.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity IS NOT NULL").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 salvaged logs with metadata, got %d", count)
+	}
+}
@@ -0,0 +1,306 @@
+// CubicLog Issue Trackers - Turn an error group into a GitHub, GitLab or Jira issue
+//
+// The tracker is configured with a JSON file given with -issue-tracker-file:
+//
+//	{"provider": "github", "repo": "acme/shop", "token_env": "GITHUB_TOKEN", "labels": ["bug"]}
+//	{"provider": "gitlab", "url": "https://gitlab.example.com", "project": "acme/shop", "token_env": "GITLAB_TOKEN"}
+//	{"provider": "jira", "url": "https://acme.atlassian.net", "project": "SHOP", "email": "bot@acme.com", "token_env": "JIRA_TOKEN"}
+//
+// POST /api/groups/{id}/issue opens an issue for the group (title, source,
+// counts and dashboard links) and stores its URL on the group. Posting again
+// adds a comment with the current counts and refreshes the issue's status
+// (open, closed, or the Jira workflow status), which the dashboard shows next
+// to the group. "token" may hold the token directly instead of "token_env";
+// "url" also points GitHub at an Enterprise server. Failed tracker requests
+// show up in /api/deliveries, where they can be retried (see deliveries.go).
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// issueTrackerConfig is the -issue-tracker-file
+type issueTrackerConfig struct {
+	Provider  string   `json:"provider"` // github, gitlab or jira
+	URL       string   `json:"url"`
+	Repo      string   `json:"repo"`    // github: owner/name
+	Project   string   `json:"project"` // gitlab: path or id, jira: project key
+	Email     string   `json:"email"`   // jira: account for basic auth
+	Token     string   `json:"token"`
+	TokenEnv  string   `json:"token_env"`
+	Labels    []string `json:"labels"`
+	IssueType string   `json:"issue_type"` // jira, default "Bug"
+}
+
+// issueTracker is nil when no tracker is configured
+var issueTracker *issueTrackerConfig
+
+// issueClient talks to the tracker
+var issueClient = &http.Client{Timeout: 15 * time.Second}
+
+// issueMu keeps two requests from opening two issues for one group
+var issueMu sync.Mutex
+
+// loadIssueTracker reads and validates the tracker file
+func loadIssueTracker(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read issue tracker file: %v", err)
+	}
+	var config issueTrackerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid issue tracker file: %v", err)
+	}
+
+	if config.TokenEnv != "" {
+		config.Token = os.Getenv(config.TokenEnv)
+	}
+	if config.Token == "" {
+		return fmt.Errorf("issue tracker needs a token (token or token_env)")
+	}
+	config.Provider = strings.ToLower(config.Provider)
+	switch config.Provider {
+	case "github":
+		if config.Repo == "" {
+			return fmt.Errorf("github needs repo (owner/name)")
+		}
+		config.URL = valueOr(config.URL, "https://api.github.com")
+	case "gitlab":
+		if config.Project == "" {
+			return fmt.Errorf("gitlab needs project")
+		}
+		config.URL = valueOr(config.URL, "https://gitlab.com")
+	case "jira":
+		if config.URL == "" || config.Project == "" || config.Email == "" {
+			return fmt.Errorf("jira needs url, project and email")
+		}
+		config.IssueType = valueOr(config.IssueType, "Bug")
+	default:
+		return fmt.Errorf("unknown issue tracker provider '%s' (github, gitlab or jira)", config.Provider)
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+
+	issueTracker = &config
+	return nil
+}
+
+// call sends one API request to the tracker and decodes the answer into out
+func (t *issueTrackerConfig) call(method, path string, payload, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	req, err := http.NewRequest(method, t.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	switch t.Provider {
+	case "github":
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	case "gitlab":
+		req.Header.Set("PRIVATE-TOKEN", t.Token)
+	case "jira":
+		req.SetBasicAuth(t.Email, t.Token)
+	}
+
+	resp, err := issueClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &deliveryStatusError{Code: resp.StatusCode,
+			Message: fmt.Sprintf("%s answered %d: %s", t.Provider, resp.StatusCode, strings.TrimSpace(string(detail)))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// issuePath is the API path of an issue (or of the issue list for key "")
+func (t *issueTrackerConfig) issuePath(key string) string {
+	var path string
+	switch t.Provider {
+	case "github":
+		path = "/repos/" + t.Repo + "/issues"
+	case "gitlab":
+		path = "/api/v4/projects/" + url.PathEscape(t.Project) + "/issues"
+	case "jira":
+		path = "/rest/api/2/issue"
+	}
+	if key != "" {
+		path += "/" + key
+	}
+	return path
+}
+
+// createIssue opens an issue and returns its key and URL
+func (t *issueTrackerConfig) createIssue(title, text string) (key, link string, err error) {
+	switch t.Provider {
+	case "github":
+		var created struct {
+			Number  int    `json:"number"`
+			HTMLURL string `json:"html_url"`
+		}
+		err = t.call("POST", t.issuePath(""), map[string]interface{}{"title": title, "body": text, "labels": t.Labels}, &created)
+		return fmt.Sprint(created.Number), created.HTMLURL, err
+	case "gitlab":
+		var created struct {
+			IID    int    `json:"iid"`
+			WebURL string `json:"web_url"`
+		}
+		err = t.call("POST", t.issuePath(""), map[string]interface{}{"title": title, "description": text,
+			"labels": strings.Join(t.Labels, ",")}, &created)
+		return fmt.Sprint(created.IID), created.WebURL, err
+	default:
+		var created struct {
+			Key string `json:"key"`
+		}
+		err = t.call("POST", t.issuePath(""), map[string]interface{}{"fields": map[string]interface{}{
+			"project": map[string]string{"key": t.Project}, "summary": title, "description": text,
+			"issuetype": map[string]string{"name": t.IssueType}, "labels": t.Labels}}, &created)
+		return created.Key, t.URL + "/browse/" + created.Key, err
+	}
+}
+
+// commentIssue adds a comment to an issue
+func (t *issueTrackerConfig) commentIssue(key, text string) error {
+	switch t.Provider {
+	case "github":
+		return t.call("POST", t.issuePath(key)+"/comments", map[string]string{"body": text}, nil)
+	case "gitlab":
+		return t.call("POST", t.issuePath(key)+"/notes", map[string]string{"body": text}, nil)
+	default:
+		return t.call("POST", t.issuePath(key)+"/comment", map[string]string{"body": text}, nil)
+	}
+}
+
+// issueStatus returns the current status of an issue ("open", "closed", or the Jira status)
+func (t *issueTrackerConfig) issueStatus(key string) (string, error) {
+	var issue struct {
+		State  string `json:"state"`
+		Fields struct {
+			Status struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	path := t.issuePath(key)
+	if t.Provider == "jira" {
+		path += "?fields=status"
+	}
+	if err := t.call("GET", path, nil, &issue); err != nil {
+		return "", err
+	}
+	if t.Provider == "jira" {
+		return strings.ToLower(issue.Fields.Status.Name), nil
+	}
+	if issue.State == "opened" { // gitlab
+		return "open", nil
+	}
+	return issue.State, nil
+}
+
+// groupIssueText describes an error group for the tracker
+func groupIssueText(g ErrorGroup) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "CubicLog error group #%d from %s\n\n", g.ID, g.Source)
+	fmt.Fprintf(&text, "- Title: %s\n", g.Title)
+	fmt.Fprintf(&text, "- Severity: %s\n", g.Severity)
+	fmt.Fprintf(&text, "- Occurrences: %d\n", g.Count)
+	fmt.Fprintf(&text, "- First seen: %s\n", g.FirstSeen.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&text, "- Last seen: %s\n", g.LastSeen.UTC().Format(time.RFC3339))
+	if g.LastLogID > 0 {
+		fmt.Fprintf(&text, "- Latest log: %s\n", dashboardLink(fmt.Sprintf("/logs/%d", g.LastLogID)))
+	}
+	fmt.Fprintf(&text, "- Fingerprint: %s\n", g.Fingerprint)
+	return text.String()
+}
+
+// handleGroupIssue answers POST /api/groups/{id}/issue
+func handleGroupIssue(w http.ResponseWriter, r *http.Request, id int64) {
+	if issueTracker == nil {
+		http.Error(w, "No issue tracker configured (-issue-tracker-file)", http.StatusNotImplemented)
+		return
+	}
+	issueMu.Lock()
+	defer issueMu.Unlock()
+
+	group, err := loadErrorGroup(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Error group not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load error group", http.StatusInternalServerError)
+		return
+	}
+
+	action, err := syncGroupIssue(&group, &Delivery{Kind: "issue", Reference: group.ID, Target: issueTracker.URL})
+	if err != nil {
+		http.Error(w, "Issue tracker error: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err := linkGroupIssue(group); err != nil {
+		http.Error(w, "Failed to link issue", http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusOK
+	if action == "created" {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"action": action, "group": group})
+}
+
+// syncGroupIssue opens the issue of a group, or comments on it and refreshes
+// its status, and records the delivery (issueMu held)
+func syncGroupIssue(group *ErrorGroup, delivery *Delivery) (action string, err error) {
+	action = "commented"
+	if group.IssueKey == "" {
+		action = "created"
+		group.IssueKey, group.IssueURL, err = issueTracker.createIssue(truncateTitle(fmt.Sprintf("[%s] %s", group.Source, group.Title)), groupIssueText(*group))
+		group.IssueStatus = "open"
+	} else {
+		err = issueTracker.commentIssue(group.IssueKey, fmt.Sprintf("Still happening: %d occurrences, last seen %s.\n\n%s",
+			group.Count, group.LastSeen.UTC().Format(time.RFC3339), groupIssueText(*group)))
+		if err == nil {
+			group.IssueStatus, err = issueTracker.issueStatus(group.IssueKey)
+		}
+	}
+	recordDelivery(delivery, 0, err)
+	return action, err
+}
+
+// linkGroupIssue stores the issue of a group
+func linkGroupIssue(group ErrorGroup) error {
+	_, err := db.Exec(db.Rebind("UPDATE error_groups SET issue_url = ?, issue_key = ?, issue_status = ? WHERE id = ?"),
+		group.IssueURL, group.IssueKey, group.IssueStatus, group.ID)
+	return err
+}
+
+// truncateTitle keeps issue titles within tracker limits
+func truncateTitle(title string) string {
+	if runes := []rune(title); len(runes) > 250 {
+		return string(runes[:250]) + "…"
+	}
+	return title
+}
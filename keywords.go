@@ -0,0 +1,130 @@
+// CubicLog Keyword Engine - Aho-Corasick matching for the smart pattern tables
+//
+// Classifying a log used to run one strings.Contains per keyword - a few hundred
+// substring scans over the same text. A keywordMatcher compiles a keyword list
+// into a single automaton (a DFA over the bytes that occur in the keywords), so
+// one pass over the text finds every keyword at once, however long the list.
+//
+// Matching is case-insensitive for ASCII: keywords are lowercased when the
+// matcher is built and text bytes are folded while scanning.
+package main
+
+import "strings"
+
+// keywordMatcher is a compiled Aho-Corasick automaton
+type keywordMatcher struct {
+	keywords []string
+	classes  [256]uint8 // byte -> alphabet class (0 = byte not used by any keyword)
+	width    int        // number of alphabet classes
+	next     []int32    // DFA transitions: next[state*width+class]
+	output   []int32    // keyword index ending at a state (following dictionary links), -1 if none
+}
+
+// newKeywordMatcher compiles keywords into a matcher
+func newKeywordMatcher(keywords []string) *keywordMatcher {
+	m := &keywordMatcher{keywords: make([]string, len(keywords))}
+	for i, keyword := range keywords {
+		m.keywords[i] = strings.ToLower(keyword)
+	}
+
+	// Alphabet: only bytes that appear in keywords get their own class
+	m.width = 1
+	for _, keyword := range m.keywords {
+		for i := 0; i < len(keyword); i++ {
+			if m.classes[keyword[i]] == 0 {
+				m.classes[keyword[i]] = uint8(m.width)
+				m.width++
+			}
+		}
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		m.classes[c-'a'+'A'] = m.classes[c]
+	}
+
+	// Trie
+	m.next = make([]int32, m.width)
+	m.output = []int32{-1}
+	for index, keyword := range m.keywords {
+		state := int32(0)
+		for i := 0; i < len(keyword); i++ {
+			class := int(m.classes[keyword[i]])
+			if m.next[int(state)*m.width+class] == 0 {
+				m.next = append(m.next, make([]int32, m.width)...)
+				m.output = append(m.output, -1)
+				m.next[int(state)*m.width+class] = int32(len(m.output) - 1)
+			}
+			state = m.next[int(state)*m.width+class]
+		}
+		if m.output[state] == -1 {
+			m.output[state] = int32(index)
+		}
+	}
+
+	// Failure links, breadth first; missing transitions become DFA jumps
+	fail := make([]int32, len(m.output))
+	queue := []int32{}
+	for class := 0; class < m.width; class++ {
+		if child := m.next[class]; child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		if m.output[state] == -1 {
+			m.output[state] = m.output[fail[state]]
+		}
+		for class := 0; class < m.width; class++ {
+			child := m.next[int(state)*m.width+class]
+			if child == 0 {
+				m.next[int(state)*m.width+class] = m.next[int(fail[state])*m.width+class]
+				continue
+			}
+			fail[child] = m.next[int(fail[state])*m.width+class]
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// firstMatch returns the index of the keyword whose occurrence ends first in
+// text, or -1 when no keyword occurs
+func (m *keywordMatcher) firstMatch(text string) int {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		state = m.next[int(state)*m.width+int(m.classes[text[i]])]
+		if m.output[state] >= 0 {
+			return int(m.output[state])
+		}
+	}
+	return -1
+}
+
+// containsAny reports whether any keyword occurs in text
+func (m *keywordMatcher) containsAny(text string) bool {
+	return m.firstMatch(text) >= 0
+}
+
+// newPatternMatcher compiles the keys of a pattern -> severity table and
+// returns the matcher with the severities in keyword order
+func newPatternMatcher(patterns map[string]string) (*keywordMatcher, []string) {
+	keywords := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		keywords = append(keywords, pattern)
+	}
+	m := newKeywordMatcher(keywords)
+
+	severities := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		severities[i] = patterns[keyword]
+	}
+	return m, severities
+}
+
+// matchSeverity returns the severity of the first pattern found in text
+func matchSeverity(m *keywordMatcher, severities []string, text string) string {
+	if index := m.firstMatch(text); index >= 0 {
+		return severities[index]
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestKeywordMatcher tests that the automaton agrees with plain substring search
+func TestKeywordMatcher(t *testing.T) {
+	texts := []string{
+		"Payment FAILED for order 1234",
+		"Connection to db timed out after 30s",
+		"all systems operational",
+		"segfault in worker (core dumped)",
+		"she said hershey", // overlapping keywords
+		"Traceback (most recent call last):\n  File \"app.py\", line 3",
+		"nothing to see here",
+		"",
+	}
+	lists := [][]string{errorKeywords, warningKeywords, successKeywords, debugKeywords, securityPatterns, stackTraceIndicators, {"he", "she", "his", "hers"}}
+
+	for _, keywords := range lists {
+		matcher := newKeywordMatcher(keywords)
+		for _, text := range texts {
+			expected := false
+			for _, keyword := range keywords {
+				if strings.Contains(strings.ToLower(text), strings.ToLower(keyword)) {
+					expected = true
+					break
+				}
+			}
+			if got := matcher.containsAny(text); got != expected {
+				t.Errorf("containsAny(%q) with %v: expected %v, got %v", text, keywords[:2], expected, got)
+			}
+		}
+	}
+
+	if severity := detectDatabaseIssue("ERROR: DEADLOCK detected"); severity != "critical" {
+		t.Errorf("Expected 'critical' for deadlock, got '%s'", severity)
+	}
+	if severity := detectSystemError("connect econnrefused 127.0.0.1:5432"); severity != "error" {
+		t.Errorf("Expected 'error' for ECONNREFUSED, got '%s'", severity)
+	}
+}
+
+// BenchmarkDeriveMetadata measures the classification cost per log
+func BenchmarkDeriveMetadata(b *testing.B) {
+	header := LogHeader{Title: "Request handled", Description: "GET /api/orders returned 200 in 45ms"}
+	body := map[string]interface{}{"service": "orders", "user_id": 42, "path": "/api/orders"}
+	for i := 0; i < b.N; i++ {
+		deriveMetadata(header, body)
+	}
+}
@@ -0,0 +1,115 @@
+// CubicLog Languages - Which runtime a log came from, for polyglot systems
+//
+//	GET /api/logs?language=python&severity=error
+//
+// Every log gets a derived_language at ingestion: go, python, kotlin, java,
+// dotnet, javascript, ruby, php or rust. A language, lang or platform body
+// field naming one of them wins (Sentry events carry platform, see sentry.go);
+// otherwise the stack trace and content are recognised by their frames
+// ("File "app.py", line 3", "at Foo.bar(Foo.java:12)", "goroutine 1 [running]",
+// "at charge (payments.js:42:7)", ...). Logs without either stay without a
+// language. The filter accepts aliases such as node, golang or csharp.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// languages are the derived languages, in detection order (more specific frames first)
+var languages = []string{"go", "python", "kotlin", "java", "dotnet", "javascript", "ruby", "php", "rust"}
+
+// languageAliases map other names (and Sentry platforms) to a language
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "python3": "python", "jvm": "java", "kt": "kotlin",
+	"node": "javascript", "nodejs": "javascript", "js": "javascript", "typescript": "javascript", "ts": "javascript",
+	"csharp": "dotnet", "c#": "dotnet", ".net": "dotnet", "net": "dotnet", "rb": "ruby",
+}
+
+// languagePatterns recognise the stack frames and runtime messages of each language
+// (matched against the JSON-encoded body too, where line breaks read \n)
+var languagePatterns = map[string][]*regexp.Regexp{
+	"go": {
+		regexp.MustCompile(`goroutine \d+ \[`),
+		regexp.MustCompile(`\.go:\d+`),
+	},
+	"python": {
+		regexp.MustCompile(`Traceback \(most recent call last\)`),
+		regexp.MustCompile(`File \\?"[^"\\]+\.py\\?", line \d+`),
+		regexp.MustCompile(`\.py:\d+`),
+	},
+	"java": {
+		regexp.MustCompile(`at [\w$.]+\([\w$]+\.java:\d+\)`),
+		regexp.MustCompile(`Exception in thread \\?"`),
+		regexp.MustCompile(`\bjava\.(lang|util|io|net|sql)\.\w+`),
+	},
+	"kotlin": {
+		regexp.MustCompile(`at [\w$.]+\([\w$]+\.kt:\d+\)`),
+		regexp.MustCompile(`\bkotlin\.\w+Exception`),
+	},
+	"dotnet": {
+		regexp.MustCompile(`\.cs:line \d+`),
+		regexp.MustCompile(`\bSystem\.(\w+\.)*\w*Exception\b`),
+	},
+	"javascript": {
+		regexp.MustCompile(`\.(m?js|cjs|tsx?|jsx):\d+:\d+`),
+		regexp.MustCompile(`node:internal/`),
+		regexp.MustCompile(`at Object\.<anonymous>`),
+		regexp.MustCompile(`Unhandled(Promise)?Rejection`),
+	},
+	"ruby": {
+		regexp.MustCompile("\\.rb:\\d+:in [`']"),
+	},
+	"php": {
+		regexp.MustCompile(`PHP (Fatal error|Warning|Notice|Parse error)`),
+		regexp.MustCompile(`\.php(:\d+| on line \d+|\(\d+\))`),
+	},
+	"rust": {
+		regexp.MustCompile(`thread '[^']*' panicked at`),
+		regexp.MustCompile(`\.rs:\d+:\d+`),
+	},
+}
+
+// languageFields are body fields naming the language outright
+var languageFields = []string{"language", "lang", "platform"}
+
+// normalizeLanguage returns the language a name stands for ("" if none)
+func normalizeLanguage(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := languageAliases[name]; ok {
+		return alias
+	}
+	if containsString(languages, name) {
+		return name
+	}
+	return ""
+}
+
+// detectLanguage derives the language of a log from its body fields or its text
+func detectLanguage(text string, body map[string]interface{}) string {
+	for _, field := range languageFields {
+		if value, ok := body[field].(string); ok {
+			if language := normalizeLanguage(value); language != "" {
+				return language
+			}
+		}
+	}
+	for _, language := range languages {
+		for _, pattern := range languagePatterns[language] {
+			if pattern.MatchString(text) {
+				return language
+			}
+		}
+	}
+	return ""
+}
+
+// parseLanguageFilter validates the ?language= filter
+func parseLanguageFilter(value string) (string, error) {
+	language := normalizeLanguage(value)
+	if language == "" {
+		return "", fmt.Errorf("unknown language '%s' - use %s", value, strings.Join(languages, ", "))
+	}
+	return language, nil
+}
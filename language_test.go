@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDerivedLanguage tests deriving, storing and filtering the language of logs
+func TestDerivedLanguage(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	cases := []struct {
+		body     string
+		expected string
+	}{
+		{`{"header":{"title":"Job crashed"},"body":{"trace":"Traceback (most recent call last):\n  File \"worker.py\", line 12, in run\nKeyError: 'id'"}}`, "python"},
+		{`{"header":{"title":"NPE"},"body":{"trace":"java.lang.NullPointerException\n\tat com.shop.Cart.total(Cart.java:42)"}}`, "java"},
+		{`{"header":{"title":"Crash"},"body":{"trace":"at com.shop.Cart.total(Cart.kt:42)\n\tat java.lang.Thread.run(Thread.java:833)"}}`, "kotlin"},
+		{`{"header":{"title":"panic: runtime error"},"body":{"trace":"goroutine 1 [running]:\nmain.main()\n\t/app/main.go:14 +0x1d"}}`, "go"},
+		{`{"header":{"title":"TypeError"},"body":{"stack":"at charge (/srv/payments.js:42:7)"}}`, "javascript"},
+		{`{"header":{"title":"Unhandled"},"body":{"trace":"at Shop.Cart.Total() in /src/Cart.cs:line 42"}}`, "dotnet"},
+		{`{"header":{"title":"Event"},"body":{"platform":"node"}}`, "javascript"},
+		{`{"header":{"title":"User signed in"}}`, ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(c.body)))
+		var created Log
+		json.Unmarshal(w.Body.Bytes(), &created)
+		var language string
+		db.QueryRow("SELECT COALESCE(derived_language, '') FROM logs WHERE id = ?", created.ID).Scan(&language)
+		if w.Code != 201 || language != c.expected {
+			t.Errorf("Expected language '%s' for %s, got %d '%s'", c.expected, c.body, w.Code, language)
+		}
+	}
+
+	list := func(query string) (int, []Log) {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		return w.Code, logs
+	}
+	if _, logs := list("?language=nodejs"); len(logs) != 2 {
+		t.Errorf("Expected 2 JavaScript logs for the nodejs alias, got %d", len(logs))
+	}
+	if _, logs := list("?language=python"); len(logs) != 1 || logs[0].Header.Title != "Job crashed" {
+		t.Errorf("Expected the Python log, got %+v", logs)
+	}
+	if code, _ := list("?language=cobol"); code != 400 {
+		t.Errorf("Expected status 400 for an unknown language, got %d", code)
+	}
+}
@@ -0,0 +1,144 @@
+// CubicLog Latency - Durations as a column for filters, sorting and percentiles
+//
+//	GET /api/logs?min_duration=3s&source=checkout   logs that took 3 seconds or more
+//	GET /api/logs?sort=duration                     slowest first
+//	GET /api/latency?since=24h&source=checkout      duration percentiles per source
+//
+// The duration a log mentions ("took 350ms", "duration: 2.5s", "elapsed: 500ms")
+// is extracted once, at ingestion, and stored in the indexed derived_duration_ms
+// column, so duration queries never run the patterns over stored logs again.
+// Logs without a duration have none (logs stored before the upgrade too).
+// min_duration and max_duration take milliseconds or Go durations (3000, 3s,
+// 1m30s, 250ms) and work on /api/logs and the bulk actions.
+//
+// /api/latency lists every source with durations in the window (default the
+// last 24 hours): the number of logs with a duration, the nearest-rank p50,
+// p90, p95 and p99, the maximum, all in milliseconds, and how many were fast
+// and how many slow by the source's thresholds (see performance.go).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseDurationFilter reads a duration filter as milliseconds ("3000", "3s", "250ms")
+func parseDurationFilter(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+		return ms, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration '%s' - use milliseconds or a duration like 3s", value)
+	}
+	return int(duration.Milliseconds()), nil
+}
+
+// LatencyStats are the duration percentiles of one source
+type LatencyStats struct {
+	Source string `json:"source"`
+	Count  int    `json:"count"` // logs with a duration
+	P50    int    `json:"p50_ms"`
+	P90    int    `json:"p90_ms"`
+	P95    int    `json:"p95_ms"`
+	P99    int    `json:"p99_ms"`
+	Max    int    `json:"max_ms"`
+	Fast   int    `json:"fast"` // logs below the fast threshold
+	Slow   int    `json:"slow"` // logs at or above the slow threshold
+
+	Thresholds performanceLimits `json:"thresholds"`
+}
+
+// nearestRank returns the p-th percentile of sorted durations
+func nearestRank(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// latencyStats summarizes sorted durations
+func latencyStats(source string, sorted []int) LatencyStats {
+	stats := LatencyStats{Source: source, Count: len(sorted), P50: nearestRank(sorted, 50), P90: nearestRank(sorted, 90),
+		P95: nearestRank(sorted, 95), P99: nearestRank(sorted, 99), Max: sorted[len(sorted)-1], Thresholds: performanceLimitsFor(source)}
+	for _, duration := range sorted {
+		if duration < stats.Thresholds.Fast {
+			stats.Fast++
+		}
+		if duration >= stats.Thresholds.Slow {
+			stats.Slow++
+		}
+	}
+	return stats
+}
+
+// loadLatencyStats reads the durations since a point in time, per source
+func loadLatencyStats(since time.Time, source string) ([]LatencyStats, error) {
+	query := `SELECT COALESCE(derived_source, 'unknown'), derived_duration_ms FROM logs
+		WHERE derived_duration_ms IS NOT NULL AND timestamp >= ?`
+	args := []interface{}{dbTime(since)}
+	if source != "" {
+		query += " AND derived_source = ?"
+		args = append(args, source)
+	}
+	rows, err := db.Query(db.Rebind(query+" ORDER BY derived_source, derived_duration_ms"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []LatencyStats{}
+	current, durations := "", []int{}
+	for rows.Next() {
+		var rowSource string
+		var duration int
+		if err := rows.Scan(&rowSource, &duration); err != nil {
+			return nil, err
+		}
+		if rowSource != current && len(durations) > 0 {
+			stats = append(stats, latencyStats(current, durations))
+			durations = []int{}
+		}
+		current = rowSource
+		durations = append(durations, duration)
+	}
+	if len(durations) > 0 {
+		stats = append(stats, latencyStats(current, durations))
+	}
+	return stats, rows.Err()
+}
+
+// handleLatency answers GET /api/latency?since=24h&source=
+func handleLatency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	since := 24 * time.Hour
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "since must be a duration like 1h or 24h", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	stats, err := loadLatencyStats(time.Now().Add(-since), r.URL.Query().Get("source"))
+	if err != nil {
+		http.Error(w, "Failed to load latency", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sources": stats})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLatency tests storing durations and filtering and summarizing by them
+func TestLatency(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, title := range []string{"Request took 120ms", "Checkout took 2.5s", "Checkout took 4s", "Cart emptied"} {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header": {"title": "`+title+`", "source": "checkout"}}`)))
+	}
+	var stored, withoutDuration int
+	db.QueryRow("SELECT derived_duration_ms FROM logs WHERE title = 'Checkout took 2.5s'").Scan(&stored)
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_duration_ms IS NULL").Scan(&withoutDuration)
+	if stored != 2500 || withoutDuration != 1 {
+		t.Errorf("Expected 2500ms stored and one log without a duration, got %d and %d", stored, withoutDuration)
+	}
+
+	titles := func(query string) (int, []string) {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs?"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		var titles []string
+		for _, l := range logs {
+			titles = append(titles, l.Header.Title)
+		}
+		return w.Code, titles
+	}
+	if _, got := titles("min_duration=3s"); len(got) != 1 || got[0] != "Checkout took 4s" {
+		t.Errorf("Expected only the 4s log, got %v", got)
+	}
+	if _, got := titles("min_duration=100&max_duration=2500&sort=duration"); len(got) != 2 || got[0] != "Checkout took 2.5s" {
+		t.Errorf("Expected the 2.5s and 120ms logs, slowest first, got %v", got)
+	}
+	if code, _ := titles("max_duration=fast"); code != 400 {
+		t.Errorf("Expected status 400 for an invalid duration, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handleLatency(w, httptest.NewRequest("GET", "/api/latency?source=checkout", nil))
+	var response struct {
+		Sources []LatencyStats `json:"sources"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Sources) != 1 {
+		t.Fatalf("Expected one source, got %+v", response.Sources)
+	}
+	if s := response.Sources[0]; s.Count != 3 || s.P50 != 2500 || s.P99 != 4000 || s.Max != 4000 || s.Slow != 1 {
+		t.Errorf("Expected percentiles over three durations, got %+v", s)
+	}
+}
@@ -0,0 +1,108 @@
+// CubicLog Size Limits - Keep oversized payloads out of SQLite
+//
+// Two limits protect the database:
+//   - -max-request-size caps the raw POST /api/logs request; larger requests are
+//     refused with 413 before they are read into memory
+//   - -max-body-size caps the stored JSON body
+//
+// OVERSIZE POLICY (-oversize-policy, for bodies above -max-body-size):
+//   - truncate (default): long strings are shortened until the body fits; if
+//     that is not enough the body is replaced by a preview. Truncated bodies
+//     carry "truncated": true and "original_size" so nothing is silently lost.
+//   - reject: the log is refused with 413
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Size limit settings - configured once in main()
+var (
+	maxRequestBytes int64 = 10 << 20   // largest accepted POST /api/logs request
+	maxBodyBytes          = 1 << 20    // largest stored JSON body
+	oversizePolicy        = "truncate" // truncate or reject
+)
+
+// smallestStringCap is the shortest length strings are truncated to before
+// falling back to a preview of the whole body
+const smallestStringCap = 64
+
+// validateOversizePolicy checks the -oversize-policy value
+func validateOversizePolicy(policy string) error {
+	switch policy {
+	case "truncate", "reject":
+		return nil
+	}
+	return fmt.Errorf("invalid oversize policy '%s' - use truncate or reject", policy)
+}
+
+// isRequestTooLarge reports whether a read failed because of -max-request-size
+func isRequestTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// truncateBody shrinks a body until its JSON encoding fits in limit bytes and
+// returns the new body together with its encoding
+func truncateBody(body map[string]interface{}, originalSize, limit int) (map[string]interface{}, []byte) {
+	for stringCap := limit / 4; stringCap >= smallestStringCap; stringCap /= 2 {
+		shrunk, _ := truncateStrings(body, stringCap).(map[string]interface{})
+		if shrunk == nil {
+			shrunk = map[string]interface{}{}
+		}
+		shrunk["truncated"] = true
+		shrunk["original_size"] = originalSize
+		if encoded, err := json.Marshal(shrunk); err == nil && len(encoded) <= limit {
+			return shrunk, encoded
+		}
+	}
+
+	// Too many keys rather than too long strings: keep a preview of the original
+	encoded, _ := json.Marshal(body)
+	preview := truncateString(string(encoded), limit/2)
+	shrunk := map[string]interface{}{
+		"truncated":     true,
+		"original_size": originalSize,
+		"preview":       preview,
+	}
+	encoded, _ = json.Marshal(shrunk)
+	return shrunk, encoded
+}
+
+// truncateStrings returns a copy of value with every string longer than maxLen shortened
+func truncateStrings(value interface{}, maxLen int) interface{} {
+	switch v := value.(type) {
+	case string:
+		return truncateString(v, maxLen)
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = truncateStrings(item, maxLen)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = truncateStrings(item, maxLen)
+		}
+		return copied
+	}
+	return value
+}
+
+// truncateString cuts s to at most maxLen bytes on a rune boundary, marking the cut
+func truncateString(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(s[:cut]) + "…"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBodySizeLimits tests truncating and rejecting oversized payloads
+func TestBodySizeLimits(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	originalRequest, originalBody, originalPolicy := maxRequestBytes, maxBodyBytes, oversizePolicy
+	defer func() { maxRequestBytes, maxBodyBytes, oversizePolicy = originalRequest, originalBody, originalPolicy }()
+	maxBodyBytes = 300
+
+	post := func() *httptest.ResponseRecorder {
+		payload := `{"header": {"title": "Huge dump"}, "body": {"dump": "` + strings.Repeat("x", 2000) + `", "service": "api"}}`
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", bytes.NewBufferString(payload)))
+		return w
+	}
+
+	if w := post(); w.Code != http.StatusCreated {
+		t.Fatalf("Expected truncated log to be stored, got %d", w.Code)
+	}
+	var stored string
+	db.QueryRow("SELECT body FROM logs").Scan(&stored)
+	var body map[string]interface{}
+	json.Unmarshal([]byte(stored), &body)
+	if len(stored) > maxBodyBytes || body["truncated"] != true || body["service"] != "api" {
+		t.Errorf("Expected truncated body under %d bytes keeping short fields, got %d bytes: %s", maxBodyBytes, len(stored), stored)
+	}
+
+	oversizePolicy = "reject"
+	if w := post(); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 with reject policy, got %d", w.Code)
+	}
+
+	maxBodyBytes = 0
+	maxRequestBytes = 100
+	if w := post(); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for oversized request, got %d", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+// CubicLog Listener - Choose where the HTTP server accepts connections
+//
+// -listen takes precedence over -port and accepts:
+//   - 127.0.0.1:8080                 only reachable from this machine
+//   - 0.0.0.0:8443 or :8443          every interface
+//   - unix:///var/run/cubiclog.sock  a Unix socket for a reverse proxy on the same host
+//
+// A stale socket file left behind by a crash is removed before listening; the
+// socket is removed again on shutdown. Socket permissions are 0660 so a proxy
+// running in the same group can connect.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixSocketPrefix marks a -listen value as a Unix socket path
+const unixSocketPrefix = "unix://"
+
+// parseListenAddress returns the network and address to listen on
+func parseListenAddress(listen, port string) (network, address string, err error) {
+	if listen == "" {
+		return "tcp", ":" + port, nil
+	}
+	if strings.HasPrefix(listen, unixSocketPrefix) {
+		path := strings.TrimPrefix(listen, unixSocketPrefix)
+		if path == "" {
+			return "", "", fmt.Errorf("missing socket path in '%s'", listen)
+		}
+		return "unix", path, nil
+	}
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		return "", "", fmt.Errorf("invalid listen address '%s' - use host:port or unix:///path/to.sock", listen)
+	}
+	return "tcp", listen, nil
+}
+
+// openListener starts listening on the configured address
+func openListener(network, address string) (net.Listener, error) {
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	// Only remove a leftover socket, never a regular file given by mistake
+	if info, err := os.Stat(address); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", address)
+		}
+		if conn, err := net.Dial("unix", address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", address)
+		}
+		os.Remove(address)
+	}
+
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(address, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// listenURL describes the listen address for the startup log
+func listenURL(network, address string) string {
+	if network == "unix" {
+		return unixSocketPrefix + address
+	}
+	host, port, _ := net.SplitHostPort(address)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		return fmt.Sprintf("http://localhost:%s (all interfaces)", port)
+	}
+	return "http://" + address
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestListenAddresses tests -listen parsing and serving over a Unix socket
+func TestListenAddresses(t *testing.T) {
+	cases := map[string][2]string{
+		"":                              {"tcp", ":8080"},
+		"127.0.0.1:9000":                {"tcp", "127.0.0.1:9000"},
+		"0.0.0.0:8443":                  {"tcp", "0.0.0.0:8443"},
+		"unix:///var/run/cubiclog.sock": {"unix", "/var/run/cubiclog.sock"},
+	}
+	for listen, expected := range cases {
+		network, address, err := parseListenAddress(listen, "8080")
+		if err != nil || network != expected[0] || address != expected[1] {
+			t.Errorf("Expected %s %s for '%s', got %s %s (%v)", expected[0], expected[1], listen, network, address, err)
+		}
+	}
+	if _, _, err := parseListenAddress("localhost", "8080"); err == nil {
+		t.Errorf("Expected error for address without port")
+	}
+
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// A stale socket file is replaced and requests are served over the socket
+	socket := filepath.Join(t.TempDir(), "cubiclog.sock")
+	stale, _ := net.Listen("unix", socket)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := openListener("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(handleHealth)}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0660 {
+		t.Errorf("Expected socket with mode 0660, got %v (%v)", info, err)
+	}
+	if _, err := openListener("unix", socket); err == nil {
+		t.Errorf("Expected error when the socket is in use")
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://cubiclog/health")
+	if err != nil {
+		t.Fatalf("Request over socket failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,109 @@
+// CubicLog Log Detail - One log with everything CubicLog derived from it
+//
+//	GET /api/logs/{id}    the log, its derived metadata and its body as stored
+//
+// The list endpoint returns what the log list shows; the dashboard's detail
+// drawer asks for a single log instead and gets its derived metadata (severity,
+// source, category, language, duration, HTTP status - see deriveMetadata),
+// its tags, acknowledgement and throttled repeats, and under "raw" the body
+// exactly as it was stored, before the dashboard pretty-prints it. With
+// -partition monthly the log is looked up in the partitions as well.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// logDetail is a log as GET /api/logs/{id} returns it
+type logDetail struct {
+	Log
+	Metadata LogMetadata `json:"metadata"`
+	Raw      string      `json:"raw"` // the body as stored (decrypted)
+}
+
+// loadLogDetail reads a log and its derived metadata (nil if there is no such log)
+func loadLogDetail(id int) (*logDetail, error) {
+	// The month of the log isn't known, so look through the partitions batch by batch
+	for _, batch := range partitionBatches() {
+		if d, err := loadLogDetailIn(id, batch[0], batch[1]); d != nil || err != nil {
+			return d, err
+		}
+	}
+	return nil, nil
+}
+
+// loadLogDetailIn is loadLogDetail reading the partitions between from and to
+func loadLogDetailIn(id int, from, to string) (*logDetail, error) {
+	rows, release, err := queryLogs(from, to, func(table string) (string, []interface{}) {
+		return `SELECT id, type, title, description, source, color, body, timestamp, environment, release,
+			derived_severity, derived_source, derived_category, derived_language, derived_duration_ms, derived_http_status
+			FROM ` + table + ` WHERE id = ?`, []interface{}{id}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var d logDetail
+	var description, source, color, body, environment, logRelease sql.NullString
+	var severity, derivedSource, category, language sql.NullString
+	var duration, httpStatus sql.NullInt64
+	if err := rows.Scan(&d.ID, &d.Header.Type, &d.Header.Title, &description, &source, &color, &body, (*scanTime)(&d.Timestamp),
+		&environment, &logRelease, &severity, &derivedSource, &category, &language, &duration, &httpStatus); err != nil {
+		return nil, err
+	}
+	d.Header.Description = openField(description.String)
+	d.Header.Source, d.Header.Color = source.String, color.String
+	d.Header.Environment, d.Header.Release = environment.String, logRelease.String
+	d.Raw = openField(body.String)
+	if d.Raw != "" {
+		json.Unmarshal([]byte(d.Raw), &d.Body)
+	}
+	d.Metadata = LogMetadata{
+		DerivedSeverity:   severity.String,
+		DerivedSource:     derivedSource.String,
+		DerivedCategory:   category.String,
+		DerivedLanguage:   language.String,
+		DerivedDurationMs: int(duration.Int64),
+		DerivedHTTPStatus: int(httpStatus.Int64),
+	}
+	return &d, nil
+}
+
+// handleLogDetail answers GET /api/logs/{id}
+func handleLogDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/logs/"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid log ID", http.StatusBadRequest)
+		return
+	}
+	detail, err := loadLogDetail(id)
+	if err != nil {
+		http.Error(w, "Failed to load log", http.StatusInternalServerError)
+		return
+	}
+	if detail == nil {
+		http.Error(w, "Log not found", http.StatusNotFound)
+		return
+	}
+
+	// Read once the log's rows are closed (in-memory databases have a single connection)
+	logs := []Log{detail.Log}
+	attachTriage(logs)
+	attachRepeats(logs)
+	detail.Log = logs[0]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestLogDetail tests reading one log with its derived metadata
+func TestLogDetail(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(
+		`{"header": {"title": "Checkout failed with status 503 after 1200ms", "source": "shop"}, "body": {"order": 42, "retry": true}}`)))
+	var created Log
+	json.NewDecoder(w.Body).Decode(&created)
+
+	request := func(path string) (int, logDetail) {
+		w := httptest.NewRecorder()
+		handleLogDetail(w, httptest.NewRequest("GET", path, nil))
+		var detail logDetail
+		json.NewDecoder(w.Body).Decode(&detail)
+		return w.Code, detail
+	}
+	code, detail := request("/api/logs/" + strconv.Itoa(created.ID))
+	if code != 200 || detail.ID != created.ID || detail.Header.Title != created.Header.Title {
+		t.Fatalf("Expected the log, got %d %+v", code, detail)
+	}
+	if detail.Metadata.DerivedSeverity != "critical" || detail.Metadata.DerivedSource != "shop" || detail.Metadata.DerivedHTTPStatus != 503 {
+		t.Errorf("Expected the derived metadata, got %+v", detail.Metadata)
+	}
+	if !strings.Contains(detail.Raw, `"order":42`) || detail.Body["retry"] != true {
+		t.Errorf("Expected the raw and the parsed body, got %q %v", detail.Raw, detail.Body)
+	}
+
+	if code, _ := request("/api/logs/999999"); code != 404 {
+		t.Errorf("Expected status 404 for a missing log, got %d", code)
+	}
+	if code, _ := request("/api/logs/abc"); code != 400 {
+		t.Errorf("Expected status 400 for an invalid ID, got %d", code)
+	}
+}
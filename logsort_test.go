@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogSorting tests the sort and order parameters of GET /api/logs
+func TestLogSorting(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, entry := range []string{
+		`{"header":{"type":"info","title":"Request took 120ms","source":"checkout"}}`,
+		`{"header":{"type":"critical","title":"Database down","source":"billing"}}`,
+		`{"header":{"type":"warning","title":"Slow query took 2.5s","source":"api"}}`,
+		`{"header":{"type":"info","title":"User signed in","source":"auth"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(entry)))
+	}
+	titles := func(query string) []string {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs?"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		var titles []string
+		for _, l := range logs {
+			titles = append(titles, l.Header.Title)
+		}
+		return titles
+	}
+
+	if got := titles("sort=severity&limit=1"); len(got) != 1 || got[0] != "Database down" {
+		t.Errorf("Expected the critical log first, got %v", got)
+	}
+	if got := titles("sort=duration"); len(got) != 4 || got[0] != "Slow query took 2.5s" || got[1] != "Request took 120ms" {
+		t.Errorf("Expected the slowest logs first, got %v", got)
+	}
+	if got := titles("sort=duration&order=asc&limit=1&offset=1"); len(got) != 1 || got[0] != "Slow query took 2.5s" {
+		t.Errorf("Expected the second fastest log on page 2, got %v", got)
+	}
+	if got := titles("sort=source"); len(got) != 4 || got[0] != "Slow query took 2.5s" || got[3] != "Request took 120ms" {
+		t.Errorf("Expected logs by source A-Z, got %v", got)
+	}
+	if got := titles("sort=timestamp&order=asc&limit=1"); len(got) != 1 || got[0] != "Request took 120ms" {
+		t.Errorf("Expected the oldest log first, got %v", got)
+	}
+
+	w := httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs?sort=size", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an unknown sort, got %d", w.Code)
+	}
+}
@@ -42,6 +42,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -59,6 +60,9 @@ import (
 // SMART PATTERN MATCHING CONSTANTS
 // =============================================================================
 
+// These are the built-in tables. The detection functions use them through
+// livePatterns(), which also applies the changes made via /api/patterns.
+
 // HTTP Status Code patterns for smart detection
 var httpStatusSeverity = map[string]string{
 	"200": "success", "201": "success", "202": "success", "204": "success",
@@ -160,24 +164,44 @@ var performanceThresholds = map[string]int{
 	"critical": 5000,
 }
 
-// Business logic patterns
-var businessPatterns = map[string]string{
-	"payment failed":       "error",
-	"payment successful":   "success",
-	"payment pending":      "info",
-	"order completed":      "success",
-	"order cancelled":      "warning",
-	"order failed":         "error",
-	"subscription expired": "warning",
-	"subscription renewed": "success",
-	"trial expired":        "info",
-	"invoice overdue":      "warning",
-	"invoice paid":         "success",
-	"refund processed":     "info",
-	"user registered":      "success",
-	"user deleted":         "warning",
-	"login successful":     "success",
-	"login failed":         "warning",
+// Stack trace indicators
+var stackTraceIndicators = []string{
+	" at line ", " at Object.", "Traceback", "goroutine ",
+	"panic:", ".java:", ".py:", ".js:", ".go:",
+	"at /", "File \"", " line ", "in <module>",
+	"Exception in thread", "Caused by:", "\n\tat ",
+	"Call Stack:", "Stack trace:", "at Function.",
+}
+
+// Precompiled regular expressions for status codes, timings and resource usage
+var (
+	// Match patterns like: 'status 200', 'HTTP 404', 'returned 500', 'status: 403', 'status=502'
+	httpStatusPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(?:status|http|code)[\s:=]*(\d{3})`),
+		regexp.MustCompile(`(?i)returned\s+(\d{3})`),
+		regexp.MustCompile(`(?i)\b(\d{3})\s+(?:error|ok|found|not found)`),
+		regexp.MustCompile(`(?i)\"status\"[\s:]+[\"']?(\d{3})`),
+	}
+
+	// Match patterns like: 'took 1234ms', 'duration: 5.2s', 'elapsed: 500ms', 'in 2000 ms'
+	performancePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(?:took|duration|elapsed|time)[\s:]+([0-9\.]+)\s*(?:ms|milliseconds)`),
+		regexp.MustCompile(`(?i)(?:took|duration|elapsed|time)[\s:]+([0-9\.]+)\s*(?:s|seconds)`),
+		regexp.MustCompile(`(?i)in\s+([0-9\.]+)\s*(?:ms|milliseconds)`),
+		regexp.MustCompile(`(?i)([0-9\.]+)\s*(?:ms|milliseconds)\s+(?:elapsed|duration)`),
+	}
+
+	// Match patterns like: 'cpu 95%', 'memory: 80.5%'
+	percentagePatterns = map[string]*regexp.Regexp{
+		"cpu":    percentagePattern("cpu"),
+		"memory": percentagePattern("memory"),
+		"disk":   percentagePattern("disk"),
+	}
+)
+
+// percentagePattern compiles the resource usage pattern for a context word
+func percentagePattern(context string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?i)%s[\s:]*([0-9\.]+)\s*%%`, regexp.QuoteMeta(context)))
 }
 
 // =============================================================================
@@ -186,16 +210,7 @@ var businessPatterns = map[string]string{
 
 // extractHTTPStatusCode extracts HTTP status codes from text
 func extractHTTPStatusCode(text string) string {
-	// Match patterns like: 'status 200', 'HTTP 404', 'returned 500', 'status: 403', 'status=502'
-	patterns := []string{
-		`(?i)(?:status|http|code)[\s:=]*(\d{3})`,
-		`(?i)returned\s+(\d{3})`,
-		`(?i)\b(\d{3})\s+(?:error|ok|found|not found)`,
-		`(?i)\"status\"[\s:]+[\"']?(\d{3})`,
-	}
-
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
+	for _, re := range httpStatusPatterns {
 		if matches := re.FindStringSubmatch(text); len(matches) > 1 {
 			return matches[1]
 		}
@@ -205,46 +220,17 @@ func extractHTTPStatusCode(text string) string {
 
 // hasStackTrace detects if text contains a stack trace
 func hasStackTrace(text string) bool {
-	stackIndicators := []string{
-		" at line ", " at Object.", "Traceback", "goroutine ",
-		"panic:", ".java:", ".py:", ".js:", ".go:",
-		"at /", "File \"", " line ", "in <module>",
-		"Exception in thread", "Caused by:", "\n\tat ",
-		"Call Stack:", "Stack trace:", "at Function.",
-	}
-
-	textLower := strings.ToLower(text)
-	for _, indicator := range stackIndicators {
-		if strings.Contains(textLower, strings.ToLower(indicator)) {
-			return true
-		}
-	}
-	return false
+	return livePatterns().stackTraceMatcher.containsAny(text)
 }
 
 // detectSecurityIssue checks for security-related patterns
 func detectSecurityIssue(text string) bool {
-	textLower := strings.ToLower(text)
-	for _, pattern := range securityPatterns {
-		if strings.Contains(textLower, pattern) {
-			return true
-		}
-	}
-	return false
+	return livePatterns().securityMatcher.containsAny(text)
 }
 
 // extractPerformanceMetrics extracts timing information from logs
 func extractPerformanceMetrics(text string) (duration int, found bool) {
-	// Match patterns like: 'took 1234ms', 'duration: 5.2s', 'elapsed: 500ms', 'in 2000 ms'
-	patterns := []string{
-		`(?i)(?:took|duration|elapsed|time)[\s:]+([0-9\.]+)\s*(?:ms|milliseconds)`,
-		`(?i)(?:took|duration|elapsed|time)[\s:]+([0-9\.]+)\s*(?:s|seconds)`,
-		`(?i)in\s+([0-9\.]+)\s*(?:ms|milliseconds)`,
-		`(?i)([0-9\.]+)\s*(?:ms|milliseconds)\s+(?:elapsed|duration)`,
-	}
-
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
+	for _, re := range performancePatterns {
 		if matches := re.FindStringSubmatch(text); len(matches) > 1 {
 			if val, err := strconv.ParseFloat(matches[1], 64); err == nil {
 				// Convert seconds to milliseconds if needed
@@ -261,27 +247,18 @@ func extractPerformanceMetrics(text string) (duration int, found bool) {
 
 // detectSystemError checks for system error codes
 func detectSystemError(text string) string {
-	textUpper := strings.ToUpper(text)
-	for code, severity := range systemErrorCodes {
-		if strings.Contains(textUpper, code) {
-			return severity
-		}
-	}
-	return ""
+	patterns := livePatterns()
+	return matchSeverity(patterns.systemErrorMatcher, patterns.systemErrorLevel, text)
 }
 
 // detectDatabaseIssue checks for database-related issues
 func detectDatabaseIssue(text string) string {
-	textLower := strings.ToLower(text)
-	for pattern, severity := range databasePatterns {
-		if strings.Contains(textLower, pattern) {
-			return severity
-		}
-	}
-	return ""
+	patterns := livePatterns()
+	return matchSeverity(patterns.databaseMatcher, patterns.databaseLevel, text)
 }
 
-// containsAnyKeyword checks if text contains any of the keywords
+// containsAnyKeyword checks if text contains any of the keywords (for ad-hoc
+// lists; the pattern tables above use their precompiled matchers)
 func containsAnyKeyword(text string, keywords []string) bool {
 	textLower := strings.ToLower(text)
 	for _, keyword := range keywords {
@@ -292,21 +269,22 @@ func containsAnyKeyword(text string, keywords []string) bool {
 	return false
 }
 
-// detectBusinessLogic checks for business-related patterns
-func detectBusinessLogic(text string) string {
-	textLower := strings.ToLower(text)
-	for pattern, severity := range businessPatterns {
-		if strings.Contains(textLower, pattern) {
-			return severity
-		}
+// detectBusinessLogic checks for business-related patterns, from the pattern
+// packs of the source when it has its own (see patternpacks.go)
+func detectBusinessLogic(source, text string) string {
+	patterns := livePatterns()
+	if business, ok := patterns.sourceBusiness[source]; ok {
+		return matchSeverity(business.matcher, business.levels, text)
 	}
-	return ""
+	return matchSeverity(patterns.businessMatcher, patterns.businessLevel, text)
 }
 
 // extractPercentage extracts percentage values for threshold checking
 func extractPercentage(text string, context string) int {
-	pattern := fmt.Sprintf(`(?i)%s[\s:]*([0-9\.]+)\s*%%`, context)
-	re := regexp.MustCompile(pattern)
+	re, ok := percentagePatterns[context]
+	if !ok {
+		re = percentagePattern(context)
+	}
 	if matches := re.FindStringSubmatch(text); len(matches) > 1 {
 		if val, err := strconv.ParseFloat(matches[1], 64); err == nil {
 			return int(val)
@@ -464,6 +442,11 @@ type Log struct {
 	Header    LogHeader              `json:"header"`    // Structured, mandatory metadata
 	Body      map[string]interface{} `json:"body"`      // Flexible JSON content
 	Timestamp time.Time              `json:"timestamp"` // Auto-generated creation time
+
+	Severity       string     `json:"severity,omitempty"`        // Optional - stored as the derived severity instead of guessing one
+	Tags           []string   `json:"tags,omitempty"`            // Set by bulk actions (see bulk.go)
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"` // Set by bulk actions (see bulk.go)
+	Repeated       int        `json:"repeated,omitempty"`        // Throttled repeats it stands for (see throttle.go)
 }
 
 // LogHeader contains structured metadata - only title is required for v1.1+
@@ -473,13 +456,19 @@ type LogHeader struct {
 	Description string `json:"description,omitempty"` // Optional
 	Source      string `json:"source,omitempty"`      // Optional - will be derived
 	Color       string `json:"color,omitempty"`       // Optional - will be auto-assigned
+	Environment string `json:"environment,omitempty"` // Optional - production, staging, ... (see environment.go)
+	Release     string `json:"release,omitempty"`     // Optional - version the log was sent from (see releases.go)
 }
 
 // LogMetadata contains smart derived metadata from log analysis
 type LogMetadata struct {
-	DerivedSeverity string `json:"derived_severity"` // error, warning, success, info, debug
-	DerivedSource   string `json:"derived_source"`   // extracted from body.service, body.source, or header.source
-	DerivedCategory string `json:"derived_category"` // extracted from type or first word of title
+	DerivedSeverity   string `json:"derived_severity"`              // error, warning, success, info, debug
+	DerivedSource     string `json:"derived_source"`                // extracted from body.service, body.source, or header.source
+	DerivedCategory   string `json:"derived_category"`              // extracted from type or first word of title
+	DerivedLanguage   string `json:"derived_language,omitempty"`    // go, python, java, ... (see language.go)
+	DerivedDurationMs int    `json:"derived_duration_ms,omitempty"` // "took 350ms", "duration: 2.5s" (see latency.go)
+	DerivedHTTPStatus int    `json:"derived_http_status,omitempty"` // "status 503", "HTTP 404" (see httpstatus.go)
+	Correction        string `json:"correction,omitempty"`          // fingerprint of the learned correction applied (see corrections.go)
 }
 
 // TypeCount represents aggregated type statistics
@@ -498,8 +487,8 @@ type SourceCount struct {
 // GLOBAL VARIABLES
 // =============================================================================
 
-// Database connection - initialized once in main()
-var db *sql.DB
+// Database connection - initialized once in main() (SQLite by default, see store.go)
+var db Store
 
 // Version information
 const VERSION = "1.2.0"
@@ -507,32 +496,252 @@ const VERSION = "1.2.0"
 // Default PID file location
 const DEFAULT_PID_FILE = "./cubiclog.pid"
 
+// flagEnvVars maps flags to the environment variables that set them when the
+// flag isn't given. The service install copies these (see service.go).
+var flagEnvVars = map[string]string{
+	"port":                    "PORT",
+	"listen":                  "LISTEN",
+	"db":                      "DB_PATH",
+	"db-driver":               "DB_DRIVER",
+	"ephemeral":               "EPHEMERAL",
+	"read-only":               "READ_ONLY",
+	"partition":               "PARTITION",
+	"attach":                  "ATTACH",
+	"api-key":                 "API_KEY",
+	"retention":               "RETENTION_DAYS",
+	"rollup-after":            "ROLLUP_AFTER_DAYS",
+	"ui-dir":                  "UI_DIR",
+	"color-file":              "COLOR_FILE",
+	"color-by":                "COLOR_BY",
+	"palette-file":            "PALETTE_FILE",
+	"palette":                 "PALETTE",
+	"locale":                  "LOCALE",
+	"debug-addr":              "DEBUG_ADDR",
+	"replicate-to":            "REPLICATE_TO",
+	"encryption-key-file":     "CUBICLOG_ENCRYPTION_KEY_FILE",
+	"signing-key-file":        "CUBICLOG_SIGNING_KEY_FILE",
+	"hash-chain":              "HASH_CHAIN",
+	"max-request-size":        "MAX_REQUEST_SIZE",
+	"max-body-size":           "MAX_BODY_SIZE",
+	"oversize-policy":         "OVERSIZE_POLICY",
+	"validate-only":           "VALIDATE_ONLY",
+	"quota-file":              "QUOTA_FILE",
+	"performance-file":        "PERFORMANCE_FILE",
+	"throttle":                "THROTTLE_PER_MINUTE",
+	"eventlog":                "EVENTLOG_CHANNELS",
+	"docker":                  "DOCKER",
+	"classifier":              "CLASSIFIER",
+	"http-status":             "HTTP_STATUS",
+	"http-status-fields":      "HTTP_STATUS_FIELDS",
+	"http-status-sources":     "HTTP_STATUS_SOURCES",
+	"pattern-packs":           "PATTERN_PACKS",
+	"pattern-pack-dir":        "PATTERN_PACK_DIR",
+	"escalation-file":         "ESCALATION_FILE",
+	"severity-overrides-file": "SEVERITY_OVERRIDES_FILE",
+	"alert-webhook":           "ALERT_WEBHOOK_URL",
+	"alert-template":          "ALERT_TEMPLATE",
+	"public-url":              "PUBLIC_URL",
+	"issue-tracker-file":      "ISSUE_TRACKER_FILE",
+	"slack-signing-secret":    "SLACK_SIGNING_SECRET",
+	"report-file":             "REPORT_FILE",
+	"report-pdf-command":      "REPORT_PDF_COMMAND",
+	"alert-new-errors":        "ALERT_NEW_ERRORS",
+	"user-field":              "USER_FIELD",
+	"spool-file":              "SPOOL_FILE",
+	"min-free-disk":           "MIN_FREE_DISK_MB",
+	"disk-runway-days":        "DISK_RUNWAY_DAYS",
+}
+
+// applyFlagEnv sets the flags of fs that have an environment variable from
+// it; given flags still win, as flag.Parse runs afterwards. Invalid values
+// keep the default.
+func applyFlagEnv(fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		name, ok := flagEnvVars[f.Name]
+		if !ok {
+			return
+		}
+		value := os.Getenv(name)
+		if value == "" {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			fmt.Printf("⚠️  Ignoring %s=%q: %v\n", name, value, err)
+			f.Value.Set(f.DefValue) // a failed Set may have zeroed it
+		}
+	})
+}
+
 // =============================================================================
 // MAIN FUNCTION & INITIALIZATION
 // =============================================================================
 
 // main initializes and starts the CubicLog server
 func main() {
-	// Parse command-line flags with environment variable fallbacks
+	// Parse command-line flags with environment variable fallbacks (see flagEnvVars)
 	var (
-		port          = flag.String("port", getEnv("PORT", "8080"), "Port to run server on")
-		dbPath        = flag.String("db", getEnv("DB_PATH", "./logs.db"), "Path to SQLite database")
-		apiKey        = flag.String("api-key", os.Getenv("API_KEY"), "API key for authentication (optional)")
-		retentionDays = flag.Int("retention", getEnvInt("RETENTION_DAYS", 30), "Days to retain logs")
+		port          = flag.String("port", "8080", "Port to run server on")
+		listen        = flag.String("listen", "", "Address to listen on: host:port or unix:///path/to.sock (overrides -port)")
+		dbPath        = flag.String("db", "./logs.db", "Path to SQLite database (or PostgreSQL connection string)")
+		dbDriver      = flag.String("db-driver", "sqlite3", "Database driver: sqlite3 or postgres")
+		ephemeral     = flag.Bool("ephemeral", false, "Keep everything in memory for this run only (implies -db :memory:, no PID file)")
+		readOnly      = flag.Bool("read-only", false, "Serve queries and the dashboard but refuse all writes (for restored backups and archives)")
+		partition     = flag.String("partition", "", "Split SQLite storage into per-month files (monthly)")
+		attach        = flag.String("attach", "", "Read-only SQLite files (old partitions, backups) searchable with ?attach=: comma-separated paths, globs or name=path")
+		apiKey        = flag.String("api-key", "", "API key for authentication (optional)")
+		createKey     = flag.String("create-key", "", "Issue a managed API key with this name, print it and exit")
+		retentionDays = flag.Int("retention", 30, "Days to retain logs")
+		rollupAfter   = flag.Int("rollup-after", 0, "Replace low-severity logs older than N days with hourly counts (0 = disabled)")
+		rollupLevels  = flag.String("rollup-severities", "debug,info", "Comma-separated derived severities eligible for rollup")
+		rollupKeep    = flag.Int("rollup-retention", 365, "Days to keep hourly rollup counts")
 		pidFile       = flag.String("pid-file", DEFAULT_PID_FILE, "Path to PID file")
+		uiDir         = flag.String("ui-dir", "", "Directory with branding.json, custom.css, logos or a custom index.html overriding the embedded UI")
+		colorFile     = flag.String("color-file", "", "JSON file mapping severities (including custom ones) and categories to Tailwind colors")
+		colorBy       = flag.String("color-by", "severity", "Color logs by severity or by source (a stable color per service)")
+		paletteFile   = flag.String("palette-file", "", "JSON file with custom dashboard palettes (hex colors per severity and Tailwind color)")
+		paletteName   = flag.String("palette", "default", "Palette the dashboard opens with: default, colorblind or one from -palette-file")
+		locale        = flag.String("locale", "en", "Language the dashboard opens with: en, es, pt, de or a pack from -ui-dir")
+		refreshEvery  = flag.Duration("refresh-interval", 5*time.Second, "How often the dashboard polls for new logs (0 = only on demand)")
+		slowQuery     = flag.Duration("slow-query", 250*time.Millisecond, "Log queries slower than this are recorded for /api/admin/query-insights")
+		debugAddr     = flag.String("debug-addr", "", "Serve pprof, expvar and runtime snapshots on this address (e.g. localhost:6060)")
+
+		// Replication settings
+		replicateTo       = flag.String("replicate-to", "", "Ship database snapshots to a directory, http(s):// URL or s3://bucket/prefix")
+		replicateInterval = flag.Duration("replicate-interval", time.Minute, "How often to check for changes and ship a snapshot")
+		replicateRetain   = flag.Int("replicate-retain", 24, "Number of snapshots to keep at the replica")
+		restoreFrom       = flag.String("restore", "", "Restore the latest snapshot from a replica into -db and exit")
+
+		// Encryption at rest (key may also come from CUBICLOG_ENCRYPTION_KEY)
+		encryptionKeyFile = flag.String("encryption-key-file", "", "File with a 32-byte key to encrypt log bodies and descriptions at rest")
+		signingKeyFile    = flag.String("signing-key-file", "", "File with the secret used to sign erasure reports, chain checkpoints and ingest tokens (default: generated next to the database)")
+
+		// Tamper evidence
+		hashChain   = flag.Bool("hash-chain", false, "Chain every stored log to the previous one with SHA-256 hashes")
+		verifyChain = flag.Bool("verify-chain", false, "Verify the hash chain and exit")
+
+		// Payload size limits
+		maxRequestSize = flag.Int64("max-request-size", 10<<20, "Largest accepted POST /api/logs request in bytes")
+		maxBodySize    = flag.Int("max-body-size", 1<<20, "Largest stored JSON body in bytes (0 = unlimited)")
+		oversize       = flag.String("oversize-policy", "truncate", "What to do with bodies above -max-body-size: truncate or reject")
+		validateOnly   = flag.Bool("validate-only", false, "Treat every ingestion request as a dry run: validate and derive, never store")
+
+		// HTTP server tuning (0 disables a timeout)
+		readTimeout    = flag.Duration("read-timeout", 30*time.Second, "Maximum time to read a request including its body")
+		writeTimeout   = flag.Duration("write-timeout", 5*time.Minute, "Maximum time to write a response (raise for very large exports)")
+		idleTimeout    = flag.Duration("idle-timeout", 2*time.Minute, "How long idle keep-alive connections stay open")
+		maxHeaderBytes = flag.Int("max-header-size", 1<<20, "Largest accepted request header block in bytes")
+
+		// Ingestion quotas
+		quotaFile = flag.String("quota-file", "", "JSON file with daily log/byte quotas per source or API key")
+
+		// Performance thresholds
+		performanceFile = flag.String("performance-file", "", "JSON file with the fast/normal/slow/critical duration thresholds, globally and per source")
+
+		// Noise reduction
+		throttlePerMinute = flag.Int("throttle", 0, "Store each fingerprint (source + normalized title) at most this many times per minute, counting the rest (0 = off)")
+
+		// Windows event log collection
+		eventLogChannelList = flag.String("eventlog", "", "Comma-separated Windows event log channels to collect, e.g. Application,System (Windows only)")
+
+		// Docker container collection
+		dockerEnabled = flag.Bool("docker", false, "Collect the stdout/stderr of local Docker containers")
+		dockerSocket  = flag.String("docker-socket", defaultDockerSocketPath(), "Docker daemon socket (defaults to DOCKER_HOST or /var/run/docker.sock)")
+
+		// Custom classification
+		classifierCmd     = flag.String("classifier", "", "Command classifying every log over JSON lines on stdin/stdout (a script, or a WASI runtime running a WASM module)")
+		classifierTimeout = flag.Duration("classifier-timeout", 250*time.Millisecond, "How long the -classifier may take per log before it is skipped and restarted")
+
+		// HTTP status detection
+		statusDetection = flag.Bool("http-status", true, "Derive severity from HTTP status codes found in logs (false to turn detection off)")
+		statusFields    = flag.String("http-status-fields", "", "Comma-separated body paths holding the HTTP status code (instead of scanning the text)")
+		statusSources   = flag.String("http-status-sources", "", "Comma-separated derived sources HTTP status codes are detected in (default all)")
+
+		// Business pattern packs
+		patternPackList = flag.String("pattern-packs", "", "Comma-separated business pattern packs to enable, e.g. ecommerce,iot (default: accounts,ecommerce,saas-billing; none to disable)")
+		patternPackDir  = flag.String("pattern-pack-dir", "", "Directory with more business pattern packs (*.json, see patternpacks.go)")
+
+		// Alerting
+		escalationFile = flag.String("escalation-file", "", "JSON file with rules escalating floods of matching logs and firing alerts")
+		overridesFile  = flag.String("severity-overrides-file", "", "JSON file with rules capping, raising or setting the severity of logs by source")
+		alertWebhook   = flag.String("alert-webhook", "", "URL that fired alerts are POSTed to as JSON")
+		alertTmpl      = flag.String("alert-template", "", "Go text/template file rendering alert webhook bodies")
+		publicBase     = flag.String("public-url", "", "External URL of this instance, used for links in notifications")
+		issueFile      = flag.String("issue-tracker-file", "", "JSON file configuring the GitHub, GitLab or Jira project for error group issues")
+		slackSecret    = flag.String("slack-signing-secret", "", "Signing secret of the Slack app whose /cubiclog command queries this instance")
+		reportFile     = flag.String("report-file", "", "JSON file with scheduled reports (error trends, top groups, SLO status)")
+		reportPDF      = flag.String("report-pdf-command", "", "Command converting report HTML on stdin to PDF on stdout, e.g. \"wkhtmltopdf --quiet - -\"")
+		newErrors      = flag.Bool("alert-new-errors", false, "Fire an alert when an error group is seen for the first time (at most 20 per hour)")
+		userField      = flag.String("user-field", defaultUserFields, "Comma-separated body paths naming the affected user of an error (counted per error group)")
+
+		// Write circuit breaker
+		spoolFile   = flag.String("spool-file", "", "Spool file for logs received while the database can't take writes (default: none, buffer up to 10,000 logs in memory; put it on another disk than the database)")
+		minFreeDisk = flag.Int64("min-free-disk", 100, "Spool instead of writing when free disk space drops below this many MB")
+		diskRunway  = flag.Int("disk-runway-days", 14, "Alert when the database growth fills the disk within this many days (0 disables)")
 
 		// Service management commands
 		stop    = flag.Bool("stop", false, "Stop CubicLog server")
 		restart = flag.Bool("restart", false, "Restart CubicLog server")
 		status  = flag.Bool("status", false, "Check CubicLog server status")
-		cleanup = flag.Bool("cleanup", false, "Run cleanup and exit")
+		cleanup = flag.Bool("cleanup", false, "Preview what retention would remove and exit (add -confirm to remove it)")
+		confirm = flag.Bool("confirm", false, "Confirm -cleanup: actually remove the previewed data")
 		version = flag.Bool("version", false, "Show version and exit")
+
+		// OS service installation (systemd or launchd)
+		installService   = flag.Bool("install-service", false, "Install, enable and start CubicLog as a system service with the other flags given")
+		uninstallService = flag.Bool("uninstall-service", false, "Stop and remove the installed system service")
+
+		// Load testing
+		bench       = flag.Bool("bench", false, "Load-test a running instance with synthetic logs and exit")
+		benchTarget = flag.String("target", "", "Instance to load-test or replay to (-bench default: http://localhost:<port>)")
+		benchRate   = flag.Int("rate", 1000, "Logs per second to send with -bench")
+		benchFor    = flag.Duration("duration", 30*time.Second, "How long to run -bench")
+		benchConns  = flag.Int("concurrency", 50, "Concurrent connections used by -bench")
+
+		// Replay to another instance (uses -target and -api-key)
+		replay      = flag.Bool("replay", false, "Re-send the logs between -from and -to to the -target instance and exit")
+		replayFrom  = flag.String("from", "", "Start of the -replay range (date or RFC 3339 time)")
+		replayTo    = flag.String("to", "", "End of the -replay range (date or RFC 3339 time, dates include the whole day)")
+		replaySpeed = flag.Float64("speed", 0, "Replay at this multiple of the original pace (0 = as fast as possible, 1 = original)")
+
+		// Demo data
+		seed     = flag.Int("seed", 0, "Insert N realistic demo logs and exit")
+		seedDays = flag.Int("seed-days", 21, "Spread -seed timestamps over the last N days")
+
+		// Integrity maintenance commands
+		check   = flag.Bool("check", false, "Check database integrity and exit")
+		repair  = flag.Bool("repair", false, "With -check: rebuild indexes and salvage a corrupted database")
+		migrate = flag.String("migrate", "", "Schema migrations: status, up (apply pending) or down (revert the latest), then exit")
 	)
+	applyFlagEnv(flag.CommandLine)
 	flag.Parse()
 
 	// Handle version flag
 	if *version {
 		fmt.Printf("CubicLog v%s by Mendex\n", VERSION)
+		if build := currentBuild(); build.Commit != "" {
+			fmt.Printf("commit %s, built %s with %s (%s)\n", build.Commit, valueOr(build.BuildDate, "unknown"), build.GoVersion, build.Platform)
+		}
+		return
+	}
+
+	// Handle load test against a running instance
+	if *bench {
+		target := *benchTarget
+		if target == "" {
+			target = "http://localhost:" + *port
+		}
+		handleBench(target, *apiKey, *benchRate, *benchFor, *benchConns)
+		return
+	}
+
+	// Handle OS service installation
+	if *installService {
+		handleInstallService(os.Args[1:])
+		return
+	}
+
+	if *uninstallService {
+		handleUninstallService()
 		return
 	}
 
@@ -552,9 +761,135 @@ func main() {
 		return
 	}
 
-	// Initialize SQLite database
+	// Ephemeral runs keep the database in memory and leave no files behind
+	if *ephemeral {
+		*dbPath, *dbDriver, *pidFile = ":memory:", "sqlite3", ""
+	}
+	if *dbDriver == "sqlite3" && isMemoryDSN(*dbPath) {
+		if err := checkEphemeralCommands(map[string]bool{"check": *check || *repair, "cleanup": *cleanup, "restore": *restoreFrom != "",
+			"seed": *seed > 0, "migrate": *migrate != "", "create-key": *createKey != "", "verify-chain": *verifyChain}); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+	}
+
+	// Read-only instances never change the database, not even at startup
+	readOnlyMode = *readOnly
+	if readOnlyMode {
+		if err := checkReadOnlyCommands(map[string]bool{"cleanup -confirm": *cleanup && *confirm, "seed": *seed > 0, "repair": *repair,
+			"migrate " + *migrate: *migrate != "" && *migrate != "status", "create-key": *createKey != "", "restore": *restoreFrom != ""}); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+	}
+
+	// Handle restore before the database is opened
+	if *restoreFrom != "" {
+		handleRestore(*restoreFrom, *dbPath)
+		return
+	}
+
+	// Apply payload size limits
+	if err := validateOversizePolicy(*oversize); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	maxRequestBytes = *maxRequestSize
+	maxBodyBytes = *maxBodySize
+	oversizePolicy = *oversize
+	ingestValidateOnly = *validateOnly
+	slowQueryThreshold = *slowQuery
+
+	// Apply dashboard branding
+	if err := configureUI(*uiDir); err != nil {
+		log.Fatalf("UI setup failed: %v", err)
+	}
+	if err := loadColorConfig(*colorFile); err != nil {
+		log.Fatalf("Color setup failed: %v", err)
+	}
+	if err := configureColorMode(*colorBy); err != nil {
+		log.Fatalf("Color setup failed: %v", err)
+	}
+	if err := configurePalettes(*paletteFile, *paletteName); err != nil {
+		log.Fatalf("Palette setup failed: %v", err)
+	}
+	if err := configureLocales(*uiDir, *locale); err != nil {
+		log.Fatalf("Language setup failed: %v", err)
+	}
+	if err := configureRefresh(*refreshEvery); err != nil {
+		log.Fatalf("Refresh setup failed: %v", err)
+	}
+
+	// Load ingestion quotas
+	if err := loadQuotas(*quotaFile); err != nil {
+		log.Fatalf("Quota setup failed: %v", err)
+	}
+
+	// Load performance thresholds
+	if err := loadPerformanceThresholds(*performanceFile); err != nil {
+		log.Fatalf("Performance threshold setup failed: %v", err)
+	}
+
+	// Configure throttling of repeated logs
+	configureThrottle(*throttlePerMinute)
+
+	// Check the Windows event log channels
+	if err := configureEventLog(*eventLogChannelList); err != nil {
+		log.Fatalf("Event log setup failed: %v", err)
+	}
+
+	// Connect to the Docker daemon
+	if err := configureDocker(*dockerEnabled, *dockerSocket); err != nil {
+		log.Fatalf("Docker setup failed: %v", err)
+	}
+
+	// Configure the custom classifier
+	if err := configureClassifier(*classifierCmd, *classifierTimeout); err != nil {
+		log.Fatalf("Classifier setup failed: %v", err)
+	}
+
+	// Configure HTTP status detection
+	if err := configureHTTPStatus(*statusDetection, *statusFields, *statusSources); err != nil {
+		log.Fatalf("HTTP status setup failed: %v", err)
+	}
+	if err := configurePatternPacks(*patternPackDir, *patternPackList); err != nil {
+		log.Fatalf("Pattern pack setup failed: %v", err)
+	}
+
+	// Load escalation rules
+	if err := loadEscalationRules(*escalationFile); err != nil {
+		log.Fatalf("Escalation setup failed: %v", err)
+	}
+	if err := loadSeverityOverrides(*overridesFile); err != nil {
+		log.Fatalf("Severity override setup failed: %v", err)
+	}
+	alertWebhookURL = *alertWebhook
+	newErrorAlerts = *newErrors
+	publicURL = *publicBase
+	if err := loadAlertTemplate(*alertTmpl); err != nil {
+		log.Fatalf("Alert template setup failed: %v", err)
+	}
+	if err := loadIssueTracker(*issueFile); err != nil {
+		log.Fatalf("Issue tracker setup failed: %v", err)
+	}
+	slackSigningSecret = *slackSecret
+	if err := loadReports(*reportFile, *reportPDF); err != nil {
+		log.Fatalf("Report setup failed: %v", err)
+	}
+	if err := configureUserFields(*userField); err != nil {
+		log.Fatalf("User field setup failed: %v", err)
+	}
+
+	// Load encryption key before any rows are read or written
+	if err := loadEncryptionKey(*encryptionKeyFile); err != nil {
+		log.Fatalf("Encryption setup failed: %v", err)
+	}
+	configureSigning(*signingKeyFile, *dbPath, *dbDriver)
+
+	// Initialize database (SQLite unless -db-driver says otherwise)
 	var err error
-	db, err = sql.Open("sqlite3", *dbPath)
+	dsn := *dbPath
+	if readOnlyMode {
+		dsn = readOnlyDSN(*dbDriver, dsn)
+	}
+	db, err = openStore(*dbDriver, dsn)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -565,31 +900,198 @@ func main() {
 		log.Fatalf("Database connection failed: %v", err)
 	}
 
-	// Create tables and indexes
-	if err := createTable(); err != nil {
+	// Handle integrity check before the schema is touched
+	if *check || *repair {
+		handleCheck(*dbPath, *repair)
+		return
+	}
+
+	// Handle schema migration commands before the startup migrations run
+	if *migrate != "" {
+		handleMigrate(*migrate)
+		return
+	}
+
+	// Create tables and indexes, then apply pending schema migrations; a
+	// corrupt SQLite file is salvaged instead of stopping (see recovery.go)
+	if readOnlyMode {
+		if err := checkReadOnlySchema(); err != nil {
+			log.Fatalf("Read-only mode: %v", err)
+		}
+	} else if err := withCorruptionRecovery(*dbPath, createTable); err != nil {
 		log.Fatalf("Table creation failed: %v", err)
 	}
 
-	// Handle cleanup-only mode
+	// Apply the stored pattern changes to the smart detection
+	if err := loadPatterns(); err != nil {
+		log.Fatalf("Failed to load patterns: %v", err)
+	}
+	if err := loadCorrections(); err != nil {
+		log.Fatalf("Failed to load corrections: %v", err)
+	}
+	if err := loadTaxonomy(); err != nil {
+		log.Fatalf("Failed to load category taxonomy: %v", err)
+	}
+	if err := loadSourceColors(); err != nil {
+		log.Fatalf("Failed to load source colors: %v", err)
+	}
+	if err := loadSourceRegistry(); err != nil {
+		log.Fatalf("Failed to load source registry: %v", err)
+	}
+	if err := loadLegalHolds(); err != nil {
+		log.Fatalf("Failed to load legal holds: %v", err)
+	}
+	if err := loadSourceMaps(); err != nil {
+		log.Fatalf("Failed to load source maps: %v", err)
+	}
+
+	// Load managed API keys (only their hashes are stored)
+	if err := loadAPIKeys(); err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	if *createKey != "" {
+		handleCreateKey(*createKey)
+		return
+	}
+
+	// Move finished months into their own files when partitioning is enabled
+	if err := enablePartitioning(*partition, *dbPath); err != nil {
+		log.Fatalf("Partitioning setup failed: %v", err)
+	}
+	if partitionMode && !readOnlyMode {
+		if err := rollOverPartitions(); err != nil {
+			log.Printf("⚠️  Partition rollover error: %v", err)
+		}
+		startPartitionRollover()
+	}
+
+	// Attach archived databases for queries with ?attach= (see archives.go)
+	if err := configureArchives(*attach); err != nil {
+		log.Fatalf("Archive setup failed: %v", err)
+	}
+
+	// Handle hash chain verification
+	hashChainEnabled = *hashChain
+	if *verifyChain {
+		handleVerifyChain()
+		return
+	}
+
+	// Configure rollups before the first cleanup run
+	rollupAfterDays = *rollupAfter
+	rollupSeverities = parseSeverityList(*rollupLevels)
+	rollupRetentionDays = *rollupKeep
+
+	// Handle replay to another instance
+	if *replay {
+		handleReplay(*benchTarget, *apiKey, *replayFrom, *replayTo, *replaySpeed)
+		return
+	}
+
+	// Handle demo data seeding
+	if *seed > 0 {
+		handleSeed(*seed, *seedDays)
+		return
+	}
+
+	// Settings changed from the dashboard take precedence over the flags (see adminconfig.go)
+	logRetentionDays = *retentionDays
+	if err := loadRuntimeConfig(); err != nil {
+		log.Fatalf("Failed to load runtime settings: %v", err)
+	}
+
+	// Handle cleanup-only mode (a dry run unless confirmed)
 	if *cleanup {
-		cleanupOldLogs(*retentionDays)
-		fmt.Printf("Cleanup completed. Logs older than %d days removed.\n", *retentionDays)
+		handleCleanup(currentRetention(), *confirm)
 		return
 	}
 
-	// Perform initial cleanup on startup
-	cleanupOldLogs(*retentionDays)
+	// Perform initial cleanup on startup (an in-memory database starts empty, so clean it hourly instead)
+	if storeInMemory() {
+		startMemoryCleanup()
+	} else if !readOnlyMode {
+		cleanupOldLogs(currentRetention())
+	}
+	if !readOnlyMode {
+		if rollupAfterDays > 0 {
+			startRollupJob()
+		}
+		startSLOMonitor()
+		startReportScheduler()
+		startEventLogCollector()
+		startDockerCollector()
+		startCorrelationJob()
+	}
+
+	// Spool incoming logs whenever the database can't take writes
+	spoolPath = *spoolFile
+	minFreeDiskMB = *minFreeDisk
+	dataDir := ""
+	if db.Driver() == "sqlite3" && !storeInMemory() {
+		dataDir = filepath.Dir(*dbPath)
+	}
+	if !readOnlyMode {
+		startWriteMonitor(dataDir)
+	}
+	healthDBPath = *dbPath
+	healthDataDir = dataDir
+
+	// Forecast the database growth and the disk runway (see forecast.go)
+	diskRunwayDays = *diskRunway
+	if !readOnlyMode && !storeInMemory() {
+		startStorageForecast()
+	}
+
+	// Start continuous replication if configured
+	if *replicateTo != "" {
+		target, err := newReplicaTarget(*replicateTo)
+		if err != nil {
+			log.Fatalf("Invalid replication target: %v", err)
+		}
+		startReplication(target, *replicateInterval, *replicateRetain)
+	}
+
+	// Bind before announcing readiness so a taken port fails fast
+	network, address, err := parseListenAddress(*listen, *port)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	listener, err := openListener(network, address)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", address, err)
+	}
 
 	// Setup HTTP routes
 	setupRoutes(*apiKey)
 
+	// Start the private diagnostics server when requested
+	debugListen := ""
+	if *debugAddr != "" {
+		if debugListen, err = startDebugServer(*debugAddr); err != nil {
+			log.Fatalf("Failed to start debug server: %v", err)
+		}
+	}
+
 	// Write PID file
-	if err := writePIDFile(*pidFile); err != nil {
-		log.Printf("⚠️  Warning: Could not write PID file: %v", err)
+	if *pidFile != "" {
+		if err := writePIDFile(*pidFile); err != nil {
+			log.Printf("⚠️  Warning: Could not write PID file: %v", err)
+		}
 	}
 
 	// Setup graceful shutdown
-	server := &http.Server{Addr: ":" + *port}
+	handler := withoutDebugRoutes(http.DefaultServeMux)
+	if readOnlyMode {
+		handler = readOnlyHandler(handler)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
 
 	// Channel to listen for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -599,16 +1101,54 @@ func main() {
 	go func() {
 		// Display startup information
 		log.Printf("🚀 CubicLog v%s starting up", VERSION)
-		log.Printf("📊 Database: %s", *dbPath)
-		log.Printf("🌐 Server: http://localhost:%s", *port)
-		if *apiKey != "" {
-			log.Printf("🔐 API key authentication enabled")
+		log.Printf("📊 Database: %s (%s)", *dbPath, db.Driver())
+		log.Printf("🌐 Server: %s", listenURL(network, address))
+		if *apiKey != "" || managedKeysExist() {
+			log.Printf("🔐 API key authentication enabled (%d managed keys)", len(listAPIKeys()))
+		}
+		if readOnlyMode {
+			log.Printf("📖 Read-only: queries and the dashboard only, nothing is written or removed")
+		} else {
+			log.Printf("🗑️  Log retention: %d days", currentRetention())
+		}
+		if rollupAfterDays > 0 {
+			log.Printf("📉 Rolling up %s logs after %d days", strings.Join(rollupSeverities, "/"), rollupAfterDays)
+		}
+		if partitionMode {
+			log.Printf("🗂️  Monthly partitions enabled (%d archived months)", len(listPartitions()))
+		}
+		if len(archives) > 0 {
+			log.Printf("🗄️  %d archives attached for ?attach= queries: %s", len(archives), strings.Join(archiveNames(archives), ", "))
+		}
+		if *pidFile != "" {
+			log.Printf("📁 PID file: %s", *pidFile)
+		}
+		if fieldCipher != nil {
+			log.Printf("🔒 Encryption at rest enabled for log bodies and descriptions")
+		}
+		if ingestValidateOnly {
+			log.Printf("🧪 Validate-only: ingested logs are checked and derived but never stored")
+		}
+		if quotas != nil {
+			log.Printf("🚦 Ingestion quotas loaded from %s", *quotaFile)
+		}
+		if spoolPath != "" {
+			log.Printf("💾 Spool file: %s (min free disk: %d MB)", spoolPath, minFreeDiskMB)
+			if dataDir != "" && filepath.Dir(spoolPath) == dataDir {
+				log.Printf("⚠️  The spool file shares the database's directory; a full disk fills both")
+			}
+		} else if !readOnlyMode {
+			log.Printf("💾 No -spool-file set: up to %d logs are buffered in memory while the database can't take writes", spoolMemoryLimit)
+		}
+		if debugListen != "" {
+			log.Printf("🩺 Debug endpoints: http://%s/debug/pprof/", debugListen)
+		}
+		if *replicateTo != "" {
+			log.Printf("📦 Replicating to %s every %s", *replicateTo, *replicateInterval)
 		}
-		log.Printf("🗑️  Log retention: %d days", *retentionDays)
-		log.Printf("📁 PID file: %s", *pidFile)
 		log.Printf("✨ Ready to log!")
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -625,9 +1165,21 @@ func main() {
 		log.Printf("⚠️  Server forced to shutdown: %v", err)
 	}
 
+	// Let alert deliveries in flight finish and be recorded
+	pendingDeliveries.Wait()
+
+	// Last chance to store spooled logs; memory-buffered ones are lost otherwise
+	if _, _, pending := breaker.status(); pending > 0 {
+		if err := breaker.replay(); err != nil {
+			log.Printf("⚠️  %d spooled logs could not be stored: %v", pending, err)
+		}
+	}
+
 	// Clean up PID file
-	if err := removePIDFile(*pidFile); err != nil {
-		log.Printf("⚠️  Warning: Could not remove PID file: %v", err)
+	if *pidFile != "" {
+		if err := removePIDFile(*pidFile); err != nil {
+			log.Printf("⚠️  Warning: Could not remove PID file: %v", err)
+		}
 	}
 
 	log.Printf("✅ CubicLog stopped gracefully")
@@ -635,12 +1187,87 @@ func main() {
 
 // setupRoutes configures all HTTP endpoints
 func setupRoutes(apiKey string) {
-	http.HandleFunc("/", serveWeb)                                                // Web dashboard (public)
-	http.HandleFunc("/health", handleHealth)                                      // Health check (public)
-	http.HandleFunc("/api/stats", handleStats)                                    // Statistics (public)
-	http.HandleFunc("/api/logs", authMiddleware(apiKey, handleLogs))              // Log CRUD operations
-	http.HandleFunc("/api/export/csv", authMiddleware(apiKey, handleExportCSV))   // CSV export
-	http.HandleFunc("/api/export/json", authMiddleware(apiKey, handleExportJSON)) // JSON export
+	http.HandleFunc("/", compressHandler(serveWeb))                                                      // Web dashboard (public)
+	http.HandleFunc("/assets/", compressHandler(serveAssets))                                            // Bundled and custom UI assets (public)
+	http.HandleFunc("/logs/", compressHandler(handleLogPermalink))                                       // Dashboard focused on one log (public)
+	http.HandleFunc("/search", compressHandler(handleSearchPermalink))                                   // Dashboard with filters applied (public)
+	http.HandleFunc("/share/", compressHandler(handleSharePage))                                         // Dashboard on a shared filter set (public)
+	http.HandleFunc("/health", handleHealth)                                                             // Health check (public)
+	http.HandleFunc("/healthz", handleLiveness)                                                          // Liveness probe (public)
+	http.HandleFunc("/readyz", handleReadiness)                                                          // Readiness probe (public)
+	http.HandleFunc("/api/stats", handleStats)                                                           // Statistics (public)
+	http.HandleFunc("/api/stats/trends", compressHandler(handleTrends))                                  // Volume and error rate changes per source (public)
+	http.HandleFunc("/api/version", authMiddleware(apiKey, handleVersion))                               // Version, build and schema info
+	http.HandleFunc("/api/charts/severity", compressHandler(handleSeverityChart))                        // Severity chart series (public)
+	http.HandleFunc("/api/charts/sources", compressHandler(handleSourcesChart))                          // Per-source error rates (public)
+	http.HandleFunc("/api/ui/config", compressHandler(handleUIConfig))                                   // Dashboard palettes and languages (public)
+	http.HandleFunc("/api/ui/i18n/", compressHandler(handleLanguagePack))                                // Dashboard language packs (public)
+	http.HandleFunc("/api/logs", compressHandler(shareAuthMiddleware(apiKey, handleLogs)))               // Log CRUD operations (ingest tokens may POST, share links GET)
+	http.HandleFunc("/api/logs/", compressHandler(authMiddleware(apiKey, handleLogDetail)))              // One log with its derived metadata
+	http.HandleFunc("/api/logs/bulk", authMiddleware(apiKey, handleBulkLogs))                            // Tag, acknowledge, re-rate or delete many logs
+	http.HandleFunc("/api/export/csv", exportCompressHandler(authMiddleware(apiKey, handleExportCSV)))   // CSV export
+	http.HandleFunc("/api/export/json", exportCompressHandler(authMiddleware(apiKey, handleExportJSON))) // JSON export
+	http.HandleFunc("/api/export/xlsx", exportCompressHandler(authMiddleware(apiKey, handleExportXLSX))) // Excel export
+	http.HandleFunc("/api/export/verify", authMiddleware(apiKey, handleExportVerify))                    // Check the signature of a signed export
+	http.HandleFunc("/api/archives", authMiddleware(apiKey, handleArchives))                             // Attached archive databases
+	http.HandleFunc("/api/retention/preview", authMiddleware(apiKey, handleRetentionPreview))            // What retention would remove
+	http.HandleFunc("/api/retention/run", authMiddleware(apiKey, handleRetentionRun))                    // Manual cleanup (requires confirm=true)
+	http.HandleFunc("/api/admin/legal-holds", authMiddleware(apiKey, handleLegalHolds))                  // Place and audit legal holds
+	http.HandleFunc("/api/admin/legal-holds/", authMiddleware(apiKey, handleLegalHold))                  // Release a legal hold
+	http.HandleFunc("/api/privacy/erase", authMiddleware(apiKey, handlePrivacyErase))                    // Erase logs mentioning a data subject
+	http.HandleFunc("/api/privacy/verify", authMiddleware(apiKey, handlePrivacyVerify))                  // Verify a signed erasure report
+	http.HandleFunc("/api/chain/verify", authMiddleware(apiKey, handleChainVerify))                      // Verify the tamper-evident hash chain
+	http.HandleFunc("/api/keys", authMiddleware(apiKey, handleAPIKeys))                                  // List and issue API keys
+	http.HandleFunc("/api/keys/", authMiddleware(apiKey, handleAPIKey))                                  // Rotate or revoke an API key
+	http.HandleFunc("/api/admin/config", authMiddleware(apiKey, handleAdminConfig))                      // Runtime settings (retention, escalation rules)
+	http.HandleFunc("/api/admin/audit", authMiddleware(apiKey, handleConfigAudit))                       // Audit log of configuration changes
+	http.HandleFunc("/api/tokens/ingest", authMiddleware(apiKey, handleIngestToken))                     // Mint a short-lived ingest token
+	http.HandleFunc("/api/shares", authMiddleware(apiKey, handleShares))                                 // Signed share links for filtered views
+	http.HandleFunc("/api/ingest/alertmanager", authMiddleware(apiKey, handleAlertmanager))              // Prometheus Alertmanager webhook receiver
+	http.HandleFunc("/api/ingest/vector", authMiddleware(apiKey, handleVectorIngest))                    // Vector http sink receiver
+	http.HandleFunc("/api/ingest/firehose", handleFirehose(apiKey))                                      // AWS Firehose HTTP endpoint (access key = API key)
+	http.HandleFunc("/api/testing/echo-classify", ingestAuthMiddleware(apiKey, handleEchoClassify))      // Run a log through the ingest pipeline without storing it
+	http.HandleFunc("/api/", handleSentry(apiKey))                                                       // Sentry store/envelope endpoints (/api/<project>/envelope/)
+	http.HandleFunc("/api/alerts", authMiddleware(apiKey, handleAlerts))                                 // Recently fired alerts
+	http.HandleFunc("/api/alerts/silences", authMiddleware(apiKey, handleSilences))                      // List and create alert silences
+	http.HandleFunc("/api/alerts/silences/", authMiddleware(apiKey, handleSilence))                      // Delete an alert silence
+	http.HandleFunc("/api/alerts/active", authMiddleware(apiKey, handleActiveAlerts))                    // Firing alerts, silences and resolutions
+	http.HandleFunc("/api/alerts/ws", socketAuthMiddleware(apiKey, handleAlertSocket))                   // Notification center push (WebSocket)
+	http.HandleFunc("/api/alerts/", authMiddleware(apiKey, handleAlertAck))                              // Acknowledge an alert
+	http.HandleFunc("/api/escalations", authMiddleware(apiKey, handleEscalations))                       // Escalation rules and current counts
+	http.HandleFunc("/api/severity-overrides", authMiddleware(apiKey, handleSeverityOverrides))          // Severity override rules and how often they applied
+	http.HandleFunc("/api/deliveries", authMiddleware(apiKey, handleDeliveries))                         // Outbound webhook and issue deliveries
+	http.HandleFunc("/api/deliveries/", authMiddleware(apiKey, handleDelivery))                          // Retry a delivery
+	http.HandleFunc("/api/security/summary", authMiddleware(apiKey, handleSecuritySummary))              // Brute force, scanners and 401 rates
+	http.HandleFunc("/api/security/rules", authMiddleware(apiKey, handleSecurityRules))                  // Escalation rule templates for security alerts
+	http.HandleFunc("/api/slo", authMiddleware(apiKey, handleSLOs))                                      // Error budget status of every SLO
+	http.HandleFunc("/api/slo/", authMiddleware(apiKey, handleSLO))                                      // Show, define or remove the SLO of a source
+	http.HandleFunc("/api/groups", authMiddleware(apiKey, handleErrorGroups))                            // Error groups by fingerprint
+	http.HandleFunc("/api/groups/", authMiddleware(apiKey, handleErrorGroup))                            // One error group and its tracker issue
+	http.HandleFunc("/api/releases", authMiddleware(apiKey, handleReleases))                             // Error rates and new error groups per release
+	http.HandleFunc("/api/latency", authMiddleware(apiKey, handleLatency))                               // Duration percentiles per source
+	http.HandleFunc("/api/top", authMiddleware(apiKey, handleTop))                                       // Most frequent sources, categories or titles
+	http.HandleFunc("/api/correlations", authMiddleware(apiKey, handleCorrelations))                     // Errors and warnings whose spikes co-occur
+	http.HandleFunc("/api/reports", authMiddleware(apiKey, handleReports))                               // Scheduled reports, generate one now
+	http.HandleFunc("/api/reports/", authMiddleware(apiKey, handleReport))                               // Download a generated report as HTML or PDF
+	http.HandleFunc("/api/patterns", authMiddleware(apiKey, handlePatterns))                             // Smart detection pattern lists
+	http.HandleFunc("/api/patterns/", authMiddleware(apiKey, handlePatternList))                         // Add or remove a detection pattern
+	http.HandleFunc("/api/patterns/packs", authMiddleware(apiKey, handlePatternPacks))                   // Business pattern packs and where they are enabled
+	http.HandleFunc("/api/categories", authMiddleware(apiKey, handleCategories))                         // Category taxonomy and unknown categories
+	http.HandleFunc("/api/categories/", authMiddleware(apiKey, handleCategory))                          // One category of the taxonomy
+	http.HandleFunc("/api/corrections", authMiddleware(apiKey, handleCorrections))                       // Correct misclassified logs, list learned corrections
+	http.HandleFunc("/api/corrections/", authMiddleware(apiKey, handleCorrection))                       // Forget a learned correction
+	http.HandleFunc("/api/preferences", authMiddleware(apiKey, handlePreferences))                       // Dashboard preferences of the caller
+	http.HandleFunc("/api/colors/sources", authMiddleware(apiKey, handleSourceColors))                   // Colors of the sources (-color-by source)
+	http.HandleFunc("/api/colors/sources/", authMiddleware(apiKey, handleSourceColor))                   // Set or reset the color of a source
+	http.HandleFunc("/api/sources", authMiddleware(apiKey, handleSources))                               // Source registry with recent volume
+	http.HandleFunc("/api/sources/", authMiddleware(apiKey, handleSource))                               // Show, register or forget a source
+	http.HandleFunc("/api/annotations", authMiddleware(apiKey, handleAnnotations))                       // List and record deploy/config markers
+	http.HandleFunc("/api/annotations/", authMiddleware(apiKey, handleAnnotation))                       // Delete a marker
+	http.HandleFunc("/api/sourcemaps", authMiddleware(apiKey, handleSourceMaps))                         // Upload and list JavaScript source maps
+	http.HandleFunc("/api/sourcemaps/", authMiddleware(apiKey, handleSourceMap))                         // Delete a source map
+	http.HandleFunc("/api/admin/query-insights", authMiddleware(apiKey, handleQueryInsights))            // Slow query statistics and index advice
+	http.HandleFunc("/api/slack/command", handleSlackCommand)                                            // Slack slash command (Slack-signed)
 }
 
 // =============================================================================
@@ -649,106 +1276,218 @@ func setupRoutes(apiKey string) {
 
 // createTable creates the logs table with proper indexes if it doesn't exist
 func createTable() error {
-	query := `
-	-- Main logs table with mandatory fields
-	CREATE TABLE IF NOT EXISTS logs (
-		id          INTEGER PRIMARY KEY AUTOINCREMENT,
-		type        TEXT NOT NULL,                        -- Log category
-		title       TEXT NOT NULL,                        -- Brief title (only required field in v1.1+)
-		description TEXT,                                 -- Detailed description (optional in v1.1+)
-		source      TEXT,                                 -- Source service/component (optional in v1.1+)
-		color       TEXT NOT NULL,                        -- Tailwind CSS 4 color
-		body        TEXT,                                 -- JSON body (optional)
-		timestamp   DATETIME DEFAULT CURRENT_TIMESTAMP    -- Auto-generated timestamp
-	);
-	
-	-- Performance indexes for common query patterns
-	CREATE INDEX IF NOT EXISTS idx_logs_type ON logs(type);
-	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_logs_color ON logs(color);
-	CREATE INDEX IF NOT EXISTS idx_logs_source ON logs(source);
-	`
-
-	if _, err := db.Exec(query); err != nil {
+	// Main logs table and base indexes (dialect-specific DDL lives in store.go)
+	if _, err := db.Exec(db.Schema()); err != nil {
 		return err
 	}
 
-	// Add derived metadata columns if they don't exist (migration-safe)
-	migrationQuery := `
-	-- Add derived metadata columns for smart analytics
-	ALTER TABLE logs ADD COLUMN derived_severity TEXT;
-	ALTER TABLE logs ADD COLUMN derived_source TEXT;
-	ALTER TABLE logs ADD COLUMN derived_category TEXT;
-	
-	-- Add indexes for analytics performance
-	CREATE INDEX IF NOT EXISTS idx_logs_derived_severity ON logs(derived_severity);
-	CREATE INDEX IF NOT EXISTS idx_logs_derived_source ON logs(derived_source);
-	CREATE INDEX IF NOT EXISTS idx_logs_derived_category ON logs(derived_category);
-	`
+	// Hourly aggregates for rolled-up logs
+	if err := createRollupTable(); err != nil {
+		return err
+	}
 
-	// Execute migration (will silently fail if columns already exist)
-	db.Exec(migrationQuery)
+	// Tamper-evident hash chain (only filled with -hash-chain)
+	if err := createChainTable(); err != nil {
+		return err
+	}
 
-	return nil
-}
+	// Managed API keys (hashed)
+	if err := createAPIKeyTable(); err != nil {
+		return err
+	}
 
-// cleanupOldLogs removes logs older than the specified retention period
-func cleanupOldLogs(retentionDays int) {
-	cutoffDate := time.Now().AddDate(0, 0, -retentionDays)
-	result, err := db.Exec("DELETE FROM logs WHERE timestamp < ?", cutoffDate)
-	if err != nil {
-		log.Printf("⚠️  Cleanup error: %v", err)
-		return
+	// History of fired alerts and the silences muting them
+	if err := createAlertsTable(); err != nil {
+		return err
+	}
+	if err := createSilencesTable(); err != nil {
+		return err
+	}
+	if err := createAlertAcksTable(); err != nil {
+		return err
 	}
 
-	deleted, _ := result.RowsAffected()
-	if deleted > 0 {
-		log.Printf("🗑️  Cleaned up %d old logs (older than %d days)", deleted, retentionDays)
+	// Error groups and their linked issues
+	if err := createGroupsTable(); err != nil {
+		return err
 	}
-}
 
-// =============================================================================
-// AUTHENTICATION MIDDLEWARE
-// =============================================================================
+	// Runtime changes to the smart detection patterns
+	if err := createPatternsTable(); err != nil {
+		return err
+	}
 
-// authMiddleware provides optional API key authentication
-// If no API key is configured, requests pass through without authentication
-func authMiddleware(apiKey string, handler http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Skip authentication if no API key is configured
-		if apiKey == "" {
-			handler(w, r)
-			return
-		}
+	// Dashboard preferences per user
+	if err := createPreferencesTable(); err != nil {
+		return err
+	}
 
-		// Check for API key in Authorization header (supports both formats)
-		auth := r.Header.Get("Authorization")
-		if auth != apiKey && auth != "Bearer "+apiKey {
-			http.Error(w, "Unauthorized - Invalid API key", http.StatusUnauthorized)
-			return
-		}
+	// Tags and acknowledgements set by bulk actions
+	if err := createTriageTable(); err != nil {
+		return err
+	}
 
-		// Authentication successful, proceed to handler
-		handler(w, r)
+	// Colors chosen for sources with -color-by source
+	if err := createSourceColorsTable(); err != nil {
+		return err
 	}
-}
 
-// =============================================================================
-// VALIDATION FUNCTIONS
-// =============================================================================
+	// Error budgets per source
+	if err := createSLOTable(); err != nil {
+		return err
+	}
 
-// isValidTailwindColor validates if a color name is valid in Tailwind CSS 4
-// Returns true for any of the 22 official Tailwind color names
-func isValidTailwindColor(color string) bool {
-	validColors := map[string]bool{
-		// Neutral colors
-		"slate": true, "gray": true, "zinc": true, "neutral": true, "stone": true,
-		// Warm colors
-		"red": true, "orange": true, "amber": true, "yellow": true, "lime": true,
-		// Cool colors
-		"green": true, "emerald": true, "teal": true, "cyan": true, "sky": true, "blue": true,
-		// Purple/Pink spectrum
-		"indigo": true, "violet": true, "purple": true, "fuchsia": true, "pink": true, "rose": true,
+	// Owners, environments and runbooks of sources
+	if err := createSourcesTable(); err != nil {
+		return err
+	}
+
+	// Deploy and config change markers for the charts
+	if err := createAnnotationsTable(); err != nil {
+		return err
+	}
+
+	// Filters exempting logs from deletion
+	if err := createLegalHoldsTable(); err != nil {
+		return err
+	}
+
+	// Source maps for minified JavaScript stack traces
+	if err := createSourceMapsTable(); err != nil {
+		return err
+	}
+
+	// Distinct users affected by error groups
+	if err := createGroupUsersTable(); err != nil {
+		return err
+	}
+
+	// Corrected logs and the corrections learned from them
+	if err := createCorrectionsTables(); err != nil {
+		return err
+	}
+
+	// Repeats counted by the logs representing throttled floods
+	if err := createRepeatsTable(); err != nil {
+		return err
+	}
+
+	// Generated reports
+	if err := createReportsTable(); err != nil {
+		return err
+	}
+
+	// Outbound notifications and their outcome
+	if err := createDeliveriesTable(); err != nil {
+		return err
+	}
+
+	// Hourly counters /api/stats is served from
+	if err := createHourlyStatsTable(); err != nil {
+		return err
+	}
+
+	// Database size samples the storage forecast is made from
+	if err := createStorageSamplesTable(); err != nil {
+		return err
+	}
+
+	// Allowed categories and their aliases
+	if err := createTaxonomyTable(); err != nil {
+		return err
+	}
+
+	// Settings changed from the dashboard and the audit log of configuration changes
+	if err := createRuntimeConfigTables(); err != nil {
+		return err
+	}
+
+	// Versioned changes to existing tables, e.g. the derived metadata columns (see migrations.go)
+	ran, err := migrateUp()
+	for _, m := range ran {
+		log.Printf("🗃️  Applied schema migration %04d %s", m.Version, m.Name)
+	}
+	return err
+}
+
+// cleanupOldLogs removes logs older than the specified retention period
+func cleanupOldLogs(retentionDays int) {
+	cutoffDate := time.Now().AddDate(0, 0, -retentionDays)
+
+	// With partitioning, expired months are dropped by deleting their file
+	if partitionMode {
+		cleanupPartitions(cutoffDate)
+	}
+
+	// Downsample aged low-severity logs before they are deleted outright
+	if _, err := runRollup(); err != nil {
+		log.Printf("⚠️  Rollup error: %v", err)
+	}
+	cleanupOldRollups()
+
+	// Logs under a legal hold stay until it is released (see holds.go)
+	filter, args := excludeHeld("timestamp < ?", []interface{}{cutoffDate})
+	result, err := db.Exec("DELETE FROM logs WHERE "+filter, args...)
+	if err != nil {
+		log.Printf("⚠️  Cleanup error: %v", err)
+		return
+	}
+
+	pruneChain(cutoffDate)
+	pruneTriage(cutoffDate)
+	pruneRepeats(cutoffDate)
+	pruneReports(cutoffDate)
+	pruneDeliveries(cutoffDate)
+
+	deleted, _ := result.RowsAffected()
+	recordCleanup(deleted)
+	if deleted > 0 {
+		invalidateHourlyStats()
+		log.Printf("🗑️  Cleaned up %d old logs (older than %d days)", deleted, retentionDays)
+	}
+}
+
+// =============================================================================
+// AUTHENTICATION MIDDLEWARE
+// =============================================================================
+
+// authMiddleware provides optional API key authentication
+// If no API key is configured, requests pass through without authentication
+func authMiddleware(apiKey string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Skip authentication if no API key is configured
+		if apiKey == "" && !managedKeysExist() {
+			handler(w, r)
+			return
+		}
+
+		// Check for API key in Authorization header (supports both formats), compared by hash in constant time
+		if !validAPIKey(requestAPIKey(r), apiKey) {
+			http.Error(w, "Unauthorized - Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		// Authentication successful, proceed to handler
+		handler(w, r)
+	}
+}
+
+// =============================================================================
+// VALIDATION FUNCTIONS
+// =============================================================================
+
+// isValidTailwindColor validates if a color name is valid in Tailwind CSS 4
+// Returns true for any of the 22 official Tailwind color names
+func isValidTailwindColor(color string) bool {
+	validColors := map[string]bool{
+		// Neutral colors
+		"slate": true, "gray": true, "zinc": true, "neutral": true, "stone": true,
+		// Warm colors
+		"red": true, "orange": true, "amber": true, "yellow": true, "lime": true,
+		// Cool colors
+		"green": true, "emerald": true, "teal": true, "cyan": true, "sky": true, "blue": true,
+		// Purple/Pink spectrum
+		"indigo": true, "violet": true, "purple": true, "fuchsia": true, "pink": true, "rose": true,
 	}
 	return validColors[color]
 }
@@ -796,16 +1535,17 @@ func deriveTypeFromContent(header LogHeader, body map[string]interface{}) string
 	}
 
 	// Use comprehensive pattern matching
-	if containsAnyKeyword(allText, errorKeywords) {
+	patterns := livePatterns()
+	if patterns.errorMatcher.containsAny(allText) {
 		return "error"
 	}
-	if containsAnyKeyword(allText, warningKeywords) {
+	if patterns.warningMatcher.containsAny(allText) {
 		return "warning"
 	}
-	if containsAnyKeyword(allText, successKeywords) {
+	if patterns.successMatcher.containsAny(allText) {
 		return "success"
 	}
-	if containsAnyKeyword(allText, debugKeywords) {
+	if patterns.debugMatcher.containsAny(allText) {
 		return "debug"
 	}
 
@@ -816,8 +1556,8 @@ func deriveTypeFromContent(header LogHeader, body map[string]interface{}) string
 	if detectSecurityIssue(allText) {
 		return "security"
 	}
-	if statusCode := extractHTTPStatusCode(allText); statusCode != "" {
-		if severity, ok := httpStatusSeverity[statusCode]; ok {
+	if code := detectHTTPStatus(deriveLogSource(header, body, allText), allText, body); code != 0 {
+		if severity, ok := livePatterns().httpStatusSeverity[strconv.Itoa(code)]; ok {
 			return severity
 		}
 	}
@@ -862,37 +1602,8 @@ func deriveColorFromSeverity(header LogHeader, body map[string]interface{}) stri
 	// Use the comprehensive deriveMetadata function
 	metadata := deriveMetadata(header, body)
 
-	// Map severity to appropriate color with more granularity
-	switch metadata.DerivedSeverity {
-	case "critical":
-		return "red"
-	case "error":
-		return "rose"
-	case "warning":
-		return "yellow"
-	case "success":
-		return "green"
-	case "debug":
-		return "gray"
-	case "info":
-		return "blue"
-	default:
-		// Special cases based on category
-		switch metadata.DerivedCategory {
-		case "security":
-			return "purple"
-		case "database":
-			return "indigo"
-		case "performance":
-			return "orange"
-		case "business":
-			return "emerald"
-		case "http":
-			return "cyan"
-		default:
-			return "blue"
-		}
-	}
+	// Map severity (or, failing that, category) to a color - see colors.go
+	return colorForLog(header.Type, metadata)
 }
 
 // Returns LogMetadata with derived insights that power the analytics dashboard
@@ -911,25 +1622,17 @@ func deriveMetadata(header LogHeader, body map[string]interface{}) LogMetadata {
 	allText := fmt.Sprintf("%s %s %s %s",
 		header.Type, header.Title, header.Description, bodyText)
 
-	// Priority 1: Check HTTP status codes (most definitive)
-	if statusCode := extractHTTPStatusCode(allText); statusCode != "" {
-		if severity, ok := httpStatusSeverity[statusCode]; ok {
+	// Smart source extraction from multiple possible locations
+	metadata.DerivedSource = deriveLogSource(header, body, allText)
+
+	// Priority 1: Check HTTP status codes (most definitive, see httpstatus.go)
+	if code := detectHTTPStatus(metadata.DerivedSource, allText, body); code != 0 {
+		metadata.DerivedHTTPStatus = code
+		if severity, ok := livePatterns().httpStatusSeverity[strconv.Itoa(code)]; ok {
 			metadata.DerivedSeverity = severity
 		} else {
 			// Default based on status code range
-			code, _ := strconv.Atoi(statusCode)
-			switch {
-			case code >= 200 && code < 300:
-				metadata.DerivedSeverity = "success"
-			case code >= 300 && code < 400:
-				metadata.DerivedSeverity = "info"
-			case code >= 400 && code < 500:
-				metadata.DerivedSeverity = "warning"
-			case code >= 500:
-				metadata.DerivedSeverity = "error"
-			default:
-				metadata.DerivedSeverity = "info"
-			}
+			metadata.DerivedSeverity = httpStatusRangeSeverity(code)
 		}
 	} else if hasStackTrace(allText) {
 		// Priority 2: Stack traces always indicate errors
@@ -943,32 +1646,24 @@ func deriveMetadata(header LogHeader, body map[string]interface{}) LogMetadata {
 	} else if sysError := detectSystemError(allText); sysError != "" {
 		// Priority 5: System error codes
 		metadata.DerivedSeverity = sysError
-	} else if businessSev := detectBusinessLogic(allText); businessSev != "" {
+	} else if businessSev := detectBusinessLogic(metadata.DerivedSource, allText); businessSev != "" {
 		// Priority 6: Business logic patterns
 		metadata.DerivedSeverity = businessSev
 	} else {
 		// Priority 7: Keyword-based detection
 		textLower := strings.ToLower(allText)
+		patterns := livePatterns()
 
-		// Check performance metrics
+		// Check performance metrics (rated with the thresholds of the source, see performance.go)
 		if duration, found := extractPerformanceMetrics(allText); found {
-			switch {
-			case duration >= performanceThresholds["critical"]:
-				metadata.DerivedSeverity = "critical"
-			case duration >= performanceThresholds["slow"]:
-				metadata.DerivedSeverity = "warning"
-			case duration >= performanceThresholds["normal"]:
-				metadata.DerivedSeverity = "info"
-			default:
-				metadata.DerivedSeverity = "success"
-			}
-		} else if containsAnyKeyword(textLower, errorKeywords) {
+			metadata.DerivedSeverity = durationSeverity(metadata.DerivedSource, duration)
+		} else if patterns.errorMatcher.containsAny(textLower) {
 			metadata.DerivedSeverity = "error"
-		} else if containsAnyKeyword(textLower, warningKeywords) {
+		} else if patterns.warningMatcher.containsAny(textLower) {
 			metadata.DerivedSeverity = "warning"
-		} else if containsAnyKeyword(textLower, successKeywords) {
+		} else if patterns.successMatcher.containsAny(textLower) {
 			metadata.DerivedSeverity = "success"
-		} else if containsAnyKeyword(textLower, debugKeywords) {
+		} else if patterns.debugMatcher.containsAny(textLower) {
 			metadata.DerivedSeverity = "debug"
 		} else {
 			// Check resource usage percentages
@@ -986,41 +1681,6 @@ func deriveMetadata(header LogHeader, body map[string]interface{}) LogMetadata {
 		}
 	}
 
-	// Smart source extraction from multiple possible locations
-	if service, ok := body["service"].(string); ok && service != "" {
-		metadata.DerivedSource = service
-	} else if source, ok := body["source"].(string); ok && source != "" {
-		metadata.DerivedSource = source
-	} else if component, ok := body["component"].(string); ok && component != "" {
-		metadata.DerivedSource = component
-	} else if app, ok := body["app"].(string); ok && app != "" {
-		metadata.DerivedSource = app
-	} else if module, ok := body["module"].(string); ok && module != "" {
-		metadata.DerivedSource = module
-	} else if origin, ok := body["origin"].(string); ok && origin != "" {
-		metadata.DerivedSource = origin
-	} else if header.Source != "" {
-		metadata.DerivedSource = header.Source
-	} else {
-		// Try to extract source from stack traces
-		if hasStackTrace(allText) {
-			if strings.Contains(allText, ".java:") {
-				metadata.DerivedSource = "java-app"
-			} else if strings.Contains(allText, ".py:") {
-				metadata.DerivedSource = "python-app"
-			} else if strings.Contains(allText, ".js:") {
-				metadata.DerivedSource = "node-app"
-			} else if strings.Contains(allText, ".go:") {
-				metadata.DerivedSource = "go-app"
-			} else {
-				metadata.DerivedSource = "unknown"
-			}
-		} else {
-			// Use smart content-based source extraction
-			metadata.DerivedSource = smartSourceExtraction(allText)
-		}
-	}
-
 	// Smart category derivation
 	if header.Type != "" {
 		metadata.DerivedCategory = strings.ToLower(header.Type)
@@ -1034,7 +1694,7 @@ func deriveMetadata(header LogHeader, body map[string]interface{}) LogMetadata {
 			strings.Contains(strings.ToLower(allText), "invoice") ||
 			strings.Contains(strings.ToLower(allText), "subscription") {
 			metadata.DerivedCategory = "business"
-		} else if extractHTTPStatusCode(allText) != "" {
+		} else if metadata.DerivedHTTPStatus != 0 {
 			metadata.DerivedCategory = "http"
 		} else if hasStackTrace(allText) {
 			metadata.DerivedCategory = "exception"
@@ -1060,7 +1720,50 @@ func deriveMetadata(header LogHeader, body map[string]interface{}) LogMetadata {
 		}
 	}
 
-	return metadata
+	// Language of the stack trace or content, if recognisable
+	metadata.DerivedLanguage = detectLanguage(allText, body)
+
+	// Duration mentioned in the text, stored for filters, sorting and percentiles
+	if duration, found := extractPerformanceMetrics(allText); found {
+		metadata.DerivedDurationMs = duration
+	}
+
+	// Categories outside the taxonomy are flagged by createLog (see taxonomy.go)
+	metadata.DerivedCategory, _ = canonicalCategory(metadata.DerivedCategory)
+
+	// Corrections learned from misclassified logs win over the detection
+	return withLearnedCorrection(header, metadata)
+}
+
+// deriveLogSource extracts the source of a log from multiple possible locations
+func deriveLogSource(header LogHeader, body map[string]interface{}, allText string) string {
+	for _, field := range []string{"service", "source", "component", "app", "module", "origin"} {
+		if value, ok := body[field].(string); ok && value != "" {
+			return value
+		}
+	}
+	if header.Source != "" {
+		return header.Source
+	}
+
+	// Try to extract source from stack traces
+	if hasStackTrace(allText) {
+		switch {
+		case strings.Contains(allText, ".java:"):
+			return "java-app"
+		case strings.Contains(allText, ".py:"):
+			return "python-app"
+		case strings.Contains(allText, ".js:"):
+			return "node-app"
+		case strings.Contains(allText, ".go:"):
+			return "go-app"
+		default:
+			return "unknown"
+		}
+	}
+
+	// Use smart content-based source extraction
+	return smartSourceExtraction(allText)
 }
 
 // containsString checks if a slice contains a string (helper function)
@@ -1088,6 +1791,15 @@ func validateLogHeader(header *LogHeader) error {
 	return nil
 }
 
+// validateLogSeverity checks a client-provided severity against the known ones
+func validateLogSeverity(entry *Log) error {
+	entry.Severity = strings.ToLower(strings.TrimSpace(entry.Severity))
+	if entry.Severity != "" && !containsString(builtinSeverities, entry.Severity) {
+		return fmt.Errorf("invalid severity '%s' - must be one of %s", entry.Severity, strings.Join(builtinSeverities, ", "))
+	}
+	return nil
+}
+
 // =============================================================================
 // HTTP HANDLERS - CORE API
 // =============================================================================
@@ -1119,9 +1831,16 @@ func handleLogs(w http.ResponseWriter, r *http.Request) {
 
 // createLog creates a new log entry from JSON request body
 func createLog(w http.ResponseWriter, r *http.Request) {
-	// Parse JSON request body
+	logsReceived.Add(1)
+
+	// Parse JSON request body (oversized requests are refused before being read into memory)
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
 	var entry Log
 	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, fmt.Sprintf("Request too large - limit is %d bytes", maxRequestBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
@@ -1131,26 +1850,68 @@ func createLog(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := validateLogSeverity(&entry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	traceIngest(r, "validation", "passed", "")
 
 	// =============================================================================
 	// SMART DEFAULTS SECTION - v1.2.0 ENHANCED SOURCE DETECTION
 	// =============================================================================
 
-	// Auto-derive type if missing
-	if entry.Header.Type == "" {
+	// Manual entries are not pattern matched (see manualentries.go)
+	if isAnnotation(entry.Header) {
+		normalizeAnnotation(&entry)
+		traceIngest(r, "annotation", "manual entry", entry.Header.Type)
+	}
+
+	// Auto-derive type if missing (a client-provided severity is the type, no guessing)
+	if entry.Header.Type == "" && entry.Severity != "" {
+		entry.Header.Type = entry.Severity
+		traceIngest(r, "type", "from severity", entry.Header.Type)
+	} else if entry.Header.Type == "" {
 		entry.Header.Type = deriveTypeFromContent(entry.Header, entry.Body)
+		traceIngest(r, "type", "derived", entry.Header.Type)
+	} else {
+		traceIngest(r, "type", "client", entry.Header.Type)
 	}
 
 	// Auto-derive source if missing
 	if entry.Header.Source == "" {
 		entry.Header.Source = deriveSourceFromBody(entry.Body)
+		traceIngest(r, "source", "derived", entry.Header.Source)
+	} else {
+		traceIngest(r, "source", "client", entry.Header.Source)
 	}
 
 	// Auto-assign color based on detected severity if missing
-	if entry.Header.Color == "" {
+	derivedColor := entry.Header.Color == ""
+	if derivedColor {
 		entry.Header.Color = deriveColorFromSeverity(entry.Header, entry.Body)
 	}
 
+	// Ingest tokens are scoped to one source, whatever the client claims
+	tokenSource := ingestTokenSource(r)
+	if tokenSource != "" {
+		entry.Header.Source = tokenSource
+		traceIngest(r, "source", "ingest token", tokenSource)
+	}
+
+	// Resolve the release (request header, log or body, see releases.go)
+	release, err := resolveRelease(r, entry.Header, entry.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry.Header.Release = release
+	if release != "" {
+		traceIngest(r, "release", "resolved", release)
+	}
+
+	// Point minified JavaScript frames at the original sources (see sourcemaps.go)
+	resolveSourceMaps(entry.Header.Source, entry.Header.Release, entry.Body)
+
 	// Serialize body to JSON for storage
 	bodyJSON, err := json.Marshal(entry.Body)
 	if err != nil {
@@ -1158,63 +1919,277 @@ func createLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Derive smart metadata from the log content
-	metadata := deriveMetadata(entry.Header, entry.Body)
+	// Derive smart metadata from the log content, then apply the -classifier (see classifier.go)
+	metadata, classified := classifyLog(entry.Header, entry.Body, deriveMetadata(entry.Header, entry.Body))
+	if classified {
+		traceIngest(r, "classification", "classifier", metadata.DerivedSeverity+"/"+metadata.DerivedCategory)
+		if derivedColor {
+			entry.Header.Color = colorForLog(entry.Header.Type, metadata)
+		}
+	} else {
+		traceIngest(r, "classification", "smart defaults", metadata.DerivedSeverity+"/"+metadata.DerivedCategory)
+	}
+	if tokenSource != "" {
+		metadata.DerivedSource = tokenSource
+	}
+	var knownCategory bool
+	if metadata.DerivedCategory, knownCategory = canonicalCategory(metadata.DerivedCategory); !knownCategory {
+		w.Header().Set("X-CubicLog-Unknown-Category", metadata.DerivedCategory)
+		traceIngest(r, "category", "unknown", metadata.DerivedCategory)
+	} else {
+		traceIngest(r, "category", "known", metadata.DerivedCategory)
+	}
+	if severity := ingestSeverity(r); severity != "" {
+		metadata.DerivedSeverity = severity
+		traceIngest(r, "severity", "converted log", severity)
+	}
+
+	// A client-provided severity is stored as is, whatever the content suggests
+	if entry.Severity != "" {
+		metadata.DerivedSeverity = entry.Severity
+		traceIngest(r, "severity", "client", entry.Severity)
+		if derivedColor {
+			entry.Header.Color = colorForLog(entry.Header.Type, metadata)
+		}
+	}
+	if derivedColor {
+		traceIngest(r, "color", "derived", entry.Header.Color)
+	} else {
+		traceIngest(r, "color", "client", entry.Header.Color)
+	}
+	dryRun := isDryRun(r)
+	var overridden *severityOverrideRule
+	if metadata, overridden = applySeverityOverride(metadata); overridden != nil {
+		w.Header().Set("X-CubicLog-Severity-Override", overridden.Name)
+		traceIngest(r, "severity override", overridden.Name, metadata.DerivedSeverity)
+	}
+	if isAnnotation(entry.Header) {
+		metadata = annotationMetadata(metadata)
+	}
+
+	// Resolve the environment (API key, request header, log, body or source registry)
+	if entry.Header.Environment, err = resolveEnvironment(r, entry.Header, entry.Body, metadata.DerivedSource); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if entry.Header.Environment != "" {
+		traceIngest(r, "environment", "resolved", entry.Header.Environment)
+	}
+
+	// Escalate logs that arrive faster than an escalation rule allows, within the
+	// severity overrides. The log is only counted once it is accepted (see accepted below).
+	var escalated *escalation
+	escalationHeader, escalationBody, escalationMetadata := entry.Header, entry.Body, metadata
+	if escalations != nil && !dryRun {
+		if escalated = escalations.peek(time.Now(), escalationHeader, escalationBody, escalationMetadata); escalated != nil {
+			metadata.DerivedSeverity = escalated.Rule.EscalateTo
+			w.Header().Set("X-CubicLog-Escalated", escalated.Rule.Name)
+			if capped, rule := applySeverityOverride(metadata); rule != nil {
+				metadata, overridden = capped, rule
+				w.Header().Set("X-CubicLog-Severity-Override", rule.Name)
+			}
+		}
+	}
+
+	// accepted counts a log that was stored, spooled or throttled towards the
+	// escalation windows and severity override stats - rejected, dry-run and
+	// quota-limited logs don't count
+	accepted := func() {
+		if escalations != nil {
+			escalated = escalations.observe(time.Now(), escalationHeader, escalationBody, escalationMetadata)
+		}
+		if overridden != nil {
+			overridden.applied.Add(1)
+		}
+	}
+
+	// Batch endpoints acknowledge each event with its metadata (see ingestack.go)
+	reportIngestMetadata(r, metadata)
 
-	// Insert into database with derived metadata (handling nullable fields for v1.1+)
-	result, err := db.Exec(`
-		INSERT INTO logs (type, title, description, source, color, body, derived_severity, derived_source, derived_category) 
-		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?)`,
-		entry.Header.Type,
-		entry.Header.Title,
-		entry.Header.Description, // Will be NULL if empty
-		entry.Header.Source,      // Will be NULL if empty
-		entry.Header.Color,
-		string(bodyJSON),
-		metadata.DerivedSeverity,
-		metadata.DerivedSource,
-		metadata.DerivedCategory)
+	// Enforce the stored body size limit (metadata above still sees the full body)
+	truncated := false
+	if maxBodyBytes > 0 && len(bodyJSON) > maxBodyBytes {
+		if oversizePolicy == "reject" {
+			http.Error(w, fmt.Sprintf("Body too large - limit is %d bytes", maxBodyBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		entry.Body, bodyJSON = truncateBody(entry.Body, len(bodyJSON), maxBodyBytes)
+		truncated = true
+		traceIngest(r, "body limit", "truncated", strconv.Itoa(maxBodyBytes))
+	}
 
+	// Dry runs stop here with the record that would have been stored
+	if dryRun {
+		var notes []string
+		if truncated {
+			notes = append(notes, fmt.Sprintf("body truncated to fit the %d byte limit", maxBodyBytes))
+		}
+		writeDryRun(w, entry, metadata, notes)
+		return
+	}
+
+	// Enforce daily ingestion quotas per source and API key
+	if quotas != nil {
+		size := int64(len(bodyJSON) + len(entry.Header.Title) + len(entry.Header.Description))
+		switch quotas.checkQuota(metadata.DerivedSource, requestAPIKey(r), size) {
+		case quotaReject:
+			logsQuotaLimited.Add(1)
+			w.Header().Set("Retry-After", strconv.Itoa(secondsUntilQuotaReset()))
+			http.Error(w, "Daily ingestion quota exceeded", http.StatusTooManyRequests)
+			return
+		case quotaCountOnly:
+			logsQuotaLimited.Add(1)
+			if err := countLogOnly(metadata.DerivedSource, metadata.DerivedSeverity); err != nil {
+				log.Printf("Quota counter error: %v", err)
+				http.Error(w, "Failed to save log", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("X-CubicLog-Quota", "counted")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(entry)
+			return
+		}
+	}
+
+	// Floods of one fingerprint are counted on a representative instead of stored (see throttle.go)
+	fingerprint := errorFingerprint(metadata.DerivedSource, entry.Header.Title)
+	if throttle != nil {
+		now := time.Now()
+		if representative, throttled := throttle.observe(fingerprint, now); throttled && recordRepeat(representative, now) == nil {
+			logsThrottled.Add(1)
+			entry.ID, entry.Timestamp = int(representative), now
+			accepted()
+			recordLogOutcome(representative, entry.Header, entry.Body, metadata, escalated)
+			w.Header().Set("X-CubicLog-Throttled", strconv.FormatInt(representative, 10))
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(entry)
+			return
+		}
+	}
+
+	// Encrypt sensitive columns when encryption at rest is enabled
+	storedBody, err := sealField(string(bodyJSON))
+	if err != nil {
+		log.Printf("Encryption error: %v", err)
+		http.Error(w, "Failed to save log", http.StatusInternalServerError)
+		return
+	}
+	storedDescription, err := sealField(entry.Header.Description)
+	if err != nil {
+		log.Printf("Encryption error: %v", err)
+		http.Error(w, "Failed to save log", http.StatusInternalServerError)
+		return
+	}
+
+	// Insert into database with derived metadata (spooled while the database can't take writes)
+	id, spooled, err := storeLog(storedLog{
+		Type:              entry.Header.Type,
+		Title:             entry.Header.Title,
+		Description:       storedDescription,
+		Source:            entry.Header.Source,
+		Color:             entry.Header.Color,
+		Body:              storedBody,
+		DerivedSeverity:   metadata.DerivedSeverity,
+		DerivedSource:     metadata.DerivedSource,
+		DerivedCategory:   metadata.DerivedCategory,
+		DerivedLanguage:   metadata.DerivedLanguage,
+		DerivedDurationMs: metadata.DerivedDurationMs,
+		DerivedHTTPStatus: metadata.DerivedHTTPStatus,
+		Environment:       entry.Header.Environment,
+		Release:           entry.Header.Release,
+	})
+
+	if err == errSpoolFull {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Storage temporarily unavailable - retry later", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		log.Printf("Database insert error: %v", err)
 		http.Error(w, "Failed to save log", http.StatusInternalServerError)
 		return
 	}
 
-	// Get generated ID and set timestamp
-	id, _ := result.LastInsertId()
+	// Set generated ID and timestamp
 	entry.ID = int(id)
 	entry.Timestamp = time.Now()
 
+	// Alert once the log has its ID and counts towards its error group
+	accepted()
+	recordLogOutcome(id, entry.Header, entry.Body, metadata, escalated)
+	if throttle != nil && id > 0 {
+		throttle.remember(fingerprint, id, entry.Timestamp)
+	}
+
+	// Spooled logs are accepted but get their ID once replayed
+	if spooled {
+		logsSpooled.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(entry)
+		return
+	}
+
 	// Return created log entry
+	logsStored.Add(1)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(entry)
 }
 
-// getLogs retrieves logs with optional filtering and pagination
-func getLogs(w http.ResponseWriter, r *http.Request) {
-	// Parse pagination parameters
-	limit := parseIntParam(r, "limit", 100, 1, 1000)
-	offset := parseIntParam(r, "offset", 0, 0, 1000000)
+// recordLogOutcome counts a stored (or throttled) log towards its error group
+// and learned correction, and fires the alert of its escalation if one is due
+func recordLogOutcome(id int64, header LogHeader, body map[string]interface{}, metadata LogMetadata, escalated *escalation) {
+	recordErrorGroup(id, header, body, metadata)
+	countCorrectionApplied(metadata)
+	if escalated != nil && escalated.Fire {
+		alert := escalated.alert(id)
+		if impact := userImpactMessage(header, metadata); impact != "" {
+			alert.Message += " - " + impact
+		}
+		fireAlert(alert)
+	}
+}
 
+// buildLogFilter turns the GET /api/logs filter parameters into a WHERE clause
+// (also used by the bulk actions, see bulk.go)
+func buildLogFilter(params url.Values) (string, []interface{}, error) {
 	// Parse filter parameters
-	searchQuery := r.URL.Query().Get("q")
-	typeFilter := r.URL.Query().Get("type")
-	colorFilter := r.URL.Query().Get("color")
-	fromDate := r.URL.Query().Get("from")
-	toDate := r.URL.Query().Get("to")
+	searchQuery := params.Get("q")
+	typeFilter := params.Get("type")
+	colorFilter := params.Get("color")
+	fromDate := params.Get("from")
+	toDate := params.Get("to")
 
-	// Build dynamic SQL query
-	sqlQuery := "SELECT id, type, title, description, source, color, body, timestamp FROM logs WHERE 1=1"
+	sqlQuery := " WHERE 1=1"
 	var args []interface{}
 
 	// Add search filter (searches title, description, and body)
 	if searchQuery != "" {
-		sqlQuery += " AND (title LIKE ? OR description LIKE ? OR body LIKE ?)"
+		like := db.Like()
+		sqlQuery += " AND (title " + like + " ? OR description " + like + " ? OR body " + like + " ?)"
 		searchTerm := "%" + searchQuery + "%"
 		args = append(args, searchTerm, searchTerm, searchTerm)
 	}
 
+	// Add id filter (permalinks to a single log)
+	if idParam := params.Get("id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			return "", nil, fmt.Errorf("Invalid id")
+		}
+		sqlQuery += " AND id = ?"
+		args = append(args, id)
+	}
+
+	// Add since_id filter (new logs for a paused dashboard, see autorefresh.go)
+	if sinceParam := params.Get("since_id"); sinceParam != "" {
+		sinceID, err := strconv.Atoi(sinceParam)
+		if err != nil {
+			return "", nil, fmt.Errorf("Invalid since_id")
+		}
+		sqlQuery += " AND id > ?"
+		args = append(args, sinceID)
+	}
+
 	// Add type filter
 	if typeFilter != "" {
 		sqlQuery += " AND type = ?"
@@ -1227,6 +2202,93 @@ func getLogs(w http.ResponseWriter, r *http.Request) {
 		args = append(args, colorFilter)
 	}
 
+	// Add derived source and severity filters
+	if source := params.Get("source"); source != "" {
+		sqlQuery += " AND derived_source = ?"
+		args = append(args, source)
+	}
+	if severity := params.Get("severity"); severity != "" {
+		sqlQuery += " AND derived_severity = ?"
+		args = append(args, severity)
+	}
+
+	// Add environment filter (aliases like prod work too, see environment.go)
+	if environment := params.Get("environment"); environment != "" {
+		normalized, err := normalizeEnvironment(environment)
+		if err != nil {
+			return "", nil, err
+		}
+		sqlQuery += " AND environment = ?"
+		args = append(args, normalized)
+	}
+
+	// Add release filter (see releases.go)
+	if release := params.Get("release"); release != "" {
+		sqlQuery += " AND release = ?"
+		args = append(args, strings.TrimSpace(release))
+	}
+
+	// Add duration filters in milliseconds (see latency.go)
+	for _, bound := range []struct{ param, condition string }{
+		{"min_duration", " AND derived_duration_ms >= ?"},
+		{"max_duration", " AND derived_duration_ms <= ?"},
+	} {
+		if value := params.Get(bound.param); value != "" {
+			duration, err := parseDurationFilter(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("%s: %v", bound.param, err)
+			}
+			sqlQuery += bound.condition
+			args = append(args, duration)
+		}
+	}
+
+	// Add HTTP status filter, a code or a class like 5xx (see httpstatus.go)
+	if status := params.Get("http_status"); status != "" {
+		lowest, highest, err := parseHTTPStatusFilter(status)
+		if err != nil {
+			return "", nil, err
+		}
+		sqlQuery += " AND derived_http_status BETWEEN ? AND ?"
+		args = append(args, lowest, highest)
+	}
+
+	// Add language filter (aliases like node work too, see language.go)
+	if language := params.Get("language"); language != "" {
+		normalized, err := parseLanguageFilter(language)
+		if err != nil {
+			return "", nil, err
+		}
+		sqlQuery += " AND derived_language = ?"
+		args = append(args, normalized)
+	}
+
+	// Add triage filters (tags and acknowledgements live in log_triage)
+	if tag := params.Get("tag"); tag != "" {
+		sqlQuery += " AND id IN (SELECT log_id FROM log_triage WHERE ',' || tags || ',' " + db.Like() + " ?)"
+		args = append(args, "%,"+tag+",%")
+	}
+	if acknowledged := params.Get("acknowledged"); acknowledged != "" {
+		value, err := strconv.ParseBool(acknowledged)
+		if err != nil {
+			return "", nil, fmt.Errorf("acknowledged must be true or false")
+		}
+		operator := "IN"
+		if !value {
+			operator = "NOT IN"
+		}
+		sqlQuery += " AND id " + operator + " (SELECT log_id FROM log_triage WHERE acknowledged_at IS NOT NULL)"
+	}
+
+	// Add the sample filter (see sample.go)
+	rate, seed, err := parseSample(params)
+	if err != nil {
+		return "", nil, err
+	}
+	condition, sampleArgs := sampleFilter(rate, seed)
+	sqlQuery += condition
+	args = append(args, sampleArgs...)
+
 	// Add date filters
 	if fromDate != "" {
 		// Single date filter: show logs from specific day
@@ -1239,51 +2301,100 @@ func getLogs(w http.ResponseWriter, r *http.Request) {
 		sqlQuery += " AND timestamp <= ?"
 		args = append(args, toDate)
 	}
+	return sqlQuery, args, nil
+}
+
+// getLogs retrieves logs with optional filtering and pagination
+func getLogs(w http.ResponseWriter, r *http.Request) {
+	// Parse pagination parameters
+	limit := parseIntParam(r, "limit", 100, 1, 1000)
+	offset := parseIntParam(r, "offset", 0, 0, 1000000)
 
-	// Add ordering and pagination
-	sqlQuery += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
+	// Build dynamic SQL query (the table is filled in by queryLogs for partition routing)
+	fromDate := r.URL.Query().Get("from")
+	toDate := r.URL.Query().Get("to")
+	sqlQuery, args, err := buildLogFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sorting, err := parseLogSort(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attached, err := selectArchives(r.URL.Query().Get("attach"), fromDate, toDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Answer polling clients with 304 when nothing matching the filter changed
+	if etag, err := logsETag(fromDate, toDate, attached, sqlQuery, args); err == nil {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		log.Printf("ETag query error: %v", err)
+	}
+
+	// Add ordering and pagination (see logsort.go)
+	sqlQuery += sorting.orderBy() + " LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
 
-	// Execute query
-	rows, err := db.Query(sqlQuery, args...)
+	// Execute query (timed for /api/admin/query-insights)
+	started := time.Now()
+	rows, release, err := queryArchivedLogs(fromDate, toDate, attached, func(table string) (string, []interface{}) {
+		return "SELECT id, type, title, description, source, color, body, timestamp, environment, release FROM " + table + sqlQuery, args
+	})
 	if err != nil {
 		log.Printf("Query error: %v", err)
-		http.Error(w, "Query failed", http.StatusInternalServerError)
+		writeQueryError(w, err, "Query failed")
 		return
 	}
-	defer rows.Close()
 
 	// Parse results
 	var logs []Log
 	for rows.Next() {
 		var l Log
 		var bodyJSON string
-		var description, source, color sql.NullString
+		var description, source, color, environment, logRelease sql.NullString
 
 		err := rows.Scan(&l.ID, &l.Header.Type, &l.Header.Title,
-			&description, &source, &color, &bodyJSON, &l.Timestamp)
+			&description, &source, &color, &bodyJSON, (*scanTime)(&l.Timestamp), &environment, &logRelease)
 		if err != nil {
 			log.Printf("Row scan error: %v", err)
 			continue
 		}
 
 		// Handle nullable fields
-		l.Header.Description = description.String
+		l.Header.Description = openField(description.String)
 		l.Header.Source = source.String
 		l.Header.Color = color.String
+		l.Header.Environment = environment.String
+		l.Header.Release = logRelease.String
 
-		// Parse body JSON
+		// Parse body JSON (decrypting first if needed)
+		bodyJSON = openField(bodyJSON)
 		if bodyJSON != "" {
 			json.Unmarshal([]byte(bodyJSON), &l.Body)
 		}
 
 		logs = append(logs, l)
 	}
+	// Free the connection before attachTriage needs one (in-memory databases have a single one)
+	release()
+	recordQuery(r.URL.Query(), time.Since(started), len(logs))
 
 	// Ensure we return an array even if empty
 	if logs == nil {
 		logs = []Log{}
 	}
+	attachTriage(logs)
+	attachRepeats(logs)
 
 	json.NewEncoder(w).Encode(logs)
 }
@@ -1306,6 +2417,17 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Report spooling so monitoring notices before the buffer fills up
+	if open, reason, pending := breaker.status(); open || pending > 0 {
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "ok",
+			"storage": "spooling",
+			"reason":  reason,
+			"spooled": strconv.Itoa(pending),
+		})
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
@@ -1345,56 +2467,57 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 		DatabaseSize       string                 `json:"database_size"`
 		PatternStats       map[string]int         `json:"pattern_stats"`
 		DetectionAccuracy  string                 `json:"detection_accuracy"`
+		RolledUp           int                    `json:"rolled_up"`
+		Quotas             []QuotaUsage           `json:"quotas,omitempty"`
+		Silences           []silenceSummary       `json:"silences"`
+		ErrorGroups        []errorGroupSummary    `json:"error_groups"`
+		Corrections        correctionStats        `json:"corrections"`
+		Storage            *StorageForecast       `json:"storage,omitempty"`
+		ReadOnly           bool                   `json:"read_only,omitempty"`
 	}
 
 	stats := Stats{
-		Trends: make(map[string]interface{}),
-		Alerts: []string{},
+		Trends:   make(map[string]interface{}),
+		Alerts:   []string{},
+		ReadOnly: readOnlyMode,
 	}
 
-	// Basic counts
-	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&stats.Total)
-
-	// Logs in last 24 hours
-	last24h := time.Now().AddDate(0, 0, -1)
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE timestamp >= ?", last24h).Scan(&stats.Last24Hours)
-
-	// Smart severity breakdown using derived metadata
+	// All-time counts from the hourly counters (see hourlystats.go), rolled-up
+	// logs included in the total, severities and sources
+	totals, err := loadHourlyStats(time.Time{})
+	if err != nil {
+		http.Error(w, "Failed to load statistics", http.StatusInternalServerError)
+		return
+	}
 	stats.SeverityBreakdown = make(map[string]int)
-	if rows, err := db.Query("SELECT derived_severity, COUNT(*) FROM logs WHERE derived_severity IS NOT NULL GROUP BY derived_severity ORDER BY COUNT(*) DESC"); err == nil {
-		for rows.Next() {
-			var severity string
-			var count int
-			rows.Scan(&severity, &count)
-			stats.SeverityBreakdown[severity] = count
+	stats.PatternStats = make(map[string]int)
+	for _, pattern := range statsPatterns {
+		stats.PatternStats[pattern.stat] = 0
+	}
+	categories, sources := map[string]int{}, map[string]int{}
+	smartCategorized := 0
+	for _, row := range totals {
+		all := row.count + row.rolledUp
+		stats.Total += all
+		stats.RolledUp += row.rolledUp
+		if row.severity != "" {
+			stats.SeverityBreakdown[row.severity] += all
+			if row.severity != "info" {
+				smartCategorized += row.count
+			}
+		}
+		if row.source != "" {
+			sources[row.source] += all
+		}
+		if row.category != "" {
+			categories[row.category] += row.count
+		}
+		for i, pattern := range statsPatterns {
+			stats.PatternStats[pattern.stat] += row.patterns[i]
 		}
-		rows.Close()
-	}
-
-	// Pattern statistics collection
-	stats.PatternStats = map[string]int{
-		"http_codes_detected": 0,
-		"stack_traces_found":  0,
-		"security_issues":     0,
-		"performance_issues":  0,
 	}
 
-	// Query for pattern statistics using temporary variables
-	var httpCodes, stackTraces, securityIssues, performanceIssues int
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE body LIKE '%status%' OR body LIKE '%HTTP%' OR body LIKE '%code%'").Scan(&httpCodes)
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE body LIKE '%.java:%' OR body LIKE '%.py:%' OR body LIKE '%goroutine%' OR body LIKE '%Traceback%'").Scan(&stackTraces)
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE body LIKE '%unauthorized%' OR body LIKE '%forbidden%' OR body LIKE '%breach%' OR body LIKE '%vulnerability%'").Scan(&securityIssues)
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE body LIKE '%ms%' OR body LIKE '%slow%' OR body LIKE '%timeout%' OR body LIKE '%performance%'").Scan(&performanceIssues)
-
-	// Assign to map
-	stats.PatternStats["http_codes_detected"] = httpCodes
-	stats.PatternStats["stack_traces_found"] = stackTraces
-	stats.PatternStats["security_issues"] = securityIssues
-	stats.PatternStats["performance_issues"] = performanceIssues
-
 	// Calculate detection accuracy (percentage of logs with smart categorization)
-	var smartCategorized int
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity IS NOT NULL AND derived_severity != 'info'").Scan(&smartCategorized)
 	if stats.Total > 0 {
 		accuracy := float64(smartCategorized) / float64(stats.Total) * 100
 		stats.DetectionAccuracy = fmt.Sprintf("%.1f%%", accuracy)
@@ -1402,31 +2525,47 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 		stats.DetectionAccuracy = "N/A"
 	}
 
-	// Top log types (top 10)
-	if rows, err := db.Query("SELECT derived_category, COUNT(*) FROM logs WHERE derived_category IS NOT NULL GROUP BY derived_category ORDER BY COUNT(*) DESC LIMIT 10"); err == nil {
-		for rows.Next() {
-			var category string
-			var count int
-			rows.Scan(&category, &count)
-			stats.TopTypes = append(stats.TopTypes, TypeCount{Name: category, Count: count})
-		}
-		rows.Close()
+	// Top log types and sources (top 10)
+	for _, category := range topStatCounts(categories, 10) {
+		stats.TopTypes = append(stats.TopTypes, TypeCount{Name: category, Count: categories[category]})
+	}
+	for _, source := range topStatCounts(sources, 10) {
+		stats.TopSources = append(stats.TopSources, SourceCount{Name: source, Count: sources[source]})
 	}
 
-	// Top sources (top 10)
-	if rows, err := db.Query("SELECT derived_source, COUNT(*) FROM logs WHERE derived_source IS NOT NULL GROUP BY derived_source ORDER BY COUNT(*) DESC LIMIT 10"); err == nil {
-		for rows.Next() {
-			var source string
-			var count int
-			rows.Scan(&source, &count)
-			stats.TopSources = append(stats.TopSources, SourceCount{Name: source, Count: count})
+	// The last 24 hours (the current hour and the 23 before, in UTC) and the 24 before them
+	now := time.Now().UTC()
+	currentHour := now.Truncate(time.Hour)
+	last24h := currentHour.Add(-23 * time.Hour)
+	recent, err := loadHourlyStats(last24h.Add(-24 * time.Hour))
+	if err != nil {
+		http.Error(w, "Failed to load statistics", http.StatusInternalServerError)
+		return
+	}
+	stats.HourlyDistribution = make([]int, 24)
+	var errorCount24h, unknownSourceCount int
+	var current, previous trendCount
+	for _, row := range recent {
+		failed := 0
+		if row.severity == "error" || row.severity == "critical" {
+			failed = row.count
+		}
+		if row.hour.Before(last24h) {
+			previous = trendCount{previous.volume + row.count, previous.errors + failed}
+			continue
+		}
+		current = trendCount{current.volume + row.count, current.errors + failed}
+		stats.Last24Hours += row.count
+		stats.HourlyDistribution[row.hour.Hour()] += row.count
+		if row.severity == "error" {
+			errorCount24h += row.count
+		}
+		if row.source == "unknown" {
+			unknownSourceCount += row.count
 		}
-		rows.Close()
 	}
 
 	// Calculate error rate for last 24 hours
-	var errorCount24h int
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity = 'error' AND timestamp >= ?", last24h).Scan(&errorCount24h)
 	if stats.Last24Hours > 0 {
 		errorRate := float64(errorCount24h) / float64(stats.Last24Hours) * 100
 		stats.ErrorRate24h = fmt.Sprintf("%.1f%%", errorRate)
@@ -1439,27 +2578,6 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 		stats.ErrorRate24h = "0.0%"
 	}
 
-	// Hourly distribution for last 24 hours
-	stats.HourlyDistribution = make([]int, 24)
-	if rows, err := db.Query(`
-		SELECT 
-			strftime('%H', timestamp) as hour, 
-			COUNT(*) 
-		FROM logs 
-		WHERE timestamp >= ? 
-		GROUP BY strftime('%H', timestamp)
-		ORDER BY hour`, last24h); err == nil {
-		for rows.Next() {
-			var hour int
-			var count int
-			rows.Scan(&hour, &count)
-			if hour >= 0 && hour < 24 {
-				stats.HourlyDistribution[hour] = count
-			}
-		}
-		rows.Close()
-	}
-
 	// Find peak hour
 	maxCount := 0
 	peakHour := 0
@@ -1471,25 +2589,14 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 	}
 	stats.PeakHour = fmt.Sprintf("%02d:00", peakHour)
 
-	// Trend analysis
-	var errorCountPrev24h int
-	prev48h := time.Now().AddDate(0, 0, -2)
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_severity = 'error' AND timestamp >= ? AND timestamp < ?", prev48h, last24h).Scan(&errorCountPrev24h)
-
-	stats.Trends["errors_increasing"] = errorCount24h > errorCountPrev24h
-	stats.Trends["error_change"] = errorCount24h - errorCountPrev24h
+	// Trend analysis: the last 24 hours against the 24 hours before (errors as in trends.go)
+	stats.Trends["errors_increasing"] = current.errors > previous.errors
+	stats.Trends["error_change"] = current.errors - previous.errors
+	stats.Trends["volume_change_pct"] = changePercent(float64(current.volume), float64(previous.volume))
 
 	// Detect spikes (current hour vs average)
-	currentHour := time.Now().Hour()
-	currentHourCount := stats.HourlyDistribution[currentHour]
-	avgHourlyCount := 0
-	if len(stats.HourlyDistribution) > 0 {
-		total := 0
-		for _, count := range stats.HourlyDistribution {
-			total += count
-		}
-		avgHourlyCount = total / 24
-	}
+	currentHourCount := stats.HourlyDistribution[now.Hour()]
+	avgHourlyCount := stats.Last24Hours / 24
 
 	if currentHourCount > avgHourlyCount*2 && avgHourlyCount > 0 {
 		stats.Trends["spike_detected"] = true
@@ -1498,23 +2605,45 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 		stats.Trends["spike_detected"] = false
 	}
 
-	// Database file size
-	if info, err := os.Stat("./logs.db"); err == nil {
-		sizeKB := float64(info.Size()) / 1024
+	// Database size as the database reports it (whatever -db is, including :memory:)
+	if size := databaseBytes(); size > 0 {
+		sizeKB := float64(size) / 1024
 		if sizeKB > 1024 {
 			stats.DatabaseSize = fmt.Sprintf("%.1f MB", sizeKB/1024)
 		} else {
 			stats.DatabaseSize = fmt.Sprintf("%.1f KB", sizeKB)
 		}
+		if storeInMemory() {
+			stats.DatabaseSize += " (in memory)"
+		}
+	}
+
+	// Growth forecast and disk runway (see forecast.go)
+	if forecast, err := computeStorageForecast(now); err == nil && forecast != nil {
+		stats.Storage = forecast
+		if forecast.runwayLow() {
+			stats.Alerts = append(stats.Alerts, fmt.Sprintf("Disk full in about %.1f days at the current growth", *forecast.RunwayDays))
+		}
 	}
 
 	// Alert for unknown sources
-	var unknownSourceCount int
-	db.QueryRow("SELECT COUNT(*) FROM logs WHERE derived_source = 'unknown' AND timestamp >= ?", last24h).Scan(&unknownSourceCount)
 	if unknownSourceCount > stats.Last24Hours/4 && stats.Last24Hours > 10 {
 		stats.Alerts = append(stats.Alerts, fmt.Sprintf("%d logs from unknown sources in last 24h", unknownSourceCount))
 	}
 
+	// Alerts fired in the last hour (escalations, ...) and what is muted right now
+	stats.Alerts = append(stats.Alerts, alertBanners()...)
+	stats.Silences = silenceSummaries(time.Now())
+	stats.ErrorGroups = errorGroupSummaries()
+
+	// Corrections of misclassified logs and how often they were learned from
+	stats.Corrections = loadCorrectionStats()
+
+	// Today's ingestion quota usage
+	if quotas != nil {
+		stats.Quotas = quotas.report()
+	}
+
 	json.NewEncoder(w).Encode(stats)
 }
 
@@ -1535,87 +2664,106 @@ func serveWeb(w http.ResponseWriter, r *http.Request) {
 // HTTP HANDLERS - EXPORT FUNCTIONALITY
 // =============================================================================
 
-// handleExportCSV exports logs to CSV format with optional date filtering
+// handleExportCSV exports logs to CSV format with optional date filtering and column selection
 func handleExportCSV(w http.ResponseWriter, r *http.Request) {
+	// Column, delimiter and header options (see csvexport.go)
+	options, err := parseCSVOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, _, err := parseSample(r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attached, err := selectArchives(r.URL.Query().Get("attach"), r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Set CSV response headers
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=cubiclog_export.csv")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	// Build query with date filters
-	query, args := buildExportQuery(r)
-
-	// Execute query
-	rows, err := db.Query(query, args...)
+	// Build query with date filters and execute it
+	rows, release, err := queryArchivedLogs(r.URL.Query().Get("from"), r.URL.Query().Get("to"), attached, func(table string) (string, []interface{}) {
+		return buildExportQuery(r, table, partitionColumns)
+	})
 	if err != nil {
 		log.Printf("Export query error: %v", err)
-		http.Error(w, "Export query failed", http.StatusInternalServerError)
+		writeQueryError(w, err, "Export query failed")
 		return
 	}
-	defer rows.Close()
+	defer release()
 
 	// Setup CSV writer
 	writer := csv.NewWriter(w)
+	writer.Comma = options.Delimiter
 	defer writer.Flush()
 
 	// Write CSV header
-	writer.Write([]string{"ID", "Type", "Title", "Description", "Source", "Color", "Body", "Timestamp"})
+	if options.Header {
+		header := make([]string, len(options.Columns))
+		for i, column := range options.Columns {
+			header[i] = column.Label
+		}
+		writer.Write(header)
+	}
 
 	// Write data rows
 	for rows.Next() {
-		var id int
-		var logType, title string
-		var timestamp time.Time
-		var descNS, sourceNS, colorNS, bodyNS sql.NullString
-
-		rows.Scan(&id, &logType, &title, &descNS, &sourceNS, &colorNS, &bodyNS, &timestamp)
-
-		writer.Write([]string{
-			strconv.Itoa(id),
-			logType,
-			title,
-			descNS.String,
-			sourceNS.String,
-			colorNS.String,
-			bodyNS.String,
-			timestamp.Format(time.RFC3339),
-		})
+		var row exportRow
+		row.scan(rows)
+		writer.Write(row.csvRecord(options.Columns))
 	}
 }
 
-// handleExportJSON exports logs to JSON format with optional date filtering
 func handleExportJSON(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := parseSample(r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attached, err := selectArchives(r.URL.Query().Get("attach"), r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Set JSON response headers
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "attachment; filename=cubiclog_export.json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	// Build query with date filters
-	query, args := buildExportQuery(r)
-
-	// Execute query
-	rows, err := db.Query(query, args...)
+	// Build query with date filters and execute it
+	rows, release, err := queryArchivedLogs(r.URL.Query().Get("from"), r.URL.Query().Get("to"), attached, func(table string) (string, []interface{}) {
+		return buildExportQuery(r, table, exportColumns)
+	})
 	if err != nil {
 		log.Printf("Export query error: %v", err)
-		http.Error(w, "Export query failed", http.StatusInternalServerError)
+		writeQueryError(w, err, "Export query failed")
 		return
 	}
-	defer rows.Close()
+	defer release()
 
 	// Parse results into log structs
 	var logs []Log
 	for rows.Next() {
 		var l Log
 		var bodyJSON string
-		var description, source, color sql.NullString
+		var description, source, color, environment, logRelease sql.NullString
 
 		rows.Scan(&l.ID, &l.Header.Type, &l.Header.Title,
-			&description, &source, &color, &bodyJSON, &l.Timestamp)
+			&description, &source, &color, &bodyJSON, (*scanTime)(&l.Timestamp), &environment, &logRelease)
 
-		l.Header.Description = description.String
+		l.Header.Description = openField(description.String)
 		l.Header.Source = source.String
 		l.Header.Color = color.String
+		l.Header.Environment = environment.String
+		l.Header.Release = logRelease.String
 
+		bodyJSON = openField(bodyJSON)
 		if bodyJSON != "" {
 			json.Unmarshal([]byte(bodyJSON), &l.Body)
 		}
@@ -1635,27 +2783,53 @@ func handleExportJSON(w http.ResponseWriter, r *http.Request) {
 // UTILITY FUNCTIONS
 // =============================================================================
 
+// exportColumns are the columns the JSON export reads
+const exportColumns = "id, type, title, description, source, color, body, timestamp, environment, release"
+
 // buildExportQuery constructs a SQL query for export operations with date filtering
-func buildExportQuery(r *http.Request) (string, []interface{}) {
-	query := "SELECT id, type, title, description, source, color, body, timestamp FROM logs"
+func buildExportQuery(r *http.Request, table, columns string) (string, []interface{}) {
+	query := "SELECT " + columns + " FROM " + table
 	var args []interface{}
 
 	from := r.URL.Query().Get("from")
 	to := r.URL.Query().Get("to")
+	environment, _ := normalizeEnvironment(r.URL.Query().Get("environment"))
+	release := strings.TrimSpace(r.URL.Query().Get("release"))
+	lowestStatus, highestStatus, _ := parseHTTPStatusFilter(r.URL.Query().Get("http_status"))
+	filtered := from != "" || to != "" || environment != "" || release != "" || lowestStatus != 0
 
-	if from != "" || to != "" {
-		query += " WHERE"
+	if filtered {
+		query += " WHERE 1=1"
 		if from != "" {
-			query += " timestamp >= ?"
+			query += " AND timestamp >= ?"
 			args = append(args, from)
 		}
 		if to != "" {
-			if from != "" {
-				query += " AND"
-			}
-			query += " timestamp <= ?"
+			query += " AND timestamp <= ?"
 			args = append(args, to)
 		}
+		if environment != "" {
+			query += " AND environment = ?"
+			args = append(args, environment)
+		}
+		if release != "" {
+			query += " AND release = ?"
+			args = append(args, release)
+		}
+		if lowestStatus != 0 {
+			query += " AND derived_http_status BETWEEN ? AND ?"
+			args = append(args, lowestStatus, highestStatus)
+		}
+	}
+
+	// Add the sample filter (validated by the handlers, see sample.go)
+	rate, seed, _ := parseSample(r.URL.Query())
+	if condition, sampleArgs := sampleFilter(rate, seed); condition != "" {
+		if !filtered {
+			query += " WHERE 1=1"
+		}
+		query += condition
+		args = append(args, sampleArgs...)
 	}
 
 	query += " ORDER BY timestamp DESC"
@@ -1682,16 +2856,6 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// getEnvInt gets environment variable as integer with fallback to default value
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
-		}
-	}
-	return defaultValue
-}
-
 // =============================================================================
 // SERVICE MANAGEMENT FUNCTIONS
 // =============================================================================
@@ -31,7 +31,6 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -50,7 +49,7 @@ import (
 func setupTestDB(t *testing.T) func() {
 	var err error
 	originalDB := db
-	db, err = sql.Open("sqlite3", ":memory:")
+	db, err = openStore("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
 	}
@@ -61,6 +60,7 @@ func setupTestDB(t *testing.T) func() {
 
 	// Return cleanup function
 	return func() {
+		pendingDeliveries.Wait()
 		db.Close()
 		db = originalDB
 	}
@@ -911,6 +911,35 @@ func TestSmartDefaults(t *testing.T) {
 	}
 }
 
+// TestClientSeverity tests that a client-provided severity is stored instead of a derived one
+func TestClientSeverity(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	body := `{"severity": "Success", "header": {"title": "Failed login attempts report completed successfully"}}`
+	w := httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create log: %d %s", w.Code, w.Body.String())
+	}
+	var response Log
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Severity != "success" || response.Header.Type != "success" || response.Header.Color != severityColors["success"] {
+		t.Errorf("Expected the success severity, type and color, got %q %q %q", response.Severity, response.Header.Type, response.Header.Color)
+	}
+	var severity string
+	db.QueryRow("SELECT derived_severity FROM logs WHERE id = ?", response.ID).Scan(&severity)
+	if severity != "success" {
+		t.Errorf("Expected the derived severity 'success', got '%s'", severity)
+	}
+
+	w = httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"severity": "loud", "header": {"title": "Hello"}}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid severity") {
+		t.Errorf("Expected an unknown severity to be refused, got %d %s", w.Code, w.Body.String())
+	}
+}
+
 // =============================================================================
 // UTILITY FUNCTIONS
 // =============================================================================
@@ -0,0 +1,61 @@
+// CubicLog Manual Entries - Deploy notes, incident notes and handoffs from the dashboard
+//
+// The dashboard's "New entry" form posts a regular log to POST /api/logs
+// (with the dashboard's API key when authentication is on):
+//
+//	{"header": {"type": "annotation", "title": "Deployed checkout v2.4.1", "source": "checkout"},
+//	 "body": {"annotation": "deploy", "author": "alice"}}
+//
+// Logs of type "annotation" are written by people, not services, so their
+// text is not pattern matched: "Incident: checkout failing" must not count as
+// an error, feed error rates or escalate. They are stored as info in the
+// "annotation" category (violet, from source "manual" unless the entry names
+// one) and show up on the log timeline as annotations.
+package main
+
+import "strings"
+
+// annotationType is the log type of manual entries
+const annotationType = "annotation"
+
+// annotationKinds are the kinds of manual entries the dashboard offers
+var annotationKinds = []string{"note", "deploy", "incident", "handoff"}
+
+// isAnnotation reports whether a log is a manual entry
+func isAnnotation(header LogHeader) bool {
+	return strings.EqualFold(header.Type, annotationType)
+}
+
+// Color and source of manual entries that don't pick one
+const (
+	annotationColor  = "violet"
+	annotationSource = "manual"
+)
+
+// normalizeAnnotation spells the type of a manual entry and its kind in the body
+// the way the dashboard expects them ("note" for missing or unknown kinds)
+func normalizeAnnotation(entry *Log) {
+	entry.Header.Type = annotationType
+	if entry.Header.Color == "" {
+		entry.Header.Color = annotationColor
+	}
+	if entry.Header.Source == "" {
+		entry.Header.Source = annotationSource
+	}
+	if entry.Body == nil {
+		entry.Body = map[string]interface{}{}
+	}
+	kind, _ := entry.Body["annotation"].(string)
+	kind = strings.ToLower(kind)
+	if !containsString(annotationKinds, kind) {
+		kind = "note"
+	}
+	entry.Body["annotation"] = kind
+}
+
+// annotationMetadata is the derived metadata of a manual entry
+func annotationMetadata(metadata LogMetadata) LogMetadata {
+	metadata.DerivedSeverity = "info"
+	metadata.DerivedCategory = annotationType
+	return metadata
+}
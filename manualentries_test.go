@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestManualEntry tests that manual entries are stored as annotations without pattern matching
+func TestManualEntry(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(
+		`{"header":{"type":"Annotation","title":"Incident: checkout failed with 500 errors"},"body":{"annotation":"INCIDENT","author":"alice"}}`)))
+	var created Log
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != 201 || created.Header.Type != "annotation" || created.Header.Color != "violet" || created.Body["annotation"] != "incident" {
+		t.Fatalf("Expected an incident annotation, got %d %+v", w.Code, created)
+	}
+
+	var severity, source, category string
+	db.QueryRow("SELECT derived_severity, derived_source, derived_category FROM logs WHERE id = ?", created.ID).Scan(&severity, &source, &category)
+	if severity != "info" || source != "manual" || category != "annotation" {
+		t.Errorf("Expected an info annotation from the manual source, got %s %s %s", severity, source, category)
+	}
+
+	w = httptest.NewRecorder()
+	createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(
+		`{"header":{"type":"annotation","title":"Handing over to Bob","source":"checkout"},"body":{"annotation":"shift"}}`)))
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Header.Source != "checkout" || created.Body["annotation"] != "note" {
+		t.Errorf("Expected an unknown kind stored as a note for checkout, got %+v", created)
+	}
+}
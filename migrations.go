@@ -0,0 +1,288 @@
+// CubicLog Migrations - Versioned schema changes
+//
+// Changes to existing tables live in migrations/ as numbered SQL files:
+//
+//	migrations/0001_derived_metadata.up.sql     applied in version order
+//	migrations/0001_derived_metadata.down.sql   reverts it (optional)
+//
+// Applied versions are recorded in schema_migrations, and pending migrations
+// run at startup, each in its own transaction, so a failing one stops
+// CubicLog instead of leaving a half-changed schema behind. A database
+// written by a newer CubicLog (with versions this binary doesn't know) is
+// refused. The migration SQL must work on both SQLite and PostgreSQL.
+//
+//	cubiclog -migrate status   list migrations and whether they are applied
+//	cubiclog -migrate up       apply the pending migrations and exit
+//	cubiclog -migrate down     revert the latest applied migration and exit
+//
+// New tables are still created with CREATE TABLE IF NOT EXISTS by their
+// feature; anything altering a table that already shipped gets a migration.
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one numbered schema change
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty when the migration can't be reverted
+}
+
+// legacyMigrations detect changes that databases created before migrations
+// existed already have (they were applied with ALTER TABLE, ignoring errors),
+// so those migrations are recorded instead of run again
+var legacyMigrations = map[int]func() bool{
+	1: func() bool { return columnExists("logs", "derived_severity") },
+	2: func() bool { return columnExists("alerts", "silenced_by") },
+}
+
+// loadMigrations reads the embedded migration files in version order
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		// 0001_name.up.sql or 0001_name.down.sql
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		direction := path.Ext(base)
+		prefix, name, found := strings.Cut(strings.TrimSuffix(base, direction), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("migration file %s is not named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == ".up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no .up.sql file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// createMigrationsTable creates the table recording applied migrations
+func createMigrationsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// appliedMigrations returns when each applied version was applied
+func appliedMigrations() (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, (*scanTime)(&appliedAt)); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// columnExists reports whether a table has a column
+func columnExists(table, column string) bool {
+	rows, err := db.Query("SELECT " + column + " FROM " + table + " WHERE 1 = 0")
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// runMigration executes a migration's SQL and records or forgets its version
+// in one transaction
+func runMigration(m migration, statements string, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(statements) != "" {
+		if _, err := tx.Exec(statements); err != nil {
+			return fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+	}
+	if up {
+		_, err = tx.Exec(db.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"), m.Version, m.Name, dbTime(time.Now()))
+	} else {
+		_, err = tx.Exec(db.Rebind("DELETE FROM schema_migrations WHERE version = ?"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateUp applies the pending migrations and returns them
+func migrateUp() ([]migration, error) {
+	if err := createMigrationsTable(); err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(migrations, applied); err != nil {
+		return nil, err
+	}
+
+	// Databases without recorded migrations may predate them
+	legacy := len(applied) == 0
+	var ran []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		statements := m.Up
+		if detect, ok := legacyMigrations[m.Version]; ok && legacy && detect() {
+			statements = ""
+		}
+		if err := runMigration(m, statements, true); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// migrateDown reverts the latest applied migration
+func migrateDown() (migration, error) {
+	if err := createMigrationsTable(); err != nil {
+		return migration{}, err
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return migration{}, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return migration{}, err
+	}
+	if err := checkSchemaVersion(migrations, applied); err != nil {
+		return migration{}, err
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return m, fmt.Errorf("migration %d (%s) can't be reverted", m.Version, m.Name)
+		}
+		return m, runMigration(m, m.Down, false)
+	}
+	return migration{}, fmt.Errorf("no applied migrations to revert")
+}
+
+// checkSchemaVersion refuses databases migrated by a newer CubicLog
+func checkSchemaVersion(migrations []migration, applied map[int]time.Time) error {
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("the database has schema migration %d, which this CubicLog v%s doesn't know: upgrade CubicLog, or revert it with -migrate down using the newer version", version, VERSION)
+		}
+	}
+	return nil
+}
+
+// handleMigrate runs the -migrate command
+func handleMigrate(command string) {
+	switch command {
+	case "status":
+		if err := createMigrationsTable(); err != nil {
+			fmt.Printf("❌ Migration status failed: %v\n", err)
+			os.Exit(1)
+		}
+		migrations, err := loadMigrations()
+		if err == nil {
+			var applied map[int]time.Time
+			if applied, err = appliedMigrations(); err == nil {
+				fmt.Printf("🗃️  Schema migrations:\n")
+				for _, m := range migrations {
+					if at, ok := applied[m.Version]; ok {
+						fmt.Printf("   ✅ %04d %s (applied %s)\n", m.Version, m.Name, at.Format("2006-01-02 15:04:05"))
+					} else {
+						fmt.Printf("   ⏳ %04d %s (pending)\n", m.Version, m.Name)
+					}
+				}
+				err = checkSchemaVersion(migrations, applied)
+			}
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+	case "up":
+		// createTable creates missing tables, then applies the pending migrations
+		if err := createTable(); err != nil {
+			fmt.Printf("❌ Migration failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Schema is up to date\n")
+	case "down":
+		m, err := migrateDown()
+		if err != nil {
+			fmt.Printf("❌ Revert failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Reverted %04d %s\n", m.Version, m.Name)
+	default:
+		fmt.Printf("❌ -migrate must be status, up or down\n")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_logs_derived_category;
+DROP INDEX IF EXISTS idx_logs_derived_source;
+DROP INDEX IF EXISTS idx_logs_derived_severity;
+
+ALTER TABLE logs DROP COLUMN derived_category;
+ALTER TABLE logs DROP COLUMN derived_source;
+ALTER TABLE logs DROP COLUMN derived_severity;
@@ -0,0 +1,8 @@
+-- Derived metadata for the smart analytics (filled by deriveMetadata on insert)
+ALTER TABLE logs ADD COLUMN derived_severity TEXT;
+ALTER TABLE logs ADD COLUMN derived_source TEXT;
+ALTER TABLE logs ADD COLUMN derived_category TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_logs_derived_severity ON logs(derived_severity);
+CREATE INDEX IF NOT EXISTS idx_logs_derived_source ON logs(derived_source);
+CREATE INDEX IF NOT EXISTS idx_logs_derived_category ON logs(derived_category);
@@ -0,0 +1,2 @@
+-- The silence that muted an alert (see silences.go)
+ALTER TABLE alerts ADD COLUMN silenced_by TEXT;
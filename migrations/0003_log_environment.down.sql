@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_logs_environment;
+
+ALTER TABLE api_keys DROP COLUMN environment;
+ALTER TABLE logs DROP COLUMN environment;
@@ -0,0 +1,6 @@
+-- The environment a log came from (see environment.go), and the one a managed
+-- API key stamps on the logs it sends
+ALTER TABLE logs ADD COLUMN environment TEXT;
+ALTER TABLE api_keys ADD COLUMN environment TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_logs_environment ON logs(environment);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_logs_derived_language;
+
+ALTER TABLE logs DROP COLUMN derived_language;
@@ -0,0 +1,4 @@
+-- The language a log's stack trace or content was written in (see language.go)
+ALTER TABLE logs ADD COLUMN derived_language TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_logs_derived_language ON logs(derived_language);
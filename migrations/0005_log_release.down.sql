@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_logs_release;
+
+ALTER TABLE error_groups DROP COLUMN first_release;
+ALTER TABLE logs DROP COLUMN release;
@@ -0,0 +1,6 @@
+-- The release a log was sent from, and the release an error group was first
+-- seen in (see releases.go)
+ALTER TABLE logs ADD COLUMN release TEXT;
+ALTER TABLE error_groups ADD COLUMN first_release TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_logs_release ON logs(release);
@@ -0,0 +1,5 @@
+-- The duration in milliseconds extracted from a log's text ("took 350ms"), so
+-- duration filters, sorting and percentiles read a column (see latency.go)
+ALTER TABLE logs ADD COLUMN derived_duration_ms INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_logs_derived_duration_ms ON logs(derived_duration_ms);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_logs_derived_http_status;
+
+ALTER TABLE logs DROP COLUMN derived_http_status;
@@ -0,0 +1,5 @@
+-- The HTTP status code a log's severity was derived from ("status 503"), so
+-- logs filter by code or class (see httpstatus.go)
+ALTER TABLE logs ADD COLUMN derived_http_status INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_logs_derived_http_status ON logs(derived_http_status);
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMigrations tests applying, reverting and adopting schema migrations
+func TestMigrations(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	applied, err := appliedMigrations()
+	if err != nil || len(applied) != 7 || !columnExists("logs", "derived_severity") || !columnExists("alerts", "silenced_by") || !columnExists("logs", "environment") || !columnExists("logs", "derived_language") || !columnExists("logs", "release") || !columnExists("logs", "derived_duration_ms") || !columnExists("logs", "derived_http_status") {
+		t.Fatalf("Expected all migrations applied to a new database, got %v (%v)", applied, err)
+	}
+
+	// Down reverts the latest migration only, up applies it again
+	if m, err := migrateDown(); err != nil || m.Version != 7 {
+		t.Fatalf("Expected migration 7 reverted, got %d (%v)", m.Version, err)
+	}
+	if columnExists("logs", "derived_http_status") || !columnExists("logs", "derived_duration_ms") {
+		t.Errorf("Expected only the derived_http_status column dropped")
+	}
+	if ran, err := migrateUp(); err != nil || len(ran) != 1 || ran[0].Name != "derived_http_status" {
+		t.Errorf("Expected migration 7 applied again, got %v (%v)", ran, err)
+	}
+
+	// A database migrated by a newer version is refused
+	db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', '2030-01-01 00:00:00')")
+	if _, err := migrateUp(); err == nil || !strings.Contains(err.Error(), "999") {
+		t.Errorf("Expected an error for an unknown schema version, got %v", err)
+	}
+	db.Exec("DELETE FROM schema_migrations WHERE version = 999")
+
+	// Databases from before migrations already have the columns of the first two
+	migrateDown()
+	migrateDown()
+	migrateDown()
+	migrateDown()
+	migrateDown()
+	db.Exec("DROP TABLE schema_migrations")
+	if err := createTable(); err != nil {
+		t.Fatalf("Expected a pre-migration database to be adopted, got %v", err)
+	}
+	if applied, _ := appliedMigrations(); len(applied) != 7 || !columnExists("logs", "environment") || !columnExists("logs", "derived_language") || !columnExists("logs", "release") || !columnExists("logs", "derived_duration_ms") || !columnExists("logs", "derived_http_status") {
+		t.Errorf("Expected the legacy migrations recorded and the later columns added, got %v", applied)
+	}
+}
@@ -0,0 +1,83 @@
+// CubicLog New Errors - Brand new errors stand out from the known noise
+//
+//	cubiclog -alert-new-errors
+//	GET /api/groups?new=24h    error groups first seen in the last 24 hours, newest first
+//
+// Error groups (see groups.go) remember every fingerprint ever seen, and
+// outlive retention. A log that starts a new group is a new type of error,
+// which after a deploy usually matters more than the errors everybody already
+// knows: it is logged with 🆕, and with -alert-new-errors an alert fires (kind
+// new_error, see alerts.go) naming the source, the release the error first
+// appeared in and a link to the log.
+//
+// At most 20 new-error alerts fire per hour, so a fresh database or a deploy
+// breaking everything doesn't flood the webhook; the rest are still logged and
+// listed by GET /api/groups?new=.
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// newErrorAlertLimit is the most new-error alerts fired per hour
+const newErrorAlertLimit = 20
+
+// newErrorAlerts is the -alert-new-errors setting - configured once in main()
+var newErrorAlerts bool
+
+// newErrorAlertBudget counts the new-error alerts of the current hour
+var newErrorAlertBudget struct {
+	sync.Mutex
+	hour  time.Time
+	fired int
+}
+
+// announceNewErrorGroup reports a group that was just seen for the first time
+func announceNewErrorGroup(group ErrorGroup) {
+	log.Printf("🆕 New error in %s: %s", group.Source, group.Title)
+	if !newErrorAlerts || !takeNewErrorAlert(time.Now()) {
+		return
+	}
+
+	message := fmt.Sprintf("First seen: %s", group.Title)
+	if group.FirstRelease != "" {
+		message += " (release " + group.FirstRelease + ")"
+	}
+	alert := Alert{
+		Rule:     "new-error",
+		Kind:     "new_error",
+		Source:   group.Source,
+		Severity: group.Severity,
+		Title:    "New error in " + group.Source,
+		Message:  message,
+		Count:    1,
+	}
+	if group.LastLogID > 0 {
+		alert.LogIDs = []int64{group.LastLogID}
+		if link := dashboardLink(fmt.Sprintf("/logs/%d", group.LastLogID)); link != "" {
+			alert.Message += " - " + link
+		}
+	}
+	fireAlert(alert)
+}
+
+// takeNewErrorAlert reports whether another new-error alert may fire this hour
+func takeNewErrorAlert(now time.Time) bool {
+	newErrorAlertBudget.Lock()
+	defer newErrorAlertBudget.Unlock()
+	if hour := now.Truncate(time.Hour); !hour.Equal(newErrorAlertBudget.hour) {
+		newErrorAlertBudget.hour, newErrorAlertBudget.fired = hour, 0
+	}
+	if newErrorAlertBudget.fired >= newErrorAlertLimit {
+		if newErrorAlertBudget.fired == newErrorAlertLimit {
+			log.Printf("⚠️  More than %d new errors this hour, no further new-error alerts until the next one", newErrorAlertLimit)
+		}
+		newErrorAlertBudget.fired++
+		return false
+	}
+	newErrorAlertBudget.fired++
+	return true
+}
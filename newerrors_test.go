@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewErrorAlerts tests announcing error groups seen for the first time
+func TestNewErrorAlerts(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	newErrorAlerts = true
+	defer func() { newErrorAlerts = false }()
+
+	for _, body := range []string{
+		`{"header":{"type":"error","title":"Order 4711 failed","source":"payments","release":"v2.1.0"}}`,
+		`{"header":{"type":"error","title":"Order 4712 failed","source":"payments","release":"v2.1.0"}}`,
+		`{"header":{"type":"info","title":"Order 1 shipped","source":"payments"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	alerts, err := recentAlerts(time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatalf("Failed to load alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != "new_error" || alerts[0].Source != "payments" || len(alerts[0].LogIDs) != 1 {
+		t.Fatalf("Expected one new-error alert for the first order failure, got %+v", alerts)
+	}
+	if !strings.Contains(alerts[0].Message, "Order 4711 failed") || !strings.Contains(alerts[0].Message, "v2.1.0") {
+		t.Errorf("Expected the title and release in the message, got %q", alerts[0].Message)
+	}
+
+	w := httptest.NewRecorder()
+	handleErrorGroups(w, httptest.NewRequest("GET", "/api/groups?new=24h", nil))
+	var listed struct {
+		Groups []ErrorGroup `json:"groups"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Groups) != 1 || listed.Groups[0].Count != 2 {
+		t.Errorf("Expected the new group counted twice, got %+v", listed.Groups)
+	}
+	w = httptest.NewRecorder()
+	handleErrorGroups(w, httptest.NewRequest("GET", "/api/groups?new=yesterday", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected 400 for an invalid duration, got %d", w.Code)
+	}
+
+	// Past the hourly budget new errors are only logged
+	newErrorAlertBudget.Lock()
+	newErrorAlertBudget.hour, newErrorAlertBudget.fired = time.Now().Truncate(time.Hour), newErrorAlertLimit
+	newErrorAlertBudget.Unlock()
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs",
+		strings.NewReader(`{"header":{"type":"error","title":"Checkout crashed","source":"payments"}}`)))
+	if alerts, _ := recentAlerts(time.Now().Add(-time.Hour), 10); len(alerts) != 1 {
+		t.Errorf("Expected no alert past the budget, got %d alerts", len(alerts))
+	}
+	if !takeNewErrorAlert(time.Now().Add(time.Hour)) {
+		t.Error("Expected the budget to reset in the next hour")
+	}
+}
@@ -0,0 +1,266 @@
+// CubicLog Notification Center - What is firing, what is muted, what resolved
+//
+//   - GET  /api/alerts/active     firing alerts, active silences and the alerts resolved in the last 24 hours
+//   - POST /api/alerts/{id}/ack   acknowledge a firing alert: {"by": "alice"} (optional)
+//   - GET  /api/alerts/ws         the same snapshot, pushed over a WebSocket whenever it changes
+//
+// An alert is firing for an hour after it fired, like the dashboard banner
+// (see alerts.go), unless a silence muted it or someone acknowledged it.
+// Acknowledged alerts resolve right away ("resolution": "acknowledged"), the
+// others an hour after they fired ("expired"). Acknowledgements are kept
+// beside the alert history in alert_acks.
+//
+// The socket sends the snapshot on connect, when an alert fires or is
+// acknowledged, when a silence is created or removed, and every minute so
+// alerts age out. Browsers can't set an Authorization header on a WebSocket,
+// so the socket also accepts the API key as a "bearer.<key>" subprotocol next
+// to "cubiclog"; the dashboard falls back to polling /api/alerts/active when
+// the socket is unavailable.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long an alert fires, and how long it is listed once resolved
+const (
+	firingAlertWindow   = time.Hour
+	resolvedAlertWindow = 24 * time.Hour
+	maxResolvedAlerts   = 20
+)
+
+// alertSocketRefresh is how often the socket resends the snapshot without a change
+const alertSocketRefresh = time.Minute
+
+// resolvedAlert is an alert that stopped firing
+type resolvedAlert struct {
+	Alert
+	Resolution     string    `json:"resolution"` // acknowledged or expired
+	ResolvedAt     time.Time `json:"resolved_at"`
+	AcknowledgedBy string    `json:"acknowledged_by,omitempty"`
+}
+
+// alertSnapshot is what the notification center shows
+type alertSnapshot struct {
+	Firing   []Alert          `json:"firing"`
+	Silences []silenceSummary `json:"silences"`
+	Resolved []resolvedAlert  `json:"resolved"`
+}
+
+// alertAck is the acknowledgement of an alert
+type alertAck struct {
+	By string    `json:"acknowledged_by,omitempty"`
+	At time.Time `json:"acknowledged_at"`
+}
+
+// alertWatchers are the open notification sockets, woken on changes
+var alertWatchers = struct {
+	sync.Mutex
+	channels map[chan struct{}]bool
+}{channels: map[chan struct{}]bool{}}
+
+// createAlertAcksTable creates the alert acknowledgement table
+func createAlertAcksTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS alert_acks (
+		alert_id        BIGINT PRIMARY KEY,
+		acknowledged_by TEXT NOT NULL DEFAULT '',
+		acknowledged_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// notifyAlertWatchers wakes the open sockets to send a new snapshot
+func notifyAlertWatchers() {
+	alertWatchers.Lock()
+	defer alertWatchers.Unlock()
+	for changed := range alertWatchers.channels {
+		select {
+		case changed <- struct{}{}:
+		default: // a snapshot is already pending
+		}
+	}
+}
+
+// loadAlertAcks returns the acknowledgements made since a point in time, by alert
+func loadAlertAcks(since time.Time) (map[int64]alertAck, error) {
+	rows, err := db.Query(db.Rebind("SELECT alert_id, acknowledged_by, acknowledged_at FROM alert_acks WHERE acknowledged_at >= ?"), dbTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	acks := map[int64]alertAck{}
+	for rows.Next() {
+		var id int64
+		var ack alertAck
+		if err := rows.Scan(&id, &ack.By, (*scanTime)(&ack.At)); err != nil {
+			return nil, err
+		}
+		acks[id] = ack
+	}
+	return acks, rows.Err()
+}
+
+// loadAlertSnapshot sorts the alerts of the last 24 hours into firing and resolved
+func loadAlertSnapshot(now time.Time) (alertSnapshot, error) {
+	snapshot := alertSnapshot{Firing: []Alert{}, Resolved: []resolvedAlert{}}
+	alerts, err := recentAlerts(now.Add(-resolvedAlertWindow), 1000)
+	if err != nil {
+		return snapshot, err
+	}
+	acks, err := loadAlertAcks(now.Add(-resolvedAlertWindow))
+	if err != nil {
+		return snapshot, err
+	}
+	for _, alert := range alerts {
+		if alert.SilencedBy != "" {
+			continue
+		}
+		ack, acknowledged := acks[alert.ID]
+		switch {
+		case acknowledged:
+			snapshot.Resolved = append(snapshot.Resolved, resolvedAlert{Alert: alert, Resolution: "acknowledged", ResolvedAt: ack.At, AcknowledgedBy: ack.By})
+		case now.Sub(alert.FiredAt) < firingAlertWindow:
+			snapshot.Firing = append(snapshot.Firing, alert)
+		default:
+			snapshot.Resolved = append(snapshot.Resolved, resolvedAlert{Alert: alert, Resolution: "expired", ResolvedAt: alert.FiredAt.Add(firingAlertWindow)})
+		}
+	}
+	sort.SliceStable(snapshot.Resolved, func(i, j int) bool { return snapshot.Resolved[i].ResolvedAt.After(snapshot.Resolved[j].ResolvedAt) })
+	if len(snapshot.Resolved) > maxResolvedAlerts {
+		snapshot.Resolved = snapshot.Resolved[:maxResolvedAlerts]
+	}
+	snapshot.Silences = silenceSummaries(now)
+	return snapshot, nil
+}
+
+// handleActiveAlerts answers GET /api/alerts/active
+func handleActiveAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot, err := loadAlertSnapshot(time.Now())
+	if err != nil {
+		http.Error(w, "Failed to load alerts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// handleAlertAck answers POST /api/alerts/{id}/ack
+func handleAlertAck(w http.ResponseWriter, r *http.Request) {
+	rest, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), "/ack")
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if !found || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request struct {
+		By string `json:"by"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if request.By = strings.TrimSpace(request.By); len(request.By) > 100 {
+		http.Error(w, "by must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	if err := db.QueryRow(db.Rebind("SELECT 1 FROM alerts WHERE id = ?"), id).Scan(&exists); err == sql.ErrNoRows {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to load alert", http.StatusInternalServerError)
+		return
+	}
+
+	// Acknowledging twice keeps the first acknowledgement
+	var ack alertAck
+	err = db.QueryRow(db.Rebind("SELECT acknowledged_by, acknowledged_at FROM alert_acks WHERE alert_id = ?"), id).Scan(&ack.By, (*scanTime)(&ack.At))
+	if err == sql.ErrNoRows {
+		ack = alertAck{By: request.By, At: time.Now().UTC().Truncate(time.Second)}
+		_, err = db.Exec(db.Rebind("INSERT INTO alert_acks (alert_id, acknowledged_by, acknowledged_at) VALUES (?, ?, ?)"), id, ack.By, dbTime(ack.At))
+		notifyAlertWatchers()
+	}
+	if err != nil {
+		http.Error(w, "Failed to acknowledge alert", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "acknowledged_by": ack.By, "acknowledged_at": ack.At})
+}
+
+// socketAuthMiddleware authenticates WebSocket requests that carry the API
+// key as a "bearer.<key>" subprotocol
+func socketAuthMiddleware(apiKey string, handler http.HandlerFunc) http.HandlerFunc {
+	authenticated := authMiddleware(apiKey, handler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			for _, protocol := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+				if key, ok := strings.CutPrefix(strings.TrimSpace(protocol), "bearer."); ok {
+					r.Header.Set("Authorization", "Bearer "+key)
+				}
+			}
+		}
+		authenticated(w, r)
+	}
+}
+
+// handleAlertSocket answers GET /api/alerts/ws, pushing snapshots until the client leaves
+func handleAlertSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r, "cubiclog")
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	changed := make(chan struct{}, 1)
+	alertWatchers.Lock()
+	alertWatchers.channels[changed] = true
+	alertWatchers.Unlock()
+	defer func() {
+		alertWatchers.Lock()
+		delete(alertWatchers.channels, changed)
+		alertWatchers.Unlock()
+	}()
+
+	gone := make(chan struct{})
+	go func() {
+		conn.readFrames()
+		close(gone)
+	}()
+	refresh := time.NewTicker(alertSocketRefresh)
+	defer refresh.Stop()
+	for {
+		if snapshot, err := loadAlertSnapshot(time.Now()); err == nil {
+			message, _ := json.Marshal(snapshot)
+			if conn.WriteText(message) != nil {
+				return
+			}
+		}
+		select {
+		case <-gone:
+			return
+		case <-changed:
+		case <-refresh.C:
+		}
+	}
+}
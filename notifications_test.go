@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNotificationCenter tests the alert snapshot, acknowledgements and the push socket
+func TestNotificationCenter(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	firing := fireAlert(Alert{Rule: "warning-flood", Kind: "escalation", Source: "payments", Severity: "critical", Title: "Payments flood", Message: "40 warnings in 5m", FiredAt: now.Add(-10 * time.Minute)})
+	fireAlert(Alert{Rule: "warning-flood", Kind: "escalation", Source: "search", Severity: "critical", Title: "Search flood", Message: "25 warnings in 5m", FiredAt: now.Add(-3 * time.Hour)})
+	fireAlert(Alert{Rule: "warning-flood", Kind: "escalation", Severity: "critical", Title: "Old flood", Message: "ages ago", FiredAt: now.Add(-48 * time.Hour)})
+
+	snapshot := func() alertSnapshot {
+		w := httptest.NewRecorder()
+		handleActiveAlerts(w, httptest.NewRequest("GET", "/api/alerts/active", nil))
+		var snapshot alertSnapshot
+		json.Unmarshal(w.Body.Bytes(), &snapshot)
+		return snapshot
+	}
+	current := snapshot()
+	if len(current.Firing) != 1 || current.Firing[0].Title != "Payments flood" {
+		t.Fatalf("Expected the payments alert firing, got %+v", current.Firing)
+	}
+	if len(current.Resolved) != 1 || current.Resolved[0].Title != "Search flood" || current.Resolved[0].Resolution != "expired" {
+		t.Errorf("Expected the search alert expired and the 2-day-old one left out, got %+v", current.Resolved)
+	}
+
+	// Acknowledging resolves the alert; a second acknowledgement keeps the first
+	ack := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleAlertAck(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+	path := "/api/alerts/" + strconv.FormatInt(firing.ID, 10) + "/ack"
+	if w := ack(path, `{"by":"alice"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the alert acknowledged, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ack(path, `{"by":"bob"}`); !strings.Contains(w.Body.String(), `"acknowledged_by":"alice"`) {
+		t.Errorf("Expected the first acknowledgement kept, got %s", w.Body.String())
+	}
+	current = snapshot()
+	if len(current.Firing) != 0 || len(current.Resolved) != 2 || current.Resolved[0].AcknowledgedBy != "alice" || current.Resolved[0].Resolution != "acknowledged" {
+		t.Errorf("Expected the payments alert resolved by alice, got %+v / %+v", current.Firing, current.Resolved)
+	}
+	if w := ack("/api/alerts/999/ack", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown alert, got %d", w.Code)
+	}
+
+	// The socket sends the snapshot on connect and again when an alert fires
+	server := httptest.NewServer(socketAuthMiddleware("server-key", handleAlertSocket))
+	defer server.Close()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /api/alerts/ws HTTP/1.1\r\nHost: cubiclog\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: cubiclog, bearer.server-key\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil || response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" || response.Header.Get("Sec-WebSocket-Protocol") != "cubiclog" {
+		t.Fatalf("Expected a WebSocket handshake, got %v (%v)", response, err)
+	}
+	readSnapshot := func() alertSnapshot {
+		head := make([]byte, 2)
+		io.ReadFull(reader, head)
+		length := int(head[1])
+		if length == 126 {
+			extended := make([]byte, 2)
+			io.ReadFull(reader, extended)
+			length = int(extended[0])<<8 | int(extended[1])
+		}
+		payload := make([]byte, length)
+		io.ReadFull(reader, payload)
+		var snapshot alertSnapshot
+		if head[0] != 0x81 || json.Unmarshal(payload, &snapshot) != nil {
+			t.Fatalf("Expected a text frame with a snapshot, got %x %s", head, payload)
+		}
+		return snapshot
+	}
+	if pushed := readSnapshot(); len(pushed.Firing) != 0 || len(pushed.Resolved) != 2 {
+		t.Errorf("Expected the current snapshot on connect, got %+v", pushed)
+	}
+	fireAlert(Alert{Rule: "slo", Kind: "slo", Source: "checkout", Severity: "error", Title: "Checkout budget burning", Message: "2% left"})
+	if pushed := readSnapshot(); len(pushed.Firing) != 1 || pushed.Firing[0].Title != "Checkout budget burning" {
+		t.Errorf("Expected the new alert pushed, got %+v", pushed.Firing)
+	}
+
+	// Without the key the upgrade is refused
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/alerts/ws", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "cubiclog, bearer.wrong")
+	socketAuthMiddleware("server-key", handleAlertSocket)(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong key, got %d", w.Code)
+	}
+}
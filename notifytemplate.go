@@ -0,0 +1,166 @@
+// CubicLog Notification Templates - Shape alert messages like your incidents
+//
+// By default an alert webhook receives the alert as JSON. With -alert-template
+// the body is rendered from a Go text/template file instead, e.g. for Slack:
+//
+//	{"text": {{json (printf "🚨 *%s* - %s\n<%s|Open in CubicLog>" .Title .Message .Link)}}}
+//
+// Templates see the alert fields (.Rule, .Kind, .Source, .Severity, .Title,
+// .Message, .Count, .FiredAt, .ID, and .Owner and .RunbookURL for registered
+// sources) plus:
+//   - .Logs   up to 5 sample logs (.ID .Title .Type .Source .Severity .Timestamp .Link)
+//   - .Link   dashboard link for the alert (first sample log, or a search)
+//   - .DashboardURL
+//
+// Helpers: json (quote a value for JSON), upper, lower, truncate N, join.
+// A {{define "<kind>"}} block (e.g. "escalation") overrides the template for
+// that kind of alert. Bodies that are valid JSON are sent as
+// application/json, anything else as text/plain. Links are absolute when
+// -public-url is set.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification settings - configured once in main()
+var (
+	alertTemplate *template.Template // nil sends the alert as JSON
+	publicURL     string             // -public-url, "" for relative links
+)
+
+// maxNotificationLogs caps the sample logs a template sees
+const maxNotificationLogs = 5
+
+// notificationLog is a sample log as seen by templates
+type notificationLog struct {
+	ID        int64
+	Title     string
+	Type      string
+	Source    string
+	Severity  string
+	Timestamp time.Time
+	Link      string
+}
+
+// notificationData is what a notification template renders
+type notificationData struct {
+	Alert
+	Logs         []notificationLog
+	Link         string
+	DashboardURL string
+}
+
+// notificationFuncs are the helpers available in templates
+var notificationFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"truncate": func(length int, value string) string {
+		if runes := []rune(value); len(runes) > length {
+			return string(runes[:length]) + "…"
+		}
+		return value
+	},
+	"join": strings.Join,
+}
+
+// loadAlertTemplate parses the template file and test-renders it
+func loadAlertTemplate(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read alert template: %v", err)
+	}
+	tmpl, err := template.New("alert").Funcs(notificationFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid alert template: %v", err)
+	}
+
+	// Catch references to fields that don't exist before the first real alert
+	sample := notificationData{
+		Alert: Alert{ID: 1, Rule: "example", Kind: "escalation", Source: "api", Severity: "critical",
+			Title: "Escalated: example", Message: "20 warning logs within 5m0s", Count: 20, FiredAt: time.Now()},
+		Logs: []notificationLog{{ID: 1, Title: "Example", Type: "warning", Source: "api", Severity: "warning", Timestamp: time.Now(), Link: dashboardLink("/logs/1")}},
+		Link: dashboardLink("/logs/1"), DashboardURL: dashboardLink("/"),
+	}
+	for _, t := range tmpl.Templates() {
+		if err := t.Execute(&bytes.Buffer{}, sample); err != nil {
+			return fmt.Errorf("alert template '%s' fails to render: %v", t.Name(), err)
+		}
+	}
+	alertTemplate = tmpl
+	return nil
+}
+
+// dashboardLink makes a dashboard path absolute when -public-url is set
+func dashboardLink(path string) string {
+	return strings.TrimRight(publicURL, "/") + path
+}
+
+// alertLink points at the first sample log, or at a search for the alert's source
+func alertLink(alert Alert) string {
+	if len(alert.LogIDs) > 0 {
+		return dashboardLink("/logs/" + strconv.FormatInt(alert.LogIDs[0], 10))
+	}
+	if alert.Source != "" {
+		return dashboardLink("/search?query=" + url.QueryEscape(alert.Source))
+	}
+	return dashboardLink("/")
+}
+
+// notificationLogs loads the sample logs of an alert
+func notificationLogs(ids []int64) []notificationLog {
+	logs := []notificationLog{}
+	for _, id := range ids {
+		if len(logs) == maxNotificationLogs {
+			break
+		}
+		entry := notificationLog{ID: id, Link: dashboardLink("/logs/" + strconv.FormatInt(id, 10))}
+		var source, severity sql.NullString
+		err := db.QueryRow(db.Rebind("SELECT title, type, source, derived_severity, timestamp FROM logs WHERE id = ?"), id).
+			Scan(&entry.Title, &entry.Type, &source, &severity, (*scanTime)(&entry.Timestamp))
+		if err != nil {
+			continue
+		}
+		entry.Source, entry.Severity = source.String, severity.String
+		logs = append(logs, entry)
+	}
+	return logs
+}
+
+// renderAlert returns the webhook body for an alert and its content type
+func renderAlert(alert Alert) ([]byte, string, error) {
+	if alertTemplate == nil {
+		body, err := json.Marshal(alert)
+		return body, "application/json", err
+	}
+
+	tmpl := alertTemplate
+	if kind := alertTemplate.Lookup(alert.Kind); kind != nil {
+		tmpl = kind
+	}
+	data := notificationData{Alert: alert, Logs: notificationLogs(alert.LogIDs), Link: alertLink(alert), DashboardURL: dashboardLink("/")}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, "", err
+	}
+	if json.Valid(body.Bytes()) {
+		return body.Bytes(), "application/json", nil
+	}
+	return body.Bytes(), "text/plain; charset=utf-8", nil
+}
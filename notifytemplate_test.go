@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAlertTemplates tests rendering alert webhook bodies from a template
+func TestAlertTemplates(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	publicURL = "https://logs.example.com"
+	defer func() { alertTemplate, publicURL = nil, "" }()
+
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs",
+		strings.NewReader(`{"header":{"type":"warning","title":"Upstream \"slow\"","source":"payments"}}`)))
+	alert := Alert{Rule: "warning-flood", Kind: "escalation", Source: "payments", Title: "Escalated: warning-flood",
+		Message: "20 warning logs within 5m0s", Count: 20, LogIDs: []int64{1}}
+
+	// Without a template the alert itself is sent
+	if body, contentType, _ := renderAlert(alert); contentType != "application/json" || !strings.Contains(string(body), `"rule":"warning-flood"`) {
+		t.Errorf("Expected the alert as JSON, got %s %s", contentType, body)
+	}
+
+	path := filepath.Join(t.TempDir(), "alert.tmpl")
+	os.WriteFile(path, []byte(`{"text": {{json (printf "%s (%d) %s" .Title .Count .Link)}}, "first": {{json (index .Logs 0).Title}}}`+
+		`{{define "first_seen"}}New error: {{.Title | upper}}{{end}}`), 0644)
+	if err := loadAlertTemplate(path); err != nil {
+		t.Fatalf("Failed to load template: %v", err)
+	}
+
+	body, contentType, err := renderAlert(alert)
+	var rendered map[string]string
+	if err != nil || contentType != "application/json" || json.Unmarshal(body, &rendered) != nil {
+		t.Fatalf("Expected a JSON body, got %s %s (%v)", contentType, body, err)
+	}
+	if rendered["text"] != "Escalated: warning-flood (20) https://logs.example.com/logs/1" || rendered["first"] != `Upstream "slow"` {
+		t.Errorf("Unexpected rendering: %v", rendered)
+	}
+
+	// A template named after the alert kind wins
+	alert.Kind = "first_seen"
+	if body, contentType, _ := renderAlert(alert); string(body) != "New error: ESCALATED: WARNING-FLOOD" || !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Expected the first_seen template as text, got %s %s", contentType, body)
+	}
+
+	os.WriteFile(path, []byte(`{{.Nope}}`), 0644)
+	if err := loadAlertTemplate(path); err == nil {
+		t.Errorf("Expected a template using unknown fields to be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+// CubicLog Palettes - The dashboard's colors, including a color-blind safe set
+//
+//	cubiclog -palette colorblind
+//	cubiclog -palette-file palettes.json -palette corporate
+//	GET /api/ui/config    the palettes and the default one (public)
+//
+// The dashboard draws status indicators, badges and charts from a palette: a
+// hex color per severity and per Tailwind color name (the names logs are
+// colored with, see colors.go). Built in are "default", the colors the
+// dashboard always had, and "colorblind", built on the Okabe-Ito colors that
+// stay apart with the common kinds of color blindness. More palettes come
+// from -palette-file:
+//
+//	{
+//	  "palettes": [
+//	    {
+//	      "name": "corporate",
+//	      "description": "Brand colors",
+//	      "base": "colorblind",
+//	      "severities": {"critical": "#7b1fa2", "audit": "#00897b"},
+//	      "colors": {"red": "#c62828"}
+//	    }
+//	  ]
+//	}
+//
+// A palette starts from its base (default "default") and replaces the colors
+// it names; severities may include custom ones. -palette picks the palette
+// the dashboard opens with, and everyone can choose another one in the
+// dashboard (stored with their preferences, see preferences.go).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// uiPalette maps severities and Tailwind color names to hex colors
+type uiPalette struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Base        string            `json:"base,omitempty"`
+	Severities  map[string]string `json:"severities"`
+	Colors      map[string]string `json:"colors"`
+}
+
+// hexColorPattern validates palette colors
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// builtinPalettes are always available, default first
+var builtinPalettes = []uiPalette{
+	{
+		Name:        "default",
+		Description: "CubicLog's standard colors",
+		Severities: map[string]string{
+			"critical": "#991b1b", "error": "#ef4444", "warning": "#f59e0b",
+			"success": "#10b981", "info": "#3b82f6", "debug": "#6b7280",
+		},
+		Colors: map[string]string{
+			"slate": "#64748b", "gray": "#6b7280", "zinc": "#71717a", "neutral": "#737373", "stone": "#78716c",
+			"red": "#ef4444", "orange": "#f97316", "amber": "#f59e0b", "yellow": "#f59e0b", "lime": "#65a30d",
+			"green": "#10b981", "emerald": "#059669", "teal": "#0d9488", "cyan": "#06b6d4", "sky": "#0ea5e9", "blue": "#3b82f6",
+			"indigo": "#6366f1", "violet": "#8b5cf6", "purple": "#a855f7", "fuchsia": "#d946ef", "pink": "#ec4899", "rose": "#f43f5e",
+		},
+	},
+	{
+		Name:        "colorblind",
+		Description: "Okabe-Ito colors, distinguishable with red-green and blue-yellow color blindness",
+		Severities: map[string]string{
+			"critical": "#d55e00", "error": "#e69f00", "warning": "#f0e442",
+			"success": "#009e73", "info": "#0072b2", "debug": "#999999",
+		},
+		Colors: map[string]string{
+			"slate": "#999999", "gray": "#999999", "zinc": "#999999", "neutral": "#999999", "stone": "#999999",
+			"red": "#d55e00", "orange": "#e69f00", "amber": "#e69f00", "yellow": "#f0e442", "lime": "#f0e442",
+			"green": "#009e73", "emerald": "#009e73", "teal": "#009e73", "cyan": "#56b4e9", "sky": "#56b4e9", "blue": "#0072b2",
+			"indigo": "#0072b2", "violet": "#cc79a7", "purple": "#cc79a7", "fuchsia": "#cc79a7", "pink": "#cc79a7", "rose": "#d55e00",
+		},
+	},
+}
+
+// UI palettes - configured once in main()
+var (
+	uiPalettes     = builtinPalettes
+	defaultPalette = "default"
+)
+
+// findPalette looks up a palette by name
+func findPalette(palettes []uiPalette, name string) (uiPalette, bool) {
+	for _, palette := range palettes {
+		if palette.Name == name {
+			return palette, true
+		}
+	}
+	return uiPalette{}, false
+}
+
+// configurePalettes loads the -palette-file on top of the built-in palettes and picks the default one
+func configurePalettes(path, name string) error {
+	palettes := append([]uiPalette{}, builtinPalettes...)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read palette file: %v", err)
+		}
+		var config struct {
+			Palettes []uiPalette `json:"palettes"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("invalid palette file: %v", err)
+		}
+		for _, palette := range config.Palettes {
+			if palette, err = resolvePalette(palettes, palette); err != nil {
+				return err
+			}
+			palettes = append(palettes, palette)
+		}
+	}
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := findPalette(palettes, name); !ok {
+		return fmt.Errorf("unknown palette '%s'", name)
+	}
+	uiPalettes, defaultPalette = palettes, name
+	return nil
+}
+
+// resolvePalette validates a palette from the file and fills it in from its base
+func resolvePalette(palettes []uiPalette, palette uiPalette) (uiPalette, error) {
+	palette.Name = strings.ToLower(strings.TrimSpace(palette.Name))
+	if palette.Name == "" {
+		return palette, fmt.Errorf("palette name is required")
+	}
+	if _, taken := findPalette(palettes, palette.Name); taken {
+		return palette, fmt.Errorf("palette '%s' is defined twice", palette.Name)
+	}
+	base, ok := findPalette(palettes, valueOr(strings.ToLower(palette.Base), "default"))
+	if !ok {
+		return palette, fmt.Errorf("palette '%s': unknown base '%s'", palette.Name, palette.Base)
+	}
+
+	resolved := uiPalette{Name: palette.Name, Description: palette.Description, Base: base.Name,
+		Severities: map[string]string{}, Colors: map[string]string{}}
+	for severity, hex := range base.Severities {
+		resolved.Severities[severity] = hex
+	}
+	for color, hex := range base.Colors {
+		resolved.Colors[color] = hex
+	}
+	for severity, hex := range palette.Severities {
+		if !hexColorPattern.MatchString(hex) {
+			return palette, fmt.Errorf("palette '%s': severity %s: '%s' is not a #rrggbb color", palette.Name, severity, hex)
+		}
+		resolved.Severities[strings.ToLower(strings.TrimSpace(severity))] = strings.ToLower(hex)
+	}
+	for color, hex := range palette.Colors {
+		if !isValidTailwindColor(color) {
+			return palette, fmt.Errorf("palette '%s': '%s' is not a Tailwind color name", palette.Name, color)
+		}
+		if !hexColorPattern.MatchString(hex) {
+			return palette, fmt.Errorf("palette '%s': color %s: '%s' is not a #rrggbb color", palette.Name, color, hex)
+		}
+		resolved.Colors[color] = strings.ToLower(hex)
+	}
+	return resolved, nil
+}
+
+// handleUIConfig answers GET /api/ui/config
+func handleUIConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"palette":             defaultPalette,
+		"palettes":            uiPalettes,
+		"locale":              defaultLocale,
+		"languages":           uiLanguages(),
+		"refresh_interval_ms": dashboardRefresh.Milliseconds(), // see autorefresh.go
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPalettes tests the built-in and custom dashboard palettes
+func TestPalettes(t *testing.T) {
+	defer func() { uiPalettes, defaultPalette = builtinPalettes, "default" }()
+
+	var config struct {
+		Palette  string      `json:"palette"`
+		Palettes []uiPalette `json:"palettes"`
+	}
+	w := httptest.NewRecorder()
+	handleUIConfig(w, httptest.NewRequest("GET", "/api/ui/config", nil))
+	json.NewDecoder(w.Body).Decode(&config)
+	if config.Palette != "default" || len(config.Palettes) != 2 || config.Palettes[1].Name != "colorblind" {
+		t.Fatalf("Expected the built-in palettes, got %+v", config)
+	}
+
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "palettes.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write palette file: %v", err)
+		}
+		return path
+	}
+	path := write(`{"palettes": [{"name": "Corporate", "base": "colorblind", "severities": {"audit": "#00897B"}, "colors": {"red": "#c62828"}}]}`)
+	if err := configurePalettes(path, "corporate"); err != nil {
+		t.Fatalf("Failed to configure palettes: %v", err)
+	}
+	corporate, ok := findPalette(uiPalettes, "corporate")
+	if !ok || defaultPalette != "corporate" {
+		t.Fatalf("Expected the custom palette as the default, got %q %+v", defaultPalette, uiPalettes)
+	}
+	if corporate.Severities["audit"] != "#00897b" || corporate.Colors["red"] != "#c62828" || corporate.Severities["info"] != "#0072b2" {
+		t.Errorf("Expected the palette merged over its base, got %+v", corporate)
+	}
+
+	for name, content := range map[string]string{
+		"invalid hex":  `{"palettes": [{"name": "x", "severities": {"error": "red"}}]}`,
+		"unknown base": `{"palettes": [{"name": "x", "base": "neon"}]}`,
+		"bad color":    `{"palettes": [{"name": "x", "colors": {"crimson": "#ff0000"}}]}`,
+		"duplicate":    `{"palettes": [{"name": "default"}]}`,
+	} {
+		if err := configurePalettes(write(content), "default"); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+	if err := configurePalettes("", "neon"); err == nil || !strings.Contains(err.Error(), "unknown palette") {
+		t.Errorf("Expected an unknown -palette to be refused, got %v", err)
+	}
+
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	uiPalettes = builtinPalettes
+	w = httptest.NewRecorder()
+	handlePreferences(w, httptest.NewRequest("PUT", "/api/preferences", strings.NewReader(`{"palette": "neon"}`)))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an unknown palette preference, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handlePreferences(w, httptest.NewRequest("PUT", "/api/preferences", strings.NewReader(`{"palette": "colorblind"}`)))
+	if w.Code != 200 {
+		t.Errorf("Expected the color-blind palette to be saved, got %d", w.Code)
+	}
+}
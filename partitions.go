@@ -0,0 +1,422 @@
+// CubicLog Monthly Partitioning - One SQLite file per month
+//
+// With -partition monthly the main database only holds the current month.
+// When a month ends its rows are moved into their own file next to the main
+// database (logs.db → logs-2024-05.db), which means:
+//   - retention becomes "delete a file" instead of a huge DELETE + VACUUM
+//   - the main database stays small, so vacuuming it is cheap
+//   - old months can be moved to cheap storage (and copied back when needed)
+//
+// Queries that list or export logs attach the partitions covering the requested
+// date range on a dedicated connection and read them through a UNION ALL view.
+// Analytics (/api/stats) only look at the main database, i.e. the current month.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SQLite refuses to attach more than 10 databases to one connection by default
+const maxAttachedPartitions = 10
+
+// errTooManyPartitions is returned by queryLogs when the requested range spans
+// more partitions than can be attached at once, rather than leaving months out
+var errTooManyPartitions = fmt.Errorf("the requested range spans more than %d monthly partitions - narrow it with from/to", maxAttachedPartitions)
+
+// errTooManyArchives is errTooManyPartitions for ranges that only go over the
+// limit together with the archives asked for (see archives.go)
+var errTooManyArchives = fmt.Errorf("the requested range and archives span more than %d database files - narrow it with from/to or attach fewer archives", maxAttachedPartitions)
+
+// timestampLayouts are the text forms a timestamp can be stored in (the ones
+// the SQLite driver writes and reads back for DATETIME columns)
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// partitionColumns is the column set read across partitions (older partitions
+// may lack columns added by later migrations)
+const partitionColumns = "id, type, title, description, source, color, body, timestamp, derived_severity, derived_source, derived_category, environment, derived_language, release, derived_duration_ms, derived_http_status"
+
+// partitionLateColumns were added after partitioning shipped, so partitions
+// written before may lack them
+var partitionLateColumns = []string{"environment", "derived_language", "release", "derived_duration_ms", "derived_http_status"}
+
+// Partitioning state - configured once in main()
+var (
+	partitionMode bool   // true when -partition monthly is enabled
+	partitionBase string // main database path the partition names derive from
+)
+
+// enablePartitioning validates and enables monthly partitioning for dbPath
+func enablePartitioning(mode, dbPath string) error {
+	switch mode {
+	case "":
+		return nil
+	case "monthly":
+	default:
+		return fmt.Errorf("unsupported partition mode '%s' - use monthly", mode)
+	}
+	if db.Driver() != "sqlite3" {
+		return fmt.Errorf("partitioning is only supported for SQLite")
+	}
+	if dbPath == "" || isMemoryDSN(dbPath) {
+		return fmt.Errorf("partitioning requires a database file")
+	}
+	partitionMode = true
+	partitionBase = dbPath
+	return nil
+}
+
+// partitionPath returns the file holding logs for a month ("2024-05")
+func partitionPath(month string) string {
+	ext := filepath.Ext(partitionBase)
+	return strings.TrimSuffix(partitionBase, ext) + "-" + month + ext
+}
+
+// listPartitions returns the months that have a partition file, oldest first
+func listPartitions() []string {
+	ext := filepath.Ext(partitionBase)
+	pattern := strings.TrimSuffix(partitionBase, ext) + "-????-??" + ext
+	files, _ := filepath.Glob(pattern)
+
+	months := make([]string, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ext)
+		months = append(months, name[len(name)-7:])
+	}
+	sort.Strings(months)
+	return months
+}
+
+// rollOverPartitions moves rows from finished months out of the main database
+func rollOverPartitions() error {
+	currentMonth := time.Now().Format("2006-01")
+
+	rows, err := db.Query("SELECT DISTINCT substr(timestamp, 1, 7) FROM logs WHERE substr(timestamp, 1, 7) < ?", currentMonth)
+	if err != nil {
+		return err
+	}
+	var months []string
+	for rows.Next() {
+		var month string
+		if rows.Scan(&month) == nil {
+			months = append(months, month)
+		}
+	}
+	rows.Close()
+
+	if len(months) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, month := range months {
+		if err := moveMonthToPartition(ctx, conn, month); err != nil {
+			return fmt.Errorf("partition %s: %v", month, err)
+		}
+		log.Printf("🗂️  Moved logs from %s into %s", month, partitionPath(month))
+		invalidateHourlyStats()
+	}
+
+	// The main database only holds one month now, so vacuuming it is cheap
+	_, err = conn.ExecContext(ctx, "VACUUM")
+	return err
+}
+
+// moveMonthToPartition copies one month into its partition file and removes it from main
+func moveMonthToPartition(ctx context.Context, conn *sql.Conn, month string) error {
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS part", partitionPath(month)); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE part")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS part.logs AS SELECT * FROM main.logs WHERE 0",
+		"CREATE INDEX IF NOT EXISTS part.idx_logs_timestamp ON logs(timestamp)",
+		"CREATE INDEX IF NOT EXISTS part.idx_logs_type ON logs(type)",
+		"CREATE INDEX IF NOT EXISTS part.idx_logs_derived_severity ON logs(derived_severity)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	// Partitions from older versions get the newer columns before rows are copied in
+	missing, err := missingPartitionColumns(ctx, tx, "part", partitionLateColumns)
+	if err != nil {
+		return err
+	}
+	for _, column := range missing {
+		if _, err := tx.ExecContext(ctx, "ALTER TABLE part.logs ADD COLUMN "+column+" TEXT"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO part.logs SELECT * FROM main.logs WHERE substr(timestamp, 1, 7) = ?", month); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM main.logs WHERE substr(timestamp, 1, 7) = ?", month); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// startPartitionRollover checks for finished months every hour
+func startPartitionRollover() {
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := rollOverPartitions(); err != nil {
+				log.Printf("⚠️  Partition rollover error: %v", err)
+			}
+		}
+	}()
+}
+
+// cleanupPartitions deletes partition files whose whole month is older than cutoff
+func cleanupPartitions(cutoff time.Time) {
+	cutoffMonth := cutoff.Format("2006-01")
+	for _, month := range listPartitions() {
+		if month >= cutoffMonth {
+			continue
+		}
+		if partitionHasHeldLogs(month) {
+			log.Printf("⚖️  Kept expired partition %s: it holds logs under a legal hold", partitionPath(month))
+			continue
+		}
+		if err := os.Remove(partitionPath(month)); err != nil {
+			log.Printf("⚠️  Could not remove partition %s: %v", month, err)
+			continue
+		}
+		log.Printf("🗑️  Removed expired partition %s", partitionPath(month))
+	}
+}
+
+// partitionsInRange returns the partitions overlapping [from, to] (dates or
+// timestamps, either may be empty), newest first
+func partitionsInRange(from, to string) []string {
+	var selected []string
+	months := listPartitions()
+	for i := len(months) - 1; i >= 0; i-- {
+		month := months[i]
+		if from != "" && len(from) >= 7 && month < from[:7] {
+			continue
+		}
+		if to != "" && len(to) >= 7 && month > to[:7] {
+			continue
+		}
+		selected = append(selected, month)
+	}
+	return selected
+}
+
+// queryLogs runs a query against the logs table. build receives the table
+// expression to select from and returns the query and its arguments; with
+// partitioning enabled the table is a UNION ALL over the main database and the
+// partitions covering [from, to]. A range spanning more partitions than can be
+// attached fails with errTooManyPartitions. The returned release function must
+// be called once the rows are no longer needed.
+func queryLogs(from, to string, build func(table string) (string, []interface{})) (*sql.Rows, func(), error) {
+	return queryArchivedLogs(from, to, nil, build)
+}
+
+// queryArchivedLogs is queryLogs that also reads the selected -attach archives
+// (see archives.go)
+func queryArchivedLogs(from, to string, selected []archiveDB, build func(table string) (string, []interface{})) (*sql.Rows, func(), error) {
+	if !partitionMode && len(selected) == 0 {
+		query, args := build("logs")
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rows, func() { rows.Close() }, nil
+	}
+
+	var months []string
+	if partitionMode {
+		months = partitionsInRange(from, to)
+	}
+	if len(months) > maxAttachedPartitions {
+		return nil, nil, errTooManyPartitions
+	}
+	if len(months)+len(selected) > maxAttachedPartitions {
+		return nil, nil, errTooManyArchives
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var attached []string
+	detach := func() {
+		for _, alias := range attached {
+			conn.ExecContext(ctx, "DETACH DATABASE "+alias)
+		}
+		conn.Close()
+	}
+
+	selects := []string{"SELECT " + partitionColumns + " FROM main.logs"}
+	for i, month := range months {
+		alias := fmt.Sprintf("p%d", i)
+		if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+alias, partitionPath(month)); err != nil {
+			log.Printf("⚠️  Could not attach partition %s: %v", month, err)
+			continue
+		}
+		attached = append(attached, alias)
+
+		// Columns a partition was written without read as NULL
+		missing, err := missingPartitionColumns(ctx, conn, alias, partitionLateColumns)
+		if err != nil {
+			detach()
+			return nil, nil, err
+		}
+		selects = append(selects, "SELECT "+partitionSelect(missing)+" FROM "+alias+".logs")
+	}
+	union, err := attachArchives(ctx, conn, selected, &attached)
+	if err != nil {
+		detach()
+		return nil, nil, err
+	}
+
+	query, args := build("(" + strings.Join(selects, " UNION ALL ") + union + ")")
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		detach()
+		return nil, nil, err
+	}
+	return rows, func() { rows.Close(); detach() }, nil
+}
+
+// partitionBatches splits the partitions into month ranges ("from", "to") that
+// each fit into one query, newest first. Lookups that don't know the month of
+// a log (GET /api/logs/{id}) walk them in turn.
+func partitionBatches() [][2]string {
+	months := listPartitions()
+	if !partitionMode || len(months) <= maxAttachedPartitions {
+		return [][2]string{{"", ""}}
+	}
+	var batches [][2]string
+	for end := len(months); end > 0; end -= maxAttachedPartitions {
+		start := end - maxAttachedPartitions
+		if start < 0 {
+			start = 0
+		}
+		batches = append(batches, [2]string{months[start], months[end-1]})
+	}
+	return batches
+}
+
+// writeQueryError answers a failed log query: a range spanning too many
+// partitions is for the client to narrow, anything else is a server error
+func writeQueryError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, errTooManyPartitions) || errors.Is(err, errTooManyArchives) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// partitionSelect is the partitionColumns list reading missing columns as NULL
+func partitionSelect(missing []string) string {
+	columns := strings.Split(partitionColumns, ", ")
+	for i, column := range columns {
+		if containsString(missing, column) {
+			columns[i] = "NULL AS " + column
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// missingPartitionColumns returns the columns an attached database lacks
+func missingPartitionColumns(ctx context.Context, conn interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, alias string, columns []string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, "PRAGMA "+alias+".table_info(logs)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	present := map[string]bool{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		present[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, column := range columns {
+		if !present[column] {
+			missing = append(missing, column)
+		}
+	}
+	return missing, nil
+}
+
+// scanTime is a sql.Scanner for timestamps read through a UNION ALL, where
+// SQLite loses the DATETIME column type and hands back plain text
+type scanTime time.Time
+
+func (t *scanTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		*t = scanTime(v)
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	case nil:
+		*t = scanTime(time.Time{})
+		return nil
+	}
+	return fmt.Errorf("unsupported timestamp type %T", value)
+}
+
+func (t *scanTime) parse(value string) error {
+	value = strings.TrimSuffix(value, "Z")
+	for _, format := range timestampLayouts {
+		if parsed, err := time.ParseInLocation(format, value, time.UTC); err == nil {
+			*t = scanTime(parsed)
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognized timestamp '%s'", value)
+}
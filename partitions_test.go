@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMonthlyPartitioning tests rollover, cross-partition queries and file-based retention
+func TestMonthlyPartitioning(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+
+	originalDB := db
+	var err error
+	db, err = openStore("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() {
+		db.Close()
+		db = originalDB
+		partitionMode = false
+	}()
+	if err := createTable(); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := enablePartitioning("monthly", dbPath); err != nil {
+		t.Fatalf("Failed to enable partitioning: %v", err)
+	}
+
+	db.Exec("INSERT INTO logs (type, title, color, body, timestamp) VALUES ('info', 'old entry', 'blue', '{}', '2024-01-15 10:00:00')")
+	db.Exec("INSERT INTO logs (type, title, color, body, timestamp) VALUES ('info', 'new entry', 'blue', '{}', ?)", time.Now())
+
+	if err := rollOverPartitions(); err != nil {
+		t.Fatalf("Rollover failed: %v", err)
+	}
+
+	var mainCount int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&mainCount)
+	if mainCount != 1 {
+		t.Errorf("Expected 1 log left in main database, got %d", mainCount)
+	}
+	if _, err := os.Stat(partitionPath("2024-01")); err != nil {
+		t.Fatalf("Expected partition file: %v", err)
+	}
+
+	// Listing spans the main database and the partition
+	w := httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs", nil))
+	var logs []Log
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 2 {
+		t.Errorf("Expected 2 logs across partitions, got %d: %s", len(logs), w.Body.String())
+	}
+
+	// Retention deletes the whole file
+	cleanupPartitions(time.Now())
+	if _, err := os.Stat(partitionPath("2024-01")); !os.IsNotExist(err) {
+		t.Error("Expected expired partition file to be removed")
+	}
+}
+
+// TestPartitionLimit tests that a range spanning too many partitions is refused instead of cut short
+func TestPartitionLimit(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+
+	originalDB := db
+	var err error
+	db, err = openStore("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() {
+		db.Close()
+		db = originalDB
+		partitionMode = false
+	}()
+	if err := createTable(); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := enablePartitioning("monthly", dbPath); err != nil {
+		t.Fatalf("Failed to enable partitioning: %v", err)
+	}
+
+	for month := 1; month <= 12; month++ {
+		db.Exec("INSERT INTO logs (type, title, color, body, timestamp) VALUES ('info', 'old entry', 'blue', '{}', ?)",
+			fmt.Sprintf("2023-%02d-15 10:00:00", month))
+	}
+	if err := rollOverPartitions(); err != nil {
+		t.Fatalf("Rollover failed: %v", err)
+	}
+	db.Exec("INSERT INTO logs (type, title, color, body, timestamp) VALUES ('info', 'new entry', 'blue', '{}', ?)", time.Now())
+
+	w := httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a range over 12 partitions, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs?from=2023-06-15", nil))
+	var logs []Log
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if w.Code != http.StatusOK || len(logs) != 1 {
+		t.Errorf("Expected 1 log for a narrowed range, got %d (%d): %s", len(logs), w.Code, w.Body.String())
+	}
+
+	// Ten partitions fit, but not together with an archive
+	_, _, err = queryArchivedLogs("2023-03-01", "", []archiveDB{{Name: "old", Path: "old.db"}}, func(table string) (string, []interface{}) {
+		return "SELECT id FROM " + table, nil
+	})
+	if !errors.Is(err, errTooManyArchives) {
+		t.Errorf("Expected errTooManyArchives for 10 partitions and an archive, got %v", err)
+	}
+
+	// Single log lookups walk the partitions in batches, down to the oldest month
+	detail, err := loadLogDetail(1)
+	if err != nil || detail == nil || detail.Timestamp.Format("2006-01") != "2023-01" {
+		t.Errorf("Expected the January log from the oldest batch, got %+v (%v)", detail, err)
+	}
+}
+
+// TestScanTimeLayouts tests parsing timestamps read back as text
+func TestScanTimeLayouts(t *testing.T) {
+	for _, value := range []string{"2024-05-01 10:00:00", "2024-05-01T10:00:00Z", "2024-05-01 10:00:00.123456789+00:00", "2024-05-01"} {
+		var parsed scanTime
+		if err := parsed.Scan(value); err != nil {
+			t.Errorf("Failed to parse %s: %v", value, err)
+		}
+		if time.Time(parsed).Format("2006-01-02") != "2024-05-01" {
+			t.Errorf("Wrong date for %s: %v", value, time.Time(parsed))
+		}
+	}
+}
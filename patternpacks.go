@@ -0,0 +1,259 @@
+// CubicLog Pattern Packs - Business events for the kind of system you run
+//
+//	cubiclog -pattern-packs ecommerce,iot
+//	cubiclog -pattern-packs none -pattern-pack-dir /etc/cubiclog/packs
+//	GET /api/patterns/packs     every pack with its patterns, and which are enabled
+//
+// The business pattern list ("payment failed" → error, "device offline" →
+// warning, ...) is made of packs, JSON files shipped in patternpacks/:
+// accounts, ecommerce and saas-billing are enabled by default, iot and
+// security can be added. -pattern-packs picks the packs instead ("none"
+// turns business detection off), and -pattern-pack-dir adds packs from a
+// directory in the same format, replacing a shipped pack of the same name:
+//
+//	{"description": "Fleet telemetry", "default": false, "patterns": {"truck idle": "info"}}
+//
+// The pack name is the file name without .json. When enabled packs map the
+// same pattern differently, the more severe one wins.
+//
+// Packs are enabled for the instance, and sources (projects) can have their
+// own packs instead: a log of the sensor-gateway source is matched against
+// the packs of that source only. Both are runtime settings (see
+// adminconfig.go): pattern_packs takes the instance packs, and
+// source_pattern_packs maps sources to theirs, e.g.
+// {"sensor-gateway": ["iot", "security"]}. Patterns added or removed through
+// /api/patterns/business apply on top of every pack selection.
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed patternpacks/*.json
+var patternPackFiles embed.FS
+
+// patternPack is one set of business patterns
+type patternPack struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Default     bool              `json:"default"`
+	Patterns    map[string]string `json:"patterns"`
+	Custom      bool              `json:"custom"` // from -pattern-pack-dir
+}
+
+// packNamePattern validates pack names (file names without .json)
+var packNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+var (
+	// patternPacks are the known packs by name - shipped ones, plus -pattern-pack-dir in main()
+	patternPacks = loadShippedPacks()
+
+	// The enabled packs - set by -pattern-packs and the runtime settings
+	packsMu       sync.RWMutex
+	instancePacks = defaultPackNames()
+	sourcePacks   = map[string][]string{} // source → its own packs
+)
+
+// loadShippedPacks reads the embedded packs (TestPatternPacks checks that all of them load)
+func loadShippedPacks() map[string]patternPack {
+	packs := map[string]patternPack{}
+	entries, _ := patternPackFiles.ReadDir("patternpacks")
+	for _, entry := range entries {
+		data, _ := patternPackFiles.ReadFile("patternpacks/" + entry.Name())
+		if pack, err := parsePatternPack(entry.Name(), data); err == nil {
+			packs[pack.Name] = pack
+		}
+	}
+	return packs
+}
+
+// parsePatternPack reads and checks one pack file
+func parsePatternPack(file string, data []byte) (patternPack, error) {
+	var pack patternPack
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return pack, fmt.Errorf("pattern pack %s: %v", file, err)
+	}
+	pack.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+	if !packNamePattern.MatchString(pack.Name) {
+		return pack, fmt.Errorf("pattern pack %s: name must be lowercase letters, digits, - and _", file)
+	}
+	if len(pack.Patterns) == 0 {
+		return pack, fmt.Errorf("pattern pack %s: no patterns", file)
+	}
+	business := patternList{Name: "business", severities: map[string]string{}}
+	for pattern, severity := range pack.Patterns {
+		if _, _, err := validatePattern(business, pattern, severity); err != nil {
+			return pack, fmt.Errorf("pattern pack %s: '%s': %v", file, pattern, err)
+		}
+	}
+	return pack, nil
+}
+
+// defaultPackNames returns the packs enabled without -pattern-packs
+func defaultPackNames() []string {
+	names := []string{}
+	for name, pack := range patternPacks {
+		if pack.Default {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// packPatterns merges the patterns of packs; the more severe mapping wins
+func packPatterns(names []string) map[string]string {
+	patterns := map[string]string{}
+	for _, name := range names {
+		for pattern, severity := range patternPacks[name].Patterns {
+			if current, ok := patterns[pattern]; !ok || severityOverrideRanks[severity] > severityOverrideRanks[current] {
+				patterns[pattern] = severity
+			}
+		}
+	}
+	return patterns
+}
+
+// parsePackNames checks a list of pack names, dropping duplicates
+func parsePackNames(names []string) ([]string, error) {
+	valid := []string{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if _, ok := patternPacks[name]; !ok {
+			return nil, fmt.Errorf("unknown pattern pack '%s'", name)
+		}
+		if !containsString(valid, name) {
+			valid = append(valid, name)
+		}
+	}
+	sort.Strings(valid)
+	return valid, nil
+}
+
+// configurePatternPacks sets the -pattern-pack-dir and -pattern-packs flags
+func configurePatternPacks(dir, names string) error {
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			pack, err := parsePatternPack(file, data)
+			if err != nil {
+				return err
+			}
+			pack.Custom = true
+			patternPacks[pack.Name] = pack
+		}
+	}
+
+	selected := defaultPackNames()
+	switch names = strings.TrimSpace(names); names {
+	case "":
+	case "none":
+		selected = []string{}
+	default:
+		var err error
+		if selected, err = parsePackNames(strings.Split(names, ",")); err != nil {
+			return err
+		}
+	}
+	_, sources := currentPackSelection()
+	setPackSelection(selected, sources)
+	return nil
+}
+
+// currentPackSelection returns copies of the instance and per-source packs
+func currentPackSelection() ([]string, map[string][]string) {
+	packsMu.RLock()
+	defer packsMu.RUnlock()
+	sources := make(map[string][]string, len(sourcePacks))
+	for source, names := range sourcePacks {
+		sources[source] = append([]string{}, names...)
+	}
+	return append([]string{}, instancePacks...), sources
+}
+
+// setPackSelection changes the enabled packs; the matchers pick them up on
+// the next loadPatterns
+func setPackSelection(instance []string, sources map[string][]string) {
+	if sources == nil {
+		sources = map[string][]string{}
+	}
+	packsMu.Lock()
+	instancePacks, sourcePacks = instance, sources
+	packsMu.Unlock()
+
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	for i := range patternLists {
+		if patternLists[i].Name == "business" {
+			patternLists[i].severities = packPatterns(instance)
+		}
+	}
+}
+
+// validateSourcePacks checks a source → packs mapping
+func validateSourcePacks(sources map[string][]string) (map[string][]string, error) {
+	valid := make(map[string][]string, len(sources))
+	for source, names := range sources {
+		if source = strings.TrimSpace(source); source == "" {
+			return nil, fmt.Errorf("source names can't be empty")
+		}
+		packs, err := parsePackNames(names)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		valid[source] = packs
+	}
+	return valid, nil
+}
+
+// patternPackView is a pack as listed by GET /api/patterns/packs
+type patternPackView struct {
+	patternPack
+	Patterns []patternEntry `json:"patterns"`
+	Enabled  bool           `json:"enabled"` // for the instance
+	Sources  []string       `json:"sources"` // sources that have it enabled
+}
+
+// handlePatternPacks answers GET /api/patterns/packs
+func handlePatternPacks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	instance, sources := currentPackSelection()
+	views := []patternPackView{}
+	for _, pack := range patternPacks {
+		view := patternPackView{patternPack: pack, Patterns: []patternEntry{}, Enabled: containsString(instance, pack.Name), Sources: []string{}}
+		for pattern, severity := range pack.Patterns {
+			view.Patterns = append(view.Patterns, patternEntry{Pattern: pattern, Severity: severity, Builtin: true})
+		}
+		sort.Slice(view.Patterns, func(i, j int) bool { return view.Patterns[i].Pattern < view.Patterns[j].Pattern })
+		for source, names := range sources {
+			if containsString(names, pack.Name) {
+				view.Sources = append(view.Sources, source)
+			}
+		}
+		sort.Strings(view.Sources)
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"packs": views, "instance": instance, "sources": sources})
+}
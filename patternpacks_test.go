@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPatternPacks tests enabling business pattern packs for the instance and per source
+func TestPatternPacks(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() {
+		delete(patternPacks, "fleet")
+		setPackSelection(defaultPackNames(), nil)
+		activePatterns.Store(nil)
+	}()
+
+	entries, _ := patternPackFiles.ReadDir("patternpacks")
+	if len(patternPacks) != len(entries) || len(entries) < 5 {
+		t.Fatalf("Expected every shipped pack to load, got %d of %d", len(patternPacks), len(entries))
+	}
+	if names := strings.Join(defaultPackNames(), ","); names != "accounts,ecommerce,saas-billing" {
+		t.Errorf("Expected accounts, ecommerce and saas-billing by default, got %s", names)
+	}
+	if err := loadPatterns(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadRuntimeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if detectBusinessLogic("", "Payment failed for order 7") != "error" || detectBusinessLogic("", "device offline") != "" {
+		t.Errorf("Expected only the default packs to match")
+	}
+
+	configure := func(body string) int {
+		w := httptest.NewRecorder()
+		handleAdminConfig(w, httptest.NewRequest("PUT", "/api/admin/config", strings.NewReader(body)))
+		return w.Code
+	}
+
+	// The instance packs change right away; sources with their own packs keep them
+	if code := configure(`{"pattern_packs": ["iot", "iot"], "source_pattern_packs": {"checkout": ["ecommerce"]}}`); code != http.StatusOK {
+		t.Fatalf("Expected the packs changed, got %d", code)
+	}
+	if detectBusinessLogic("sensors", "Device offline: gw-7") != "warning" || detectBusinessLogic("sensors", "payment failed") != "" {
+		t.Errorf("Expected only the iot pack for the instance")
+	}
+	if detectBusinessLogic("checkout", "payment failed") != "error" || detectBusinessLogic("checkout", "device offline") != "" {
+		t.Errorf("Expected only the ecommerce pack for checkout")
+	}
+
+	// Pattern changes apply on top of every selection
+	w := httptest.NewRecorder()
+	handlePatternList(w, httptest.NewRequest("POST", "/api/patterns/business", strings.NewReader(`{"pattern":"card declined","severity":"error"}`)))
+	if w.Code != http.StatusCreated || detectBusinessLogic("checkout", "card declined") != "error" || detectBusinessLogic("", "card declined") != "error" {
+		t.Errorf("Expected the added pattern for the instance and checkout, got %d", w.Code)
+	}
+
+	for _, body := range []string{`{"pattern_packs": ["crypto"]}`, `{"source_pattern_packs": {"": ["iot"]}}`, `{"source_pattern_packs": ["iot"]}`} {
+		if code := configure(body); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handlePatternPacks(w, httptest.NewRequest("GET", "/api/patterns/packs", nil))
+	var listed struct {
+		Packs    []patternPackView `json:"packs"`
+		Instance []string          `json:"instance"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	for _, pack := range listed.Packs {
+		if pack.Enabled != (pack.Name == "iot") || (pack.Name == "ecommerce") != (len(pack.Sources) == 1) {
+			t.Errorf("Expected iot enabled and ecommerce used by checkout, got %+v", pack)
+		}
+	}
+	if len(listed.Packs) != len(entries) || strings.Join(listed.Instance, ",") != "iot" {
+		t.Errorf("Expected %d packs with iot enabled, got %+v", len(entries), listed)
+	}
+
+	// Packs from a directory extend the shipped ones
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "fleet.json"), []byte(`{"description": "Trucks", "patterns": {"truck idle": "info"}}`), 0644)
+	if err := configurePatternPacks(dir, "fleet,security"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadPatterns(); err != nil {
+		t.Fatal(err)
+	}
+	if detectBusinessLogic("", "Truck idle for 20 minutes") != "info" || detectBusinessLogic("", "Account locked after 5 attempts") != "warning" {
+		t.Errorf("Expected the fleet and security packs to match")
+	}
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"patterns": {"truck idle": "loud"}}`), 0644)
+	if err := configurePatternPacks(dir, ""); err == nil {
+		t.Errorf("Expected an invalid severity to be refused")
+	}
+	if err := configurePatternPacks("", "crypto"); err == nil {
+		t.Errorf("Expected an unknown pack to be refused")
+	}
+}
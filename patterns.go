@@ -0,0 +1,408 @@
+// CubicLog Pattern Management - Tune the smart detection without a new release
+//
+//   - GET    /api/patterns                     all lists with their effective patterns
+//   - GET    /api/patterns/{list}              one list
+//   - POST   /api/patterns/{list}              add a pattern: {"pattern": "card declined", "severity": "error"}
+//   - DELETE /api/patterns/{list}?pattern=…    remove a pattern (built-in ones included)
+//
+// Lists are the keyword tables in main.go: error, warning, success, debug,
+// security and stack_trace (plain keywords), plus system_errors, database,
+// business (keyword → severity) and http_status (status code → severity), and
+// auth_failure and scan_paths for the security analytics (see security.go).
+// The business list is made of the enabled pattern packs (see patternpacks.go).
+// The built-in tables stay in the binary; the database only keeps the changes
+// (pattern_overrides), so upgrades still bring new built-in patterns. Every
+// change recompiles the matchers and takes effect for the next log. Removing a
+// built-in pattern hides it; adding it again brings it back. Other instances
+// sharing a PostgreSQL database pick up changes on restart. Changes are
+// recorded in the configuration audit log as patterns.{list} (see adminconfig.go).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// patternList describes one table the engine matches against
+type patternList struct {
+	Name        string
+	Description string
+	keywords    []string          // plain keyword lists
+	severities  map[string]string // keyword/code → severity lists
+}
+
+// patternLists are the manageable tables, in display order
+var patternLists = []patternList{
+	{Name: "error", Description: "Keywords marking a log as an error", keywords: errorKeywords},
+	{Name: "warning", Description: "Keywords marking a log as a warning", keywords: warningKeywords},
+	{Name: "success", Description: "Keywords marking a log as a success", keywords: successKeywords},
+	{Name: "debug", Description: "Keywords marking a log as debug output", keywords: debugKeywords},
+	{Name: "security", Description: "Keywords flagging a security issue (critical)", keywords: securityPatterns},
+	{Name: "stack_trace", Description: "Fragments identifying a stack trace (error)", keywords: stackTraceIndicators},
+	{Name: "system_errors", Description: "System error codes and their severity", severities: systemErrorCodes},
+	{Name: "database", Description: "Database problems and their severity", severities: databasePatterns},
+	{Name: "business", Description: "Business events and their severity", severities: packPatterns(defaultPackNames())},
+	{Name: "http_status", Description: "HTTP status codes and their severity", severities: httpStatusSeverity},
+	{Name: "auth_failure", Description: "Keywords marking a failed login (security analytics)", keywords: authFailurePatterns},
+	{Name: "scan_paths", Description: "Request paths probed by vulnerability scanners (security analytics)", keywords: scanPathPatterns},
+}
+
+// patternSeverities are the severities a pattern may map to
+var patternSeverities = []string{"critical", "error", "warning", "info", "success", "debug"}
+
+// httpStatusCodePattern validates http_status patterns
+var httpStatusCodePattern = regexp.MustCompile(`^[1-5]\d\d$`)
+
+// patternSet is the compiled state the detection functions use
+type patternSet struct {
+	errorMatcher, warningMatcher, successMatcher, debugMatcher *keywordMatcher
+	securityMatcher, stackTraceMatcher                         *keywordMatcher
+	authFailureMatcher, scanPathMatcher                        *keywordMatcher
+
+	systemErrorMatcher, databaseMatcher, businessMatcher *keywordMatcher
+	systemErrorLevel, databaseLevel, businessLevel       []string
+
+	httpStatusSeverity map[string]string
+
+	sourceBusiness map[string]businessMatcher // sources with their own pattern packs
+}
+
+// businessMatcher matches the business patterns of one pack selection
+type businessMatcher struct {
+	matcher *keywordMatcher
+	levels  []string
+}
+
+// patternOverride is one runtime change stored in pattern_overrides
+type patternOverride struct {
+	List      string    `json:"list"`
+	Pattern   string    `json:"pattern"`
+	Severity  string    `json:"severity,omitempty"`
+	Removed   bool      `json:"removed"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	activePatterns atomic.Pointer[patternSet]
+	patternsMu     sync.Mutex // serializes changes and reloads
+)
+
+// livePatterns returns the compiled pattern set (built-ins until loadPatterns ran)
+func livePatterns() *patternSet {
+	if set := activePatterns.Load(); set != nil {
+		return set
+	}
+	set := compilePatterns(nil)
+	activePatterns.CompareAndSwap(nil, set)
+	return activePatterns.Load()
+}
+
+// createPatternsTable creates the pattern change table
+func createPatternsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS pattern_overrides (
+		list       TEXT NOT NULL,
+		pattern    TEXT NOT NULL,
+		severity   TEXT NOT NULL DEFAULT '',
+		removed    BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (list, pattern)
+	);
+	`)
+	return err
+}
+
+// loadPatterns reads the stored changes and recompiles the matchers
+func loadPatterns() error {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	overrides, err := loadPatternOverrides()
+	if err != nil {
+		return err
+	}
+	activePatterns.Store(compilePatterns(overrides))
+	return nil
+}
+
+// loadPatternOverrides returns all stored changes
+func loadPatternOverrides() ([]patternOverride, error) {
+	rows, err := db.Query("SELECT list, pattern, severity, removed, created_at FROM pattern_overrides ORDER BY list, pattern")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []patternOverride{}
+	for rows.Next() {
+		var o patternOverride
+		if err := rows.Scan(&o.List, &o.Pattern, &o.Severity, &o.Removed, (*scanTime)(&o.CreatedAt)); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// effectivePatterns applies the overrides of one list to its built-ins
+func effectivePatterns(list patternList, overrides []patternOverride) map[string]string {
+	patterns := make(map[string]string)
+	for _, keyword := range list.keywords {
+		patterns[keyword] = ""
+	}
+	for keyword, severity := range list.severities {
+		patterns[keyword] = severity
+	}
+	for _, o := range overrides {
+		if o.List != list.Name {
+			continue
+		}
+		if o.Removed {
+			delete(patterns, o.Pattern)
+		} else {
+			patterns[o.Pattern] = o.Severity
+		}
+	}
+	return patterns
+}
+
+// compilePatterns builds the matchers from the built-ins and the overrides
+func compilePatterns(overrides []patternOverride) *patternSet {
+	effective := make(map[string]map[string]string, len(patternLists))
+	for _, list := range patternLists {
+		effective[list.Name] = effectivePatterns(list, overrides)
+	}
+	keywords := func(name string) *keywordMatcher {
+		words := make([]string, 0, len(effective[name]))
+		for word := range effective[name] {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+		return newKeywordMatcher(words)
+	}
+
+	set := &patternSet{
+		errorMatcher:       keywords("error"),
+		warningMatcher:     keywords("warning"),
+		successMatcher:     keywords("success"),
+		debugMatcher:       keywords("debug"),
+		securityMatcher:    keywords("security"),
+		stackTraceMatcher:  keywords("stack_trace"),
+		authFailureMatcher: keywords("auth_failure"),
+		scanPathMatcher:    keywords("scan_paths"),
+		httpStatusSeverity: effective["http_status"],
+	}
+	set.systemErrorMatcher, set.systemErrorLevel = newPatternMatcher(effective["system_errors"])
+	set.databaseMatcher, set.databaseLevel = newPatternMatcher(effective["database"])
+	set.businessMatcher, set.businessLevel = newPatternMatcher(effective["business"])
+
+	_, sources := currentPackSelection()
+	set.sourceBusiness = make(map[string]businessMatcher, len(sources))
+	for source, packs := range sources {
+		business := patternList{Name: "business", severities: packPatterns(packs)}
+		matcher, levels := newPatternMatcher(effectivePatterns(business, overrides))
+		set.sourceBusiness[source] = businessMatcher{matcher: matcher, levels: levels}
+	}
+	return set
+}
+
+// findPatternList returns a list by name
+func findPatternList(name string) (patternList, bool) {
+	for _, list := range patternLists {
+		if list.Name == name {
+			return list, true
+		}
+	}
+	return patternList{}, false
+}
+
+// isBuiltinPattern reports whether a pattern ships with the binary
+func (list patternList) isBuiltinPattern(pattern string) bool {
+	if list.severities != nil {
+		_, ok := list.severities[pattern]
+		return ok
+	}
+	return containsString(list.keywords, pattern)
+}
+
+// canonicalPattern returns the spelling a list already uses for a pattern
+// (matching is case-insensitive, so "econnrefused" is "ECONNREFUSED")
+func canonicalPattern(list patternList, overrides []patternOverride, pattern string) string {
+	for existing := range effectivePatterns(list, nil) {
+		if strings.EqualFold(existing, pattern) {
+			return existing
+		}
+	}
+	for _, o := range overrides {
+		if o.List == list.Name && strings.EqualFold(o.Pattern, pattern) {
+			return o.Pattern
+		}
+	}
+	return pattern
+}
+
+// patternEntry is one effective pattern as listed by the API
+type patternEntry struct {
+	Pattern  string `json:"pattern"`
+	Severity string `json:"severity,omitempty"`
+	Builtin  bool   `json:"builtin"`
+}
+
+// patternListView is a list as shown by the API
+type patternListView struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Kind        string         `json:"kind"` // keywords or severities
+	Patterns    []patternEntry `json:"patterns"`
+	Removed     []string       `json:"removed"` // built-ins switched off
+}
+
+// viewPatternList lists the effective patterns of a list
+func viewPatternList(list patternList, overrides []patternOverride) patternListView {
+	view := patternListView{Name: list.Name, Description: list.Description, Kind: "keywords", Patterns: []patternEntry{}, Removed: []string{}}
+	if list.severities != nil {
+		view.Kind = "severities"
+	}
+	for pattern, severity := range effectivePatterns(list, overrides) {
+		view.Patterns = append(view.Patterns, patternEntry{Pattern: pattern, Severity: severity, Builtin: list.isBuiltinPattern(pattern)})
+	}
+	sort.Slice(view.Patterns, func(i, j int) bool { return view.Patterns[i].Pattern < view.Patterns[j].Pattern })
+	for _, o := range overrides {
+		if o.List == list.Name && o.Removed {
+			view.Removed = append(view.Removed, o.Pattern)
+		}
+	}
+	return view
+}
+
+// validatePattern checks a new pattern for a list
+func validatePattern(list patternList, pattern, severity string) (string, string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if len(pattern) < 2 || len(pattern) > 200 {
+		return "", "", fmt.Errorf("pattern must be 2-200 characters")
+	}
+	if list.severities == nil {
+		if severity != "" {
+			return "", "", fmt.Errorf("'%s' is a keyword list, severity is not used", list.Name)
+		}
+		return pattern, "", nil
+	}
+	if list.Name == "http_status" && !httpStatusCodePattern.MatchString(pattern) {
+		return "", "", fmt.Errorf("http_status patterns are 3-digit status codes")
+	}
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if !containsString(patternSeverities, severity) {
+		return "", "", fmt.Errorf("severity must be one of %s", strings.Join(patternSeverities, ", "))
+	}
+	return pattern, severity, nil
+}
+
+// savePatternOverride stores one change and recompiles. A change that undoes
+// an earlier one (adding back a built-in as shipped, removing a custom
+// pattern) only deletes the stored row.
+func savePatternOverride(list patternList, o patternOverride) error {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	if _, err := db.Exec(db.Rebind("DELETE FROM pattern_overrides WHERE list = ? AND LOWER(pattern) = LOWER(?)"), o.List, o.Pattern); err != nil {
+		return err
+	}
+	builtin := list.isBuiltinPattern(o.Pattern)
+	restoresBuiltin := !o.Removed && builtin && list.severities[o.Pattern] == o.Severity
+	dropsCustom := o.Removed && !builtin
+	if !restoresBuiltin && !dropsCustom {
+		if _, err := db.Exec(db.Rebind("INSERT INTO pattern_overrides (list, pattern, severity, removed, created_at) VALUES (?, ?, ?, ?, ?)"),
+			o.List, o.Pattern, o.Severity, o.Removed, dbTime(o.CreatedAt)); err != nil {
+			return err
+		}
+	}
+	overrides, err := loadPatternOverrides()
+	if err != nil {
+		return err
+	}
+	activePatterns.Store(compilePatterns(overrides))
+	return nil
+}
+
+// handlePatterns answers GET /api/patterns
+func handlePatterns(w http.ResponseWriter, r *http.Request) {
+	overrides, err := loadPatternOverrides()
+	if err != nil {
+		http.Error(w, "Failed to load patterns", http.StatusInternalServerError)
+		return
+	}
+	views := []patternListView{}
+	for _, list := range patternLists {
+		views = append(views, viewPatternList(list, overrides))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"lists": views})
+}
+
+// handlePatternList answers GET, POST and DELETE /api/patterns/{list}
+func handlePatternList(w http.ResponseWriter, r *http.Request) {
+	list, ok := findPatternList(strings.TrimPrefix(r.URL.Path, "/api/patterns/"))
+	if !ok {
+		http.Error(w, "Unknown pattern list", http.StatusNotFound)
+		return
+	}
+
+	overrides, err := loadPatternOverrides()
+	if err != nil {
+		http.Error(w, "Failed to load patterns", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var request struct {
+			Pattern  string `json:"pattern"`
+			Severity string `json:"severity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		pattern, severity, err := validatePattern(list, request.Pattern, request.Severity)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pattern = canonicalPattern(list, overrides, pattern)
+		if err := savePatternOverride(list, patternOverride{List: list.Name, Pattern: pattern, Severity: severity, CreatedAt: time.Now()}); err != nil {
+			http.Error(w, "Failed to save pattern", http.StatusInternalServerError)
+			return
+		}
+		recordConfigChange(configActor(r), "patterns."+list.Name, nil, map[string]string{"pattern": pattern, "severity": severity})
+		status = http.StatusCreated
+	case http.MethodDelete:
+		pattern := canonicalPattern(list, overrides, strings.TrimSpace(r.URL.Query().Get("pattern")))
+		if _, found := effectivePatterns(list, overrides)[pattern]; !found {
+			http.Error(w, "Pattern not found", http.StatusNotFound)
+			return
+		}
+		if err := savePatternOverride(list, patternOverride{List: list.Name, Pattern: pattern, Removed: true, CreatedAt: time.Now()}); err != nil {
+			http.Error(w, "Failed to remove pattern", http.StatusInternalServerError)
+			return
+		}
+		recordConfigChange(configActor(r), "patterns."+list.Name, map[string]string{"pattern": pattern, "severity": effectivePatterns(list, overrides)[pattern]}, nil)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if overrides, err = loadPatternOverrides(); err != nil {
+		http.Error(w, "Failed to load patterns", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(viewPatternList(list, overrides))
+}
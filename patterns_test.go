@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPatternManagement tests adding and removing detection patterns at runtime
+func TestPatternManagement(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer activePatterns.Store(nil)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlePatternList(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if severity := detectBusinessLogic("", "card declined for order 7"); severity != "" {
+		t.Fatalf("Expected no business match before adding the pattern, got %s", severity)
+	}
+	if w := request("POST", "/api/patterns/business", `{"pattern":"Card Declined","severity":"error"}`); w.Code != 201 {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if severity := detectBusinessLogic("", "card declined for order 7"); severity != "error" {
+		t.Errorf("Expected the new business pattern to match as error, got %q", severity)
+	}
+
+	// Built-ins are removed case-insensitively and come back when added again
+	if w := request("DELETE", "/api/patterns/system_errors?pattern=enoent", ""); w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if severity := detectSystemError("open config.yml: ENOENT"); severity != "" {
+		t.Errorf("Expected removed ENOENT to no longer match, got %q", severity)
+	}
+	w := request("POST", "/api/patterns/system_errors", `{"pattern":"enoent","severity":"warning"}`)
+	var view patternListView
+	json.NewDecoder(w.Body).Decode(&view)
+	if w.Code != 201 || len(view.Removed) != 0 || detectSystemError("open config.yml: ENOENT") != "warning" {
+		t.Errorf("Expected ENOENT to be restored as a built-in, got %d %+v", w.Code, view.Removed)
+	}
+	var stored int
+	db.QueryRow("SELECT COUNT(*) FROM pattern_overrides WHERE list = 'system_errors'").Scan(&stored)
+	if stored != 0 {
+		t.Errorf("Expected restoring a built-in to leave no override, got %d", stored)
+	}
+
+	for path, body := range map[string]string{
+		"/api/patterns/http_status": `{"pattern":"5xx","severity":"error"}`,
+		"/api/patterns/error":       `{"pattern":"boom","severity":"error"}`,
+		"/api/patterns/database":    `{"pattern":"replica lag","severity":"loud"}`,
+	} {
+		if w := request("POST", path, body); w.Code != 400 {
+			t.Errorf("Expected status 400 for %s %s, got %d", path, body, w.Code)
+		}
+	}
+	if w := request("GET", "/api/patterns/colors", ""); w.Code != 404 {
+		t.Errorf("Expected status 404 for an unknown list, got %d", w.Code)
+	}
+
+	// Changes survive a reload, as on restart
+	activePatterns.Store(nil)
+	if err := loadPatterns(); err != nil {
+		t.Fatalf("Failed to load patterns: %v", err)
+	}
+	if severity := detectBusinessLogic("", "Card declined"); severity != "error" {
+		t.Errorf("Expected the stored pattern after reload, got %q", severity)
+	}
+	w = httptest.NewRecorder()
+	handlePatterns(w, httptest.NewRequest("GET", "/api/patterns", nil))
+	var all struct {
+		Lists []patternListView `json:"lists"`
+	}
+	json.NewDecoder(w.Body).Decode(&all)
+	if len(all.Lists) != len(patternLists) {
+		t.Errorf("Expected %d lists, got %d", len(patternLists), len(all.Lists))
+	}
+}
@@ -0,0 +1,135 @@
+// CubicLog Performance Thresholds - What counts as slow depends on the source
+//
+// Logs that mention a duration ("took 350ms", "duration: 2.5s") and have
+// nothing more definite to go by (status code, stack trace, keywords of the
+// pattern packs, ...) get their severity from it:
+//
+//	duration >= critical   critical
+//	duration >= slow       warning
+//	duration >= normal     info
+//	below normal           success
+//
+// The built-in thresholds are 100/1000/3000/5000 ms (fast/normal/slow/critical).
+// A 2-second batch job is fine where a 2-second API call is not, so they can be
+// changed globally and per source with -performance-file:
+//
+//	{
+//	  "default": {"slow": 2000, "critical": 4000},
+//	  "sources": {
+//	    "api-gateway":   {"normal": 200, "slow": 500, "critical": 1500},
+//	    "nightly-batch": {"normal": 60000, "slow": 600000, "critical": 1800000}
+//	  }
+//	}
+//
+// Sources are matched on the derived source; thresholds left out come from
+// "default", then from the built-in ones, and must not decrease from fast to
+// critical. The severity feeds everything downstream (escalation rules and
+// their alerts, SLOs, error groups), and /api/latency counts fast and slow logs
+// per source with that source's thresholds (see latency.go).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// performanceLimits are the duration thresholds of a source in milliseconds (0 = inherited)
+type performanceLimits struct {
+	Fast     int `json:"fast"`
+	Normal   int `json:"normal"`
+	Slow     int `json:"slow"`
+	Critical int `json:"critical"`
+}
+
+// performanceConfig is the content of the -performance-file
+type performanceConfig struct {
+	Default performanceLimits            `json:"default"`
+	Sources map[string]performanceLimits `json:"sources"`
+}
+
+// performanceSettings is the loaded -performance-file - configured once in main()
+var performanceSettings performanceConfig
+
+// overlay replaces the thresholds other sets
+func (l performanceLimits) overlay(other performanceLimits) performanceLimits {
+	if other.Fast > 0 {
+		l.Fast = other.Fast
+	}
+	if other.Normal > 0 {
+		l.Normal = other.Normal
+	}
+	if other.Slow > 0 {
+		l.Slow = other.Slow
+	}
+	if other.Critical > 0 {
+		l.Critical = other.Critical
+	}
+	return l
+}
+
+// validate checks that the thresholds don't decrease
+func (l performanceLimits) validate() error {
+	if l.Fast < 0 || l.Normal < 0 || l.Slow < 0 || l.Critical < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if l.Fast > l.Normal || l.Normal > l.Slow || l.Slow > l.Critical {
+		return fmt.Errorf("thresholds must grow from fast to critical, got %d/%d/%d/%d ms", l.Fast, l.Normal, l.Slow, l.Critical)
+	}
+	return nil
+}
+
+// performanceLimitsFor returns the thresholds in effect for a derived source
+func performanceLimitsFor(source string) performanceLimits {
+	limits := performanceLimits{
+		Fast:     performanceThresholds["fast"],
+		Normal:   performanceThresholds["normal"],
+		Slow:     performanceThresholds["slow"],
+		Critical: performanceThresholds["critical"],
+	}
+	return limits.overlay(performanceSettings.Default).overlay(performanceSettings.Sources[source])
+}
+
+// durationSeverity derives the severity of a log mentioning a duration
+func durationSeverity(source string, duration int) string {
+	limits := performanceLimitsFor(source)
+	switch {
+	case duration >= limits.Critical:
+		return "critical"
+	case duration >= limits.Slow:
+		return "warning"
+	case duration >= limits.Normal:
+		return "info"
+	default:
+		return "success"
+	}
+}
+
+// loadPerformanceThresholds reads and validates the performance file ("" for the built-in thresholds)
+func loadPerformanceThresholds(path string) error {
+	performanceSettings = performanceConfig{}
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read performance file: %v", err)
+	}
+	var config performanceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid performance file: %v", err)
+	}
+
+	performanceSettings = config
+	if err := performanceLimitsFor("").validate(); err != nil {
+		performanceSettings = performanceConfig{}
+		return fmt.Errorf("default: %v", err)
+	}
+	for name := range config.Sources {
+		if err := performanceLimitsFor(name).validate(); err != nil {
+			performanceSettings = performanceConfig{}
+			return fmt.Errorf("source '%s': %v", name, err)
+		}
+	}
+	return nil
+}
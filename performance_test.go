@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPerformanceThresholds tests rating durations with global and per-source thresholds
+func TestPerformanceThresholds(t *testing.T) {
+	defer loadPerformanceThresholds("")
+
+	severity := func(source string) string {
+		return deriveMetadata(LogHeader{Title: "Request took 2s", Source: source}, nil).DerivedSeverity
+	}
+	if got := severity("checkout"); got != "info" {
+		t.Errorf("Expected the built-in thresholds to rate 2s as info, got %s", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "performance.json")
+	os.WriteFile(path, []byte(`{"default": {"slow": 2000, "critical": 4000}, "sources": {
+		"api-gateway": {"normal": 200, "slow": 500, "critical": 1500},
+		"nightly-batch": {"normal": 60000, "slow": 600000, "critical": 1800000}}}`), 0644)
+	if err := loadPerformanceThresholds(path); err != nil {
+		t.Fatalf("Failed to load thresholds: %v", err)
+	}
+	for source, expected := range map[string]string{"checkout": "warning", "api-gateway": "critical", "nightly-batch": "success"} {
+		if got := severity(source); got != expected {
+			t.Errorf("Expected 2s from %s rated %s, got %s", source, expected, got)
+		}
+	}
+	if limits := performanceLimitsFor("nightly-batch"); limits.Fast != 100 || limits.Slow != 600000 {
+		t.Errorf("Expected unset thresholds inherited, got %+v", limits)
+	}
+
+	os.WriteFile(path, []byte(`{"sources": {"api-gateway": {"slow": 9000}}}`), 0644)
+	if err := loadPerformanceThresholds(path); err == nil || !strings.Contains(err.Error(), "api-gateway") {
+		t.Errorf("Expected an error for a slow threshold above critical, got %v", err)
+	}
+	if got := severity("api-gateway"); got != "info" {
+		t.Errorf("Expected the built-in thresholds after a failed load, got %s", got)
+	}
+}
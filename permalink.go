@@ -0,0 +1,72 @@
+// CubicLog Permalinks - Links that open the dashboard on a log or a search
+//
+//   - /logs/{id}                                 the dashboard showing one log, expanded
+//   - /search?query=timeout&type=error&date=2024-01-31   the dashboard with these filters
+//
+// Both serve the regular dashboard with the requested view injected as
+// window.CUBICLOG_FOCUS, so links in alert notifications and chat messages
+// lead straight to the evidence. The dashboard keeps the address bar in sync
+// with its filters, so any view can be shared by copying the URL. Like the
+// dashboard itself these pages contain no log data; it is loaded through the
+// API as usual.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// datePattern matches the dashboard's date filter format
+var datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// handleLogPermalink serves /logs/{id}
+func handleLogPermalink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/logs/"))
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	serveDashboardFocused(w, map[string]interface{}{"log_id": id})
+}
+
+// handleSearchPermalink serves /search
+func handleSearchPermalink(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	focus := map[string]interface{}{}
+	if query := params.Get("query"); query != "" {
+		focus["query"] = query
+	} else if query := params.Get("q"); query != "" {
+		focus["query"] = query
+	}
+	if logType := params.Get("type"); logType != "" {
+		focus["type"] = logType
+	}
+	if environment, err := normalizeEnvironment(params.Get("environment")); err == nil && environment != "" {
+		focus["environment"] = environment
+	}
+	if date := params.Get("date"); datePattern.MatchString(date) {
+		focus["date"] = date
+	}
+	serveDashboardFocused(w, focus)
+}
+
+// serveDashboardFocused serves the dashboard with an initial view
+func serveDashboardFocused(w http.ResponseWriter, focus map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Write([]byte(dashboardWithFocus(webUI, focus)))
+}
+
+// dashboardWithFocus injects the initial view into the dashboard HTML
+func dashboardWithFocus(page string, focus map[string]interface{}) string {
+	// json.Marshal escapes <, > and &, so values can't close the script tag
+	encoded, _ := json.Marshal(focus)
+	script := "<script>window.CUBICLOG_FOCUS = " + string(encoded) + ";</script>\n"
+	if index := strings.Index(page, "</head>"); index >= 0 {
+		return page[:index] + script + page[index:]
+	}
+	return script + page
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPermalinks tests that permalink routes open the dashboard on a log or search
+func TestPermalinks(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	handleLogPermalink(w, httptest.NewRequest("GET", "/logs/42", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `window.CUBICLOG_FOCUS = {"log_id":42};</script>`) {
+		t.Errorf("Expected dashboard focused on log 42, got %d", w.Code)
+	}
+	for _, path := range []string{"/logs/abc", "/logs/-1", "/logs/"} {
+		w = httptest.NewRecorder()
+		handleLogPermalink(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", path, w.Code)
+		}
+	}
+
+	// Search values are JSON-encoded so they can't break out of the script tag
+	w = httptest.NewRecorder()
+	handleSearchPermalink(w, httptest.NewRequest("GET", "/search?query=%3C/script%3Etimeout&type=error&date=2024-01-31", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `"query":"\u003c/script\u003etimeout"`) || !strings.Contains(body, `"type":"error"`) || !strings.Contains(body, `"date":"2024-01-31"`) {
+		t.Errorf("Expected encoded search focus, got %s", body[strings.Index(body, "CUBICLOG_FOCUS"):strings.Index(body, "CUBICLOG_FOCUS")+120])
+	}
+
+	// The dashboard loads a focused log through the id filter
+	for _, title := range []string{"first", "second"} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"title":"`+title+`"}}`)))
+	}
+	w = httptest.NewRecorder()
+	handleLogs(w, httptest.NewRequest("GET", "/api/logs?id=2", nil))
+	var logs []Log
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 1 || logs[0].Header.Title != "second" {
+		t.Errorf("Expected only log 2, got %+v", logs)
+	}
+	w = httptest.NewRecorder()
+	handleLogs(w, httptest.NewRequest("GET", "/api/logs?id=x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid id, got %d", w.Code)
+	}
+}
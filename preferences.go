@@ -0,0 +1,190 @@
+// CubicLog Preferences - Dashboard settings that follow you between browsers
+//
+//   - GET    /api/preferences   the caller's preferences (defaults if none saved)
+//   - PUT    /api/preferences   replace them (fields left out get their default):
+//     {"theme": "light", "page_size": 25,
+//     "default_filters": {"query": "payments", "type": "error"},
+//     "pinned_sources": ["checkout"], "collapsed_cards": ["patterns"],
+//     "palette": "colorblind", "language": "es"}
+//   - DELETE /api/preferences   back to the defaults
+//
+// Preferences belong to the managed API key the request is authenticated with
+// (see apikeys.go) and survive its rotation. Requests with the -api-key flag
+// or without authentication share one "default" profile, which is what a
+// single-user instance wants. The dashboard still keeps a copy in
+// localStorage so it starts without waiting for the server.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// uiPreferences are the dashboard settings stored per user
+type uiPreferences struct {
+	Theme          string     `json:"theme"`     // dark or light
+	PageSize       int        `json:"page_size"` // logs per page
+	DefaultFilters uiFilters  `json:"default_filters"`
+	PinnedSources  []string   `json:"pinned_sources"`
+	CollapsedCards []string   `json:"collapsed_cards"`
+	Palette        string     `json:"palette,omitempty"`  // "" follows -palette (see palettes.go)
+	Language       string     `json:"language,omitempty"` // "" follows -locale (see i18n.go)
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// uiFilters are the log list filters applied when the dashboard opens
+type uiFilters struct {
+	Query string `json:"query,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// defaultPreferences returns the settings used until a user saves their own
+func defaultPreferences() uiPreferences {
+	return uiPreferences{Theme: "dark", PageSize: 10, PinnedSources: []string{}, CollapsedCards: []string{"distribution"}}
+}
+
+// Accepted preference values
+var (
+	preferenceThemes    = []string{"dark", "light"}
+	preferencePageSizes = []int{10, 25, 50}
+	preferenceCards     = []string{"patterns", "security", "sources", "distribution"}
+)
+
+// maxPinnedSources caps the pinned source list
+const maxPinnedSources = 20
+
+// createPreferencesTable creates the preference table
+func createPreferencesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS ui_preferences (
+		owner       TEXT PRIMARY KEY,
+		preferences TEXT NOT NULL,
+		updated_at  TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// preferenceOwner names the profile a request reads and writes
+func preferenceOwner(r *http.Request) string {
+	if id := managedKeyID(requestAPIKey(r)); id != "" {
+		return "key:" + id
+	}
+	return "default"
+}
+
+// loadPreferences returns the saved preferences of an owner, or the defaults
+func loadPreferences(owner string) (uiPreferences, error) {
+	var data string
+	var updatedAt time.Time
+	err := db.QueryRow(db.Rebind("SELECT preferences, updated_at FROM ui_preferences WHERE owner = ?"), owner).Scan(&data, (*scanTime)(&updatedAt))
+	if err == sql.ErrNoRows {
+		return defaultPreferences(), nil
+	}
+	if err != nil {
+		return uiPreferences{}, err
+	}
+	prefs := defaultPreferences()
+	if err := json.Unmarshal([]byte(data), &prefs); err != nil {
+		return uiPreferences{}, err
+	}
+	prefs.UpdatedAt = &updatedAt
+	return prefs, nil
+}
+
+// savePreferences stores the preferences of an owner
+func savePreferences(owner string, prefs uiPreferences) error {
+	prefs.UpdatedAt = nil
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	now := dbTime(time.Now())
+	result, err := db.Exec(db.Rebind("UPDATE ui_preferences SET preferences = ?, updated_at = ? WHERE owner = ?"), string(data), now, owner)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+	_, err = db.Exec(db.Rebind("INSERT INTO ui_preferences (owner, preferences, updated_at) VALUES (?, ?, ?)"), owner, string(data), now)
+	return err
+}
+
+// validatePreferences checks a submitted preference set
+func validatePreferences(prefs uiPreferences) error {
+	if !containsString(preferenceThemes, prefs.Theme) {
+		return fmt.Errorf("theme must be dark or light")
+	}
+	validSize := false
+	for _, size := range preferencePageSizes {
+		validSize = validSize || prefs.PageSize == size
+	}
+	if !validSize {
+		return fmt.Errorf("page_size must be 10, 25 or 50")
+	}
+	if len(prefs.DefaultFilters.Query) > 200 || len(prefs.DefaultFilters.Type) > 50 {
+		return fmt.Errorf("default_filters are too long")
+	}
+	if len(prefs.PinnedSources) > maxPinnedSources {
+		return fmt.Errorf("at most %d pinned_sources", maxPinnedSources)
+	}
+	for _, source := range prefs.PinnedSources {
+		if source == "" || len(source) > 100 {
+			return fmt.Errorf("pinned source names must be 1-100 characters")
+		}
+	}
+	for _, card := range prefs.CollapsedCards {
+		if !containsString(preferenceCards, card) {
+			return fmt.Errorf("unknown card '%s' in collapsed_cards", card)
+		}
+	}
+	if _, ok := findPalette(uiPalettes, prefs.Palette); prefs.Palette != "" && !ok {
+		return fmt.Errorf("unknown palette '%s'", prefs.Palette)
+	}
+	if _, ok := languagePacks[prefs.Language]; prefs.Language != "" && !ok {
+		return fmt.Errorf("unknown language '%s'", prefs.Language)
+	}
+	return nil
+}
+
+// handlePreferences answers GET, PUT and DELETE /api/preferences
+func handlePreferences(w http.ResponseWriter, r *http.Request) {
+	owner := preferenceOwner(r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		prefs := defaultPreferences()
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := validatePreferences(prefs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := savePreferences(owner, prefs); err != nil {
+			http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if _, err := db.Exec(db.Rebind("DELETE FROM ui_preferences WHERE owner = ?"), owner); err != nil {
+			http.Error(w, "Failed to reset preferences", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefs, err := loadPreferences(owner)
+	if err != nil {
+		http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
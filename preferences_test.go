@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPreferences tests saving dashboard preferences per API key
+func TestPreferences(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { keyring.keys = nil }()
+
+	_, secret, err := createAPIKey("alice", "")
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	request := func(method, key, body string) (int, uiPreferences) {
+		req := httptest.NewRequest(method, "/api/preferences", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		handlePreferences(w, req)
+		var prefs uiPreferences
+		json.NewDecoder(w.Body).Decode(&prefs)
+		return w.Code, prefs
+	}
+
+	code, prefs := request("PUT", secret, `{"theme": "light", "page_size": 25, "default_filters": {"type": "error"}, "pinned_sources": ["checkout"]}`)
+	if code != 200 || prefs.Theme != "light" || prefs.PageSize != 25 || prefs.UpdatedAt == nil {
+		t.Fatalf("Expected the saved preferences, got %d %+v", code, prefs)
+	}
+	if len(prefs.CollapsedCards) != 1 || prefs.CollapsedCards[0] != "distribution" {
+		t.Errorf("Expected left out fields to keep their default, got %v", prefs.CollapsedCards)
+	}
+
+	_, prefs = request("GET", secret, "")
+	if prefs.DefaultFilters.Type != "error" || len(prefs.PinnedSources) != 1 || prefs.PinnedSources[0] != "checkout" {
+		t.Errorf("Expected the key's preferences, got %+v", prefs)
+	}
+	if _, shared := request("GET", "", ""); shared.Theme != "dark" || shared.UpdatedAt != nil {
+		t.Errorf("Expected the default profile to be untouched, got %+v", shared)
+	}
+
+	if code, _ := request("PUT", secret, `{"theme": "neon"}`); code != 400 {
+		t.Errorf("Expected status 400 for an unknown theme, got %d", code)
+	}
+	if code, _ := request("PUT", secret, `{"collapsed_cards": ["sidebar"]}`); code != 400 {
+		t.Errorf("Expected status 400 for an unknown card, got %d", code)
+	}
+
+	if _, prefs = request("DELETE", secret, ""); prefs.Theme != "dark" || prefs.UpdatedAt != nil {
+		t.Errorf("Expected the defaults after a reset, got %+v", prefs)
+	}
+}
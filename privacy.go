@@ -0,0 +1,509 @@
+// CubicLog Privacy - Right-to-be-forgotten erasure by data subject
+//
+//	curl -X POST -H "Authorization: Bearer $API_KEY" http://localhost:8080/api/privacy/erase \
+//	  -d '{"subjects": ["user-4711", "jane@example.com"], "mode": "delete"}'
+//
+// Finds every log whose title, description or body contains one of the
+// subjects (case-insensitive, including encrypted columns and monthly
+// partitions) and then:
+//   - mode "delete" (default)  removes the logs
+//   - mode "redact"            replaces each occurrence with [REDACTED] and keeps
+//     the rest of the log; JSON bodies stay valid JSON
+//   - "dry_run": true          only reports what would be erased
+//
+// Log content copied elsewhere is redacted as well, in both modes: error group
+// titles, alert titles and messages, and the payloads of webhook deliveries
+// (counted per table under "copies").
+//
+// The response is an erasure report listing the affected log ids, signed with
+// the instance's signing key (see signing.go). Subjects appear in the report
+// only as SHA-256 hashes, so the report itself holds no personal data. POST a
+// report to /api/privacy/verify to check its signature. SQLite's secure_delete
+// is switched on while erasing so removed content is overwritten on disk.
+//
+// Not covered: logs still waiting in the spool (the report says so), logs
+// under a legal hold (listed in held_log_ids, see holds.go), replicas and
+// backups made before the erasure.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// redactedText replaces erased subjects in redact mode
+const redactedText = "[REDACTED]"
+
+// minSubjectLength keeps a short subject from matching most logs
+const minSubjectLength = 3
+
+// erasureRequest is the body of POST /api/privacy/erase
+type erasureRequest struct {
+	Subject  string   `json:"subject"`
+	Subjects []string `json:"subjects"`
+	Mode     string   `json:"mode"`
+	DryRun   bool     `json:"dry_run"`
+}
+
+// erasureReport documents an erasure; Signature covers all other fields
+type erasureReport struct {
+	ID            string         `json:"id"`
+	Mode          string         `json:"mode"`
+	DryRun        bool           `json:"dry_run"`
+	SubjectHashes []string       `json:"subject_sha256"`
+	RequestedAt   string         `json:"requested_at"`
+	CompletedAt   string         `json:"completed_at"`
+	Matched       int            `json:"matched"`
+	Erased        int            `json:"erased"`
+	LogIDs        []int          `json:"log_ids"`
+	HeldLogIDs    []int          `json:"held_log_ids,omitempty"` // matches kept by a legal hold
+	Copies        map[string]int `json:"copies,omitempty"`       // redacted rows per table copying log content
+	Notes         []string       `json:"notes,omitempty"`
+	Signature     string         `json:"signature,omitempty"`
+}
+
+// erasureMatch is a log containing a subject, with its redacted columns
+type erasureMatch struct {
+	id                       int
+	title, description, body string
+}
+
+// subjectMatcher finds subjects in text
+type subjectMatcher struct {
+	subjects []string
+	pattern  *regexp.Regexp
+}
+
+func newSubjectMatcher(subjects []string) *subjectMatcher {
+	quoted := make([]string, len(subjects))
+	for i, subject := range subjects {
+		quoted[i] = regexp.QuoteMeta(subject)
+	}
+	return &subjectMatcher{subjects: subjects, pattern: regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))}
+}
+
+func (m *subjectMatcher) matches(text string) bool {
+	return text != "" && m.pattern.MatchString(text)
+}
+
+func (m *subjectMatcher) redact(text string) string {
+	return m.pattern.ReplaceAllString(text, redactedText)
+}
+
+// redactBody redacts a JSON body value by value, so the result stays valid
+// JSON even when a subject is a number; other bodies are redacted as text
+func (m *subjectMatcher) redactBody(body string) string {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return m.redact(body)
+	}
+	encoded, err := json.Marshal(m.redactValue(value))
+	if err != nil {
+		return m.redact(body)
+	}
+	return string(encoded)
+}
+
+func (m *subjectMatcher) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return m.redact(v)
+	case json.Number:
+		if m.matches(v.String()) {
+			return redactedText
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = m.redactValue(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[m.redact(key)] = m.redactValue(item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// parseErasureRequest validates the request body
+func parseErasureRequest(r *http.Request) (erasureRequest, error) {
+	var request erasureRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if request.Subject != "" {
+		request.Subjects = append(request.Subjects, request.Subject)
+	}
+
+	var subjects []string
+	for _, subject := range request.Subjects {
+		subject = strings.TrimSpace(subject)
+		if len(subject) < minSubjectLength {
+			return request, fmt.Errorf("subject '%s' is too short - use at least %d characters", subject, minSubjectLength)
+		}
+		if !containsString(subjects, subject) {
+			subjects = append(subjects, subject)
+		}
+	}
+	if len(subjects) == 0 {
+		return request, fmt.Errorf("no subject given")
+	}
+	request.Subjects = subjects
+
+	if request.Mode == "" {
+		request.Mode = "delete"
+	}
+	if request.Mode != "delete" && request.Mode != "redact" {
+		return request, fmt.Errorf("invalid mode '%s' - use delete or redact", request.Mode)
+	}
+	return request, nil
+}
+
+// eraseSubjects erases the subjects from the main database and all partitions
+func eraseSubjects(request erasureRequest) (erasureReport, error) {
+	report := erasureReport{
+		ID:          newErasureID(),
+		Mode:        request.Mode,
+		DryRun:      request.DryRun,
+		RequestedAt: time.Now().UTC().Format(time.RFC3339),
+		LogIDs:      []int{},
+	}
+	for _, subject := range request.Subjects {
+		sum := sha256.Sum256([]byte(strings.ToLower(subject)))
+		report.SubjectHashes = append(report.SubjectHashes, hex.EncodeToString(sum[:]))
+	}
+	matcher := newSubjectMatcher(request.Subjects)
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer conn.Close()
+
+	// Overwrite deleted content on disk instead of leaving it in free pages
+	if db.Driver() == "sqlite3" && !request.DryRun {
+		var previous int
+		conn.QueryRowContext(ctx, "PRAGMA secure_delete").Scan(&previous)
+		conn.ExecContext(ctx, "PRAGMA secure_delete = ON")
+		defer conn.ExecContext(ctx, fmt.Sprintf("PRAGMA secure_delete = %d", previous))
+	}
+
+	if err := eraseFromTable(ctx, conn, "logs", matcher, request, &report); err != nil {
+		return report, err
+	}
+	if partitionMode {
+		for _, month := range listPartitions() {
+			if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS erasure", partitionPath(month)); err != nil {
+				return report, fmt.Errorf("could not open partition %s: %v", month, err)
+			}
+			err := eraseFromTable(ctx, conn, "erasure.logs", matcher, request, &report)
+			conn.ExecContext(ctx, "DETACH DATABASE erasure")
+			if err != nil {
+				return report, fmt.Errorf("partition %s: %v", month, err)
+			}
+		}
+	}
+
+	if err := eraseCopies(ctx, conn, matcher, request, &report); err != nil {
+		return report, err
+	}
+
+	if len(report.HeldLogIDs) > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("%d matching logs are under a legal hold and were kept - erase them again once the hold is released", len(report.HeldLogIDs)))
+	}
+	if _, _, pending := breaker.status(); pending > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("%d logs were waiting in the spool and not searched - run the erasure again once they are stored", pending))
+	}
+	if !request.DryRun && report.Erased > 0 {
+		// Redacted logs keep their id and count, so the ETags must change another way
+		bulkGeneration.Add(1)
+		invalidateHourlyStats()
+	}
+	report.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	return report, nil
+}
+
+// eraseFromTable finds and erases matching logs in one logs table
+func eraseFromTable(ctx context.Context, conn *sql.Conn, table string, matcher *subjectMatcher, request erasureRequest, report *erasureReport) error {
+	// Narrow down in SQL; encrypted rows can only be checked once opened
+	var conditions []string
+	var args []interface{}
+	for _, subject := range matcher.subjects {
+		if !isASCII(subject) {
+			// SQL LOWER() only folds ASCII, so check every row in Go
+			conditions, args = []string{"1 = 1"}, nil
+			break
+		}
+		pattern := "%" + escapeLike(strings.ToLower(subject)) + "%"
+		for _, column := range []string{"title", "description", "body"} {
+			conditions = append(conditions, "LOWER(COALESCE("+column+", '')) LIKE ? ESCAPE '\\'")
+			args = append(args, pattern)
+		}
+	}
+	conditions = append(conditions, "description LIKE '"+encryptedPrefix+"%'", "body LIKE '"+encryptedPrefix+"%'")
+
+	held, heldArgs := heldColumn()
+	query := "SELECT id, title, description, body, " + held + " FROM " + table + " WHERE " + strings.Join(conditions, " OR ")
+	rows, err := conn.QueryContext(ctx, db.Rebind(query), append(heldArgs, args...)...)
+	if err != nil {
+		return err
+	}
+	var matches []erasureMatch
+	for rows.Next() {
+		var id int
+		var title string
+		var description, body sql.NullString
+		var isHeld int
+		if err := rows.Scan(&id, &title, &description, &body, &isHeld); err != nil {
+			rows.Close()
+			return err
+		}
+		// A log that can't be decrypted might hold the subject, so don't report it as clean
+		plainDescription, err := decryptField(description.String)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("log %d in %s: %v", id, table, err)
+		}
+		plainBody, err := decryptField(body.String)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("log %d in %s: %v", id, table, err)
+		}
+		if !matcher.matches(title) && !matcher.matches(plainDescription) && !matcher.matches(plainBody) {
+			continue
+		}
+		if isHeld == 1 {
+			report.Matched++
+			report.HeldLogIDs = append(report.HeldLogIDs, id)
+			continue
+		}
+		matches = append(matches, erasureMatch{
+			id:          id,
+			title:       matcher.redact(title),
+			description: matcher.redact(plainDescription),
+			body:        matcher.redactBody(plainBody),
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	report.Matched += len(matches)
+	for _, match := range matches {
+		report.LogIDs = append(report.LogIDs, match.id)
+	}
+	if request.DryRun || len(matches) == 0 {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, match := range matches {
+		if request.Mode == "delete" {
+			_, err = tx.ExecContext(ctx, db.Rebind("DELETE FROM "+table+" WHERE id = ?"), match.id)
+		} else {
+			description, sealErr := sealField(match.description)
+			body, sealBodyErr := sealField(match.body)
+			if sealErr != nil || sealBodyErr != nil {
+				return fmt.Errorf("could not encrypt redacted log %d", match.id)
+			}
+			_, err = tx.ExecContext(ctx, db.Rebind("UPDATE "+table+" SET title = ?, description = ?, body = ? WHERE id = ?"),
+				match.title, description, body, match.id)
+		}
+		if err != nil {
+			return err
+		}
+		// Let hash chain verification tell erasures apart from tampering
+		if _, err := tx.ExecContext(ctx, db.Rebind("UPDATE log_chain SET erased_by = ? WHERE log_id = ?"), report.ID, match.id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	report.Erased += len(matches)
+	return nil
+}
+
+// erasureCopies are the columns outside the logs tables holding log content
+var erasureCopies = []struct {
+	table   string
+	columns []string
+}{
+	{"error_groups", []string{"title"}},      // title of the group's first log
+	{"alerts", []string{"title", "message"}}, // e.g. "First seen: <title>"
+	{"deliveries", []string{"payload"}},      // webhook bodies, kept for retries
+}
+
+// eraseCopies redacts the subjects in the columns listed in erasureCopies
+func eraseCopies(ctx context.Context, conn *sql.Conn, matcher *subjectMatcher, request erasureRequest, report *erasureReport) error {
+	type redaction struct {
+		id     int64
+		values []interface{}
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, copied := range erasureCopies {
+		rows, err := tx.QueryContext(ctx, "SELECT id, "+strings.Join(copied.columns, ", ")+" FROM "+copied.table)
+		if err != nil {
+			return err
+		}
+		var redactions []redaction
+		for rows.Next() {
+			var id int64
+			values := make([]sql.NullString, len(copied.columns))
+			dest := []interface{}{&id}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			matched := false
+			redacted := make([]interface{}, len(values))
+			for i, value := range values {
+				matched = matched || matcher.matches(value.String)
+				if copied.columns[i] == "payload" {
+					redacted[i] = matcher.redactBody(value.String)
+				} else {
+					redacted[i] = matcher.redact(value.String)
+				}
+			}
+			if matched {
+				redactions = append(redactions, redaction{id: id, values: redacted})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(redactions) == 0 {
+			continue
+		}
+		if report.Copies == nil {
+			report.Copies = map[string]int{}
+		}
+		report.Copies[copied.table] = len(redactions)
+		if request.DryRun {
+			continue
+		}
+		update := db.Rebind("UPDATE " + copied.table + " SET " + strings.Join(copied.columns, " = ?, ") + " = ? WHERE id = ?")
+		for _, r := range redactions {
+			if _, err := tx.ExecContext(ctx, update, append(r.values, r.id)...); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// isASCII reports whether value has only ASCII characters
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeLike escapes LIKE wildcards so a subject matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// newErasureID returns a random report id
+func newErasureID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return "erasure-" + hex.EncodeToString(id)
+}
+
+// signErasureReport signs the report with its Signature field empty
+func signErasureReport(report *erasureReport) error {
+	report.Signature = ""
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	report.Signature, err = signPayload(payload)
+	return err
+}
+
+// handlePrivacyErase answers POST /api/privacy/erase
+func handlePrivacyErase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	request, err := parseErasureRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := eraseSubjects(request)
+	if err != nil {
+		log.Printf("⚠️  Erasure %s failed: %v", report.ID, err)
+		http.Error(w, "Erasure failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := signErasureReport(&report); err != nil {
+		log.Printf("⚠️  Could not sign erasure report %s: %v", report.ID, err)
+		report.Notes = append(report.Notes, "report could not be signed: "+err.Error())
+	}
+	if !request.DryRun {
+		log.Printf("🧹 Erasure %s: %s %d logs for %d subjects", report.ID, request.Mode, report.Erased, len(request.Subjects))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handlePrivacyVerify answers POST /api/privacy/verify with a report as body
+func handlePrivacyVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var report erasureReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "Invalid report JSON", http.StatusBadRequest)
+		return
+	}
+
+	signature := report.Signature
+	report.Signature = ""
+	payload, _ := json.Marshal(report)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":    report.ID,
+		"valid": signature != "" && verifyPayload(payload, signature),
+	})
+}
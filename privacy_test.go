@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPrivacyErase tests dry runs, redaction, deletion and signed reports
+func TestPrivacyErase(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureSigning("", ":memory:", "sqlite3")
+	t.Setenv("CUBICLOG_SIGNING_KEY", "test-signing-key-0123456789")
+
+	for _, body := range []string{
+		`{"header":{"type":"info","title":"Login for Jane@Example.com"}}`,
+		`{"header":{"type":"info","title":"Order placed"},"body":{"customer":"jane@example.com","user_id":4711,"total":99}}`,
+		`{"header":{"type":"info","title":"Unrelated"},"body":{"user_id":42}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	erase := func(body string) (int, erasureReport) {
+		w := httptest.NewRecorder()
+		handlePrivacyErase(w, httptest.NewRequest("POST", "/api/privacy/erase", strings.NewReader(body)))
+		var report erasureReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	// Dry run: matches case-insensitively, changes nothing
+	_, report := erase(`{"subject":"jane@example.com","dry_run":true}`)
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if report.Matched != 2 || report.Erased != 0 || count != 3 {
+		t.Errorf("Expected 2 matches and nothing erased, got %d/%d with %d logs left", report.Matched, report.Erased, count)
+	}
+
+	// Redact a numeric id: the body stays valid JSON
+	listed := httptest.NewRecorder()
+	getLogs(listed, httptest.NewRequest("GET", "/api/logs", nil))
+	_, report = erase(`{"subjects":["4711"],"mode":"redact"}`)
+	var body string
+	db.QueryRow("SELECT body FROM logs WHERE title = 'Order placed'").Scan(&body)
+	var decoded map[string]interface{}
+	if report.Erased != 1 || json.Unmarshal([]byte(body), &decoded) != nil || decoded["user_id"] != redactedText || decoded["total"] != 99.0 {
+		t.Errorf("Expected user_id redacted in valid JSON, got %d erased and %s", report.Erased, body)
+	}
+
+	// A cached copy of the unredacted list is not confirmed with a 304
+	cached := httptest.NewRequest("GET", "/api/logs", nil)
+	cached.Header.Set("If-None-Match", listed.Header().Get("ETag"))
+	w := httptest.NewRecorder()
+	getLogs(w, cached)
+	if w.Code != 200 {
+		t.Errorf("Expected the redaction to change the ETag, got %d", w.Code)
+	}
+
+	// Delete, and the report carries hashes instead of the subject
+	_, report = erase(`{"subject":"JANE@example.com"}`)
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if report.Erased != 2 || count != 1 || strings.Contains(report.SubjectHashes[0], "jane") {
+		t.Errorf("Expected 2 logs deleted and 1 left, got %d erased and %d left", report.Erased, count)
+	}
+
+	// The signature verifies, and breaks when the report is altered
+	verify := func(report erasureReport) bool {
+		payload, _ := json.Marshal(report)
+		w := httptest.NewRecorder()
+		handlePrivacyVerify(w, httptest.NewRequest("POST", "/api/privacy/verify", strings.NewReader(string(payload))))
+		var result map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result["valid"] == true
+	}
+	if !verify(report) {
+		t.Errorf("Expected the erasure report signature to verify")
+	}
+	report.Erased = 0
+	if verify(report) {
+		t.Errorf("Expected a tampered report to fail verification")
+	}
+
+	if code, _ := erase(`{"subject":"ab"}`); code != 400 {
+		t.Errorf("Expected 400 for a too short subject, got %d", code)
+	}
+}
+
+// TestPrivacyEraseCopies tests that log content copied into groups, alerts and deliveries is redacted
+func TestPrivacyEraseCopies(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureSigning("", ":memory:", "sqlite3")
+	t.Setenv("CUBICLOG_SIGNING_KEY", "test-signing-key-0123456789")
+
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs",
+		strings.NewReader(`{"header":{"type":"error","title":"Payment failed for jane@example.com","source":"billing"}}`)))
+	db.Exec(db.Rebind("INSERT INTO alerts (rule, kind, severity, title, message, fired_at) VALUES ('new-error', 'new_error', 'error', 'New error in billing', ?, ?)"),
+		"First seen: Payment failed for jane@example.com", dbTime(time.Now()))
+	db.Exec(db.Rebind("INSERT INTO deliveries (kind, target, payload, status, created_at, last_attempt_at) VALUES ('alert', 'https://hooks.example', ?, 'delivered', ?, ?)"),
+		`{"message":"First seen: Payment failed for jane@example.com"}`, dbTime(time.Now()), dbTime(time.Now()))
+
+	w := httptest.NewRecorder()
+	handlePrivacyErase(w, httptest.NewRequest("POST", "/api/privacy/erase", strings.NewReader(`{"subject":"jane@example.com"}`)))
+	var report erasureReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.Erased != 1 || report.Copies["error_groups"] != 1 || report.Copies["alerts"] != 1 || report.Copies["deliveries"] != 1 {
+		t.Fatalf("Expected the log and 3 copies erased, got %+v", report)
+	}
+
+	var remaining int
+	db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM error_groups WHERE title LIKE '%jane%') +
+		(SELECT COUNT(*) FROM alerts WHERE message LIKE '%jane%') +
+		(SELECT COUNT(*) FROM deliveries WHERE payload LIKE '%jane%')`).Scan(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected no copies of the subject left, got %d", remaining)
+	}
+	var payload string
+	db.QueryRow("SELECT payload FROM deliveries").Scan(&payload)
+	if !json.Valid([]byte(payload)) {
+		t.Errorf("Expected the delivery payload to stay valid JSON, got %s", payload)
+	}
+}
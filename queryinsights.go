@@ -0,0 +1,254 @@
+// CubicLog Query Insights - Tune indexes for the searches people actually run
+//
+//	GET /api/admin/query-insights
+//
+// Every GET /api/logs query is counted by the set of filters it uses
+// ("severity+from", "q+source", ...), and queries slower than -slow-query
+// (default 250ms) are kept with their filters. The report lists the filter
+// combinations by slow queries, the most recent slow queries and suggestions:
+//
+//   - equality filters (type, color, source, severity) and sorts on a derived
+//     column get a composite index with timestamp, which serves both the
+//     filter and the newest-first ordering; suggestions for indexes that
+//     already exist are marked "exists"
+//   - q is a substring search over title, description and body that no index
+//     can serve; the suggestion is to bound it by time or another filter
+//
+// Suggestions are advice: CubicLog never creates indexes on its own. With
+// -partition monthly they apply to each partition file. Statistics live in
+// memory and start over on restart. Search text is never recorded.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slowQueryThreshold marks a log query as slow - configured once in main()
+var slowQueryThreshold = 250 * time.Millisecond
+
+// maxRecentSlowQueries caps the slow queries kept for the report
+const maxRecentSlowQueries = 20
+
+// insightFilters are the /api/logs parameters queries are grouped by
+var insightFilters = []string{"q", "id", "type", "color", "source", "severity", "environment", "release", "language", "min_duration", "max_duration", "http_status", "tag", "acknowledged", "from", "to", "sort", "sample"}
+
+// indexedFilters map equality filters and sorts to the column they read
+var indexedFilters = map[string]string{
+	"type":          "type",
+	"color":         "color",
+	"source":        "derived_source",
+	"severity":      "derived_severity",
+	"environment":   "environment",
+	"release":       "release",
+	"language":      "derived_language",
+	"min_duration":  "derived_duration_ms",
+	"max_duration":  "derived_duration_ms",
+	"http_status":   "derived_http_status",
+	"sort=source":   "derived_source",
+	"sort=severity": "derived_severity",
+	"sort=duration": "derived_duration_ms",
+}
+
+// queryShape is the usage of one filter combination
+type queryShape struct {
+	Filters    []string   `json:"filters"`
+	Count      int64      `json:"count"`
+	Slow       int64      `json:"slow"`
+	AvgMs      float64    `json:"avg_ms"`
+	MaxMs      float64    `json:"max_ms"`
+	LastSlowAt *time.Time `json:"last_slow_at,omitempty"`
+	total      time.Duration
+}
+
+// slowQuery is one recorded slow query
+type slowQuery struct {
+	Filters    []string          `json:"filters"`
+	Parameters map[string]string `json:"parameters"`
+	DurationMs float64           `json:"duration_ms"`
+	Rows       int               `json:"rows"`
+	At         time.Time         `json:"at"`
+}
+
+// querySuggestion is one piece of tuning advice
+type querySuggestion struct {
+	Filters     []string `json:"filters"`
+	Reason      string   `json:"reason"`
+	Statement   string   `json:"statement,omitempty"`
+	Exists      bool     `json:"exists,omitempty"`
+	SlowQueries int64    `json:"slow_queries"`
+}
+
+// queryStats collects the log query statistics
+var queryStats = struct {
+	sync.Mutex
+	shapes map[string]*queryShape
+	recent []slowQuery
+}{shapes: map[string]*queryShape{}}
+
+// queryFilters returns the filters a query uses, sorts included as "sort=<field>"
+func queryFilters(params url.Values) []string {
+	filters := []string{}
+	for _, name := range insightFilters {
+		if value := params.Get(name); value != "" {
+			if name == "sort" {
+				name += "=" + value
+			}
+			filters = append(filters, name)
+		}
+	}
+	return filters
+}
+
+// recordQuery counts a finished log query and keeps it when it was slow
+func recordQuery(params url.Values, elapsed time.Duration, rows int) {
+	filters := queryFilters(params)
+	key := strings.Join(filters, "+")
+
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	shape, ok := queryStats.shapes[key]
+	if !ok {
+		shape = &queryShape{Filters: filters}
+		queryStats.shapes[key] = shape
+	}
+	shape.Count++
+	shape.total += elapsed
+	if ms := milliseconds(elapsed); ms > shape.MaxMs {
+		shape.MaxMs = ms
+	}
+	if elapsed < slowQueryThreshold {
+		return
+	}
+
+	now := time.Now()
+	shape.Slow++
+	shape.LastSlowAt = &now
+	parameters := map[string]string{}
+	for _, name := range insightFilters {
+		if value := params.Get(name); value != "" && name != "q" {
+			parameters[name] = value
+		}
+	}
+	queryStats.recent = append(queryStats.recent, slowQuery{Filters: filters, Parameters: parameters, DurationMs: milliseconds(elapsed), Rows: rows, At: now})
+	if len(queryStats.recent) > maxRecentSlowQueries {
+		queryStats.recent = queryStats.recent[1:]
+	}
+}
+
+// milliseconds converts a duration for the report
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// querySuggestions derives tuning advice from the slow filter combinations
+func querySuggestions(shapes []queryShape, existing map[string]bool) []querySuggestion {
+	byStatement := map[string]*querySuggestion{}
+	var suggestions []*querySuggestion
+	add := func(filters []string, reason, statement string, slow int64) {
+		key := statement
+		if key == "" {
+			key = reason
+		}
+		if suggestion, ok := byStatement[key]; ok {
+			suggestion.SlowQueries += slow
+			return
+		}
+		suggestion := &querySuggestion{Filters: filters, Reason: reason, Statement: statement, SlowQueries: slow}
+		byStatement[key] = suggestion
+		suggestions = append(suggestions, suggestion)
+	}
+
+	for _, shape := range shapes {
+		if shape.Slow == 0 {
+			continue
+		}
+		var columns []string
+		for _, filter := range shape.Filters {
+			switch {
+			case filter == "q":
+				add([]string{"q"}, "q is a substring search over title, description and body that no index can serve: bound it with from/to or combine it with type, source or severity", "", shape.Slow)
+			case indexedFilters[filter] != "" && !containsString(columns, indexedFilters[filter]):
+				columns = append(columns, indexedFilters[filter])
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		sort.Strings(columns)
+		name := "idx_logs_" + strings.Join(columns, "_") + "_timestamp"
+		statement := "CREATE INDEX IF NOT EXISTS " + name + " ON logs(" + strings.Join(columns, ", ") + ", timestamp)"
+		add(shape.Filters, "filters on "+strings.Join(columns, ", ")+" ordered by time are served by one composite index", statement, shape.Slow)
+		byStatement[statement].Exists = existing[name]
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].SlowQueries > suggestions[j].SlowQueries })
+	result := make([]querySuggestion, len(suggestions))
+	for i, suggestion := range suggestions {
+		result[i] = *suggestion
+	}
+	return result
+}
+
+// logIndexes returns the names of the indexes on the logs table
+func logIndexes() map[string]bool {
+	query := "SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'logs'"
+	if db.Driver() == "postgres" {
+		query = "SELECT indexname FROM pg_indexes WHERE tablename = 'logs'"
+	}
+	indexes := map[string]bool{}
+	rows, err := db.Query(query)
+	if err != nil {
+		return indexes
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			indexes[name] = true
+		}
+	}
+	return indexes
+}
+
+// handleQueryInsights answers GET /api/admin/query-insights
+func handleQueryInsights(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queryStats.Lock()
+	shapes := make([]queryShape, 0, len(queryStats.shapes))
+	for _, shape := range queryStats.shapes {
+		view := *shape
+		view.AvgMs = milliseconds(shape.total / time.Duration(shape.Count))
+		shapes = append(shapes, view)
+	}
+	recent := make([]slowQuery, len(queryStats.recent))
+	for i, query := range queryStats.recent {
+		recent[len(recent)-1-i] = query
+	}
+	queryStats.Unlock()
+
+	sort.Slice(shapes, func(i, j int) bool {
+		if shapes[i].Slow != shapes[j].Slow {
+			return shapes[i].Slow > shapes[j].Slow
+		}
+		return shapes[i].Count > shapes[j].Count
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"slow_query_ms": milliseconds(slowQueryThreshold),
+		"since":         startedAt,
+		"queries":       shapes,
+		"recent_slow":   recent,
+		"suggestions":   querySuggestions(shapes, logIndexes()),
+	})
+}
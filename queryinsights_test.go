@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestQueryInsights tests slow query tracking and index suggestions
+func TestQueryInsights(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func(threshold time.Duration) { slowQueryThreshold = threshold }(slowQueryThreshold)
+	slowQueryThreshold = 0
+	queryStats.Lock()
+	queryStats.shapes, queryStats.recent = map[string]*queryShape{}, nil
+	queryStats.Unlock()
+
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"type":"error","title":"Card declined","source":"payments"}}`)))
+	for _, query := range []string{"severity=error&source=payments", "source=payments&severity=error", "q=secret-customer-name", "from=2024-05-14"} {
+		getLogs(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/logs?"+query, nil))
+	}
+
+	w := httptest.NewRecorder()
+	handleQueryInsights(w, httptest.NewRequest("GET", "/api/admin/query-insights", nil))
+	if w.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "secret-customer-name") {
+		t.Errorf("Expected search text to stay out of the report")
+	}
+	var report struct {
+		Queries     []queryShape      `json:"queries"`
+		RecentSlow  []slowQuery       `json:"recent_slow"`
+		Suggestions []querySuggestion `json:"suggestions"`
+	}
+	json.NewDecoder(w.Body).Decode(&report)
+	if len(report.Queries) != 3 || report.Queries[0].Slow != 2 || strings.Join(report.Queries[0].Filters, "+") != "source+severity" {
+		t.Errorf("Expected the two source+severity queries grouped first, got %+v", report.Queries)
+	}
+	if len(report.RecentSlow) != 4 || report.RecentSlow[0].Parameters["from"] != "2024-05-14" {
+		t.Errorf("Expected 4 recent slow queries, newest first, got %+v", report.RecentSlow)
+	}
+	if len(report.Suggestions) != 2 || report.Suggestions[0].Statement != "CREATE INDEX IF NOT EXISTS idx_logs_derived_severity_derived_source_timestamp ON logs(derived_severity, derived_source, timestamp)" || report.Suggestions[0].Exists {
+		t.Errorf("Expected a composite index suggestion and advice for q, got %+v", report.Suggestions)
+	}
+
+	db.Exec(report.Suggestions[0].Statement)
+	w = httptest.NewRecorder()
+	handleQueryInsights(w, httptest.NewRequest("GET", "/api/admin/query-insights", nil))
+	json.NewDecoder(w.Body).Decode(&report)
+	if !report.Suggestions[0].Exists {
+		t.Errorf("Expected the created index to be marked as existing")
+	}
+}
@@ -0,0 +1,283 @@
+// CubicLog Ingestion Quotas - Keep one noisy service from starving the rest
+//
+// Quotas are read from a JSON file given with -quota-file:
+//
+//	{
+//	  "default": {"max_logs_per_day": 100000},
+//	  "sources": {
+//	    "batch-importer": {"max_logs_per_day": 5000, "action": "sample", "sample_rate": 20},
+//	    "debug-service":  {"max_bytes_per_day": 52428800, "action": "count"}
+//	  },
+//	  "keys": {
+//	    "<api key>": {"max_logs_per_day": 1000000}
+//	  }
+//	}
+//
+// Sources are matched on the derived source; "default" applies to every source
+// without its own entry. Keys are matched on the API key sent with the request.
+//
+// OVER-QUOTA ACTIONS:
+//   - reject: 429 Too Many Requests with Retry-After until midnight UTC (default)
+//   - sample: store 1 in sample_rate logs (default 10), count the rest
+//   - count:  store nothing, only count the log in the hourly rollups
+//
+// Counted logs land in log_rollups, so totals and breakdowns in /api/stats stay
+// accurate. Daily usage per source and key is reported under "quotas" in
+// /api/stats. Counters live in memory and start over at midnight UTC or on restart.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota decisions, ordered by severity
+const (
+	quotaAllow     = iota // store the log
+	quotaCountOnly        // count the log in the rollups, don't store it
+	quotaReject           // refuse the log
+)
+
+// quotaLimit is the daily allowance of one source or key
+type quotaLimit struct {
+	MaxLogsPerDay  int64  `json:"max_logs_per_day"`  // 0 = unlimited
+	MaxBytesPerDay int64  `json:"max_bytes_per_day"` // 0 = unlimited
+	Action         string `json:"action"`            // reject (default), sample or count
+	SampleRate     int64  `json:"sample_rate"`       // keep 1 in N over-quota logs when sampling (default 10)
+}
+
+// quotaConfig is the content of the -quota-file
+type quotaConfig struct {
+	Default *quotaLimit           `json:"default"`
+	Sources map[string]quotaLimit `json:"sources"`
+	Keys    map[string]quotaLimit `json:"keys"`
+}
+
+// QuotaUsage is today's consumption of one quota subject, as shown in /api/stats
+type QuotaUsage struct {
+	Subject        string `json:"subject"` // "source:<name>" or "key:<fingerprint>"
+	Logs           int64  `json:"logs"`
+	Bytes          int64  `json:"bytes"`
+	OverQuota      int64  `json:"over_quota"` // logs rejected, sampled away or counted only
+	MaxLogsPerDay  int64  `json:"max_logs_per_day,omitempty"`
+	MaxBytesPerDay int64  `json:"max_bytes_per_day,omitempty"`
+	Action         string `json:"action"`
+}
+
+// quotaTracker holds the configuration and today's counters
+type quotaTracker struct {
+	mu     sync.Mutex
+	config *quotaConfig
+	day    string
+	usage  map[string]*QuotaUsage
+}
+
+// quotas is nil when no quota file is configured
+var quotas *quotaTracker
+
+// loadQuotas reads and validates the quota file
+func loadQuotas(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read quota file: %v", err)
+	}
+
+	var config quotaConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid quota file: %v", err)
+	}
+
+	if config.Default != nil {
+		if *config.Default, err = normalizeQuotaLimit(*config.Default); err != nil {
+			return err
+		}
+	}
+	for name, limit := range config.Sources {
+		if config.Sources[name], err = normalizeQuotaLimit(limit); err != nil {
+			return fmt.Errorf("source '%s': %v", name, err)
+		}
+	}
+	for key, limit := range config.Keys {
+		if config.Keys[key], err = normalizeQuotaLimit(limit); err != nil {
+			return fmt.Errorf("key %s: %v", keyFingerprint(key), err)
+		}
+	}
+
+	quotas = &quotaTracker{config: &config, usage: make(map[string]*QuotaUsage)}
+	return nil
+}
+
+// normalizeQuotaLimit validates a limit and fills in defaults
+func normalizeQuotaLimit(limit quotaLimit) (quotaLimit, error) {
+	switch limit.Action {
+	case "":
+		limit.Action = "reject"
+	case "reject", "sample", "count":
+	default:
+		return limit, fmt.Errorf("invalid quota action '%s' - use reject, sample or count", limit.Action)
+	}
+	if limit.SampleRate <= 0 {
+		limit.SampleRate = 10
+	}
+	return limit, nil
+}
+
+// requestAPIKey returns the API key sent with the request, if any
+func requestAPIKey(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// keyFingerprint identifies an API key in stats without revealing it
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// checkQuota decides what happens to a log of size bytes from source sent with
+// key, and records it against every matching quota
+func (q *quotaTracker) checkQuota(source, key string, size int64) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.decide(source, key, size, true)
+}
+
+// peekQuota decides like checkQuota without recording anything (see echoclassify.go)
+func (q *quotaTracker) peekQuota(source, key string, size int64) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.decide(source, key, size, false)
+}
+
+// decide is checkQuota with the tracker locked; without record it works on
+// copies of the counters
+func (q *quotaTracker) decide(source, key string, size int64, record bool) int {
+	today := time.Now().UTC().Format("2006-01-02")
+	usageFor := q.usageFor
+	if !record {
+		usageFor = func(name string, limit quotaLimit) *QuotaUsage {
+			var counted QuotaUsage
+			if usage, ok := q.usage[name]; ok && q.day == today {
+				counted = *usage
+			}
+			return &counted
+		}
+	} else if q.day != today {
+		q.day = today
+		q.usage = make(map[string]*QuotaUsage)
+	}
+
+	type subject struct {
+		usage *QuotaUsage
+		limit quotaLimit
+	}
+	var subjects []subject
+	if limit, ok := q.config.Sources[source]; ok {
+		subjects = append(subjects, subject{usageFor("source:"+source, limit), limit})
+	} else if q.config.Default != nil {
+		subjects = append(subjects, subject{usageFor("source:"+source, *q.config.Default), *q.config.Default})
+	}
+	if key != "" {
+		if limit, ok := q.config.Keys[key]; ok {
+			subjects = append(subjects, subject{usageFor("key:"+keyFingerprint(key), limit), limit})
+		}
+	}
+
+	decision := quotaAllow
+	for _, s := range subjects {
+		over := (s.limit.MaxLogsPerDay > 0 && s.usage.Logs+1 > s.limit.MaxLogsPerDay) ||
+			(s.limit.MaxBytesPerDay > 0 && s.usage.Bytes+size > s.limit.MaxBytesPerDay)
+		if !over {
+			continue
+		}
+
+		s.usage.OverQuota++
+		outcome := quotaReject
+		switch s.limit.Action {
+		case "count":
+			outcome = quotaCountOnly
+		case "sample":
+			outcome = quotaCountOnly
+			if s.usage.OverQuota%s.limit.SampleRate == 0 {
+				outcome = quotaAllow
+			}
+		}
+		if outcome > decision {
+			decision = outcome
+		}
+	}
+
+	if decision == quotaAllow {
+		for _, s := range subjects {
+			s.usage.Logs++
+			s.usage.Bytes += size
+		}
+	}
+	return decision
+}
+
+// usageFor returns the counters of a subject, creating them on first use
+func (q *quotaTracker) usageFor(name string, limit quotaLimit) *QuotaUsage {
+	usage, ok := q.usage[name]
+	if !ok {
+		usage = &QuotaUsage{
+			Subject:        name,
+			MaxLogsPerDay:  limit.MaxLogsPerDay,
+			MaxBytesPerDay: limit.MaxBytesPerDay,
+			Action:         limit.Action,
+		}
+		q.usage[name] = usage
+	}
+	return usage
+}
+
+// report returns today's usage sorted by subject
+func (q *quotaTracker) report() []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	report := []QuotaUsage{}
+	if q.day != time.Now().UTC().Format("2006-01-02") {
+		return report
+	}
+	for _, usage := range q.usage {
+		report = append(report, *usage)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Subject < report[j].Subject })
+	return report
+}
+
+// countLogOnly records a log in the hourly rollups without storing it
+func countLogOnly(source, severity string) error {
+	if source == "" {
+		source = "unknown"
+	}
+	hourlyStatsMu.RLock()
+	defer hourlyStatsMu.RUnlock()
+	hour := time.Now().UTC().Format("2006-01-02 15")
+	_, err := db.Exec(`
+		INSERT INTO log_rollups (hour, source, severity, count) VALUES (?, ?, ?, 1)
+		ON CONFLICT (hour, source, severity) DO UPDATE SET count = log_rollups.count + 1`,
+		hour, source, severity)
+	if err == nil {
+		countHourlyRollup(hour, source, severity)
+	}
+	return err
+}
+
+// secondsUntilQuotaReset returns the Retry-After value for rejected logs
+func secondsUntilQuotaReset() int {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return int(midnight.Sub(now).Seconds()) + 1
+}
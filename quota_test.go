@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestIngestionQuotas tests rejecting and counting logs once a source exceeds its daily quota
+func TestIngestionQuotas(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { quotas = nil }()
+
+	quotaFile := filepath.Join(t.TempDir(), "quotas.json")
+	os.WriteFile(quotaFile, []byte(`{
+		"sources": {
+			"noisy": {"max_logs_per_day": 1},
+			"chatty": {"max_logs_per_day": 1, "action": "count"}
+		}
+	}`), 0644)
+	if err := loadQuotas(quotaFile); err != nil {
+		t.Fatalf("Failed to load quotas: %v", err)
+	}
+
+	post := func(service string) int {
+		body := `{"header": {"title": "Tick", "type": "info"}, "body": {"service": "` + service + `"}}`
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", bytes.NewBufferString(body)))
+		return w.Code
+	}
+
+	if code := post("noisy"); code != http.StatusCreated {
+		t.Errorf("Expected first log to be stored, got %d", code)
+	}
+	if code := post("noisy"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 over quota, got %d", code)
+	}
+
+	post("chatty")
+	if code := post("chatty"); code != http.StatusAccepted {
+		t.Errorf("Expected 202 for counted log, got %d", code)
+	}
+	var counted int
+	db.QueryRow("SELECT COALESCE(SUM(count), 0) FROM log_rollups WHERE source = 'chatty'").Scan(&counted)
+	if counted != 1 {
+		t.Errorf("Expected 1 counted log in rollups, got %d", counted)
+	}
+
+	report := quotas.report()
+	if len(report) != 2 || report[1].Subject != "source:noisy" || report[1].OverQuota != 1 {
+		t.Errorf("Unexpected quota report: %+v", report)
+	}
+}
@@ -0,0 +1,116 @@
+// CubicLog Read-Only Mode - Browse a restored backup or an archive without changing it
+//
+//	cubiclog -read-only -db restored.db
+//
+// For forensic review the database must stay exactly as it was, so with
+// -read-only:
+//   - SQLite files (and monthly partitions) are opened with mode=ro and
+//     PostgreSQL sessions with default_transaction_read_only, so even a missed
+//     code path can't write
+//   - no tables are created and no migrations run; a database that needs
+//     pending migrations is refused (migrate a copy first)
+//   - retention, rollups, partition rollover, SLO checks and the spool don't run
+//   - every request that isn't GET, HEAD or OPTIONS is answered 403, except
+//     the endpoints that only verify or query (readOnlyPaths)
+//
+// Commands that change the database and exit (-cleanup -confirm, -seed,
+// -migrate up/down, -create-key, -repair, -restore) are refused. The dashboard
+// works as usual, shows a "Read-only" badge and hides its write controls.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// readOnlyMode is the -read-only setting - configured once in main()
+var readOnlyMode bool
+
+// readOnlyPaths answer POST requests without writing anything
+var readOnlyPaths = []string{"/api/export/verify", "/api/privacy/verify", "/api/slack/command", "/api/shares", "/api/testing/echo-classify"}
+
+// checkReadOnlyCommands rejects one-shot commands that would change the database
+func checkReadOnlyCommands(commands map[string]bool) error {
+	var used []string
+	for name, set := range commands {
+		if set {
+			used = append(used, "-"+name)
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	sort.Strings(used)
+	return fmt.Errorf("%s would change the database, which -read-only keeps as it is", strings.Join(used, ", "))
+}
+
+// readOnlyDSN asks the database itself to refuse writes
+func readOnlyDSN(driver, dsn string) string {
+	switch driver {
+	case "postgres", "postgresql":
+		// lib/pq passes unknown settings on to the server as session parameters
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			if parsed, err := url.Parse(dsn); err == nil {
+				query := parsed.Query()
+				query.Set("default_transaction_read_only", "on")
+				parsed.RawQuery = query.Encode()
+				return parsed.String()
+			}
+		}
+		return strings.TrimSpace(dsn + " default_transaction_read_only=on")
+	default:
+		if isMemoryDSN(dsn) {
+			return dsn
+		}
+		if !strings.HasPrefix(dsn, "file:") {
+			dsn = "file:" + dsn
+		}
+		if strings.Contains(dsn, "?") {
+			return dsn + "&mode=ro"
+		}
+		return dsn + "?mode=ro"
+	}
+}
+
+// checkReadOnlySchema makes sure a database can be served without migrating it
+func checkReadOnlySchema() error {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return fmt.Errorf("this doesn't look like a CubicLog database (%v)", err)
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := checkSchemaVersion(migrations, applied); err != nil {
+		return err
+	}
+	var pending []string
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%04d %s", m.Version, m.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("the database needs schema migrations (%s) - run -migrate up on a copy and open that", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// readOnlyHandler answers requests that would write with 403
+func readOnlyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !containsString(readOnlyPaths, r.URL.Path) {
+				http.Error(w, "CubicLog is running with -read-only", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
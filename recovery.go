@@ -0,0 +1,116 @@
+// CubicLog Startup Recovery - Keep serving when the database file is damaged
+//
+// A power cut or a failing disk can leave the SQLite file corrupt, and then
+// CubicLog would refuse to start until someone ran -check -repair by hand.
+// Instead, when opening the database at startup fails with SQLITE_CORRUPT,
+// SQLITE_NOTADB or a "malformed" error, CubicLog salvages every readable row
+// into a fresh database (like -repair, see integrity.go), moves the damaged
+// file aside as <db>.corrupt-<timestamp> and carries on with the fresh one.
+// The incident is logged prominently and reported under "database_recovery"
+// in GET /readyz?verbose=1. PostgreSQL and in-memory databases are left alone.
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lastRecovery remembers the startup recovery of a corrupt database
+var lastRecovery struct {
+	sync.Mutex
+	at      time.Time
+	aside   string
+	cause   string
+	rescued int
+}
+
+// SQLite result codes for a damaged database file
+const (
+	sqliteCorrupt = 11 // SQLITE_CORRUPT
+	sqliteNotADB  = 26 // SQLITE_NOTADB
+)
+
+// isCorruptionError reports whether err means the SQLite file is damaged
+func isCorruptionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if code, ok := sqliteErrorCode(err); ok && (code == sqliteCorrupt || code == sqliteNotADB) {
+		return true
+	}
+	// Errors wrapped with %v (e.g. by migrations) only keep the message
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "malformed") || strings.Contains(message, "file is not a database")
+}
+
+// withCorruptionRecovery runs a startup step against the database; if the
+// database turns out to be corrupt it is salvaged and the step runs again
+func withCorruptionRecovery(dbPath string, step func() error) error {
+	err := probeDatabase()
+	if err == nil {
+		err = step()
+	}
+	if !isCorruptionError(err) || db.Driver() != "sqlite3" || isMemoryDSN(dbPath) {
+		return err
+	}
+
+	log.Printf("🚨 ==================================================================")
+	log.Printf("🚨 DATABASE CORRUPTION DETECTED: %v", err)
+	log.Printf("🚨 Salvaging readable rows from %s into a fresh database...", dbPath)
+	aside, rescued, recoverErr := replaceWithSalvage(dbPath)
+	if recoverErr != nil {
+		log.Printf("🚨 Salvage failed: %v", recoverErr)
+		log.Printf("🚨 ==================================================================")
+		return err
+	}
+	total := 0
+	for table, count := range rescued {
+		total += count
+		if count > 0 {
+			log.Printf("🚨    rescued %d rows from %s", count, table)
+		}
+	}
+	log.Printf("🚨 Recovered %d rows; the damaged file is kept at %s", total, aside)
+	log.Printf("🚨 Logs in damaged pages are lost - inspect the copy with -check if needed")
+	log.Printf("🚨 ==================================================================")
+
+	lastRecovery.Lock()
+	lastRecovery.at, lastRecovery.aside, lastRecovery.cause, lastRecovery.rescued = time.Now(), aside, err.Error(), total
+	lastRecovery.Unlock()
+
+	if err := probeDatabase(); err != nil {
+		return err
+	}
+	return step()
+}
+
+// probeDatabase reads the schema, which fails right away on most damaged files
+func probeDatabase() error {
+	var tables int
+	return db.QueryRow("SELECT COUNT(*) FROM " + schemaTable()).Scan(&tables)
+}
+
+// schemaTable is the catalog listing the tables of the current driver
+func schemaTable() string {
+	if db.Driver() == "sqlite3" {
+		return "sqlite_master"
+	}
+	return "information_schema.tables"
+}
+
+// recoveryDetails describes the startup recovery for /readyz?verbose=1
+func recoveryDetails() map[string]interface{} {
+	lastRecovery.Lock()
+	defer lastRecovery.Unlock()
+	if lastRecovery.at.IsZero() {
+		return nil
+	}
+	return map[string]interface{}{
+		"at":           lastRecovery.at.UTC().Format(time.RFC3339),
+		"cause":        lastRecovery.cause,
+		"damaged_copy": lastRecovery.aside,
+		"rescued_rows": lastRecovery.rescued,
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStartupRecovery tests salvaging a damaged database file at startup
+func TestStartupRecovery(t *testing.T) {
+	originalDB := db
+	defer func() { db = originalDB }()
+
+	dbPath := filepath.Join(t.TempDir(), "logs.db")
+	if err := os.WriteFile(dbPath, []byte(strings.Repeat("not a sqlite database ", 400)), 0644); err != nil {
+		t.Fatalf("Failed to write damaged file: %v", err)
+	}
+	var err error
+	if db, err = openStore("sqlite3", dbPath); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() { db.Close() }()
+
+	if err := withCorruptionRecovery(dbPath, createTable); err != nil {
+		t.Fatalf("Expected the damaged database to be replaced, got %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO logs (type, title, color) VALUES ('info', 'Back online', 'blue')"); err != nil {
+		t.Errorf("Expected the fresh database to take writes, got %v", err)
+	}
+	details := recoveryDetails()
+	if details == nil {
+		t.Fatalf("Expected the recovery to be reported")
+	}
+	if aside, _ := details["damaged_copy"].(string); !strings.Contains(aside, "logs.db.corrupt-") {
+		t.Errorf("Expected the damaged file moved aside, got '%s'", aside)
+	} else if _, err := os.Stat(aside); err != nil {
+		t.Errorf("Expected the damaged copy to exist: %v", err)
+	}
+
+	if !isCorruptionError(fmt.Errorf("migration 1 (derived_metadata): database disk image is malformed")) {
+		t.Errorf("Expected wrapped malformed errors to count as corruption")
+	}
+	if isCorruptionError(fmt.Errorf("no such table: logs")) {
+		t.Errorf("Expected other errors not to count as corruption")
+	}
+}
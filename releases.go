@@ -0,0 +1,197 @@
+// CubicLog Releases - Spot the deploy that made things worse
+//
+//	GET /api/releases?since=720h&source=checkout&environment=production
+//
+// Every log can carry the release it was sent from (a version, build number
+// or commit). The first of these wins:
+//   - the X-CubicLog-Release request header
+//   - header.release in the log itself
+//   - "release", "app_version" or "service_version" in the body (or body.metadata)
+//
+// Releases are up to 64 letters, digits and ". _ - + @ / :", so "1.4.0",
+// "checkout@2024.06.1+b7" and git SHAs all work as they are. An invalid release
+// in the request header or log header is refused; body fields that don't look
+// like a release are ignored. Logs without any of these have no release.
+//
+// GET /api/logs and the exports filter with ?release=, and error groups
+// remember the release they were first seen in (first_release, see groups.go).
+//
+// /api/releases lists the releases of each source, newest first: their logs,
+// errors (error and critical), error rate, the error groups first seen in them,
+// and the change in error rate against the source's previous release. A
+// release is flagged as regression when it brought new error groups or at
+// least doubled the error rate of the release before it.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// releaseHeader sets the release of the logs in a request
+const releaseHeader = "X-CubicLog-Release"
+
+// releaseFields are the body fields naming the release, in order of preference
+var releaseFields = []string{"release", "app_version", "service_version"}
+
+// releasePattern is what a release may look like
+var releasePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+@/:-]{0,63}$`)
+
+// normalizeRelease trims and validates a release ("" stays "")
+func normalizeRelease(release string) (string, error) {
+	release = strings.TrimSpace(release)
+	if release == "" {
+		return "", nil
+	}
+	if !releasePattern.MatchString(release) {
+		return "", fmt.Errorf("invalid release '%s' - use up to 64 letters, digits, '.', '_', '-', '+', '@', '/' or ':'", release)
+	}
+	return release, nil
+}
+
+// bodyRelease returns the release named in a log body ("" if none looks like one)
+func bodyRelease(body map[string]interface{}) string {
+	for _, field := range releaseFields {
+		if value, ok := body[field].(string); ok {
+			if release, err := normalizeRelease(value); err == nil && release != "" {
+				return release
+			}
+		}
+	}
+	if meta, ok := body["metadata"].(map[string]interface{}); ok {
+		return bodyRelease(meta)
+	}
+	return ""
+}
+
+// resolveRelease decides the release of a log sent with r
+func resolveRelease(r *http.Request, header LogHeader, body map[string]interface{}) (string, error) {
+	for _, candidate := range []string{r.Header.Get(releaseHeader), header.Release} {
+		if strings.TrimSpace(candidate) != "" {
+			return normalizeRelease(candidate)
+		}
+	}
+	return bodyRelease(body), nil
+}
+
+// ReleaseStats summarizes the logs of one release of a source
+type ReleaseStats struct {
+	Source          string    `json:"source"`
+	Release         string    `json:"release"`
+	Logs            int       `json:"logs"`
+	Errors          int       `json:"errors"`
+	ErrorRate       float64   `json:"error_rate"` // percent of the logs
+	NewGroups       int       `json:"new_groups"` // error groups first seen in this release
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+	Previous        string    `json:"previous,omitempty"` // the source's release before this one
+	ErrorRateChange float64   `json:"error_rate_change"`  // percentage points against the previous release
+	Regression      bool      `json:"regression"`
+}
+
+// loadReleaseStats returns the releases seen since a point in time, grouped by
+// source (sources alphabetically, newest release first)
+func loadReleaseStats(since time.Time, source, environment string) ([]ReleaseStats, error) {
+	query := `SELECT COALESCE(derived_source, 'unknown'), release, COUNT(*),
+		SUM(CASE WHEN derived_severity IN ('error', 'critical') THEN 1 ELSE 0 END), MIN(timestamp), MAX(timestamp)
+		FROM logs WHERE release IS NOT NULL AND timestamp >= ?`
+	args := []interface{}{dbTime(since)}
+	if source != "" {
+		query += " AND derived_source = ?"
+		args = append(args, source)
+	}
+	if environment != "" {
+		query += " AND environment = ?"
+		args = append(args, environment)
+	}
+	rows, err := db.Query(db.Rebind(query+" GROUP BY derived_source, release"), args...)
+	if err != nil {
+		return nil, err
+	}
+	stats := []ReleaseStats{}
+	for rows.Next() {
+		var s ReleaseStats
+		if err := rows.Scan(&s.Source, &s.Release, &s.Logs, &s.Errors, (*scanTime)(&s.FirstSeen), (*scanTime)(&s.LastSeen)); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.ErrorRate = percent(s.Errors, s.Logs)
+		stats = append(stats, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Error groups are counted towards the release they first appeared in
+	newGroups := map[string]int{}
+	groupRows, err := db.Query("SELECT source, first_release, COUNT(*) FROM error_groups WHERE first_release IS NOT NULL GROUP BY source, first_release")
+	if err != nil {
+		return nil, err
+	}
+	for groupRows.Next() {
+		var groupSource, release string
+		var count int
+		if groupRows.Scan(&groupSource, &release, &count) == nil {
+			newGroups[groupSource+"\x00"+release] = count
+		}
+	}
+	groupRows.Close()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Source != stats[j].Source {
+			return stats[i].Source < stats[j].Source
+		}
+		return stats[i].FirstSeen.After(stats[j].FirstSeen)
+	})
+	for i := range stats {
+		s := &stats[i]
+		s.NewGroups = newGroups[s.Source+"\x00"+s.Release]
+		s.Regression = s.NewGroups > 0
+		if i+1 < len(stats) && stats[i+1].Source == s.Source {
+			previous := stats[i+1]
+			s.Previous = previous.Release
+			s.ErrorRateChange = roundTo(s.ErrorRate-previous.ErrorRate, 1)
+			if s.Errors > 0 && s.ErrorRate >= 2*previous.ErrorRate {
+				s.Regression = true
+			}
+		}
+	}
+	return stats, nil
+}
+
+// handleReleases answers GET /api/releases?since=720h&source=&environment=
+func handleReleases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	since := 30 * 24 * time.Hour
+	if value := params.Get("since"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "since must be a duration like 24h or 720h", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	environment, err := normalizeEnvironment(params.Get("environment"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := loadReleaseStats(time.Now().Add(-since), params.Get("source"), environment)
+	if err != nil {
+		http.Error(w, "Failed to load releases", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"releases": stats})
+}
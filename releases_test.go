@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestReleases tests resolving releases and comparing error rates between them
+func TestReleases(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	send := func(body, release string) (int, Log) {
+		r := httptest.NewRequest("POST", "/api/logs", strings.NewReader(body))
+		if release != "" {
+			r.Header.Set(releaseHeader, release)
+		}
+		w := httptest.NewRecorder()
+		createLog(w, r)
+		var created Log
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return w.Code, created
+	}
+
+	// Release 1.0: one error in four logs, sent two days ago
+	for _, title := range []string{"Cart loaded", "Cart loaded", "Checkout started"} {
+		send(`{"header": {"title": "`+title+`", "type": "info", "source": "checkout", "release": "1.0"}}`, "")
+	}
+	if _, created := send(`{"header": {"title": "Payment 4711 failed", "type": "error", "source": "checkout"}}`, "1.0"); created.Header.Release != "1.0" {
+		t.Fatalf("Expected the request header release, got '%s'", created.Header.Release)
+	}
+	db.Exec(db.Rebind("UPDATE logs SET timestamp = ?"), dbTime(time.Now().Add(-48*time.Hour)))
+
+	// Release 1.1 (named in the body): a new kind of error in two logs
+	send(`{"header": {"title": "Cart loaded", "type": "info", "source": "checkout"}, "body": {"metadata": {"app_version": "1.1"}}}`, "")
+	if _, created := send(`{"header": {"title": "Inventory lookup timed out", "type": "error", "source": "checkout"}, "body": {"release": "1.1"}}`, ""); created.Header.Release != "1.1" {
+		t.Fatalf("Expected the body release, got '%s'", created.Header.Release)
+	}
+	if code, _ := send(`{"header": {"title": "Cart loaded", "release": "1.2 beta!"}}`, ""); code != 400 {
+		t.Errorf("Expected status 400 for an invalid release, got %d", code)
+	}
+	if _, created := send(`{"header": {"title": "Cart loaded"}, "body": {"release": {"name": "1.2"}}}`, ""); created.Header.Release != "" {
+		t.Errorf("Expected no release from a body field that isn't one, got '%s'", created.Header.Release)
+	}
+
+	w := httptest.NewRecorder()
+	handleReleases(w, httptest.NewRequest("GET", "/api/releases?source=checkout", nil))
+	var response struct {
+		Releases []ReleaseStats `json:"releases"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Releases) != 2 {
+		t.Fatalf("Expected two releases, got %+v", response.Releases)
+	}
+	latest, previous := response.Releases[0], response.Releases[1]
+	if latest.Release != "1.1" || latest.Previous != "1.0" || latest.ErrorRate != 50 || latest.ErrorRateChange != 25 ||
+		latest.NewGroups != 1 || !latest.Regression {
+		t.Errorf("Expected 1.1 flagged against 1.0, got %+v", latest)
+	}
+	if previous.Release != "1.0" || previous.Logs != 4 || previous.Errors != 1 || previous.Previous != "" {
+		t.Errorf("Expected 1.0 with four logs and one error, got %+v", previous)
+	}
+
+	groups, _ := loadErrorGroups(time.Now().Add(-time.Hour), 10)
+	for _, g := range groups {
+		if strings.HasPrefix(g.Title, "Inventory") && g.FirstRelease != "1.1" {
+			t.Errorf("Expected the inventory group first seen in 1.1, got '%s'", g.FirstRelease)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs?release=1.0", nil))
+	var logs []Log
+	json.NewDecoder(w.Body).Decode(&logs)
+	if len(logs) != 4 || logs[0].Header.Release != "1.0" {
+		t.Errorf("Expected the four logs of release 1.0, got %d", len(logs))
+	}
+}
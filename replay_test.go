@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestReplay tests re-sending stored logs to another instance
+func TestReplay(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func(delay time.Duration) { replayRetryDelay = delay }(replayRetryDelay)
+	replayRetryDelay = time.Millisecond
+
+	for _, entry := range []string{
+		`{"header":{"type":"error","title":"Checkout failed","source":"checkout"},"body":{"order":42}}`,
+		`{"header":{"title":"Retrying payment"}}`,
+		`{"header":{"title":"Outside the range"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(entry)))
+	}
+	db.Exec("UPDATE logs SET timestamp = ? WHERE id = 1", "2024-05-01 12:00:00")
+	db.Exec("UPDATE logs SET timestamp = ? WHERE id = 2", "2024-05-01 12:00:02")
+
+	var mu sync.Mutex
+	var received []Log
+	attempts := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/api/logs" || r.Header.Get("Authorization") != "Bearer target-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var l Log
+		json.NewDecoder(r.Body).Decode(&l)
+		received = append(received, l)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer target.Close()
+
+	from, _ := parseReplayTime("2024-05-01", false)
+	to, _ := parseReplayTime("2024-05-01", true)
+	started := time.Now()
+	result, err := runReplay(target.URL, "target-key", from, to, 100)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if result.Sent != 2 || result.Failed != 0 || len(received) != 2 {
+		t.Fatalf("Expected 2 logs replayed after a retry, got %+v", result)
+	}
+	if received[0].Header.Title != "Checkout failed" || received[0].Header.Source != "checkout" || received[0].Body["order"] != float64(42) {
+		t.Errorf("Expected the oldest log first with its header and body, got %+v", received[0])
+	}
+	if elapsed := time.Since(started); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected the 2s gap replayed at 100x to take 20ms, took %s", elapsed)
+	}
+
+	if _, err := parseReplayTime("May 1st", false); err == nil {
+		t.Errorf("Expected an error for an invalid date")
+	}
+}
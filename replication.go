@@ -0,0 +1,519 @@
+// CubicLog Replication - Continuous off-host snapshots with one-command restore
+//
+// A single-node logging server should not lose its whole history when a disk
+// dies. When -replicate-to is set, CubicLog periodically takes a consistent
+// snapshot of the SQLite database (VACUUM INTO), gzips it and ships it to
+// (streamed through temporary files, so memory use doesn't grow with the database):
+//   - a directory (local disk, NFS or any mounted remote filesystem)
+//   - an HTTP(S) endpoint accepting PUT/GET/DELETE (another host, presigned storage)
+//   - an S3 bucket (s3://bucket/prefix, SigV4 signed using AWS_* env variables)
+//
+// Snapshots are only taken when the database changed since the last run (any
+// committed write, see databaseChangeMarker), and a manifest.json next to them tracks the latest snapshot and the retained history.
+//
+// RESTORE:
+//
+//	cubiclog -restore s3://my-bucket/cubiclog -db ./logs.db
+//
+// fetches the latest snapshot and writes it to the database path (an existing
+// database is moved aside first, never overwritten).
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// replicationManifest records which snapshots exist at a replica target
+type replicationManifest struct {
+	Latest    string    `json:"latest"`
+	Snapshots []string  `json:"snapshots"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// replicaTarget is a destination snapshots can be shipped to and restored from
+type replicaTarget interface {
+	Put(name string, body io.ReadSeeker) error
+	Get(name string) ([]byte, error)
+	Delete(name string) error
+	String() string
+}
+
+// newReplicaTarget parses a replication destination into a target
+func newReplicaTarget(dest string) (replicaTarget, error) {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		rest := strings.TrimPrefix(dest, "s3://")
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("missing bucket in '%s'", dest)
+		}
+		target := &s3Target{
+			bucket:       bucket,
+			prefix:       strings.Trim(prefix, "/"),
+			region:       getEnv("AWS_REGION", "us-east-1"),
+			endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if target.accessKey == "" || target.secretKey == "" {
+			return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for S3 replication")
+		}
+		return target, nil
+	case strings.HasPrefix(dest, "http://"), strings.HasPrefix(dest, "https://"):
+		return &httpTarget{baseURL: strings.TrimRight(dest, "/")}, nil
+	case dest == "":
+		return nil, fmt.Errorf("empty replication destination")
+	default:
+		return &dirTarget{dir: strings.TrimPrefix(dest, "file://")}, nil
+	}
+}
+
+// =============================================================================
+// REPLICATION LOOP
+// =============================================================================
+
+// startReplication ships a snapshot every interval whenever the database changed
+func startReplication(target replicaTarget, interval time.Duration, retain int) {
+	go func() {
+		lastMarker := ""
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// PRAGMA data_version only moves for commits made by other connections,
+		// so it is read on a connection of its own (an in-memory database has a
+		// single connection, where total_changes() counts every write instead)
+		var markerConn *sql.Conn
+		if !storeInMemory() {
+			conn, err := db.Conn(context.Background())
+			if err != nil {
+				log.Printf("⚠️  Replication disabled: %v", err)
+				return
+			}
+			defer conn.Close()
+			markerConn = conn
+		}
+
+		for {
+			marker, err := databaseChangeMarker(markerConn)
+			if err != nil {
+				log.Printf("⚠️  Replication change check failed: %v", err)
+			}
+
+			if marker != lastMarker || err != nil {
+				if name, err := replicateOnce(target, retain); err != nil {
+					log.Printf("⚠️  Replication to %s failed: %v", target, err)
+				} else {
+					lastMarker = marker
+					log.Printf("📦 Replicated snapshot %s to %s", name, target)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// databaseChangeMarker returns a value that changes with every committed write:
+// data_version (writes by other connections) and total_changes() (writes by
+// this one). A nil conn reads it through db.
+func databaseChangeMarker(conn *sql.Conn) (string, error) {
+	const query = "SELECT (SELECT data_version FROM pragma_data_version()), total_changes()"
+	var version, changes int64
+	var err error
+	if conn != nil {
+		err = conn.QueryRowContext(context.Background(), query).Scan(&version, &changes)
+	} else {
+		err = db.QueryRow(query).Scan(&version, &changes)
+	}
+	return fmt.Sprintf("%d:%d", version, changes), err
+}
+
+// replicateOnce takes a consistent snapshot and ships it to the target
+func replicateOnce(target replicaTarget, retain int) (string, error) {
+	snapshot, err := snapshotDatabase()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(snapshot)
+
+	// Compress the snapshot into a second file before shipping
+	compressed, err := gzipFile(snapshot)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(compressed.Name())
+	defer compressed.Close()
+
+	name := "snapshot-" + time.Now().UTC().Format("20060102T150405.000Z") + ".db.gz"
+	if err := target.Put(name, compressed); err != nil {
+		return "", err
+	}
+
+	// Update the manifest (a missing manifest simply means first snapshot)
+	manifest := replicationManifest{}
+	if raw, err := target.Get("manifest.json"); err == nil {
+		json.Unmarshal(raw, &manifest)
+	}
+	manifest.Latest = name
+	manifest.Snapshots = append(manifest.Snapshots, name)
+	manifest.UpdatedAt = time.Now().UTC()
+
+	// Enforce snapshot retention
+	if retain > 0 && len(manifest.Snapshots) > retain {
+		expired := manifest.Snapshots[:len(manifest.Snapshots)-retain]
+		manifest.Snapshots = manifest.Snapshots[len(manifest.Snapshots)-retain:]
+		for _, old := range expired {
+			if err := target.Delete(old); err != nil {
+				log.Printf("⚠️  Could not delete expired snapshot %s: %v", old, err)
+			}
+		}
+	}
+
+	raw, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := target.Put("manifest.json", bytes.NewReader(raw)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// snapshotDatabase writes a transactionally consistent copy of the SQLite
+// database to a temporary file and returns its path (the caller removes it)
+func snapshotDatabase() (string, error) {
+	if db.Driver() != "sqlite3" {
+		return "", fmt.Errorf("snapshots are only supported for SQLite (use your database's native replication)")
+	}
+
+	tmp, err := os.CreateTemp("", "cubiclog-snapshot-*.db")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	os.Remove(tmpPath) // VACUUM INTO requires the target not to exist
+
+	if _, err := db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("snapshot failed: %v", err)
+	}
+	return tmpPath, nil
+}
+
+// gzipFile compresses a file into a temporary file, returned open and rewound
+// (the caller closes and removes it)
+func gzipFile(path string) (*os.File, error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	compressed, err := os.CreateTemp("", "cubiclog-snapshot-*.db.gz")
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		compressed.Close()
+		os.Remove(compressed.Name())
+		return nil, err
+	}
+	gz := gzip.NewWriter(compressed)
+	if _, err := io.Copy(gz, source); err != nil {
+		return fail(err)
+	}
+	if err := gz.Close(); err != nil {
+		return fail(err)
+	}
+	if _, err := compressed.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return compressed, nil
+}
+
+// restoreFromReplica downloads the latest snapshot and writes it to dbPath
+func restoreFromReplica(target replicaTarget, dbPath string) (string, error) {
+	raw, err := target.Get("manifest.json")
+	if err != nil {
+		return "", fmt.Errorf("could not read manifest: %v", err)
+	}
+
+	var manifest replicationManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil || manifest.Latest == "" {
+		return "", fmt.Errorf("invalid or empty manifest at %s", target)
+	}
+
+	compressed, err := target.Get(manifest.Latest)
+	if err != nil {
+		return "", fmt.Errorf("could not download %s: %v", manifest.Latest, err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("corrupt snapshot %s: %v", manifest.Latest, err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return "", fmt.Errorf("corrupt snapshot %s: %v", manifest.Latest, err)
+	}
+
+	// Never overwrite an existing database - move it aside instead
+	if _, err := os.Stat(dbPath); err == nil {
+		aside := dbPath + ".pre-restore-" + time.Now().Format("20060102-150405")
+		if err := os.Rename(dbPath, aside); err != nil {
+			return "", fmt.Errorf("could not move existing database aside: %v", err)
+		}
+		os.Remove(dbPath + "-wal")
+		os.Remove(dbPath + "-shm")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dbPath, data, 0644); err != nil {
+		return "", err
+	}
+	return manifest.Latest, nil
+}
+
+// handleRestore implements the -restore command
+func handleRestore(source, dbPath string) {
+	target, err := newReplicaTarget(source)
+	if err != nil {
+		fmt.Printf("❌ Invalid restore source: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("📥 Restoring latest snapshot from %s...\n", target)
+	name, err := restoreFromReplica(target, dbPath)
+	if err != nil {
+		fmt.Printf("❌ Restore failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Restored %s to %s\n", name, dbPath)
+}
+
+// =============================================================================
+// REPLICA TARGETS
+// =============================================================================
+
+// dirTarget stores snapshots in a directory
+type dirTarget struct {
+	dir string
+}
+
+func (t *dirTarget) Put(name string, body io.ReadSeeker) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	// Write atomically so a crash never leaves a half-written snapshot
+	tmp := filepath.Join(t.dir, "."+name+".tmp")
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, name))
+}
+
+func (t *dirTarget) Get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(t.dir, name))
+}
+
+func (t *dirTarget) Delete(name string) error {
+	return os.Remove(filepath.Join(t.dir, name))
+}
+
+func (t *dirTarget) String() string { return t.dir }
+
+// httpTarget stores snapshots on any server accepting PUT/GET/DELETE
+type httpTarget struct {
+	baseURL string
+}
+
+func (t *httpTarget) do(method, name string, body io.ReadSeeker) ([]byte, error) {
+	req, err := http.NewRequest(method, t.baseURL+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := setReplicaBody(req, body); err != nil {
+		return nil, err
+	}
+	return doReplicaRequest(req)
+}
+
+func (t *httpTarget) Put(name string, body io.ReadSeeker) error {
+	_, err := t.do("PUT", name, body)
+	return err
+}
+
+func (t *httpTarget) Get(name string) ([]byte, error) { return t.do("GET", name, nil) }
+
+func (t *httpTarget) Delete(name string) error {
+	_, err := t.do("DELETE", name, nil)
+	return err
+}
+
+func (t *httpTarget) String() string { return t.baseURL }
+
+// s3Target stores snapshots in an S3-compatible bucket using SigV4 signing
+type s3Target struct {
+	bucket, prefix, region, endpoint   string
+	accessKey, secretKey, sessionToken string
+}
+
+func (t *s3Target) do(method, name string, body io.ReadSeeker) ([]byte, error) {
+	key := path.Join(t.prefix, name)
+
+	// Virtual-hosted style for AWS, path style for custom endpoints (MinIO etc.)
+	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", t.bucket, t.region, key)
+	if t.endpoint != "" {
+		url = strings.TrimRight(t.endpoint, "/") + "/" + t.bucket + "/" + key
+	}
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// SigV4 signs the payload hash, read in a first pass over the body
+	payloadHash := sha256Hex(nil)
+	if body != nil {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, body); err != nil {
+			return nil, err
+		}
+		payloadHash = hex.EncodeToString(hash.Sum(nil))
+	}
+	if err := setReplicaBody(req, body); err != nil {
+		return nil, err
+	}
+	signS3Request(req, payloadHash, t.region, t.accessKey, t.secretKey, t.sessionToken, time.Now().UTC())
+	return doReplicaRequest(req)
+}
+
+func (t *s3Target) Put(name string, body io.ReadSeeker) error {
+	_, err := t.do("PUT", name, body)
+	return err
+}
+
+func (t *s3Target) Get(name string) ([]byte, error) { return t.do("GET", name, nil) }
+
+func (t *s3Target) Delete(name string) error {
+	_, err := t.do("DELETE", name, nil)
+	return err
+}
+
+func (t *s3Target) String() string { return "s3://" + path.Join(t.bucket, t.prefix) }
+
+// signS3Request adds AWS Signature Version 4 headers to an S3 request whose
+// body has the given SHA-256 hash (hex)
+func signS3Request(req *http.Request, payloadHash, region, accessKey, secretKey, sessionToken string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	if sessionToken != "" {
+		req.Header.Set("x-amz-security-token", sessionToken)
+		canonicalHeaders += "x-amz-security-token:" + sessionToken + "\n"
+		signedHeaders += ";x-amz-security-token"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders, signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// setReplicaBody streams body (rewound first, nil for none) as the request
+// body with a known length, as S3 and most servers require for PUT
+func setReplicaBody(req *http.Request, body io.ReadSeeker) error {
+	if body == nil {
+		return nil
+	}
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	req.Body = io.NopCloser(body)
+	req.ContentLength = size
+	return nil
+}
+
+// doReplicaRequest executes a replica request and treats non-2xx responses as errors
+func doReplicaRequest(req *http.Request) ([]byte, error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s returned %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return data, nil
+}
+
+// sha256Hex returns the hex-encoded SHA-256 digest of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 computes an HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
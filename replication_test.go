@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReplicationRoundTrip tests shipping a snapshot to a directory and restoring it
+func TestReplicationRoundTrip(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.Exec("INSERT INTO logs (type, title, color) VALUES ('info', 'replicated entry', 'blue')")
+
+	dir := t.TempDir()
+	target, err := newReplicaTarget(filepath.Join(dir, "replica"))
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+
+	// Two snapshots with retention of one must leave a single snapshot behind
+	if _, err := replicateOnce(target, 1); err != nil {
+		t.Fatalf("First snapshot failed: %v", err)
+	}
+	latest, err := replicateOnce(target, 1)
+	if err != nil {
+		t.Fatalf("Second snapshot failed: %v", err)
+	}
+
+	dbPath := filepath.Join(dir, "restored.db")
+	restored, err := restoreFromReplica(target, dbPath)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored != latest {
+		t.Errorf("Expected latest snapshot '%s', got '%s'", latest, restored)
+	}
+
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer conn.Close()
+
+	var title string
+	if err := conn.QueryRow("SELECT title FROM logs").Scan(&title); err != nil || title != "replicated entry" {
+		t.Errorf("Expected restored log, got '%s' (%v)", title, err)
+	}
+}
+
+// TestDatabaseChangeMarker tests that every kind of write changes the replication marker
+func TestDatabaseChangeMarker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.db")
+	originalDB := db
+	var err error
+	if db, err = openStore("sqlite3", path); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer func() {
+		db.Close()
+		db = originalDB
+	}()
+	if err := createTable(); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	db.Exec("INSERT INTO logs (type, title, color) VALUES ('info', 'first', 'blue')")
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get a connection: %v", err)
+	}
+	defer conn.Close()
+
+	marker, _ := databaseChangeMarker(conn)
+	writes := []string{
+		"UPDATE logs SET title = 'renamed'",
+		"DELETE FROM logs",
+		"INSERT INTO logs (id, type, title, color) VALUES (1, 'info', 'first', 'blue')",
+		"CREATE TABLE notes (text TEXT)",
+	}
+	for _, write := range writes {
+		if _, err := db.Exec(write); err != nil {
+			t.Fatalf("%s failed: %v", write, err)
+		}
+		next, err := databaseChangeMarker(conn)
+		if err != nil {
+			t.Fatalf("Marker query failed: %v", err)
+		}
+		if next == marker {
+			t.Errorf("Expected the marker to change after %s", write)
+		}
+		marker = next
+	}
+	if next, _ := databaseChangeMarker(conn); next != marker {
+		t.Errorf("Expected the marker to stay put without writes, got %s then %s", marker, next)
+	}
+}
+
+// TestS3TargetStreamsBody tests that S3 uploads carry the payload hash and a known length
+func TestS3TargetStreamsBody(t *testing.T) {
+	var gotHash string
+	var gotLength int64
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHash, gotLength = r.Header.Get("x-amz-content-sha256"), r.ContentLength
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	target := &s3Target{bucket: "logs", region: "us-east-1", endpoint: server.URL, accessKey: "key", secretKey: "secret"}
+	payload := strings.Repeat("snapshot ", 1000)
+	if err := target.Put("snapshot.db.gz", strings.NewReader(payload)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if string(gotBody) != payload || gotLength != int64(len(payload)) || gotHash != sha256Hex([]byte(payload)) {
+		t.Errorf("Expected the whole body with its length and hash, got %d bytes, length %d, hash %s", len(gotBody), gotLength, gotHash)
+	}
+}
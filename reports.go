@@ -0,0 +1,588 @@
+// CubicLog Reports - Error trends, top groups and SLO status as a document
+//
+// Reports are read from a JSON file given with -report-file:
+//
+//	{
+//	  "reports": [
+//	    {
+//	      "name": "weekly",
+//	      "schedule": "0 8 * * 1",
+//	      "timezone": "Europe/Berlin",
+//	      "window": "168h",
+//	      "sections": ["error_trends", "top_groups", "slo"],
+//	      "sources": ["checkout", "payments"],
+//	      "pdf": true
+//	    }
+//	  ]
+//	}
+//
+// At every time the cron schedule (see cron.go) fires, the report covering the
+// preceding window (default the last 7 days) is rendered to a standalone HTML
+// page - inline styles, no scripts, readable offline and in mail clients - and
+// stored in the database. Sections default to all three; sources narrow the
+// report to these derived sources. With "pdf" the page is also converted to
+// PDF by the -report-pdf-command, which reads HTML on stdin and writes PDF to
+// stdout (e.g. "wkhtmltopdf --quiet - -"), so CubicLog needs no PDF library.
+//
+//   - GET  /api/reports               configured reports and the latest generated ones (?name=weekly)
+//   - POST /api/reports               generate a report now: {"name": "weekly"}
+//   - GET  /api/reports/{id}.html     download a generated report
+//   - GET  /api/reports/{id}.pdf      download its PDF
+//
+// Generated reports are removed by retention like the logs they summarize.
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportSections are the sections a report can have, in the order they're rendered
+var reportSections = []string{"error_trends", "top_groups", "slo"}
+
+// reportPDFTimeout bounds one run of the -report-pdf-command
+const reportPDFTimeout = time.Minute
+
+// reportConfig is one entry of the -report-file
+type reportConfig struct {
+	Name     string   `json:"name"`
+	Schedule string   `json:"schedule"`
+	Timezone string   `json:"timezone,omitempty"`
+	Window   string   `json:"window,omitempty"`
+	Sections []string `json:"sections,omitempty"`
+	Sources  []string `json:"sources,omitempty"`
+	PDF      bool     `json:"pdf,omitempty"`
+
+	schedule *cronSchedule
+	location *time.Location
+	window   time.Duration
+}
+
+// GeneratedReport is a stored report (without its content)
+type GeneratedReport struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	GeneratedAt time.Time `json:"generated_at"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	HTMLURL     string    `json:"html_url"`
+	PDFURL      string    `json:"pdf_url,omitempty"`
+}
+
+// Report settings - configured once in main()
+var (
+	reportConfigs    []reportConfig
+	reportPDFCommand []string
+	reportsMu        sync.Mutex // one report is generated at a time
+)
+
+// loadReports reads and validates the report file and the -report-pdf-command
+func loadReports(path, pdfCommand string) error {
+	reportConfigs, reportPDFCommand = nil, strings.Fields(pdfCommand)
+	if len(reportPDFCommand) > 0 {
+		if _, err := exec.LookPath(reportPDFCommand[0]); err != nil {
+			return fmt.Errorf("report PDF command not found: %v", err)
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read report file: %v", err)
+	}
+
+	var config struct {
+		Reports []reportConfig `json:"reports"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid report file: %v", err)
+	}
+	names := map[string]bool{}
+	for i := range config.Reports {
+		report := &config.Reports[i]
+		if err := normalizeReportConfig(report); err != nil {
+			return fmt.Errorf("report %d: %v", i+1, err)
+		}
+		if names[report.Name] {
+			return fmt.Errorf("report '%s' is defined twice", report.Name)
+		}
+		names[report.Name] = true
+	}
+	reportConfigs = config.Reports
+	return nil
+}
+
+// normalizeReportConfig validates a report and fills in defaults
+func normalizeReportConfig(report *reportConfig) error {
+	report.Name = strings.TrimSpace(report.Name)
+	if report.Name == "" || len(report.Name) > 100 || strings.ContainsAny(report.Name, "/\"") {
+		return fmt.Errorf("name must be 1-100 characters without / or \"")
+	}
+	var err error
+	if report.schedule, err = parseCron(report.Schedule); err != nil {
+		return fmt.Errorf("'%s': %v", report.Name, err)
+	}
+	report.location = time.UTC
+	if report.Timezone != "" {
+		if report.location, err = time.LoadLocation(report.Timezone); err != nil {
+			return fmt.Errorf("'%s': unknown timezone '%s'", report.Name, report.Timezone)
+		}
+	}
+	report.window = 7 * 24 * time.Hour
+	if report.Window != "" {
+		if report.window, err = time.ParseDuration(report.Window); err != nil || report.window <= 0 {
+			return fmt.Errorf("'%s': window must be a duration like 24h or 168h", report.Name)
+		}
+	}
+	if len(report.Sections) == 0 {
+		report.Sections = reportSections
+	}
+	for _, section := range report.Sections {
+		if !containsString(reportSections, section) {
+			return fmt.Errorf("'%s': unknown section '%s' (use %s)", report.Name, section, strings.Join(reportSections, ", "))
+		}
+	}
+	if report.PDF && len(reportPDFCommand) == 0 {
+		return fmt.Errorf("'%s': pdf needs -report-pdf-command", report.Name)
+	}
+	return nil
+}
+
+// findReportConfig returns the configured report of a name
+func findReportConfig(name string) (reportConfig, bool) {
+	for _, report := range reportConfigs {
+		if report.Name == name {
+			return report, true
+		}
+	}
+	return reportConfig{}, false
+}
+
+// createReportsTable creates the table of generated reports
+func createReportsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS reports (
+		id           ` + alertIDColumn() + `,
+		name         TEXT NOT NULL,
+		generated_at TIMESTAMP NOT NULL,
+		period_from  TIMESTAMP NOT NULL,
+		period_to    TIMESTAMP NOT NULL,
+		html         TEXT NOT NULL,
+		pdf          TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_reports_generated_at ON reports(generated_at);
+	`)
+	return err
+}
+
+// reportTrendDay is one day of the error trend
+type reportTrendDay struct {
+	Day    string
+	Logs   int
+	Errors int
+	Width  int // bar width in percent of the busiest day
+}
+
+// reportSource is one source's share of the errors
+type reportSource struct {
+	Source    string
+	Logs      int
+	Errors    int
+	ErrorRate float64
+}
+
+// reportData is what the report template renders
+type reportData struct {
+	Name        string
+	GeneratedAt time.Time
+	From, To    time.Time
+	Sources     []string
+	Sections    []string
+
+	Logs, Errors int
+	Days         []reportTrendDay
+	TopSources   []reportSource
+	Groups       []ErrorGroup
+	SLOs         []sloStatus
+}
+
+// Has reports whether the report includes a section
+func (d reportData) Has(section string) bool {
+	return containsString(d.Sections, section)
+}
+
+// buildReportData collects the numbers of a report ending at to
+func buildReportData(report reportConfig, to time.Time) (reportData, error) {
+	to = to.UTC().Truncate(time.Second)
+	data := reportData{Name: report.Name, GeneratedAt: time.Now().UTC().Truncate(time.Second),
+		From: to.Add(-report.window), To: to, Sources: report.Sources, Sections: report.Sections}
+	inScope := func(source string) bool {
+		return len(report.Sources) == 0 || containsString(report.Sources, source)
+	}
+
+	if data.Has("error_trends") {
+		counts, err := hourlyCounts(data.From)
+		if err != nil {
+			return data, err
+		}
+		days, sources := map[string]*reportTrendDay{}, map[string]*reportSource{}
+		for _, row := range counts {
+			if row.hour.After(to) || !inScope(row.source) {
+				continue
+			}
+			key := row.hour.Format("2006-01-02")
+			if days[key] == nil {
+				days[key] = &reportTrendDay{Day: key}
+			}
+			if sources[row.source] == nil {
+				sources[row.source] = &reportSource{Source: row.source}
+			}
+			days[key].Logs += row.count
+			sources[row.source].Logs += row.count
+			data.Logs += row.count
+			if containsString(groupedSeverities, row.severity) {
+				days[key].Errors += row.count
+				sources[row.source].Errors += row.count
+				data.Errors += row.count
+			}
+		}
+		busiest := 0
+		for _, day := range days {
+			data.Days = append(data.Days, *day)
+			if day.Errors > busiest {
+				busiest = day.Errors
+			}
+		}
+		sort.Slice(data.Days, func(i, j int) bool { return data.Days[i].Day < data.Days[j].Day })
+		for i := range data.Days {
+			if busiest > 0 {
+				data.Days[i].Width = data.Days[i].Errors * 100 / busiest
+			}
+		}
+		for _, source := range sources {
+			if source.Errors > 0 {
+				source.ErrorRate = roundTo(percent(source.Errors, source.Logs), 2)
+				data.TopSources = append(data.TopSources, *source)
+			}
+		}
+		sort.Slice(data.TopSources, func(i, j int) bool {
+			if data.TopSources[i].Errors != data.TopSources[j].Errors {
+				return data.TopSources[i].Errors > data.TopSources[j].Errors
+			}
+			return data.TopSources[i].Source < data.TopSources[j].Source
+		})
+		if len(data.TopSources) > 10 {
+			data.TopSources = data.TopSources[:10]
+		}
+	}
+
+	if data.Has("top_groups") {
+		groups, err := loadErrorGroups(data.From, 100)
+		if err != nil {
+			return data, err
+		}
+		for _, group := range groups {
+			if inScope(group.Source) && len(data.Groups) < 10 {
+				data.Groups = append(data.Groups, group)
+			}
+		}
+	}
+
+	if data.Has("slo") {
+		slos, err := loadSLOs()
+		if err != nil {
+			return data, err
+		}
+		var scoped []SLO
+		for _, slo := range slos {
+			if inScope(slo.Source) {
+				scoped = append(scoped, slo)
+			}
+		}
+		if data.SLOs, err = sloStatuses(scoped, to); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+// reportTemplate renders a report as a standalone page
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>CubicLog report: {{.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2937; max-width: 900px; margin: 2rem auto; padding: 0 1rem; }
+h1 { font-size: 1.5rem; margin-bottom: 0.25rem; }
+h2 { font-size: 1.15rem; margin-top: 2rem; border-bottom: 1px solid #e5e7eb; padding-bottom: 0.25rem; }
+.muted { color: #6b7280; font-size: 0.875rem; }
+table { width: 100%; border-collapse: collapse; font-size: 0.875rem; }
+th, td { text-align: left; padding: 0.35rem 0.5rem; border-bottom: 1px solid #f3f4f6; }
+td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { background: #ef4444; height: 0.75rem; border-radius: 2px; }
+.status-ok { color: #16a34a; } .status-slow_burn { color: #d97706; } .status-fast_burn, .status-exhausted { color: #dc2626; } .status-no_data { color: #6b7280; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p class="muted">{{date .From}} – {{date .To}}{{if .Sources}} · sources: {{range $i, $s := .Sources}}{{if $i}}, {{end}}{{$s}}{{end}}{{end}} · generated {{date .GeneratedAt}}</p>
+{{if .Has "error_trends"}}
+<h2>Error trends</h2>
+<p>{{.Errors}} errors in {{.Logs}} logs.</p>
+{{if .Days}}<table>
+<tr><th>Day</th><th class="num">Logs</th><th class="num">Errors</th><th style="width:40%"></th></tr>
+{{range .Days}}<tr><td>{{.Day}}</td><td class="num">{{.Logs}}</td><td class="num">{{.Errors}}</td><td><div class="bar" style="width: {{.Width}}%"></div></td></tr>
+{{end}}</table>{{end}}
+{{if .TopSources}}<table style="margin-top:1rem">
+<tr><th>Source</th><th class="num">Errors</th><th class="num">Logs</th><th class="num">Error rate</th></tr>
+{{range .TopSources}}<tr><td>{{.Source}}</td><td class="num">{{.Errors}}</td><td class="num">{{.Logs}}</td><td class="num">{{.ErrorRate}}%</td></tr>
+{{end}}</table>{{end}}
+{{end}}
+{{if .Has "top_groups"}}
+<h2>Top error groups</h2>
+{{if .Groups}}<table>
+<tr><th>Error</th><th>Source</th><th class="num">Count</th><th class="num">Users</th><th>Last seen</th></tr>
+{{range .Groups}}<tr><td>{{.Title}}</td><td>{{.Source}}</td><td class="num">{{.Count}}</td><td class="num">{{.Users}}</td><td>{{date .LastSeen}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">No errors in this period.</p>{{end}}
+{{end}}
+{{if .Has "slo"}}
+<h2>SLO status</h2>
+{{if .SLOs}}<table>
+<tr><th>Source</th><th>Status</th><th class="num">Objective</th><th class="num">Error rate</th><th class="num">Budget left</th></tr>
+{{range .SLOs}}<tr><td>{{.Source}}</td><td class="status-{{.Status}}">{{.Status}}</td><td class="num">≤ {{.MaxErrorRate}}% / {{.WindowDays}}d</td><td class="num">{{.ErrorRate}}%</td><td class="num">{{.BudgetRemaining}}%</td></tr>
+{{end}}</table>{{else}}<p class="muted">No SLOs defined.</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// renderReportPDF converts a report page with the -report-pdf-command
+func renderReportPDF(page []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportPDFTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, reportPDFCommand[0], reportPDFCommand[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(page), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("the PDF command wrote nothing")
+	}
+	return stdout.Bytes(), nil
+}
+
+// generateReport renders and stores a report ending at to
+func generateReport(report reportConfig, to time.Time) (GeneratedReport, error) {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+	data, err := buildReportData(report, to)
+	if err != nil {
+		return GeneratedReport{}, err
+	}
+	var page bytes.Buffer
+	if err := reportTemplate.Execute(&page, data); err != nil {
+		return GeneratedReport{}, err
+	}
+	pdf := ""
+	if report.PDF {
+		rendered, err := renderReportPDF(page.Bytes())
+		if err != nil {
+			// The HTML is still worth keeping
+			log.Printf("⚠️  PDF of report '%s' failed: %v", report.Name, err)
+		} else {
+			pdf = base64.StdEncoding.EncodeToString(rendered)
+		}
+	}
+
+	id, err := db.InsertID(`INSERT INTO reports (name, generated_at, period_from, period_to, html, pdf) VALUES (?, ?, ?, ?, ?, ?)`,
+		report.Name, dbTime(data.GeneratedAt), dbTime(data.From), dbTime(data.To), page.String(), pdf)
+	if err != nil {
+		return GeneratedReport{}, err
+	}
+	return generatedReport(id, report.Name, data.GeneratedAt, data.From, data.To, pdf != ""), nil
+}
+
+// generatedReport fills in the download links of a stored report
+func generatedReport(id int64, name string, generatedAt, from, to time.Time, hasPDF bool) GeneratedReport {
+	report := GeneratedReport{ID: id, Name: name, GeneratedAt: generatedAt, From: from, To: to,
+		HTMLURL: dashboardLink(fmt.Sprintf("/api/reports/%d.html", id))}
+	if hasPDF {
+		report.PDFURL = dashboardLink(fmt.Sprintf("/api/reports/%d.pdf", id))
+	}
+	return report
+}
+
+// loadGeneratedReports returns the latest generated reports, optionally of one name
+func loadGeneratedReports(name string, limit int) ([]GeneratedReport, error) {
+	query := "SELECT id, name, generated_at, period_from, period_to, pdf <> '' FROM reports"
+	var args []interface{}
+	if name != "" {
+		query += " WHERE name = ?"
+		args = append(args, name)
+	}
+	rows, err := db.Query(db.Rebind(query+" ORDER BY generated_at DESC, id DESC LIMIT ?"), append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reports := []GeneratedReport{}
+	for rows.Next() {
+		var id int64
+		var reportName string
+		var generatedAt, from, to time.Time
+		var hasPDF bool
+		if err := rows.Scan(&id, &reportName, (*scanTime)(&generatedAt), (*scanTime)(&from), (*scanTime)(&to), &hasPDF); err != nil {
+			return nil, err
+		}
+		reports = append(reports, generatedReport(id, reportName, generatedAt, from, to, hasPDF))
+	}
+	return reports, rows.Err()
+}
+
+// runDueReports generates the reports whose schedule fired in (last, now]
+func runDueReports(last, now time.Time) {
+	for _, report := range reportConfigs {
+		due := report.schedule.next(last.In(report.location))
+		if due.IsZero() || due.After(now) {
+			continue
+		}
+		generated, err := generateReport(report, due)
+		if err != nil {
+			log.Printf("⚠️  Report '%s' failed: %v", report.Name, err)
+			continue
+		}
+		log.Printf("📄 Report '%s' generated: %s", report.Name, generated.HTMLURL)
+	}
+}
+
+// startReportScheduler generates the configured reports in the background
+func startReportScheduler() {
+	if len(reportConfigs) == 0 {
+		return
+	}
+	go func() {
+		last := time.Now()
+		for now := range time.Tick(time.Minute) {
+			runDueReports(last, now)
+			last = now
+		}
+	}()
+}
+
+// pruneReports removes reports generated before the retention cutoff
+func pruneReports(cutoff time.Time) {
+	db.Exec(db.Rebind("DELETE FROM reports WHERE generated_at < ?"), dbTime(cutoff))
+}
+
+// handleReports answers GET and POST /api/reports
+func handleReports(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		name := r.URL.Query().Get("name")
+		reports, err := loadGeneratedReports(name, 50)
+		if err != nil {
+			http.Error(w, "Failed to load reports", http.StatusInternalServerError)
+			return
+		}
+		type scheduled struct {
+			reportConfig
+			NextRun time.Time `json:"next_run"`
+		}
+		schedules := []scheduled{}
+		for _, report := range reportConfigs {
+			if name == "" || report.Name == name {
+				schedules = append(schedules, scheduled{report, report.schedule.next(time.Now().In(report.location)).UTC()})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"schedules": schedules, "reports": reports})
+	case http.MethodPost:
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		report, ok := findReportConfig(request.Name)
+		if !ok {
+			http.Error(w, "Report not found in the -report-file", http.StatusNotFound)
+			return
+		}
+		generated, err := generateReport(report, time.Now())
+		if err != nil {
+			http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(generated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleReport answers GET /api/reports/{id}.html and /api/reports/{id}.pdf
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file := strings.TrimPrefix(r.URL.Path, "/api/reports/")
+	format := "html"
+	if strings.HasSuffix(file, ".pdf") {
+		format = "pdf"
+	}
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSuffix(file, ".html"), ".pdf"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	var name, page, pdf string
+	var generatedAt time.Time
+	err = db.QueryRow(db.Rebind("SELECT name, generated_at, html, pdf FROM reports WHERE id = ?"), id).
+		Scan(&name, (*scanTime)(&generatedAt), &page, &pdf)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load report", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("cubiclog-report-%s-%s.%s", strings.ReplaceAll(name, " ", "-"), generatedAt.Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+		return
+	}
+	content, err := base64.StdEncoding.DecodeString(pdf)
+	if pdf == "" || err != nil {
+		http.Error(w, "Report has no PDF", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Write(content)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestScheduledReports tests that reports are generated on schedule and downloadable
+func TestScheduledReports(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer loadReports("", "")
+
+	path := filepath.Join(t.TempDir(), "reports.json")
+	os.WriteFile(path, []byte(`{"reports": [{"name": "daily", "schedule": "0 8 * * *", "window": "24h", "sources": ["checkout"], "pdf": true}]}`), 0644)
+	if err := loadReports(path, ""); err == nil {
+		t.Error("Expected pdf without -report-pdf-command to be rejected")
+	}
+	if err := loadReports(path, "cat"); err != nil {
+		t.Fatalf("Failed to load reports: %v", err)
+	}
+
+	for _, body := range []string{
+		`{"header":{"type":"error","title":"Payment <script> declined","source":"checkout"}}`,
+		`{"header":{"type":"info","title":"Order placed","source":"checkout"}}`,
+		`{"header":{"type":"error","title":"Index rebuild failed","source":"search"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+	saveSLO(SLO{Source: "checkout", MaxErrorRate: 1, WindowDays: 30, UpdatedAt: time.Now()})
+
+	// Nothing is due before 08:00, one report at 08:00
+	morning := time.Date(2024, 5, 13, 7, 58, 0, 0, time.UTC)
+	runDueReports(morning, morning.Add(time.Minute))
+	runDueReports(morning.Add(time.Minute), morning.Add(2*time.Minute))
+	if reports, _ := loadGeneratedReports("", 10); len(reports) != 1 || !reports[0].To.Equal(morning.Add(2*time.Minute)) {
+		t.Fatalf("Expected one report for 08:00, got %+v", reports)
+	}
+
+	w := httptest.NewRecorder()
+	handleReports(w, httptest.NewRequest("POST", "/api/reports", strings.NewReader(`{"name": "daily"}`)))
+	if w.Code != 201 {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var generated GeneratedReport
+	json.NewDecoder(w.Body).Decode(&generated)
+	if generated.PDFURL == "" {
+		t.Errorf("Expected a PDF link, got %+v", generated)
+	}
+
+	w = httptest.NewRecorder()
+	handleReport(w, httptest.NewRequest("GET", generated.HTMLURL, nil))
+	page := w.Body.String()
+	for _, want := range []string{"Payment &lt;script&gt; declined", "Error trends", "SLO status", "checkout"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected the report to contain %q", want)
+		}
+	}
+	if strings.Contains(page, "Index rebuild failed") {
+		t.Error("Expected the search source to be left out")
+	}
+
+	w = httptest.NewRecorder()
+	handleReport(w, httptest.NewRequest("GET", generated.PDFURL, nil))
+	if w.Header().Get("Content-Type") != "application/pdf" || !bytes.Equal(w.Body.Bytes(), []byte(page)) {
+		t.Errorf("Expected the PDF command's output, got %q", w.Header().Get("Content-Type"))
+	}
+}
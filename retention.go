@@ -0,0 +1,281 @@
+// CubicLog Retention Preview - See what a cleanup would remove before it runs
+//
+//   - GET /api/retention/preview              rows and space each policy would
+//     reclaim right now; ?retention=N previews a different retention period
+//   - POST /api/retention/run?confirm=true    run the cleanup now (without
+//     confirm it answers 400 with the preview)
+//   - cubiclog -cleanup                       prints the preview and exits
+//   - cubiclog -cleanup -confirm              runs the cleanup
+//
+// Policies, in the order cleanup applies them:
+//   - partitions        monthly partition files older than the retention period
+//   - rollup            low-severity logs older than -rollup-after days, replaced
+//     by hourly counts
+//   - retention         remaining logs older than -retention days
+//   - rollup_retention  hourly counts older than -rollup-retention days
+//
+// Space is estimated from the size of the affected rows (partition files are
+// exact). SQLite reuses the freed pages for new logs rather than shrinking the
+// file.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logRetentionDays is the -retention setting, configured in main() and
+// changeable from the dashboard (see adminconfig.go) - read it with currentRetention()
+var (
+	logRetentionDays = 30
+	retentionMu      sync.RWMutex
+)
+
+// currentRetention returns the retention period in days
+func currentRetention() int {
+	retentionMu.RLock()
+	defer retentionMu.RUnlock()
+	return logRetentionDays
+}
+
+// setRetention changes the retention period; the next cleanup applies it
+func setRetention(days int) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+	logRetentionDays = days
+}
+
+// retentionRowOverhead approximates the per-row cost of ids, timestamps,
+// derived columns and index entries on top of the text columns
+const retentionRowOverhead = 96
+
+// retentionPolicy is what one policy would remove
+type retentionPolicy struct {
+	Policy         string `json:"policy"`
+	Description    string `json:"description"`
+	Rows           int64  `json:"rows"`
+	EstimatedBytes int64  `json:"estimated_bytes"`
+	Oldest         string `json:"oldest,omitempty"`
+}
+
+// retentionPreview is the result of a dry run
+type retentionPreview struct {
+	RetentionDays  int               `json:"retention_days"`
+	Cutoff         string            `json:"cutoff"`
+	Policies       []retentionPolicy `json:"policies"`
+	TotalRows      int64             `json:"total_rows"`
+	EstimatedBytes int64             `json:"total_estimated_bytes"`
+	Held           int64             `json:"held,omitempty"` // expired logs kept by legal holds
+}
+
+// rowSizeExpr estimates the stored size of a log row
+var rowSizeExpr = `LENGTH(COALESCE(type, '')) + LENGTH(COALESCE(title, '')) + LENGTH(COALESCE(description, '')) +
+	LENGTH(COALESCE(source, '')) + LENGTH(COALESCE(color, '')) + LENGTH(COALESCE(body, '')) + ` + strconv.Itoa(retentionRowOverhead)
+
+// rollupRowSize approximates the size of one hourly count row
+const rollupRowSize = 48
+
+// previewRetention computes what cleanupOldLogs(retentionDays) would remove
+func previewRetention(retentionDays int) (retentionPreview, error) {
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, -retentionDays)
+	preview := retentionPreview{RetentionDays: retentionDays, Cutoff: cutoff.UTC().Format(time.RFC3339)}
+
+	if partitionMode {
+		policy := retentionPolicy{Policy: "partitions", Description: "Delete monthly partition files older than " + cutoff.Format("2006-01")}
+		for _, month := range listPartitions() {
+			if month >= cutoff.Format("2006-01") || partitionHasHeldLogs(month) {
+				continue
+			}
+			if info, err := os.Stat(partitionPath(month)); err == nil {
+				policy.EstimatedBytes += info.Size()
+			}
+			if policy.Oldest == "" {
+				policy.Oldest = month
+			}
+			policy.Rows += partitionRowCount(month)
+		}
+		preview.Policies = append(preview.Policies, policy)
+	}
+
+	// Rollup runs first, so eligible logs are downsampled rather than deleted
+	rollupFilter, rollupArgs := "", []interface{}{}
+	if rollupAfterDays > 0 && len(rollupSeverities) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(rollupSeverities)), ", ")
+		rollupFilter = "timestamp < ? AND derived_severity IN (" + placeholders + ")"
+		rollupArgs = append(rollupArgs, now.AddDate(0, 0, -rollupAfterDays))
+		for _, severity := range rollupSeverities {
+			rollupArgs = append(rollupArgs, severity)
+		}
+
+		policy := retentionPolicy{Policy: "rollup", Description: fmt.Sprintf("Replace %s logs older than %d days with hourly counts",
+			strings.Join(rollupSeverities, "/"), rollupAfterDays)}
+		filter, args := excludeHeld(rollupFilter, rollupArgs)
+		if err := measureLogs(&policy, filter, args); err != nil {
+			return preview, err
+		}
+		preview.Policies = append(preview.Policies, policy)
+	}
+
+	policy := retentionPolicy{Policy: "retention", Description: fmt.Sprintf("Delete logs older than %d days", retentionDays)}
+	filter, args := "timestamp < ?", []interface{}{cutoff}
+	if rollupFilter != "" {
+		filter += " AND NOT (" + rollupFilter + ")"
+		args = append(args, rollupArgs...)
+	}
+	if held, heldArgs := heldCondition(); held != "" {
+		query := "SELECT COUNT(*) FROM logs WHERE timestamp < ? AND " + held
+		if err := db.QueryRow(db.Rebind(query), append([]interface{}{cutoff}, heldArgs...)...).Scan(&preview.Held); err != nil {
+			return preview, err
+		}
+	}
+	filter, args = excludeHeld(filter, args)
+	if err := measureLogs(&policy, filter, args); err != nil {
+		return preview, err
+	}
+	preview.Policies = append(preview.Policies, policy)
+
+	cutoffHour := now.AddDate(0, 0, -rollupRetentionDays).Format("2006-01-02 15")
+	policy = retentionPolicy{Policy: "rollup_retention", Description: fmt.Sprintf("Delete hourly counts older than %d days", rollupRetentionDays)}
+	var oldest *string
+	if err := db.QueryRow(db.Rebind("SELECT COUNT(*), MIN(hour) FROM log_rollups WHERE hour < ?"), cutoffHour).Scan(&policy.Rows, &oldest); err != nil {
+		return preview, err
+	}
+	if oldest != nil {
+		policy.Oldest = *oldest
+	}
+	policy.EstimatedBytes = policy.Rows * rollupRowSize
+	preview.Policies = append(preview.Policies, policy)
+
+	for _, policy := range preview.Policies {
+		preview.TotalRows += policy.Rows
+		preview.EstimatedBytes += policy.EstimatedBytes
+	}
+	return preview, nil
+}
+
+// measureLogs fills in the rows, size and oldest log matching a filter
+func measureLogs(policy *retentionPolicy, filter string, args []interface{}) error {
+	var oldest time.Time
+	query := "SELECT COUNT(*), COALESCE(SUM(" + rowSizeExpr + "), 0), MIN(timestamp) FROM logs WHERE " + filter
+	if err := db.QueryRow(db.Rebind(query), args...).Scan(&policy.Rows, &policy.EstimatedBytes, (*scanTime)(&oldest)); err != nil {
+		return err
+	}
+	if !oldest.IsZero() {
+		policy.Oldest = oldest.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// partitionRowCount counts the logs in a partition file
+func partitionRowCount(month string) int64 {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS expired", partitionPath(month)); err != nil {
+		return 0
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE expired")
+
+	var count int64
+	conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM expired.logs").Scan(&count)
+	return count
+}
+
+// handleRetentionPreview answers GET /api/retention/preview
+func handleRetentionPreview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	days := currentRetention()
+	if value := r.URL.Query().Get("retention"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "retention must be a positive number of days", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	preview, err := previewRetention(days)
+	if err != nil {
+		http.Error(w, "Failed to compute retention preview", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(preview)
+}
+
+// handleRetentionRun answers POST /api/retention/run
+func handleRetentionRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	days := currentRetention()
+	preview, err := previewRetention(days)
+	if err != nil {
+		http.Error(w, "Failed to compute retention preview", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if confirm, _ := strconv.ParseBool(r.URL.Query().Get("confirm")); !confirm {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "add confirm=true to run the cleanup",
+			"preview": preview,
+		})
+		return
+	}
+
+	cleanupOldLogs(days)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "completed", "removed": preview})
+}
+
+// handleCleanup runs -cleanup: a dry run unless confirmed
+func handleCleanup(retentionDays int, confirm bool) {
+	preview, err := previewRetention(retentionDays)
+	if err != nil {
+		fmt.Printf("❌ Retention preview failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🗑️  Retention preview (cutoff %s)\n", preview.Cutoff)
+	for _, policy := range preview.Policies {
+		fmt.Printf("   %-17s %8d rows  ~%s  %s\n", policy.Policy, policy.Rows, formatBytes(policy.EstimatedBytes), policy.Description)
+	}
+	fmt.Printf("   %-17s %8d rows  ~%s\n", "total", preview.TotalRows, formatBytes(preview.EstimatedBytes))
+	if preview.Held > 0 {
+		fmt.Printf("⚖️  %d expired logs are kept by legal holds (GET /api/admin/legal-holds)\n", preview.Held)
+	}
+
+	if !confirm {
+		fmt.Printf("ℹ️  Dry run - nothing was removed. Run with -cleanup -confirm to apply.\n")
+		return
+	}
+	cleanupOldLogs(retentionDays)
+	fmt.Printf("✅ Cleanup completed. Logs older than %d days removed.\n", retentionDays)
+}
+
+// formatBytes renders a byte count as B, KB, MB or GB
+func formatBytes(n int64) string {
+	size := float64(n)
+	for _, unit := range []string{"B", "KB", "MB"} {
+		if size < 1024 {
+			if unit == "B" {
+				return fmt.Sprintf("%d B", n)
+			}
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return fmt.Sprintf("%.1f GB", size)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRetentionPreview tests that the preview matches what a confirmed cleanup removes
+func TestRetentionPreview(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	rollupAfterDays = 7
+	defer func() { rollupAfterDays = 0 }()
+
+	for _, row := range []struct{ severity, timestamp string }{
+		{"info", "2020-03-01 10:00:00"},  // rolled up
+		{"error", "2020-03-01 11:00:00"}, // deleted
+		{"error", "2099-01-01 00:00:00"}, // kept
+	} {
+		db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+			VALUES (?, 'entry', 'blue', '{}', ?, ?, 'cron')`, row.severity, row.timestamp, row.severity)
+	}
+
+	w := httptest.NewRecorder()
+	handleRetentionPreview(w, httptest.NewRequest("GET", "/api/retention/preview", nil))
+	var preview retentionPreview
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	rows := map[string]int64{}
+	for _, policy := range preview.Policies {
+		rows[policy.Policy] = policy.Rows
+	}
+	if rows["rollup"] != 1 || rows["retention"] != 1 || preview.TotalRows != 2 || preview.EstimatedBytes <= 0 {
+		t.Errorf("Expected 1 rollup and 1 deletion, got %+v", preview)
+	}
+
+	// Nothing happens without confirmation
+	w = httptest.NewRecorder()
+	handleRetentionRun(w, httptest.NewRequest("POST", "/api/retention/run", nil))
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if w.Code != http.StatusBadRequest || count != 3 {
+		t.Errorf("Expected 400 and 3 logs left without confirm, got %d and %d", w.Code, count)
+	}
+
+	w = httptest.NewRecorder()
+	handleRetentionRun(w, httptest.NewRequest("POST", "/api/retention/run?confirm=true", nil))
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if w.Code != http.StatusOK || count != 1 {
+		t.Errorf("Expected 200 and 1 log left after a confirmed run, got %d and %d", w.Code, count)
+	}
+}
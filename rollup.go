@@ -0,0 +1,121 @@
+// CubicLog Rollups - Downsample old low-value logs into hourly counts
+//
+// Debug and info logs are useful for a few days and then mostly matter as
+// volume trends. With -rollup-after N, raw logs older than N days whose derived
+// severity is in -rollup-severities are replaced by one row per hour, source
+// and severity in the log_rollups table. /api/stats folds these counts back in,
+// so long-term totals and breakdowns survive without long-term row counts.
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// Rollup settings - configured once in main()
+var (
+	rollupAfterDays     int                         // 0 disables rollups
+	rollupSeverities    = []string{"debug", "info"} // severities eligible for downsampling
+	rollupRetentionDays = 365                       // how long hourly counts are kept
+)
+
+// createRollupTable creates the hourly aggregate table
+func createRollupTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS log_rollups (
+		hour     TEXT NOT NULL,            -- 'YYYY-MM-DD HH'
+		source   TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		count    INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (hour, source, severity)
+	);
+	CREATE INDEX IF NOT EXISTS idx_log_rollups_hour ON log_rollups(hour);
+	`)
+	return err
+}
+
+// parseSeverityList turns "debug,info" into a clean slice
+func parseSeverityList(value string) []string {
+	var severities []string
+	for _, severity := range strings.Split(value, ",") {
+		if severity = strings.TrimSpace(strings.ToLower(severity)); severity != "" {
+			severities = append(severities, severity)
+		}
+	}
+	return severities
+}
+
+// runRollup aggregates eligible raw logs older than the configured age and deletes them
+func runRollup() (int64, error) {
+	if rollupAfterDays <= 0 || len(rollupSeverities) == 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -rollupAfterDays)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(rollupSeverities)), ", ")
+	filter := "timestamp < ? AND derived_severity IN (" + placeholders + ")"
+
+	args := []interface{}{cutoff}
+	for _, severity := range rollupSeverities {
+		args = append(args, severity)
+	}
+	filter, args = excludeHeld(filter, args)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// substr over the text form of the timestamp yields 'YYYY-MM-DD HH' on both SQLite and PostgreSQL
+	if _, err := tx.Exec(db.Rebind(`
+		INSERT INTO log_rollups (hour, source, severity, count)
+		SELECT substr(CAST(timestamp AS TEXT), 1, 13), COALESCE(derived_source, 'unknown'), derived_severity, COUNT(*)
+		FROM logs
+		WHERE `+filter+`
+		GROUP BY substr(CAST(timestamp AS TEXT), 1, 13), COALESCE(derived_source, 'unknown'), derived_severity
+		ON CONFLICT (hour, source, severity) DO UPDATE SET count = log_rollups.count + excluded.count`), args...); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(db.Rebind("DELETE FROM logs WHERE "+filter), args...)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	rolled, _ := result.RowsAffected()
+	if rolled > 0 {
+		invalidateHourlyStats()
+		log.Printf("📉 Rolled up %d %s logs older than %d days into hourly counts",
+			rolled, strings.Join(rollupSeverities, "/"), rollupAfterDays)
+	}
+	return rolled, nil
+}
+
+// cleanupOldRollups removes hourly counts past the rollup retention period
+func cleanupOldRollups() {
+	cutoffHour := time.Now().AddDate(0, 0, -rollupRetentionDays).Format("2006-01-02 15")
+	result, err := db.Exec("DELETE FROM log_rollups WHERE hour < ?", cutoffHour)
+	if err != nil {
+		log.Printf("⚠️  Rollup cleanup error: %v", err)
+		return
+	}
+	if removed, _ := result.RowsAffected(); removed > 0 {
+		invalidateHourlyStats()
+	}
+}
+
+// startRollupJob runs the rollup every hour
+func startRollupJob() {
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := runRollup(); err != nil {
+				log.Printf("⚠️  Rollup error: %v", err)
+			}
+		}
+	}()
+}
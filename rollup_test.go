@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRollupOldLogs tests that aged info logs become hourly counts reflected in stats
+func TestRollupOldLogs(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	rollupAfterDays = 7
+	defer func() { rollupAfterDays = 0 }()
+
+	for i := 0; i < 3; i++ {
+		db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+			VALUES ('info', 'heartbeat', 'blue', '{}', '2020-03-01 10:15:00', 'info', 'cron')`)
+	}
+	db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+		VALUES ('error', 'crash', 'red', '{}', '2020-03-01 10:20:00', 'error', 'cron')`)
+
+	rolled, err := runRollup()
+	if err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	if rolled != 3 {
+		t.Errorf("Expected 3 rolled up logs, got %d", rolled)
+	}
+
+	var count int
+	db.QueryRow("SELECT count FROM log_rollups WHERE hour = '2020-03-01 10' AND source = 'cron' AND severity = 'info'").Scan(&count)
+	if count != 3 {
+		t.Errorf("Expected hourly count of 3, got %d", count)
+	}
+
+	// Error logs are kept raw, totals still include the rolled-up logs
+	w := httptest.NewRecorder()
+	handleStats(w, httptest.NewRequest("GET", "/api/stats", nil))
+	var stats map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if stats["total"].(float64) != 4 || stats["rolled_up"].(float64) != 3 {
+		t.Errorf("Expected total 4 with 3 rolled up, got %v / %v", stats["total"], stats["rolled_up"])
+	}
+}
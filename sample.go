@@ -0,0 +1,57 @@
+// CubicLog Sampling - Look at the shape of millions of logs without downloading them
+//
+//	GET /api/logs?sample=0.01&type=debug       about 1% of the debug logs
+//	GET /api/export/json?sample=0.001          about 0.1% of everything
+//
+// sample is a fraction between 0 and 1 and combines with every other filter.
+// Logs are picked by hashing their id rather than with RANDOM(), so the
+// database never sorts the whole table, pages of a sampled list don't overlap
+// and the same request returns the same subset. Repeat a request with another
+// sample_seed to look at a different subset of the same size.
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Id hashing: ids are multiplied by a large constant and reduced modulo a
+// prime, then squared modulo the prime again so the picked ids don't repeat in
+// a fixed stride; the hash spreads evenly over [0, sampleBuckets)
+const (
+	sampleMultiplier = 2654435761
+	sampleBuckets    = 1000003
+	maxSampleSeed    = 999999 // keeps (id + seed) * sampleMultiplier within 64 bits
+)
+
+// parseSample reads the sample and sample_seed parameters; rate 0 means no sampling
+func parseSample(params url.Values) (rate float64, seed int64, err error) {
+	if value := params.Get("sample"); value != "" {
+		rate, err = strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return 0, 0, fmt.Errorf("sample must be a number above 0 and at most 1")
+		}
+	}
+	if value := params.Get("sample_seed"); value != "" {
+		seed, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || seed < 0 || seed > maxSampleSeed {
+			return 0, 0, fmt.Errorf("sample_seed must be between 0 and %d", maxSampleSeed)
+		}
+	}
+	return rate, seed, nil
+}
+
+// sampleFilter returns the condition that keeps a rate share of the logs, or
+// nothing when rate is 0 or 1
+func sampleFilter(rate float64, seed int64) (string, []interface{}) {
+	if rate <= 0 || rate >= 1 {
+		return "", nil
+	}
+	threshold := int64(rate * sampleBuckets)
+	if threshold < 1 {
+		threshold = 1
+	}
+	spread := fmt.Sprintf("(((id + ?) * %d) %% %d)", sampleMultiplier, sampleBuckets)
+	return fmt.Sprintf(" AND (%s * %s) %% %d < ?", spread, spread, sampleBuckets), []interface{}{seed, seed, threshold}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogSampling tests the sample parameter on /api/logs and the exports
+func TestLogSampling(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 400; i++ {
+		req := httptest.NewRequest("POST", "/api/logs", strings.NewReader(`{"header":{"type":"debug","title":"Cache lookup"}}`))
+		createLog(httptest.NewRecorder(), req)
+	}
+	ids := func(query string) []int {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs?limit=1000&"+query, nil))
+		var logs []Log
+		json.NewDecoder(w.Body).Decode(&logs)
+		var ids []int
+		for _, l := range logs {
+			ids = append(ids, l.ID)
+		}
+		return ids
+	}
+
+	sampled := ids("sample=0.25")
+	if len(sampled) < 60 || len(sampled) > 140 {
+		t.Errorf("Expected about 100 of 400 logs in a 25%% sample, got %d", len(sampled))
+	}
+	again := ids("sample=0.25")
+	if len(again) != len(sampled) || (len(again) > 0 && again[0] != sampled[0]) {
+		t.Errorf("Expected the same sample for the same request")
+	}
+	if other := ids("sample=0.25&sample_seed=7"); len(other) == 0 || (len(other) == len(sampled) && other[0] == sampled[0] && other[len(other)-1] == sampled[len(sampled)-1]) {
+		t.Errorf("Expected another seed to pick another subset")
+	}
+	if all := ids("sample=1"); len(all) != 400 {
+		t.Errorf("Expected sample=1 to return every log, got %d", len(all))
+	}
+
+	w := httptest.NewRecorder()
+	handleExportJSON(w, httptest.NewRequest("GET", "/api/export/json?sample=0.25", nil))
+	var exported []Log
+	json.NewDecoder(w.Body).Decode(&exported)
+	if len(exported) != len(sampled) {
+		t.Errorf("Expected the export to sample like /api/logs (%d logs), got %d", len(sampled), len(exported))
+	}
+
+	for _, query := range []string{"sample=0", "sample=2", "sample=half", "sample=0.5&sample_seed=-1"} {
+		w := httptest.NewRecorder()
+		getLogs(w, httptest.NewRequest("GET", "/api/logs?"+query, nil))
+		if w.Code != 400 {
+			t.Errorf("Expected status 400 for %s, got %d", query, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	handleExportCSV(w, httptest.NewRequest("GET", "/api/export/csv?sample=2", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an invalid export sample, got %d", w.Code)
+	}
+}
@@ -0,0 +1,368 @@
+// CubicLog Security Analytics - Brute force, path scanning and 401 rates from access logs
+//
+//	GET /api/security/summary?hours=24&min_failures=10
+//	GET /api/security/rules
+//
+// The summary reads the logs of the last hours (default 24, at most 168; the
+// newest 10,000 logs) and looks at each one as an HTTP request: the client IP
+// comes from a body field (client_ip, ip, remote_addr, remote_ip,
+// x_forwarded_for) or the first IP address in the title, the path from a body
+// field (path, uri, request_uri, url) or an access log request line
+// ("GET /wp-login.php HTTP/1.1" 401), and the status from a body field (status,
+// status_code) or the usual status patterns. It reports:
+//
+//   - brute_force: client IPs with at least min_failures auth failures - a
+//     401, or text matching the auth_failure patterns ("invalid password",
+//     "login failed", ...)
+//   - scanners: client IPs requesting paths from the scan_paths patterns
+//     (/.env, /wp-admin, ../ ...), with the paths they tried
+//   - sources: per derived source, the requests carrying a status, how many
+//     were 401s and their share
+//
+// Both pattern lists can be changed at runtime like the other smart patterns
+// (see patterns.go). GET /api/security/rules returns escalation rule templates
+// (see escalation.go) that turn the same signals into alerts as logs arrive;
+// save the response as the -escalation-file and adjust the thresholds.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authentication failure patterns (a 401 counts too)
+var authFailurePatterns = []string{
+	"login failed", "failed login", "authentication failed", "auth failed",
+	"invalid password", "wrong password", "invalid credentials", "bad credentials",
+	"invalid username", "unknown user", "invalid api key", "unauthorized",
+}
+
+// Paths probed by vulnerability scanners
+var scanPathPatterns = []string{
+	"/.env", "/.git", "/.aws", "/.ssh", "/.htaccess", "/.ds_store",
+	"/wp-admin", "/wp-login", "/xmlrpc.php", "/phpmyadmin", "/pma/", "/admin.php",
+	"/cgi-bin", "/etc/passwd", "/server-status", "/actuator", "/vendor/phpunit",
+	"/boaform", "/config.json", "/backup.sql", "../", "..%2f", "%2e%2e",
+}
+
+// securityScanLimit caps the logs a summary reads
+const securityScanLimit = 10000
+
+// accessLogPattern matches the request line and status of an access log
+var accessLogPattern = regexp.MustCompile(`(?i)\b(?:GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS)\s+(\S+)\s+HTTP/[\d.]+"?\s+(\d{3})`)
+
+// ipPattern finds an IPv4 address in free text
+var ipPattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// accessEvent is what a log says about an HTTP request
+type accessEvent struct {
+	IP          string
+	Path        string
+	Status      int
+	AuthFailure bool
+	Scan        bool
+}
+
+// inspectAccess reads a log as an HTTP request
+func inspectAccess(header LogHeader, body map[string]interface{}) accessEvent {
+	var event accessEvent
+	text := header.Title + " " + header.Description
+
+	for _, field := range []string{"client_ip", "ip", "remote_addr", "remote_ip", "x_forwarded_for"} {
+		if ip := clientIP(bodyString(body, field)); ip != "" {
+			event.IP = ip
+			break
+		}
+	}
+	if event.IP == "" {
+		for _, candidate := range ipPattern.FindAllString(text, 3) {
+			if ip := clientIP(candidate); ip != "" {
+				event.IP = ip
+				break
+			}
+		}
+	}
+
+	requestLine := accessLogPattern.FindStringSubmatch(text)
+	for _, field := range []string{"path", "uri", "request_uri", "url"} {
+		if value := bodyString(body, field); value != "" {
+			event.Path = requestPath(value)
+			break
+		}
+	}
+	if event.Path == "" && requestLine != nil {
+		event.Path = requestPath(requestLine[1])
+	}
+
+	for _, field := range []string{"status", "status_code"} {
+		if status, err := strconv.Atoi(bodyString(body, field)); err == nil {
+			event.Status = status
+			break
+		}
+	}
+	if event.Status == 0 {
+		if requestLine != nil {
+			event.Status, _ = strconv.Atoi(requestLine[2])
+		} else {
+			event.Status, _ = strconv.Atoi(extractHTTPStatusCode(text))
+		}
+	}
+
+	patterns := livePatterns()
+	event.AuthFailure = event.Status == http.StatusUnauthorized || patterns.authFailureMatcher.containsAny(text)
+	event.Scan = event.Path != "" && patterns.scanPathMatcher.containsAny(event.Path)
+	return event
+}
+
+// bodyString returns a top-level body field as text
+func bodyString(body map[string]interface{}, field string) string {
+	switch value := body[field].(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
+
+// clientIP normalizes an address: the first of a forwarded list, without the port
+func clientIP(value string) string {
+	value, _, _ = strings.Cut(value, ",")
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// requestPath drops the scheme and host of a full URL, keeping the query
+func requestPath(value string) string {
+	if parsed, err := url.Parse(value); err == nil && parsed.Host != "" {
+		return parsed.RequestURI()
+	}
+	return value
+}
+
+// bruteForceIP is a client with many auth failures
+type bruteForceIP struct {
+	IP        string    `json:"ip"`
+	Failures  int       `json:"failures"`
+	Sources   []string  `json:"sources"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// scannerIP is a client probing for vulnerable paths
+type scannerIP struct {
+	IP       string    `json:"ip"`
+	Requests int       `json:"requests"`
+	Paths    []string  `json:"paths"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// sourceAuthStats is the 401 rate of one source
+type sourceAuthStats struct {
+	Source       string  `json:"source"`
+	Requests     int     `json:"requests"`
+	Unauthorized int     `json:"unauthorized"`
+	Rate         float64 `json:"unauthorized_rate"`
+	PerHour      float64 `json:"unauthorized_per_hour"`
+}
+
+// maxScannerPaths caps the paths listed per scanner
+const maxScannerPaths = 10
+
+// handleSecuritySummary answers GET /api/security/summary
+func handleSecuritySummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hours := parseIntParam(r, "hours", 24, 1, 168)
+	minFailures := parseIntParam(r, "min_failures", 10, 1, 100000)
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+
+	rows, release, err := queryLogs(since.Format("2006-01-02"), "", func(table string) (string, []interface{}) {
+		return db.Rebind("SELECT title, description, body, COALESCE(derived_source, 'unknown'), timestamp FROM " + table +
+			" WHERE timestamp >= ? ORDER BY timestamp DESC LIMIT " + strconv.Itoa(securityScanLimit)), []interface{}{dbTime(since)}
+	})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	failures := map[string]*bruteForceIP{}
+	scanners := map[string]*scannerIP{}
+	sources := map[string]*sourceAuthStats{}
+	scanned, authFailures := 0, 0
+	for rows.Next() {
+		var header LogHeader
+		var description sql.NullString
+		var bodyJSON, source string
+		var timestamp time.Time
+		if err := rows.Scan(&header.Title, &description, &bodyJSON, &source, (*scanTime)(&timestamp)); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		scanned++
+		header.Description = openField(description.String)
+		var body map[string]interface{}
+		if bodyJSON = openField(bodyJSON); bodyJSON != "" {
+			json.Unmarshal([]byte(bodyJSON), &body)
+		}
+
+		event := inspectAccess(header, body)
+		if event.Status > 0 {
+			stats := sources[source]
+			if stats == nil {
+				stats = &sourceAuthStats{Source: source}
+				sources[source] = stats
+			}
+			stats.Requests++
+			if event.Status == http.StatusUnauthorized {
+				stats.Unauthorized++
+			}
+		}
+		if event.AuthFailure {
+			authFailures++
+		}
+		if event.IP == "" {
+			continue
+		}
+
+		// Rows come newest first
+		if event.AuthFailure {
+			client := failures[event.IP]
+			if client == nil {
+				client = &bruteForceIP{IP: event.IP, Sources: []string{}, LastSeen: timestamp}
+				failures[event.IP] = client
+			}
+			client.Failures++
+			client.FirstSeen = timestamp
+			if !containsString(client.Sources, source) {
+				client.Sources = append(client.Sources, source)
+			}
+		}
+		if event.Scan {
+			client := scanners[event.IP]
+			if client == nil {
+				client = &scannerIP{IP: event.IP, Paths: []string{}, LastSeen: timestamp}
+				scanners[event.IP] = client
+			}
+			client.Requests++
+			if len(client.Paths) < maxScannerPaths && !containsString(client.Paths, event.Path) {
+				client.Paths = append(client.Paths, event.Path)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	bruteForce := []bruteForceIP{}
+	for _, client := range failures {
+		if client.Failures >= minFailures {
+			sort.Strings(client.Sources)
+			bruteForce = append(bruteForce, *client)
+		}
+	}
+	sort.Slice(bruteForce, func(i, j int) bool {
+		if bruteForce[i].Failures != bruteForce[j].Failures {
+			return bruteForce[i].Failures > bruteForce[j].Failures
+		}
+		return bruteForce[i].IP < bruteForce[j].IP
+	})
+
+	scanning := []scannerIP{}
+	for _, client := range scanners {
+		scanning = append(scanning, *client)
+	}
+	sort.Slice(scanning, func(i, j int) bool {
+		if scanning[i].Requests != scanning[j].Requests {
+			return scanning[i].Requests > scanning[j].Requests
+		}
+		return scanning[i].IP < scanning[j].IP
+	})
+
+	bySource := []sourceAuthStats{}
+	for _, stats := range sources {
+		stats.Rate = float64(stats.Unauthorized) / float64(stats.Requests)
+		stats.PerHour = float64(stats.Unauthorized) / float64(hours)
+		bySource = append(bySource, *stats)
+	}
+	sort.Slice(bySource, func(i, j int) bool {
+		if bySource[i].Unauthorized != bySource[j].Unauthorized {
+			return bySource[i].Unauthorized > bySource[j].Unauthorized
+		}
+		return bySource[i].Source < bySource[j].Source
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"hours":         hours,
+		"since":         since,
+		"scanned":       scanned,
+		"truncated":     scanned >= securityScanLimit,
+		"auth_failures": authFailures,
+		"brute_force":   bruteForce,
+		"scanners":      scanning,
+		"sources":       bySource,
+	})
+}
+
+// securityRuleTemplates are escalation rules alerting on the summary's signals
+var securityRuleTemplates = []escalationRule{
+	{
+		Name:       "brute-force",
+		Match:      escalationMatch{Access: "auth_failure"},
+		Threshold:  10,
+		Window:     "5m",
+		GroupBy:    "ip",
+		EscalateTo: "critical",
+		Cooldown:   "30m",
+	},
+	{
+		Name:       "path-scanning",
+		Match:      escalationMatch{Access: "scan"},
+		Threshold:  5,
+		Window:     "10m",
+		GroupBy:    "ip",
+		EscalateTo: "error",
+		Cooldown:   "1h",
+	},
+	{
+		Name:       "unauthorized-spike",
+		Match:      escalationMatch{Access: "unauthorized"},
+		Threshold:  50,
+		Window:     "5m",
+		GroupBy:    "source",
+		EscalateTo: "error",
+		Cooldown:   "15m",
+	},
+}
+
+// handleSecurityRules answers GET /api/security/rules with the templates in
+// the -escalation-file format
+func handleSecurityRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(map[string]interface{}{"rules": securityRuleTemplates})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSecuritySummary tests brute force, scanner and 401 detection in access logs
+func TestSecuritySummary(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	send := func(body string) {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		if w.Code != 201 {
+			t.Fatalf("Expected status 201, got %d", w.Code)
+		}
+	}
+	for i := 0; i < 12; i++ {
+		send(`{"header":{"title":"Login failed for admin","source":"auth"},"body":{"client_ip":"203.0.113.7:51234","status":401}}`)
+	}
+	for i := 0; i < 3; i++ {
+		send(`{"header":{"title":"Login failed for bob","source":"auth"},"body":{"ip":"198.51.100.2","status":401}}`)
+	}
+	for _, path := range []string{"/.env", "/wp-login.php", "/.git/config"} {
+		send(fmt.Sprintf(`{"header":{"title":"192.0.2.44 - - \"GET %s HTTP/1.1\" 404 153","source":"nginx"}}`, path))
+	}
+	send(`{"header":{"title":"Order placed","source":"checkout"},"body":{"status":200,"path":"/api/orders"}}`)
+
+	w := httptest.NewRecorder()
+	handleSecuritySummary(w, httptest.NewRequest("GET", "/api/security/summary", nil))
+	var summary struct {
+		Scanned      int               `json:"scanned"`
+		AuthFailures int               `json:"auth_failures"`
+		BruteForce   []bruteForceIP    `json:"brute_force"`
+		Scanners     []scannerIP       `json:"scanners"`
+		Sources      []sourceAuthStats `json:"sources"`
+	}
+	json.NewDecoder(w.Body).Decode(&summary)
+
+	if summary.Scanned != 19 || summary.AuthFailures != 15 {
+		t.Errorf("Expected 19 logs with 15 auth failures, got %d with %d", summary.Scanned, summary.AuthFailures)
+	}
+	if len(summary.BruteForce) != 1 || summary.BruteForce[0].IP != "203.0.113.7" || summary.BruteForce[0].Failures != 12 {
+		t.Errorf("Expected only 203.0.113.7 flagged for brute force, got %+v", summary.BruteForce)
+	}
+	if len(summary.Scanners) != 1 || summary.Scanners[0].IP != "192.0.2.44" || len(summary.Scanners[0].Paths) != 3 {
+		t.Errorf("Expected 192.0.2.44 listed as a scanner with 3 paths, got %+v", summary.Scanners)
+	}
+	if len(summary.Sources) == 0 || summary.Sources[0].Source != "auth" || summary.Sources[0].Unauthorized != 15 || summary.Sources[0].Rate != 1 {
+		t.Errorf("Expected auth first with 15 of 15 requests unauthorized, got %+v", summary.Sources)
+	}
+
+	// The rule templates must load as an escalation file
+	w = httptest.NewRecorder()
+	handleSecurityRules(w, httptest.NewRequest("GET", "/api/security/rules", nil))
+	var templates struct {
+		Rules []escalationRule `json:"rules"`
+	}
+	json.NewDecoder(w.Body).Decode(&templates)
+	for i := range templates.Rules {
+		if err := normalizeEscalationRule(&templates.Rules[i]); err != nil {
+			t.Errorf("Expected a valid rule template, got %v", err)
+		}
+	}
+	if len(templates.Rules) != len(securityRuleTemplates) {
+		t.Errorf("Expected %d rule templates, got %d", len(securityRuleTemplates), len(templates.Rules))
+	}
+
+	// brute-force counts per client IP
+	tracker := &escalationTracker{rules: templates.Rules[:1], windows: map[string]*escalationWindow{}}
+	header := LogHeader{Title: "Login failed for admin"}
+	var escalated *escalation
+	for i := 0; i < 10; i++ {
+		tracker.observe(time.Now(), header, map[string]interface{}{"ip": "198.51.100.9"}, LogMetadata{})
+		escalated = tracker.observe(time.Now(), header, map[string]interface{}{"ip": "203.0.113.7"}, LogMetadata{})
+	}
+	if escalated == nil || escalated.Group != "203.0.113.7" || escalated.Count != 10 {
+		t.Errorf("Expected the tenth failure from 203.0.113.7 to escalate, got %+v", escalated)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// TestSeedLogs tests that demo logs are varied and spread over the requested days
+func TestSeedLogs(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	inserted, err := seedLogs(1500, 14*24*time.Hour, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("Seeding failed: %v", err)
+	}
+	if inserted != 1500 {
+		t.Errorf("Expected 1500 inserted logs, got %d", inserted)
+	}
+
+	var count, severities, sources, days int
+	db.QueryRow("SELECT COUNT(*), COUNT(DISTINCT derived_severity), COUNT(DISTINCT derived_source), COUNT(DISTINCT date(timestamp)) FROM logs").
+		Scan(&count, &severities, &sources, &days)
+	if count != 1500 {
+		t.Errorf("Expected 1500 stored logs, got %d", count)
+	}
+	if severities < 4 {
+		t.Errorf("Expected at least 4 different severities, got %d", severities)
+	}
+	if sources < 4 {
+		t.Errorf("Expected at least 4 different sources, got %d", sources)
+	}
+	if days < 10 {
+		t.Errorf("Expected timestamps spread over at least 10 days, got %d", days)
+	}
+
+	var future int
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE timestamp > datetime('now')").Scan(&future)
+	if future != 0 {
+		t.Errorf("Expected no timestamps in the future, got %d", future)
+	}
+}
@@ -0,0 +1,405 @@
+// CubicLog Sentry - Point existing Sentry SDKs at CubicLog
+//
+//	SENTRY_DSN=http://<api key>@cubiclog:8080/1
+//
+// The DSN's public key is a CubicLog API key and the project ID a number of
+// your choice. The SDKs then send their events to:
+//   - POST /api/<project>/envelope/  (current SDKs)
+//   - POST /api/<project>/store/     (older SDKs, one JSON event)
+//
+// with the key in X-Sentry-Auth (or ?sentry_key= from browsers). Bodies may be
+// gzip or deflate compressed. Only error and message events are kept;
+// transactions, sessions, attachments and client reports are accepted and
+// dropped, as CubicLog isn't a tracing backend.
+//
+// Every event becomes one log, stored like a POST /api/logs:
+//   - title "<ExceptionType>: <message>" of the outermost exception, or the
+//     message of captureMessage events
+//   - severity from the event level (fatal is critical), error for exceptions
+//     without one - so exceptions land in error groups (see groups.go)
+//   - source from the "service" tag, "sentry-<project>" without one
+//   - the stack trace (innermost frame first), tags, user, release,
+//     environment, platform and SDK as body fields
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sentryPathPattern matches the store and envelope endpoints of a project
+var sentryPathPattern = regexp.MustCompile(`^/api/(\d+)/(store|envelope)/?$`)
+
+// sentryLevels maps Sentry levels to CubicLog severities
+var sentryLevels = map[string]string{
+	"fatal": "critical", "error": "error", "warning": "warning",
+	"info": "info", "log": "info", "debug": "debug",
+}
+
+// sentryEvent is the part of a Sentry event CubicLog keeps
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Logger      string                 `json:"logger"`
+	Release     string                 `json:"release"`
+	Environment string                 `json:"environment"`
+	ServerName  string                 `json:"server_name"`
+	Transaction string                 `json:"transaction"`
+	Culprit     string                 `json:"culprit"`
+	Message     json.RawMessage        `json:"message"`
+	LogEntry    *sentryMessage         `json:"logentry"`
+	Exception   json.RawMessage        `json:"exception"`
+	Tags        json.RawMessage        `json:"tags"`
+	User        map[string]interface{} `json:"user"`
+	Extra       map[string]interface{} `json:"extra"`
+	SDK         struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"sdk"`
+}
+
+// sentryMessage is a structured message ("logentry")
+type sentryMessage struct {
+	Formatted string `json:"formatted"`
+	Message   string `json:"message"`
+}
+
+// sentryException is one exception of an event (the last one is the outermost)
+type sentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Module     string `json:"module"`
+	Stacktrace *struct {
+		Frames []struct {
+			Function string `json:"function"`
+			Module   string `json:"module"`
+			Filename string `json:"filename"`
+			AbsPath  string `json:"abs_path"`
+			Lineno   int    `json:"lineno"`
+			Colno    int    `json:"colno"`
+		} `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// message returns the event's message ("" without one)
+func (e sentryEvent) message() string {
+	if e.LogEntry != nil {
+		if e.LogEntry.Formatted != "" {
+			return e.LogEntry.Formatted
+		}
+		return e.LogEntry.Message
+	}
+	var text string
+	if json.Unmarshal(e.Message, &text) == nil {
+		return text
+	}
+	var structured sentryMessage
+	if json.Unmarshal(e.Message, &structured) == nil {
+		if structured.Formatted != "" {
+			return structured.Formatted
+		}
+		return structured.Message
+	}
+	return ""
+}
+
+// exceptions returns the event's exceptions, sent as {"values": [...]} or a plain list
+func (e sentryEvent) exceptions() []sentryException {
+	var wrapped struct {
+		Values []sentryException `json:"values"`
+	}
+	if json.Unmarshal(e.Exception, &wrapped) == nil && len(wrapped.Values) > 0 {
+		return wrapped.Values
+	}
+	var list []sentryException
+	json.Unmarshal(e.Exception, &list)
+	return list
+}
+
+// tags returns the event's tags, sent as an object or a list of pairs
+func (e sentryEvent) tags() map[string]string {
+	tags := map[string]string{}
+	if json.Unmarshal(e.Tags, &tags) == nil {
+		return tags
+	}
+	var pairs [][]string
+	json.Unmarshal(e.Tags, &pairs)
+	for _, pair := range pairs {
+		if len(pair) == 2 {
+			tags[pair[0]] = pair[1]
+		}
+	}
+	return tags
+}
+
+// stackTrace formats the frames of an exception, innermost frame first
+func (x sentryException) stackTrace() string {
+	if x.Stacktrace == nil {
+		return ""
+	}
+	var lines []string
+	frames := x.Stacktrace.Frames
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := frames[i]
+		function := frame.Function
+		if function == "" {
+			function = "<anonymous>"
+		}
+		if frame.Module != "" {
+			function = frame.Module + "." + function
+		}
+		file := frame.Filename
+		if file == "" {
+			file = frame.AbsPath
+		}
+		position := fmt.Sprintf("%s:%d", file, frame.Lineno)
+		if frame.Colno > 0 {
+			position += fmt.Sprintf(":%d", frame.Colno)
+		}
+		lines = append(lines, fmt.Sprintf("    at %s (%s)", function, position))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toLog converts an event of a project into a log and its severity
+func (e sentryEvent) toLog(project string) (Log, string) {
+	exceptions := e.exceptions()
+	message := e.message()
+
+	severity, ok := sentryLevels[strings.ToLower(e.Level)]
+	if !ok {
+		severity = "info"
+		if len(exceptions) > 0 {
+			severity = "error"
+		}
+	}
+
+	body := map[string]interface{}{"sentry_project": project}
+	title, description := message, ""
+	if len(exceptions) > 0 {
+		outermost := exceptions[len(exceptions)-1]
+		title = outermost.Type
+		if outermost.Value != "" {
+			title = strings.TrimPrefix(title+": "+outermost.Value, ": ")
+		}
+		description = message
+		var chain []map[string]interface{}
+		for i := len(exceptions) - 1; i >= 0; i-- {
+			chain = append(chain, map[string]interface{}{"type": exceptions[i].Type, "value": exceptions[i].Value, "module": exceptions[i].Module})
+		}
+		body["exception"] = chain
+		if trace := outermost.stackTrace(); trace != "" {
+			body["stacktrace"] = outermost.Type + ": " + outermost.Value + "\n" + trace
+		}
+	}
+	if title == "" {
+		title = "Sentry event"
+	}
+	if description == "" {
+		description = e.Culprit
+	}
+
+	tags := e.tags()
+	for name, value := range map[string]string{
+		"event_id": e.EventID, "level": e.Level, "platform": e.Platform, "logger": e.Logger,
+		"release": e.Release, "server_name": e.ServerName, "transaction": e.Transaction,
+	} {
+		if value != "" {
+			body[name] = value
+		}
+	}
+	// Environments CubicLog can't store as such are kept as plain fields
+	if e.Environment != "" {
+		if _, err := normalizeEnvironment(e.Environment); err == nil {
+			body["environment"] = e.Environment
+		} else {
+			body["sentry_environment"] = e.Environment
+		}
+	}
+	if len(tags) > 0 {
+		body["tags"] = tags
+	}
+	if len(e.User) > 0 {
+		body["user"] = e.User
+	}
+	if len(e.Extra) > 0 {
+		body["extra"] = e.Extra
+	}
+	if e.SDK.Name != "" {
+		body["sdk"] = strings.TrimSpace(e.SDK.Name + " " + e.SDK.Version)
+	}
+
+	source := tags["service"]
+	if source == "" {
+		source = "sentry-" + project
+	}
+	logType := severity
+	if logType == "critical" {
+		logType = "error"
+	}
+	return Log{Header: LogHeader{
+		Type:        logType,
+		Title:       title,
+		Description: description,
+		Source:      source,
+		Color:       colorForLog(logType, LogMetadata{DerivedSeverity: severity, DerivedSource: source}),
+	}, Body: body}, severity
+}
+
+// sentryKey returns the public key of a Sentry request ("" without one)
+func sentryKey(r *http.Request) string {
+	for _, part := range strings.Split(strings.TrimPrefix(r.Header.Get("X-Sentry-Auth"), "Sentry "), ",") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok && name == "sentry_key" {
+			return value
+		}
+	}
+	return r.URL.Query().Get("sentry_key")
+}
+
+// sentryEnvelopeEvents returns the events of an envelope and the envelope's event ID
+func sentryEnvelopeEvents(body io.Reader) ([][]byte, string, error) {
+	reader := bufio.NewReader(body)
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	var header struct {
+		EventID string `json:"event_id"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(line), &header); err != nil {
+		return nil, "", fmt.Errorf("invalid envelope header")
+	}
+
+	var events [][]byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, "", err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return events, header.EventID, nil
+			}
+			continue
+		}
+		var item struct {
+			Type   string `json:"type"`
+			Length *int   `json:"length"`
+		}
+		if json.Unmarshal(bytes.TrimSpace(line), &item) != nil {
+			return nil, "", fmt.Errorf("invalid envelope item header")
+		}
+
+		// Payloads have the given length, or run to the end of the line
+		var payload []byte
+		if item.Length != nil {
+			if *item.Length < 0 || int64(*item.Length) > maxRequestBytes {
+				return nil, "", fmt.Errorf("invalid envelope item length")
+			}
+			payload = make([]byte, *item.Length)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				if isRequestTooLarge(err) {
+					return nil, "", err
+				}
+				return nil, "", fmt.Errorf("truncated envelope item")
+			}
+			reader.ReadBytes('\n')
+		} else {
+			payload, err = reader.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return nil, "", err
+			}
+		}
+		if item.Type == "event" {
+			events = append(events, bytes.TrimSpace(payload))
+		}
+	}
+}
+
+// handleSentry answers the Sentry store and envelope endpoints below /api/
+// (other unknown /api/ paths get a 404 as before)
+func handleSentry(apiKey string) http.HandlerFunc {
+	authenticated := authMiddleware(apiKey, receiveSentry)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sentryPathPattern.MatchString(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		// Browser SDKs send from the page's origin
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Sentry-Auth, Content-Encoding")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if key := sentryKey(r); key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		authenticated(w, r)
+	}
+}
+
+// receiveSentry stores the events of a store or envelope request
+func receiveSentry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	match := sentryPathPattern.FindStringSubmatch(r.URL.Path)
+	project, endpoint := match[1], match[2]
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	body, err := decodedBody(r, maxRequestBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	var events [][]byte
+	var eventID string
+	if endpoint == "envelope" {
+		events, eventID, err = sentryEnvelopeEvents(body)
+	} else {
+		var event []byte
+		event, err = io.ReadAll(body)
+		events = [][]byte{event}
+	}
+	if err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, fmt.Sprintf("Request too large - limit is %d bytes", maxRequestBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid Sentry payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, payload := range events {
+		var event sentryEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			http.Error(w, "Invalid Sentry event", http.StatusBadRequest)
+			return
+		}
+		if eventID == "" {
+			eventID = event.EventID
+		}
+		entry, severity := event.toLog(project)
+		status, _, message := ingestLog(r, entry, severity)
+		if status >= 300 {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", strconv.Itoa(secondsUntilQuotaReset()))
+			}
+			http.Error(w, message, status)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": eventID})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSentryIngestion tests storing events sent by Sentry SDKs
+func TestSentryIngestion(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	handler := handleSentry("secret")
+
+	// An envelope with an exception and a transaction, gzip compressed as the Python SDK sends it
+	event := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","level":"error","platform":"python","environment":"production",` +
+		`"tags":{"service":"checkout","region":"eu"},"exception":{"values":[{"type":"ValueError","value":"Card 4711 declined",` +
+		`"stacktrace":{"frames":[{"function":"handle","filename":"app.py","lineno":10},{"function":"charge","filename":"payments.py","lineno":42}]}}]}}`
+	envelope := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","sent_at":"2024-05-01T10:00:00Z"}` + "\n" +
+		`{"type":"event","length":` + strconv.Itoa(len(event)) + "}\n" + event + "\n" +
+		`{"type":"transaction"}` + "\n" + `{"spans":[]}` + "\n"
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(envelope))
+	gz.Close()
+
+	send := func(path, auth, encoding string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		r.Header.Set("X-Sentry-Auth", auth)
+		r.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	if w := send("/api/1/envelope/", "Sentry sentry_version=7, sentry_key=wrong", "gzip", compressed.Bytes()); w.Code != 401 {
+		t.Errorf("Expected status 401 for a wrong key, got %d", w.Code)
+	}
+	w := send("/api/1/envelope/", "Sentry sentry_version=7, sentry_key=secret, sentry_client=sentry.python/2.0", "gzip", compressed.Bytes())
+	var answer map[string]string
+	json.NewDecoder(w.Body).Decode(&answer)
+	if w.Code != 200 || answer["id"] != "9ec79c33ec9942ab8353589fcb2e04dc" {
+		t.Fatalf("Expected the envelope to be accepted, got %d %v", w.Code, answer)
+	}
+
+	var title, source, severity, environment, body string
+	db.QueryRow("SELECT title, source, derived_severity, COALESCE(environment, ''), body FROM logs").
+		Scan(&title, &source, &severity, &environment, &body)
+	if title != "ValueError: Card 4711 declined" || source != "checkout" || severity != "error" || environment != "production" {
+		t.Errorf("Unexpected log: %q %s %s %s", title, source, severity, environment)
+	}
+	if !strings.Contains(body, `at charge (payments.py:42)\n    at handle (app.py:10)`) {
+		t.Errorf("Expected the stack trace innermost frame first, got %s", body)
+	}
+	groups, _ := loadErrorGroups(time.Now().Add(-time.Hour), 10)
+	if len(groups) != 1 || groups[0].Source != "checkout" {
+		t.Errorf("Expected the exception in an error group, got %+v", groups)
+	}
+
+	// Older SDKs post a single event to the store endpoint, browsers pass the key in the URL
+	if w := send("/api/7/store/?sentry_key=secret", "", "", []byte(`{"message":"Cache warmed","level":"info"}`)); w.Code != 200 {
+		t.Fatalf("Expected the stored event to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+	db.QueryRow("SELECT title, source, derived_severity FROM logs ORDER BY id DESC LIMIT 1").Scan(&title, &source, &severity)
+	if title != "Cache warmed" || source != "sentry-7" || severity != "info" {
+		t.Errorf("Unexpected message log: %q %s %s", title, source, severity)
+	}
+
+	if w := send("/api/unknown", "", "", nil); w.Code != 404 {
+		t.Errorf("Expected status 404 for other /api/ paths, got %d", w.Code)
+	}
+}
+
+// TestSentryGzipLimit tests that compressed store and envelope requests are held to the request limit
+func TestSentryGzipLimit(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	originalLimit := maxRequestBytes
+	defer func() { maxRequestBytes = originalLimit }()
+	maxRequestBytes = 1024
+	handler := handleSentry("secret")
+
+	event := `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","message":"` + strings.Repeat("x", 64*1024) + `"}`
+	bodies := map[string]string{
+		"/api/1/store/":    event,
+		"/api/1/envelope/": `{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc"}` + "\n" + `{"type":"event"}` + "\n" + event + "\n",
+	}
+	for path, body := range bodies {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write([]byte(body))
+		gz.Close()
+
+		r := httptest.NewRequest("POST", path, bytes.NewReader(compressed.Bytes()))
+		r.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key=secret")
+		r.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != 413 {
+			t.Errorf("Expected 413 for %s, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
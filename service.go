@@ -0,0 +1,276 @@
+// CubicLog Service Install - Let the OS service manager run CubicLog
+//
+//	sudo ./cubiclog -install-service -port 9000 -retention 90
+//
+// Generates a service definition that starts this binary with the same flags
+// (minus -install-service) from the current directory, installs it, then
+// enables and starts it:
+//   - Linux: systemd unit /etc/systemd/system/cubiclog.service
+//   - macOS: launchd plist /Library/LaunchDaemons/io.mendex.cubiclog.plist
+//     (~/Library/LaunchAgents when not run as root)
+//
+// The service manager restarts CubicLog when it crashes and starts it at boot,
+// which the PID-file based -stop/-restart commands can't do. CubicLog settings
+// passed through environment variables are copied into the definition, so the
+// file is only readable by its owner. -uninstall-service stops and removes it.
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	systemdUnitPath = "/etc/systemd/system/cubiclog.service"
+	launchdLabel    = "io.mendex.cubiclog"
+)
+
+// settingEnvVars are the environment variables CubicLog reads settings from
+// besides the ones behind flags (flagEnvVars)
+var settingEnvVars = []string{
+	"CUBICLOG_ENCRYPTION_KEY", "CUBICLOG_SIGNING_KEY", "DOCKER_HOST",
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_ENDPOINT_URL",
+}
+
+// serviceEnvVars returns the environment variables copied into the service
+// definition: every flag's variable and the other settings, sorted
+func serviceEnvVars() []string {
+	names := append([]string{}, settingEnvVars...)
+	for _, name := range flagEnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceConfig describes how the service runs CubicLog
+type serviceConfig struct {
+	ExecPath string
+	WorkDir  string
+	Args     []string
+	Env      map[string]string
+	User     string // systemd only; empty runs as root
+}
+
+// currentServiceConfig captures the running command line and environment
+func currentServiceConfig(args []string) (serviceConfig, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return serviceConfig{}, err
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return serviceConfig{}, err
+	}
+
+	config := serviceConfig{
+		ExecPath: execPath,
+		WorkDir:  workDir,
+		Args:     serviceArgs(args),
+		Env:      make(map[string]string),
+		User:     os.Getenv("SUDO_USER"), // run as the user who invoked sudo, not root
+	}
+	for _, name := range serviceEnvVars() {
+		if value, ok := os.LookupEnv(name); ok {
+			config.Env[name] = value
+		}
+	}
+	return config, nil
+}
+
+// serviceArgs drops the service install flags from a command line
+func serviceArgs(args []string) []string {
+	kept := []string{}
+	for _, arg := range args {
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if strings.HasPrefix(arg, "-") && (name == "install-service" || name == "uninstall-service") {
+			continue
+		}
+		kept = append(kept, arg)
+	}
+	return kept
+}
+
+// sortedEnv returns environment variable names in a stable order
+func sortedEnv(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// systemdQuote quotes a word for ExecStart= and Environment= lines
+func systemdQuote(word string) string {
+	word = strings.ReplaceAll(word, "%", "%%")
+	if word != "" && !strings.ContainsAny(word, " \t\"'\\$;") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`).Replace(word) + `"`
+}
+
+// systemdUnit renders a systemd unit file
+func systemdUnit(config serviceConfig) string {
+	words := []string{systemdQuote(config.ExecPath)}
+	for _, arg := range config.Args {
+		words = append(words, systemdQuote(arg))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\nDescription=CubicLog\nAfter=network.target\n\n[Service]\nType=simple\n")
+	if config.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", config.User)
+	}
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", config.WorkDir)
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(words, " "))
+	b.WriteString("Restart=always\nRestartSec=5\n")
+	for _, name := range sortedEnv(config.Env) {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(name+"="+config.Env[name]))
+	}
+	b.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// launchdPlist renders a launchd property list
+func launchdPlist(config serviceConfig, logDir string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", launchdLabel)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, word := range append([]string{config.ExecPath}, config.Args...) {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(word))
+	}
+	b.WriteString("\t</array>\n")
+	fmt.Fprintf(&b, "\t<key>WorkingDirectory</key>\n\t<string>%s</string>\n", html.EscapeString(config.WorkDir))
+	if len(config.Env) > 0 {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, name := range sortedEnv(config.Env) {
+			fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", name, html.EscapeString(config.Env[name]))
+		}
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n\t<key>KeepAlive</key>\n\t<true/>\n")
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", html.EscapeString(filepath.Join(logDir, "cubiclog.log")))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", html.EscapeString(filepath.Join(logDir, "cubiclog.log")))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// launchdPlistPath returns where the plist goes: system-wide as root, per user otherwise
+func launchdPlistPath() (string, error) {
+	if os.Geteuid() == 0 {
+		return filepath.Join("/Library/LaunchDaemons", launchdLabel+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+}
+
+// runServiceCommand runs a service manager command, passing its output through
+func runServiceCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// handleInstallService implements the -install-service command
+func handleInstallService(args []string) {
+	config, err := currentServiceConfig(args)
+	if err != nil {
+		fmt.Printf("❌ Could not determine how CubicLog was started: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		if err := os.WriteFile(systemdUnitPath, []byte(systemdUnit(config)), 0600); err != nil {
+			fmt.Printf("❌ Could not write %s: %v (run with sudo)\n", systemdUnitPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("📝 Wrote %s\n", systemdUnitPath)
+		for _, command := range [][]string{{"daemon-reload"}, {"enable", "--now", "cubiclog"}} {
+			if err := runServiceCommand("systemctl", command...); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("✅ CubicLog installed and started - manage it with: systemctl status|restart|stop cubiclog\n")
+
+	case "darwin":
+		path, err := launchdPlistPath()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		os.MkdirAll(filepath.Dir(path), 0755)
+		runServiceCommand("launchctl", "unload", path) // replace a previous install; fails harmlessly otherwise
+		if err := os.WriteFile(path, []byte(launchdPlist(config, config.WorkDir)), 0600); err != nil {
+			fmt.Printf("❌ Could not write %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("📝 Wrote %s\n", path)
+		if err := runServiceCommand("launchctl", "load", "-w", path); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ CubicLog installed and started - manage it with: launchctl stop|start %s\n", launchdLabel)
+
+	default:
+		fmt.Printf("❌ -install-service supports systemd (Linux) and launchd (macOS), not %s\n", runtime.GOOS)
+		os.Exit(1)
+	}
+}
+
+// handleUninstallService implements the -uninstall-service command
+func handleUninstallService() {
+	switch runtime.GOOS {
+	case "linux":
+		if err := runServiceCommand("systemctl", "disable", "--now", "cubiclog"); err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+		if err := os.Remove(systemdUnitPath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("❌ Could not remove %s: %v (run with sudo)\n", systemdUnitPath, err)
+			os.Exit(1)
+		}
+		runServiceCommand("systemctl", "daemon-reload")
+
+	case "darwin":
+		path, err := launchdPlistPath()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if err := runServiceCommand("launchctl", "unload", "-w", path); err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("❌ Could not remove %s: %v\n", path, err)
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Printf("❌ -uninstall-service supports systemd (Linux) and launchd (macOS), not %s\n", runtime.GOOS)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ CubicLog service removed\n")
+}
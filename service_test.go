@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestServiceDefinitions tests the generated systemd unit and launchd plist
+func TestServiceDefinitions(t *testing.T) {
+	args := serviceArgs([]string{"-install-service", "-port", "9000", "--install-service=true", "-db", "/var/lib/cube log/logs.db"})
+	if strings.Join(args, "|") != "-port|9000|-db|/var/lib/cube log/logs.db" {
+		t.Errorf("Expected install flags to be dropped, got %v", args)
+	}
+
+	config := serviceConfig{
+		ExecPath: "/opt/cubiclog/cubiclog",
+		WorkDir:  "/opt/cubiclog",
+		Args:     args,
+		Env:      map[string]string{"API_KEY": "s3cret", "RETENTION_DAYS": "90"},
+		User:     "cubiclog",
+	}
+
+	unit := systemdUnit(config)
+	for _, expected := range []string{
+		`ExecStart=/opt/cubiclog/cubiclog -port 9000 -db "/var/lib/cube log/logs.db"`,
+		"User=cubiclog",
+		"WorkingDirectory=/opt/cubiclog",
+		"Environment=API_KEY=s3cret",
+		"Restart=always",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, expected) {
+			t.Errorf("Expected unit to contain %q, got:\n%s", expected, unit)
+		}
+	}
+
+	plist := launchdPlist(config, "/opt/cubiclog")
+	for _, expected := range []string{
+		"<string>io.mendex.cubiclog</string>",
+		"<string>/var/lib/cube log/logs.db</string>",
+		"<key>RETENTION_DAYS</key>",
+		"<key>KeepAlive</key>",
+	} {
+		if !strings.Contains(plist, expected) {
+			t.Errorf("Expected plist to contain %q, got:\n%s", expected, plist)
+		}
+	}
+}
+
+// TestServiceEnvVars tests that every environment variable CubicLog reads is copied into the service
+func TestServiceEnvVars(t *testing.T) {
+	copied := map[string]bool{}
+	for _, name := range serviceEnvVars() {
+		copied[name] = true
+	}
+	// Not a setting: who ran sudo, so the service doesn't run as root
+	ignored := map[string]bool{"SUDO_USER": true}
+
+	files, _ := filepath.Glob("*.go")
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", file, err)
+		}
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			switch fn := call.Fun.(type) {
+			case *ast.SelectorExpr:
+				if pkg, ok := fn.X.(*ast.Ident); !ok || pkg.Name != "os" || (fn.Sel.Name != "Getenv" && fn.Sel.Name != "LookupEnv") {
+					return true
+				}
+			case *ast.Ident:
+				if fn.Name != "getEnv" {
+					return true
+				}
+			default:
+				return true
+			}
+			literal, ok := call.Args[0].(*ast.BasicLit)
+			if !ok {
+				return true
+			}
+			name, _ := strconv.Unquote(literal.Value)
+			if !copied[name] && !ignored[name] {
+				t.Errorf("%s reads %s, which the service install doesn't copy", fset.Position(call.Pos()), name)
+			}
+			return true
+		})
+	}
+	for _, name := range []string{"READ_ONLY", "ATTACH", "REPLICATE_TO", "SPOOL_FILE", "QUOTA_FILE", "CUBICLOG_ENCRYPTION_KEY", "PARTITION"} {
+		if !copied[name] {
+			t.Errorf("Expected %s to be copied into the service", name)
+		}
+	}
+}
+
+// TestApplyFlagEnv tests that environment variables set flags unless the flag is given
+func TestApplyFlagEnv(t *testing.T) {
+	t.Setenv("PORT", "9000")
+	t.Setenv("READ_ONLY", "true")
+	t.Setenv("RETENTION_DAYS", "many")
+
+	fs := flag.NewFlagSet("cubiclog", flag.ContinueOnError)
+	port := fs.String("port", "8080", "")
+	readOnly := fs.Bool("read-only", false, "")
+	retention := fs.Int("retention", 30, "")
+	applyFlagEnv(fs)
+	if *port != "9000" || !*readOnly || *retention != 30 {
+		t.Errorf("Expected PORT and READ_ONLY applied and an invalid RETENTION_DAYS ignored, got %s %v %d", *port, *readOnly, *retention)
+	}
+	fs.Parse([]string{"-port", "7000"})
+	if *port != "7000" {
+		t.Errorf("Expected the given flag to win over PORT, got %s", *port)
+	}
+}
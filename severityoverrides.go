@@ -0,0 +1,172 @@
+// CubicLog Severity Overrides - Known-noisy systems stay out of critical alerting
+//
+// Rules are read from a JSON file given with -severity-overrides-file:
+//
+//	{
+//	  "rules": [
+//	    {"name": "backups-are-noise", "sources": ["cron-backup"], "max_severity": "warning"},
+//	    {"name": "pen-test", "sources": ["pen-test"], "categories": ["security"], "max_severity": "error"},
+//	    {"name": "payments-matter", "sources": ["payments"], "severities": ["warning"], "min_severity": "error"},
+//	    {"name": "staging-debug", "sources": ["staging-*"], "severity": "debug"}
+//	  ]
+//	}
+//
+// Every incoming log is checked after its metadata was derived (smart
+// detection, learned corrections, the -classifier, a client severity), and
+// the first matching rule changes its derived severity: max_severity caps it,
+// min_severity raises it to at least that, severity sets it. Severities rank
+// critical > error > warning > info > success > debug; others rank lowest.
+//
+// Match fields are all optional and combined with AND: sources compare
+// against the derived source (a trailing * matches a prefix), categories and
+// severities against the derived category and severity. Escalation rules (see
+// escalation.go) see the overridden severity, and can't escalate a log above
+// the cap of its rule either. The rule that applied is named in the
+// X-CubicLog-Severity-Override response header, dry runs included, and GET
+// /api/severity-overrides shows the rules and how many logs each changed.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// severityOverrideRanks orders severities like severityRank (see logsort.go)
+var severityOverrideRanks = map[string]int{"critical": 5, "error": 4, "warning": 3, "info": 2, "success": 1, "debug": 0}
+
+// severityOverrideRule is one entry of the -severity-overrides-file
+type severityOverrideRule struct {
+	Name        string   `json:"name"`
+	Sources     []string `json:"sources,omitempty"`
+	Categories  []string `json:"categories,omitempty"`
+	Severities  []string `json:"severities,omitempty"`
+	MaxSeverity string   `json:"max_severity,omitempty"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Severity    string   `json:"severity,omitempty"`
+
+	applied atomic.Int64 // stored logs whose severity the rule changed
+}
+
+// severityOverrides are the rules of the -severity-overrides-file (nil without one) - configured once in main()
+var severityOverrides []*severityOverrideRule
+
+// loadSeverityOverrides reads and validates the severity overrides file
+func loadSeverityOverrides(path string) error {
+	severityOverrides = nil
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read severity overrides file: %v", err)
+	}
+
+	var config struct {
+		Rules []*severityOverrideRule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid severity overrides file: %v", err)
+	}
+	for i, rule := range config.Rules {
+		if err := normalizeSeverityOverride(rule); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	severityOverrides = config.Rules
+	return nil
+}
+
+// normalizeSeverityOverride validates a rule and lower-cases its severities
+func normalizeSeverityOverride(rule *severityOverrideRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	actions := 0
+	for _, severity := range []*string{&rule.MaxSeverity, &rule.MinSeverity, &rule.Severity} {
+		if *severity = strings.ToLower(strings.TrimSpace(*severity)); *severity != "" {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("'%s': exactly one of max_severity, min_severity and severity is required", rule.Name)
+	}
+	for _, severity := range []string{rule.MaxSeverity, rule.MinSeverity} {
+		if _, known := severityOverrideRanks[severity]; severity != "" && !known {
+			return fmt.Errorf("'%s': %q can't be ranked - use critical, error, warning, info, success or debug", rule.Name, severity)
+		}
+	}
+	rule.Severities = parseSeverityList(strings.Join(rule.Severities, ","))
+	return nil
+}
+
+// matches reports whether a rule applies to a log's metadata
+func (rule *severityOverrideRule) matches(metadata LogMetadata) bool {
+	if len(rule.Sources) > 0 {
+		matched := false
+		for _, source := range rule.Sources {
+			if prefix, ok := strings.CutSuffix(source, "*"); (ok && strings.HasPrefix(metadata.DerivedSource, prefix)) || source == metadata.DerivedSource {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(rule.Categories) > 0 && !containsString(rule.Categories, metadata.DerivedCategory) {
+		return false
+	}
+	return len(rule.Severities) == 0 || containsString(rule.Severities, metadata.DerivedSeverity)
+}
+
+// overrideSeverity returns the severity a rule gives a log of the given one
+func (rule *severityOverrideRule) overrideSeverity(severity string) string {
+	switch {
+	case rule.Severity != "":
+		return rule.Severity
+	case rule.MaxSeverity != "" && severityOverrideRanks[severity] > severityOverrideRanks[rule.MaxSeverity]:
+		return rule.MaxSeverity
+	case rule.MinSeverity != "" && severityOverrideRanks[severity] < severityOverrideRanks[rule.MinSeverity]:
+		return rule.MinSeverity
+	}
+	return severity
+}
+
+// applySeverityOverride applies the first matching rule, returning it if it
+// changed the severity (nil otherwise)
+func applySeverityOverride(metadata LogMetadata) (LogMetadata, *severityOverrideRule) {
+	for _, rule := range severityOverrides {
+		if !rule.matches(metadata) {
+			continue
+		}
+		severity := rule.overrideSeverity(metadata.DerivedSeverity)
+		if severity == metadata.DerivedSeverity {
+			return metadata, nil
+		}
+		metadata.DerivedSeverity = severity
+		return metadata, rule
+	}
+	return metadata, nil
+}
+
+// handleSeverityOverrides answers GET /api/severity-overrides
+func handleSeverityOverrides(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type ruleView struct {
+		*severityOverrideRule
+		Applied int64 `json:"applied"`
+	}
+	rules := []ruleView{}
+	for _, rule := range severityOverrides {
+		rules = append(rules, ruleView{rule, rule.applied.Load()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rules": rules})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSeverityOverrides tests capping, raising and setting severities by source
+func TestSeverityOverrides(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { severityOverrides, escalations = nil, nil }()
+
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	os.WriteFile(path, []byte(`{"rules": [
+		{"name": "backups-are-noise", "sources": ["cron-backup"], "max_severity": "Warning"},
+		{"name": "payments-matter", "sources": ["pay*"], "severities": ["warning"], "min_severity": "error"},
+		{"name": "staging-debug", "sources": ["staging"], "severity": "debug"}]}`), 0644)
+	if err := loadSeverityOverrides(path); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	send := func(kind, source, title string) (string, string) {
+		body := `{"header":{"type":"` + kind + `","title":"` + title + `","source":"` + source + `"}}`
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		var severity string
+		db.QueryRow("SELECT derived_severity FROM logs WHERE title = ?", title).Scan(&severity)
+		return severity, w.Header().Get("X-CubicLog-Severity-Override")
+	}
+	if severity, rule := send("error", "cron-backup", "Backup failed"); severity != "warning" || rule != "backups-are-noise" {
+		t.Errorf("Expected the backup error capped at warning, got %s by '%s'", severity, rule)
+	}
+	if severity, rule := send("info", "cron-backup", "Backup started"); severity != "info" || rule != "" {
+		t.Errorf("Expected an info log under the cap to stay info, got %s by '%s'", severity, rule)
+	}
+	if severity, rule := send("warning", "payments", "Card declined"); severity != "error" || rule != "payments-matter" {
+		t.Errorf("Expected the payments warning raised to error, got %s by '%s'", severity, rule)
+	}
+	if severity, _ := send("info", "payments", "Card charged"); severity != "info" {
+		t.Errorf("Expected a payments info log not to match, got %s", severity)
+	}
+	if severity, _ := send("critical", "staging", "Staging down"); severity != "debug" {
+		t.Errorf("Expected staging logs set to debug, got %s", severity)
+	}
+
+	// Escalations can't raise a log above its cap
+	escalationsPath := filepath.Join(t.TempDir(), "escalations.json")
+	os.WriteFile(escalationsPath, []byte(`{"rules": [{"name": "flood", "threshold": 1, "window": "1m"}]}`), 0644)
+	if err := loadEscalationRules(escalationsPath); err != nil {
+		t.Fatalf("Failed to load escalation rules: %v", err)
+	}
+	if severity, rule := send("warning", "cron-backup", "Backup slow"); severity != "warning" || rule != "backups-are-noise" {
+		t.Errorf("Expected the escalated backup warning capped at warning, got %s by '%s'", severity, rule)
+	}
+
+	w := httptest.NewRecorder()
+	handleSeverityOverrides(w, httptest.NewRequest("GET", "/api/severity-overrides", nil))
+	var listed struct {
+		Rules []struct {
+			Name    string `json:"name"`
+			Applied int64  `json:"applied"`
+		} `json:"rules"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Rules) != 3 || listed.Rules[0].Applied != 2 || listed.Rules[1].Applied != 1 {
+		t.Errorf("Expected the rules with their counts, got %+v", listed.Rules)
+	}
+
+	for _, invalid := range []string{
+		`{"rules": [{"sources": ["a"], "max_severity": "warning"}]}`,
+		`{"rules": [{"name": "both", "max_severity": "warning", "severity": "info"}]}`,
+		`{"rules": [{"name": "unranked", "max_severity": "loud"}]}`,
+	} {
+		os.WriteFile(path, []byte(invalid), 0644)
+		if err := loadSeverityOverrides(path); err == nil {
+			t.Errorf("Expected %s to be refused", invalid)
+		}
+	}
+}
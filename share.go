@@ -0,0 +1,242 @@
+// CubicLog Share Links - "Here are the relevant logs" for a ticket
+//
+//	POST /api/shares    {"filters": {"query": "timeout", "source": "checkout", "date": "2024-01-31"}, "ttl": "72h", "read_only": true}
+//	→ {"url": "https://logs.example.com/share/csh_eyJ...", "filters": {...}, "expires_at": "...", "read_only": true}
+//	GET  /share/{token}    the dashboard showing the shared logs (public)
+//
+// A share link carries its filters (query, type, severity, source,
+// environment, release, date) in a token signed with the signing key (see
+// signing.go), so nothing is stored, the filters can't be edited and every
+// instance sharing the key opens it. With a ttl the link expires.
+//
+// By default the link only opens the dashboard on the filters, and the
+// recipient reads the logs with their own access. A read_only link also lets
+// anyone holding it read the matching logs without an API key: the dashboard
+// sends the token, and GET /api/logs then returns only logs matching the
+// shared filters, whatever the request asks for. Nothing else accepts the
+// token. The access can't be revoked short of rotating the signing key, so
+// read-only links expire after 7 days by default and 30 days at most.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// shareTokenPrefix marks share tokens in links and the Authorization header
+const shareTokenPrefix = "csh_"
+
+// Read-only share link lifetimes
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// Share token errors
+var (
+	errInvalidShareToken = errors.New("invalid share link")
+	errExpiredShareToken = errors.New("this share link has expired")
+)
+
+// shareFilters are the log filters a link shares
+type shareFilters struct {
+	Query       string `json:"query,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Release     string `json:"release,omitempty"`
+	Date        string `json:"date,omitempty"` // YYYY-MM-DD
+}
+
+// shareClaims is the signed content of a share token
+type shareClaims struct {
+	Filters  shareFilters `json:"f"`
+	Expires  int64        `json:"exp,omitempty"` // unix seconds, 0 = never
+	ReadOnly bool         `json:"ro,omitempty"`
+}
+
+// normalize validates the filters and trims them
+func (f *shareFilters) normalize() error {
+	for _, value := range []*string{&f.Query, &f.Type, &f.Severity, &f.Source, &f.Environment, &f.Release, &f.Date} {
+		*value = strings.TrimSpace(*value)
+		if len(*value) > 200 {
+			return fmt.Errorf("filters must be at most 200 characters")
+		}
+	}
+	if *f == (shareFilters{}) {
+		return fmt.Errorf("at least one filter is required")
+	}
+	if f.Date != "" && !datePattern.MatchString(f.Date) {
+		return fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	if f.Environment != "" {
+		environment, err := normalizeEnvironment(f.Environment)
+		if err != nil {
+			return err
+		}
+		f.Environment = environment
+	}
+	return nil
+}
+
+// logParams returns the filters as GET /api/logs parameters
+func (f shareFilters) logParams() url.Values {
+	params := url.Values{}
+	for name, value := range map[string]string{"q": f.Query, "type": f.Type, "severity": f.Severity, "source": f.Source,
+		"environment": f.Environment, "release": f.Release, "from": f.Date} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	return params
+}
+
+// mintShareToken returns a signed share token
+func mintShareToken(claims shareClaims) (string, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	signature, err := signPayload([]byte(payload))
+	if err != nil {
+		return "", err
+	}
+	return shareTokenPrefix + payload + "." + strings.TrimPrefix(signature, signaturePrefix), nil
+}
+
+// parseShareToken checks a share token's signature and expiry
+func parseShareToken(token string, now time.Time) (shareClaims, error) {
+	var claims shareClaims
+	payload, signature, ok := strings.Cut(strings.TrimPrefix(token, shareTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, shareTokenPrefix) || !verifyPayload([]byte(payload), signaturePrefix+signature) {
+		return claims, errInvalidShareToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(decoded, &claims) != nil || claims.Filters == (shareFilters{}) {
+		return claims, errInvalidShareToken
+	}
+	if claims.Expires != 0 && now.Unix() >= claims.Expires {
+		return claims, errExpiredShareToken
+	}
+	return claims, nil
+}
+
+// shareAuthMiddleware accepts read-only share tokens for GET requests, limited
+// to the shared logs, and falls back to ingestAuthMiddleware
+func shareAuthMiddleware(apiKey string, handler http.HandlerFunc) http.HandlerFunc {
+	authenticated := ingestAuthMiddleware(apiKey, handler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := requestAPIKey(r)
+		if !strings.HasPrefix(token, shareTokenPrefix) {
+			authenticated(w, r)
+			return
+		}
+		claims, err := parseShareToken(token, time.Now())
+		if err != nil || !claims.ReadOnly || r.Method != http.MethodGet {
+			http.Error(w, "Unauthorized - Invalid or expired share link", http.StatusUnauthorized)
+			return
+		}
+
+		// Paging and sorting are up to the client, the filters are not
+		params := claims.Filters.logParams()
+		for _, name := range []string{"limit", "offset", "sort", "order", "id", "since_id"} {
+			if value := r.URL.Query().Get(name); value != "" {
+				params.Set(name, value)
+			}
+		}
+		shared := r.Clone(r.Context())
+		shared.URL.RawQuery = params.Encode()
+		shared.Header.Del("Authorization")
+		handler(w, shared)
+	}
+}
+
+// handleShares answers POST /api/shares
+func handleShares(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var request struct {
+		Filters  shareFilters `json:"filters"`
+		TTL      string       `json:"ttl"`
+		ReadOnly bool         `json:"read_only"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := request.Filters.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if request.ReadOnly {
+		ttl = defaultShareTTL
+	}
+	if request.TTL != "" {
+		parsed, err := time.ParseDuration(request.TTL)
+		if err != nil || parsed <= 0 || (request.ReadOnly && parsed > maxShareTTL) {
+			http.Error(w, fmt.Sprintf("ttl must be a positive duration, up to %s for read-only links", maxShareTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+
+	claims := shareClaims{Filters: request.Filters, ReadOnly: request.ReadOnly}
+	response := map[string]interface{}{"filters": request.Filters, "read_only": request.ReadOnly}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl).Truncate(time.Second)
+		claims.Expires = expires.Unix()
+		response["expires_at"] = expires.UTC().Format(time.RFC3339)
+	}
+	token, err := mintShareToken(claims)
+	if err != nil {
+		http.Error(w, "Failed to sign share link", http.StatusInternalServerError)
+		return
+	}
+	response["url"] = dashboardLink("/share/" + token)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleSharePage serves /share/{token}: the dashboard on the shared filters
+func handleSharePage(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/share/")
+	claims, err := parseShareToken(token, time.Now())
+	switch {
+	case errors.Is(err, errExpiredShareToken):
+		http.Error(w, "This share link has expired", http.StatusGone)
+		return
+	case err != nil:
+		http.NotFound(w, r)
+		return
+	}
+
+	share := map[string]interface{}{"read_only": claims.ReadOnly, "filters": claims.Filters}
+	if claims.ReadOnly {
+		share["token"] = token
+	}
+	if claims.Expires != 0 {
+		share["expires_at"] = time.Unix(claims.Expires, 0).UTC().Format(time.RFC3339)
+	}
+	serveDashboardFocused(w, map[string]interface{}{
+		"query":       claims.Filters.Query,
+		"type":        claims.Filters.Type,
+		"environment": claims.Filters.Environment,
+		"date":        claims.Filters.Date,
+		"share":       share,
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestShareLinks tests minting share links and reading logs with a read-only one
+func TestShareLinks(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureSigning("", ":memory:", "sqlite3")
+
+	for _, body := range []string{
+		`{"header":{"title":"Checkout timeout","source":"checkout"}}`,
+		`{"header":{"title":"Payment timeout","source":"payments"}}`,
+		`{"header":{"title":"Checkout completed","source":"checkout"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	share := func(body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		handleShares(w, httptest.NewRequest("POST", "/api/shares", strings.NewReader(body)))
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	code, response := share(`{"filters":{"query":"timeout","source":"checkout"},"read_only":true}`)
+	link, _ := response["url"].(string)
+	if code != http.StatusCreated || !strings.HasPrefix(link, "/share/"+shareTokenPrefix) || response["expires_at"] == nil {
+		t.Fatalf("Expected a read-only link expiring by default, got %d: %v", code, response)
+	}
+	token := strings.TrimPrefix(link, "/share/")
+
+	w := httptest.NewRecorder()
+	handleSharePage(w, httptest.NewRequest("GET", link, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"token":"`+token+`"`) {
+		t.Errorf("Expected the dashboard focused on the share, got %d", w.Code)
+	}
+
+	// The token reads only the shared logs, whatever the request asks for
+	handler := shareAuthMiddleware("server-key", handleLogs)
+	read := func(method, token, query string) (int, []Log) {
+		req := httptest.NewRequest(method, "/api/logs"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		var logs []Log
+		json.Unmarshal(w.Body.Bytes(), &logs)
+		return w.Code, logs
+	}
+	code, logs := read("GET", token, "?q=completed&source=payments")
+	if code != http.StatusOK || len(logs) != 1 || logs[0].Header.Title != "Checkout timeout" {
+		t.Errorf("Expected only the shared log, got %d: %+v", code, logs)
+	}
+	if code, _ := read("POST", token, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected share tokens to be refused for writing, got %d", code)
+	}
+	if code, _ := read("GET", "server-key", "?q=completed"); code != http.StatusOK {
+		t.Errorf("Expected the API key to keep working, got %d", code)
+	}
+
+	// Links without read_only only open the dashboard
+	code, response = share(`{"filters":{"type":"error"}}`)
+	if code != http.StatusCreated || response["expires_at"] != nil {
+		t.Fatalf("Expected a link that doesn't expire, got %d: %v", code, response)
+	}
+	if code, _ := read("GET", strings.TrimPrefix(response["url"].(string), "/share/"), ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a link without read_only to be refused, got %d", code)
+	}
+
+	expired, _ := mintShareToken(shareClaims{Filters: shareFilters{Query: "timeout"}, Expires: time.Now().Add(-time.Minute).Unix(), ReadOnly: true})
+	forged := token[:len(token)-1] + map[bool]string{true: "1", false: "0"}[strings.HasSuffix(token, "0")]
+	for path, want := range map[string]int{"/share/" + expired: http.StatusGone, "/share/" + forged: http.StatusNotFound, "/share/": http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		handleSharePage(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("Expected %d for %.20s, got %d", want, path, w.Code)
+		}
+	}
+	if code, _ := read("GET", expired, ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired token to be refused, got %d", code)
+	}
+
+	for _, body := range []string{`{"filters":{}}`, `{"filters":{"date":"31.01.2024"}}`, `{"filters":{"query":"x"},"read_only":true,"ttl":"2000h"}`} {
+		if code, _ := share(body); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, code)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// CubicLog Shippers - Receive logs from Vector and AWS Firehose
+//
+//	POST /api/ingest/vector    Vector's http sink
+//	POST /api/ingest/firehose  Amazon Data Firehose HTTP endpoint delivery
+//
+// Vector (with an API key as bearer token):
+//
+//	[sinks.cubiclog]
+//	type = "http"
+//	inputs = ["app_logs"]
+//	uri = "http://cubiclog:8080/api/ingest/vector"
+//	encoding.codec = "json"
+//	compression = "gzip"
+//	auth.strategy = "bearer"
+//	auth.token = "${CUBICLOG_API_KEY}"
+//
+// Bodies may be a JSON array of events, newline-delimited JSON or plain text
+// lines (codec = "text"), optionally gzip or deflate compressed. Firehose
+// streams use an API key as the endpoint's access key; records may hold the
+// same formats, gzip compressed or not, and CloudWatch Logs subscription data
+// is unpacked into one log per log event (source: the last part of the log
+// group, "/aws/lambda/checkout" is "checkout").
+//
+// Events that already are CubicLog logs ({"header": ..., "body": ...}) are
+// stored as they are. Other events are stored with their message's first line
+// as title and every field in the body, and go through the smart defaults for
+// type, source and severity; a message that is itself a JSON object adds its
+// fields to the body. Vector gets the stored IDs and an acknowledgment per
+// event with its id, status and derived metadata (see ingestack.go), Firehose the acknowledgement
+// it expects ({"requestId": ..., "timestamp": ...}). Every event is handled on
+// its own: one that can't be stored is acknowledged as rejected with the reason
+// and the rest of the batch is still stored. Only when no event of a batch
+// could be stored does the request fail with that status, so the shipper
+// retries it without storing anything twice.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// decodedBody decompresses a request body as told by Content-Encoding. The
+// decompressed stream is capped at limit bytes like the body itself (see
+// cappedReader), so a small compressed body can't expand without bound.
+func decodedBody(r *http.Request, limit int64) (io.Reader, error) {
+	var decoded io.Reader
+	var err error
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip":
+		decoded, err = gzip.NewReader(r.Body)
+	case "deflate":
+		decoded, err = zlib.NewReader(r.Body)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %s - use gzip or deflate", r.Header.Get("Content-Encoding"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cappedReader{r: io.LimitReader(decoded, limit+1), limit: limit}, nil
+}
+
+// cappedReader fails with an *http.MaxBytesError once more than limit bytes
+// were read, so isRequestTooLarge answers 413 for it as for the raw body
+type cappedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.limit {
+		return n - int(c.read-c.limit), &http.MaxBytesError{Limit: c.limit}
+	}
+	return n, err
+}
+
+// shippedMessageFields hold an event's message, in order of preference
+var shippedMessageFields = []string{"message", "msg", "log", "title"}
+
+// parseShippedEvents splits a JSON array, newline-delimited JSON or text lines into events
+func parseShippedEvents(data []byte) ([]map[string]interface{}, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] == '[' {
+		var events []map[string]interface{}
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, fmt.Errorf("invalid JSON array of events")
+		}
+		return events, nil
+	}
+
+	var events []map[string]interface{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		event := map[string]interface{}{}
+		if line[0] != '{' || json.Unmarshal(line, &event) != nil {
+			event = map[string]interface{}{"message": string(line)}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// shippedEventLog converts a shipped event into a log
+func shippedEventLog(event map[string]interface{}) Log {
+	// Events already in CubicLog's format
+	if header, ok := event["header"].(map[string]interface{}); ok && header["title"] != nil {
+		var entry Log
+		if raw, err := json.Marshal(event); err == nil && json.Unmarshal(raw, &entry) == nil {
+			return entry
+		}
+	}
+
+	// Structured logs written as one JSON line
+	if message, ok := event["message"].(string); ok && strings.HasPrefix(strings.TrimSpace(message), "{") {
+		var fields map[string]interface{}
+		if json.Unmarshal([]byte(message), &fields) == nil {
+			delete(event, "message")
+			for name, value := range fields {
+				if _, taken := event[name]; !taken {
+					event[name] = value
+				}
+			}
+		}
+	}
+
+	title := ""
+	for _, field := range shippedMessageFields {
+		if message, ok := event[field].(string); ok && strings.TrimSpace(message) != "" {
+			title, _, _ = strings.Cut(strings.TrimSpace(message), "\n")
+			break
+		}
+	}
+	if title == "" {
+		title = "Shipped event"
+		if sourceType, ok := event["source_type"].(string); ok && sourceType != "" {
+			title = sourceType + " event"
+		}
+	}
+	return Log{Header: LogHeader{Title: truncateTitle(strings.TrimSpace(title))}, Body: event}
+}
+
+// ingestShippedEvents stores events one by one through ingestLog; failed events
+// are acknowledged as rejected. The status and message are those of the first
+// failure when no event was accepted, http.StatusOK otherwise.
+func ingestShippedEvents(r *http.Request, events []map[string]interface{}) ([]ingestAck, int, string) {
+	items := []ingestAck{}
+	accepted, failedStatus, failedMessage := 0, 0, ""
+	for i, event := range events {
+		status, ack, message := ingestLog(r, shippedEventLog(event), "")
+		if status >= 300 {
+			if failedStatus == 0 {
+				failedStatus, failedMessage = status, fmt.Sprintf("Event %d: %s", i+1, message)
+			}
+		} else {
+			accepted++
+		}
+		ack.Index = i
+		items = append(items, ack)
+	}
+	if accepted == 0 && failedStatus != 0 {
+		return items, failedStatus, failedMessage
+	}
+	return items, http.StatusOK, ""
+}
+
+// handleVectorIngest answers POST /api/ingest/vector
+func handleVectorIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	body, err := decodedBody(r, maxRequestBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		if isRequestTooLarge(err) {
+			http.Error(w, fmt.Sprintf("Request too large - limit is %d bytes", maxRequestBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	events, err := parseShippedEvents(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, status, message := ingestShippedEvents(r, events)
+	if status >= 300 {
+		http.Error(w, message, status)
+		return
+	}
+	ids := []int{}
+	for _, item := range items {
+		if item.ID != 0 {
+			ids = append(ids, item.ID)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"received": len(events), "ids": ids, "items": items})
+}
+
+// firehoseRequest is a Firehose HTTP endpoint delivery request
+type firehoseRequest struct {
+	RequestID string `json:"requestId"`
+	Records   []struct {
+		Data string `json:"data"`
+	} `json:"records"`
+}
+
+// cloudWatchLogsData is a CloudWatch Logs subscription payload
+type cloudWatchLogsData struct {
+	MessageType string `json:"messageType"`
+	Owner       string `json:"owner"`
+	LogGroup    string `json:"logGroup"`
+	LogStream   string `json:"logStream"`
+	LogEvents   []struct {
+		ID        string `json:"id"`
+		Timestamp int64  `json:"timestamp"`
+		Message   string `json:"message"`
+	} `json:"logEvents"`
+}
+
+// firehoseRecordEvents turns the data of one Firehose record into events
+func firehoseRecordEvents(encoded string) ([]map[string]interface{}, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("record data is not base64")
+	}
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(io.LimitReader(reader, maxRequestBytes)); err != nil {
+			return nil, fmt.Errorf("invalid gzip record")
+		}
+	}
+
+	var cloudWatch cloudWatchLogsData
+	if json.Unmarshal(data, &cloudWatch) != nil || cloudWatch.MessageType == "" {
+		return parseShippedEvents(data)
+	}
+	// CONTROL_MESSAGE records only check that the destination is reachable
+	if cloudWatch.MessageType != "DATA_MESSAGE" {
+		return nil, nil
+	}
+	source := cloudWatch.LogGroup[strings.LastIndex(cloudWatch.LogGroup, "/")+1:]
+	var events []map[string]interface{}
+	for _, logEvent := range cloudWatch.LogEvents {
+		events = append(events, map[string]interface{}{
+			"message":         logEvent.Message,
+			"source":          source,
+			"log_group":       cloudWatch.LogGroup,
+			"log_stream":      cloudWatch.LogStream,
+			"aws_account":     cloudWatch.Owner,
+			"cloudwatch_id":   logEvent.ID,
+			"event_timestamp": time.UnixMilli(logEvent.Timestamp).UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return events, nil
+}
+
+// writeFirehoseResponse sends the acknowledgement Firehose expects (errorMessage for failures)
+func writeFirehoseResponse(w http.ResponseWriter, requestID string, status int, errorMessage string) {
+	response := map[string]interface{}{"requestId": requestID, "timestamp": time.Now().UnixMilli()}
+	if errorMessage != "" {
+		response["errorMessage"] = errorMessage
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleFirehose answers POST /api/ingest/firehose, authenticated by the
+// endpoint's access key
+func handleFirehose(apiKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Amz-Firehose-Request-Id")
+		if r.Method != http.MethodPost {
+			writeFirehoseResponse(w, requestID, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if key := r.Header.Get("X-Amz-Firehose-Access-Key"); key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		if (apiKey != "" || managedKeysExist()) && !validAPIKey(requestAPIKey(r), apiKey) {
+			writeFirehoseResponse(w, requestID, http.StatusUnauthorized, "Invalid access key")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+		body, err := decodedBody(r, maxRequestBytes)
+		if err != nil {
+			writeFirehoseResponse(w, requestID, http.StatusUnsupportedMediaType, err.Error())
+			return
+		}
+		var delivery firehoseRequest
+		if err := json.NewDecoder(body).Decode(&delivery); err != nil {
+			if isRequestTooLarge(err) {
+				writeFirehoseResponse(w, requestID, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request too large - limit is %d bytes", maxRequestBytes))
+				return
+			}
+			writeFirehoseResponse(w, requestID, http.StatusBadRequest, "Invalid Firehose request")
+			return
+		}
+		if delivery.RequestID != "" {
+			requestID = delivery.RequestID
+		}
+
+		var events []map[string]interface{}
+		for i, record := range delivery.Records {
+			recordEvents, err := firehoseRecordEvents(record.Data)
+			if err != nil {
+				writeFirehoseResponse(w, requestID, http.StatusBadRequest, fmt.Sprintf("Record %d: %v", i+1, err))
+				return
+			}
+			events = append(events, recordEvents...)
+		}
+		items, status, message := ingestShippedEvents(r, events)
+		if status >= 300 {
+			writeFirehoseResponse(w, requestID, status, message)
+			return
+		}
+		// Firehose only retries whole requests, so rejected events can't be sent back
+		for _, item := range items {
+			if item.Status == "rejected" {
+				log.Printf("⚠️  Firehose request %s: event %d rejected: %s", requestID, item.Index+1, item.Error)
+			}
+		}
+		writeFirehoseResponse(w, requestID, http.StatusOK, "")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestShippers tests receiving logs from Vector and AWS Firehose
+func TestShippers(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Vector batches events as a JSON array; a CubicLog log is stored as it is
+	vector := `[
+		{"message": "Payment failed for order 17\n  at charge (payments.js:42)", "service": "checkout", "level": "error", "host": "web-1"},
+		{"message": "{\"msg\": \"Cache warmed\", \"service\": \"catalog\", \"level\": \"info\"}", "source_type": "file"},
+		{"header": {"title": "Deploy finished", "source": "ci"}, "body": {"version": "1.4.0"}}
+	]`
+	w := httptest.NewRecorder()
+	handleVectorIngest(w, httptest.NewRequest("POST", "/api/ingest/vector", strings.NewReader(vector)))
+	var result struct {
+		Received int   `json:"received"`
+		IDs      []int `json:"ids"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 200 || result.Received != 3 || len(result.IDs) != 3 {
+		t.Fatalf("Expected 3 stored events, got %d %+v", w.Code, result)
+	}
+	var title, source, body string
+	expected := [][2]string{{"Payment failed for order 17", "checkout"}, {"Cache warmed", "catalog"}, {"Deploy finished", "ci"}}
+	for i, id := range result.IDs {
+		db.QueryRow("SELECT title, source FROM logs WHERE id = ?", id).Scan(&title, &source)
+		if title != expected[i][0] || source != expected[i][1] {
+			t.Errorf("Event %d: expected %v, got %q %q", i, expected[i], title, source)
+		}
+	}
+
+	// Firehose delivering gzipped CloudWatch Logs data, authenticated by its access key
+	cloudWatch := `{"messageType": "DATA_MESSAGE", "owner": "123456789012", "logGroup": "/aws/lambda/invoices",
+		"logStream": "2024/05/01/[$LATEST]abc", "logEvents": [{"id": "1", "timestamp": 1714557600000, "message": "Invoice 88 sent"}]}`
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(cloudWatch))
+	gz.Close()
+	control := base64.StdEncoding.EncodeToString([]byte(`{"messageType": "CONTROL_MESSAGE", "logEvents": []}`))
+	delivery := `{"requestId": "req-1", "timestamp": 1714557600000, "records": [{"data": "` +
+		base64.StdEncoding.EncodeToString(compressed.Bytes()) + `"}, {"data": "` + control + `"}]}`
+
+	firehose := handleFirehose("secret")
+	send := func(key string) (int, map[string]interface{}) {
+		r := httptest.NewRequest("POST", "/api/ingest/firehose", strings.NewReader(delivery))
+		r.Header.Set("X-Amz-Firehose-Request-Id", "req-1")
+		r.Header.Set("X-Amz-Firehose-Access-Key", key)
+		w := httptest.NewRecorder()
+		firehose(w, r)
+		var answer map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&answer)
+		return w.Code, answer
+	}
+	if code, answer := send("wrong"); code != 401 || answer["requestId"] != "req-1" || answer["errorMessage"] == nil {
+		t.Errorf("Expected a 401 acknowledgement with an error, got %d %v", code, answer)
+	}
+	code, answer := send("secret")
+	if code != 200 || answer["requestId"] != "req-1" || answer["timestamp"] == nil || answer["errorMessage"] != nil {
+		t.Fatalf("Expected the delivery to be acknowledged, got %d %v", code, answer)
+	}
+	db.QueryRow("SELECT title, source, body FROM logs ORDER BY id DESC LIMIT 1").Scan(&title, &source, &body)
+	if title != "Invoice 88 sent" || source != "invoices" || !strings.Contains(body, `"log_group":"/aws/lambda/invoices"`) {
+		t.Errorf("Unexpected CloudWatch log: %q %q %s", title, source, body)
+	}
+}
+
+// TestShippedBatchFailures tests that a failed event doesn't fail the events around it
+func TestShippedBatchFailures(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	originalBody, originalPolicy := maxBodyBytes, oversizePolicy
+	defer func() { maxBodyBytes, oversizePolicy = originalBody, originalPolicy }()
+	maxBodyBytes, oversizePolicy = 200, "reject"
+
+	large := strings.Repeat("x", 300)
+	batch := `[{"message": "Order 1 shipped"}, {"message": "Order 2 failed", "dump": "` + large + `"}, {"message": "Order 3 shipped"}]`
+	w := httptest.NewRecorder()
+	handleVectorIngest(w, httptest.NewRequest("POST", "/api/ingest/vector", strings.NewReader(batch)))
+	var result struct {
+		IDs   []int       `json:"ids"`
+		Items []ingestAck `json:"items"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != 200 || len(result.Items) != 3 || len(result.IDs) != 2 {
+		t.Fatalf("Expected 2 stored events and 3 acknowledgments, got %d %+v", w.Code, result)
+	}
+	rejected := result.Items[1]
+	if rejected.Index != 1 || rejected.Status != "rejected" || rejected.Code != 413 || rejected.Error == "" || rejected.ID != 0 {
+		t.Errorf("Expected the oversized event rejected with 413, got %+v", rejected)
+	}
+	if result.Items[2].Status != "stored" {
+		t.Errorf("Expected the event after the failure stored, got %+v", result.Items[2])
+	}
+
+	// A batch where nothing could be stored fails, so the shipper retries it
+	w = httptest.NewRecorder()
+	handleVectorIngest(w, httptest.NewRequest("POST", "/api/ingest/vector", strings.NewReader(`[{"message": "Dump", "dump": "`+large+`"}]`)))
+	if w.Code != 413 {
+		t.Errorf("Expected 413 when no event was stored, got %d", w.Code)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 stored logs, got %d", count)
+	}
+}
+
+// TestShippedGzipLimit tests that a compressed body is held to the request limit once decompressed
+func TestShippedGzipLimit(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	originalLimit := maxRequestBytes
+	defer func() { maxRequestBytes = originalLimit }()
+	maxRequestBytes = 1024
+
+	// A few hundred compressed bytes expanding well past the limit
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`[{"message": "` + strings.Repeat("x", 64*1024) + `"}]`))
+	gz.Close()
+	if compressed.Len() >= 1024 {
+		t.Fatalf("Expected the compressed body under the limit, got %d bytes", compressed.Len())
+	}
+
+	post := func(handler func(w http.ResponseWriter, r *http.Request), path string) int {
+		r := httptest.NewRequest("POST", path, bytes.NewReader(compressed.Bytes()))
+		r.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	if code := post(handleVectorIngest, "/api/ingest/vector"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for Vector, got %d", code)
+	}
+	if code := post(handleFirehose(""), "/api/ingest/firehose"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for Firehose, got %d", code)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected nothing stored, got %d logs", count)
+	}
+}
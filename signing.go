@@ -0,0 +1,138 @@
+// CubicLog Signing - HMAC signatures for reports CubicLog vouches for
+//
+// Erasure reports, hash chain checkpoints, ingest tokens and exports (with
+// ?sign=, see exportsign.go) are signed with HMAC-SHA256 so they can later be
+// checked against the instance that produced them (POST /api/privacy/verify,
+// POST /api/export/verify, POST /api/logs with an ingest token).
+//
+// KEY SOURCES (first match wins):
+//   - -signing-key-file: file containing the secret
+//   - CUBICLOG_SIGNING_KEY: environment variable
+//   - otherwise a random secret is generated on first use and kept next to
+//     the SQLite database as <db>.signing-key (mode 0600); with PostgreSQL or
+//     an in-memory database (or with -read-only) it only lives until restart
+//
+// Keep the key with your backups: signatures can't be verified without it.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// signaturePrefix names the algorithm in every signature
+const signaturePrefix = "hmac-sha256:"
+
+// Signing settings - configured once in main()
+var (
+	signingKeyFile    string // -signing-key-file
+	signingDefaultKey string // generated key location, "" to keep it in memory
+)
+
+var signing struct {
+	sync.Mutex
+	secret []byte
+}
+
+// configureSigning records where the signing secret comes from
+func configureSigning(keyFile, dbPath, driver string) {
+	signingKeyFile = keyFile
+	signingDefaultKey = ""
+	if driver == "sqlite3" && dbPath != "" && !isMemoryDSN(dbPath) {
+		signingDefaultKey = dbPath + ".signing-key"
+	}
+	signing.Lock()
+	signing.secret = nil
+	signing.Unlock()
+}
+
+// signingSecret loads or creates the signing secret
+func signingSecret() ([]byte, error) {
+	signing.Lock()
+	defer signing.Unlock()
+	if signing.secret != nil {
+		return signing.secret, nil
+	}
+
+	raw := os.Getenv("CUBICLOG_SIGNING_KEY")
+	if signingKeyFile != "" {
+		data, err := os.ReadFile(signingKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read signing key file: %v", err)
+		}
+		raw = string(data)
+	} else if raw == "" && signingDefaultKey != "" {
+		data, err := os.ReadFile(signingDefaultKey)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("could not read signing key: %v", err)
+		}
+		raw = string(data)
+	}
+	if raw = strings.TrimSpace(raw); raw != "" {
+		if len(raw) < 16 {
+			return nil, fmt.Errorf("signing key must be at least 16 characters")
+		}
+		signing.secret = []byte(raw)
+		return signing.secret, nil
+	}
+
+	// Nothing configured: generate a secret
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encoded := hex.EncodeToString(secret)
+	if signingDefaultKey != "" && !readOnlyMode {
+		if err := os.WriteFile(signingDefaultKey, []byte(encoded+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("could not store signing key: %v", err)
+		}
+		log.Printf("🔏 Generated signing key %s - keep it with your backups", signingDefaultKey)
+	} else {
+		log.Printf("⚠️  No -signing-key-file configured, signatures are only valid until restart")
+	}
+	signing.secret = []byte(encoded)
+	return signing.secret, nil
+}
+
+// signPayload returns the signature of data
+func signPayload(data []byte) (string, error) {
+	mac, err := newPayloadMAC()
+	if err != nil {
+		return "", err
+	}
+	mac.Write(data)
+	return formatSignature(mac), nil
+}
+
+// newPayloadMAC returns an HMAC for signing data too large to hold in memory
+func newPayloadMAC() (hash.Hash, error) {
+	secret, err := signingSecret()
+	if err != nil {
+		return nil, err
+	}
+	return hmac.New(sha256.New, secret), nil
+}
+
+// formatSignature renders the signature of everything written to mac
+func formatSignature(mac hash.Hash) string {
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPayload reports whether signature was produced for data with the current secret
+func verifyPayload(data []byte, signature string) bool {
+	expected, err := signPayload(data)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,307 @@
+// CubicLog Alert Silences - Mute alerts during deploys and maintenance windows
+//
+//   - POST   /api/alerts/silences         create a silence
+//   - GET    /api/alerts/silences         list silences (?active=true for the muted ones)
+//   - DELETE /api/alerts/silences/{id}    remove a silence
+//
+// A silence mutes alerts of one rule, one source, or both (at least one is
+// required). It is either one-off:
+//
+//	{"rule": "warning-flood", "source": "payments", "reason": "Deploy 4.2", "duration": "30m"}
+//	{"source": "search", "starts_at": "2024-05-04T22:00:00Z", "ends_at": "2024-05-05T02:00:00Z"}
+//
+// or recurring, following a cron expression (see cron.go) in a time zone:
+//
+//	{"rule": "*", "source": "batch-importer", "cron": "0 2 * * *", "duration": "1h", "timezone": "Europe/Berlin"}
+//
+// Muted alerts are still recorded in the alert history (with silenced_by set)
+// but not delivered to the webhook and not shown in the alert banner. Active
+// silences are listed under "silences" in /api/stats so the dashboard shows
+// what is muted and until when. "*" or an empty rule/source matches any.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurringSilence bounds how long one recurring window may last
+const maxRecurringSilence = 7 * 24 * time.Hour
+
+// Silence mutes alerts matching a rule and/or source
+type Silence struct {
+	ID        string     `json:"id"`
+	Rule      string     `json:"rule,omitempty"`
+	Source    string     `json:"source,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	StartsAt  *time.Time `json:"starts_at,omitempty"` // one-off silences
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	Cron      string     `json:"cron,omitempty"` // recurring silences
+	Duration  string     `json:"duration,omitempty"`
+	Timezone  string     `json:"timezone,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Computed when listed
+	Active      bool       `json:"active"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	NextStart   *time.Time `json:"next_start,omitempty"`
+
+	schedule *cronSchedule
+	length   time.Duration
+	location *time.Location
+}
+
+// createSilencesTable creates the silence table
+func createSilencesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS alert_silences (
+		id         TEXT PRIMARY KEY,
+		rule       TEXT NOT NULL DEFAULT '',
+		source     TEXT NOT NULL DEFAULT '',
+		reason     TEXT NOT NULL DEFAULT '',
+		starts_at  TIMESTAMP,
+		ends_at    TIMESTAMP,
+		cron       TEXT NOT NULL DEFAULT '',
+		duration   TEXT NOT NULL DEFAULT '',
+		timezone   TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// prepare validates a silence and fills in its computed fields
+func (s *Silence) prepare(now time.Time) error {
+	s.Active, s.ActiveUntil, s.NextStart = false, nil, nil
+	s.Rule, s.Source = strings.TrimSpace(s.Rule), strings.TrimSpace(s.Source)
+	if s.Rule == "*" {
+		s.Rule = ""
+	}
+	if s.Source == "*" {
+		s.Source = ""
+	}
+	if s.Rule == "" && s.Source == "" {
+		return fmt.Errorf("a silence needs a rule or a source (use \"*\" for one of them to match any)")
+	}
+
+	var err error
+	if s.Duration != "" {
+		if s.length, err = time.ParseDuration(s.Duration); err != nil || s.length <= 0 {
+			return fmt.Errorf("duration must be a positive duration like 30m")
+		}
+	}
+
+	if s.Cron != "" {
+		if s.schedule, err = parseCron(s.Cron); err != nil {
+			return err
+		}
+		if s.length <= 0 || s.length > maxRecurringSilence {
+			return fmt.Errorf("recurring silences need a duration of at most %s", maxRecurringSilence)
+		}
+		s.location = time.UTC
+		if s.Timezone != "" {
+			if s.location, err = time.LoadLocation(s.Timezone); err != nil {
+				return fmt.Errorf("unknown timezone '%s'", s.Timezone)
+			}
+		}
+		s.StartsAt, s.EndsAt = nil, nil
+		return nil
+	}
+
+	start, end := now, time.Time{}
+	if s.StartsAt != nil {
+		start = *s.StartsAt
+	}
+	if s.EndsAt != nil {
+		end = *s.EndsAt
+	} else if s.length > 0 {
+		end = start.Add(s.length)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("one-off silences need ends_at after starts_at, or a duration")
+	}
+	start, end = start.UTC().Truncate(time.Second), end.UTC().Truncate(time.Second)
+	s.StartsAt, s.EndsAt = &start, &end
+	return nil
+}
+
+// activeAt reports whether the silence mutes alerts at now, and until when
+func (s *Silence) activeAt(now time.Time) (bool, time.Time) {
+	if s.schedule == nil {
+		return !now.Before(*s.StartsAt) && now.Before(*s.EndsAt), *s.EndsAt
+	}
+	start := s.schedule.lastWithin(now.In(s.location), s.length)
+	if start.IsZero() {
+		return false, time.Time{}
+	}
+	return true, start.Add(s.length).UTC()
+}
+
+// mutes reports whether the silence covers an alert
+func (s *Silence) mutes(alert Alert) bool {
+	return (s.Rule == "" || s.Rule == alert.Rule) && (s.Source == "" || s.Source == alert.Source)
+}
+
+// loadSilences reads all silences with their state at now
+func loadSilences(now time.Time) ([]Silence, error) {
+	rows, err := db.Query(`SELECT id, rule, source, reason, starts_at, ends_at, cron, duration, timezone, created_at
+		FROM alert_silences ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	silences := []Silence{}
+	for rows.Next() {
+		var s Silence
+		var startsAt, endsAt time.Time
+		if err := rows.Scan(&s.ID, &s.Rule, &s.Source, &s.Reason, (*scanTime)(&startsAt), (*scanTime)(&endsAt),
+			&s.Cron, &s.Duration, &s.Timezone, (*scanTime)(&s.CreatedAt)); err != nil {
+			return nil, err
+		}
+		if s.Cron == "" {
+			s.StartsAt, s.EndsAt = &startsAt, &endsAt
+		}
+		if s.prepare(now) != nil {
+			continue // validated on creation; skip rather than fail the whole list
+		}
+		if active, until := s.activeAt(now); active {
+			s.Active, s.ActiveUntil = true, &until
+		}
+		if s.schedule != nil {
+			if next := s.schedule.next(now.In(s.location)); !next.IsZero() {
+				next = next.UTC()
+				s.NextStart = &next
+			}
+		}
+		silences = append(silences, s)
+	}
+	return silences, rows.Err()
+}
+
+// activeSilences returns the silences muting alerts right now
+func activeSilences(now time.Time) []Silence {
+	silences, err := loadSilences(now)
+	if err != nil {
+		return nil
+	}
+	active := []Silence{}
+	for _, s := range silences {
+		if s.Active {
+			active = append(active, s)
+		}
+	}
+	return active
+}
+
+// silencedBy returns the id of the silence muting an alert ("" when none)
+func silencedBy(alert Alert) string {
+	for _, s := range activeSilences(alert.FiredAt) {
+		if s.mutes(alert) {
+			return s.ID
+		}
+	}
+	return ""
+}
+
+// handleSilences answers GET and POST /api/alerts/silences
+func handleSilences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	now := time.Now()
+	switch r.Method {
+	case http.MethodGet:
+		silences, err := loadSilences(now)
+		if err != nil {
+			http.Error(w, "Failed to load silences", http.StatusInternalServerError)
+			return
+		}
+		if activeOnly, _ := strconv.ParseBool(r.URL.Query().Get("active")); activeOnly {
+			silences = activeSilences(now)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"silences": silences})
+
+	case http.MethodPost:
+		var s Silence
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := s.prepare(now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := make([]byte, 6)
+		rand.Read(id)
+		s.ID = "silence-" + hex.EncodeToString(id)
+		s.CreatedAt = now.UTC().Truncate(time.Second)
+
+		var startsAt, endsAt interface{}
+		if s.schedule == nil {
+			startsAt, endsAt = dbTime(*s.StartsAt), dbTime(*s.EndsAt)
+		}
+		if _, err := db.Exec(db.Rebind(`INSERT INTO alert_silences (id, rule, source, reason, starts_at, ends_at, cron, duration, timezone, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`), s.ID, s.Rule, s.Source, s.Reason, startsAt, endsAt,
+			s.Cron, s.Duration, s.Timezone, dbTime(s.CreatedAt)); err != nil {
+			http.Error(w, "Failed to save silence", http.StatusInternalServerError)
+			return
+		}
+		if active, until := s.activeAt(now); active {
+			s.Active, s.ActiveUntil = true, &until
+		}
+		notifyAlertWatchers()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSilence answers DELETE /api/alerts/silences/{id}
+func handleSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/alerts/silences/")
+	result, err := db.Exec(db.Rebind("DELETE FROM alert_silences WHERE id = ?"), id)
+	if err != nil {
+		http.Error(w, "Failed to delete silence", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Silence not found", http.StatusNotFound)
+		return
+	}
+	notifyAlertWatchers()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "deleted", "id": id})
+}
+
+// silenceSummary is an active silence as shown in /api/stats
+type silenceSummary struct {
+	ID     string    `json:"id"`
+	Rule   string    `json:"rule"`
+	Source string    `json:"source"`
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+// silenceSummaries lists active silences for the dashboard
+func silenceSummaries(now time.Time) []silenceSummary {
+	summaries := []silenceSummary{}
+	for _, s := range activeSilences(now) {
+		summary := silenceSummary{ID: s.ID, Rule: valueOr(s.Rule, "*"), Source: valueOr(s.Source, "*"), Reason: s.Reason}
+		if s.ActiveUntil != nil {
+			summary.Until = *s.ActiveUntil
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
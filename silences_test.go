@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAlertSilences tests one-off and recurring silences muting alerts
+func TestAlertSilences(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	create := func(body string) (int, Silence) {
+		w := httptest.NewRecorder()
+		handleSilences(w, httptest.NewRequest("POST", "/api/alerts/silences", strings.NewReader(body)))
+		var silence Silence
+		json.Unmarshal(w.Body.Bytes(), &silence)
+		return w.Code, silence
+	}
+
+	code, deploy := create(`{"source": "payments", "reason": "Deploy 4.2", "duration": "30m"}`)
+	if code != 201 || !deploy.Active {
+		t.Fatalf("Expected an active silence, got %d %+v", code, deploy)
+	}
+	if code, _ := create(`{"reason": "everything"}`); code != 400 {
+		t.Errorf("Expected 400 for a silence without rule or source, got %d", code)
+	}
+	if code, _ := create(`{"rule": "nightly", "cron": "0 2 * * *"}`); code != 400 {
+		t.Errorf("Expected 400 for a recurring silence without duration, got %d", code)
+	}
+
+	muted := fireAlert(Alert{Rule: "warning-flood", Kind: "escalation", Source: "payments", Severity: "critical", Title: "Escalated: warning-flood", Message: "muted"})
+	loud := fireAlert(Alert{Rule: "warning-flood", Kind: "escalation", Source: "search", Severity: "critical", Title: "Escalated: warning-flood", Message: "loud"})
+	if muted.SilencedBy != deploy.ID || loud.SilencedBy != "" {
+		t.Errorf("Expected only the payments alert to be silenced, got '%s' and '%s'", muted.SilencedBy, loud.SilencedBy)
+	}
+	if banners := alertBanners(); len(banners) != 1 || !strings.Contains(banners[0], "loud") {
+		t.Errorf("Expected only the unsilenced alert in the banner, got %v", banners)
+	}
+
+	// A recurring window every day at 02:00 for an hour
+	_, nightly := create(`{"rule": "*", "source": "batch", "cron": "0 2 * * *", "duration": "1h", "timezone": "UTC"}`)
+	nightly.prepare(time.Now())
+	at := func(value string) time.Time { parsed, _ := time.Parse(time.RFC3339, value); return parsed }
+	if active, until := nightly.activeAt(at("2024-05-04T02:30:00Z")); !active || !until.Equal(at("2024-05-04T03:00:00Z")) {
+		t.Errorf("Expected the nightly silence active until 03:00, got %v %v", active, until)
+	}
+	if active, _ := nightly.activeAt(at("2024-05-04T03:00:00Z")); active {
+		t.Errorf("Expected the nightly silence to end at 03:00")
+	}
+	if next := nightly.schedule.next(at("2024-05-04T02:30:00Z")); !next.Equal(at("2024-05-05T02:00:00Z")) {
+		t.Errorf("Expected the next window at 2024-05-05T02:00, got %v", next)
+	}
+
+	w := httptest.NewRecorder()
+	handleSilence(w, httptest.NewRequest("DELETE", "/api/alerts/silences/"+deploy.ID, nil))
+	if w.Code != 200 || silencedBy(Alert{Rule: "warning-flood", Source: "payments", FiredAt: time.Now()}) != "" {
+		t.Errorf("Expected the deploy silence to be removed, got %d", w.Code)
+	}
+}
@@ -0,0 +1,283 @@
+// CubicLog Slack Command - Check logs without leaving chat
+//
+// Point a Slack slash command (Request URL: https://<cubiclog>/api/slack/command)
+// at CubicLog and start it with -slack-signing-secret (the app's signing
+// secret). Then, in any channel:
+//
+//	/cubiclog errors payment-service 1h     errors from payment-service in the last hour
+//	/cubiclog warnings 30m                  warnings from all sources
+//	/cubiclog logs checkout 7d              everything from checkout
+//	/cubiclog groups payments 24h           top error groups
+//	/cubiclog help
+//
+// The answer is only visible to the caller and summarizes the count, the most
+// frequent titles and the latest log, with a link to the matching dashboard
+// view (absolute when -public-url is set). Requests are authenticated with
+// Slack's request signature instead of the API key, so the endpoint works
+// without auth headers but rejects anything Slack did not sign in the last
+// five minutes.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackSigningSecret is the -slack-signing-secret setting - configured once in main()
+var slackSigningSecret string
+
+// slackMaxSkew is how old a signed Slack request may be
+const slackMaxSkew = 5 * time.Minute
+
+// slackCommandSeverities maps command words to derived severities ("" = all logs)
+var slackCommandSeverities = map[string]string{
+	"errors": "error", "error": "error",
+	"warnings": "warning", "warning": "warning",
+	"critical": "critical",
+	"info":     "info",
+	"debug":    "debug",
+	"success":  "success",
+	"logs":     "", "all": "",
+}
+
+// slackHelp is shown for "help" and unknown commands
+const slackHelp = "Usage: `/cubiclog <errors|warnings|critical|info|debug|success|logs|groups> [source] [window]`\n" +
+	"Examples: `/cubiclog errors payment-service 1h`, `/cubiclog groups 24h`. The window defaults to 1h (up to 30d)."
+
+// errSlackHelp asks for the usage text
+var errSlackHelp = errors.New("help")
+
+// slackQuery is a parsed slash command
+type slackQuery struct {
+	Kind     string // a key of slackCommandSeverities, or "groups"
+	Severity string
+	Source   string
+	Window   time.Duration
+}
+
+// parseSlackCommand parses the text after /cubiclog
+func parseSlackCommand(text string) (slackQuery, error) {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 || words[0] == "help" {
+		return slackQuery{}, errSlackHelp
+	}
+	query := slackQuery{Kind: words[0], Window: time.Hour}
+	severity, known := slackCommandSeverities[query.Kind]
+	if !known && query.Kind != "groups" {
+		return query, fmt.Errorf("unknown command '%s'", query.Kind)
+	}
+	query.Severity = severity
+
+	for _, word := range words[1:] {
+		if window, ok := parseSlackWindow(word); ok {
+			query.Window = window
+		} else if query.Source == "" {
+			query.Source = word
+		} else {
+			return query, fmt.Errorf("unexpected '%s'", word)
+		}
+	}
+	if query.Window > 30*24*time.Hour {
+		return query, fmt.Errorf("window can be at most 30d")
+	}
+	return query, nil
+}
+
+// parseSlackWindow accepts Go durations and days ("7d")
+func parseSlackWindow(word string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(word, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, true
+		}
+	}
+	window, err := time.ParseDuration(word)
+	return window, err == nil && window > 0
+}
+
+// verifySlackRequest checks Slack's v0 request signature
+func verifySlackRequest(r *http.Request, body []byte, now time.Time) bool {
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil || math.Abs(now.Sub(time.Unix(timestamp, 0)).Seconds()) > slackMaxSkew.Seconds() {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(slackSigningSecret))
+	fmt.Fprintf(mac, "v0:%d:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+// handleSlackCommand answers POST /api/slack/command
+func handleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	if slackSigningSecret == "" {
+		http.Error(w, "Slack command not configured (-slack-signing-secret)", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+	if !verifySlackRequest(r, body, time.Now()) {
+		http.Error(w, "Invalid Slack signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	var text string
+	query, err := parseSlackCommand(form.Get("text"))
+	switch {
+	case err == errSlackHelp:
+		text = slackHelp
+	case err != nil:
+		text = fmt.Sprintf("❌ %s\n%s", err, slackHelp)
+	default:
+		if query.Kind == "groups" {
+			text, err = slackGroupsSummary(query)
+		} else {
+			text, err = slackLogSummary(query)
+		}
+		if err != nil {
+			log.Printf("Slack command error: %v", err)
+			text = "❌ Query failed, check the CubicLog server logs"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+		"blocks":        []interface{}{map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}}},
+	})
+}
+
+// slackScope describes what a query covers, e.g. "errors from payments in the last 1h"
+func slackScope(query slackQuery) string {
+	scope := query.Kind
+	if query.Source != "" {
+		scope += " from " + query.Source
+	}
+	return scope + " in the last " + formatSlackWindow(query.Window)
+}
+
+// formatSlackWindow prints whole days as 7d and everything else as a Go duration
+func formatSlackWindow(window time.Duration) string {
+	if window >= 24*time.Hour && window%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", window/(24*time.Hour))
+	}
+	text := window.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// slackLogSummary counts the matching logs and lists the most frequent titles
+func slackLogSummary(query slackQuery) (string, error) {
+	where, args := "timestamp >= ?", []interface{}{dbTime(time.Now().Add(-query.Window))}
+	if query.Severity != "" {
+		where += " AND derived_severity = ?"
+		args = append(args, query.Severity)
+	}
+	if query.Source != "" {
+		where += " AND derived_source = ?"
+		args = append(args, query.Source)
+	}
+
+	var total int
+	if err := db.QueryRow(db.Rebind("SELECT COUNT(*) FROM logs WHERE "+where), args...).Scan(&total); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%d* %s\n", total, slackScope(query))
+	if total == 0 {
+		return text.String() + "✅ Nothing to see here.", nil
+	}
+
+	rows, err := db.Query(db.Rebind("SELECT title, COUNT(*) FROM logs WHERE "+where+" GROUP BY title ORDER BY COUNT(*) DESC, title LIMIT 5"), args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var title string
+		var count int
+		if err := rows.Scan(&title, &count); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&text, "• %d× %s\n", count, title)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	var latestID int64
+	var latest time.Time
+	if db.QueryRow(db.Rebind("SELECT id, timestamp FROM logs WHERE "+where+" ORDER BY timestamp DESC, id DESC LIMIT 1"), args...).
+		Scan(&latestID, (*scanTime)(&latest)) == nil {
+		fmt.Fprintf(&text, "Latest: <%s|#%d> at %s\n", dashboardLink(fmt.Sprintf("/logs/%d", latestID)), latestID, latest.UTC().Format("15:04:05 UTC"))
+	}
+
+	search := url.Values{}
+	if query.Source != "" {
+		search.Set("query", query.Source)
+	}
+	if query.Severity != "" {
+		search.Set("type", query.Severity)
+	}
+	link := dashboardLink("/search")
+	if encoded := search.Encode(); encoded != "" {
+		link += "?" + encoded
+	}
+	fmt.Fprintf(&text, "<%s|Open in CubicLog>", link)
+	return text.String(), nil
+}
+
+// slackGroupsSummary lists the most frequent error groups
+func slackGroupsSummary(query slackQuery) (string, error) {
+	groups, err := loadErrorGroups(time.Now().Add(-query.Window), 100)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	shown := 0
+	for _, g := range groups {
+		if query.Source != "" && g.Source != query.Source {
+			continue
+		}
+		if shown++; shown > 5 {
+			break
+		}
+		fmt.Fprintf(&text, "• %d× %s (%s)", g.Count, g.Title, g.Source)
+		if g.IssueURL != "" {
+			fmt.Fprintf(&text, " <%s|%s %s>", g.IssueURL, g.IssueKey, g.IssueStatus)
+		}
+		text.WriteString("\n")
+	}
+	if shown == 0 {
+		return fmt.Sprintf("✅ No error groups seen (%s)", slackScope(query)), nil
+	}
+	return fmt.Sprintf("Top error groups (%s):\n", slackScope(query)) + text.String(), nil
+}
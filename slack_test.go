@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSlackCommand tests the signed /cubiclog slash command
+func TestSlackCommand(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	slackSigningSecret, publicURL = "slack-secret", "https://logs.example.com"
+	defer func() { slackSigningSecret, publicURL = "", "" }()
+
+	for _, log := range []string{
+		`{"header":{"type":"error","title":"Card declined","source":"payment-service"}}`,
+		`{"header":{"type":"error","title":"Card declined","source":"payment-service"}}`,
+		`{"header":{"type":"error","title":"Gateway timeout error","source":"payment-service"}}`,
+		`{"header":{"type":"error","title":"Disk failure","source":"storage"}}`,
+		`{"header":{"type":"info","title":"Payment captured","source":"payment-service"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(log)))
+	}
+
+	command := func(text string, timestamp time.Time, secret string) (int, string) {
+		body := url.Values{"command": {"/cubiclog"}, "text": {text}}.Encode()
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%d:%s", timestamp.Unix(), body)
+		req := httptest.NewRequest("POST", "/api/slack/command", strings.NewReader(body))
+		req.Header.Set("X-Slack-Request-Timestamp", fmt.Sprint(timestamp.Unix()))
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		handleSlackCommand(w, req)
+		var answer struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(w.Body).Decode(&answer)
+		return w.Code, answer.Text
+	}
+
+	code, text := command("errors payment-service 1h", time.Now(), "slack-secret")
+	if code != http.StatusOK || !strings.HasPrefix(text, "*3* errors from payment-service in the last 1h") {
+		t.Fatalf("Expected 3 errors from payment-service, got %d: %s", code, text)
+	}
+	if !strings.Contains(text, "2× Card declined") || !strings.Contains(text, "https://logs.example.com/search?query=payment-service&type=error") {
+		t.Errorf("Expected top titles and a dashboard link, got: %s", text)
+	}
+
+	if _, text := command("groups 7d", time.Now(), "slack-secret"); !strings.Contains(text, "2× Card declined (payment-service)") {
+		t.Errorf("Expected error groups, got: %s", text)
+	}
+	if _, text := command("bogus", time.Now(), "slack-secret"); !strings.Contains(text, "unknown command") {
+		t.Errorf("Expected usage for an unknown command, got: %s", text)
+	}
+
+	if code, _ := command("errors", time.Now(), "wrong-secret"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bad signature, got %d", code)
+	}
+	if code, _ := command("errors", time.Now().Add(-10*time.Minute), "slack-secret"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a stale request, got %d", code)
+	}
+}
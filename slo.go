@@ -0,0 +1,352 @@
+// CubicLog SLOs - Error budgets per source
+//
+//   - GET    /api/slo            every SLO with its current status
+//   - GET    /api/slo/{source}   one SLO
+//   - PUT    /api/slo/{source}   define or change it: {"max_error_rate": 1, "window_days": 30}
+//   - DELETE /api/slo/{source}   remove it
+//
+// An SLO says that at most max_error_rate percent of a source's logs may be
+// errors (derived severity error or critical) over the last window_days days
+// (1-90, default 30). The allowed errors are the error budget; the status
+// shows the error rate, how much of the budget is left and the burn rate -
+// how many times faster than allowed the budget is being spent - over the
+// last hour and the last six hours (whole hours plus the current one, read
+// from the same hourly counts as the charts, rollups included).
+//
+// Every five minutes the SLOs are checked and an alert fires (see alerts.go):
+//   - slo-fast-burn (critical) at a 1h burn rate of 14.4, which spends 2% of a
+//     30 day budget in an hour
+//   - slo-slow-burn (error) at a 6h burn rate of 6, which spends 5% in six hours
+//
+// Windows with fewer than 20 logs are not alerted on. An alert repeats at
+// most once per its window while the burn continues.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SLO is the error budget of one source
+type SLO struct {
+	Source       string    `json:"source"`
+	MaxErrorRate float64   `json:"max_error_rate"` // percent
+	WindowDays   int       `json:"window_days"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// sloStatus is an SLO with its current numbers
+type sloStatus struct {
+	SLO
+	Logs            int     `json:"logs"`
+	Errors          int     `json:"errors"`
+	ErrorRate       float64 `json:"error_rate"`       // percent over the window
+	BudgetRemaining float64 `json:"budget_remaining"` // percent of the budget left, negative once overspent
+	BurnRate1h      float64 `json:"burn_rate_1h"`
+	BurnRate6h      float64 `json:"burn_rate_6h"`
+	Status          string  `json:"status"` // ok, slow_burn, fast_burn, exhausted or no_data
+}
+
+// sloBurnAlert is a burn rate that fires an alert
+type sloBurnAlert struct {
+	rule      string
+	severity  string
+	hours     int
+	threshold float64
+}
+
+// sloBurnAlerts are the fast (1h) and slow (6h) burn alerts, in that order
+var sloBurnAlerts = []sloBurnAlert{
+	{rule: "slo-fast-burn", severity: "critical", hours: 1, threshold: 14.4},
+	{rule: "slo-slow-burn", severity: "error", hours: 6, threshold: 6},
+}
+
+// sloMinLogs is the fewest logs a burn window needs before it alerts
+const sloMinLogs = 20
+
+// sloCheckInterval is how often the SLOs are checked for burn alerts
+const sloCheckInterval = 5 * time.Minute
+
+// sloAlerted remembers when each source's burn alerts last fired
+var sloAlerted = struct {
+	sync.Mutex
+	fired map[string]time.Time
+}{fired: map[string]time.Time{}}
+
+// createSLOTable creates the SLO table
+func createSLOTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS slos (
+		source         TEXT PRIMARY KEY,
+		max_error_rate REAL NOT NULL,
+		window_days    INTEGER NOT NULL,
+		updated_at     TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// loadSLOs returns all SLOs ordered by source
+func loadSLOs() ([]SLO, error) {
+	rows, err := db.Query("SELECT source, max_error_rate, window_days, updated_at FROM slos ORDER BY source")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	slos := []SLO{}
+	for rows.Next() {
+		var slo SLO
+		if err := rows.Scan(&slo.Source, &slo.MaxErrorRate, &slo.WindowDays, (*scanTime)(&slo.UpdatedAt)); err != nil {
+			return nil, err
+		}
+		slos = append(slos, slo)
+	}
+	return slos, rows.Err()
+}
+
+// saveSLO stores an SLO, replacing the source's previous one
+func saveSLO(slo SLO) error {
+	now := dbTime(slo.UpdatedAt)
+	result, err := db.Exec(db.Rebind("UPDATE slos SET max_error_rate = ?, window_days = ?, updated_at = ? WHERE source = ?"),
+		slo.MaxErrorRate, slo.WindowDays, now, slo.Source)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+	_, err = db.Exec(db.Rebind("INSERT INTO slos (source, max_error_rate, window_days, updated_at) VALUES (?, ?, ?, ?)"),
+		slo.Source, slo.MaxErrorRate, slo.WindowDays, now)
+	return err
+}
+
+// sloStatuses computes the status of each SLO at now
+func sloStatuses(slos []SLO, now time.Time) ([]sloStatus, error) {
+	statuses := make([]sloStatus, 0, len(slos))
+	if len(slos) == 0 {
+		return statuses, nil
+	}
+	longest := 0
+	for _, slo := range slos {
+		if slo.WindowDays > longest {
+			longest = slo.WindowDays
+		}
+	}
+	counts, err := hourlyCounts(now.UTC().AddDate(0, 0, -longest))
+	if err != nil {
+		return nil, err
+	}
+
+	currentHour := now.UTC().Truncate(time.Hour)
+	for _, slo := range slos {
+		status := sloStatus{SLO: slo}
+		from := now.UTC().AddDate(0, 0, -slo.WindowDays)
+		var recent [2]struct{ logs, errors int } // last 1h and 6h
+		for _, row := range counts {
+			if row.source != slo.Source || row.hour.Before(from.Truncate(time.Hour)) {
+				continue
+			}
+			isError := row.severity == "error" || row.severity == "critical"
+			status.Logs += row.count
+			if isError {
+				status.Errors += row.count
+			}
+			for i, alert := range sloBurnAlerts {
+				if !row.hour.Before(currentHour.Add(-time.Duration(alert.hours) * time.Hour)) {
+					recent[i].logs += row.count
+					if isError {
+						recent[i].errors += row.count
+					}
+				}
+			}
+		}
+
+		budget := slo.MaxErrorRate / 100
+		burnRate := func(logs, errors int) float64 {
+			if logs == 0 {
+				return 0
+			}
+			return roundTo(float64(errors)/float64(logs)/budget, 2)
+		}
+		status.BurnRate1h = burnRate(recent[0].logs, recent[0].errors)
+		status.BurnRate6h = burnRate(recent[1].logs, recent[1].errors)
+		switch {
+		case status.Logs == 0:
+			status.BudgetRemaining = 100
+			status.Status = "no_data"
+		default:
+			rate := float64(status.Errors) / float64(status.Logs)
+			status.ErrorRate = roundTo(rate*100, 3)
+			status.BudgetRemaining = roundTo((1-rate/budget)*100, 1)
+			// A burn going on right now matters more than a spent budget
+			switch {
+			case status.BurnRate1h >= sloBurnAlerts[0].threshold && recent[0].logs >= sloMinLogs:
+				status.Status = "fast_burn"
+			case status.BurnRate6h >= sloBurnAlerts[1].threshold && recent[1].logs >= sloMinLogs:
+				status.Status = "slow_burn"
+			case status.BudgetRemaining <= 0:
+				status.Status = "exhausted"
+			default:
+				status.Status = "ok"
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// roundTo rounds a value to the given number of decimals
+func roundTo(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// checkSLOs fires burn alerts for SLOs spending their budget too fast
+func checkSLOs(now time.Time) error {
+	slos, err := loadSLOs()
+	if err != nil {
+		return err
+	}
+	statuses, err := sloStatuses(slos, now)
+	if err != nil {
+		return err
+	}
+
+	sloAlerted.Lock()
+	defer sloAlerted.Unlock()
+	for _, status := range statuses {
+		var alert sloBurnAlert
+		var burnRate float64
+		switch status.Status {
+		case "fast_burn":
+			alert, burnRate = sloBurnAlerts[0], status.BurnRate1h
+		case "slow_burn":
+			alert, burnRate = sloBurnAlerts[1], status.BurnRate6h
+		default:
+			continue
+		}
+		key := alert.rule + "\x00" + status.Source
+		if last, ok := sloAlerted.fired[key]; ok && now.Sub(last) < time.Duration(alert.hours)*time.Hour {
+			continue
+		}
+		sloAlerted.fired[key] = now
+		fireAlert(Alert{
+			Rule:     alert.rule,
+			Kind:     "slo",
+			Source:   status.Source,
+			Severity: alert.severity,
+			Title:    "Error budget burning: " + status.Source,
+			Message: fmt.Sprintf("%s is spending its error budget %.1fx faster than its SLO (%g%% errors over %d days) allows over the last %dh; %.1f%% of the budget is left",
+				status.Source, burnRate, status.MaxErrorRate, status.WindowDays, alert.hours, status.BudgetRemaining),
+			Count: int(math.Round(burnRate)),
+		})
+	}
+	return nil
+}
+
+// startSLOMonitor checks the SLOs in the background
+func startSLOMonitor() {
+	go func() {
+		for now := range time.Tick(sloCheckInterval) {
+			if err := checkSLOs(now); err != nil {
+				log.Printf("⚠️  SLO check error: %v", err)
+			}
+		}
+	}()
+}
+
+// handleSLOs answers GET /api/slo
+func handleSLOs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	slos, err := loadSLOs()
+	if err != nil {
+		http.Error(w, "Failed to load SLOs", http.StatusInternalServerError)
+		return
+	}
+	statuses, err := sloStatuses(slos, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to compute SLO status", http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].BudgetRemaining < statuses[j].BudgetRemaining })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"slos": statuses})
+}
+
+// handleSLO answers GET, PUT and DELETE /api/slo/{source}
+func handleSLO(w http.ResponseWriter, r *http.Request) {
+	source := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/slo/"))
+	if source == "" || len(source) > 100 {
+		http.Error(w, "Source name must be 1-100 characters", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		request := SLO{WindowDays: 30}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if request.MaxErrorRate <= 0 || request.MaxErrorRate >= 100 {
+			http.Error(w, "max_error_rate must be a percentage between 0 and 100, e.g. 1", http.StatusBadRequest)
+			return
+		}
+		if request.WindowDays < 1 || request.WindowDays > 90 {
+			http.Error(w, "window_days must be between 1 and 90", http.StatusBadRequest)
+			return
+		}
+		request.Source, request.UpdatedAt = source, time.Now().UTC().Truncate(time.Second)
+		if err := saveSLO(request); err != nil {
+			http.Error(w, "Failed to save SLO", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		result, err := db.Exec(db.Rebind("DELETE FROM slos WHERE source = ?"), source)
+		if err != nil {
+			http.Error(w, "Failed to delete SLO", http.StatusInternalServerError)
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			http.Error(w, "SLO not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "deleted", "source": source})
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	slos, err := loadSLOs()
+	if err != nil {
+		http.Error(w, "Failed to load SLOs", http.StatusInternalServerError)
+		return
+	}
+	for _, slo := range slos {
+		if slo.Source != source {
+			continue
+		}
+		statuses, err := sloStatuses([]SLO{slo}, time.Now())
+		if err != nil {
+			http.Error(w, "Failed to compute SLO status", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses[0])
+		return
+	}
+	http.Error(w, "SLO not found", http.StatusNotFound)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSLOBurnRate tests SLO status and burn alerts for a source spending its budget
+func TestSLOBurnRate(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { sloAlerted.fired = map[string]time.Time{} }()
+
+	define := func(source, body string) int {
+		w := httptest.NewRecorder()
+		handleSLO(w, httptest.NewRequest("PUT", "/api/slo/"+source, strings.NewReader(body)))
+		return w.Code
+	}
+	if code := define("checkout", `{"max_error_rate": 1, "window_days": 30}`); code != 200 {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	define("search", `{"max_error_rate": 5}`)
+	if code := define("checkout", `{"max_error_rate": 150}`); code != 400 {
+		t.Errorf("Expected status 400 for an error rate above 100%%, got %d", code)
+	}
+
+	for i := 0; i < 30; i++ {
+		severity := "success"
+		if i%3 == 0 {
+			severity = "error"
+		}
+		body := fmt.Sprintf(`{"header":{"type":"%s","title":"Checkout %d","source":"checkout"}}`, severity, i)
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	w := httptest.NewRecorder()
+	handleSLOs(w, httptest.NewRequest("GET", "/api/slo", nil))
+	var response struct {
+		SLOs []sloStatus `json:"slos"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.SLOs) != 2 {
+		t.Fatalf("Expected 2 SLOs, got %d", len(response.SLOs))
+	}
+	checkout, search := response.SLOs[0], response.SLOs[1]
+	if checkout.Source != "checkout" || checkout.Errors != 10 || checkout.Status != "fast_burn" || checkout.BudgetRemaining >= 0 {
+		t.Errorf("Expected checkout burning fast with its budget overspent, got %+v", checkout)
+	}
+	if search.Status != "no_data" || search.WindowDays != 30 {
+		t.Errorf("Expected search without data and the default window, got %+v", search)
+	}
+
+	checkSLOs(time.Now())
+	checkSLOs(time.Now()) // within the alert's window, no repeat
+	alerts, _ := recentAlerts(time.Now().Add(-time.Hour), 10)
+	if len(alerts) != 1 || alerts[0].Rule != "slo-fast-burn" || alerts[0].Source != "checkout" {
+		t.Errorf("Expected one fast burn alert for checkout, got %+v", alerts)
+	}
+}
@@ -0,0 +1,422 @@
+// CubicLog Source Maps - Readable stack traces from minified JavaScript
+//
+//   - POST   /api/sourcemaps?source=web-checkout&release=1.4.0&file=app.3f9a.min.js
+//     upload a source map (the map's JSON as body, gzip allowed)
+//   - GET    /api/sourcemaps              uploaded maps (?source=)
+//   - DELETE /api/sourcemaps/{id}         remove a map
+//
+// A map belongs to a source, a release and the minified file it describes
+// (file defaults to the map's own "file"). Uploading again for the same three
+// replaces the map, so a build step can simply upload after every deploy;
+// maps uploaded without a release apply to every release of the source.
+//
+// When a log arrives whose body holds frames of a mapped file ("at t
+// (https://cdn.example.com/js/app.3f9a.min.js:1:48211)", "n@app.3f9a.min.js:1:902"),
+// each position is rewritten to the original file, line and column before the
+// log is stored: "src/cart/total.ts:42:17". The map is picked by the log's
+// release (see releases.go). The body gets source_mapped with the number of
+// resolved frames; frames of files without a map stay as they are.
+//
+// Only regular (version 3) maps are supported, not index maps with sections.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSourceMapBytes is the largest source map accepted
+const maxSourceMapBytes = 50 << 20
+
+// SourceMapInfo describes an uploaded source map
+type SourceMapInfo struct {
+	ID         string    `json:"id"`
+	Source     string    `json:"source"`
+	Release    string    `json:"release,omitempty"`
+	File       string    `json:"file"`
+	Sources    int       `json:"sources"` // original files the map covers
+	Size       int       `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// sourceMaps caches the uploaded maps (without their content) and the maps
+// parsed so far, by ID
+var sourceMaps = struct {
+	sync.RWMutex
+	list   []SourceMapInfo
+	parsed map[string]*sourceMap
+}{}
+
+// jsFramePattern finds the file:line:column positions of JavaScript stack frames
+var jsFramePattern = regexp.MustCompile(`([^\s()@"'\\]+\.(?:m?js|cjs))(?:\?[^\s():"'\\]*)?:(\d+):(\d+)`)
+
+// sourceMap is a decoded source map
+type sourceMap struct {
+	sources []string
+	lines   [][]mapSegment // by generated line, sorted by column
+}
+
+// mapSegment maps a generated column to an original position (source -1 if none)
+type mapSegment struct {
+	column, source, line, sourceColumn int
+}
+
+// createSourceMapsTable creates the source map table
+func createSourceMapsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS source_maps (
+		id          TEXT PRIMARY KEY,
+		source      TEXT NOT NULL,
+		release     TEXT NOT NULL DEFAULT '',
+		file        TEXT NOT NULL,
+		sources     INTEGER NOT NULL,
+		size        INTEGER NOT NULL,
+		content     TEXT NOT NULL,
+		uploaded_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// loadSourceMaps reads the list of uploaded maps into the cache
+func loadSourceMaps() error {
+	rows, err := db.Query("SELECT id, source, release, file, sources, size, uploaded_at FROM source_maps ORDER BY source, release, file")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	list := []SourceMapInfo{}
+	for rows.Next() {
+		var info SourceMapInfo
+		if err := rows.Scan(&info.ID, &info.Source, &info.Release, &info.File, &info.Sources, &info.Size, (*scanTime)(&info.UploadedAt)); err != nil {
+			return err
+		}
+		list = append(list, info)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sourceMaps.Lock()
+	sourceMaps.list = list
+	sourceMaps.parsed = map[string]*sourceMap{}
+	sourceMaps.Unlock()
+	return nil
+}
+
+// parseSourceMap decodes a version 3 source map
+func parseSourceMap(data []byte) (*sourceMap, string, error) {
+	var raw struct {
+		Version    int               `json:"version"`
+		File       string            `json:"file"`
+		SourceRoot string            `json:"sourceRoot"`
+		Sources    []string          `json:"sources"`
+		Mappings   string            `json:"mappings"`
+		Sections   []json.RawMessage `json:"sections"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, "", fmt.Errorf("not a source map (invalid JSON)")
+	}
+	if len(raw.Sections) > 0 {
+		return nil, "", fmt.Errorf("index maps with sections aren't supported - upload the map of each section")
+	}
+	if raw.Version != 3 {
+		return nil, "", fmt.Errorf("unsupported source map version %d - only version 3 is supported", raw.Version)
+	}
+
+	m := &sourceMap{}
+	for _, source := range raw.Sources {
+		if raw.SourceRoot != "" {
+			source = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + source
+		}
+		m.sources = append(m.sources, source)
+	}
+	lines, err := decodeMappings(raw.Mappings, len(m.sources))
+	if err != nil {
+		return nil, "", err
+	}
+	m.lines = lines
+	return m, raw.File, nil
+}
+
+// base64VLQ holds the digit value of each base64 character (-1 for others)
+var base64VLQ = func() [256]int {
+	var digits [256]int
+	for i := range digits {
+		digits[i] = -1
+	}
+	for i, c := range "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/" {
+		digits[c] = i
+	}
+	return digits
+}()
+
+// decodeMappings decodes the base64 VLQ mappings of a source map (names are
+// not needed to resolve positions and are skipped)
+func decodeMappings(mappings string, sources int) ([][]mapSegment, error) {
+	var lines [][]mapSegment
+	var source, line, sourceColumn int
+	for _, group := range strings.Split(mappings, ";") {
+		var segments []mapSegment
+		column := 0
+		for _, encoded := range strings.Split(group, ",") {
+			if encoded == "" {
+				continue
+			}
+			var fields []int
+			for i := 0; i < len(encoded); {
+				value, shift := 0, 0
+				for {
+					if i >= len(encoded) || base64VLQ[encoded[i]] < 0 {
+						return nil, fmt.Errorf("invalid mappings")
+					}
+					digit := base64VLQ[encoded[i]]
+					i++
+					value += (digit & 31) << shift
+					shift += 5
+					if digit&32 == 0 {
+						break
+					}
+				}
+				if value&1 == 1 {
+					value = -(value >> 1)
+				} else {
+					value >>= 1
+				}
+				fields = append(fields, value)
+			}
+
+			column += fields[0]
+			segment := mapSegment{column: column, source: -1}
+			if len(fields) >= 4 {
+				source += fields[1]
+				line += fields[2]
+				sourceColumn += fields[3]
+				if source < 0 || source >= sources {
+					return nil, fmt.Errorf("invalid mappings (source %d out of range)", source)
+				}
+				segment.source, segment.line, segment.sourceColumn = source, line, sourceColumn
+			}
+			segments = append(segments, segment)
+		}
+		sort.SliceStable(segments, func(i, j int) bool { return segments[i].column < segments[j].column })
+		lines = append(lines, segments)
+	}
+	return lines, nil
+}
+
+// lookup returns the original position of a 1-based generated line and column
+func (m *sourceMap) lookup(line, column int) (string, int, int, bool) {
+	if line < 1 || line > len(m.lines) {
+		return "", 0, 0, false
+	}
+	segments := m.lines[line-1]
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].column > column-1 }) - 1
+	if i < 0 || segments[i].source < 0 {
+		return "", 0, 0, false
+	}
+	segment := segments[i]
+	return m.sources[segment.source], segment.line + 1, segment.sourceColumn + 1, true
+}
+
+// findSourceMap returns the parsed map for a minified file of a source and
+// release, preferring a map uploaded for the release over one without
+func findSourceMap(source, release, file string) *sourceMap {
+	sourceMaps.RLock()
+	var match *SourceMapInfo
+	for i, info := range sourceMaps.list {
+		if info.Source != source || info.File != file {
+			continue
+		}
+		if info.Release == release || (info.Release == "" && match == nil) {
+			match = &sourceMaps.list[i]
+		}
+	}
+	var parsed *sourceMap
+	if match != nil {
+		parsed = sourceMaps.parsed[match.ID]
+	}
+	sourceMaps.RUnlock()
+	if match == nil || parsed != nil {
+		return parsed
+	}
+
+	var content string
+	if err := db.QueryRow(db.Rebind("SELECT content FROM source_maps WHERE id = ?"), match.ID).Scan(&content); err != nil {
+		return nil
+	}
+	parsed, _, err := parseSourceMap([]byte(content))
+	if err != nil {
+		return nil
+	}
+	sourceMaps.Lock()
+	if sourceMaps.parsed != nil {
+		sourceMaps.parsed[match.ID] = parsed
+	}
+	sourceMaps.Unlock()
+	return parsed
+}
+
+// resolveSourceMaps rewrites minified JavaScript frames in a log body to their
+// original positions and returns the number of frames resolved
+func resolveSourceMaps(source, release string, body map[string]interface{}) int {
+	sourceMaps.RLock()
+	uploaded := len(sourceMaps.list) > 0
+	sourceMaps.RUnlock()
+	if !uploaded || body == nil {
+		return 0
+	}
+	resolved := 0
+	var rewrite func(value interface{}) interface{}
+	rewrite = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return jsFramePattern.ReplaceAllStringFunc(v, func(frame string) string {
+				match := jsFramePattern.FindStringSubmatch(frame)
+				m := findSourceMap(source, release, path.Base(match[1]))
+				if m == nil {
+					return frame
+				}
+				line, _ := strconv.Atoi(match[2])
+				column, _ := strconv.Atoi(match[3])
+				file, originalLine, originalColumn, ok := m.lookup(line, column)
+				if !ok {
+					return frame
+				}
+				resolved++
+				return fmt.Sprintf("%s:%d:%d", file, originalLine, originalColumn)
+			})
+		case map[string]interface{}:
+			for key, nested := range v {
+				v[key] = rewrite(nested)
+			}
+		case []interface{}:
+			for i, nested := range v {
+				v[i] = rewrite(nested)
+			}
+		}
+		return value
+	}
+	rewrite(body)
+	if resolved > 0 {
+		body["source_mapped"] = resolved
+	}
+	return resolved
+}
+
+// handleSourceMaps answers GET and POST /api/sourcemaps
+func handleSourceMaps(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		source := r.URL.Query().Get("source")
+		list := []SourceMapInfo{}
+		sourceMaps.RLock()
+		for _, info := range sourceMaps.list {
+			if source == "" || info.Source == source {
+				list = append(list, info)
+			}
+		}
+		sourceMaps.RUnlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"sourcemaps": list})
+
+	case http.MethodPost:
+		params := r.URL.Query()
+		info := SourceMapInfo{Source: params.Get("source"), Release: params.Get("release"), File: params.Get("file")}
+		if info.Source == "" {
+			http.Error(w, "source is required", http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSourceMapBytes)
+		body, err := decodedBody(r, maxSourceMapBytes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			if isRequestTooLarge(err) {
+				http.Error(w, fmt.Sprintf("Source map too large - limit is %d bytes", maxSourceMapBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read source map", http.StatusBadRequest)
+			return
+		}
+		parsed, file, err := parseSourceMap(content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if info.File == "" {
+			info.File = file
+		}
+		if info.File = path.Base(info.File); info.File == "." || info.File == "/" {
+			http.Error(w, "file is required - the map doesn't name its minified file", http.StatusBadRequest)
+			return
+		}
+
+		id := make([]byte, 6)
+		rand.Read(id)
+		info.ID = "sourcemap-" + hex.EncodeToString(id)
+		info.Sources = len(parsed.sources)
+		info.Size = len(content)
+		info.UploadedAt = time.Now().UTC().Truncate(time.Second)
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to save source map", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		tx.Exec(db.Rebind("DELETE FROM source_maps WHERE source = ? AND release = ? AND file = ?"), info.Source, info.Release, info.File)
+		if _, err := tx.Exec(db.Rebind(`INSERT INTO source_maps (id, source, release, file, sources, size, content, uploaded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`), info.ID, info.Source, info.Release, info.File, info.Sources, info.Size,
+			string(content), dbTime(info.UploadedAt)); err != nil {
+			http.Error(w, "Failed to save source map", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to save source map", http.StatusInternalServerError)
+			return
+		}
+		loadSourceMaps()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(info)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSourceMap answers DELETE /api/sourcemaps/{id}
+func handleSourceMap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/sourcemaps/")
+	result, err := db.Exec(db.Rebind("DELETE FROM source_maps WHERE id = ?"), id)
+	if err != nil {
+		http.Error(w, "Failed to delete source map", http.StatusInternalServerError)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Source map not found", http.StatusNotFound)
+		return
+	}
+	loadSourceMaps()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "deleted", "id": id})
+}
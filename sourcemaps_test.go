@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSourceMaps tests uploading source maps and resolving minified frames at ingestion
+func TestSourceMaps(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { sourceMaps.list = nil }()
+
+	// Column 10 of line 1 in app.min.js is line 42, column 17 of src/cart.ts
+	sourceMapJSON := `{"version": 3, "file": "app.min.js", "sourceRoot": "webpack://shop", "sources": ["src/cart.ts"], "names": [], "mappings": "AAAA,UAyCgB"}`
+	upload := func(query, body string) (int, SourceMapInfo) {
+		w := httptest.NewRecorder()
+		handleSourceMaps(w, httptest.NewRequest("POST", "/api/sourcemaps"+query, strings.NewReader(body)))
+		var info SourceMapInfo
+		json.Unmarshal(w.Body.Bytes(), &info)
+		return w.Code, info
+	}
+	if code, _ := upload("?source=web", `{"version": 3, "sections": []}`); code != 400 {
+		t.Errorf("Expected status 400 for an unsupported map, got %d", code)
+	}
+	code, info := upload("?source=web&release=1.4.0", sourceMapJSON)
+	if code != 201 || info.File != "app.min.js" || info.Sources != 1 {
+		t.Fatalf("Expected the map to be stored for app.min.js, got %d %+v", code, info)
+	}
+
+	send := func(body string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		var created Log
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created.Body
+	}
+	body := send(`{"header": {"title": "TypeError", "source": "web"}, "body": {"release": "1.4.0",
+		"error": {"stack": "TypeError: x is undefined\n    at t (https://cdn.example.com/js/app.min.js?v=3:1:15)\n    at n (https://cdn.example.com/js/vendor.js:1:99)"}}}`)
+	stack := body["error"].(map[string]interface{})["stack"].(string)
+	if !strings.Contains(stack, "at t (webpack://shop/src/cart.ts:42:17)") || !strings.Contains(stack, "vendor.js:1:99") || body["source_mapped"] != float64(1) {
+		t.Errorf("Expected the app.min.js frame resolved and vendor.js untouched, got %v", body)
+	}
+
+	// Other releases and sources have no map
+	if body := send(`{"header": {"title": "TypeError", "source": "web"}, "body": {"release": "1.5.0", "stack": "t@app.min.js:1:15"}}`); body["stack"] != "t@app.min.js:1:15" {
+		t.Errorf("Expected no resolution for another release, got %v", body)
+	}
+
+	w := httptest.NewRecorder()
+	handleSourceMap(w, httptest.NewRequest("DELETE", "/api/sourcemaps/"+info.ID, nil))
+	if w.Code != 200 || len(sourceMaps.list) != 0 {
+		t.Errorf("Expected the map deleted, got %d", w.Code)
+	}
+}
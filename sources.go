@@ -0,0 +1,293 @@
+// CubicLog Source Registry - Owners, environments and runbooks for sources
+//
+//   - GET    /api/sources          registered sources and sources seen in the last 7 days
+//   - GET    /api/sources/{name}   one source
+//   - PUT    /api/sources/{name}   register or update it
+//   - DELETE /api/sources/{name}   forget its metadata
+//
+// Sources are the derived sources of the logs. Registering one attaches who
+// owns it and what to do when it breaks:
+//
+//	{"owner": "team-payments", "environment": "production", "expected_per_day": 5000,
+//	 "runbook_url": "https://wiki.example.com/runbooks/checkout"}
+//
+// Alerts about the source carry its owner and runbook (in /api/alerts, the
+// webhook payload and templates as .Owner and .RunbookURL), and the dashboard
+// shows them next to its logs. With expected_per_day set, the listing
+// compares the last 24 hours against it: "low" below half, "high" above twice
+// the expected volume.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceInfo is the registered metadata of a source
+type SourceInfo struct {
+	Name           string     `json:"name"`
+	Owner          string     `json:"owner"`
+	Environment    string     `json:"environment"`
+	ExpectedPerDay int        `json:"expected_per_day"` // 0 = no expectation
+	RunbookURL     string     `json:"runbook_url"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// sourceView is one source in GET /api/sources
+type sourceView struct {
+	SourceInfo
+	Registered bool       `json:"registered"`
+	Logs24h    int        `json:"logs_24h"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+	Volume     string     `json:"volume,omitempty"` // ok, low or high with expected_per_day
+}
+
+// sourceRegistry caches the registered sources for alerts
+var sourceRegistry = struct {
+	sync.RWMutex
+	sources map[string]SourceInfo
+}{sources: map[string]SourceInfo{}}
+
+// createSourcesTable creates the source registry
+func createSourcesTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS sources (
+		name             TEXT PRIMARY KEY,
+		owner            TEXT NOT NULL DEFAULT '',
+		environment      TEXT NOT NULL DEFAULT '',
+		expected_per_day INTEGER NOT NULL DEFAULT 0,
+		runbook_url      TEXT NOT NULL DEFAULT '',
+		updated_at       TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// loadSourceRegistry reads the registered sources into the cache
+func loadSourceRegistry() error {
+	rows, err := db.Query("SELECT name, owner, environment, expected_per_day, runbook_url, updated_at FROM sources")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	sources := map[string]SourceInfo{}
+	for rows.Next() {
+		var info SourceInfo
+		var updatedAt time.Time
+		if err := rows.Scan(&info.Name, &info.Owner, &info.Environment, &info.ExpectedPerDay, &info.RunbookURL, (*scanTime)(&updatedAt)); err != nil {
+			return err
+		}
+		info.UpdatedAt = &updatedAt
+		sources[info.Name] = info
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sourceRegistry.Lock()
+	sourceRegistry.sources = sources
+	sourceRegistry.Unlock()
+	return nil
+}
+
+// lookupSource returns the registered metadata of a source
+func lookupSource(name string) (SourceInfo, bool) {
+	sourceRegistry.RLock()
+	defer sourceRegistry.RUnlock()
+	info, ok := sourceRegistry.sources[name]
+	return info, ok
+}
+
+// withSourceInfo adds the owner and runbook of the alert's source
+func withSourceInfo(alert Alert) Alert {
+	if info, ok := lookupSource(alert.Source); ok {
+		alert.Owner, alert.RunbookURL = info.Owner, info.RunbookURL
+	}
+	return alert
+}
+
+// validate checks an update to a source's metadata
+func (info *SourceInfo) validate() error {
+	info.Owner = strings.TrimSpace(info.Owner)
+	info.Environment = strings.ToLower(strings.TrimSpace(info.Environment))
+	info.RunbookURL = strings.TrimSpace(info.RunbookURL)
+	if len(info.Owner) > 100 || len(info.Environment) > 50 {
+		return fmt.Errorf("owner must be at most 100 and environment at most 50 characters")
+	}
+	if info.ExpectedPerDay < 0 {
+		return fmt.Errorf("expected_per_day can't be negative")
+	}
+	if info.RunbookURL != "" {
+		parsed, err := url.Parse(info.RunbookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("runbook_url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// saveSourceInfo stores the metadata of a source
+func saveSourceInfo(info SourceInfo) error {
+	now := dbTime(time.Now())
+	result, err := db.Exec(db.Rebind("UPDATE sources SET owner = ?, environment = ?, expected_per_day = ?, runbook_url = ?, updated_at = ? WHERE name = ?"),
+		info.Owner, info.Environment, info.ExpectedPerDay, info.RunbookURL, now, info.Name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+	_, err = db.Exec(db.Rebind("INSERT INTO sources (name, owner, environment, expected_per_day, runbook_url, updated_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		info.Name, info.Owner, info.Environment, info.ExpectedPerDay, info.RunbookURL, now)
+	return err
+}
+
+// listSources merges the registry with the sources seen in the last 7 days
+func listSources(now time.Time) ([]sourceView, error) {
+	day, week := now.UTC().Add(-24*time.Hour), now.UTC().AddDate(0, 0, -7)
+	rows, release, err := queryLogs(week.Format("2006-01-02"), "", func(table string) (string, []interface{}) {
+		return db.Rebind(`
+			SELECT COALESCE(derived_source, 'unknown'), SUM(CASE WHEN timestamp >= ? THEN 1 ELSE 0 END), MAX(timestamp)
+			FROM ` + table + `
+			WHERE timestamp >= ?
+			GROUP BY COALESCE(derived_source, 'unknown')`), []interface{}{dbTime(day), dbTime(week)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]*sourceView{}
+	for rows.Next() {
+		view := &sourceView{}
+		var lastSeen time.Time
+		if err := rows.Scan(&view.Name, &view.Logs24h, (*scanTime)(&lastSeen)); err != nil {
+			release()
+			return nil, err
+		}
+		view.LastSeen = &lastSeen
+		seen[view.Name] = view
+	}
+	err = rows.Err()
+	release()
+	if err != nil {
+		return nil, err
+	}
+
+	sourceRegistry.RLock()
+	for name, info := range sourceRegistry.sources {
+		view := seen[name]
+		if view == nil {
+			view = &sourceView{}
+			seen[name] = view
+		}
+		view.SourceInfo, view.Registered = info, true
+		if info.ExpectedPerDay > 0 {
+			switch {
+			case view.Logs24h*2 < info.ExpectedPerDay:
+				view.Volume = "low"
+			case view.Logs24h > info.ExpectedPerDay*2:
+				view.Volume = "high"
+			default:
+				view.Volume = "ok"
+			}
+		}
+	}
+	sourceRegistry.RUnlock()
+
+	sources := make([]sourceView, 0, len(seen))
+	for _, view := range seen {
+		sources = append(sources, *view)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Registered != sources[j].Registered {
+			return sources[i].Registered
+		}
+		return sources[i].Name < sources[j].Name
+	})
+	return sources, nil
+}
+
+// handleSources answers GET /api/sources
+func handleSources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sources, err := listSources(time.Now())
+	if err != nil {
+		http.Error(w, "Failed to list sources", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sources": sources})
+}
+
+// handleSource answers GET, PUT and DELETE /api/sources/{name}
+func handleSource(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/sources/"))
+	if name == "" || len(name) > 100 {
+		http.Error(w, "Source name must be 1-100 characters", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var info SourceInfo
+		if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := info.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info.Name = name
+		if err := saveSourceInfo(info); err != nil {
+			http.Error(w, "Failed to save source", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		result, err := db.Exec(db.Rebind("DELETE FROM sources WHERE name = ?"), name)
+		if err != nil {
+			http.Error(w, "Failed to delete source", http.StatusInternalServerError)
+			return
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			http.Error(w, "Source not registered", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != http.MethodGet {
+		if err := loadSourceRegistry(); err != nil {
+			http.Error(w, "Failed to load sources", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sources, err := listSources(time.Now())
+	if err != nil {
+		http.Error(w, "Failed to list sources", http.StatusInternalServerError)
+		return
+	}
+	for _, source := range sources {
+		if source.Name == name {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(source)
+			return
+		}
+	}
+	if r.Method == http.MethodDelete {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "deleted", "name": name})
+		return
+	}
+	http.Error(w, "Source not found", http.StatusNotFound)
+}
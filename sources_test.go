@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSourceRegistry tests registering sources and their metadata on alerts
+func TestSourceRegistry(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { sourceRegistry.sources = map[string]SourceInfo{} }()
+
+	for i := 0; i < 3; i++ {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs",
+			strings.NewReader(`{"header":{"title":"Order placed","source":"checkout"}}`)))
+	}
+	createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs",
+		strings.NewReader(`{"header":{"title":"Index rebuilt","source":"search"}}`)))
+
+	register := func(name, body string) (int, sourceView) {
+		w := httptest.NewRecorder()
+		handleSource(w, httptest.NewRequest("PUT", "/api/sources/"+name, strings.NewReader(body)))
+		var view sourceView
+		json.Unmarshal(w.Body.Bytes(), &view)
+		return w.Code, view
+	}
+	code, checkout := register("checkout", `{"owner": "team-payments", "environment": "Production", "expected_per_day": 100,
+		"runbook_url": "https://wiki.example.com/runbooks/checkout"}`)
+	if code != 200 || checkout.Environment != "production" || checkout.Logs24h != 3 || checkout.Volume != "low" {
+		t.Errorf("Expected checkout registered with 3 logs and low volume, got %d %+v", code, checkout)
+	}
+	if code, _ := register("checkout", `{"runbook_url": "javascript:alert(1)"}`); code != 400 {
+		t.Errorf("Expected status 400 for a non-http runbook, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handleSources(w, httptest.NewRequest("GET", "/api/sources", nil))
+	var response struct {
+		Sources []sourceView `json:"sources"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Sources) != 2 || response.Sources[0].Name != "checkout" || response.Sources[1].Registered {
+		t.Errorf("Expected registered checkout first and search unregistered, got %+v", response.Sources)
+	}
+
+	alert := fireAlert(Alert{Rule: "test", Kind: "escalation", Source: "checkout", Severity: "critical", Title: "Checkout down", Message: "down"})
+	stored, _ := recentAlerts(time.Now().Add(-time.Hour), 10)
+	if alert.Owner != "team-payments" || len(stored) != 1 || stored[0].RunbookURL != checkout.RunbookURL {
+		t.Errorf("Expected the alert to carry the owner and runbook, got %+v and %+v", alert, stored)
+	}
+
+	handleSource(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/api/sources/checkout", nil))
+	if _, ok := lookupSource("checkout"); ok {
+		t.Error("Expected checkout to be forgotten")
+	}
+}
@@ -0,0 +1,451 @@
+// CubicLog Write Circuit Breaker - Keep accepting logs while the database can't
+//
+// A full disk or a failing database used to turn every POST /api/logs into a
+// 500 and the log was lost. Now:
+//   - free disk space next to the database is checked every few seconds and
+//     the breaker opens before SQLite runs out of room (-min-free-disk)
+//   - a write failure (disk full, I/O error, read-only, connection lost) opens
+//     the breaker as well; lock contention (busy, locked) does not
+//   - while the breaker is open, logs are appended to a spool file (-spool-file)
+//     or, if that fails too or none is set, to a bounded in-memory buffer, and
+//     accepted with 202. There is no default spool file: next to the database
+//     it would fill up with the same disk, so point it at another one
+//   - once the database takes writes again the spool is replayed in order and
+//     the breaker closes; ingestion keeps going (into the spool) meanwhile
+//
+// Only when both the spool file and the memory buffer are exhausted does the
+// API answer 503 with Retry-After.
+package main
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Circuit breaker settings - configured once in main()
+var (
+	spoolPath          string                    // append-only spool file ("" = memory buffer only)
+	minFreeDiskMB      int64  = 100              // breaker opens below this much free space
+	spoolMemoryLimit          = 10000            // logs buffered in memory when the spool file is unusable
+	writeCheckInterval        = 10 * time.Second // how often disk space is checked and the spool replayed
+)
+
+// SQLite result codes meaning the database can't take writes right now
+const (
+	sqliteReadonly = 8  // SQLITE_READONLY
+	sqliteIOErr    = 10 // SQLITE_IOERR
+	sqliteFull     = 13 // SQLITE_FULL
+	sqliteCantOpen = 14 // SQLITE_CANTOPEN
+)
+
+// errSpoolFull is returned when a log can neither be stored nor spooled
+var errSpoolFull = errors.New("storage unavailable and spool buffer full")
+
+// storedLog is a log row ready for insertion (columns already sealed)
+type storedLog struct {
+	Type              string    `json:"type"`
+	Title             string    `json:"title"`
+	Description       string    `json:"description,omitempty"`
+	Source            string    `json:"source,omitempty"`
+	Color             string    `json:"color"`
+	Body              string    `json:"body"`
+	DerivedSeverity   string    `json:"derived_severity"`
+	DerivedSource     string    `json:"derived_source"`
+	DerivedCategory   string    `json:"derived_category"`
+	DerivedLanguage   string    `json:"derived_language,omitempty"`
+	DerivedDurationMs int       `json:"derived_duration_ms,omitempty"`
+	DerivedHTTPStatus int       `json:"derived_http_status,omitempty"`
+	Environment       string    `json:"environment,omitempty"`
+	Release           string    `json:"release,omitempty"`
+	Timestamp         time.Time `json:"timestamp"`
+}
+
+// writeBreaker tracks whether writes go to the database or the spool
+type writeBreaker struct {
+	mu       sync.Mutex
+	replayMu sync.Mutex // one replay at a time, without holding mu while inserting
+	open     bool
+	reason   string
+	memory   []storedLog // spooled logs that could not be written to the spool file
+	onDisk   int         // spooled logs waiting in the spool file
+}
+
+var breaker = &writeBreaker{}
+
+// storeLog inserts a log, spooling it when the database cannot take writes.
+// spooled reports whether the log is waiting in the spool instead of the database.
+func storeLog(row storedLog) (id int64, spooled bool, err error) {
+	if !breaker.isOpen() {
+		id, err = insertLogRow(row, false)
+		if err == nil || !isWriteFailure(err) {
+			return id, false, err
+		}
+		breaker.trip(err.Error())
+	}
+	return 0, true, breaker.spool(row)
+}
+
+// insertLogRow writes a row to the logs table and counts it for /api/stats
+// (see hourlystats.go); replayed rows keep their original timestamp
+func insertLogRow(row storedLog, keepTimestamp bool) (int64, error) {
+	hourlyStatsMu.RLock()
+	defer hourlyStatsMu.RUnlock()
+	timestamp := time.Now()
+	if keepTimestamp && !row.Timestamp.IsZero() {
+		timestamp = row.Timestamp
+	}
+	id, err := writeLogRow(row, keepTimestamp)
+	if err == nil {
+		countHourlyStats(row, timestamp)
+	}
+	return id, err
+}
+
+// writeLogRow inserts the row into the logs table
+func writeLogRow(row storedLog, keepTimestamp bool) (int64, error) {
+	if hashChainEnabled {
+		if !keepTimestamp {
+			row.Timestamp = time.Time{}
+		}
+		return insertChainedLog(row)
+	}
+
+	args := []interface{}{
+		row.Type,
+		row.Title,
+		row.Description, // Will be NULL if empty
+		row.Source,      // Will be NULL if empty
+		row.Color,
+		row.Body,
+		row.DerivedSeverity,
+		row.DerivedSource,
+		row.DerivedCategory,
+		row.Environment,       // Will be NULL if empty
+		row.DerivedLanguage,   // Will be NULL if empty
+		row.Release,           // Will be NULL if empty
+		row.DerivedDurationMs, // Will be NULL if 0
+		row.DerivedHTTPStatus, // Will be NULL if 0
+	}
+	if !keepTimestamp {
+		return db.InsertID(`
+		INSERT INTO logs (type, title, description, source, color, body, derived_severity, derived_source, derived_category, environment, derived_language, release, derived_duration_ms, derived_http_status)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, 0))`, args...)
+	}
+
+	// SQLite's CURRENT_TIMESTAMP format, so replayed rows sort and filter like the rest
+	var timestamp interface{} = row.Timestamp
+	if db.Driver() == "sqlite3" {
+		timestamp = row.Timestamp.UTC().Format("2006-01-02 15:04:05")
+	}
+	return db.InsertID(`
+		INSERT INTO logs (type, title, description, source, color, body, derived_severity, derived_source, derived_category, environment, derived_language, release, derived_duration_ms, derived_http_status, timestamp)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, 0), ?)`, append(args, timestamp)...)
+}
+
+// isWriteFailure reports whether err means the database cannot take writes
+// right now (as opposed to a problem with the log itself, or a lock another
+// writer holds for a moment)
+func isWriteFailure(err error) bool {
+	if code, ok := sqliteErrorCode(err); ok {
+		switch code {
+		case sqliteFull, sqliteIOErr, sqliteReadonly, sqliteCantOpen:
+			return true
+		}
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57": // connection exception, insufficient resources, operator intervention
+			return true
+		}
+		return pqErr.Code == "25006" // read_only_sql_transaction
+	}
+
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+// isOpen reports whether writes currently go to the spool
+func (b *writeBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// trip opens the breaker
+func (b *writeBreaker) trip(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		log.Printf("⚠️  Database writes suspended, spooling incoming logs: %s", reason)
+	}
+	b.open = true
+	b.reason = reason
+}
+
+// status returns the breaker state and the number of logs waiting to be replayed
+func (b *writeBreaker) status() (open bool, reason string, pending int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open, b.reason, b.onDisk + len(b.memory)
+}
+
+// oldestPending returns when the oldest log waiting to be replayed arrived
+// (zero when nothing is pending)
+func (b *writeBreaker) oldestPending() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.onDisk > 0 {
+		if f, err := os.Open(spoolPath); err == nil {
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+			var row storedLog
+			if scanner.Scan() && json.Unmarshal(scanner.Bytes(), &row) == nil {
+				return row.Timestamp
+			}
+		}
+	}
+	if len(b.memory) > 0 {
+		return b.memory[0].Timestamp
+	}
+	return time.Time{}
+}
+
+// spool appends a log to the spool file, falling back to the memory buffer
+func (b *writeBreaker) spool(row storedLog) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if row.Timestamp.IsZero() {
+		row.Timestamp = time.Now()
+	}
+
+	// Keep order: once anything is buffered in memory, later logs go there too
+	if spoolPath != "" && len(b.memory) == 0 {
+		if err := appendSpoolFile(row); err == nil {
+			b.onDisk++
+			return nil
+		}
+	}
+	if len(b.memory) >= spoolMemoryLimit {
+		return errSpoolFull
+	}
+	b.memory = append(b.memory, row)
+	return nil
+}
+
+// appendSpoolFile writes one JSON line to the spool file
+func appendSpoolFile(row storedLog) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(spoolPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replay writes spooled logs back to the database, oldest first, and closes
+// the breaker once everything is stored. Batches are taken under the lock and
+// inserted after releasing it, so ingestion (still spooling) isn't blocked
+// while the backlog drains.
+func (b *writeBreaker) replay() error {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	for {
+		batch, fromFile, err := b.takeBatch()
+		if err != nil {
+			return err
+		}
+		if batch == nil {
+			return nil
+		}
+		for i, row := range batch {
+			if _, err := insertLogRow(row, true); err != nil {
+				b.requeue(batch[i:])
+				return err
+			}
+		}
+		if fromFile && len(batch) > 0 {
+			log.Printf("📥 Replayed %d spooled logs", len(batch))
+		}
+	}
+}
+
+// takeBatch removes the oldest pending logs from the spool: the whole spool
+// file, or else the memory buffer. With nothing pending it closes the breaker
+// and returns a nil batch.
+func (b *writeBreaker) takeBatch() (batch []storedLog, fromFile bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.onDisk > 0 {
+		rows, err := readSpoolFile()
+		if err != nil {
+			return nil, false, err
+		}
+		b.onDisk = 0
+		if err := os.Remove(spoolPath); err != nil && !os.IsNotExist(err) {
+			if err := os.Truncate(spoolPath, 0); err != nil {
+				b.onDisk = len(rows)
+				return nil, false, err
+			}
+		}
+		return append([]storedLog{}, rows...), true, nil
+	}
+	if len(b.memory) > 0 {
+		batch, b.memory = b.memory, nil
+		return batch, false, nil
+	}
+
+	if b.open {
+		log.Printf("✅ Database writes resumed")
+	}
+	b.open = false
+	b.reason = ""
+	return nil, false, nil
+}
+
+// requeue puts logs that could not be replayed back in front of the logs
+// spooled while they were being inserted
+func (b *writeBreaker) requeue(rows []storedLog) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The spool file, when in use, holds the oldest pending logs
+	if b.onDisk > 0 {
+		pending, err := readSpoolFile()
+		if err == nil {
+			b.rewriteSpoolFile(append(append([]storedLog{}, rows...), pending...))
+			return
+		}
+	}
+	b.memory = append(append([]storedLog{}, rows...), b.memory...)
+}
+
+// readSpoolFile returns the logs in the spool file (none if it doesn't exist)
+func readSpoolFile() ([]storedLog, error) {
+	f, err := os.Open(spoolPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []storedLog
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var row storedLog
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			log.Printf("⚠️  Skipping unreadable spool entry: %v", err)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// rewriteSpoolFile replaces the spool file with the logs still pending. If the
+// file cannot be rewritten (typically: still no disk space) they move to the
+// memory buffer instead, so stored rows are never replayed twice.
+func (b *writeBreaker) rewriteSpoolFile(rows []storedLog) {
+	tmp := spoolPath + ".tmp"
+	if f, err := os.Create(tmp); err == nil {
+		w := bufio.NewWriter(f)
+		for _, row := range rows {
+			line, _ := json.Marshal(row)
+			w.Write(append(line, '\n'))
+		}
+		flushErr := w.Flush()
+		closeErr := f.Close()
+		if flushErr == nil && closeErr == nil && os.Rename(tmp, spoolPath) == nil {
+			b.onDisk = len(rows)
+			return
+		}
+		os.Remove(tmp)
+	}
+
+	b.memory = append(append([]storedLog{}, rows...), b.memory...)
+	b.onDisk = 0
+	if err := os.Remove(spoolPath); err != nil {
+		os.Truncate(spoolPath, 0)
+	}
+}
+
+// recoverSpool picks up a spool file left behind by a previous run
+func recoverSpool() {
+	if spoolPath == "" {
+		return
+	}
+	f, err := os.Open(spoolPath)
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	count := 0
+	for scanner.Scan() {
+		count++
+	}
+	f.Close()
+
+	breaker.mu.Lock()
+	breaker.onDisk = count
+	breaker.mu.Unlock()
+	if count > 0 {
+		log.Printf("📥 Found %d spooled logs from a previous run", count)
+	}
+}
+
+// checkWriteHealth opens the breaker when disk space runs low and replays the
+// spool once the database is writable again
+func checkWriteHealth(dataDir string) {
+	if dataDir != "" && minFreeDiskMB > 0 {
+		if free, err := freeDiskBytes(dataDir); err == nil && free < uint64(minFreeDiskMB)*1024*1024 {
+			breaker.trip(fmt.Sprintf("only %d MB free on %s", free/1024/1024, dataDir))
+			return
+		}
+	}
+
+	if open, _, pending := breaker.status(); open || pending > 0 {
+		if err := breaker.replay(); err != nil {
+			log.Printf("⚠️  Spool replay failed, will retry: %v", err)
+		}
+	}
+}
+
+// startWriteMonitor runs checkWriteHealth periodically; dataDir is the
+// directory holding the database ("" when there is no local file to watch)
+func startWriteMonitor(dataDir string) {
+	recoverSpool()
+	checkWriteHealth(dataDir)
+	go func() {
+		for range time.Tick(writeCheckInterval) {
+			checkWriteHealth(dataDir)
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSpoolWhileWritesSuspended tests that logs are spooled while the breaker is open and replayed afterwards
+func TestSpoolWhileWritesSuspended(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	originalBreaker, originalPath, originalLimit := breaker, spoolPath, spoolMemoryLimit
+	defer func() { breaker, spoolPath, spoolMemoryLimit = originalBreaker, originalPath, originalLimit }()
+	breaker = &writeBreaker{}
+	spoolPath = filepath.Join(t.TempDir(), "logs.db.spool")
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/logs", bytes.NewBufferString(`{"header": {"title": "Disk is full"}}`))
+		w := httptest.NewRecorder()
+		createLog(w, req)
+		return w
+	}
+
+	breaker.trip("test")
+	if w := post(); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202 while spooling, got %d", w.Code)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected no logs in database while spooling, got %d", count)
+	}
+
+	if err := breaker.replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM logs WHERE title = 'Disk is full'").Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected spooled log to be replayed, got %d logs", count)
+	}
+	if breaker.isOpen() {
+		t.Error("Expected breaker to close after replay")
+	}
+	if _, err := os.Stat(spoolPath); !os.IsNotExist(err) {
+		t.Error("Expected spool file to be removed after replay")
+	}
+
+	// Without a spool file and with the memory buffer full, clients are told to retry
+	spoolPath = ""
+	spoolMemoryLimit = 1
+	breaker.trip("test")
+	post()
+	w := post()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After when spool is full, got %d", w.Code)
+	}
+}
+
+// TestReplayKeepsSpooling tests that logs spooled while a replay runs are kept behind the replayed ones
+func TestReplayKeepsSpooling(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	originalBreaker, originalPath := breaker, spoolPath
+	defer func() { breaker, spoolPath = originalBreaker, originalPath }()
+	breaker = &writeBreaker{}
+	spoolPath = filepath.Join(t.TempDir(), "logs.spool")
+
+	breaker.trip("test")
+	breaker.spool(storedLog{Type: "info", Title: "first"})
+	batch, fromFile, err := breaker.takeBatch()
+	if err != nil || !fromFile || len(batch) != 1 {
+		t.Fatalf("Expected the spool file as one batch, got %d logs (file %v, err %v)", len(batch), fromFile, err)
+	}
+
+	// Ingestion is not blocked while the batch is inserted, and a failed batch goes back in front
+	breaker.spool(storedLog{Type: "info", Title: "second"})
+	breaker.requeue(batch)
+	rows, err := readSpoolFile()
+	if err != nil || len(rows) != 2 || rows[0].Title != "first" || rows[1].Title != "second" {
+		t.Fatalf("Expected first then second in the spool file, got %+v (err %v)", rows, err)
+	}
+
+	if err := breaker.replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	var titles []string
+	dbRows, _ := db.Query("SELECT title FROM logs ORDER BY id")
+	for dbRows.Next() {
+		var title string
+		dbRows.Scan(&title)
+		titles = append(titles, title)
+	}
+	dbRows.Close()
+	if len(titles) != 2 || titles[0] != "first" || titles[1] != "second" {
+		t.Errorf("Expected logs replayed in order, got %v", titles)
+	}
+	if breaker.isOpen() {
+		t.Error("Expected breaker to close after replay")
+	}
+}
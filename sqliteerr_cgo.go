@@ -0,0 +1,18 @@
+//go:build cgo
+
+package main
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteErrorCode returns the SQLite result code carried by err, if any
+func sqliteErrorCode(err error) (int, bool) {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return int(sqliteErr.Code), true
+	}
+	return 0, false
+}
@@ -0,0 +1,30 @@
+//go:build cgo
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// TestWriteFailureClassification tests that only outages trip the breaker, not lock contention
+func TestWriteFailureClassification(t *testing.T) {
+	cases := []struct {
+		code sqlite3.ErrNo
+		want bool
+	}{
+		{sqlite3.ErrFull, true},
+		{sqlite3.ErrIoErr, true},
+		{sqlite3.ErrReadonly, true},
+		{sqlite3.ErrCantOpen, true},
+		{sqlite3.ErrBusy, false},
+		{sqlite3.ErrLocked, false},
+		{sqlite3.ErrConstraint, false},
+	}
+	for _, c := range cases {
+		if got := isWriteFailure(sqlite3.Error{Code: c.code}); got != c.want {
+			t.Errorf("isWriteFailure(%v) = %v, want %v", c.code, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package main
+
+// sqliteErrorCode returns the SQLite result code carried by err, if any.
+// Without cgo the SQLite driver is a stub whose errors carry no code.
+func sqliteErrorCode(err error) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,196 @@
+// CubicLog Storage Layer - Pluggable persistence behind a small Store interface
+//
+// SQLite remains the zero-configuration default. Operators whose volume outgrows
+// a single SQLite file can switch to PostgreSQL with -db-driver=postgres and a
+// connection string in -db. Both drivers speak database/sql, so the Store keeps
+// the familiar Exec/Query/QueryRow surface and only papers over the handful of
+// dialect differences (placeholders, auto-increment ids, date functions).
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	// PostgreSQL driver for the optional -db-driver=postgres backend
+	_ "github.com/lib/pq"
+)
+
+// Store abstracts the persistence layer used by every handler
+type Store interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Begin() (*sql.Tx, error)
+	Conn(ctx context.Context) (*sql.Conn, error)
+	Ping() error
+	Close() error
+
+	// Driver returns the database/sql driver name ("sqlite3" or "postgres")
+	Driver() string
+	// Rebind converts '?' placeholders into the driver's native form
+	Rebind(query string) string
+	// InsertID executes an INSERT and returns the generated row id
+	InsertID(query string, args ...interface{}) (int64, error)
+	// HourExpr returns an expression extracting the hour (0-23) from a timestamp column
+	HourExpr(column string) string
+	// Like returns the case-insensitive LIKE operator for queries matching
+	// user input (SQLite's LIKE already ignores ASCII case, PostgreSQL's doesn't)
+	Like() string
+	// Schema returns the DDL creating the logs table and its base indexes
+	// (later changes are migrations, see migrations.go)
+	Schema() string
+}
+
+// openStore opens a database connection for the given driver and wraps it in a Store
+func openStore(driver, dsn string) (Store, error) {
+	switch driver {
+	case "", "sqlite", "sqlite3":
+		conn, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			return nil, err
+		}
+		// Every connection to :memory: gets its own empty database, so share one
+		memory := isMemoryDSN(dsn)
+		if memory {
+			conn.SetMaxOpenConns(1)
+		}
+		return &sqliteStore{DB: conn, memory: memory}, nil
+	case "postgres", "postgresql":
+		conn, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &postgresStore{DB: conn}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s' - use sqlite3 or postgres", driver)
+	}
+}
+
+// =============================================================================
+// SQLITE STORE (DEFAULT)
+// =============================================================================
+
+// sqliteStore is the default zero-configuration backend
+type sqliteStore struct {
+	*sql.DB
+	memory bool // in-memory database (see ephemeral.go)
+}
+
+func (s *sqliteStore) Driver() string { return "sqlite3" }
+
+func (s *sqliteStore) Rebind(query string) string { return query }
+
+func (s *sqliteStore) InsertID(query string, args ...interface{}) (int64, error) {
+	result, err := s.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *sqliteStore) HourExpr(column string) string {
+	return fmt.Sprintf("CAST(strftime('%%H', %s) AS INTEGER)", column)
+}
+
+func (s *sqliteStore) Like() string { return "LIKE" }
+
+func (s *sqliteStore) Schema() string {
+	return `
+	-- Main logs table with mandatory fields
+	CREATE TABLE IF NOT EXISTS logs (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		type        TEXT NOT NULL,                        -- Log category
+		title       TEXT NOT NULL,                        -- Brief title (only required field in v1.1+)
+		description TEXT,                                 -- Detailed description (optional in v1.1+)
+		source      TEXT,                                 -- Source service/component (optional in v1.1+)
+		color       TEXT NOT NULL,                        -- Tailwind CSS 4 color
+		body        TEXT,                                 -- JSON body (optional)
+		timestamp   DATETIME DEFAULT CURRENT_TIMESTAMP    -- Auto-generated timestamp
+	);
+
+	-- Performance indexes for common query patterns
+	CREATE INDEX IF NOT EXISTS idx_logs_type ON logs(type);
+	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_logs_color ON logs(color);
+	CREATE INDEX IF NOT EXISTS idx_logs_source ON logs(source);
+	`
+}
+
+// =============================================================================
+// POSTGRESQL STORE (OPTIONAL)
+// =============================================================================
+
+// postgresStore translates CubicLog's SQLite-flavoured SQL for PostgreSQL
+type postgresStore struct {
+	*sql.DB
+}
+
+func (s *postgresStore) Driver() string { return "postgres" }
+
+// Rebind rewrites '?' placeholders as $1..$n
+func (s *postgresStore) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '\'' {
+			inQuote = !inQuote
+		}
+		if c == '?' && !inQuote {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func (s *postgresStore) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.Exec(s.Rebind(query), args...)
+}
+
+func (s *postgresStore) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.Query(s.Rebind(query), args...)
+}
+
+func (s *postgresStore) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRow(s.Rebind(query), args...)
+}
+
+// InsertID uses RETURNING since lib/pq does not support LastInsertId
+func (s *postgresStore) InsertID(query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := s.DB.QueryRow(s.Rebind(query)+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+func (s *postgresStore) HourExpr(column string) string {
+	return fmt.Sprintf("CAST(EXTRACT(HOUR FROM %s) AS INTEGER)", column)
+}
+
+func (s *postgresStore) Like() string { return "ILIKE" }
+
+func (s *postgresStore) Schema() string {
+	return `
+	CREATE TABLE IF NOT EXISTS logs (
+		id          BIGSERIAL PRIMARY KEY,
+		type        TEXT NOT NULL,
+		title       TEXT NOT NULL,
+		description TEXT,
+		source      TEXT,
+		color       TEXT NOT NULL,
+		body        TEXT,
+		timestamp   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_logs_type ON logs(type);
+	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_logs_color ON logs(color);
+	CREATE INDEX IF NOT EXISTS idx_logs_source ON logs(source);
+	`
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgresRebind tests placeholder translation for the PostgreSQL store
+func TestPostgresRebind(t *testing.T) {
+	s := &postgresStore{}
+
+	got := s.Rebind("SELECT id FROM logs WHERE title LIKE ? AND type = ? AND color != '?' AND body NOT LIKE '% LIKE %'")
+	expected := "SELECT id FROM logs WHERE title LIKE $1 AND type = $2 AND color != '?' AND body NOT LIKE '% LIKE %'"
+	if got != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, got)
+	}
+}
+
+// TestPostgresStore tests the dialect helpers against a real PostgreSQL server
+// (set POSTGRES_DSN, e.g. postgres://localhost/cubiclog_test?sslmode=disable)
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set")
+	}
+	store, err := openStore("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open PostgreSQL: %v", err)
+	}
+	defer store.Close()
+	if err := store.Ping(); err != nil {
+		t.Fatalf("Failed to reach PostgreSQL: %v", err)
+	}
+
+	// Another pooled connection wouldn't see the temporary table
+	store.(*postgresStore).SetMaxOpenConns(1)
+	if _, err := store.Exec("CREATE TEMPORARY TABLE store_test (id SERIAL PRIMARY KEY, title TEXT, at TIMESTAMP)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	at := time.Date(2024, 3, 1, 17, 30, 0, 0, time.UTC)
+	first, err := store.InsertID("INSERT INTO store_test (title, at) VALUES (?, ?)", "Disk FULL on db-1", at)
+	if err != nil {
+		t.Fatalf("InsertID failed: %v", err)
+	}
+	second, err := store.InsertID("INSERT INTO store_test (title, at) VALUES (?, ?)", "what's up?", at)
+	if err != nil {
+		t.Fatalf("InsertID failed: %v", err)
+	}
+	if first <= 0 || second != first+1 {
+		t.Errorf("Expected consecutive ids, got %d and %d", first, second)
+	}
+
+	// Placeholders are numbered in order; '?' inside literals stays a literal
+	var title string
+	if err := store.QueryRow("SELECT title FROM store_test WHERE id = ? AND title <> '?' AND at = ?", second, at).Scan(&title); err != nil || title != "what's up?" {
+		t.Errorf("Expected rebound query to find row %d, got '%s' (%v)", second, title, err)
+	}
+
+	var hour int
+	if err := store.QueryRow("SELECT "+store.HourExpr("at")+" FROM store_test WHERE id = ?", first).Scan(&hour); err != nil || hour != 17 {
+		t.Errorf("Expected hour 17, got %d (%v)", hour, err)
+	}
+
+	// Like() ignores case; a plain LIKE keeps PostgreSQL's case-sensitive match
+	var count int
+	store.QueryRow("SELECT COUNT(*) FROM store_test WHERE title "+store.Like()+" ?", "%disk full%").Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected Like() to match case-insensitively, got %d rows", count)
+	}
+	store.QueryRow("SELECT COUNT(*) FROM store_test WHERE title LIKE ?", "%disk full%").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected plain LIKE to stay case-sensitive, got %d rows", count)
+	}
+}
+
+// TestOpenStoreUnknownDriver tests that unsupported drivers are rejected
+func TestOpenStoreUnknownDriver(t *testing.T) {
+	if _, err := openStore("mysql", "dsn"); err == nil {
+		t.Error("Expected error for unsupported driver")
+	}
+}
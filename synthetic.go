@@ -0,0 +1,140 @@
+// CubicLog Synthetic Logs - Realistic fake traffic for benchmarks and demos
+//
+// The generator mixes the kinds of logs CubicLog sees in practice: access logs
+// with HTTP status codes and timings, database trouble, payments and other
+// business events, stack traces from several languages, resource alerts,
+// security events and plain debug chatter. Header fields are left out on
+// purpose in part of the logs so the smart defaults get exercised too.
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+var (
+	syntheticServices = []string{"auth-service", "payment-service", "order-service", "user-service",
+		"notification-service", "inventory-service", "api-gateway", "search-service"}
+	syntheticPaths   = []string{"/api/orders", "/api/users", "/api/login", "/api/cart", "/api/search", "/api/payments", "/health"}
+	syntheticMethods = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	syntheticHosts   = []string{"web-1", "web-2", "worker-1", "worker-2", "db-primary"}
+)
+
+// syntheticLog returns one realistic log entry
+func syntheticLog(rng *rand.Rand) Log {
+	service := syntheticServices[rng.Intn(len(syntheticServices))]
+	host := syntheticHosts[rng.Intn(len(syntheticHosts))]
+
+	switch roll := rng.Intn(100); {
+	case roll < 40:
+		return syntheticAccessLog(rng, service)
+
+	case roll < 50:
+		level := []string{"debug", "info"}[rng.Intn(2)]
+		return Log{
+			Header: LogHeader{Type: level, Title: fmt.Sprintf("Entering handler %s", syntheticPaths[rng.Intn(len(syntheticPaths))])},
+			Body:   map[string]interface{}{"service": service, "host": host, "request_id": fmt.Sprintf("req-%08x", rng.Uint32())},
+		}
+
+	case roll < 60:
+		amount := float64(rng.Intn(50000)) / 100
+		events := []struct{ title, status string }{
+			{"Payment successful", "paid"},
+			{"Payment failed", "declined"},
+			{"Order completed", "completed"},
+			{"Order cancelled", "cancelled"},
+			{"Subscription renewed", "active"},
+			{"Invoice overdue", "overdue"},
+			{"User registered", "active"},
+		}
+		event := events[rng.Intn(len(events))]
+		return Log{
+			Header: LogHeader{Title: event.title, Description: fmt.Sprintf("%s for customer %d", event.title, rng.Intn(10000))},
+			Body: map[string]interface{}{"service": service, "amount": amount, "currency": "EUR",
+				"status": event.status, "customer_id": rng.Intn(10000)},
+		}
+
+	case roll < 70:
+		problems := []string{
+			"deadlock detected while updating orders",
+			"connection pool exhausted (max 50)",
+			"duplicate key value violates unique constraint \"users_email_key\"",
+			"too many connections for role \"app\"",
+			"query took 4200ms: SELECT * FROM orders WHERE status = 'open'",
+		}
+		return Log{
+			Header: LogHeader{Title: "Database problem", Description: problems[rng.Intn(len(problems))]},
+			Body:   map[string]interface{}{"service": service, "database": "postgres", "host": "db-primary"},
+		}
+
+	case roll < 78:
+		return syntheticStackTrace(rng, service)
+
+	case roll < 86:
+		cpu, memory, disk := rng.Intn(100), rng.Intn(100), rng.Intn(100)
+		return Log{
+			Header: LogHeader{Title: fmt.Sprintf("Resource usage on %s", host),
+				Description: fmt.Sprintf("cpu: %d%% memory: %d%% disk: %d%%", cpu, memory, disk)},
+			Body: map[string]interface{}{"host": host, "cpu": cpu, "memory": memory, "disk": disk},
+		}
+
+	case roll < 92:
+		events := []string{"Authentication failed for user admin", "Invalid token presented", "Suspicious login from new country",
+			"Permission denied on /admin", "Brute force attempt blocked"}
+		return Log{
+			Header: LogHeader{Type: "security", Title: events[rng.Intn(len(events))]},
+			Body: map[string]interface{}{"service": "auth-service", "ip": fmt.Sprintf("203.0.113.%d", rng.Intn(255)),
+				"user_agent": "Mozilla/5.0"},
+		}
+
+	default:
+		messages := []string{"ECONNREFUSED 10.0.0.12:6379", "ETIMEDOUT calling payment provider", "ENOSPC: no space left on device",
+			"Retrying request (attempt 3 of 5)", "Cache warmed successfully", "Deployment v2.4.1 deployed to production"}
+		return Log{
+			Header: LogHeader{Title: messages[rng.Intn(len(messages))], Source: service},
+			Body:   map[string]interface{}{"host": host},
+		}
+	}
+}
+
+// syntheticAccessLog returns an HTTP request log
+func syntheticAccessLog(rng *rand.Rand, service string) Log {
+	statuses := []int{200, 200, 200, 200, 200, 201, 204, 301, 304, 400, 401, 403, 404, 404, 429, 500, 502, 503}
+	status := statuses[rng.Intn(len(statuses))]
+	method := syntheticMethods[rng.Intn(len(syntheticMethods))]
+	path := syntheticPaths[rng.Intn(len(syntheticPaths))]
+	duration := rng.Intn(300)
+	if rng.Intn(20) == 0 {
+		duration = 1000 + rng.Intn(6000) // occasional slow request
+	}
+
+	return Log{
+		Header: LogHeader{
+			Title:       fmt.Sprintf("%s %s", method, path),
+			Description: fmt.Sprintf("%s %s returned %d in %dms", method, path, status, duration),
+		},
+		Body: map[string]interface{}{
+			"service":     service,
+			"method":      method,
+			"path":        path,
+			"status":      status,
+			"duration_ms": duration,
+			"client_ip":   fmt.Sprintf("198.51.100.%d", rng.Intn(255)),
+		},
+	}
+}
+
+// syntheticStackTrace returns an exception with a language-specific stack trace
+func syntheticStackTrace(rng *rand.Rand, service string) Log {
+	traces := []struct{ title, trace string }{
+		{"NullPointerException in OrderProcessor", "java.lang.NullPointerException\n\tat com.shop.OrderProcessor.process(OrderProcessor.java:42)\n\tat com.shop.Worker.run(Worker.java:17)"},
+		{"KeyError in recommendation job", "Traceback (most recent call last):\n  File \"jobs/recommend.py\", line 88, in run\n    score = weights[item_id]\nKeyError: 'item_4711'"},
+		{"panic in cart handler", "panic: runtime error: index out of range [3] with length 3\n\ngoroutine 42 [running]:\nmain.(*Cart).Item(...)\n\t/app/cart.go:57"},
+		{"TypeError in checkout", "TypeError: Cannot read properties of undefined (reading 'price')\n    at Object.total (/app/checkout.js:23:19)\n    at Function.handle (/app/router.js:104:7)"},
+	}
+	trace := traces[rng.Intn(len(traces))]
+	return Log{
+		Header: LogHeader{Title: trace.title, Description: trace.trace},
+		Body:   map[string]interface{}{"service": service, "stack_trace": trace.trace},
+	}
+}
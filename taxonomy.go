@@ -0,0 +1,309 @@
+// CubicLog Category Taxonomy - A fixed set of categories instead of first words
+//
+//   - GET    /api/categories           the taxonomy, and the unknown categories of the last 7 days
+//   - POST   /api/categories           add or replace a category: {"name": "database", "aliases": ["db", "sql"]}
+//   - GET    /api/categories/{name}    one category
+//   - DELETE /api/categories/{name}    remove a category
+//
+// Without a taxonomy the derived category is whatever the detection comes up
+// with - often the first word of the title - so analytics fragment into
+// "db", "database" and "sql". Once categories are defined, the derived
+// category of every new log (after the -classifier) is mapped onto them: a
+// category's aliases become its name. Categories that are neither a name nor
+// an alias are kept but flagged: the X-CubicLog-Unknown-Category response
+// header names them, and GET /api/categories lists the unknown categories of
+// the last 7 days with their counts, so they can be added as aliases.
+//
+// Saving a category also renames the stored logs carrying one of its aliases
+// (with -partition monthly, those of the current month), so /api/stats groups
+// cleanly right away. Removing a category leaves the logs as they are. Other
+// instances sharing a PostgreSQL database pick up changes on restart.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// taxonomyUnknownWindow is how far back GET /api/categories looks for unknown categories
+const taxonomyUnknownWindow = 7 * 24 * time.Hour
+
+// taxonomyCategory is an allowed category and the names mapped onto it
+type taxonomyCategory struct {
+	Name        string    `json:"name"`
+	Aliases     []string  `json:"aliases"`
+	Description string    `json:"description,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// categoryTaxonomy is the taxonomy as applied to logs
+type categoryTaxonomy struct {
+	categories []taxonomyCategory
+	canonical  map[string]string // name or alias → name
+}
+
+// unknownCategory is a derived category outside the taxonomy
+type unknownCategory struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// The taxonomy - loaded once in main(), changed by the API
+var (
+	activeTaxonomy atomic.Pointer[categoryTaxonomy]
+	taxonomyMu     sync.Mutex // serializes changes and reloads
+)
+
+// createTaxonomyTable creates the category taxonomy
+func createTaxonomyTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS categories (
+		name        TEXT PRIMARY KEY,
+		aliases     TEXT NOT NULL DEFAULT '[]', -- JSON array
+		description TEXT NOT NULL DEFAULT '',
+		updated_at  TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// loadTaxonomy reads the taxonomy into memory
+func loadTaxonomy() error {
+	taxonomyMu.Lock()
+	defer taxonomyMu.Unlock()
+	return refreshTaxonomy()
+}
+
+// refreshTaxonomy replaces the taxonomy in memory (taxonomyMu held)
+func refreshTaxonomy() error {
+	rows, err := db.Query("SELECT name, aliases, description, updated_at FROM categories ORDER BY name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	taxonomy := &categoryTaxonomy{categories: []taxonomyCategory{}, canonical: map[string]string{}}
+	for rows.Next() {
+		var c taxonomyCategory
+		var aliases string
+		if err := rows.Scan(&c.Name, &aliases, &c.Description, (*scanTime)(&c.UpdatedAt)); err != nil {
+			return err
+		}
+		json.Unmarshal([]byte(aliases), &c.Aliases)
+		if c.Aliases == nil {
+			c.Aliases = []string{}
+		}
+		taxonomy.categories = append(taxonomy.categories, c)
+		taxonomy.canonical[c.Name] = c.Name
+		for _, alias := range c.Aliases {
+			taxonomy.canonical[alias] = c.Name
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	activeTaxonomy.Store(taxonomy)
+	return nil
+}
+
+// canonicalCategory maps a derived category onto the taxonomy, reporting
+// whether it is part of it (always true without a taxonomy)
+func canonicalCategory(category string) (string, bool) {
+	taxonomy := activeTaxonomy.Load()
+	if taxonomy == nil || len(taxonomy.categories) == 0 || category == "" {
+		return category, true
+	}
+	if name, ok := taxonomy.canonical[category]; ok {
+		return name, true
+	}
+	return category, false
+}
+
+// normalizeTaxonomyCategory validates a category against the others and cleans up its names
+func normalizeTaxonomyCategory(c *taxonomyCategory) error {
+	c.Name = strings.ToLower(strings.TrimSpace(c.Name))
+	if c.Name == "" || len(c.Name) > 100 || strings.Contains(c.Name, "/") {
+		return fmt.Errorf("name must be 1 to 100 characters without '/'")
+	}
+	taxonomy := activeTaxonomy.Load()
+	taken := func(name string) error {
+		if taxonomy == nil {
+			return nil
+		}
+		if owner, ok := taxonomy.canonical[name]; ok && owner != c.Name {
+			if owner == name {
+				return fmt.Errorf("'%s' is a category of its own", name)
+			}
+			return fmt.Errorf("'%s' is already an alias of '%s'", name, owner)
+		}
+		return nil
+	}
+	if err := taken(c.Name); err != nil {
+		return err
+	}
+	aliases := []string{}
+	for _, alias := range c.Aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias == "" || alias == c.Name || containsString(aliases, alias) {
+			continue
+		}
+		if len(alias) > 100 {
+			return fmt.Errorf("alias '%s' is longer than 100 characters", alias)
+		}
+		if err := taken(alias); err != nil {
+			return err
+		}
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	c.Aliases = aliases
+	c.Description = strings.TrimSpace(c.Description)
+	return nil
+}
+
+// saveTaxonomyCategory stores a category and renames the logs carrying its
+// aliases, returning how many were renamed
+func saveTaxonomyCategory(c taxonomyCategory) (int64, error) {
+	taxonomyMu.Lock()
+	defer taxonomyMu.Unlock()
+	if err := normalizeTaxonomyCategory(&c); err != nil {
+		return 0, err
+	}
+	aliases, _ := json.Marshal(c.Aliases)
+	if _, err := db.Exec(db.Rebind(`INSERT INTO categories (name, aliases, description, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET aliases = excluded.aliases, description = excluded.description, updated_at = excluded.updated_at`),
+		c.Name, string(aliases), c.Description, dbTime(time.Now())); err != nil {
+		return 0, err
+	}
+
+	var renamed int64
+	if len(c.Aliases) > 0 {
+		args := []interface{}{c.Name}
+		for _, alias := range c.Aliases {
+			args = append(args, alias)
+		}
+		result, err := db.Exec(db.Rebind(`UPDATE logs SET derived_category = ?
+			WHERE derived_category IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(c.Aliases)), ", ")+`)`), args...)
+		if err != nil {
+			return 0, err
+		}
+		if renamed, _ = result.RowsAffected(); renamed > 0 {
+			invalidateHourlyStats()
+		}
+	}
+	return renamed, refreshTaxonomy()
+}
+
+// deleteTaxonomyCategory removes a category, reporting whether it existed
+func deleteTaxonomyCategory(name string) (bool, error) {
+	taxonomyMu.Lock()
+	defer taxonomyMu.Unlock()
+	result, err := db.Exec(db.Rebind("DELETE FROM categories WHERE name = ?"), name)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, refreshTaxonomy()
+}
+
+// unknownCategories counts the derived categories outside the taxonomy since a point in time, most first
+func unknownCategories(since time.Time, limit int) ([]unknownCategory, error) {
+	unknown := []unknownCategory{}
+	if taxonomy := activeTaxonomy.Load(); taxonomy == nil || len(taxonomy.categories) == 0 {
+		return unknown, nil
+	}
+	stats, err := loadHourlyStats(since)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, stat := range stats {
+		if _, known := canonicalCategory(stat.category); !known {
+			counts[stat.category] += stat.count
+		}
+	}
+	for _, category := range topStatCounts(counts, limit) {
+		unknown = append(unknown, unknownCategory{Category: category, Count: counts[category]})
+	}
+	return unknown, nil
+}
+
+// handleCategories answers GET and POST /api/categories
+func handleCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		unknown, err := unknownCategories(time.Now().Add(-taxonomyUnknownWindow), 50)
+		if err != nil {
+			http.Error(w, "Failed to load categories", http.StatusInternalServerError)
+			return
+		}
+		categories := []taxonomyCategory{}
+		if taxonomy := activeTaxonomy.Load(); taxonomy != nil {
+			categories = taxonomy.categories
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"categories": categories, "unknown": unknown})
+	case http.MethodPost:
+		var c taxonomyCategory
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		renamed, err := saveTaxonomyCategory(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		saved, _ := findTaxonomyCategory(strings.ToLower(strings.TrimSpace(c.Name)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"category": saved, "recategorized": renamed})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findTaxonomyCategory looks up a category by name
+func findTaxonomyCategory(name string) (taxonomyCategory, bool) {
+	if taxonomy := activeTaxonomy.Load(); taxonomy != nil {
+		for _, c := range taxonomy.categories {
+			if c.Name == name {
+				return c, true
+			}
+		}
+	}
+	return taxonomyCategory{}, false
+}
+
+// handleCategory answers GET and DELETE /api/categories/{name}
+func handleCategory(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/categories/"))
+	switch r.Method {
+	case http.MethodGet:
+		c, found := findTaxonomyCategory(name)
+		if !found {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+	case http.MethodDelete:
+		found, err := deleteTaxonomyCategory(name)
+		if err != nil {
+			http.Error(w, "Failed to remove category", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
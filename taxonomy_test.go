@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCategoryTaxonomy tests mapping derived categories onto a taxonomy and flagging unknown ones
+func TestCategoryTaxonomy(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer activeTaxonomy.Store(nil)
+
+	send := func(kind, title string) (string, string) {
+		body := `{"header":{"type":"` + kind + `","title":"` + title + `","source":"api"}}`
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		var category string
+		db.QueryRow("SELECT derived_category FROM logs WHERE title = ?", title).Scan(&category)
+		return category, w.Header().Get("X-CubicLog-Unknown-Category")
+	}
+	if category, flagged := send("sql", "Slow query"); category != "sql" || flagged != "" {
+		t.Fatalf("Expected categories to pass through without a taxonomy, got %s (flagged '%s')", category, flagged)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleCategories(w, httptest.NewRequest("POST", "/api/categories", strings.NewReader(body)))
+		return w
+	}
+	w := post(`{"name": "Database", "aliases": ["db", "SQL", "database", "db"]}`)
+	var saved struct {
+		Category      taxonomyCategory `json:"category"`
+		Recategorized int              `json:"recategorized"`
+	}
+	json.NewDecoder(w.Body).Decode(&saved)
+	if w.Code != 201 || saved.Category.Name != "database" || strings.Join(saved.Category.Aliases, ",") != "db,sql" || saved.Recategorized != 1 {
+		t.Fatalf("Expected the category saved with its aliases and the stored log renamed, got %d %+v", w.Code, saved)
+	}
+	if w := post(`{"name": "storage", "aliases": ["sql"]}`); w.Code != 400 || !strings.Contains(w.Body.String(), "already an alias of 'database'") {
+		t.Errorf("Expected a taken alias to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	if category, flagged := send("DB", "Pool exhausted"); category != "database" || flagged != "" {
+		t.Errorf("Expected the db alias mapped to database, got %s (flagged '%s')", category, flagged)
+	}
+	if category, flagged := send("widget", "Widget spun"); category != "widget" || flagged != "widget" {
+		t.Errorf("Expected widget kept and flagged, got %s (flagged '%s')", category, flagged)
+	}
+
+	w = httptest.NewRecorder()
+	handleCategories(w, httptest.NewRequest("GET", "/api/categories", nil))
+	var listed struct {
+		Categories []taxonomyCategory `json:"categories"`
+		Unknown    []unknownCategory  `json:"unknown"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Categories) != 1 || len(listed.Unknown) != 1 || listed.Unknown[0] != (unknownCategory{"widget", 1}) {
+		t.Errorf("Expected the taxonomy and widget as unknown, got %+v", listed)
+	}
+
+	w = httptest.NewRecorder()
+	handleCategory(w, httptest.NewRequest("DELETE", "/api/categories/database", nil))
+	if w.Code != 204 {
+		t.Fatalf("Expected the category removed, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handleCategory(w, httptest.NewRequest("GET", "/api/categories/database", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected the removed category to be gone, got %d", w.Code)
+	}
+}
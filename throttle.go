@@ -0,0 +1,145 @@
+// CubicLog Throttling - One line and a counter instead of thousands of identical ones
+//
+//	cubiclog -throttle 100
+//
+// With -throttle N, a fingerprint - the derived source and the normalized
+// title, as for error groups (see groups.go) - is stored at most N times per
+// minute. Further logs of it in that minute aren't stored: the last stored one
+// becomes their representative and counts them (table log_repeats, next to
+// the logs so the hash chain stays valid). GET /api/logs returns the count as
+// "repeated" and the dashboard shows "repeated 4,812 times".
+//
+// Throttled logs are answered 202 with X-CubicLog-Throttled and the id of the
+// representative. They still count towards escalation rules, quotas and
+// their error group, so alerts and error counts see the whole flood; they are
+// not searchable one by one. The counters live in memory and start over each
+// minute; the default 0 stores everything.
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttleWindow counts a fingerprint within the current minute
+type throttleWindow struct {
+	count int
+	logID int64 // representative: the last stored log (0 until stored)
+}
+
+// logThrottle limits the logs stored per fingerprint and minute
+type logThrottle struct {
+	mu      sync.Mutex
+	limit   int
+	minute  time.Time
+	windows map[string]*throttleWindow
+}
+
+// throttle is the -throttle limiter (nil when off) - configured once in main()
+var throttle *logThrottle
+
+// configureThrottle sets the -throttle limit (0 turns throttling off)
+func configureThrottle(perMinute int) {
+	throttle = nil
+	if perMinute > 0 {
+		throttle = &logThrottle{limit: perMinute, windows: map[string]*throttleWindow{}}
+	}
+}
+
+// observe counts a log and returns its representative when it is over the limit
+func (t *logThrottle) observe(fingerprint string, now time.Time) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if minute := now.Truncate(time.Minute); !minute.Equal(t.minute) {
+		t.minute, t.windows = minute, map[string]*throttleWindow{}
+	}
+	window := t.windows[fingerprint]
+	if window == nil {
+		window = &throttleWindow{}
+		t.windows[fingerprint] = window
+	}
+	window.count++
+	if window.count <= t.limit || window.logID == 0 {
+		return 0, false
+	}
+	return window.logID, true
+}
+
+// wouldThrottle reports what observe would answer for one more log, without counting it
+func (t *logThrottle) wouldThrottle(fingerprint string, now time.Time) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	window := t.windows[fingerprint]
+	if window == nil || !now.Truncate(time.Minute).Equal(t.minute) || window.count+1 <= t.limit || window.logID == 0 {
+		return 0, false
+	}
+	return window.logID, true
+}
+
+// remember makes a stored log the representative of its fingerprint
+func (t *logThrottle) remember(fingerprint string, logID int64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if window := t.windows[fingerprint]; window != nil && now.Truncate(time.Minute).Equal(t.minute) {
+		window.logID = logID
+	}
+}
+
+// createRepeatsTable creates the table counting the logs a representative stands for
+func createRepeatsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS log_repeats (
+		log_id           BIGINT PRIMARY KEY,
+		repeats          INTEGER NOT NULL DEFAULT 0,
+		last_repeated_at TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// recordRepeat counts a throttled log towards its representative
+func recordRepeat(logID int64, now time.Time) error {
+	result, err := db.Exec(db.Rebind("UPDATE log_repeats SET repeats = repeats + 1, last_repeated_at = ? WHERE log_id = ?"), dbTime(now), logID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := db.Exec(db.Rebind("INSERT INTO log_repeats (log_id, repeats, last_repeated_at) VALUES (?, 1, ?)"), logID, dbTime(now)); err != nil {
+			return err
+		}
+	}
+	bulkGeneration.Add(1)
+	return nil
+}
+
+// pruneRepeats drops the counters of logs removed by retention
+func pruneRepeats(cutoff time.Time) {
+	db.Exec(db.Rebind("DELETE FROM log_repeats WHERE last_repeated_at < ? AND log_id NOT IN (SELECT id FROM logs)"), dbTime(cutoff))
+}
+
+// attachRepeats fills in how often listed logs were repeated
+func attachRepeats(logs []Log) {
+	if len(logs) == 0 {
+		return
+	}
+	index := make(map[int]int, len(logs))
+	placeholders := make([]string, len(logs))
+	args := make([]interface{}, len(logs))
+	for i, l := range logs {
+		index[l.ID] = i
+		placeholders[i] = "?"
+		args[i] = l.ID
+	}
+	rows, err := db.Query(db.Rebind("SELECT log_id, repeats FROM log_repeats WHERE log_id IN ("+strings.Join(placeholders, ", ")+")"), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, repeats int
+		if rows.Scan(&id, &repeats) == nil {
+			logs[index[id]].Repeated = repeats
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestLogThrottling tests that a flood of one fingerprint is stored once with a counter
+func TestLogThrottling(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	configureThrottle(2)
+	defer configureThrottle(0)
+
+	send := func(title string) *httptest.ResponseRecorder {
+		body := `{"header":{"type":"error","title":"` + title + `","source":"checkout"}}`
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+		return w
+	}
+	var representative string
+	for i := 0; i < 6; i++ {
+		w := send("Payment 4411 declined")
+		if i < 2 && w.Code != http.StatusCreated {
+			t.Fatalf("Expected the first logs to be stored, got %d", w.Code)
+		}
+		if i >= 2 {
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("Expected log %d to be throttled, got %d", i+1, w.Code)
+			}
+			representative = w.Header().Get("X-CubicLog-Throttled")
+		}
+	}
+	send("Inventory sync failed")
+
+	var stored int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&stored)
+	if stored != 3 {
+		t.Errorf("Expected 3 stored logs, got %d", stored)
+	}
+
+	w := httptest.NewRecorder()
+	getLogs(w, httptest.NewRequest("GET", "/api/logs", nil))
+	var logs []Log
+	json.NewDecoder(w.Body).Decode(&logs)
+	repeated := map[string]int{}
+	for _, l := range logs {
+		if l.Repeated > 0 {
+			repeated[l.Header.Title] = l.Repeated
+			if representative == "" || representative != strconv.Itoa(l.ID) {
+				t.Errorf("Expected log %s to carry the repeats, got %d", representative, l.ID)
+			}
+		}
+	}
+	if len(repeated) != 1 || repeated["Payment 4411 declined"] != 4 {
+		t.Errorf("Expected the payment log to be repeated 4 times, got %v", repeated)
+	}
+}
@@ -0,0 +1,118 @@
+// fetch-ui-assets downloads the dashboard's third-party assets into ui/vendor
+//
+//	go generate    (from the repository root)
+//
+// Every file listed in ui/vendor/assets.json is downloaded from its pinned URL.
+// Entries with "localize_fonts" are stylesheets whose url(...) references are
+// downloaded next to them and rewritten to relative paths (Google Fonts CSS).
+// Commit the results so release binaries embed them and the dashboard works
+// without internet access.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const vendorDir = "ui/vendor"
+
+// asset is one entry of ui/vendor/assets.json
+type asset struct {
+	Path          string `json:"path"`
+	URL           string `json:"url"`
+	LocalizeFonts bool   `json:"localize_fonts"`
+}
+
+// Google Fonts serves woff2 only to browsers it recognizes
+const browserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+
+var (
+	client     = &http.Client{Timeout: time.Minute}
+	cssURLExpr = regexp.MustCompile(`url\((https://[^)]+)\)`)
+)
+
+func main() {
+	manifest, err := os.ReadFile(filepath.Join(vendorDir, "assets.json"))
+	if err != nil {
+		fail(err)
+	}
+	var assets []asset
+	if err := json.Unmarshal(manifest, &assets); err != nil {
+		fail(fmt.Errorf("invalid assets.json: %v", err))
+	}
+
+	for _, a := range assets {
+		data, err := download(a.URL)
+		if err != nil {
+			fail(err)
+		}
+		if a.LocalizeFonts {
+			if data, err = localizeFonts(data, path.Dir(a.Path)); err != nil {
+				fail(err)
+			}
+		}
+		if err := write(a.Path, data); err != nil {
+			fail(err)
+		}
+		fmt.Printf("✅ %s (%d bytes)\n", a.Path, len(data))
+	}
+}
+
+// localizeFonts downloads the fonts a stylesheet references into dir and
+// points the stylesheet at the local copies
+func localizeFonts(css []byte, dir string) ([]byte, error) {
+	var failed error
+	localized := cssURLExpr.ReplaceAllFunc(css, func(match []byte) []byte {
+		url := string(cssURLExpr.FindSubmatch(match)[1])
+		name := path.Base(strings.SplitN(url, "?", 2)[0])
+		data, err := download(url)
+		if err == nil {
+			err = write(path.Join(dir, name), data)
+		}
+		if err != nil && failed == nil {
+			failed = err
+		}
+		return []byte("url(" + name + ")")
+	})
+	return localized, failed
+}
+
+// download fetches a URL
+func download(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", browserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// write stores a file below ui/vendor
+func write(name string, data []byte) error {
+	target := filepath.Join(vendorDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+func fail(err error) {
+	fmt.Printf("❌ %v\n", err)
+	os.Exit(1)
+}
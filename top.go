@@ -0,0 +1,129 @@
+// CubicLog Top - The biggest contributors in one query
+//
+//	GET /api/top?dimension=source&severity=error&since=24h&limit=20
+//
+// Counts the logs of the window per value of a dimension, most first:
+//   - dimension: source (derived source, the default), category (derived
+//     category) or title
+//   - severity:  only logs with these derived severities (comma-separated)
+//   - since:     the window, a Go duration ending now (default 24h)
+//   - limit:     how many values (default 10, at most 1000)
+//
+// Each item has the value, its count, its share of the logs in the window
+// matching the severity filter and when it was last seen. Logs without the
+// dimension (no derived source or category) count as "unknown". Rollups (see
+// rollup.go) keep no titles and aren't included.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// topDimensions maps the dimensions to their column
+var topDimensions = map[string]string{
+	"source":   "COALESCE(derived_source, 'unknown')",
+	"category": "COALESCE(derived_category, 'unknown')",
+	"title":    "title",
+}
+
+// TopItem is one value of a dimension and how often it was logged
+type TopItem struct {
+	Value    string    `json:"value"`
+	Count    int       `json:"count"`
+	Percent  float64   `json:"percent"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// loadTop counts the logs since from per value of a dimension column, most first
+func loadTop(column string, severities []string, from time.Time, limit int) ([]TopItem, int, error) {
+	where, args := " WHERE timestamp >= ?", []interface{}{dbTime(from)}
+	if len(severities) > 0 {
+		where += " AND derived_severity IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(severities)), ", ") + ")"
+		for _, severity := range severities {
+			args = append(args, severity)
+		}
+	}
+	// The window total comes along with every row, so one query answers both
+	rows, release, err := queryLogs(from.Format("2006-01-02"), "", func(table string) (string, []interface{}) {
+		return db.Rebind(`
+			SELECT ` + column + `, COUNT(*), MAX(timestamp), (SELECT COUNT(*) FROM ` + table + where + `)
+			FROM ` + table + where + `
+			GROUP BY ` + column + `
+			ORDER BY COUNT(*) DESC, ` + column + `
+			LIMIT ?`), append(append(append([]interface{}{}, args...), args...), limit)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	items, total := []TopItem{}, 0
+	for rows.Next() {
+		var item TopItem
+		if err := rows.Scan(&item.Value, &item.Count, (*scanTime)(&item.LastSeen), &total); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	for i := range items {
+		items[i].Percent = percent(items[i].Count, total)
+	}
+	return items, total, rows.Err()
+}
+
+// handleTop answers GET /api/top?dimension=&severity=&since=&limit=
+func handleTop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	dimension := valueOr(query.Get("dimension"), "source")
+	column, ok := topDimensions[dimension]
+	if !ok {
+		http.Error(w, "dimension must be source, category or title", http.StatusBadRequest)
+		return
+	}
+	severities := []string{}
+	for _, severity := range strings.Split(query.Get("severity"), ",") {
+		if severity = strings.TrimSpace(strings.ToLower(severity)); severity != "" {
+			severities = append(severities, severity)
+		}
+	}
+	since := 24 * time.Hour
+	if value := query.Get("since"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "since must be a duration like 1h or 24h", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	limit := 10
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	items, total, err := loadTop(column, severities, time.Now().Add(-since), limit)
+	if err != nil {
+		http.Error(w, "Failed to load top values", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dimension": dimension,
+		"since":     since.String(),
+		"severity":  severities,
+		"total":     total,
+		"items":     items,
+	})
+}
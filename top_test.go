@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTop tests counting the most frequent values of a dimension in a window
+func TestTop(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	insert := func(title, source, severity string, age time.Duration) {
+		db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+			VALUES ('info', ?, 'blue', '{}', ?, ?, ?)`, title, dbTime(time.Now().Add(-age)), severity, source)
+	}
+	for i := 0; i < 3; i++ {
+		insert("Payment declined", "checkout", "error", time.Minute)
+	}
+	insert("Search timeout", "search", "error", time.Hour)
+	insert("Search served", "search", "info", time.Hour)
+	insert("Old failure", "billing", "error", 48*time.Hour)
+
+	top := func(query string) (int, int, []TopItem) {
+		w := httptest.NewRecorder()
+		handleTop(w, httptest.NewRequest("GET", "/api/top?"+query, nil))
+		var response struct {
+			Total int       `json:"total"`
+			Items []TopItem `json:"items"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Total, response.Items
+	}
+
+	_, total, items := top("dimension=source&severity=error&since=24h")
+	if len(items) != 2 || items[0].Value != "checkout" || items[0].Count != 3 || items[0].Percent != 75 || total != 4 {
+		t.Errorf("Expected checkout with 3 of 4 errors first, got %+v (total %d)", items, total)
+	}
+	if items[0].LastSeen.IsZero() {
+		t.Error("Expected when checkout was last seen")
+	}
+	if _, _, items = top("dimension=title&since=72h&limit=2"); len(items) != 2 || items[0].Value != "Payment declined" {
+		t.Errorf("Expected the 2 most frequent titles, got %+v", items)
+	}
+	if code, _, _ := top("dimension=host"); code != 400 {
+		t.Errorf("Expected status 400 for an unknown dimension, got %d", code)
+	}
+}
@@ -0,0 +1,203 @@
+// CubicLog Trends - How volume and errors changed, per source
+//
+//	GET /api/stats/trends                          last 24h against the 24h before
+//	GET /api/stats/trends?window=1h&compare=24h    last hour against the same hour yesterday
+//
+// window is the length of the current window, ending now (default 24h).
+// compare is how far back the comparison window of the same length lies
+// (default the window, so the window right before). Both take Go durations.
+//
+// The answer has the total and one entry per source seen in either window,
+// busiest first: the volume and errors (derived severity error or critical)
+// in both windows, the error rates, and the changes in percent. A change is
+// left out when the comparison window had nothing to compare with. Hourly
+// rollups count for the window their hour starts in, whole.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Trend is the change of one source (or of all, for the total) between two windows
+type Trend struct {
+	Source            string   `json:"source,omitempty"`
+	Volume            int      `json:"volume"`
+	PreviousVolume    int      `json:"previous_volume"`
+	VolumeChange      *float64 `json:"volume_change_pct,omitempty"`
+	Errors            int      `json:"errors"`
+	PreviousErrors    int      `json:"previous_errors"`
+	ErrorRate         float64  `json:"error_rate"`
+	PreviousErrorRate float64  `json:"previous_error_rate"`
+	ErrorRateChange   *float64 `json:"error_rate_change_pct,omitempty"`
+}
+
+// Trends compares the current window with an earlier one
+type Trends struct {
+	Window   string    `json:"window"`
+	Compare  string    `json:"compare"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Previous struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"previous"`
+	Total   Trend   `json:"total"`
+	Sources []Trend `json:"sources"`
+}
+
+// trendCount is the volume and errors of a source in a window
+type trendCount struct {
+	volume, errors int
+}
+
+// changePercent returns the change from previous to current in percent (nil without a previous value)
+func changePercent(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := roundTo((current-previous)/previous*100, 1)
+	return &change
+}
+
+// windowCounts returns the volume and errors per source logged in [from, to)
+func windowCounts(from, to time.Time) (map[string]trendCount, error) {
+	rows, release, err := queryLogs(from.Format("2006-01-02"), to.Format("2006-01-02"), func(table string) (string, []interface{}) {
+		return db.Rebind(`
+			SELECT COALESCE(derived_source, 'unknown'), COUNT(*), SUM(CASE WHEN derived_severity IN ('error', 'critical') THEN 1 ELSE 0 END)
+			FROM ` + table + `
+			WHERE timestamp >= ? AND timestamp < ?
+			GROUP BY COALESCE(derived_source, 'unknown')`), []interface{}{dbTime(from), dbTime(to)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]trendCount{}
+	for rows.Next() {
+		var source string
+		var count trendCount
+		if err := rows.Scan(&source, &count.volume, &count.errors); err != nil {
+			release()
+			return nil, err
+		}
+		current := counts[source]
+		counts[source] = trendCount{current.volume + count.volume, current.errors + count.errors}
+	}
+	err = rows.Err()
+	release()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rolled-up hours, by the hour they start in
+	rollups, err := db.Query(db.Rebind(`
+		SELECT source, SUM(count), SUM(CASE WHEN severity IN ('error', 'critical') THEN count ELSE 0 END)
+		FROM log_rollups WHERE hour >= ? AND hour < ? GROUP BY source`),
+		from.UTC().Format("2006-01-02 15"), to.UTC().Format("2006-01-02 15"))
+	if err != nil {
+		return nil, err
+	}
+	defer rollups.Close()
+	for rollups.Next() {
+		var source string
+		var count trendCount
+		if err := rollups.Scan(&source, &count.volume, &count.errors); err != nil {
+			return nil, err
+		}
+		current := counts[source]
+		counts[source] = trendCount{current.volume + count.volume, current.errors + count.errors}
+	}
+	return counts, rollups.Err()
+}
+
+// newTrend compares the counts of two windows
+func newTrend(source string, current, previous trendCount) Trend {
+	trend := Trend{
+		Source:            source,
+		Volume:            current.volume,
+		PreviousVolume:    previous.volume,
+		VolumeChange:      changePercent(float64(current.volume), float64(previous.volume)),
+		Errors:            current.errors,
+		PreviousErrors:    previous.errors,
+		ErrorRate:         percent(current.errors, current.volume),
+		PreviousErrorRate: percent(previous.errors, previous.volume),
+	}
+	trend.ErrorRateChange = changePercent(trend.ErrorRate, trend.PreviousErrorRate)
+	return trend
+}
+
+// computeTrends compares the window ending now with the one compare earlier
+func computeTrends(window, compare time.Duration, now time.Time) (Trends, error) {
+	trends := Trends{Window: window.String(), Compare: compare.String(), From: now.Add(-window), To: now, Sources: []Trend{}}
+	trends.Previous.From, trends.Previous.To = trends.From.Add(-compare), now.Add(-compare)
+
+	current, err := windowCounts(trends.From, trends.To)
+	if err != nil {
+		return trends, err
+	}
+	previous, err := windowCounts(trends.Previous.From, trends.Previous.To)
+	if err != nil {
+		return trends, err
+	}
+
+	var total, previousTotal trendCount
+	for source, count := range current {
+		total = trendCount{total.volume + count.volume, total.errors + count.errors}
+		trends.Sources = append(trends.Sources, newTrend(source, count, previous[source]))
+	}
+	for source, count := range previous {
+		previousTotal = trendCount{previousTotal.volume + count.volume, previousTotal.errors + count.errors}
+		if _, seen := current[source]; !seen {
+			trends.Sources = append(trends.Sources, newTrend(source, trendCount{}, count))
+		}
+	}
+	trends.Total = newTrend("", total, previousTotal)
+	sort.Slice(trends.Sources, func(i, j int) bool {
+		a, b := trends.Sources[i], trends.Sources[j]
+		if a.Volume != b.Volume {
+			return a.Volume > b.Volume
+		}
+		if a.PreviousVolume != b.PreviousVolume {
+			return a.PreviousVolume > b.PreviousVolume
+		}
+		return a.Source < b.Source
+	})
+	return trends, nil
+}
+
+// handleTrends answers GET /api/stats/trends?window=&compare=
+func handleTrends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	window := 24 * time.Hour
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "window must be a duration like 1h or 24h", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	compare := window
+	if value := r.URL.Query().Get("compare"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "compare must be a duration like 24h or 168h", http.StatusBadRequest)
+			return
+		}
+		compare = parsed
+	}
+
+	trends, err := computeTrends(window, compare, time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		http.Error(w, "Failed to compute trends", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(trends)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTrends tests comparing volume and error rates between windows
+func TestTrends(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	insert := func(source, severity string, age time.Duration) {
+		db.Exec(`INSERT INTO logs (type, title, color, body, timestamp, derived_severity, derived_source)
+			VALUES ('info', 'entry', 'blue', '{}', ?, ?, ?)`, dbTime(now.Add(-age)), severity, source)
+	}
+	// checkout: 4 logs (2 errors) in the last hour, 2 logs (1 error) the same hour yesterday
+	for _, severity := range []string{"error", "critical", "info", "info"} {
+		insert("checkout", severity, 10*time.Minute)
+	}
+	insert("checkout", "error", 24*time.Hour+10*time.Minute)
+	insert("checkout", "info", 24*time.Hour+20*time.Minute)
+	// search: only yesterday, cart: only in between
+	insert("search", "info", 24*time.Hour+30*time.Minute)
+	insert("cart", "error", 5*time.Hour)
+
+	w := httptest.NewRecorder()
+	handleTrends(w, httptest.NewRequest("GET", "/api/stats/trends?window=1h&compare=24h", nil))
+	var trends Trends
+	if err := json.NewDecoder(w.Body).Decode(&trends); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if trends.Window != "1h0m0s" || len(trends.Sources) != 2 {
+		t.Fatalf("Expected checkout and search in a 1h window, got %+v", trends)
+	}
+	checkout, search := trends.Sources[0], trends.Sources[1]
+	if checkout.Source != "checkout" || checkout.Volume != 4 || checkout.PreviousVolume != 2 || *checkout.VolumeChange != 100 {
+		t.Errorf("Expected checkout to double, got %+v", checkout)
+	}
+	if checkout.ErrorRate != 50 || checkout.PreviousErrorRate != 50 || *checkout.ErrorRateChange != 0 {
+		t.Errorf("Expected an unchanged 50%% error rate, got %+v", checkout)
+	}
+	if search.Source != "search" || search.Volume != 0 || *search.VolumeChange != -100 {
+		t.Errorf("Expected search to drop to nothing, got %+v", search)
+	}
+	if trends.Total.Volume != 4 || trends.Total.PreviousVolume != 3 || trends.Total.Errors != 2 {
+		t.Errorf("Unexpected total: %+v", trends.Total)
+	}
+
+	w = httptest.NewRecorder()
+	handleTrends(w, httptest.NewRequest("GET", "/api/stats/trends", nil))
+	trends = Trends{}
+	json.NewDecoder(w.Body).Decode(&trends)
+	if trends.Total.Volume != 5 || trends.Total.PreviousVolume != 3 || len(trends.Sources) != 3 {
+		t.Fatalf("Expected the last 24h against the day before, got %+v", trends)
+	}
+	if cart := trends.Sources[1]; cart.Source != "cart" || cart.VolumeChange != nil {
+		t.Errorf("Expected no change for cart, new in the window, got %+v", cart)
+	}
+
+	w = httptest.NewRecorder()
+	handleTrends(w, httptest.NewRequest("GET", "/api/stats/trends?window=soon", nil))
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 for an invalid window, got %d", w.Code)
+	}
+}
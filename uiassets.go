@@ -0,0 +1,18 @@
+//go:build vendoredassets
+
+package main
+
+import "embed"
+
+// vendoredAssets only exists to make the build fail when the dashboard's
+// libraries haven't been fetched with "go generate", so a binary that must work
+// offline can't quietly depend on third-party CDNs. Release builds use
+// -tags vendoredassets; other builds fall back to the CDNs (uiassets_cdn.go).
+//
+//go:embed ui/vendor/alpine.min.js ui/vendor/tailwind.js
+//go:embed ui/vendor/fontawesome/css/all.min.css ui/vendor/fontawesome/webfonts
+//go:embed ui/vendor/inter/inter.css
+var vendoredAssets embed.FS
+
+// cdnFallback reports whether missing vendored assets load from their CDN
+const cdnFallback = false
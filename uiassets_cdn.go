@@ -0,0 +1,6 @@
+//go:build !vendoredassets
+
+package main
+
+// cdnFallback reports whether missing vendored assets load from their CDN
+const cdnFallback = true
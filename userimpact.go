@@ -0,0 +1,185 @@
+// CubicLog User Impact - How many people an error actually hits
+//
+//	cubiclog -user-field user.id,customer_id
+//
+// When an error or critical log names the user it happened to, the user is
+// counted towards the log's error group (see groups.go). The first of the
+// -user-field body paths that holds a string or number is the user (default
+// user_id, user.id, userId, user.email). Users are stored as SHA-256 hashes,
+// only to be counted, so no user ids end up outside the logs themselves.
+//
+// Error groups then report distinct affected users: users (ever),
+// users_last_hour and users_last_day; the dashboard's top groups show the
+// last day. Escalation alerts fired by a grouped log say "this error hit 342
+// users in the last hour".
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultUserFields are the body paths naming the affected user unless -user-field is set
+const defaultUserFields = "user_id,user.id,userId,user.email"
+
+// userFields are the parsed -user-field paths - configured once in main()
+var userFields, _ = parseUserFields(defaultUserFields)
+
+// parseUserFields parses the comma-separated -user-field paths
+func parseUserFields(fields string) ([][]interface{}, error) {
+	var paths [][]interface{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(field), "body."))
+		if field == "" {
+			continue
+		}
+		path, err := parseJSONPath(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user field '%s': %v", field, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// configureUserFields sets the -user-field paths
+func configureUserFields(fields string) error {
+	paths, err := parseUserFields(fields)
+	if err != nil {
+		return err
+	}
+	userFields = paths
+	return nil
+}
+
+// createGroupUsersTable creates the affected users of error groups
+func createGroupUsersTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS error_group_users (
+		fingerprint TEXT NOT NULL,
+		user_hash   TEXT NOT NULL,
+		first_seen  TIMESTAMP NOT NULL,
+		last_seen   TIMESTAMP NOT NULL,
+		PRIMARY KEY (fingerprint, user_hash)
+	);
+	CREATE INDEX IF NOT EXISTS idx_error_group_users_last_seen ON error_group_users(last_seen);
+	`)
+	return err
+}
+
+// bodyUser returns the user a log body names ("" if none)
+func bodyUser(body map[string]interface{}) string {
+	for _, path := range userFields {
+		value, ok := lookupJSONPath(body, path)
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			if user := strings.TrimSpace(v); user != "" {
+				return user
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// userHash is what is stored instead of a user id
+func userHash(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return hex.EncodeToString(sum[:16])
+}
+
+// recordGroupUser counts a user as affected by an error group
+func recordGroupUser(fingerprint, user string) {
+	now := dbTime(time.Now())
+	hash := userHash(user)
+	result, err := db.Exec(db.Rebind("UPDATE error_group_users SET last_seen = ? WHERE fingerprint = ? AND user_hash = ?"), now, fingerprint, hash)
+	if err == nil {
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			return
+		}
+	}
+	db.Exec(db.Rebind("INSERT INTO error_group_users (fingerprint, user_hash, first_seen, last_seen) VALUES (?, ?, ?, ?)"),
+		fingerprint, hash, now, now)
+}
+
+// userImpact is the number of distinct users an error group affected
+type userImpact struct {
+	Total    int
+	LastHour int
+	LastDay  int
+}
+
+// loadUserImpact counts the affected users of the given error groups by fingerprint
+func loadUserImpact(fingerprints []string) (map[string]userImpact, error) {
+	impact := map[string]userImpact{}
+	if len(fingerprints) == 0 {
+		return impact, nil
+	}
+	now := time.Now()
+	args := []interface{}{dbTime(now.Add(-time.Hour)), dbTime(now.Add(-24 * time.Hour))}
+	for _, fingerprint := range fingerprints {
+		args = append(args, fingerprint)
+	}
+	rows, err := db.Query(db.Rebind(`SELECT fingerprint, COUNT(*),
+		SUM(CASE WHEN last_seen >= ? THEN 1 ELSE 0 END), SUM(CASE WHEN last_seen >= ? THEN 1 ELSE 0 END)
+		FROM error_group_users WHERE fingerprint IN (?`+strings.Repeat(", ?", len(fingerprints)-1)+`) GROUP BY fingerprint`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fingerprint string
+		var counts userImpact
+		if err := rows.Scan(&fingerprint, &counts.Total, &counts.LastHour, &counts.LastDay); err != nil {
+			return nil, err
+		}
+		impact[fingerprint] = counts
+	}
+	return impact, rows.Err()
+}
+
+// withUserImpact fills in the affected users of error groups
+func withUserImpact(groups []ErrorGroup) []ErrorGroup {
+	fingerprints := make([]string, len(groups))
+	for i, g := range groups {
+		fingerprints[i] = g.Fingerprint
+	}
+	impact, err := loadUserImpact(fingerprints)
+	if err != nil {
+		return groups
+	}
+	for i := range groups {
+		counts := impact[groups[i].Fingerprint]
+		groups[i].Users, groups[i].UsersLastHour, groups[i].UsersLastDay = counts.Total, counts.LastHour, counts.LastDay
+	}
+	return groups
+}
+
+// userImpactMessage describes how many users the error group of a log hit in
+// the last hour, for alert messages ("" when the log names no users)
+func userImpactMessage(header LogHeader, metadata LogMetadata) string {
+	if !containsString(groupedSeverities, metadata.DerivedSeverity) {
+		return ""
+	}
+	impact, err := loadUserImpact([]string{errorFingerprint(metadata.DerivedSource, header.Title)})
+	if err != nil {
+		return ""
+	}
+	for _, counts := range impact {
+		if counts.LastHour == 1 {
+			return "this error hit 1 user in the last hour"
+		}
+		if counts.LastHour > 1 {
+			return fmt.Sprintf("this error hit %d users in the last hour", counts.LastHour)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestUserImpact tests counting the distinct users an error group hits
+func TestUserImpact(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	defer func() { escalations = nil }()
+	defer configureUserFields(defaultUserFields)
+
+	path := filepath.Join(t.TempDir(), "escalations.json")
+	os.WriteFile(path, []byte(`{"rules": [{"name": "checkout-errors", "match": {"severities": ["error"]},
+		"threshold": 4, "window": "1m", "escalate_to": "critical"}]}`), 0644)
+	if err := loadEscalationRules(path); err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	send := func(body string) {
+		w := httptest.NewRecorder()
+		createLog(w, httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+	for _, body := range []string{`{"user_id": "u-1"}`, `{"user": {"id": 2}}`, `{"user_id": "u-1"}`, `{"cart": 7}`} {
+		send(`{"header": {"title": "Checkout failed", "type": "error", "source": "shop"}, "body": ` + body + `}`)
+	}
+
+	groups, _ := loadErrorGroups(time.Now().Add(-time.Hour), 10)
+	if len(groups) != 1 || groups[0].Users != 2 || groups[0].UsersLastHour != 2 || groups[0].UsersLastDay != 2 {
+		t.Fatalf("Expected one group with two affected users, got %+v", groups)
+	}
+	var stored int
+	db.QueryRow("SELECT COUNT(*) FROM error_group_users WHERE user_hash = 'u-1'").Scan(&stored)
+	if stored != 0 {
+		t.Errorf("Expected user ids stored only as hashes")
+	}
+
+	alerts, _ := recentAlerts(time.Now().Add(-time.Hour), 10)
+	if len(alerts) != 1 || !strings.HasSuffix(alerts[0].Message, "this error hit 2 users in the last hour") {
+		t.Errorf("Expected the alert to name the affected users, got %+v", alerts)
+	}
+
+	// Other user fields
+	if err := configureUserFields("body.customer.ref"); err != nil {
+		t.Fatalf("Expected a valid user field, got %v", err)
+	}
+	send(`{"header": {"title": "Checkout failed", "type": "error", "source": "shop"}, "body": {"customer": {"ref": "c-9"}, "user_id": "u-1"}}`)
+	if group, _ := loadErrorGroup(groups[0].ID); group.Users != 3 {
+		t.Errorf("Expected the customer counted as third user, got %d", group.Users)
+	}
+	if err := configureUserFields("items[x]"); err == nil {
+		t.Errorf("Expected an error for an invalid user field")
+	}
+}
@@ -0,0 +1,139 @@
+// CubicLog Version - What exactly is running, for fleets and support
+//
+//	GET /api/version
+//	cubiclog -version
+//
+// Reports the release version, the git commit and build date, the Go version
+// and platform, the features enabled on this instance and the database schema
+// version (the latest applied migration and whether any are pending). Commit
+// and date come from the Go toolchain's VCS stamping, or from the linker for
+// builds outside a git checkout:
+//
+//	go build -ldflags "-X main.gitCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+// Build details set with -ldflags "-X main.gitCommit=... -X main.buildDate=..."
+var (
+	gitCommit string
+	buildDate string
+)
+
+// buildInfo describes this binary and how the instance runs
+type buildInfo struct {
+	Version   string       `json:"version"`
+	Commit    string       `json:"commit,omitempty"`
+	Modified  bool         `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+	BuildDate string       `json:"build_date,omitempty"`
+	GoVersion string       `json:"go_version"`
+	Platform  string       `json:"platform"`
+	Database  string       `json:"database"`
+	Schema    *schemaState `json:"schema,omitempty"`
+	Features  []string     `json:"features"`
+}
+
+// schemaState is the migration state of the database
+type schemaState struct {
+	Version int `json:"version"` // latest applied migration
+	Latest  int `json:"latest"`  // latest migration this binary knows
+	Pending int `json:"pending"`
+}
+
+// currentBuild returns the version, commit and build date of this binary
+func currentBuild() buildInfo {
+	info := buildInfo{
+		Version:   VERSION,
+		Commit:    gitCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// enabledFeatures lists the optional features switched on for this instance
+func enabledFeatures() []string {
+	features := []string{}
+	for name, enabled := range map[string]bool{
+		"partitioning":  partitionMode,
+		"archives":      len(archives) > 0,
+		"encryption":    fieldCipher != nil,
+		"hash_chain":    hashChainEnabled,
+		"read_only":     readOnlyMode,
+		"validate_only": ingestValidateOnly,
+		"rollups":       rollupAfterDays > 0,
+		"quotas":        quotas != nil,
+		"escalations":   escalations != nil,
+		"alert_webhook": alertWebhookURL != "",
+		"issue_tracker": issueTracker != nil,
+		"slack":         slackSigningSecret != "",
+		"spool":         spoolPath != "",
+		"api_keys":      managedKeysExist(),
+	} {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// currentSchema reads the migration state (nil when it can't be read)
+func currentSchema() *schemaState {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil
+	}
+	state := &schemaState{}
+	for _, m := range migrations {
+		if m.Version > state.Latest {
+			state.Latest = m.Version
+		}
+		if _, ok := applied[m.Version]; !ok {
+			state.Pending++
+		}
+	}
+	for version := range applied {
+		if version > state.Version {
+			state.Version = version
+		}
+	}
+	return state
+}
+
+// handleVersion answers GET /api/version
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	info := currentBuild()
+	info.Database = db.Driver()
+	info.Schema = currentSchema()
+	info.Features = enabledFeatures()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
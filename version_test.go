@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// TestVersionEndpoint tests the build, feature and schema report
+func TestVersionEndpoint(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gitCommit, buildDate = "0a1b2c3", "2024-05-01T12:00:00Z"
+	defer func() { gitCommit, buildDate = "", "" }()
+	hashChainEnabled = true
+	defer func() { hashChainEnabled = false }()
+
+	w := httptest.NewRecorder()
+	handleVersion(w, httptest.NewRequest("GET", "/api/version", nil))
+	var info buildInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("Invalid version JSON: %v", err)
+	}
+	if info.Version != VERSION || info.Commit != "0a1b2c3" || info.BuildDate != "2024-05-01T12:00:00Z" || info.GoVersion != runtime.Version() {
+		t.Errorf("Expected the build details, got %+v", info)
+	}
+	if !containsString(info.Features, "hash_chain") || containsString(info.Features, "read_only") {
+		t.Errorf("Expected hash_chain among the features, got %v", info.Features)
+	}
+	if info.Schema == nil || info.Schema.Version != info.Schema.Latest || info.Schema.Pending != 0 || info.Database != "sqlite3" {
+		t.Errorf("Expected an up-to-date sqlite3 schema, got %s %+v", info.Database, info.Schema)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestEmbeddedUI tests that bundled assets are used and, without the vendoredassets tag, missing ones fall back to their CDN
+func TestEmbeddedUI(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html": {Data: []byte(`<script src="/assets/vendor/alpine.min.js"></script><script src="/assets/vendor/tailwind.js"></script>`)},
+		"vendor/assets.json": {Data: []byte(`[
+			{"path": "alpine.min.js", "url": "https://cdn.example/alpine.js"},
+			{"path": "tailwind.js", "url": "https://cdn.example/tailwind.js"}
+		]`)},
+		"vendor/alpine.min.js": {Data: []byte("/* alpine */")},
+	}
+
+	html, err := loadWebUI(files, defaultBranding)
+	if err != nil {
+		t.Fatalf("Failed to render dashboard: %v", err)
+	}
+	if !cdnFallback && strings.Contains(html, "cdn.example") {
+		t.Errorf("Expected no CDN references with the vendoredassets tag, got %s", html)
+	}
+	html = linkMissingAssets(files, html)
+	if !strings.Contains(html, `"/assets/vendor/alpine.min.js"`) {
+		t.Errorf("Expected bundled Alpine.js to be used, got %s", html)
+	}
+	if !strings.Contains(html, `"https://cdn.example/tailwind.js"`) {
+		t.Errorf("Expected missing Tailwind to fall back to the CDN, got %s", html)
+	}
+
+	// The real dashboard only references local assets or pinned CDN fallbacks
+	if strings.Contains(webUI, "@3.x.x") || strings.Contains(webUI, `src="https://cdn.tailwindcss.com"`) {
+		t.Errorf("Expected no unpinned CDN references in the dashboard")
+	}
+
+	// Assets are served from the embedded vendor directory with long caching
+	w := httptest.NewRecorder()
+	serveAssets(w, httptest.NewRequest("GET", "/assets/vendor/assets.json", nil))
+	if w.Code != 200 || w.Header().Get("Cache-Control") == "" {
+		t.Errorf("Expected cached asset, got %d with Cache-Control '%s'", w.Code, w.Header().Get("Cache-Control"))
+	}
+	w = httptest.NewRecorder()
+	serveAssets(w, httptest.NewRequest("GET", "/assets/vendor/", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected no directory listing, got %d", w.Code)
+	}
+}
@@ -0,0 +1,291 @@
+// CubicLog Excel Export - Logs as a formatted .xlsx workbook
+//
+//	curl -o logs.xlsx "http://localhost:8080/api/export/xlsx?from=2024-01-01"
+//
+// The workbook has two sheets:
+//   - Logs     one row per log with real date cells, a bold frozen header row,
+//     filters on every column and sensible column widths
+//   - Summary  the exported logs by severity and the top sources
+//
+// It takes the same from/to filters as the other exports. The file is written
+// with archive/zip and encoding/xml (no spreadsheet library) and streamed: the
+// Logs sheet is written while rows are read and the summary is built from the
+// same rows, so large exports are not held in memory.
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Excel cell limits
+const (
+	xlsxMaxCellLength = 32767
+	xlsxMaxRows       = 1048576
+)
+
+// xlsxLogColumns are the Logs sheet headers and their widths in characters
+var xlsxLogColumns = []struct {
+	Header string
+	Width  int
+}{
+	{"ID", 8}, {"Timestamp", 20}, {"Severity", 11}, {"Type", 12}, {"Title", 40},
+	{"Description", 40}, {"Source", 18}, {"Category", 14}, {"Body", 60},
+}
+
+// Cell styles, indexes into cellXfs of xlsxStyles
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><color rgb="FFFFFFFF"/><name val="Calibri"/></font></fonts>
+<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill><fill><patternFill patternType="solid"><fgColor rgb="FF3B82F6"/><bgColor indexed="64"/></patternFill></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Logs" sheetId="1" r:id="rId1"/><sheet name="Summary" sheetId="2" r:id="rId2"/></sheets>
+<definedNames><definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">Logs!$A$1:$%s$%d</definedName></definedNames>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+// xlsxSheet writes the rows of one worksheet
+type xlsxSheet struct {
+	w   io.Writer
+	row int
+}
+
+// xlsxColumnName turns a 0-based index into A, B, ..., Z, AA, ...
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxDate converts a time to an Excel serial date (days since 1899-12-30)
+func xlsxDate(t time.Time) float64 {
+	return t.UTC().Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+// start writes the worksheet preamble; widths sets column widths and
+// freeze keeps the first row visible while scrolling
+func (s *xlsxSheet) start(widths []int, freeze bool) {
+	io.WriteString(s.w, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if freeze {
+		io.WriteString(s.w, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	io.WriteString(s.w, "<cols>")
+	for i, width := range widths {
+		fmt.Fprintf(s.w, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+	}
+	io.WriteString(s.w, "</cols><sheetData>")
+}
+
+// writeRow writes one row; values are strings, ints, float64s or time.Time
+func (s *xlsxSheet) writeRow(style int, values ...interface{}) {
+	s.row++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.row)
+	for i, value := range values {
+		ref := xlsxColumnName(i) + strconv.Itoa(s.row)
+		switch v := value.(type) {
+		case int:
+			fmt.Fprintf(s.w, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+		case float64:
+			fmt.Fprintf(s.w, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			fmt.Fprintf(s.w, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleDate, strconv.FormatFloat(xlsxDate(v), 'f', 6, 64))
+		case string:
+			if v == "" {
+				continue
+			}
+			if len(v) > xlsxMaxCellLength {
+				v = strings.ToValidUTF8(v[:xlsxMaxCellLength], "")
+			}
+			fmt.Fprintf(s.w, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+			xml.EscapeText(s.w, []byte(v))
+			io.WriteString(s.w, "</t></is></c>")
+		}
+	}
+	io.WriteString(s.w, "</row>")
+}
+
+// finish closes the worksheet, with an autofilter over columns when set
+func (s *xlsxSheet) finish(filterColumns int) {
+	io.WriteString(s.w, "</sheetData>")
+	if filterColumns > 0 && s.row > 0 {
+		fmt.Fprintf(s.w, `<autoFilter ref="A1:%s%d"/>`, xlsxColumnName(filterColumns-1), s.row)
+	}
+	io.WriteString(s.w, "</worksheet>")
+}
+
+// handleExportXLSX exports logs as an Excel workbook with optional date filtering
+func handleExportXLSX(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := parseSample(r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attached, err := selectArchives(r.URL.Query().Get("attach"), r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, release, err := queryArchivedLogs(r.URL.Query().Get("from"), r.URL.Query().Get("to"), attached, func(table string) (string, []interface{}) {
+		return buildExportQuery(r, table, partitionColumns)
+	})
+	if err != nil {
+		log.Printf("Export query error: %v", err)
+		writeQueryError(w, err, "Export query failed")
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", "attachment; filename=cubiclog_export.xlsx")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+
+	// Logs sheet, streamed while counting severities and sources for the summary
+	part, _ := archive.Create("xl/worksheets/sheet1.xml")
+	logs := &xlsxSheet{w: part}
+	widths := make([]int, len(xlsxLogColumns))
+	header := make([]interface{}, len(xlsxLogColumns))
+	for i, column := range xlsxLogColumns {
+		widths[i], header[i] = column.Width, column.Header
+	}
+	logs.start(widths, true)
+	logs.writeRow(xlsxStyleHeader, header...)
+
+	total, truncated := 0, false
+	severities, sources := map[string]int{}, map[string]int{}
+	var first, last time.Time
+	for rows.Next() {
+		var row exportRow
+		if err := row.scan(rows); err != nil {
+			continue
+		}
+		if logs.row >= xlsxMaxRows {
+			truncated = true
+			break
+		}
+		logs.writeRow(xlsxStyleDefault, row.ID, row.Timestamp, row.Severity.String, row.Type, row.Title,
+			openField(row.Description.String), row.Source.String, row.Category.String, openField(row.Body.String))
+
+		total++
+		severities[valueOr(row.Severity.String, "unknown")]++
+		sources[valueOr(row.DerivedSource.String, valueOr(row.Source.String, "unknown"))]++
+		if first.IsZero() || row.Timestamp.Before(first) {
+			first = row.Timestamp
+		}
+		if row.Timestamp.After(last) {
+			last = row.Timestamp
+		}
+	}
+	logs.finish(len(xlsxLogColumns))
+
+	// Summary sheet
+	part, _ = archive.Create("xl/worksheets/sheet2.xml")
+	summary := &xlsxSheet{w: part}
+	summary.start([]int{24, 12, 10}, false)
+	summary.writeRow(xlsxStyleHeader, "CubicLog Export")
+	summary.writeRow(xlsxStyleDefault, "Exported at", time.Now())
+	summary.writeRow(xlsxStyleDefault, "Logs", total)
+	if total > 0 {
+		summary.writeRow(xlsxStyleDefault, "First log", first)
+		summary.writeRow(xlsxStyleDefault, "Last log", last)
+	}
+	if truncated {
+		summary.writeRow(xlsxStyleDefault, fmt.Sprintf("Truncated to Excel's limit of %d rows - narrow the date range", xlsxMaxRows-1))
+	}
+	summary.writeRow(xlsxStyleDefault)
+	summary.writeRow(xlsxStyleHeader, "Severity", "Logs", "Share (%)")
+	for _, entry := range sortedCounts(severities, 0) {
+		summary.writeRow(xlsxStyleDefault, entry.Name, entry.Count, percent(entry.Count, total))
+	}
+	summary.writeRow(xlsxStyleDefault)
+	summary.writeRow(xlsxStyleHeader, "Top Sources", "Logs", "Share (%)")
+	for _, entry := range sortedCounts(sources, 10) {
+		summary.writeRow(xlsxStyleDefault, entry.Name, entry.Count, percent(entry.Count, total))
+	}
+	summary.finish(0)
+
+	// Package parts
+	for name, content := range map[string]string{
+		"[Content_Types].xml":        xlsxContentTypes,
+		"_rels/.rels":                xlsxRootRels,
+		"xl/workbook.xml":            fmt.Sprintf(xlsxWorkbook, xlsxColumnName(len(xlsxLogColumns)-1), logs.row),
+		"xl/_rels/workbook.xml.rels": xlsxWorkbookRels,
+		"xl/styles.xml":              xlsxStyles,
+	} {
+		part, _ := archive.Create(name)
+		io.WriteString(part, content)
+	}
+}
+
+// sortedCounts orders counts by size, keeping at most limit entries (0 for all)
+func sortedCounts(counts map[string]int, limit int) []SourceCount {
+	entries := make([]SourceCount, 0, len(counts))
+	for name, count := range counts {
+		entries = append(entries, SourceCount{Name: name, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// valueOr returns value, or fallback when it is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
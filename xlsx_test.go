@@ -0,0 +1,64 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestExportXLSX tests that the Excel export is a well-formed workbook with logs and a summary
+func TestExportXLSX(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, body := range []string{
+		`{"header":{"type":"error","title":"Payment <failed> & retried","source":"billing"}}`,
+		`{"header":{"type":"info","title":"Invoice sent","source":"billing"}}`,
+	} {
+		createLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/logs", strings.NewReader(body)))
+	}
+
+	w := httptest.NewRecorder()
+	handleExportXLSX(w, httptest.NewRequest("GET", "/api/export/xlsx", nil))
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip archive: %v", err)
+	}
+
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		parts[file.Name] = string(data)
+
+		// Every part must be well-formed XML
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Malformed XML in %s: %v", file.Name, err)
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("Expected part %s in the workbook", name)
+		}
+	}
+	if logs := parts["xl/worksheets/sheet1.xml"]; !strings.Contains(logs, "Payment &lt;failed&gt; &amp; retried") || !strings.Contains(logs, `<autoFilter ref="A1:I3"/>`) {
+		t.Errorf("Expected both logs and a filter over them in the Logs sheet, got %s", logs)
+	}
+	if summary := parts["xl/worksheets/sheet2.xml"]; !strings.Contains(summary, "<t xml:space=\"preserve\">billing</t></is></c><c r=\"B") {
+		t.Errorf("Expected billing among the top sources in the Summary sheet, got %s", summary)
+	}
+	if xlsxColumnName(0) != "A" || xlsxColumnName(26) != "AA" {
+		t.Errorf("Expected column names A and AA, got %s and %s", xlsxColumnName(0), xlsxColumnName(26))
+	}
+}